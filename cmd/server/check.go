@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/agent"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/config"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/gitprovider"
+)
+
+// repoCheckTimeout bounds checking one repository's credential.
+const repoCheckTimeout = 30 * time.Second
+
+// checkConfig loads and validates the configuration, checks that every
+// mapped repository is reachable with the permissions fixes need and that
+// the fix backend can run, and writes a report to w. It reports whether
+// every check passed.
+func checkConfig(ctx context.Context, w io.Writer) bool {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(w, "FAIL  config: %v\n", err)
+		return false
+	}
+	fmt.Fprintln(w, "ok    config loaded")
+	for _, secret := range cfg.ManagedSecrets {
+		fmt.Fprintf(w, "ok    %s fetched from a secret manager\n", secret)
+	}
+
+	passed := checkFixBackend(ctx, w, cfg)
+
+	mappings := cfg.AllRepoMappings()
+	fmt.Fprintf(w, "ok    %d repo mapping(s)", len(mappings))
+	patterns := len(cfg.RepoPatterns)
+	for _, t := range cfg.Tenants {
+		patterns += len(t.RepoPatterns)
+	}
+	if patterns > 0 {
+		fmt.Fprintf(w, " and %d pattern(s); repositories from patterns are checked when first used", patterns)
+	}
+	fmt.Fprintln(w)
+
+	// Mappings sharing a repository are checked once
+	checked := make(map[string]bool)
+	for _, m := range mappings {
+		if checked[m.FullName()] {
+			continue
+		}
+		checked[m.FullName()] = true
+		if !checkRepo(ctx, w, m) {
+			passed = false
+		}
+	}
+	return passed
+}
+
+// checkFixBackend verifies that the Claude Code CLI can run when fixes are
+// generated with it: on the host, or in its sandbox image when one is
+// configured.
+func checkFixBackend(ctx context.Context, w io.Writer, cfg *config.Config) bool {
+	if cfg.FixBackend != agent.BackendClaudeCode {
+		fmt.Fprintf(w, "ok    fix backend %s\n", cfg.FixBackend)
+		return true
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	if cfg.ClaudeSandboxImage != "" {
+		return checkSandbox(ctx, w, cfg.ClaudeSandboxImage)
+	}
+
+	path, err := exec.LookPath("claude")
+	if err != nil {
+		fmt.Fprintf(w, "FAIL  fix backend %s: claude not found in PATH\n", agent.BackendClaudeCode)
+		return false
+	}
+	out, err := exec.CommandContext(ctx, path, "--version").Output()
+	if err != nil {
+		fmt.Fprintf(w, "FAIL  fix backend %s: %s --version: %v\n", agent.BackendClaudeCode, path, err)
+		return false
+	}
+	fmt.Fprintf(w, "ok    fix backend %s: %s (%s)\n", agent.BackendClaudeCode, path, strings.TrimSpace(string(out)))
+	return true
+}
+
+// checkSandbox verifies that docker is installed and has the sandbox image
+// the Claude Code CLI runs in.
+func checkSandbox(ctx context.Context, w io.Writer, image string) bool {
+	path, err := exec.LookPath("docker")
+	if err != nil {
+		fmt.Fprintf(w, "FAIL  fix backend %s: docker not found in PATH for sandbox image %s\n", agent.BackendClaudeCode, image)
+		return false
+	}
+	if err := exec.CommandContext(ctx, path, "image", "inspect", image).Run(); err != nil {
+		fmt.Fprintf(w, "FAIL  fix backend %s: sandbox image %s: %v; pull or build it first\n", agent.BackendClaudeCode, image, err)
+		return false
+	}
+	fmt.Fprintf(w, "ok    fix backend %s: sandbox image %s\n", agent.BackendClaudeCode, image)
+	return true
+}
+
+// checkRepo verifies that a repository's credential can read, branch and
+// open PRs, and that its base branch exists.
+func checkRepo(ctx context.Context, w io.Writer, m *config.RepoMapping) bool {
+	ctx, cancel := context.WithTimeout(ctx, repoCheckTimeout)
+	defer cancel()
+
+	name := m.FullName()
+	if m.Tenant != "" {
+		name += " (tenant " + m.Tenant + ")"
+	}
+
+	provider := gitprovider.NewGitHubProvider(m.GitHubToken, m.Owner, m.Repo)
+	caps, err := provider.CheckCapabilities(ctx)
+	switch {
+	case len(caps.Problems) > 0:
+		fmt.Fprintf(w, "FAIL  repo %s: %s\n", name, strings.Join(caps.Problems, "; "))
+		return false
+	case err != nil:
+		fmt.Fprintf(w, "FAIL  repo %s: %v\n", name, err)
+		return false
+	}
+
+	if m.BaseBranch != "" {
+		if _, err := provider.GetLatestCommitSHA(ctx, m.BaseBranch); err != nil {
+			fmt.Fprintf(w, "FAIL  repo %s: base branch %s: %v\n", name, m.BaseBranch, err)
+			return false
+		}
+	}
+	fmt.Fprintf(w, "ok    repo %s: credential can read, branch and open PRs\n", name)
+	return true
+}
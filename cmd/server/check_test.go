@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/agent"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/config"
+)
+
+func TestCheckFixBackend(t *testing.T) {
+	// docker knows only the sandbox:ok image, and claude isn't installed
+	bin := t.TempDir()
+	docker := "#!/bin/sh\n[ \"$3\" = sandbox:ok ]\n"
+	if err := os.WriteFile(filepath.Join(bin, "docker"), []byte(docker), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+
+	tests := []struct {
+		name    string
+		backend string
+		image   string
+		want    bool
+		output  string
+	}{
+		{"other backend", "api", "", true, "ok    fix backend api"},
+		{"claude on the host", agent.BackendClaudeCode, "", false, "claude not found in PATH"},
+		{"sandbox image", agent.BackendClaudeCode, "sandbox:ok", true, "sandbox image sandbox:ok"},
+		{"missing sandbox image", agent.BackendClaudeCode, "sandbox:missing", false, "pull or build it first"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			cfg := &config.Config{FixBackend: tt.backend, ClaudeSandboxImage: tt.image}
+			if got := checkFixBackend(context.Background(), &out, cfg); got != tt.want {
+				t.Errorf("checkFixBackend() = %v, want %v (%s)", got, tt.want, out.String())
+			}
+			if !strings.Contains(out.String(), tt.output) {
+				t.Errorf("output = %q, want it to contain %q", out.String(), tt.output)
+			}
+		})
+	}
+}
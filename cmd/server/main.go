@@ -2,17 +2,38 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+	"google.golang.org/grpc"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/admin"
 	"github.com/Mariscal6/sentry-claude-auto-pr/internal/agent"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/archive"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/callback"
 	"github.com/Mariscal6/sentry-claude-auto-pr/internal/config"
 	"github.com/Mariscal6/sentry-claude-auto-pr/internal/gitprovider"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/ingest"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/ingest/ingestpb"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/learning"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/queue"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/sentry"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/store"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/tools"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/tracking"
 	"github.com/Mariscal6/sentry-claude-auto-pr/internal/webhook"
 )
 
@@ -20,45 +41,359 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// "config check" validates the configuration instead of serving
+	if args := os.Args[1:]; len(args) > 0 {
+		if len(args) != 2 || args[0] != "config" || args[1] != "check" {
+			log.Fatalf("Unknown command %q (the only command is config check)", strings.Join(args, " "))
+		}
+		if !checkConfig(ctx, os.Stdout) {
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Load configuration
 	cfg, err := config.Load()
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
+	if len(cfg.ManagedSecrets) > 0 {
+		log.Printf("Fetched %s from a secret manager, refreshing every %s", strings.Join(cfg.ManagedSecrets, ", "), cfg.SecretsRefreshInterval)
+	}
+
+	if cfg.DryRun {
+		log.Println("Dry run: fixes are generated and logged, but no branch, commit or PR is created")
+	}
+
 	// Log configured repo mappings
 	log.Printf("Configured %d repo mapping(s):", len(cfg.RepoMappings))
 	for _, m := range cfg.RepoMappings {
+		if m.BaseBranch != "" {
+			log.Printf("  %s -> %s/%s (base %s)", m.SentryProject, m.Owner, m.Repo, m.BaseBranch)
+			continue
+		}
 		log.Printf("  %s -> %s/%s", m.SentryProject, m.Owner, m.Repo)
 	}
+	for _, p := range cfg.RepoPatterns {
+		log.Printf("  %s -> %s/%s (pattern)", p.Project, p.Owner, p.Repo)
+	}
+
+	// Open the reviewer feedback learning store
+	learningStore, err := learning.NewStore(cfg.LearningStorePath)
+	if err != nil {
+		log.Fatalf("Failed to open learning store: %v", err)
+	}
+
+	// Authenticate to Google Cloud up front so bad credentials fail at startup
+	var vertex *tools.VertexOptions
+	if cfg.FixBackend == agent.BackendVertex {
+		token, err := tools.VertexToken(ctx, cfg.VertexCredentialsFile)
+		if err != nil {
+			log.Fatalf("Failed to set up Vertex AI: %v", err)
+		}
+		vertex = &tools.VertexOptions{ProjectID: cfg.VertexProjectID, Region: cfg.VertexRegion, Token: token}
+	}
+
+	// Without a cache, each job clones into a workspace of its own
+	var workDirs *tools.WorkDirs
+	if cfg.WorkspaceCacheDir == "" {
+		if workDirs, err = tools.NewWorkDirs(cfg.WorkspaceDir, cfg.WorkspaceQuota, cfg.WorkspaceMaxAge); err != nil {
+			log.Fatalf("Failed to set up workspaces: %v", err)
+		}
+	}
+
+	// Create agent pipeline (uses Claude Code, the Anthropic API or Vertex AI)
+	pipeline, err := agent.NewPipeline(learningStore, agent.PipelineOptions{
+		Backend:         cfg.FixBackend,
+		AnthropicAPIKey: cfg.AnthropicAPIKey,
+		Model:           cfg.AnthropicModel,
+		BaseURL:         cfg.AnthropicBaseURL,
+		Vertex:          vertex,
+		ClaudeCode: tools.ClaudeCodeOptions{
+			MaxTurns:       cfg.ClaudeMaxTurns,
+			AllowedTools:   cfg.ClaudeAllowedTools,
+			PermissionMode: cfg.ClaudePermissionMode,
+			ExtraArgs:      cfg.ClaudeExtraArgs,
+			SubmitTool:     cfg.ClaudeSubmitTool,
+			Sandbox:        claudeSandbox(cfg),
+		},
+		WorkspaceCacheDir:  cfg.WorkspaceCacheDir,
+		WorkDirs:           workDirs,
+		CloneDepth:         cfg.CloneDepth,
+		SourceContextLines: cfg.SourceContextLines,
+		CulpritHistory:     cfg.CulpritHistoryCommits,
+		TestTimeout:        cfg.TestTimeout,
+		CheckEnv:           cfg.CheckEnv,
+		RegressionTests:    cfg.RegressionTests,
+		DiffFormat:         cfg.FixFormat == "diff",
+		RepairAttempts:     cfg.RepairAttempts,
+		Review: agent.ReviewOptions{
+			Enabled:         cfg.ReviewFixes,
+			MaxRevisions:    cfg.ReviewMaxRevisions,
+			MinChangedLines: cfg.ReviewMinChangedLines,
+		},
+		ReleaseArtifacts: func(repo *config.RepoMapping) (*sentry.Client, string) {
+			token := cfg.TenantSentryAuthToken(repo.Tenant)
+			if token == "" {
+				return nil, ""
+			}
+			return sentry.NewClient(cfg.TenantSentryURL(repo.Tenant), token), cfg.TenantSentryOrg(repo.Tenant)
+		},
+		MaxSessions: cfg.MaxClaudeSessions,
+		ProcessLimits: tools.ProcessLimits{
+			Memory:   cfg.ProcessMemoryLimit,
+			CPUTime:  cfg.ProcessCPULimit,
+			FileSize: cfg.ProcessFileSizeLimit,
+			Output:   cfg.ProcessOutputLimit,
+		},
+	})
+	if err != nil {
+		log.Fatalf("Failed to create pipeline: %v", err)
+	}
+	log.Printf("Generating fixes with %s", cfg.FixBackend)
 
-	// Create agent pipeline (uses Claude Code internally)
-	pipeline := agent.NewPipeline(cfg.AnthropicAPIKey)
+	// Detect vulnerability-class errors for the private advisory flow
+	securityPatterns := cfg.SecurityPatterns
+	if len(securityPatterns) == 0 {
+		securityPatterns = agent.DefaultSecurityPatterns
+	}
+	security, err := agent.NewSecurityClassifier(securityPatterns)
+	if err != nil {
+		log.Fatalf("Failed to load security patterns: %v", err)
+	}
 
 	// Create job queue for async webhook processing
-	jobQueue := make(chan webhook.Job, 100)
+	jobQueue, err := queue.Open(ctx, cfg.QueueBackend, queue.Options{
+		Capacity:    cfg.QueueCapacity,
+		RedisURL:    cfg.RedisURL,
+		RedisKey:    cfg.RedisQueueKey,
+		SQLitePath:  cfg.SQLitePath,
+		PostgresURL: cfg.DatabaseURL,
+		NATSURL:     cfg.NATSURL,
+		NATSStream:  cfg.NATSStream,
+		ClaimAfter:  cfg.QueueClaimAfter,
+	})
+	if err != nil {
+		log.Fatalf("Failed to open %s job queue: %v", cfg.QueueBackend, err)
+	}
+	defer jobQueue.Close()
+	log.Printf("Using %s job queue", cfg.QueueBackend)
 
-	// Start job processor
-	go processJobs(ctx, jobQueue, cfg, pipeline)
+	// Frontends only queue jobs and workers only process them, so the
+	// Claude Code stage can be scaled separately from webhook intake
+	runWorkers := cfg.Role != "frontend"
+	receiveWebhooks := cfg.Role != "worker"
+	log.Printf("Running as %s", cfg.Role)
+
+	// Jobs that fail after exhausting their retries wait here to be requeued
+	deadLetters, err := queue.OpenDeadLetters(cfg.DataPath("dead-letters.json"))
+	if err != nil {
+		log.Fatalf("Failed to open dead-letter queue: %v", err)
+	}
+
+	// Cap fix PRs per repository per day; jobs over the cap wait for tomorrow
+	budget, err := agent.NewPRBudget(cfg.DataPath("pr-budget.json"))
+	if err != nil {
+		log.Fatalf("Failed to open PR budget: %v", err)
+	}
+	if runWorkers {
+		go releaseDeferredJobs(ctx, budget, jobQueue)
+	}
+
+	// Record the outcome of every job for the admin API
+	history, err := tracking.Open(cfg.DataPath("history.json"), cfg.HistoryRetention)
+	if err != nil {
+		log.Fatalf("Failed to open job history: %v", err)
+	}
+	var audit *tracking.AuditTrail
+	if cfg.AuditTrail {
+		if audit, err = tracking.OpenAuditTrail(cfg.DataPath("audit"), cfg.HistoryRetention, agent.RedactSecrets); err != nil {
+			log.Fatalf("Failed to open audit trail: %v", err)
+		}
+	}
+
+	// Job progress, so jobs interrupted by a crash resume where they left off
+	checkpoints, err := agent.OpenCheckpoints(cfg.DataPath("checkpoints.json"))
+	if err != nil {
+		log.Fatalf("Failed to open job checkpoints: %v", err)
+	}
+
+	// Tell external systems about each job's progress (nil if no URLs are configured)
+	callbacks := callback.NewNotifier(cfg.CallbackURLs, cfg.CallbackSecret)
+	intake := callbacks.Queue(jobQueue)
+
+	// Account tokens and cost per repository, pausing fix generation once a
+	// monthly budget runs out; jobs over budget wait for the next month
+	costs, err := agent.NewCostBudget(cfg.DataPath("usage.json"), agent.CostLimits{
+		MonthlyUSD:     cfg.CostBudgetMonthlyUSD,
+		RepoMonthlyUSD: cfg.CostBudgetRepoMonthlyUSD,
+	}, func(e agent.Exhaustion) {
+		log.Printf("Reached the %s, pausing fix generation until next month", e)
+		callbacks.NotifyBudgetExhausted(e.Repo, e.SpentUSD, e.LimitUSD)
+	})
+	if err != nil {
+		log.Fatalf("Failed to open cost budget: %v", err)
+	}
+	if runWorkers {
+		go releaseDeferredJobs(ctx, costs, jobQueue)
+	}
+
+	var workers *sync.WaitGroup
+	if runWorkers {
+		// Start job workers
+		workers = processJobs(ctx, jobQueue, deadLetters, budget, costs, history, audit, checkpoints, callbacks, cfg, pipeline, security)
+
+		// Start stale PR sweeper
+		stalePolicy := agent.StalePolicy{
+			NudgeAfter: time.Duration(cfg.StalePRNudgeDays) * 24 * time.Hour,
+			CloseAfter: time.Duration(cfg.StalePRCloseDays) * 24 * time.Hour,
+		}
+		if stalePolicy.Enabled() {
+			go sweepStalePullRequests(ctx, cfg, stalePolicy)
+		}
+
+		// Start reviewer feedback ingestion
+		go ingestReviewFeedback(ctx, cfg, learningStore)
+	}
 
 	// Set up HTTP server
 	mux := http.NewServeMux()
 
-	// Webhook endpoint with signature verification
-	signatureVerifier := webhook.NewSignatureVerifier(cfg.SentryWebhookSecret)
-	webhookHandler := webhook.NewHandler(jobQueue)
-	mux.Handle("/webhook/sentry", signatureVerifier.Middleware(webhookHandler))
+	// Webhook endpoints with signature verification
+	deliveries, err := store.NewSeenSet(cfg.DataPath("deliveries.json"), cfg.DeliveryRetention)
+	if err != nil {
+		log.Fatalf("Failed to open delivery store: %v", err)
+	}
+	handlerOpts := webhook.HandlerOptions{
+		Deliveries: deliveries,
+		RetryAfter: cfg.QueueRetryAfter,
+	}
+
+	// Archive raw payloads for debugging and replay
+	var payloadArchive archive.Archive
+	if cfg.ArchiveURL != "" {
+		payloadArchive, err = archive.Open(ctx, cfg.ArchiveURL)
+		if err != nil {
+			log.Fatalf("Failed to open payload archive: %v", err)
+		}
+		handlerOpts.Archive = payloadArchive
+		go prunePayloadArchive(ctx, payloadArchive, cfg.ArchiveRetention)
+	}
+
+	if receiveWebhooks {
+		mux.Handle("/webhook/sentry", newWebhookHandler(cfg, intake, handlerOpts, ""))
+		for _, t := range cfg.Tenants {
+			log.Printf("Tenant %s: %d repo mapping(s) and %d pattern(s) at /webhook/sentry/%s", t.Name, len(t.RepoMappings), len(t.RepoPatterns), t.Name)
+			mux.Handle("/webhook/sentry/"+t.Name, newWebhookHandler(cfg, intake, handlerOpts, t.Name))
+		}
+	}
 
 	// Health check
 	mux.HandleFunc("/health", webhook.HealthHandler())
 
+	// Verify credentials against every mapped repo before the first alert arrives
+	repoStatus := admin.NewRepoStatusBoard()
+	go checkRepoCapabilities(ctx, cfg, repoStatus)
+
+	// Pick up new repo mappings, filters and per-repo settings without a
+	// restart, leaving queued jobs in place
+	go reloadConfig(ctx, cfg, func() {
+		go checkRepoCapabilities(ctx, cfg, repoStatus)
+	})
+
+	// Admin API (disabled unless a token is configured)
+	if cfg.AdminToken != "" {
+		adminOpts := admin.Options{
+			Repos: repoStatus,
+			Enqueue: func(job webhook.Job) error {
+				return intake.Enqueue(ctx, job)
+			},
+			DeadLetters: deadLetters,
+			History:     history,
+			Audit:       audit,
+			Usage:       costs,
+			LoadIssue: func(ctx context.Context, tenant, issueID string) (*webhook.SentryWebhook, error) {
+				token := cfg.TenantSentryAuthToken(tenant)
+				if token == "" {
+					return nil, fmt.Errorf("no Sentry auth token configured for tenant %q", tenant)
+				}
+				return sentry.NewClient(cfg.TenantSentryURL(tenant), token).LoadIssue(ctx, issueID)
+			},
+		}
+		if payloadArchive != nil {
+			adminOpts.Archive = payloadArchive
+		}
+		adminHandler := admin.NewHandler(cfg.AdminToken, adminOpts)
+		mux.Handle("/admin/", adminHandler)
+		mux.Handle("/jobs", adminHandler)
+	}
+
+	// gRPC ingestion API for internal error pipelines (disabled unless an address is configured)
+	var grpcServer *grpc.Server
+	if cfg.GRPCAddr != "" && receiveWebhooks {
+		lis, err := net.Listen("tcp", cfg.GRPCAddr)
+		if err != nil {
+			log.Fatalf("Failed to listen for gRPC on %s: %v", cfg.GRPCAddr, err)
+		}
+		grpcServer = grpc.NewServer(grpc.UnaryInterceptor(ingest.AuthInterceptor(cfg.GRPCToken)))
+		// Submissions name their tenant, whose mappings set some filters
+		tenantFilters := map[string][]webhook.Filter{"": webhookFilters(cfg, "")}
+		for _, t := range cfg.Tenants {
+			tenantFilters[t.Name] = webhookFilters(cfg, t.Name)
+		}
+		ingestpb.RegisterIngestServiceServer(grpcServer, ingest.NewServer(intake, func(tenant string) ([]webhook.Filter, bool) {
+			filters, ok := tenantFilters[tenant]
+			return filters, ok
+		}))
+		go func() {
+			log.Printf("Starting gRPC ingestion API on %s", cfg.GRPCAddr)
+			if err := grpcServer.Serve(lis); err != nil {
+				log.Printf("gRPC server error: %v", err)
+			}
+		}()
+	}
+
 	// Create server
+	var handler http.Handler = mux
+	if cfg.HTTPMaxBodyBytes > 0 {
+		handler = http.MaxBytesHandler(mux, cfg.HTTPMaxBodyBytes)
+	}
 	server := &http.Server{
-		Addr:         ":" + cfg.Port,
-		Handler:      mux,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
-		IdleTimeout:  120 * time.Second,
+		Addr:           ":" + cfg.Port,
+		Handler:        handler,
+		ReadTimeout:    cfg.HTTPReadTimeout,
+		WriteTimeout:   cfg.HTTPWriteTimeout,
+		IdleTimeout:    cfg.HTTPIdleTimeout,
+		MaxHeaderBytes: int(cfg.HTTPMaxHeaderBytes),
+	}
+
+	// Serve HTTPS directly when configured, answering ACME challenges on a
+	// separate plain HTTP listener
+	var challengeServer *http.Server
+	if len(cfg.ACMEDomains) > 0 {
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.ACMEDomains...),
+			Cache:      autocert.DirCache(cfg.ACMECacheDir),
+			Email:      cfg.ACMEEmail,
+		}
+		if cfg.ACMEDirectoryURL != "" {
+			manager.Client = &acme.Client{DirectoryURL: cfg.ACMEDirectoryURL}
+		}
+		server.TLSConfig = manager.TLSConfig()
+		challengeServer = &http.Server{
+			Addr:         ":" + cfg.ACMEHTTPPort,
+			Handler:      manager.HTTPHandler(nil),
+			ReadTimeout:  10 * time.Second,
+			WriteTimeout: 10 * time.Second,
+		}
+		go func() {
+			log.Printf("Answering ACME challenges for %s on :%s", strings.Join(cfg.ACMEDomains, ", "), cfg.ACMEHTTPPort)
+			if err := challengeServer.ListenAndServe(); err != http.ErrServerClosed {
+				log.Printf("ACME challenge server error: %v", err)
+			}
+		}()
 	}
 
 	// Graceful shutdown
@@ -76,65 +411,1087 @@ func main() {
 		if err := server.Shutdown(shutdownCtx); err != nil {
 			log.Printf("Server shutdown error: %v", err)
 		}
+		if grpcServer != nil {
+			grpcServer.GracefulStop()
+		}
+		if challengeServer != nil {
+			challengeServer.Close()
+		}
 	}()
 
-	log.Printf("Starting server on :%s", cfg.Port)
+	scheme := "HTTP"
+	if cfg.TLSCertFile != "" || server.TLSConfig != nil {
+		scheme = "HTTPS"
+	}
+	log.Printf("Starting %s server on :%s", scheme, cfg.Port)
 	log.Println("Endpoints:")
-	log.Println("  POST /webhook/sentry - Sentry webhook endpoint")
+	if receiveWebhooks {
+		log.Println("  POST /webhook/sentry - Sentry webhook endpoint")
+	}
 	log.Println("  GET /health - Health check")
-	log.Println("")
-	log.Println("Note: This service uses Claude Code CLI for fix generation.")
-	log.Println("Ensure 'claude' is installed and available in PATH.")
+	if cfg.AdminToken != "" {
+		log.Println("  GET /admin/repos - Repository capability status")
+		log.Println("  POST /admin/replay[/{payloadID}] - Replay a webhook payload")
+		log.Println("  POST /jobs - Queue a job for a Sentry issue")
+	}
+	if cfg.FixBackend == agent.BackendClaudeCode {
+		log.Println("")
+		log.Println("Note: This service uses Claude Code CLI for fix generation.")
+		log.Println("Ensure 'claude' is installed and available in PATH.")
+	}
 
-	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+	switch {
+	case server.TLSConfig != nil:
+		// Certificates come from the ACME manager
+		err = server.ListenAndServeTLS("", "")
+	case cfg.TLSCertFile != "":
+		err = server.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+	default:
+		err = server.ListenAndServe()
+	}
+	if err != http.ErrServerClosed {
 		log.Fatalf("Server error: %v", err)
 	}
 
+	// Exiting now would leave the Claude Code sessions and test runs of
+	// cancelled jobs running
+	if workers != nil {
+		waitForWorkers(workers, workerShutdownTimeout)
+	}
+
 	log.Println("Server stopped")
 }
 
-// processJobs processes webhook jobs from the queue.
-func processJobs(ctx context.Context, jobs <-chan webhook.Job, cfg *config.Config, pipeline *agent.Pipeline) {
+// prunePayloadArchive periodically deletes archived payloads older than retention.
+func prunePayloadArchive(ctx context.Context, a archive.Archive, retention time.Duration) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
 	for {
+		removed, err := a.Prune(ctx, time.Now().Add(-retention))
+		if err != nil {
+			log.Printf("Payload archive pruning failed: %v", err)
+		} else if removed > 0 {
+			log.Printf("Pruned %d archived payload(s)", removed)
+		}
+
 		select {
 		case <-ctx.Done():
 			return
-		case job := <-jobs:
-			processJob(ctx, job, cfg, pipeline)
+		case <-ticker.C:
+		}
+	}
+}
+
+// deferrer holds jobs back while a budget is exhausted.
+type deferrer interface {
+	Defer(job webhook.Job) error
+	Release() ([]webhook.Job, error)
+}
+
+// releaseDeferredJobs periodically requeues jobs that were deferred because
+// a budget was exhausted in an earlier day or month.
+func releaseDeferredJobs(ctx context.Context, budget deferrer, jobs queue.Queue) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		released, err := budget.Release()
+		if err != nil {
+			log.Printf("Failed to release deferred jobs: %v", err)
+		}
+		for _, job := range released {
+			err := jobs.Enqueue(ctx, job)
+			switch {
+			case err == nil:
+				log.Printf("Requeued deferred job for issue %s", job.ParsedError.IssueID)
+			case errors.Is(err, webhook.ErrDuplicateJob):
+				// A newer job for the issue is already queued
+			default:
+				log.Printf("Failed to requeue deferred job for issue %s: %v", job.ParsedError.IssueID, err)
+				if err := budget.Defer(job); err != nil {
+					log.Printf("Failed to defer job for issue %s: %v", job.ParsedError.IssueID, err)
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// claudeSandbox returns the container Claude Code and the commands checking
+// fixes run in, or nil to run them on the host.
+func claudeSandbox(cfg *config.Config) *tools.DockerSandbox {
+	if cfg.ClaudeSandboxImage == "" {
+		return nil
+	}
+	return &tools.DockerSandbox{
+		Image:     cfg.ClaudeSandboxImage,
+		Network:   cfg.ClaudeSandboxNetwork,
+		Proxy:     cfg.ClaudeSandboxProxy,
+		CPUs:      cfg.ClaudeSandboxCPUs,
+		Memory:    cfg.ClaudeSandboxMemory,
+		PidsLimit: cfg.ClaudeSandboxPids,
+	}
+}
+
+// webhookFilters returns the filters applied to a tenant's incoming errors.
+// Each call gets its own duplicate suppression state. Tag and error type
+// rules and the mapping's severity threshold are read per error so config
+// reloads apply to them.
+func webhookFilters(cfg *config.Config, tenant string) []webhook.Filter {
+	return []webhook.Filter{
+		func(parsed *webhook.ParsedError) (bool, string) {
+			tags, _ := cfg.Filters()
+			return webhook.TagFilter(tags)(parsed)
+		},
+		func(parsed *webhook.ParsedError) (bool, string) {
+			_, errorTypes := cfg.Filters()
+			return webhook.ErrorTypeFilter(errorTypes)(parsed)
+		},
+		func(parsed *webhook.ParsedError) (bool, string) {
+			// Unmapped projects are reported when the job is processed
+			repo := cfg.GetRepoMapping(tenant, parsed.ProjectSlug)
+			if repo == nil {
+				return true, ""
+			}
+			return repo.Severity.Allow(parsed.Level, parsed.EventCount, parsed.UserCount)
+		},
+		func(parsed *webhook.ParsedError) (bool, string) {
+			repo := cfg.GetRepoMapping(tenant, parsed.ProjectSlug)
+			if repo == nil || len(repo.Environments) == 0 || slices.Contains(repo.Environments, parsed.Environment) {
+				return true, ""
+			}
+			return false, fmt.Sprintf("environment %q is not one of %s", parsed.Environment, strings.Join(repo.Environments, ", "))
+		},
+		webhook.NewFingerprintDeduper(cfg.DuplicateWindow).Filter, // must be last
+	}
+}
+
+// newWebhookHandler builds the webhook endpoint for a tenant ("" for the
+// default tenant), layering IP allowlisting, signature verification and rate
+// limiting around the handler.
+func newWebhookHandler(cfg *config.Config, jobQueue webhook.JobQueue, opts webhook.HandlerOptions, tenant string) http.Handler {
+	opts.Tenant = tenant
+	opts.Filters = webhookFilters(cfg, tenant)
+
+	// Event-only payloads (e.g. event alerts) need their issue fetched from Sentry
+	if cfg.TenantSentryAuthToken(tenant) != "" {
+		opts.Issues = tenantIssues{cfg: cfg, tenant: tenant}
+	}
+
+	var handler http.Handler = webhook.NewHandler(jobQueue, opts)
+	if cfg.RateLimitPerMinute > 0 {
+		// Limit after signature verification so forged requests can't drain a project's budget
+		handler = webhook.NewRateLimiter(cfg.RateLimitPerMinute, cfg.RateLimitBurst).Middleware(handler)
+	}
+	handler = webhook.NewRotatingSignatureVerifier(func() string {
+		return cfg.TenantWebhookSecret(tenant)
+	}).Middleware(handler)
+	if len(cfg.WebhookAllowedIPs) > 0 {
+		handler = webhook.NewIPAllowlist(cfg.WebhookAllowedIPs, cfg.TrustedProxies).Middleware(handler)
+	}
+	return handler
+}
+
+// tenantIssues fetches issues from Sentry with a tenant's current credentials,
+// which change when secrets are refreshed.
+type tenantIssues struct {
+	cfg    *config.Config
+	tenant string
+}
+
+func (t tenantIssues) FetchIssue(ctx context.Context, event *webhook.Event) (*webhook.Issue, error) {
+	return sentry.NewClient(t.cfg.TenantSentryURL(t.tenant), t.cfg.TenantSentryAuthToken(t.tenant)).FetchIssue(ctx, event)
+}
+
+// checkRepoCapabilities verifies that the GitHub token can read, branch and
+// open PRs on every mapped repository, recording the results on the board.
+func checkRepoCapabilities(ctx context.Context, cfg *config.Config, board *admin.RepoStatusBoard) {
+	for _, m := range cfg.AllRepoMappings() {
+		board.SetPending(m.FullName())
+	}
+
+	for _, m := range cfg.AllRepoMappings() {
+		provider := gitprovider.NewGitHubProvider(m.GitHubToken, m.Owner, m.Repo)
+		caps, err := provider.CheckCapabilities(ctx)
+		status := board.Record(m.FullName(), caps, err, time.Now())
+
+		switch status.Status {
+		case "ok":
+			log.Printf("Repo %s: credential can read, branch and open PRs", m.FullName())
+		case "degraded":
+			log.Printf("WARNING: repo %s: missing capabilities: %v", m.FullName(), caps.Problems)
+		default:
+			log.Printf("WARNING: repo %s: capability check failed: %v", m.FullName(), err)
+		}
+	}
+}
+
+// processJobs processes webhook jobs from the queue with cfg.Workers workers.
+// When the queue has an outbox, pull requests are recorded in it together with
+// the job's acknowledgement and opened by a separate delivery loop. The
+// returned group is done once every worker has stopped.
+func processJobs(ctx context.Context, jobs queue.Queue, deadLetters *queue.DeadLetters, budget *agent.PRBudget, costs *agent.CostBudget, history *tracking.Store, audit *tracking.AuditTrail, checkpoints *agent.Checkpoints, callbacks *callback.Notifier, cfg *config.Config, pipeline *agent.Pipeline, security *agent.SecurityClassifier) *sync.WaitGroup {
+	// Workers for the same repository take turns
+	locks := agent.NewRepoLocks()
+
+	outbox, _ := jobs.(queue.Outbox)
+	if outbox != nil {
+		go outbox.DeliverEffects(ctx, func(ctx context.Context, effect queue.Effect) error {
+			return deliverEffect(ctx, cfg, locks, history, checkpoints, callbacks, effect)
+		}, func(ctx context.Context, effect queue.Effect, err error) {
+			abandonEffect(ctx, cfg, deadLetters, history, checkpoints, callbacks, effect, err)
+		})
+	}
+
+	log.Printf("Starting %d job workers", cfg.Workers)
+	if cfg.ProcessingWindows != nil {
+		log.Printf("Processing jobs only during %s", cfg.ProcessingWindows)
+	}
+	var workers sync.WaitGroup
+	for i := 0; i < cfg.Workers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			runWorker(ctx, jobs, outbox, deadLetters, budget, costs, history, audit, checkpoints, callbacks, locks, cfg, pipeline, security)
+		}()
+	}
+	return &workers
+}
+
+// workerShutdownTimeout bounds how long shutdown waits for workers to stop
+// their jobs.
+const workerShutdownTimeout = 30 * time.Second
+
+// waitForWorkers waits up to timeout for workers to return.
+func waitForWorkers(workers *sync.WaitGroup, timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		log.Printf("Job workers did not stop within %s", timeout)
+	}
+}
+
+// runWorker processes jobs one at a time until ctx is done, moving failed jobs
+// to deadLetters and recording each job's outcome in history. Checkpoints of
+// interrupted jobs are kept so they resume when redelivered. outbox, budget
+// and callbacks may be nil.
+func runWorker(ctx context.Context, jobs queue.Queue, outbox queue.Outbox, deadLetters *queue.DeadLetters, budget *agent.PRBudget, costs *agent.CostBudget, history *tracking.Store, audit *tracking.AuditTrail, checkpoints *agent.Checkpoints, callbacks *callback.Notifier, locks *agent.RepoLocks, cfg *config.Config, pipeline *agent.Pipeline, security *agent.SecurityClassifier) {
+	for {
+		// Leave jobs queued until a processing window opens, and stop waiting
+		// for jobs when it closes
+		if err := cfg.ProcessingWindows.Wait(ctx); err != nil {
+			return
+		}
+		dequeueCtx, cancel := ctx, context.CancelFunc(func() {})
+		if until := cfg.ProcessingWindows.OpenUntil(time.Now()); !until.IsZero() {
+			dequeueCtx, cancel = context.WithDeadline(ctx, until)
+		}
+
+		msg, err := jobs.Dequeue(dequeueCtx)
+		// Check before cancel, which always sets the context's error
+		windowClosed := err != nil && dequeueCtx.Err() != nil
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		if windowClosed {
+			continue
+		}
+		if err != nil {
+			log.Printf("Failed to dequeue job: %v", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		if msg.Job, err = settleJob(ctx, cfg, msg.Job); err != nil {
+			return
+		}
+		msg.Job = symbolicateJob(ctx, cfg, msg.Job)
+		msg.Job.ParsedError = msg.Job.ParsedError.Scrubbed(cfg.PIIScrubbing)
+
+		acked := false
+		rec := tracking.NewRecord(msg.Job, time.Now())
+		callbacks.Notify(callback.EventStarted, rec)
+		openPR := func(ctx context.Context, job webhook.Job, fix *agent.ProposedFix) (*agent.OpenedPullRequest, error) {
+			if outbox == nil {
+				return createPullRequest(ctx, cfg, nil, checkpoints, job.Key(), job.Tenant, job.ParsedError, fix)
+			}
+			// Save the record before the effect so delivery can add the PR to it
+			if rec.ID == "" {
+				rec.Outcome = tracking.OutcomePRPending
+				rec.FinishedAt = time.Now()
+				saved, err := history.Add(rec)
+				if err != nil {
+					return nil, fmt.Errorf("failed to record job: %w", err)
+				}
+				rec.ID = saved.ID
+			}
+			effect, err := pullRequestEffect(job, fix, rec.ID)
+			if err != nil {
+				return nil, err
+			}
+			err = outbox.AckWithEffect(ctx, msg, effect)
+			acked = err == nil || errors.Is(err, queue.ErrLeaseLost)
+			return nil, err
+		}
+
+		transcript := &tools.Transcript{}
+		err = processJob(tools.WithTranscript(ctx, transcript), msg.Job, cfg, pipeline, security, locks, budget, costs, checkpoints, &rec, openPR)
+		finished, record := true, true
+		switch {
+		case err == nil:
+			// A record saved for the outbox is completed by delivery
+			record = rec.ID == ""
+		case ctx.Err() != nil:
+			// Shutting down; durable queues redeliver the unacknowledged job
+			log.Printf("Job for issue %s interrupted: %v", msg.Job.ParsedError.IssueID, err)
+			finished, record = false, false
+		case errors.Is(err, queue.ErrLeaseLost):
+			log.Printf("Job for issue %s was taken over by another replica", msg.Job.ParsedError.IssueID)
+			finished, record = false, false
+		default:
+			rec.Outcome = tracking.OutcomeFailed
+			rec.Error = err.Error()
+			var checkFailed *agent.CheckFailedError
+			var leaked *agent.SecretFoundError
+			switch {
+			case errors.As(err, &checkFailed):
+				if checkFailed.Check == agent.CheckBuild {
+					rec.BuildOutput = checkFailed.Output
+				} else {
+					rec.TestOutput = checkFailed.Output
+				}
+			case errors.As(err, &leaked):
+				rec.Outcome = tracking.OutcomeBlocked
+			}
+			log.Printf("Job for issue %s failed: %v", msg.Job.ParsedError.IssueID, err)
+			entry, dlqErr := deadLetters.Add(msg.Job, err)
+			if dlqErr != nil {
+				log.Printf("Failed to dead-letter job for issue %s: %v", msg.Job.ParsedError.IssueID, dlqErr)
+			} else {
+				log.Printf("Moved job for issue %s to the dead-letter queue as %s", msg.Job.ParsedError.IssueID, entry.ID)
+			}
+		}
+
+		if finished {
+			if err := checkpoints.Clear(msg.Job.Key()); err != nil {
+				log.Printf("Failed to clear checkpoint for issue %s: %v", msg.Job.ParsedError.IssueID, err)
+			}
+		}
+		if record {
+			rec.FinishedAt = time.Now()
+			if err := saveRecord(history, &rec); err != nil {
+				log.Printf("Failed to record job for issue %s: %v", msg.Job.ParsedError.IssueID, err)
+			}
+			if rec.Outcome == tracking.OutcomeFailed || rec.Outcome == tracking.OutcomeBlocked {
+				callbacks.Notify(callback.EventFailed, rec)
+			} else {
+				callbacks.Notify(callback.EventSucceeded, rec)
+			}
+		}
+		// Records saved for the outbox have their ID already
+		if audit != nil && rec.ID != "" {
+			if err := audit.Save(rec.ID, transcript.Exchanges()); err != nil {
+				log.Printf("Failed to save audit trail for issue %s: %v", msg.Job.ParsedError.IssueID, err)
+			}
+		}
+
+		if !acked {
+			if err := jobs.Ack(ctx, msg); err != nil {
+				log.Printf("Failed to acknowledge job for issue %s: %v", msg.Job.ParsedError.IssueID, err)
+			}
+		}
+	}
+}
+
+// settleJob waits until cfg.ProcessingDelay has passed since job's error was
+// reported, then reloads its issue from Sentry so the job sees the settled
+// grouping and the most representative event. Jobs without a receipt time
+// are returned unchanged, as is the job when the issue can't be reloaded. It
+// fails only if ctx is done.
+func settleJob(ctx context.Context, cfg *config.Config, job webhook.Job) (webhook.Job, error) {
+	if cfg.ProcessingDelay <= 0 || job.ReceivedAt.IsZero() {
+		return job, nil
+	}
+	if wait := time.Until(job.ReceivedAt.Add(cfg.ProcessingDelay)); wait > 0 {
+		log.Printf("Waiting %s for issue %s to settle", wait.Round(time.Second), job.ParsedError.IssueID)
+		select {
+		case <-ctx.Done():
+			return job, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+
+	// Errors ingested over gRPC have no Sentry issue
+	token := cfg.TenantSentryAuthToken(job.Tenant)
+	if job.Webhook == nil || token == "" {
+		return job, nil
+	}
+	wh, err := sentry.NewClient(cfg.TenantSentryURL(job.Tenant), token).LoadIssue(ctx, job.ParsedError.IssueID)
+	if err != nil {
+		log.Printf("Failed to reload issue %s, using the reported event: %v", job.ParsedError.IssueID, err)
+		return job, nil
+	}
+	parsed := webhook.ParseWebhook(wh)
+	if len(parsed.Frames) == 0 && len(job.ParsedError.Frames) > 0 {
+		// Keep the reported event's stack trace
+		return job, nil
+	}
+	job.Webhook, job.ParsedError = wh, parsed
+	return job, nil
+}
+
+// symbolicateJob replaces the event of a mobile or native crash, or of one
+// with unsymbolicated frames, with the event Sentry stored after
+// symbolication. The job is returned unchanged if the event can't be loaded
+// or was already reloaded by settleJob.
+func symbolicateJob(ctx context.Context, cfg *config.Config, job webhook.Job) webhook.Job {
+	wh := job.Webhook
+	token := cfg.TenantSentryAuthToken(job.Tenant)
+	if wh == nil || wh.Data.Event == nil || token == "" || !(wh.IsNative() || job.ParsedError.Unsymbolicated()) {
+		return job
+	}
+	if cfg.ProcessingDelay > 0 && !job.ReceivedAt.IsZero() {
+		return job
+	}
+
+	client := sentry.NewClient(cfg.TenantSentryURL(job.Tenant), token)
+	var reloaded *webhook.SentryWebhook
+	if id := wh.Data.Event.EventID; id != "" {
+		event, err := client.FetchEvent(ctx, job.ParsedError.IssueID, id)
+		if err != nil {
+			log.Printf("Failed to fetch symbolicated event %s, using the reported one: %v", id, err)
+			return job
+		}
+		copied := *wh
+		copied.Data.Event = event
+		reloaded = &copied
+	} else {
+		var err error
+		if reloaded, err = client.LoadIssue(ctx, job.ParsedError.IssueID); err != nil {
+			log.Printf("Failed to reload issue %s, using the reported event: %v", job.ParsedError.IssueID, err)
+			return job
+		}
+	}
+
+	parsed := webhook.ParseWebhook(reloaded)
+	if len(parsed.Frames) == 0 && len(job.ParsedError.Frames) > 0 {
+		return job
+	}
+	if parsed.Unsymbolicated() {
+		log.Printf("Issue %s has unsymbolicated frames; upload its debug files to Sentry", parsed.IssueID)
+	}
+	job.Webhook, job.ParsedError = reloaded, parsed
+	return job
+}
+
+// saveRecord stores a job's record, replacing it if it was saved before, and
+// sets its ID.
+func saveRecord(history *tracking.Store, rec *tracking.Record) error {
+	if rec.ID == "" {
+		saved, err := history.Add(*rec)
+		rec.ID = saved.ID
+		return err
+	}
+	_, err := history.Update(rec.ID, func(r *tracking.Record) { *r = *rec })
+	return err
+}
+
+// effectPullRequest is the outbox effect kind for opening a fix PR.
+const effectPullRequest = "pull_request"
+
+// pullRequestPayload is the outbox payload of an effectPullRequest.
+type pullRequestPayload struct {
+	Tenant      string               `json:"tenant,omitempty"`
+	ParsedError *webhook.ParsedError `json:"parsed_error"`
+	Fix         *agent.ProposedFix   `json:"fix"`
+	// RecordID is the job's tracking record, updated once the PR is open.
+	RecordID string `json:"record_id,omitempty"`
+}
+
+func pullRequestEffect(job webhook.Job, fix *agent.ProposedFix, recordID string) (queue.Effect, error) {
+	payload, err := json.Marshal(pullRequestPayload{Tenant: job.Tenant, ParsedError: job.ParsedError, Fix: fix, RecordID: recordID})
+	if err != nil {
+		return queue.Effect{}, fmt.Errorf("failed to encode pull request: %w", err)
+	}
+	return queue.Effect{Kind: effectPullRequest, Payload: payload}, nil
+}
+
+// deliverEffect performs a side effect recorded in the queue's outbox.
+func deliverEffect(ctx context.Context, cfg *config.Config, locks *agent.RepoLocks, history *tracking.Store, checkpoints *agent.Checkpoints, callbacks *callback.Notifier, effect queue.Effect) error {
+	if effect.Kind != effectPullRequest {
+		return fmt.Errorf("unknown effect kind %q", effect.Kind)
+	}
+
+	var p pullRequestPayload
+	if err := json.Unmarshal(effect.Payload, &p); err != nil || p.ParsedError == nil || p.Fix == nil {
+		return fmt.Errorf("invalid pull request payload: %v", err)
+	}
+	// Keep the pushed branch across delivery attempts
+	key := outboxKey(effect)
+	pr, err := createPullRequest(ctx, cfg, locks, checkpoints, key, p.Tenant, p.ParsedError, p.Fix)
+	if err != nil {
+		return err
+	}
+	if err := checkpoints.Clear(key); err != nil {
+		log.Printf("Failed to clear checkpoint for issue %s: %v", p.ParsedError.IssueID, err)
+	}
+
+	if p.RecordID != "" {
+		if _, err := history.Update(p.RecordID, func(r *tracking.Record) { r.SetPullRequest(pr.Number, pr.URL, pr.Branch) }); err != nil {
+			log.Printf("Failed to record PR for issue %s: %v", p.ParsedError.IssueID, err)
 		}
 	}
+
+	// Jobs whose PR goes through the outbox succeed once it is open
+	rec, ok := history.Get(p.RecordID)
+	if !ok {
+		rec = tracking.NewRecord(webhook.Job{Tenant: p.Tenant, ParsedError: p.ParsedError}, time.Now())
+		rec.SetPullRequest(pr.Number, pr.URL, pr.Branch)
+	}
+	callbacks.Notify(callback.EventSucceeded, rec)
+	return nil
 }
 
-// processJob handles a single webhook job.
-func processJob(ctx context.Context, job webhook.Job, cfg *config.Config, pipeline *agent.Pipeline) {
+// abandonEffect gives up on an outbox effect whose last delivery attempt
+// failed with deliverErr. The job is dead-lettered so it can be requeued, its
+// record marked failed, and the branch pushed for it deleted.
+func abandonEffect(ctx context.Context, cfg *config.Config, deadLetters *queue.DeadLetters, history *tracking.Store, checkpoints *agent.Checkpoints, callbacks *callback.Notifier, effect queue.Effect, deliverErr error) {
+	var p pullRequestPayload
+	if err := json.Unmarshal(effect.Payload, &p); err != nil || p.ParsedError == nil {
+		log.Printf("Abandoned %s effect %d has an invalid payload: %v", effect.Kind, effect.ID, err)
+		return
+	}
+	issueID := p.ParsedError.IssueID
+	err := fmt.Errorf("failed to open pull request: %w", deliverErr)
+
+	job := webhook.Job{Tenant: p.Tenant, ParsedError: p.ParsedError}
+	entry, dlqErr := deadLetters.Add(job, err)
+	if dlqErr != nil {
+		log.Printf("Failed to dead-letter job for issue %s: %v", issueID, dlqErr)
+	} else {
+		log.Printf("Moved job for issue %s to the dead-letter queue as %s", issueID, entry.ID)
+	}
+
+	fail := func(r *tracking.Record) {
+		r.Outcome = tracking.OutcomeFailed
+		r.Error = err.Error()
+		r.FinishedAt = time.Now()
+	}
+	rec, ok := history.Get(p.RecordID)
+	if ok {
+		fail(&rec)
+		if _, err := history.Update(p.RecordID, fail); err != nil {
+			log.Printf("Failed to record job for issue %s: %v", issueID, err)
+		}
+	} else {
+		rec = tracking.NewRecord(job, time.Now())
+		fail(&rec)
+	}
+	callbacks.Notify(callback.EventFailed, rec)
+
+	// A retry starts over, so the branch pushed for this attempt is left over
+	key := outboxKey(effect)
+	if branch := checkpointedBranch(checkpoints, key); branch != nil {
+		if m := cfg.GetRepoMapping(p.Tenant, p.ParsedError.ProjectSlug); m != nil {
+			provider := gitprovider.NewGitHubProvider(m.GitHubToken, m.Owner, m.Repo)
+			if err := provider.DeleteBranch(ctx, branch.Name); err != nil {
+				log.Printf("Failed to delete branch %s for issue %s: %v", branch.Name, issueID, err)
+			}
+		}
+	}
+	if err := checkpoints.Clear(key); err != nil {
+		log.Printf("Failed to clear checkpoint for issue %s: %v", issueID, err)
+	}
+}
+
+// outboxKey is the checkpoint key of an outbox effect's pushed branch.
+func outboxKey(effect queue.Effect) string {
+	return fmt.Sprintf("outbox/%d", effect.ID)
+}
+
+// createPullRequest opens a PR with fix in the repository mapped to the
+// error's project. It takes the repository's lock unless locks is nil, i.e.
+// the caller already holds it. The pushed branch is checkpointed under key so
+// a retry opens the PR from it instead of pushing another branch.
+func createPullRequest(ctx context.Context, cfg *config.Config, locks *agent.RepoLocks, checkpoints *agent.Checkpoints, key, tenant string, parsedError *webhook.ParsedError, fix *agent.ProposedFix) (*agent.OpenedPullRequest, error) {
+	repoMapping := cfg.GetRepoMapping(tenant, parsedError.ProjectSlug)
+	if repoMapping == nil {
+		return nil, fmt.Errorf("no repo mapping found for project %s (tenant %q)", parsedError.ProjectSlug, tenant)
+	}
+	if locks != nil {
+		unlock, err := locks.Lock(ctx, repoMapping.FullName())
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+	}
+	provider := gitprovider.NewGitHubProvider(repoMapping.GitHubToken, repoMapping.Owner, repoMapping.Repo)
+
+	branch := checkpointedBranch(checkpoints, key)
+	if branch != nil {
+		log.Printf("Resuming issue %s from pushed branch %s", parsedError.IssueID, branch.Name)
+	} else {
+		var err error
+		branch, err = agent.PushFixBranch(ctx, provider, repoMapping, parsedError, fix)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkpoints.Save(key, agent.Checkpoint{Stage: agent.StageBranchPushed, Fix: fix, Branch: branch}); err != nil {
+			log.Printf("Failed to checkpoint issue %s: %v", parsedError.IssueID, err)
+		}
+	}
+
+	pr, err := agent.OpenPullRequest(ctx, provider, repoMapping, parsedError, fix, branch)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Created PR for issue %s: %s", parsedError.IssueID, pr.URL)
+	return pr, nil
+}
+
+// checkpointedBranch returns the fix branch already pushed for key, if any.
+func checkpointedBranch(checkpoints *agent.Checkpoints, key string) *agent.FixBranch {
+	cp, ok := checkpoints.Get(key)
+	if !ok || cp.Stage != agent.StageBranchPushed {
+		return nil
+	}
+	return cp.Branch
+}
+
+// retryPolicy returns the policy for retrying transient job failures.
+func retryPolicy(cfg *config.Config) agent.RetryPolicy {
+	return agent.RetryPolicy{
+		MaxAttempts: cfg.RetryMaxAttempts,
+		BaseDelay:   cfg.RetryBaseDelay,
+		MaxDelay:    cfg.RetryMaxDelay,
+	}
+}
+
+// processJob handles a single webhook job, filling in rec as it goes. Fix PRs
+// are opened through openPR, which returns nil if the PR will be opened later,
+// and counted against budget, and the tokens and cost of generating fixes are
+// counted against costs; jobs for a repository over either budget are deferred.
+// A job with a checkpointed fix resumes from it instead of running Claude Code.
+// It returns an error if the job failed after exhausting its retries or ran
+// longer than cfg.PipelineTimeout.
+func processJob(ctx context.Context, job webhook.Job, cfg *config.Config, pipeline *agent.Pipeline, security *agent.SecurityClassifier, locks *agent.RepoLocks, budget *agent.PRBudget, costs *agent.CostBudget, checkpoints *agent.Checkpoints, rec *tracking.Record, openPR func(context.Context, webhook.Job, *agent.ProposedFix) (*agent.OpenedPullRequest, error)) (err error) {
 	log.Printf("Processing job for issue %s (project: %s)", job.ParsedError.IssueID, job.ParsedError.ProjectSlug)
 
 	// Look up repository configuration
-	repoMapping := cfg.GetRepoMapping(job.ParsedError.ProjectSlug)
+	repoMapping := cfg.GetRepoMapping(job.Tenant, job.ParsedError.ProjectSlug)
 	if repoMapping == nil {
-		log.Printf("No repo mapping found for project %s, skipping", job.ParsedError.ProjectSlug)
-		return
+		log.Printf("No repo mapping found for project %s (tenant %q), skipping", job.ParsedError.ProjectSlug, job.Tenant)
+		rec.Outcome = tracking.OutcomeSkipped
+		return nil
 	}
+	rec.Repo = repoMapping.FullName()
 
-	// Build repo URL
-	repoURL := fmt.Sprintf("https://github.com/%s/%s.git", repoMapping.Owner, repoMapping.Repo)
-
-	// Run the agent pipeline (uses Claude Code)
-	fix, err := pipeline.Run(ctx, repoURL, cfg.GitHubToken, job.ParsedError)
+	// Only one job at a time may create branches and commits in a repository
+	unlock, err := locks.Lock(ctx, repoMapping.FullName())
 	if err != nil {
-		log.Printf("Pipeline failed for issue %s: %v", job.ParsedError.IssueID, err)
-		return
+		return fmt.Errorf("gave up waiting for repo %s: %w", repoMapping.FullName(), err)
 	}
+	defer unlock()
+
+	// Bound the run so a hung Claude Code session can't stall the worker;
+	// the clone and any subprocesses are cleaned up when it expires
+	ctx, cancel := context.WithTimeout(ctx, cfg.PipelineTimeout)
+	defer cancel()
+	defer func() {
+		if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("job timed out after %s: %w", cfg.PipelineTimeout, err)
+		}
+	}()
 
 	// Create GitHub provider for PR creation
-	provider := gitprovider.NewGitHubProvider(cfg.GitHubToken, repoMapping.Owner, repoMapping.Repo)
+	provider := gitprovider.NewGitHubProvider(repoMapping.GitHubToken, repoMapping.Owner, repoMapping.Repo)
+
+	// Keep vulnerability details out of public PRs and reviews
+	isSecurity := cfg.SecurityAdvisoryMode && security.IsSecurityError(job.ParsedError)
+
+	// Resume from a fix generated before the job was interrupted
+	cp, ok := checkpoints.Get(job.Key())
+	resumed := ok && cp.Fix != nil
+
+	// A recurrence of an error that was already fixed gets no new fix
+	if cfg.FixCache && !resumed {
+		mergedFix, err := agent.FindMergedFix(ctx, provider, job.ParsedError)
+		if err != nil {
+			log.Printf("Failed to look for merged fixes for issue %s: %v", job.ParsedError.IssueID, err)
+		} else if mergedFix != nil {
+			return pointToMergedFix(ctx, cfg, job, repoMapping, mergedFix, rec)
+		}
+	}
+
+	// Don't generate fixes once this month's cost budget has run out
+	if !resumed && !costs.Allow(repoMapping.FullName()) {
+		rec.Outcome = tracking.OutcomeDeferred
+		if err := costs.Defer(job); err != nil {
+			return fmt.Errorf("failed to defer job over cost budget: %w", err)
+		}
+		log.Printf("Cost budget for %s is exhausted, deferring issue %s until next month", repoMapping.FullName(), job.ParsedError.IssueID)
+		return nil
+	}
+
+	// Prefer reviewing a human PR that already addresses the issue
+	if cfg.SuggestOnHumanPRs && !isSecurity && !resumed && !repoMapping.AnalysisOnly && !repoMapping.DryRun {
+		humanPR, err := agent.FindHumanPullRequest(ctx, provider, job.ParsedError)
+		if err != nil {
+			log.Printf("Failed to look for existing PRs for issue %s: %v", job.ParsedError.IssueID, err)
+		} else if humanPR != nil {
+			return suggestOnHumanPR(ctx, job, cfg, pipeline, costs, repoMapping, provider, humanPR, rec)
+		}
+	}
+
+	// Don't spend a Claude Code run on a PR that couldn't be opened today
+	if !isSecurity && !repoMapping.AnalysisOnly && !repoMapping.DryRun && !budget.Allow(repoMapping.FullName(), repoMapping.MaxPRsPerDay) {
+		rec.Outcome = tracking.OutcomeDeferred
+		return deferOverBudget(ctx, cfg, budget, job, repoMapping)
+	}
+
+	// Run the agent pipeline (uses Claude Code), retrying transient failures
+	retry := retryPolicy(cfg)
+	fix := cp.Fix
+	if resumed {
+		log.Printf("Resuming job for issue %s from stage %s", job.ParsedError.IssueID, cp.Stage)
+	} else {
+		var usage agent.Usage
+		err = retry.Do(ctx, "Pipeline for issue "+job.ParsedError.IssueID, func(ctx context.Context) error {
+			var runErr error
+			fix, runErr = pipeline.Run(ctx, repoMapping, repoMapping.GitHubToken, job.ParsedError)
+			usage = usage.Add(usageOf(fix, runErr))
+			return runErr
+		})
+		recordUsage(costs, rec, repoMapping.FullName(), usage)
+		if err != nil {
+			return fmt.Errorf("pipeline failed: %w", err)
+		}
+		if err := checkpoints.Save(job.Key(), agent.Checkpoint{Stage: agent.StageFixGenerated, Fix: fix}); err != nil {
+			log.Printf("Failed to checkpoint issue %s: %v", job.ParsedError.IssueID, err)
+		}
+	}
+	if resumed {
+		rec.CostUSD, rec.InputTokens, rec.OutputTokens = fix.CostUSD, fix.InputTokens, fix.OutputTokens
+	}
+	rec.Confidence = fix.Confidence
+
+	return pipeline.Publish(ctx, repoMapping, "", job.ParsedError, fix, func(ctx context.Context) error {
+		return publishFix(ctx, job, cfg, repoMapping, provider, budget, rec, fix, isSecurity, openPR)
+	})
+}
+
+// publishFix proposes fix through openPR, counting it against budget, or
+// through a security advisory, or posts its analysis instead if it isn't fit
+// to propose. In a dry run it only logs the fix.
+func publishFix(ctx context.Context, job webhook.Job, cfg *config.Config, repoMapping *config.RepoMapping, provider gitprovider.Provider, budget *agent.PRBudget, rec *tracking.Record, fix *agent.ProposedFix, isSecurity bool, openPR func(context.Context, webhook.Job, *agent.ProposedFix) (*agent.OpenedPullRequest, error)) error {
+	// Dry runs stop short of any change to the repository or Sentry
+	if repoMapping.DryRun {
+		log.Printf("Dry run for %s: not proposing the fix for issue %s (confidence %.2f), which would change:\n%s", repoMapping.FullName(), job.ParsedError.IssueID, fix.Confidence, fix.SuggestedDiff)
+		rec.Outcome = tracking.OutcomeDryRun
+		return nil
+	}
+
+	// Don't take reviewers' time with sweeping fixes or ones Claude is unsure
+	// of, nor commit anything for repositories that only want analyses
+	if fix.AnalysisOnly || fix.Oversized != "" || fix.Confidence < cfg.MinConfidence {
+		return postAnalysis(ctx, cfg, job, provider, fix, isSecurity, rec)
+	}
+
+	if isSecurity {
+		log.Printf("Issue %s looks like a vulnerability, using a private security advisory", job.ParsedError.IssueID)
+		forkProvider := func(owner, repo string) gitprovider.Provider {
+			return gitprovider.NewGitHubProvider(repoMapping.GitHubToken, owner, repo)
+		}
+		advisoryURL, err := agent.CreateSecurityFix(ctx, provider, forkProvider, job.ParsedError, fix)
+		if err != nil {
+			return fmt.Errorf("failed to create security advisory: %w", err)
+		}
+		log.Printf("Created security advisory for issue %s: %s", job.ParsedError.IssueID, advisoryURL)
+		rec.Outcome = tracking.OutcomeAdvisory
+		return nil
+	}
 
 	// Create PR with the fix
-	prURL, err := agent.CreatePullRequest(ctx, provider, job.ParsedError, fix)
+	var pr *agent.OpenedPullRequest
+	err := retryPolicy(cfg).Do(ctx, "Creating PR for issue "+job.ParsedError.IssueID, func(ctx context.Context) error {
+		var openErr error
+		pr, openErr = openPR(ctx, job, fix)
+		return openErr
+	})
 	if err != nil {
-		log.Printf("Failed to create PR for issue %s: %v", job.ParsedError.IssueID, err)
-		return
+		return fmt.Errorf("failed to create PR: %w", err)
+	}
+	if pr != nil {
+		rec.SetPullRequest(pr.Number, pr.URL, pr.Branch)
+	}
+	if err := budget.Record(repoMapping.FullName()); err != nil {
+		log.Printf("Failed to record PR for %s against its budget: %v", repoMapping.FullName(), err)
+	}
+	return nil
+}
+
+// deferOverBudget holds a job back until the repository's PR budget resets,
+// noting this on the Sentry issue if configured.
+func deferOverBudget(ctx context.Context, cfg *config.Config, budget *agent.PRBudget, job webhook.Job, repoMapping *config.RepoMapping) error {
+	if err := budget.Defer(job); err != nil {
+		return fmt.Errorf("failed to defer job over PR budget: %w", err)
+	}
+	log.Printf("PR budget for %s is exhausted, deferring issue %s until tomorrow", repoMapping.FullName(), job.ParsedError.IssueID)
+
+	token := cfg.TenantSentryAuthToken(job.Tenant)
+	if !cfg.PRBudgetSentryComment || token == "" {
+		return nil
+	}
+	text := fmt.Sprintf("SentryAgent has reached its limit of %d fix PRs per day for %s. It will attempt a fix for this issue tomorrow.", repoMapping.MaxPRsPerDay, repoMapping.FullName())
+	if err := sentry.NewClient(cfg.TenantSentryURL(job.Tenant), token).AddComment(ctx, job.ParsedError.IssueID, text); err != nil {
+		log.Printf("Failed to comment on Sentry issue %s: %v", job.ParsedError.IssueID, err)
+	}
+	return nil
+}
+
+// pointToMergedFix records that job's error was already fixed by a merged PR
+// and, unless repoMapping is in a dry run, comments on the Sentry issue
+// pointing to it.
+func pointToMergedFix(ctx context.Context, cfg *config.Config, job webhook.Job, repoMapping *config.RepoMapping, pr *gitprovider.PullRequest, rec *tracking.Record) error {
+	log.Printf("Issue %s matches the fix merged in %s, not generating another", job.ParsedError.IssueID, pr.HTMLURL)
+	rec.Outcome = tracking.OutcomeAlreadyFixed
+	rec.PRNumber = pr.Number
+	rec.PRURL = pr.HTMLURL
+
+	token := cfg.TenantSentryAuthToken(job.Tenant)
+	if token == "" || repoMapping.DryRun {
+		return nil
+	}
+	if err := sentry.NewClient(cfg.TenantSentryURL(job.Tenant), token).AddComment(ctx, job.ParsedError.IssueID, agent.AlreadyFixedComment(pr)); err != nil {
+		log.Printf("Failed to comment on Sentry issue %s: %v", job.ParsedError.IssueID, err)
+	}
+	return nil
+}
+
+// postAnalysis posts the analysis of a fix that is oversized, that Claude is
+// not confident in or that is for an analysis-only repository instead of
+// proposing it. The analysis of a vulnerability goes only to Sentry.
+func postAnalysis(ctx context.Context, cfg *config.Config, job webhook.Job, provider gitprovider.Provider, fix *agent.ProposedFix, isSecurity bool, rec *tracking.Record) error {
+	if fix.AnalysisOnly {
+		log.Printf("Repository %s only gets analyses, posting the analysis of issue %s", rec.Repo, job.ParsedError.IssueID)
+		rec.Outcome = tracking.OutcomeAnalyzed
+	} else if fix.Oversized != "" {
+		log.Printf("Fix for issue %s %s, posting its analysis instead", job.ParsedError.IssueID, fix.Oversized)
+		rec.Outcome = tracking.OutcomeOversized
+	} else {
+		log.Printf("Confidence in the fix for issue %s is %.2f, below %.2f, posting its analysis instead", job.ParsedError.IssueID, fix.Confidence, cfg.MinConfidence)
+		rec.Outcome = tracking.OutcomeLowConfidence
+	}
+
+	if cfg.LowConfidenceAction == "github-issue" && !isSecurity {
+		issue, err := agent.OpenAnalysisIssue(ctx, provider, job.ParsedError, fix)
+		if err != nil {
+			return fmt.Errorf("failed to post analysis: %w", err)
+		}
+		log.Printf("Opened issue with the analysis of issue %s: %s", job.ParsedError.IssueID, issue.HTMLURL)
+		rec.AnalysisURL = issue.HTMLURL
+		return nil
+	}
+
+	// Errors ingested over gRPC have no Sentry issue
+	token := cfg.TenantSentryAuthToken(job.Tenant)
+	if job.Webhook == nil || token == "" {
+		log.Printf("No Sentry issue to post the analysis of issue %s on", job.ParsedError.IssueID)
+		return nil
+	}
+	if err := sentry.NewClient(cfg.TenantSentryURL(job.Tenant), token).AddComment(ctx, job.ParsedError.IssueID, agent.AnalysisReport(fix)); err != nil {
+		return fmt.Errorf("failed to post analysis: %w", err)
+	}
+	return nil
+}
+
+// suggestOnHumanPR generates a fix on a human PR's branch and posts it as review suggestions.
+func suggestOnHumanPR(ctx context.Context, job webhook.Job, cfg *config.Config, pipeline *agent.Pipeline, costs *agent.CostBudget, repoMapping *config.RepoMapping, provider gitprovider.Provider, pr *gitprovider.PullRequest, rec *tracking.Record) error {
+	log.Printf("Issue %s is referenced by PR #%d, suggesting changes there", job.ParsedError.IssueID, pr.Number)
+
+	fix, err := pipeline.RunOnBranch(ctx, repoMapping, pr.Head, repoMapping.GitHubToken, job.ParsedError)
+	recordUsage(costs, rec, repoMapping.FullName(), usageOf(fix, err))
+	if err != nil {
+		return fmt.Errorf("pipeline failed: %w", err)
+	}
+	rec.Confidence = fix.Confidence
+
+	return pipeline.Publish(ctx, repoMapping, pr.Head, job.ParsedError, fix, func(ctx context.Context) error {
+		if fix.Oversized != "" || fix.Confidence < cfg.MinConfidence {
+			return postAnalysis(ctx, cfg, job, provider, fix, false, rec)
+		}
+
+		n, err := agent.SuggestOnPullRequest(ctx, provider, pr, job.ParsedError, fix)
+		if err != nil {
+			return fmt.Errorf("failed to review PR #%d: %w", pr.Number, err)
+		}
+
+		log.Printf("Posted %d suggestion(s) for issue %s on %s", n, job.ParsedError.IssueID, pr.HTMLURL)
+		rec.SetPullRequest(pr.Number, pr.HTMLURL, pr.Head)
+		rec.Outcome = tracking.OutcomeSuggested
+		return nil
+	})
+}
+
+// usageOf returns what a pipeline run used, including runs in which Claude
+// could not produce a fix, its fix failed to build or pass the tests, the
+// reviewer vetoed it, it appeared to contain secrets or a hook stopped it.
+func usageOf(fix *agent.ProposedFix, err error) agent.Usage {
+	var failed *agent.FixFailedError
+	var checkFailed *agent.CheckFailedError
+	var vetoed *agent.FixVetoedError
+	var leaked *agent.SecretFoundError
+	var stopped *agent.HookError
+	switch {
+	case err == nil:
+		return fix.Usage()
+	case errors.As(err, &failed):
+		return failed.Usage
+	case errors.As(err, &checkFailed):
+		return checkFailed.Usage
+	case errors.As(err, &vetoed):
+		return vetoed.Usage
+	case errors.As(err, &leaked):
+		return leaked.Usage
+	case errors.As(err, &stopped):
+		return stopped.Usage
+	}
+	return agent.Usage{}
+}
+
+// recordUsage adds what generating fixes used to the job's record and to its
+// repository's cost budget.
+func recordUsage(costs *agent.CostBudget, rec *tracking.Record, repo string, u agent.Usage) {
+	rec.CostUSD += u.CostUSD
+	rec.InputTokens += u.InputTokens
+	rec.OutputTokens += u.OutputTokens
+	if err := costs.Record(repo, u); err != nil {
+		log.Printf("Failed to record usage for %s: %v", repo, err)
+	}
+}
+
+// reloadConfig reloads cfg on SIGHUP and whenever its config file changes,
+// calling reloaded after each successful reload. A configuration that fails
+// to load is logged and the current one kept.
+func reloadConfig(ctx context.Context, cfg *config.Config, reloaded func()) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	// Secrets kept in a secret manager are fetched again by reloading
+	var refresh <-chan time.Time
+	if len(cfg.ManagedSecrets) > 0 {
+		ticker := time.NewTicker(cfg.SecretsRefreshInterval)
+		defer ticker.Stop()
+		refresh = ticker.C
 	}
 
-	log.Printf("Created PR for issue %s: %s", job.ParsedError.IssueID, prURL)
+	// Without a config file only SIGHUP triggers a reload
+	var poll <-chan time.Time
+	var modTime time.Time
+	if cfg.ConfigFile != "" {
+		if info, err := os.Stat(cfg.ConfigFile); err == nil {
+			modTime = info.ModTime()
+		}
+		ticker := time.NewTicker(cfg.ConfigPollInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			log.Println("Received SIGHUP, reloading config")
+		case <-refresh:
+			log.Printf("Refreshing %d secret(s), reloading config", len(cfg.ManagedSecrets))
+		case <-poll:
+			info, err := os.Stat(cfg.ConfigFile)
+			if err != nil || info.ModTime().Equal(modTime) {
+				continue
+			}
+			modTime = info.ModTime()
+			log.Printf("%s changed, reloading config", cfg.ConfigFile)
+		}
+
+		next, err := config.Load()
+		if err != nil {
+			log.Printf("Config reload failed, keeping the current config: %v", err)
+			continue
+		}
+		for _, skipped := range cfg.Reload(next) {
+			log.Printf("Config reload: %s; restart to apply it", skipped)
+		}
+		log.Printf("Reloaded config with %d repo mapping(s)", len(cfg.AllRepoMappings()))
+		reloaded()
+	}
+}
+
+// sweepStalePullRequests periodically nudges or closes unreviewed bot PRs in
+// repositories not in a dry run.
+func sweepStalePullRequests(ctx context.Context, cfg *config.Config, policy agent.StalePolicy) {
+	ticker := time.NewTicker(cfg.StalePRCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, m := range cfg.AllRepoMappings() {
+			// Dry runs leave the repository's PRs alone
+			if m.DryRun {
+				continue
+			}
+			provider := gitprovider.NewGitHubProvider(m.GitHubToken, m.Owner, m.Repo)
+			result, err := agent.SweepStalePullRequests(ctx, provider, policy, time.Now())
+			if err != nil {
+				log.Printf("Stale PR sweep failed for %s/%s: %v", m.Owner, m.Repo, err)
+				continue
+			}
+			if result.Nudged > 0 || result.Closed > 0 {
+				log.Printf("Stale PR sweep for %s/%s: nudged %d, closed %d", m.Owner, m.Repo, result.Nudged, result.Closed)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ingestReviewFeedback periodically stores reviewer feedback left on bot PRs.
+func ingestReviewFeedback(ctx context.Context, cfg *config.Config, store *learning.Store) {
+	ticker := time.NewTicker(cfg.FeedbackSyncInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, m := range cfg.AllRepoMappings() {
+			provider := gitprovider.NewGitHubProvider(m.GitHubToken, m.Owner, m.Repo)
+			added, err := agent.IngestReviewFeedback(ctx, provider, store, time.Now())
+			if err != nil {
+				log.Printf("Feedback ingestion failed for %s: %v", m.FullName(), err)
+				continue
+			}
+			if added > 0 {
+				log.Printf("Ingested %d reviewer feedback item(s) for %s", added, m.FullName())
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
 }
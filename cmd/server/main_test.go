@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/agent"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/config"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/queue"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/schedule"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/tracking"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/webhook"
+)
+
+// ackRecorder reports each acknowledged job on acked.
+type ackRecorder struct {
+	*queue.Memory
+	acked chan string
+}
+
+func (q *ackRecorder) Ack(ctx context.Context, msg *queue.Message) error {
+	q.acked <- msg.Job.ParsedError.IssueID
+	return q.Memory.Ack(ctx, msg)
+}
+
+func TestRunWorker_OpenWindow(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// A window open from an hour ago to an hour from now
+	now := time.Now().UTC()
+	clock := time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute
+	window := schedule.Window{Start: (clock + 23*time.Hour) % (24 * time.Hour), End: (clock + time.Hour) % (24 * time.Hour)}
+	cfg := &config.Config{ProcessingWindows: &schedule.Schedule{Windows: []schedule.Window{window}, Location: time.UTC}}
+
+	jobs := &ackRecorder{Memory: queue.NewMemory(1), acked: make(chan string, 1)}
+	job := webhook.Job{ParsedError: &webhook.ParsedError{IssueID: "42", ProjectSlug: "unmapped"}}
+	if err := jobs.Enqueue(ctx, job); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	history, err := tracking.Open("", 0)
+	if err != nil {
+		t.Fatalf("tracking.Open() error = %v", err)
+	}
+	checkpoints, err := agent.OpenCheckpoints("")
+	if err != nil {
+		t.Fatalf("OpenCheckpoints() error = %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runWorker(ctx, jobs, nil, nil, nil, nil, history, nil, checkpoints, nil, agent.NewRepoLocks(), cfg, nil, nil)
+	}()
+
+	select {
+	case id := <-jobs.acked:
+		if id != "42" {
+			t.Errorf("acked issue %s, want 42", id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("job was not acknowledged during an open window")
+	}
+	cancel()
+	<-done
+
+	records := history.List(tracking.Query{})
+	if len(records) != 1 || records[0].Outcome != tracking.OutcomeSkipped {
+		t.Fatalf("history = %+v, want one skipped record", records)
+	}
+}
+
+func TestWebhookFilters_Environments(t *testing.T) {
+	cfg := &config.Config{RepoMappings: []config.RepoMapping{
+		{SentryProject: "backend", Owner: "acme", Repo: "backend", Environments: []string{"production", "staging"}},
+		{SentryProject: "web", Owner: "acme", Repo: "web"},
+	}}
+	jobs := queue.NewMemory(10)
+	handler := webhook.NewHandler(jobs, webhook.HandlerOptions{Filters: webhookFilters(cfg, "")})
+
+	tests := []struct {
+		name        string
+		project     string
+		environment string
+		wantJob     bool
+	}{
+		{"listed environment", "backend", "production", true},
+		{"other listed environment", "backend", "staging", true},
+		{"unlisted environment", "backend", "development", false},
+		{"no environment tag", "backend", "", false},
+		{"mapping without environments", "web", "development", true},
+		{"unmapped project", "mobile", "development", true},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := &webhook.Event{}
+			if tt.environment != "" {
+				event.Tags = []webhook.Tag{{Key: "environment", Value: tt.environment}}
+			}
+			body, _ := json.Marshal(webhook.SentryWebhook{
+				Action: "created",
+				Data: webhook.WebhookData{
+					Issue: &webhook.Issue{ID: strconv.Itoa(i), Title: tt.name, Project: webhook.Project{Slug: tt.project}},
+					Event: event,
+				},
+			})
+
+			before := jobs.Len()
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/webhook/sentry", bytes.NewReader(body)))
+			if rr.Code != http.StatusAccepted {
+				t.Fatalf("status code = %d, want %d", rr.Code, http.StatusAccepted)
+			}
+			if queued := jobs.Len() > before; queued != tt.wantJob {
+				t.Errorf("queued = %v, want %v", queued, tt.wantJob)
+			}
+		})
+	}
+}
+
+func TestAbandonEffect(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{}
+	history, err := tracking.Open("", 0)
+	if err != nil {
+		t.Fatalf("tracking.Open() error = %v", err)
+	}
+	checkpoints, err := agent.OpenCheckpoints("")
+	if err != nil {
+		t.Fatalf("OpenCheckpoints() error = %v", err)
+	}
+	deadLetters, err := queue.OpenDeadLetters("")
+	if err != nil {
+		t.Fatalf("OpenDeadLetters() error = %v", err)
+	}
+
+	job := webhook.Job{ParsedError: &webhook.ParsedError{IssueID: "42", ProjectSlug: "backend"}}
+	rec := tracking.NewRecord(job, time.Now())
+	rec.Outcome = tracking.OutcomePRPending
+	rec, err = history.Add(rec)
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	effect, err := pullRequestEffect(job, &agent.ProposedFix{}, rec.ID)
+	if err != nil {
+		t.Fatalf("pullRequestEffect() error = %v", err)
+	}
+	effect.ID = 7
+	branch := &agent.FixBranch{Name: "autofix/42", Base: "main"}
+	if err := checkpoints.Save(outboxKey(effect), agent.Checkpoint{Stage: agent.StageBranchPushed, Branch: branch}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	abandonEffect(ctx, cfg, deadLetters, history, checkpoints, nil, effect, errors.New("boom"))
+
+	if got, _ := history.Get(rec.ID); got.Outcome != tracking.OutcomeFailed || !strings.Contains(got.Error, "boom") {
+		t.Errorf("record = %+v, want failed with the delivery error", got)
+	}
+	if letters := deadLetters.List(); len(letters) != 1 || letters[0].Job.ParsedError.IssueID != "42" {
+		t.Errorf("dead letters = %+v, want the job for issue 42", letters)
+	}
+	if _, ok := checkpoints.Get(outboxKey(effect)); ok {
+		t.Error("checkpoint of the abandoned effect was kept")
+	}
+}
@@ -0,0 +1,387 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/agent"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/archive"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/queue"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/tracking"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/webhook"
+)
+
+// PayloadArchive looks up archived webhook payloads.
+type PayloadArchive interface {
+	Get(ctx context.Context, id string) ([]byte, error)
+}
+
+// Options wires the admin API to the rest of the service.
+type Options struct {
+	// Repos reports per-repository capability status.
+	Repos *RepoStatusBoard
+	// Archive serves payloads for replay. Replaying by ID is unavailable when nil.
+	Archive PayloadArchive
+	// Enqueue submits a job for processing.
+	Enqueue func(webhook.Job) error
+	// DeadLetters holds jobs that failed after exhausting their retries.
+	// The dead-letter endpoints are unavailable when nil.
+	DeadLetters *queue.DeadLetters
+	// History records the outcome of every processed job. The history
+	// endpoint is unavailable when nil.
+	History *tracking.Store
+	// Audit keeps the prompts and model output of each job record. The
+	// audit endpoint is unavailable when nil.
+	Audit *tracking.AuditTrail
+	// Usage accounts fix generation tokens and cost per repository. The
+	// usage endpoint is unavailable when nil.
+	Usage *agent.CostBudget
+	// LoadIssue fetches a Sentry issue and its latest event as a webhook
+	// payload for a tenant. Manual triggers are unavailable when nil.
+	LoadIssue func(ctx context.Context, tenant, issueID string) (*webhook.SentryWebhook, error)
+}
+
+// Handler serves the operator-facing admin API. Every request must carry
+// the admin token as a bearer token.
+type Handler struct {
+	token string
+	mux   *http.ServeMux
+	opts  Options
+}
+
+// NewHandler creates a new admin API handler.
+func NewHandler(token string, opts Options) *Handler {
+	h := &Handler{
+		token: token,
+		mux:   http.NewServeMux(),
+		opts:  opts,
+	}
+
+	h.mux.HandleFunc("GET /admin/repos", h.listRepos)
+	h.mux.HandleFunc("POST /admin/replay", h.replayBody)
+	h.mux.HandleFunc("POST /admin/replay/{payloadID}", h.replayArchived)
+	h.mux.HandleFunc("GET /admin/dlq", h.listDeadLetters)
+	h.mux.HandleFunc("POST /admin/dlq/{id}/requeue", h.requeueDeadLetter)
+	h.mux.HandleFunc("GET /admin/history", h.listHistory)
+	h.mux.HandleFunc("GET /admin/history/{id}/audit", h.auditRecord)
+	h.mux.HandleFunc("GET /admin/usage", h.usage)
+	h.mux.HandleFunc("POST /jobs", h.triggerJob)
+
+	return h
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	h.mux.ServeHTTP(w, r)
+}
+
+// authorized checks the bearer token using constant-time comparison.
+func (h *Handler) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || h.token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) == 1
+}
+
+// listRepos reports the capability check status of every mapped repository.
+func (h *Handler) listRepos(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"repos": h.opts.Repos.List()})
+}
+
+// replayArchived re-runs an archived webhook payload through parsing and the pipeline.
+func (h *Handler) replayArchived(w http.ResponseWriter, r *http.Request) {
+	if h.opts.Archive == nil {
+		writeError(w, http.StatusNotFound, "payload archive is not configured")
+		return
+	}
+
+	payloadID := r.PathValue("payloadID")
+	body, err := h.opts.Archive.Get(r.Context(), payloadID)
+	if errors.Is(err, archive.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "payload not found")
+		return
+	}
+	if err != nil {
+		log.Printf("failed to load archived payload %s: %v", payloadID, err)
+		writeError(w, http.StatusInternalServerError, "failed to load payload")
+		return
+	}
+
+	h.replay(w, r, body, payloadID)
+}
+
+// replayBody re-runs a webhook payload supplied in the request body.
+func (h *Handler) replayBody(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "failed to read body")
+		return
+	}
+	h.replay(w, r, body, "")
+}
+
+// replay parses a payload and queues it, bypassing signature checks, filters
+// and duplicate suppression. The optional tenant query parameter selects
+// which tenant's repo mappings are used.
+func (h *Handler) replay(w http.ResponseWriter, r *http.Request, body []byte, payloadID string) {
+	wh, parsed, err := webhook.ParsePayload(body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if parsed == nil {
+		writeError(w, http.StatusUnprocessableEntity, "payload has no issue data")
+		return
+	}
+
+	if err := h.opts.Enqueue(webhook.Job{Webhook: wh, ParsedError: parsed, PayloadID: payloadID, Tenant: r.URL.Query().Get("tenant")}); err != nil {
+		writeEnqueueError(w, err)
+		return
+	}
+
+	log.Printf("replaying webhook for issue %s (payload: %q)", parsed.IssueID, payloadID)
+	writeJSON(w, http.StatusAccepted, map[string]string{
+		"status":     "queued",
+		"issue_id":   parsed.IssueID,
+		"payload_id": payloadID,
+	})
+}
+
+// deadLetter is the admin API view of a failed job.
+type deadLetter struct {
+	ID          string    `json:"id"`
+	IssueID     string    `json:"issue_id"`
+	Title       string    `json:"title"`
+	ProjectSlug string    `json:"project"`
+	Tenant      string    `json:"tenant,omitempty"`
+	PayloadID   string    `json:"payload_id,omitempty"`
+	Error       string    `json:"error"`
+	FailedAt    time.Time `json:"failed_at"`
+}
+
+// listDeadLetters reports jobs that failed after exhausting their retries.
+func (h *Handler) listDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if h.opts.DeadLetters == nil {
+		writeError(w, http.StatusNotFound, "dead-letter queue is not configured")
+		return
+	}
+
+	jobs := []deadLetter{}
+	for _, e := range h.opts.DeadLetters.List() {
+		jobs = append(jobs, deadLetter{
+			ID:          e.ID,
+			IssueID:     e.Job.ParsedError.IssueID,
+			Title:       e.Job.ParsedError.Title,
+			ProjectSlug: e.Job.ParsedError.ProjectSlug,
+			Tenant:      e.Job.Tenant,
+			PayloadID:   e.Job.PayloadID,
+			Error:       e.Error,
+			FailedAt:    e.FailedAt,
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"jobs": jobs})
+}
+
+// requeueDeadLetter queues a failed job again, e.g. once the problem that
+// made it fail has been fixed.
+func (h *Handler) requeueDeadLetter(w http.ResponseWriter, r *http.Request) {
+	if h.opts.DeadLetters == nil {
+		writeError(w, http.StatusNotFound, "dead-letter queue is not configured")
+		return
+	}
+
+	id := r.PathValue("id")
+	entry, ok := h.opts.DeadLetters.Get(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "dead letter not found")
+		return
+	}
+
+	if err := h.opts.Enqueue(entry.Job); err != nil {
+		writeEnqueueError(w, err)
+		return
+	}
+	if err := h.opts.DeadLetters.Remove(id); err != nil {
+		log.Printf("failed to remove requeued dead letter %s: %v", id, err)
+	}
+
+	log.Printf("requeued dead letter %s for issue %s", id, entry.Job.ParsedError.IssueID)
+	writeJSON(w, http.StatusAccepted, map[string]string{
+		"status":   "queued",
+		"issue_id": entry.Job.ParsedError.IssueID,
+	})
+}
+
+// defaultHistoryLimit caps the records returned when no limit is given.
+const defaultHistoryLimit = 100
+
+// listHistory reports processed jobs, newest first. The tenant, issue and
+// repo query parameters filter the records and limit caps how many are returned.
+func (h *Handler) listHistory(w http.ResponseWriter, r *http.Request) {
+	if h.opts.History == nil {
+		writeError(w, http.StatusNotFound, "job history is not configured")
+		return
+	}
+
+	query := tracking.Query{
+		Tenant:  r.URL.Query().Get("tenant"),
+		IssueID: r.URL.Query().Get("issue"),
+		Repo:    r.URL.Query().Get("repo"),
+		Limit:   defaultHistoryLimit,
+	}
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		query.Limit = n
+	}
+
+	records := h.opts.History.List(query)
+	if records == nil {
+		records = []tracking.Record{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"records": records})
+}
+
+// auditRecord reports the prompts a job sent to the model and the model's
+// output, by the ID of the job's record.
+func (h *Handler) auditRecord(w http.ResponseWriter, r *http.Request) {
+	if h.opts.Audit == nil {
+		writeError(w, http.StatusNotFound, "audit trail is not configured")
+		return
+	}
+
+	audit, ok, err := h.opts.Audit.Get(r.PathValue("id"))
+	if err != nil {
+		log.Printf("failed to read audit of record %s: %v", r.PathValue("id"), err)
+		writeError(w, http.StatusInternalServerError, "failed to read audit")
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "audit not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, audit)
+}
+
+// usage reports this month's fix generation tokens and cost per repository
+// against the cost budget.
+func (h *Handler) usage(w http.ResponseWriter, r *http.Request) {
+	if h.opts.Usage == nil {
+		writeError(w, http.StatusNotFound, "usage accounting is not configured")
+		return
+	}
+	writeJSON(w, http.StatusOK, h.opts.Usage.Report())
+}
+
+// triggerRequest is the body of a manual job trigger.
+type triggerRequest struct {
+	// Issue is a Sentry issue ID or URL.
+	Issue  string `json:"issue"`
+	Tenant string `json:"tenant,omitempty"`
+}
+
+// triggerJob queues a job for an existing Sentry issue, e.g. an old one that
+// never fired a webhook. Like replays, it bypasses filters and duplicate
+// suppression.
+func (h *Handler) triggerJob(w http.ResponseWriter, r *http.Request) {
+	if h.opts.LoadIssue == nil {
+		writeError(w, http.StatusNotFound, "manual triggers are not configured")
+		return
+	}
+
+	var req triggerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	issueID, err := parseIssueRef(req.Issue)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	wh, err := h.opts.LoadIssue(r.Context(), req.Tenant, issueID)
+	if err != nil {
+		log.Printf("failed to load issue %s: %v", issueID, err)
+		writeError(w, http.StatusBadGateway, "failed to load issue from Sentry: "+err.Error())
+		return
+	}
+	parsed := webhook.ParseWebhook(wh)
+
+	if err := h.opts.Enqueue(webhook.Job{Webhook: wh, ParsedError: parsed, Tenant: req.Tenant}); err != nil {
+		writeEnqueueError(w, err)
+		return
+	}
+
+	log.Printf("manually queued job for issue %s (project: %s)", parsed.IssueID, parsed.ProjectSlug)
+	writeJSON(w, http.StatusAccepted, map[string]string{
+		"status":   "queued",
+		"issue_id": parsed.IssueID,
+	})
+}
+
+// parseIssueRef extracts the issue ID from a numeric ID or an issue URL such
+// as https://sentry.io/organizations/acme/issues/42/ or
+// https://acme.sentry.io/issues/42/.
+func parseIssueRef(ref string) (string, error) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return "", errors.New("issue is required")
+	}
+	if isIssueID(ref) {
+		return ref, nil
+	}
+
+	u, err := url.Parse(ref)
+	if err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+		for i := 0; i+1 < len(segments); i++ {
+			if segments[i] == "issues" && isIssueID(segments[i+1]) {
+				return segments[i+1], nil
+			}
+		}
+	}
+	return "", fmt.Errorf("issue %q is neither an issue ID nor an issue URL", ref)
+}
+
+func isIssueID(s string) bool {
+	_, err := strconv.ParseUint(s, 10, 64)
+	return err == nil
+}
+
+// writeEnqueueError reports why a job could not be queued.
+func writeEnqueueError(w http.ResponseWriter, err error) {
+	if errors.Is(err, webhook.ErrDuplicateJob) {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	writeError(w, http.StatusServiceUnavailable, err.Error())
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,398 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/agent"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/archive"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/gitprovider"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/queue"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/tools"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/tracking"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/webhook"
+)
+
+func TestHandler_Auth(t *testing.T) {
+	handler := NewHandler("s3cret", Options{Repos: NewRepoStatusBoard()})
+
+	tests := []struct {
+		name       string
+		auth       string
+		wantStatus int
+	}{
+		{"valid token", "Bearer s3cret", http.StatusOK},
+		{"wrong token", "Bearer nope", http.StatusUnauthorized},
+		{"missing token", "", http.StatusUnauthorized},
+		{"wrong scheme", "Basic s3cret", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/admin/repos", nil)
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("status code = %v, want %v", rr.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestHandler_ListRepos(t *testing.T) {
+	board := NewRepoStatusBoard()
+	board.SetPending("org/pending")
+	board.Record("org/ok", &gitprovider.Capabilities{ReadContents: true, CreateRefs: true, OpenPRs: true}, nil, time.Now())
+	board.Record("org/degraded", &gitprovider.Capabilities{ReadContents: true}, nil, time.Now())
+	board.Record("org/broken", nil, errors.New("boom"), time.Now())
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/repos", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	rr := httptest.NewRecorder()
+	NewHandler("s3cret", Options{Repos: board}).ServeHTTP(rr, req)
+
+	var resp struct {
+		Repos []RepoStatus `json:"repos"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+
+	want := map[string]string{
+		"org/broken":   "error",
+		"org/degraded": "degraded",
+		"org/ok":       "ok",
+		"org/pending":  "pending",
+	}
+	if len(resp.Repos) != len(want) {
+		t.Fatalf("got %d repos, want %d", len(resp.Repos), len(want))
+	}
+	for _, r := range resp.Repos {
+		if r.Status != want[r.Repo] {
+			t.Errorf("%s status = %q, want %q", r.Repo, r.Status, want[r.Repo])
+		}
+	}
+}
+
+func TestHandler_Replay(t *testing.T) {
+	payload := `{"action":"created","data":{"issue":{"id":"42","project":{"slug":"api"}}}}`
+	archived := memoryArchive{"20240630T120000Z-0a1b2c3d": []byte(payload)}
+
+	var queued []webhook.Job
+	handler := NewHandler("s3cret", Options{
+		Repos:   NewRepoStatusBoard(),
+		Archive: archived,
+		Enqueue: func(job webhook.Job) error {
+			queued = append(queued, job)
+			return nil
+		},
+	})
+
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		wantStatus int
+		wantQueued bool
+	}{
+		{"archived payload", "/admin/replay/20240630T120000Z-0a1b2c3d", "", http.StatusAccepted, true},
+		{"unknown payload", "/admin/replay/20240630T120000Z-ffffffff", "", http.StatusNotFound, false},
+		{"raw body", "/admin/replay", payload, http.StatusAccepted, true},
+		{"invalid body", "/admin/replay", "not json", http.StatusBadRequest, false},
+		{"body without issue", "/admin/replay", `{"action":"created"}`, http.StatusUnprocessableEntity, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queued = nil
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer s3cret")
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("status code = %v, want %v (%s)", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if got := len(queued) == 1; got != tt.wantQueued {
+				t.Errorf("queued = %v, want %v", got, tt.wantQueued)
+			}
+			if tt.wantQueued && queued[0].ParsedError.IssueID != "42" {
+				t.Errorf("queued issue = %q, want 42", queued[0].ParsedError.IssueID)
+			}
+		})
+	}
+}
+
+func TestHandler_DeadLetters(t *testing.T) {
+	dlq, err := queue.OpenDeadLetters("")
+	if err != nil {
+		t.Fatalf("OpenDeadLetters() error = %v", err)
+	}
+	job := webhook.Job{ParsedError: &webhook.ParsedError{IssueID: "42", ProjectSlug: "api"}, Tenant: "acme"}
+	entry, err := dlq.Add(job, errors.New("GitHub returned 502"))
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	queueFull := true
+	var queued []webhook.Job
+	handler := NewHandler("s3cret", Options{
+		Repos:       NewRepoStatusBoard(),
+		DeadLetters: dlq,
+		Enqueue: func(job webhook.Job) error {
+			if queueFull {
+				return webhook.ErrQueueFull
+			}
+			queued = append(queued, job)
+			return nil
+		},
+	})
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer s3cret")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve(http.MethodGet, "/admin/dlq")
+	var resp struct {
+		Jobs []deadLetter `json:"jobs"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	if len(resp.Jobs) != 1 || resp.Jobs[0].ID != entry.ID || resp.Jobs[0].IssueID != "42" || resp.Jobs[0].Error != "GitHub returned 502" {
+		t.Fatalf("GET /admin/dlq = %+v", resp.Jobs)
+	}
+
+	if rr := serve(http.MethodPost, "/admin/dlq/unknown/requeue"); rr.Code != http.StatusNotFound {
+		t.Errorf("requeue unknown status = %v, want %v", rr.Code, http.StatusNotFound)
+	}
+
+	// Entries stay in the DLQ until they are actually requeued
+	if rr := serve(http.MethodPost, "/admin/dlq/"+entry.ID+"/requeue"); rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("requeue with full queue status = %v, want %v", rr.Code, http.StatusServiceUnavailable)
+	}
+	if _, ok := dlq.Get(entry.ID); !ok {
+		t.Fatal("entry removed although requeue failed")
+	}
+
+	queueFull = false
+	if rr := serve(http.MethodPost, "/admin/dlq/"+entry.ID+"/requeue"); rr.Code != http.StatusAccepted {
+		t.Errorf("requeue status = %v, want %v", rr.Code, http.StatusAccepted)
+	}
+	if len(queued) != 1 || queued[0].Tenant != "acme" || queued[0].ParsedError.IssueID != "42" {
+		t.Errorf("queued = %+v, want the dead-lettered job", queued)
+	}
+	if _, ok := dlq.Get(entry.ID); ok {
+		t.Error("requeued entry still in the DLQ")
+	}
+}
+
+func TestHandler_History(t *testing.T) {
+	history, err := tracking.Open("", time.Hour)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	for _, id := range []string{"41", "42"} {
+		rec := tracking.NewRecord(webhook.Job{ParsedError: &webhook.ParsedError{IssueID: id, ProjectSlug: "api"}}, time.Now())
+		rec.Repo = "org/api"
+		rec.SetPullRequest(7, "https://github.com/org/api/pull/7", "sentry-fix/x")
+		if _, err := history.Add(rec); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+	}
+
+	handler := NewHandler("s3cret", Options{Repos: NewRepoStatusBoard(), History: history})
+	serve := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer s3cret")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	tests := []struct {
+		path        string
+		wantStatus  int
+		wantRecords int
+	}{
+		{"/admin/history", http.StatusOK, 2},
+		{"/admin/history?issue=42", http.StatusOK, 1},
+		{"/admin/history?repo=org/web", http.StatusOK, 0},
+		{"/admin/history?limit=1", http.StatusOK, 1},
+		{"/admin/history?limit=zero", http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rr := serve(tt.path)
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status = %v, want %v", rr.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var resp struct {
+				Records []tracking.Record `json:"records"`
+			}
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("invalid JSON response: %v", err)
+			}
+			if len(resp.Records) != tt.wantRecords {
+				t.Errorf("got %d records, want %d", len(resp.Records), tt.wantRecords)
+			}
+			for _, rec := range resp.Records {
+				if rec.PRNumber != 7 || rec.Outcome != tracking.OutcomePROpened {
+					t.Errorf("record = %+v, want PR 7", rec)
+				}
+			}
+		})
+	}
+}
+
+func TestHandler_Audit(t *testing.T) {
+	const id = "0123456789abcdef0123456789abcdef"
+	audit, err := tracking.OpenAuditTrail("", time.Hour, func(s string) string { return s })
+	if err != nil {
+		t.Fatalf("OpenAuditTrail() error = %v", err)
+	}
+	if err := audit.Save(id, []tools.Exchange{{Prompt: "Fix KeyError", Output: "Done"}}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	serve := func(opts Options, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer s3cret")
+		rr := httptest.NewRecorder()
+		NewHandler("s3cret", opts).ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve(Options{Audit: audit}, "/admin/history/"+id+"/audit")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %v, want %v", rr.Code, http.StatusOK)
+	}
+	var got tracking.Audit
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	if got.RecordID != id || len(got.Exchanges) != 1 || got.Exchanges[0].Output != "Done" {
+		t.Errorf("audit = %+v, want the saved exchange", got)
+	}
+
+	if rr := serve(Options{Audit: audit}, "/admin/history/fedcba9876543210fedcba9876543210/audit"); rr.Code != http.StatusNotFound {
+		t.Errorf("unknown record: status = %v, want %v", rr.Code, http.StatusNotFound)
+	}
+	if rr := serve(Options{}, "/admin/history/"+id+"/audit"); rr.Code != http.StatusNotFound {
+		t.Errorf("no audit trail: status = %v, want %v", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestHandler_Usage(t *testing.T) {
+	costs, err := agent.NewCostBudget("", agent.CostLimits{MonthlyUSD: 50}, nil)
+	if err != nil {
+		t.Fatalf("NewCostBudget() error = %v", err)
+	}
+	costs.Record("org/api", agent.Usage{CostUSD: 1.5, InputTokens: 2000, OutputTokens: 300})
+
+	for _, tt := range []struct {
+		opts       Options
+		wantStatus int
+	}{
+		{Options{Repos: NewRepoStatusBoard()}, http.StatusNotFound},
+		{Options{Repos: NewRepoStatusBoard(), Usage: costs}, http.StatusOK},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/admin/usage", nil)
+		req.Header.Set("Authorization", "Bearer s3cret")
+		rr := httptest.NewRecorder()
+		NewHandler("s3cret", tt.opts).ServeHTTP(rr, req)
+		if rr.Code != tt.wantStatus {
+			t.Fatalf("status = %v, want %v", rr.Code, tt.wantStatus)
+		}
+		if tt.wantStatus != http.StatusOK {
+			continue
+		}
+
+		var report agent.CostReport
+		if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+			t.Fatalf("invalid JSON response: %v", err)
+		}
+		if report.Total.CostUSD != 1.5 || report.Repos["org/api"].InputTokens != 2000 || report.Limits.MonthlyUSD != 50 {
+			t.Errorf("usage = %+v", report)
+		}
+	}
+}
+
+func TestHandler_TriggerJob(t *testing.T) {
+	var queued []webhook.Job
+	handler := NewHandler("s3cret", Options{
+		Repos: NewRepoStatusBoard(),
+		Enqueue: func(job webhook.Job) error {
+			queued = append(queued, job)
+			return nil
+		},
+		LoadIssue: func(ctx context.Context, tenant, issueID string) (*webhook.SentryWebhook, error) {
+			if issueID != "42" {
+				return nil, errors.New("404 Not Found")
+			}
+			return &webhook.SentryWebhook{Data: webhook.WebhookData{Issue: &webhook.Issue{ID: "42", Project: webhook.Project{Slug: "api"}}}}, nil
+		},
+	})
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantQueued bool
+	}{
+		{"issue id", `{"issue": "42"}`, http.StatusAccepted, true},
+		{"organization issue url", `{"issue": "https://sentry.io/organizations/acme/issues/42/?project=1"}`, http.StatusAccepted, true},
+		{"subdomain issue url", `{"issue": "https://acme.sentry.io/issues/42/", "tenant": "acme"}`, http.StatusAccepted, true},
+		{"unknown issue", `{"issue": "7"}`, http.StatusBadGateway, false},
+		{"not an issue", `{"issue": "https://sentry.io/organizations/acme/projects/"}`, http.StatusBadRequest, false},
+		{"missing issue", `{}`, http.StatusBadRequest, false},
+		{"invalid body", "not json", http.StatusBadRequest, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queued = nil
+			req := httptest.NewRequest(http.MethodPost, "/jobs", strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer s3cret")
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("status code = %v, want %v (%s)", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if got := len(queued) == 1; got != tt.wantQueued {
+				t.Errorf("queued = %v, want %v", got, tt.wantQueued)
+			}
+			if tt.wantQueued && (queued[0].ParsedError.IssueID != "42" || queued[0].Webhook == nil) {
+				t.Errorf("queued job = %+v, want issue 42", queued[0])
+			}
+		})
+	}
+}
+
+// memoryArchive is an in-memory PayloadArchive for tests.
+type memoryArchive map[string][]byte
+
+func (m memoryArchive) Get(ctx context.Context, id string) ([]byte, error) {
+	data, ok := m[id]
+	if !ok {
+		return nil, archive.ErrNotFound
+	}
+	return data, nil
+}
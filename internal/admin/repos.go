@@ -0,0 +1,68 @@
+package admin
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/gitprovider"
+)
+
+// RepoStatus is the result of checking a repository's credential capabilities.
+type RepoStatus struct {
+	Repo         string                    `json:"repo"`
+	Status       string                    `json:"status"` // "pending", "ok", "degraded", "error"
+	Capabilities *gitprovider.Capabilities `json:"capabilities,omitempty"`
+	Error        string                    `json:"error,omitempty"`
+	CheckedAt    time.Time                 `json:"checked_at,omitempty"`
+}
+
+// RepoStatusBoard holds the latest capability status per repository.
+type RepoStatusBoard struct {
+	mu    sync.RWMutex
+	repos map[string]RepoStatus
+}
+
+// NewRepoStatusBoard creates an empty status board.
+func NewRepoStatusBoard() *RepoStatusBoard {
+	return &RepoStatusBoard{repos: make(map[string]RepoStatus)}
+}
+
+// SetPending marks a repository as awaiting its first check.
+func (b *RepoStatusBoard) SetPending(repo string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.repos[repo] = RepoStatus{Repo: repo, Status: "pending"}
+}
+
+// Record stores the outcome of a capability check.
+func (b *RepoStatusBoard) Record(repo string, caps *gitprovider.Capabilities, err error, at time.Time) RepoStatus {
+	status := RepoStatus{Repo: repo, Capabilities: caps, CheckedAt: at}
+	switch {
+	case err != nil:
+		status.Status = "error"
+		status.Error = err.Error()
+	case caps.OK():
+		status.Status = "ok"
+	default:
+		status.Status = "degraded"
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.repos[repo] = status
+	return status
+}
+
+// List returns all statuses sorted by repository name.
+func (b *RepoStatusBoard) List() []RepoStatus {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	list := make([]RepoStatus, 0, len(b.repos))
+	for _, s := range b.repos {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Repo < list[j].Repo })
+	return list
+}
@@ -0,0 +1,83 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/gitprovider"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/webhook"
+)
+
+// AnalysisLabel marks issues holding the analysis of a fix too uncertain or
+// too large to propose, or for a repository that only gets analyses.
+const AnalysisLabel = "auto-fix-analysis"
+
+// maxAnalysisFiles caps how many of a fix's files are listed in its analysis.
+const maxAnalysisFiles = 10
+
+// maxSuggestedDiffBytes caps how much of a suggested diff goes into an
+// analysis, which must fit in a comment.
+const maxSuggestedDiffBytes = 20000
+
+// AnalysisReport describes a fix that was not proposed because it was
+// oversized, Claude was not confident in it, or the repository only gets
+// analyses: its analysis of the error and the files it would have changed,
+// or its suggested diff.
+func AnalysisReport(fix *ProposedFix) string {
+	var sb strings.Builder
+	if fix.AnalysisOnly {
+		sb.WriteString("SentryAgent analyzed this error and suggests the fix below. It does not open pull requests for this repository, so apply it by hand if it looks right.\n\n")
+	} else if fix.Oversized != "" {
+		fmt.Fprintf(&sb, "SentryAgent analyzed this error, but its fix %s, too much for an automated pull request.\n\n", fix.Oversized)
+	} else {
+		fmt.Fprintf(&sb, "SentryAgent analyzed this error but is not confident enough in a fix (confidence %.0f%%) to open a pull request.\n\n", fix.Confidence*100)
+	}
+
+	analysis := fix.PRBody
+	switch {
+	case fix.Report != nil:
+		analysis = fix.Report.Markdown(nil)
+	case analysis == "":
+		analysis = fix.Description
+	}
+	sb.WriteString(analysis)
+
+	if fix.AnalysisOnly && fix.SuggestedDiff != "" {
+		diff := fix.SuggestedDiff
+		if len(diff) > maxSuggestedDiffBytes {
+			diff = diff[:maxSuggestedDiffBytes] + "\n... (truncated)"
+		}
+		fmt.Fprintf(&sb, "\n\n**Suggested fix:**\n```diff\n%s\n```", strings.TrimRight(diff, "\n"))
+	} else if len(fix.Files) > 0 {
+		sb.WriteString("\n\n**Files the attempted fix changed:**\n")
+		for i, f := range fix.Files {
+			if i == maxAnalysisFiles {
+				fmt.Fprintf(&sb, "- and %d more\n", len(fix.Files)-i)
+				break
+			}
+			fmt.Fprintf(&sb, "- `%s` (%s)\n", f.Path, changeTypeOrModify(f.ChangeType))
+		}
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// OpenAnalysisIssue files AnalysisReport as an issue in the repository.
+func OpenAnalysisIssue(ctx context.Context, provider gitprovider.Provider, parsedError *webhook.ParsedError, fix *ProposedFix) (*gitprovider.IssueResponse, error) {
+	body := AnalysisReport(fix)
+	body += fmt.Sprintf("\n\n---\n🔗 Sentry Issue: %s", parsedError.Permalink)
+	if release := releaseSummary(parsedError); release != "" {
+		body += "\n🏷️ Seen in: " + release
+	}
+	body += "\n🤖 Generated by SentryAgent using Claude Code"
+
+	issue, err := provider.CreateIssue(ctx, gitprovider.IssueRequest{
+		Title:  "Analysis: " + parsedError.Title,
+		Body:   body,
+		Labels: []string{"sentry", AnalysisLabel},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create issue: %w", err)
+	}
+	return issue, nil
+}
@@ -0,0 +1,90 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/webhook"
+)
+
+func TestAnalysisReport(t *testing.T) {
+	fix := &ProposedFix{
+		Description: "Guard against a missing user",
+		PRBody:      "The user lookup returns nil for deleted accounts.",
+		Confidence:  0.35,
+		Files: []FileChange{
+			{Path: "app.py", ChangeType: "modify"},
+			{Path: "tests/test_app.py", ChangeType: "create"},
+		},
+	}
+
+	report := AnalysisReport(fix)
+
+	for _, want := range []string{
+		"(confidence 35%)",
+		"The user lookup returns nil for deleted accounts.",
+		"- `app.py` (modify)",
+		"- `tests/test_app.py` (create)",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("report missing %q:\n%s", want, report)
+		}
+	}
+
+	fix.PRBody = ""
+	if report := AnalysisReport(fix); !strings.Contains(report, "Guard against a missing user") {
+		t.Errorf("report without PR body does not fall back to the description:\n%s", report)
+	}
+
+	fix.Oversized = "changes 40 files, more than the limit of 10"
+	if report := AnalysisReport(fix); !strings.Contains(report, "its fix changes 40 files, more than the limit of 10") {
+		t.Errorf("report does not explain the fix is oversized:\n%s", report)
+	}
+
+	fix.AnalysisOnly = true
+	fix.SuggestedDiff = "--- a/app.py\n+++ b/app.py\n@@ -1 +1 @@\n-return user.name\n+return user.name if user else None\n"
+	report = AnalysisReport(fix)
+	for _, want := range []string{"suggests the fix below", "```diff\n--- a/app.py", "+return user.name if user else None\n```"} {
+		if !strings.Contains(report, want) {
+			t.Errorf("analysis-only report missing %q:\n%s", want, report)
+		}
+	}
+	if strings.Contains(report, "Files the attempted fix changed") {
+		t.Errorf("analysis-only report lists files as well as the diff:\n%s", report)
+	}
+}
+
+func TestOpenAnalysisIssue(t *testing.T) {
+	provider := &fakeProvider{}
+	parsedError := &webhook.ParsedError{
+		Title:     "AttributeError: 'NoneType' object has no attribute 'name'",
+		Permalink: "https://sentry.io/issues/1/",
+		Release:   "1.2.3",
+	}
+	fix := &ProposedFix{Description: "Guard against a missing user", Confidence: 0.2}
+
+	issue, err := OpenAnalysisIssue(context.Background(), provider, parsedError, fix)
+	if err != nil {
+		t.Fatalf("OpenAnalysisIssue() error = %v", err)
+	}
+	if issue.HTMLURL != "https://github.com/owner/repo/issues/1" {
+		t.Errorf("issue URL = %q", issue.HTMLURL)
+	}
+
+	if len(provider.issues) != 1 {
+		t.Fatalf("created %d issues, want 1", len(provider.issues))
+	}
+	req := provider.issues[0]
+	if req.Title != "Analysis: "+parsedError.Title {
+		t.Errorf("title = %q", req.Title)
+	}
+	if len(req.Labels) != 2 || req.Labels[1] != AnalysisLabel {
+		t.Errorf("labels = %v, want sentry and %s", req.Labels, AnalysisLabel)
+	}
+	for _, want := range []string{"Guard against a missing user", "https://sentry.io/issues/1/", "release 1.2.3"} {
+		if !strings.Contains(req.Body, want) {
+			t.Errorf("body missing %q:\n%s", want, req.Body)
+		}
+	}
+}
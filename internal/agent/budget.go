@@ -0,0 +1,139 @@
+package agent
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/store"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/webhook"
+)
+
+// PRBudget caps how many fix PRs are opened per repository per UTC day, so an
+// error storm can't bury maintainers in PRs. Each repository has a limit of
+// its own. Jobs over the budget are deferred and handed back once a new day
+// starts. When created with an empty path it keeps everything in memory.
+type PRBudget struct {
+	path string
+	now  func() time.Time
+
+	mu    sync.Mutex
+	state budgetState
+}
+
+// budgetState is the persisted form of a PRBudget.
+type budgetState struct {
+	Day      string         `json:"day"`
+	Opened   map[string]int `json:"opened"`
+	Deferred []deferredJob  `json:"deferred,omitempty"`
+}
+
+// deferredJob is a job held back on Day because its repository was over budget.
+type deferredJob struct {
+	Job webhook.Job `json:"job"`
+	Day string      `json:"day"`
+}
+
+// NewPRBudget opens the budget at path.
+func NewPRBudget(path string) (*PRBudget, error) {
+	b := &PRBudget{
+		path:  path,
+		now:   time.Now,
+		state: budgetState{Opened: make(map[string]int)},
+	}
+
+	if path != "" {
+		if _, err := store.ReadJSON(path, &b.state); err != nil {
+			return nil, err
+		}
+		if b.state.Opened == nil {
+			b.state.Opened = make(map[string]int)
+		}
+	}
+
+	return b, nil
+}
+
+// Allow reports whether repo may get another PR today when it is allowed
+// limit per day. A limit of 0 or less means no limit.
+func (b *PRBudget) Allow(repo string, limit int) bool {
+	if b == nil || limit <= 0 {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.rollover()
+	return b.state.Opened[repo] < limit
+}
+
+// Record counts a PR opened in repo against today's budget.
+func (b *PRBudget) Record(repo string) error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.rollover()
+	b.state.Opened[repo]++
+	return b.save()
+}
+
+// Defer holds job back until tomorrow. A job for an issue that is already
+// deferred replaces the earlier one.
+func (b *PRBudget) Defer(job webhook.Job) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.rollover()
+	for i, d := range b.state.Deferred {
+		if d.Job.Key() == job.Key() {
+			b.state.Deferred = append(b.state.Deferred[:i], b.state.Deferred[i+1:]...)
+			break
+		}
+	}
+	b.state.Deferred = append(b.state.Deferred, deferredJob{Job: job, Day: b.state.Day})
+	return b.save()
+}
+
+// Release removes and returns the jobs deferred before today, oldest first.
+func (b *PRBudget) Release() ([]webhook.Job, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.rollover()
+	var released []webhook.Job
+	kept := b.state.Deferred[:0]
+	for _, d := range b.state.Deferred {
+		if d.Day == b.state.Day {
+			kept = append(kept, d)
+			continue
+		}
+		released = append(released, d.Job)
+	}
+	if len(released) == 0 {
+		return nil, nil
+	}
+	b.state.Deferred = kept
+	return released, b.save()
+}
+
+// rollover resets the PR counts when a new day has started. Callers must
+// hold b.mu.
+func (b *PRBudget) rollover() {
+	today := b.now().UTC().Format(time.DateOnly)
+	if b.state.Day != today {
+		b.state.Day = today
+		b.state.Opened = make(map[string]int)
+	}
+}
+
+// save writes the budget to disk. Callers must hold b.mu.
+func (b *PRBudget) save() error {
+	if b.path == "" {
+		return nil
+	}
+	return store.WriteJSON(b.path, b.state)
+}
@@ -0,0 +1,87 @@
+package agent
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/webhook"
+)
+
+func TestPRBudget(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pr-budget.json")
+	now := time.Date(2024, 6, 30, 12, 0, 0, 0, time.UTC)
+
+	b, err := NewPRBudget(path)
+	if err != nil {
+		t.Fatalf("NewPRBudget() error = %v", err)
+	}
+	b.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if !b.Allow("org/api", 2) {
+			t.Fatalf("Allow() = false after %d PRs, want true", i)
+		}
+		if err := b.Record("org/api"); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+	if b.Allow("org/api", 2) {
+		t.Error("Allow() = true over budget, want false")
+	}
+	if !b.Allow("org/web", 2) {
+		t.Error("Allow() = false for another repo, want true")
+	}
+
+	job := webhook.Job{ParsedError: &webhook.ParsedError{IssueID: "1", ProjectSlug: "api"}}
+	if err := b.Defer(job); err != nil {
+		t.Fatalf("Defer() error = %v", err)
+	}
+	if err := b.Defer(job); err != nil {
+		t.Fatalf("Defer() error = %v", err)
+	}
+	if released, _ := b.Release(); len(released) != 0 {
+		t.Errorf("Release() on the same day = %d jobs, want 0", len(released))
+	}
+
+	// Counts and deferred jobs survive a restart
+	reopened, err := NewPRBudget(path)
+	if err != nil {
+		t.Fatalf("NewPRBudget() reopen error = %v", err)
+	}
+	reopened.now = func() time.Time { return now }
+	if reopened.Allow("org/api", 2) {
+		t.Error("Allow() after restart = true, want false")
+	}
+
+	// A new day resets the budget and releases deferred jobs once
+	reopened.now = func() time.Time { return now.Add(24 * time.Hour) }
+	if !reopened.Allow("org/api", 2) {
+		t.Error("Allow() on the next day = false, want true")
+	}
+	released, err := reopened.Release()
+	if err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if len(released) != 1 || released[0].ParsedError.IssueID != "1" {
+		t.Errorf("Release() = %+v, want the deferred job", released)
+	}
+	if again, _ := reopened.Release(); len(again) != 0 {
+		t.Errorf("second Release() = %d jobs, want 0", len(again))
+	}
+}
+
+func TestPRBudget_Unlimited(t *testing.T) {
+	var nilBudget *PRBudget
+	if !nilBudget.Allow("org/api", 0) {
+		t.Error("nil budget should allow every PR")
+	}
+
+	b, _ := NewPRBudget("")
+	for i := 0; i < 10; i++ {
+		b.Record("org/api")
+	}
+	if !b.Allow("org/api", 0) {
+		t.Error("budget without a limit should allow every PR")
+	}
+}
@@ -0,0 +1,109 @@
+package agent
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/store"
+)
+
+// Stage is the last completed step of a job.
+type Stage string
+
+const (
+	// StageFixGenerated means Claude Code produced a fix.
+	StageFixGenerated Stage = "fix_generated"
+	// StageBranchPushed means the fix was committed to a branch.
+	StageBranchPushed Stage = "branch_pushed"
+)
+
+// checkpointRetention is how long checkpoints of jobs that never resumed are
+// kept.
+const checkpointRetention = 7 * 24 * time.Hour
+
+// Checkpoint is a job's progress, saved so a job interrupted by a crash
+// resumes from its last completed stage instead of running Claude Code again.
+type Checkpoint struct {
+	Stage     Stage        `json:"stage"`
+	Fix       *ProposedFix `json:"fix"`
+	Branch    *FixBranch   `json:"branch,omitempty"`
+	UpdatedAt time.Time    `json:"updated_at"`
+}
+
+// Checkpoints stores job progress keyed by job. When created with an empty
+// path it keeps everything in memory.
+type Checkpoints struct {
+	path string
+	now  func() time.Time
+
+	mu          sync.Mutex
+	checkpoints map[string]Checkpoint
+}
+
+// OpenCheckpoints opens the checkpoint store at path.
+func OpenCheckpoints(path string) (*Checkpoints, error) {
+	c := &Checkpoints{
+		path:        path,
+		now:         time.Now,
+		checkpoints: make(map[string]Checkpoint),
+	}
+
+	if path != "" {
+		if _, err := store.ReadJSON(path, &c.checkpoints); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// Get returns the checkpoint saved for key.
+func (c *Checkpoints) Get(key string) (Checkpoint, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cp, ok := c.checkpoints[key]
+	return cp, ok
+}
+
+// Save records that the job for key completed cp.Stage.
+func (c *Checkpoints) Save(key string, cp Checkpoint) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.prune()
+	cp.UpdatedAt = c.now()
+	c.checkpoints[key] = cp
+	return c.save()
+}
+
+// Clear forgets the checkpoint for key once its job has finished.
+func (c *Checkpoints) Clear(key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.checkpoints[key]; !ok {
+		return nil
+	}
+	delete(c.checkpoints, key)
+	return c.save()
+}
+
+// prune drops checkpoints of jobs that were never resumed. Callers must hold
+// c.mu.
+func (c *Checkpoints) prune() {
+	now := c.now()
+	for key, cp := range c.checkpoints {
+		if now.Sub(cp.UpdatedAt) > checkpointRetention {
+			delete(c.checkpoints, key)
+		}
+	}
+}
+
+// save writes the checkpoints to disk. Callers must hold c.mu.
+func (c *Checkpoints) save() error {
+	if c.path == "" {
+		return nil
+	}
+	return store.WriteJSON(c.path, c.checkpoints)
+}
@@ -0,0 +1,57 @@
+package agent
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckpoints(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoints.json")
+	now := time.Date(2024, 6, 30, 12, 0, 0, 0, time.UTC)
+
+	c, err := OpenCheckpoints(path)
+	if err != nil {
+		t.Fatalf("OpenCheckpoints() error = %v", err)
+	}
+	c.now = func() time.Time { return now }
+
+	fix := &ProposedFix{PRTitle: "fix: guard nil user"}
+	if err := c.Save("acme/1", Checkpoint{Stage: StageFixGenerated, Fix: fix}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	branch := &FixBranch{Name: "sentry-fix/keyerror-1", Base: "main"}
+	if err := c.Save("acme/1", Checkpoint{Stage: StageBranchPushed, Fix: fix, Branch: branch}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	// Progress survives a restart
+	reopened, err := OpenCheckpoints(path)
+	if err != nil {
+		t.Fatalf("OpenCheckpoints() reopen error = %v", err)
+	}
+	reopened.now = c.now
+	cp, ok := reopened.Get("acme/1")
+	if !ok || cp.Stage != StageBranchPushed || cp.Fix.PRTitle != fix.PRTitle || *cp.Branch != *branch {
+		t.Fatalf("Get() = %+v, %v, want the pushed branch", cp, ok)
+	}
+
+	if err := reopened.Clear("acme/1"); err != nil {
+		t.Fatalf("Clear() error = %v", err)
+	}
+	if _, ok := reopened.Get("acme/1"); ok {
+		t.Error("Get() found a cleared checkpoint")
+	}
+
+	// Checkpoints of jobs that never resume expire
+	if err := reopened.Save("acme/2", Checkpoint{Stage: StageFixGenerated, Fix: fix}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	reopened.now = func() time.Time { return now.Add(checkpointRetention + time.Hour) }
+	if err := reopened.Save("acme/3", Checkpoint{Stage: StageFixGenerated, Fix: fix}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if _, ok := reopened.Get("acme/2"); ok {
+		t.Error("Get() found an expired checkpoint")
+	}
+}
@@ -0,0 +1,246 @@
+package agent
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/store"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/webhook"
+)
+
+// Usage is the tokens and cost of generating fixes.
+type Usage struct {
+	CostUSD      float64 `json:"cost_usd"`
+	InputTokens  int     `json:"input_tokens"`
+	OutputTokens int     `json:"output_tokens"`
+}
+
+// Add returns the sum of u and v.
+func (u Usage) Add(v Usage) Usage {
+	return Usage{
+		CostUSD:      u.CostUSD + v.CostUSD,
+		InputTokens:  u.InputTokens + v.InputTokens,
+		OutputTokens: u.OutputTokens + v.OutputTokens,
+	}
+}
+
+// CostLimits caps spending on fix generation per UTC calendar month. Zero
+// means no cap.
+type CostLimits struct {
+	// MonthlyUSD caps spending across all repositories.
+	MonthlyUSD float64 `json:"monthly_usd,omitempty"`
+	// RepoMonthlyUSD caps spending on each repository.
+	RepoMonthlyUSD float64 `json:"repo_monthly_usd,omitempty"`
+}
+
+// Exhaustion describes a cost budget that has just run out. Repo is empty
+// for the budget across all repositories.
+type Exhaustion struct {
+	Repo     string
+	Month    string
+	SpentUSD float64
+	LimitUSD float64
+}
+
+func (e Exhaustion) String() string {
+	if e.Repo == "" {
+		return fmt.Sprintf("monthly budget of $%.2f (spent $%.2f)", e.LimitUSD, e.SpentUSD)
+	}
+	return fmt.Sprintf("monthly budget of $%.2f for %s (spent $%.2f)", e.LimitUSD, e.Repo, e.SpentUSD)
+}
+
+// CostBudget accounts the tokens and cost of fix generation per repository
+// per UTC month and pauses fix generation once a monthly cap is reached.
+// Jobs over budget are deferred and handed back once a new month starts.
+// When created with an empty path it keeps everything in memory.
+type CostBudget struct {
+	limits      CostLimits
+	path        string
+	now         func() time.Time
+	onExhausted func(Exhaustion)
+
+	mu    sync.Mutex
+	state costState
+}
+
+// costState is the persisted form of a CostBudget.
+type costState struct {
+	Month string                `json:"month"`
+	Repos map[string]*RepoUsage `json:"repos"`
+	// Deferred jobs' Day is the month they were deferred in
+	Deferred []deferredJob `json:"deferred,omitempty"`
+}
+
+// RepoUsage is what fix generation used in a repository this month.
+type RepoUsage struct {
+	Usage
+	Jobs int `json:"jobs"`
+}
+
+// CostReport is the current month's usage.
+type CostReport struct {
+	Month  string               `json:"month"`
+	Total  Usage                `json:"total"`
+	Repos  map[string]RepoUsage `json:"repos"`
+	Limits CostLimits           `json:"limits"`
+	// Deferred counts jobs waiting for the next month.
+	Deferred int `json:"deferred"`
+}
+
+// NewCostBudget opens the cost budget at path. onExhausted, which may be
+// nil, is called once each time a cap is reached.
+func NewCostBudget(path string, limits CostLimits, onExhausted func(Exhaustion)) (*CostBudget, error) {
+	b := &CostBudget{
+		limits:      limits,
+		path:        path,
+		now:         time.Now,
+		onExhausted: onExhausted,
+		state:       costState{Repos: make(map[string]*RepoUsage)},
+	}
+
+	if path != "" {
+		if _, err := store.ReadJSON(path, &b.state); err != nil {
+			return nil, err
+		}
+		if b.state.Repos == nil {
+			b.state.Repos = make(map[string]*RepoUsage)
+		}
+	}
+
+	return b, nil
+}
+
+// Allow reports whether fixes may still be generated for repo this month.
+func (b *CostBudget) Allow(repo string) bool {
+	if b == nil {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.rollover()
+	return b.exhausted(repo) == nil
+}
+
+// Record counts one job's usage in repo against this month's budget.
+func (b *CostBudget) Record(repo string, u Usage) error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	b.rollover()
+	before := b.exhausted(repo)
+	ru := b.state.Repos[repo]
+	if ru == nil {
+		ru = &RepoUsage{}
+		b.state.Repos[repo] = ru
+	}
+	ru.Usage = ru.Usage.Add(u)
+	ru.Jobs++
+	after := b.exhausted(repo)
+	err := b.save()
+	b.mu.Unlock()
+
+	if before == nil && after != nil && b.onExhausted != nil {
+		b.onExhausted(*after)
+	}
+	return err
+}
+
+// Defer holds job back until next month. A job for an issue that is already
+// deferred replaces the earlier one.
+func (b *CostBudget) Defer(job webhook.Job) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.rollover()
+	for i, d := range b.state.Deferred {
+		if d.Job.Key() == job.Key() {
+			b.state.Deferred = append(b.state.Deferred[:i], b.state.Deferred[i+1:]...)
+			break
+		}
+	}
+	b.state.Deferred = append(b.state.Deferred, deferredJob{Job: job, Day: b.state.Month})
+	return b.save()
+}
+
+// Release removes and returns the jobs deferred before this month, oldest
+// first.
+func (b *CostBudget) Release() ([]webhook.Job, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.rollover()
+	var released []webhook.Job
+	kept := b.state.Deferred[:0]
+	for _, d := range b.state.Deferred {
+		if d.Day == b.state.Month {
+			kept = append(kept, d)
+			continue
+		}
+		released = append(released, d.Job)
+	}
+	if len(released) == 0 {
+		return nil, nil
+	}
+	b.state.Deferred = kept
+	return released, b.save()
+}
+
+// Report returns this month's usage.
+func (b *CostBudget) Report() CostReport {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.rollover()
+	report := CostReport{
+		Month:    b.state.Month,
+		Repos:    make(map[string]RepoUsage, len(b.state.Repos)),
+		Limits:   b.limits,
+		Deferred: len(b.state.Deferred),
+	}
+	for repo, ru := range b.state.Repos {
+		report.Repos[repo] = *ru
+		report.Total = report.Total.Add(ru.Usage)
+	}
+	return report
+}
+
+// exhausted returns the cap repo has reached, or nil. Callers must hold b.mu.
+func (b *CostBudget) exhausted(repo string) *Exhaustion {
+	if limit := b.limits.RepoMonthlyUSD; limit > 0 {
+		if ru := b.state.Repos[repo]; ru != nil && ru.CostUSD >= limit {
+			return &Exhaustion{Repo: repo, Month: b.state.Month, SpentUSD: ru.CostUSD, LimitUSD: limit}
+		}
+	}
+	if limit := b.limits.MonthlyUSD; limit > 0 {
+		var total float64
+		for _, ru := range b.state.Repos {
+			total += ru.CostUSD
+		}
+		if total >= limit {
+			return &Exhaustion{Month: b.state.Month, SpentUSD: total, LimitUSD: limit}
+		}
+	}
+	return nil
+}
+
+// rollover starts a new month's accounting. Callers must hold b.mu.
+func (b *CostBudget) rollover() {
+	month := b.now().UTC().Format("2006-01")
+	if b.state.Month != month {
+		b.state.Month = month
+		b.state.Repos = make(map[string]*RepoUsage)
+	}
+}
+
+// save writes the budget to disk. Callers must hold b.mu.
+func (b *CostBudget) save() error {
+	if b.path == "" {
+		return nil
+	}
+	return store.WriteJSON(b.path, b.state)
+}
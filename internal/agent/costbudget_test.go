@@ -0,0 +1,104 @@
+package agent
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/webhook"
+)
+
+func TestCostBudget(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.json")
+	now := time.Date(2024, 6, 30, 12, 0, 0, 0, time.UTC)
+
+	var exhausted []Exhaustion
+	b, err := NewCostBudget(path, CostLimits{MonthlyUSD: 10, RepoMonthlyUSD: 6}, func(e Exhaustion) {
+		exhausted = append(exhausted, e)
+	})
+	if err != nil {
+		t.Fatalf("NewCostBudget() error = %v", err)
+	}
+	b.now = func() time.Time { return now }
+
+	// The repository cap pauses only that repository
+	for i := 0; i < 2; i++ {
+		if !b.Allow("org/api") {
+			t.Fatalf("Allow() = false after %d jobs, want true", i)
+		}
+		if err := b.Record("org/api", Usage{CostUSD: 3, InputTokens: 1000, OutputTokens: 100}); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+	if b.Allow("org/api") {
+		t.Error("Allow() = true over the repository budget, want false")
+	}
+	if !b.Allow("org/web") {
+		t.Error("Allow() = false for another repo, want true")
+	}
+	if len(exhausted) != 1 || exhausted[0].Repo != "org/api" || exhausted[0].SpentUSD != 6 {
+		t.Errorf("exhaustions = %+v, want org/api's", exhausted)
+	}
+
+	// The monthly cap pauses every repository, and is reported once
+	b.Record("org/web", Usage{CostUSD: 3})
+	b.Record("org/web", Usage{CostUSD: 1})
+	if b.Allow("org/docs") {
+		t.Error("Allow() = true over the monthly budget, want false")
+	}
+	if len(exhausted) != 2 || exhausted[1].Repo != "" || exhausted[1].LimitUSD != 10 {
+		t.Errorf("exhaustions = %+v, want the monthly budget's", exhausted)
+	}
+
+	report := b.Report()
+	if report.Month != "2024-06" || report.Total.CostUSD != 10 || report.Total.InputTokens != 2000 {
+		t.Errorf("Report() = %+v", report)
+	}
+	if api := report.Repos["org/api"]; api.Jobs != 2 || api.OutputTokens != 200 {
+		t.Errorf("Report() for org/api = %+v", api)
+	}
+
+	job := webhook.Job{ParsedError: &webhook.ParsedError{IssueID: "1", ProjectSlug: "api"}}
+	if err := b.Defer(job); err != nil {
+		t.Fatalf("Defer() error = %v", err)
+	}
+	if released, _ := b.Release(); len(released) != 0 {
+		t.Errorf("Release() in the same month = %d jobs, want 0", len(released))
+	}
+
+	// Usage and deferred jobs survive a restart
+	reopened, err := NewCostBudget(path, CostLimits{MonthlyUSD: 10, RepoMonthlyUSD: 6}, nil)
+	if err != nil {
+		t.Fatalf("NewCostBudget() reopen error = %v", err)
+	}
+	reopened.now = func() time.Time { return now }
+	if reopened.Allow("org/docs") {
+		t.Error("Allow() after restart = true, want false")
+	}
+
+	// A new month resets the budget and releases deferred jobs
+	reopened.now = func() time.Time { return now.Add(24 * time.Hour) }
+	if !reopened.Allow("org/api") {
+		t.Error("Allow() in the next month = false, want true")
+	}
+	released, err := reopened.Release()
+	if err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if len(released) != 1 || released[0].ParsedError.IssueID != "1" {
+		t.Errorf("Release() = %+v, want the deferred job", released)
+	}
+}
+
+func TestCostBudget_Unlimited(t *testing.T) {
+	var nilBudget *CostBudget
+	if !nilBudget.Allow("org/api") {
+		t.Error("nil budget should allow every job")
+	}
+
+	b, _ := NewCostBudget("", CostLimits{}, nil)
+	b.Record("org/api", Usage{CostUSD: 1000})
+	if !b.Allow("org/api") {
+		t.Error("budget without limits should allow every job")
+	}
+}
@@ -0,0 +1,242 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/gitprovider"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/tools"
+)
+
+// maxDiffCells bounds the LCS table size; larger changes become one hunk.
+const maxDiffCells = 4_000_000
+
+// diffContext is how many unchanged lines surround each hunk of a unified
+// diff.
+const diffContext = 3
+
+// lineHunk replaces old lines OldStart..OldEnd (1-based, inclusive) with
+// NewLines. A pure insertion after line k has OldStart = k+1 and OldEnd = k.
+type lineHunk struct {
+	OldStart int
+	OldEnd   int
+	NewLines []string
+}
+
+// splitLines splits file content into lines without a trailing empty line.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines computes the hunks needed to turn old into new.
+func diffLines(old, new []string) []lineHunk {
+	// Trim the common prefix and suffix, fixes usually touch a few lines
+	prefix := 0
+	for prefix < len(old) && prefix < len(new) && old[prefix] == new[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(old)-prefix && suffix < len(new)-prefix &&
+		old[len(old)-1-suffix] == new[len(new)-1-suffix] {
+		suffix++
+	}
+
+	a := old[prefix : len(old)-suffix]
+	b := new[prefix : len(new)-suffix]
+	if len(a) == 0 && len(b) == 0 {
+		return nil
+	}
+	if len(a)*len(b) > maxDiffCells {
+		return []lineHunk{{OldStart: prefix + 1, OldEnd: prefix + len(a), NewLines: b}}
+	}
+
+	// Longest common subsequence table, lcs[i][j] for a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var hunks []lineHunk
+	var cur *lineHunk
+	flush := func() {
+		if cur != nil {
+			hunks = append(hunks, *cur)
+			cur = nil
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			flush()
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] >= lcs[i+1][j]):
+			if cur == nil {
+				cur = &lineHunk{OldStart: prefix + i + 1, OldEnd: prefix + i}
+			}
+			cur.NewLines = append(cur.NewLines, b[j])
+			j++
+		default:
+			if cur == nil {
+				cur = &lineHunk{OldStart: prefix + i + 1, OldEnd: prefix + i}
+			}
+			cur.OldEnd = prefix + i + 1
+			i++
+		}
+	}
+	flush()
+
+	return hunks
+}
+
+// unifiedDiff renders the change of a file from old to new content as a
+// unified diff, or "" if they are the same. An empty old or new path marks a
+// created or deleted file.
+func unifiedDiff(oldPath, newPath, oldContent, newContent string) string {
+	old, new := splitLines(oldContent), splitLines(newContent)
+	hunks := diffLines(old, new)
+	if len(hunks) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString(diffHeader("---", "a/", oldPath))
+	sb.WriteString(diffHeader("+++", "b/", newPath))
+
+	// delta is how far new line numbers have moved from old ones
+	delta := 0
+	for i := 0; i < len(hunks); {
+		// Hunks whose context would overlap share a header
+		j := i + 1
+		for j < len(hunks) && hunks[j].OldStart-hunks[j-1].OldEnd-1 <= 2*diffContext {
+			j++
+		}
+		group := hunks[i:j]
+		i = j
+
+		start := max(1, group[0].OldStart-diffContext)
+		end := min(len(old), group[len(group)-1].OldEnd+diffContext)
+		var body strings.Builder
+		oldCount, newCount := 0, 0
+		l := start
+		for _, h := range group {
+			for ; l < h.OldStart; l++ {
+				body.WriteString(" " + old[l-1] + "\n")
+				oldCount++
+				newCount++
+			}
+			for ; l <= h.OldEnd; l++ {
+				body.WriteString("-" + old[l-1] + "\n")
+				oldCount++
+			}
+			for _, line := range h.NewLines {
+				body.WriteString("+" + line + "\n")
+				newCount++
+			}
+		}
+		for ; l <= end; l++ {
+			body.WriteString(" " + old[l-1] + "\n")
+			oldCount++
+			newCount++
+		}
+
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(start, oldCount), hunkRange(start+delta, newCount))
+		sb.WriteString(body.String())
+		delta += newCount - oldCount
+	}
+	return sb.String()
+}
+
+// diffHeader renders a unified diff's file header line.
+func diffHeader(marker, prefix, path string) string {
+	if path == "" {
+		return marker + " /dev/null\n"
+	}
+	return marker + " " + prefix + path + "\n"
+}
+
+// hunkRange renders the start,count range of a hunk header; an empty range
+// starts at the line before it.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		start--
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// commentableLines returns the new-side line numbers that appear in a unified
+// diff patch and can therefore carry review comments.
+func commentableLines(patch string) map[int]bool {
+	lines := make(map[int]bool)
+	line := 0
+
+	for _, l := range strings.Split(patch, "\n") {
+		if strings.HasPrefix(l, "@@") {
+			// @@ -a,b +c,d @@
+			fields := strings.Fields(l)
+			if len(fields) < 3 || !strings.HasPrefix(fields[2], "+") {
+				line = 0
+				continue
+			}
+			start, _, _ := strings.Cut(strings.TrimPrefix(fields[2], "+"), ",")
+			line, _ = strconv.Atoi(start)
+			continue
+		}
+		if line == 0 {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(l, "-"):
+			// Removed lines only exist on the old side
+		case strings.HasPrefix(l, "\\"):
+			// "\ No newline at end of file"
+		default:
+			lines[line] = true
+			line++
+		}
+	}
+
+	return lines
+}
+
+// applyDiffs fills in the content of the files given as diffs by applying
+// them to the files in provider at ref. It returns a *FixFailedError if a
+// diff doesn't apply.
+func applyDiffs(ctx context.Context, provider gitprovider.Provider, ref string, files []tools.FileChange) error {
+	for i, f := range files {
+		if f.Diff == "" || f.ChangeType == "delete" {
+			continue
+		}
+		var old string
+		if f.ChangeType != "create" {
+			file, err := provider.FetchFile(ctx, f.Path, ref)
+			if err != nil {
+				return fmt.Errorf("failed to fetch %s to apply its diff: %w", f.Path, err)
+			}
+			old = file.Content
+		}
+		content, err := tools.ApplyPatch(old, f.Diff)
+		if err != nil {
+			return &FixFailedError{Reason: fmt.Sprintf("diff for %s does not apply: %v", f.Path, err)}
+		}
+		files[i].Content = content
+	}
+	return nil
+}
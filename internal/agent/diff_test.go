@@ -0,0 +1,121 @@
+package agent
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name string
+		old  []string
+		new  []string
+		want []lineHunk
+	}{
+		{
+			name: "identical",
+			old:  []string{"a", "b"},
+			new:  []string{"a", "b"},
+			want: nil,
+		},
+		{
+			name: "replace one line",
+			old:  []string{"a", "b", "c"},
+			new:  []string{"a", "B", "c"},
+			want: []lineHunk{{OldStart: 2, OldEnd: 2, NewLines: []string{"B"}}},
+		},
+		{
+			name: "insert after line",
+			old:  []string{"a", "c"},
+			new:  []string{"a", "if x {", "c"},
+			want: []lineHunk{{OldStart: 2, OldEnd: 1, NewLines: []string{"if x {"}}},
+		},
+		{
+			name: "delete and separate change",
+			old:  []string{"a", "b", "c", "d", "e"},
+			new:  []string{"a", "c", "d", "E"},
+			want: []lineHunk{
+				{OldStart: 2, OldEnd: 2},
+				{OldStart: 5, OldEnd: 5, NewLines: []string{"E"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := diffLines(tt.old, tt.new)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffLines() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommentableLines(t *testing.T) {
+	patch := "@@ -1,3 +1,4 @@\n a\n-b\n+B\n+B2\n c\n@@ -10,2 +11,2 @@\n x\n+y"
+
+	got := commentableLines(patch)
+	for _, line := range []int{1, 2, 3, 4, 11, 12} {
+		if !got[line] {
+			t.Errorf("line %d should be commentable", line)
+		}
+	}
+	for _, line := range []int{5, 10, 13} {
+		if got[line] {
+			t.Errorf("line %d should not be commentable", line)
+		}
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	old := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\nn\n"
+
+	tests := []struct {
+		name             string
+		oldPath, newPath string
+		old, new         string
+		want             string
+	}{
+		{
+			name:    "separate hunks",
+			oldPath: "app.py", newPath: "app.py",
+			old: old,
+			new: "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\nn\nextra\n",
+			want: "--- a/app.py\n+++ b/app.py\n" +
+				"@@ -1,5 +1,5 @@\n a\n-b\n+B\n c\n d\n e\n" +
+				"@@ -12,3 +12,4 @@\n l\n m\n n\n+extra\n",
+		},
+		{
+			name:    "overlapping context",
+			oldPath: "app.py", newPath: "app.py",
+			old:  old,
+			new:  "a\nb\nc\nd\nE\nf\ng\nh\ni\nJ\nk\nl\nm\nn\n",
+			want: "--- a/app.py\n+++ b/app.py\n@@ -2,12 +2,12 @@\n b\n c\n d\n-e\n+E\n f\n g\n h\n i\n-j\n+J\n k\n l\n m\n",
+		},
+		{
+			name:    "created",
+			newPath: "new.py",
+			new:     "x\ny\n",
+			want:    "--- /dev/null\n+++ b/new.py\n@@ -0,0 +1,2 @@\n+x\n+y\n",
+		},
+		{
+			name:    "deleted",
+			oldPath: "old.py",
+			old:     "x\n",
+			want:    "--- a/old.py\n+++ /dev/null\n@@ -1,1 +0,0 @@\n-x\n",
+		},
+		{
+			name:    "unchanged",
+			oldPath: "app.py", newPath: "app.py",
+			old: old, new: old,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unifiedDiff(tt.oldPath, tt.newPath, tt.old, tt.new); got != tt.want {
+				t.Errorf("unifiedDiff() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/gitprovider"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/learning"
+)
+
+// errorTypeMarker embeds the Sentry error class in bot PR bodies so reviewer
+// feedback can later be attributed to it.
+const errorTypeMarker = "<!-- sentryagent:error-type=%s -->"
+
+var errorTypeMarkerRe = regexp.MustCompile(`<!-- sentryagent:error-type=(.*?) -->`)
+
+// errorTypeFromBody extracts the error class marker from a bot PR body.
+func errorTypeFromBody(body string) string {
+	if m := errorTypeMarkerRe.FindStringSubmatch(body); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// revertBodyRe matches the body GitHub gives PRs made with its Revert button.
+var revertBodyRe = regexp.MustCompile(`(?m)^Reverts (\S+)#(\d+)\s*$`)
+
+// IngestReviewFeedback stores review comments and requested changes left on
+// bot PRs updated since the last sync, and how the ones that were closed
+// ended. It returns the number of new feedback entries.
+func IngestReviewFeedback(ctx context.Context, provider gitprovider.Provider, store *learning.Store, now time.Time) (int, error) {
+	repo := provider.Owner() + "/" + provider.Repo()
+	since := store.LastSync(repo)
+
+	prs, err := provider.ListPullRequests(ctx, gitprovider.PullRequestQuery{State: "all", Label: AutoFixLabel, UpdatedSince: since})
+	if err != nil {
+		return 0, err
+	}
+
+	added := 0
+	for _, pr := range prs {
+		errorType := errorTypeFromBody(pr.Body)
+
+		var entries []learning.Feedback
+
+		reviews, err := provider.ListReviews(ctx, pr.Number)
+		if err != nil {
+			return added, err
+		}
+		for _, r := range reviews {
+			if r.Body == "" || r.State == "APPROVED" {
+				continue
+			}
+			entries = append(entries, learning.Feedback{
+				ID:        fmt.Sprintf("%s#review-%d", repo, r.ID),
+				Author:    r.User,
+				Body:      r.Body,
+				CreatedAt: r.SubmittedAt,
+			})
+		}
+
+		comments, err := provider.ListReviewComments(ctx, pr.Number)
+		if err != nil {
+			return added, err
+		}
+		for _, c := range comments {
+			if c.Body == "" {
+				continue
+			}
+			entries = append(entries, learning.Feedback{
+				ID:        fmt.Sprintf("%s#comment-%d", repo, c.ID),
+				Author:    c.User,
+				Body:      c.Body,
+				CreatedAt: c.CreatedAt,
+			})
+		}
+
+		for _, fb := range entries {
+			fb.Repo = repo
+			fb.ErrorType = errorType
+			fb.PRNumber = pr.Number
+			isNew, err := store.Add(fb)
+			if err != nil {
+				return added, err
+			}
+			if isNew {
+				added++
+			}
+		}
+
+		if pr.State == "closed" {
+			if err := store.SetOutcome(closedOutcome(repo, errorType, pr, entries)); err != nil {
+				return added, err
+			}
+		}
+	}
+
+	if err := recordReverts(ctx, provider, store, repo, prs, since); err != nil {
+		return added, err
+	}
+	return added, store.SetLastSync(repo, now)
+}
+
+// closedOutcome is how a closed bot PR ended. A PR closed unmerged takes the
+// latest review feedback as the reason it was turned down.
+func closedOutcome(repo, errorType string, pr gitprovider.PullRequest, feedback []learning.Feedback) learning.PROutcome {
+	o := learning.PROutcome{
+		Repo:      repo,
+		ErrorType: errorType,
+		PRNumber:  pr.Number,
+		Title:     pr.Title,
+		Outcome:   learning.OutcomeMerged,
+		At:        pr.MergedAt,
+	}
+	if !pr.MergedAt.IsZero() {
+		return o
+	}
+
+	o.Outcome = learning.OutcomeClosed
+	o.At = pr.UpdatedAt
+	var latest time.Time
+	for _, fb := range feedback {
+		if o.Reason == "" || fb.CreatedAt.After(latest) {
+			o.Reason = fb.Body
+			latest = fb.CreatedAt
+		}
+	}
+	return o
+}
+
+// recordReverts marks bot PRs reverted by a revert PR merged since the last
+// sync, taking the revert PR's description as the reason.
+func recordReverts(ctx context.Context, provider gitprovider.Provider, store *learning.Store, repo string, botPRs []gitprovider.PullRequest, since time.Time) error {
+	closed, err := provider.ListPullRequests(ctx, gitprovider.PullRequestQuery{State: "closed", UpdatedSince: since})
+	if err != nil {
+		return err
+	}
+
+	for _, pr := range closed {
+		if pr.MergedAt.IsZero() {
+			continue
+		}
+		m := revertBodyRe.FindStringSubmatch(pr.Body)
+		if m == nil || m[1] != repo {
+			continue
+		}
+		number, _ := strconv.Atoi(m[2])
+		bot, err := revertedPullRequest(ctx, provider, botPRs, number)
+		if err != nil {
+			return err
+		}
+		if bot == nil || bot.MergedAt.IsZero() {
+			continue
+		}
+		err = store.SetOutcome(learning.PROutcome{
+			Repo:      repo,
+			ErrorType: errorTypeFromBody(bot.Body),
+			PRNumber:  bot.Number,
+			Title:     bot.Title,
+			Outcome:   learning.OutcomeReverted,
+			Reason:    strings.TrimSpace(revertBodyRe.ReplaceAllString(pr.Body, "")),
+			At:        pr.MergedAt,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// revertedPullRequest returns the PR a revert PR reverts if it is a bot PR,
+// fetching it when it wasn't updated since the last sync.
+func revertedPullRequest(ctx context.Context, provider gitprovider.Provider, botPRs []gitprovider.PullRequest, number int) (*gitprovider.PullRequest, error) {
+	for i := range botPRs {
+		if botPRs[i].Number == number {
+			return &botPRs[i], nil
+		}
+	}
+	pr, err := provider.GetPullRequest(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(pr.Labels, AutoFixLabel) {
+		return nil, nil
+	}
+	return pr, nil
+}
@@ -0,0 +1,104 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/gitprovider"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/learning"
+)
+
+func TestIngestReviewFeedback(t *testing.T) {
+	now := time.Date(2024, 6, 30, 12, 0, 0, 0, time.UTC)
+	provider := &fakeProvider{
+		prs: []gitprovider.PullRequest{
+			{Number: 7, UpdatedAt: now, Body: "Fix\n\n" + fmt.Sprintf(errorTypeMarker, "KeyError")},
+			{Number: 8, UpdatedAt: now, Body: "Fix\n\n" + fmt.Sprintf(errorTypeMarker, "KeyError")},
+		},
+		reviews: map[int][]gitprovider.Review{
+			7: {
+				{ID: 1, State: "CHANGES_REQUESTED", Body: "Check the key at the call site"},
+				{ID: 2, State: "APPROVED", Body: "LGTM"},
+			},
+		},
+		reviewComments: map[int][]gitprovider.ReviewComment{
+			7: {{ID: 3, Path: "app.py", Body: "Add a regression test", CreatedAt: now.Add(-time.Hour)}},
+			8: {{ID: 4, Path: "app.py", Body: "This needs a regression test.", CreatedAt: now}},
+		},
+	}
+
+	store, _ := learning.NewStore("")
+
+	added, err := IngestReviewFeedback(context.Background(), provider, store, now)
+	if err != nil {
+		t.Fatalf("IngestReviewFeedback() error = %v", err)
+	}
+	if added != 3 {
+		t.Errorf("added = %d, want 3", added)
+	}
+
+	// Only the regression test asked for on both PRs is a theme
+	themes := store.Themes("owner/repo", "KeyError", 5)
+	if len(themes) != 1 || themes[0].Text != "This needs a regression test." || themes[0].Count != 2 {
+		t.Fatalf("Themes() = %+v, want the regression test comments", themes)
+	}
+
+	// A second run with nothing updated since the last sync adds nothing
+	added, err = IngestReviewFeedback(context.Background(), provider, store, now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("IngestReviewFeedback() second run error = %v", err)
+	}
+	if added != 0 {
+		t.Errorf("second run added = %d, want 0", added)
+	}
+}
+
+func TestIngestReviewFeedback_Outcomes(t *testing.T) {
+	now := time.Date(2024, 6, 30, 12, 0, 0, 0, time.UTC)
+	marker := fmt.Sprintf(errorTypeMarker, "KeyError")
+	provider := &fakeProvider{
+		prs: []gitprovider.PullRequest{
+			{Number: 7, Title: "Guard missing key", State: "closed", UpdatedAt: now, Body: marker},
+			{Number: 8, Title: "Default the key", State: "closed", UpdatedAt: now, MergedAt: now, Body: marker},
+			{Number: 9, Title: "Revert \"Default the key\"", State: "closed", UpdatedAt: now, MergedAt: now,
+				Body: "Reverts owner/repo#8\n\nThe default hid a data bug"},
+		},
+		reviews: map[int][]gitprovider.Review{
+			7: {{ID: 1, State: "CHANGES_REQUESTED", Body: "The key must be validated upstream", SubmittedAt: now}},
+		},
+	}
+
+	store, _ := learning.NewStore("")
+	if _, err := IngestReviewFeedback(context.Background(), provider, store, now); err != nil {
+		t.Fatalf("IngestReviewFeedback() error = %v", err)
+	}
+
+	closed, ok := store.Outcome("owner/repo", 7)
+	if !ok || closed.Outcome != learning.OutcomeClosed || closed.Reason != "The key must be validated upstream" {
+		t.Errorf("PR 7 outcome = %+v, want closed with the review as reason", closed)
+	}
+	reverted, ok := store.Outcome("owner/repo", 8)
+	if !ok || reverted.Outcome != learning.OutcomeReverted || reverted.Reason != "The default hid a data bug" {
+		t.Errorf("PR 8 outcome = %+v, want reverted with the revert description as reason", reverted)
+	}
+	if summary := store.Outcomes("owner/repo", "KeyError", 5); summary.Rejected != 2 {
+		t.Errorf("Outcomes() = %+v, want 2 rejected", summary)
+	}
+
+	// A later revert of a bot PR not updated since the last sync
+	provider.prs = append(provider.prs,
+		gitprovider.PullRequest{Number: 10, Title: "Check the key", State: "closed", Labels: []string{AutoFixLabel},
+			UpdatedAt: now.Add(-48 * time.Hour), MergedAt: now.Add(-48 * time.Hour), Body: marker},
+		gitprovider.PullRequest{Number: 11, Title: "Revert \"Check the key\"", State: "closed",
+			UpdatedAt: now.Add(time.Hour), MergedAt: now.Add(time.Hour), Body: "Reverts owner/repo#10\n\nBroke the importer"},
+	)
+	if _, err := IngestReviewFeedback(context.Background(), provider, store, now.Add(2*time.Hour)); err != nil {
+		t.Fatalf("IngestReviewFeedback() second run error = %v", err)
+	}
+	reverted, ok = store.Outcome("owner/repo", 10)
+	if !ok || reverted.Outcome != learning.OutcomeReverted || reverted.Reason != "Broke the importer" {
+		t.Errorf("PR 10 outcome = %+v, want reverted with the revert description as reason", reverted)
+	}
+}
@@ -0,0 +1,47 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/gitprovider"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/webhook"
+)
+
+// fingerprintMarker embeds the error's fingerprint in bot PR bodies so a
+// recurrence of a fixed error can be matched to its fix.
+const fingerprintMarker = "<!-- sentryagent:fingerprint=%s -->"
+
+// FindMergedFix returns the most recently merged bot PR that fixed an error
+// with the same fingerprint, or nil if there is none.
+func FindMergedFix(ctx context.Context, provider gitprovider.Provider, parsedError *webhook.ParsedError) (*gitprovider.PullRequest, error) {
+	fingerprint := parsedError.Fingerprint()
+	query := fmt.Sprintf("is:merged label:%s \"sentryagent:fingerprint=%s\"", AutoFixLabel, fingerprint)
+	prs, err := provider.SearchPullRequests(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	// Search matches words, so confirm the exact marker
+	marker := fmt.Sprintf(fingerprintMarker, fingerprint)
+	var found *gitprovider.PullRequest
+	for i := range prs {
+		pr := &prs[i]
+		if pr.MergedAt.IsZero() || !strings.Contains(pr.Body, marker) {
+			continue
+		}
+		if found == nil || pr.MergedAt.After(found.MergedAt) {
+			found = pr
+		}
+	}
+	return found, nil
+}
+
+// AlreadyFixedComment explains on the Sentry issue that its error was fixed
+// by a merged PR, so no new fix is proposed.
+func AlreadyFixedComment(pr *gitprovider.PullRequest) string {
+	return fmt.Sprintf("SentryAgent already fixed this error in #%d (%s), merged on %s, so it is not proposing another fix. "+
+		"If the error still occurs in a release that includes that fix, the fix is incomplete and the error needs a closer look.",
+		pr.Number, pr.HTMLURL, pr.MergedAt.Format("2006-01-02"))
+}
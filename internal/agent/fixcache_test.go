@@ -0,0 +1,49 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/gitprovider"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/webhook"
+)
+
+func TestFindMergedFix(t *testing.T) {
+	parsed := &webhook.ParsedError{IssueID: "42", Culprit: "app.handler", ErrorType: "KeyError"}
+	other := &webhook.ParsedError{Culprit: "app.views", ErrorType: "KeyError"}
+	body := func(p *webhook.ParsedError) string {
+		return "Fix\n\n" + fmt.Sprintf(fingerprintMarker, p.Fingerprint())
+	}
+	merged := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	provider := &fakeProvider{
+		prs: []gitprovider.PullRequest{
+			{Number: 1, Body: body(parsed), MergedAt: merged},
+			{Number: 2, Body: body(parsed)}, // closed without merging
+			{Number: 3, Body: body(other), MergedAt: merged.Add(time.Hour)},
+			{Number: 4, Body: body(parsed), MergedAt: merged.Add(time.Hour), HTMLURL: "https://github.com/owner/repo/pull/4"},
+		},
+	}
+
+	pr, err := FindMergedFix(context.Background(), provider, parsed)
+	if err != nil {
+		t.Fatalf("FindMergedFix() error = %v", err)
+	}
+	if pr == nil || pr.Number != 4 {
+		t.Fatalf("FindMergedFix() = %+v, want PR #4", pr)
+	}
+	wantQuery := fmt.Sprintf("is:merged label:%s \"sentryagent:fingerprint=%s\"", AutoFixLabel, parsed.Fingerprint())
+	if len(provider.searches) != 1 || provider.searches[0] != wantQuery {
+		t.Errorf("searches = %q, want [%q]", provider.searches, wantQuery)
+	}
+	if comment := AlreadyFixedComment(pr); !strings.Contains(comment, "#4 (https://github.com/owner/repo/pull/4), merged on 2024-06-01") {
+		t.Errorf("AlreadyFixedComment() = %q", comment)
+	}
+
+	provider.prs = provider.prs[1:3]
+	if pr, err := FindMergedFix(context.Background(), provider, parsed); err != nil || pr != nil {
+		t.Errorf("FindMergedFix() = %+v, %v, want none", pr, err)
+	}
+}
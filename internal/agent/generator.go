@@ -0,0 +1,265 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/config"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/gitprovider"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/tools"
+)
+
+// Fix generation backends
+const (
+	// BackendClaudeCode runs the Claude Code CLI in a clone of the repository.
+	BackendClaudeCode = "claude-code"
+	// BackendAnthropicAPI calls the Anthropic Messages API directly, reading
+	// the repository through the git provider.
+	BackendAnthropicAPI = "anthropic-api"
+	// BackendVertex calls Claude on Google Vertex AI, reading the repository
+	// through the git provider like BackendAnthropicAPI.
+	BackendVertex = "vertex"
+)
+
+// FixGenerator generates a fix for req in a repository. An empty branch
+// means the repository's default branch, and token authenticates to the git
+// provider. Generators may set req.StyleGuide from repo.StyleGuidePath and
+// req.Instructions from repo.PromptTemplate and repo.InstructionFiles.
+type FixGenerator interface {
+	GenerateFix(ctx context.Context, repo *config.RepoMapping, branch, token string, req *tools.FixRequest) (*tools.FixResponse, error)
+}
+
+// FixReviewer is implemented by generators that can also review a fix, with
+// the same access to the repository they have when generating one.
+type FixReviewer interface {
+	ReviewFix(ctx context.Context, repo *config.RepoMapping, branch, token string, req *tools.ReviewRequest) (*tools.ReviewResponse, error)
+}
+
+// GeneratorFactory builds a backend's FixGenerator. sessions is shared by
+// every generator the pipeline creates, capping concurrent Claude sessions.
+type GeneratorFactory func(opts PipelineOptions, sessions *tools.Sessions) (FixGenerator, error)
+
+var (
+	generatorsMu sync.RWMutex
+	generators   = make(map[string]GeneratorFactory)
+)
+
+func init() {
+	RegisterGenerator(BackendClaudeCode, func(opts PipelineOptions, sessions *tools.Sessions) (FixGenerator, error) {
+		cli := opts.ClaudeCode
+		cli.APIKey = opts.AnthropicAPIKey
+		cli.Limits = opts.ProcessLimits
+		return &claudeCodeGenerator{
+			opts:       cli,
+			sessions:   sessions,
+			workspaces: tools.NewWorkspaces(opts.WorkspaceCacheDir, opts.WorkDirs),
+			depth:      opts.CloneDepth,
+		}, nil
+	})
+	RegisterGenerator(BackendAnthropicAPI, func(opts PipelineOptions, sessions *tools.Sessions) (FixGenerator, error) {
+		return &apiGenerator{
+			name: "Anthropic API",
+			opts: tools.AnthropicOptions{
+				APIKey:  opts.AnthropicAPIKey,
+				Model:   opts.Model,
+				BaseURL: opts.BaseURL,
+			},
+			sessions: sessions,
+		}, nil
+	})
+	RegisterGenerator(BackendVertex, func(opts PipelineOptions, sessions *tools.Sessions) (FixGenerator, error) {
+		if opts.Vertex == nil {
+			return nil, fmt.Errorf("%s backend requires Vertex options", BackendVertex)
+		}
+		return &apiGenerator{
+			name:     "Vertex AI",
+			opts:     tools.AnthropicOptions{Model: opts.Model, Vertex: opts.Vertex},
+			sessions: sessions,
+		}, nil
+	})
+}
+
+// RegisterGenerator makes a fix generation backend available to NewPipeline
+// under name. It panics if name is already registered.
+func RegisterGenerator(name string, factory GeneratorFactory) {
+	generatorsMu.Lock()
+	defer generatorsMu.Unlock()
+	if _, ok := generators[name]; ok {
+		panic("agent: generator " + name + " registered twice")
+	}
+	generators[name] = factory
+}
+
+// Generators returns the names of the registered backends, sorted.
+func Generators() []string {
+	generatorsMu.RLock()
+	defer generatorsMu.RUnlock()
+	names := make([]string, 0, len(generators))
+	for name := range generators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newGenerator builds the generator for opts.Backend, defaulting to
+// BackendClaudeCode.
+func newGenerator(opts PipelineOptions) (FixGenerator, error) {
+	name := opts.Backend
+	if name == "" {
+		name = BackendClaudeCode
+	}
+	generatorsMu.RLock()
+	factory, ok := generators[name]
+	generatorsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown fix backend %q (expected %s)", name, strings.Join(Generators(), ", "))
+	}
+	return factory(opts, tools.NewSessions(opts.MaxSessions))
+}
+
+// claudeCodeGenerator checks out the repository and runs the Claude Code CLI
+// in it.
+type claudeCodeGenerator struct {
+	opts       tools.ClaudeCodeOptions
+	sessions   *tools.Sessions
+	workspaces *tools.Workspaces
+	depth      int
+}
+
+func (g *claudeCodeGenerator) GenerateFix(ctx context.Context, repo *config.RepoMapping, branch, token string, req *tools.FixRequest) (*tools.FixResponse, error) {
+	repoURL := fmt.Sprintf("https://github.com/%s.git", repo.FullName())
+
+	// Clone the repository, or update its cached clone
+	log.Printf("Checking out repository: %s", repoURL)
+	clone := tools.CloneOptions{Depth: g.depth}
+	if repo.SparseCheckout {
+		for _, f := range req.Stacktrace {
+			clone.Sparse = append(clone.Sparse, f.Filename)
+		}
+		if repo.StyleGuidePath != "" {
+			clone.Sparse = append(clone.Sparse, repo.StyleGuidePath)
+		}
+		clone.Sparse = append(clone.Sparse, repo.InstructionFiles...)
+	}
+	repoDir, cleanup, err := g.workspaces.Checkout(ctx, repoURL, token, branch, clone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to clone repo: %w", err)
+	}
+	defer cleanup()
+
+	log.Printf("Repository checked out to: %s", repoDir)
+
+	// Include the repo's style guide so generated code matches house style
+	if repo.StyleGuidePath != "" {
+		styleGuide, err := loadRepoDoc(repoDir, repo.StyleGuidePath)
+		if err != nil {
+			return nil, err
+		}
+		if styleGuide != "" {
+			log.Printf("Using style guide %s", repo.StyleGuidePath)
+		}
+		req.StyleGuide = styleGuide
+	}
+	req.Instructions, err = repoInstructions(repo, req, func(relPath string) (string, error) {
+		return loadRepoDoc(repoDir, relPath)
+	}, claudeMemoryFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// Run Claude Code to generate the fix
+	log.Printf("Running Claude Code to analyze and fix the error...")
+	resp, err := tools.NewClaudeCodeTool(repoDir, g.options(repo), g.sessions).GenerateFix(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("Claude Code error: %w", err)
+	}
+	return resp, nil
+}
+
+func (g *claudeCodeGenerator) ReviewFix(ctx context.Context, repo *config.RepoMapping, branch, token string, req *tools.ReviewRequest) (*tools.ReviewResponse, error) {
+	repoURL := fmt.Sprintf("https://github.com/%s.git", repo.FullName())
+	repoDir, cleanup, err := g.workspaces.Checkout(ctx, repoURL, token, branch, tools.CloneOptions{Depth: g.depth})
+	if err != nil {
+		return nil, fmt.Errorf("failed to clone repo: %w", err)
+	}
+	defer cleanup()
+
+	log.Printf("Running Claude Code to review the fix...")
+	resp, err := tools.NewClaudeCodeTool(repoDir, g.options(repo), g.sessions).ReviewFix(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("Claude Code error: %w", err)
+	}
+	return resp, nil
+}
+
+// options returns the CLI options for repo, which may use its own model.
+func (g *claudeCodeGenerator) options(repo *config.RepoMapping) tools.ClaudeCodeOptions {
+	opts := g.opts
+	if repo.Model != "" {
+		opts.Model = repo.Model
+	}
+	return opts
+}
+
+// apiGenerator calls the Anthropic API or Vertex AI, letting the model read
+// the repository through GitHub instead of a clone.
+type apiGenerator struct {
+	// name is the API being called, for logs and errors
+	name     string
+	opts     tools.AnthropicOptions
+	sessions *tools.Sessions
+}
+
+func (g *apiGenerator) GenerateFix(ctx context.Context, repo *config.RepoMapping, branch, token string, req *tools.FixRequest) (*tools.FixResponse, error) {
+	provider := gitprovider.NewGitHubProvider(token, repo.Owner, repo.Repo)
+
+	if repo.StyleGuidePath != "" {
+		styleGuide, err := fetchRepoDoc(ctx, provider, branch, repo.StyleGuidePath)
+		if err != nil {
+			return nil, err
+		}
+		if styleGuide != "" {
+			log.Printf("Using style guide %s", repo.StyleGuidePath)
+		}
+		req.StyleGuide = styleGuide
+	}
+	instructions, err := repoInstructions(repo, req, func(relPath string) (string, error) {
+		return fetchRepoDoc(ctx, provider, branch, relPath)
+	}, "")
+	if err != nil {
+		return nil, err
+	}
+	req.Instructions = instructions
+
+	log.Printf("Calling the %s to analyze and fix the error...", g.name)
+	resp, err := tools.NewAnthropicTool(provider, branch, g.options(repo), g.sessions).GenerateFix(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("%s error: %w", g.name, err)
+	}
+	return resp, nil
+}
+
+func (g *apiGenerator) ReviewFix(ctx context.Context, repo *config.RepoMapping, branch, token string, req *tools.ReviewRequest) (*tools.ReviewResponse, error) {
+	provider := gitprovider.NewGitHubProvider(token, repo.Owner, repo.Repo)
+
+	log.Printf("Calling the %s to review the fix...", g.name)
+	resp, err := tools.NewAnthropicTool(provider, branch, g.options(repo), g.sessions).ReviewFix(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("%s error: %w", g.name, err)
+	}
+	return resp, nil
+}
+
+// options returns the API options for repo, which may use its own model.
+func (g *apiGenerator) options(repo *config.RepoMapping) tools.AnthropicOptions {
+	opts := g.opts
+	if repo.Model != "" {
+		opts.Model = repo.Model
+	}
+	return opts
+}
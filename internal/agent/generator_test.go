@@ -0,0 +1,72 @@
+package agent
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/config"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/tools"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/webhook"
+)
+
+// fakeGenerator records the request it was given and returns a canned fix.
+type fakeGenerator struct {
+	req  *tools.FixRequest
+	resp *tools.FixResponse
+}
+
+func (g *fakeGenerator) GenerateFix(ctx context.Context, repo *config.RepoMapping, branch, token string, req *tools.FixRequest) (*tools.FixResponse, error) {
+	g.req = req
+	return g.resp, nil
+}
+
+func TestNewPipeline_RegisteredGenerator(t *testing.T) {
+	fake := &fakeGenerator{resp: &tools.FixResponse{
+		Success: true,
+		PRTitle: "fix: guard nil user",
+		Files:   []tools.FileChange{{Path: "app.py", Content: "fixed", ChangeType: "modify"}},
+	}}
+	RegisterGenerator("fake", func(opts PipelineOptions, sessions *tools.Sessions) (FixGenerator, error) {
+		return fake, nil
+	})
+	if !slices.Contains(Generators(), "fake") {
+		t.Errorf("Generators() = %v, want it to include fake", Generators())
+	}
+
+	pipeline, err := NewPipeline(nil, PipelineOptions{Backend: "fake"})
+	if err != nil {
+		t.Fatalf("NewPipeline() error = %v", err)
+	}
+	fix, err := pipeline.Run(context.Background(), &config.RepoMapping{Owner: "o", Repo: "r"}, "token", &webhook.ParsedError{IssueID: "1", ErrorType: "AttributeError"})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if fake.req == nil || fake.req.IssueID != "1" {
+		t.Errorf("generator request = %+v", fake.req)
+	}
+	if fix.PRTitle != "fix: guard nil user" || len(fix.Files) != 1 || fix.Files[0].Path != "app.py" {
+		t.Errorf("Run() = %+v", fix)
+	}
+}
+
+func TestNewPipeline_Backends(t *testing.T) {
+	tests := []struct {
+		opts    PipelineOptions
+		wantErr bool
+	}{
+		{PipelineOptions{}, false},
+		{PipelineOptions{Backend: BackendClaudeCode}, false},
+		{PipelineOptions{Backend: BackendAnthropicAPI, AnthropicAPIKey: "key"}, false},
+		{PipelineOptions{Backend: BackendVertex, Vertex: &tools.VertexOptions{ProjectID: "p"}}, false},
+		{PipelineOptions{Backend: BackendVertex}, true},
+		{PipelineOptions{Backend: "gpt"}, true},
+	}
+
+	for _, tt := range tests {
+		_, err := NewPipeline(nil, tt.opts)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewPipeline(%q) error = %v, wantErr %v", tt.opts.Backend, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package agent
+
+import (
+	"context"
+	"log"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/gitprovider"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/tools"
+)
+
+// gatherHistory fetches the latest commits commits touching the file the
+// error was raised in, so a regression can be fixed at its cause. The file
+// is the first of sources if there are any; otherwise it is looked up from
+// the frames. It returns nil if the file or its history can't be found.
+func gatherHistory(ctx context.Context, provider gitprovider.Provider, ref string, frames []tools.Frame, sources []tools.SourceFile, commits int) *tools.FileHistory {
+	var path string
+	if len(sources) > 0 {
+		path = sources[0].Path
+	} else {
+		// Sentry lists the frame that raised the error last
+		for i := len(frames) - 1; i >= 0 && path == ""; i-- {
+			if frames[i].InApp && !frames[i].Minified {
+				path, _ = fetchFrameFile(ctx, provider, ref, frames[i].Filename)
+			}
+		}
+	}
+	if path == "" {
+		return nil
+	}
+
+	history, err := provider.FileHistory(ctx, path, ref, commits)
+	if err != nil {
+		log.Printf("Failed to fetch the history of %s, leaving it out of the prompt: %v", path, err)
+		return nil
+	}
+	if len(history) == 0 {
+		return nil
+	}
+
+	file := &tools.FileHistory{Path: path}
+	for _, c := range history {
+		file.Commits = append(file.Commits, tools.HistoryCommit{
+			SHA:     c.SHA,
+			Message: c.Message,
+			Author:  c.Author,
+			Date:    c.Date.Format("2006-01-02"),
+			Patch:   c.Patch,
+		})
+	}
+	return file
+}
@@ -0,0 +1,45 @@
+package agent
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/gitprovider"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/tools"
+)
+
+func TestGatherHistory(t *testing.T) {
+	provider := &fakeProvider{
+		files: map[string]string{"app/handler.py": "", "app/models.py": ""},
+		history: map[string][]gitprovider.Commit{
+			"app/handler.py": {
+				{SHA: "abc1234def", Message: "Refactor user loading", Author: "Dana", Date: time.Date(2026, 10, 15, 9, 0, 0, 0, time.UTC), Patch: "-user = load(id)\n+user = cache.get(id)"},
+				{SHA: "0987fed", Message: "Add handler", Author: "Lee", Date: time.Date(2026, 9, 1, 9, 0, 0, 0, time.UTC)},
+			},
+		},
+	}
+	frames := []tools.Frame{
+		{Filename: "/srv/app/models.py", LineNo: 2, InApp: true},
+		{Filename: "/srv/app/handler.py", LineNo: 5, InApp: true},
+		{Filename: "django/core/handlers/base.py", LineNo: 100},
+	}
+
+	got := gatherHistory(context.Background(), provider, "main", frames, nil, 1)
+	want := &tools.FileHistory{
+		Path: "app/handler.py",
+		Commits: []tools.HistoryCommit{
+			{SHA: "abc1234def", Message: "Refactor user loading", Author: "Dana", Date: "2026-10-15", Patch: "-user = load(id)\n+user = cache.get(id)"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("gatherHistory() = %+v, want %+v", got, want)
+	}
+
+	// The source already gathered names the culprit file
+	got = gatherHistory(context.Background(), provider, "main", frames, []tools.SourceFile{{Path: "app/models.py"}}, 5)
+	if got != nil {
+		t.Errorf("gatherHistory() for a file without history = %+v, want nil", got)
+	}
+}
@@ -0,0 +1,61 @@
+package agent
+
+import (
+	"log"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/config"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/tools"
+)
+
+// claudeMemoryFile is the instruction file the Claude Code CLI reads from
+// the root of its working directory by itself.
+const claudeMemoryFile = "CLAUDE.md"
+
+// repoInstructions returns the maintainers' notes for a fix in repo: its
+// prompt template rendered against req, then those of its instruction files
+// read finds, apart from skip. A template that fails to render is left out
+// rather than failing the fix.
+func repoInstructions(repo *config.RepoMapping, req *tools.FixRequest, read func(relPath string) (string, error), skip string) ([]tools.Instructions, error) {
+	var instructions []tools.Instructions
+
+	if repo.PromptTemplate != "" {
+		text, err := renderPromptTemplate(repo.PromptTemplate, req)
+		if err != nil {
+			log.Printf("Failed to render prompt template for %s, continuing without it: %v", repo.FullName(), err)
+		} else if text != "" {
+			instructions = append(instructions, tools.Instructions{Source: "prompt template", Text: text})
+		}
+	}
+
+	for _, relPath := range repo.InstructionFiles {
+		if skip != "" && strings.TrimPrefix(filepath.Clean("/"+relPath), "/") == skip {
+			continue
+		}
+		text, err := read(relPath)
+		if err != nil {
+			return nil, err
+		}
+		if text != "" {
+			log.Printf("Using instructions from %s", relPath)
+			instructions = append(instructions, tools.Instructions{Source: relPath, Text: text})
+		}
+	}
+	return instructions, nil
+}
+
+// renderPromptTemplate executes a prompt template with the fix request as
+// its data, so it can refer to e.g. {{.Platform}} or {{.ErrorType}}.
+func renderPromptTemplate(text string, req *tools.FixRequest) (string, error) {
+	tmpl, err := template.New("prompt").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, req); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(sb.String()), nil
+}
@@ -0,0 +1,67 @@
+package agent
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/config"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/tools"
+)
+
+func TestRepoInstructions(t *testing.T) {
+	files := map[string]string{
+		"CLAUDE.md":   "Run make test before committing.",
+		".autofix.md": "Never touch migrations/.",
+	}
+	read := func(relPath string) (string, error) { return files[relPath], nil }
+	req := &tools.FixRequest{Platform: "python", ErrorType: "KeyError"}
+
+	tests := []struct {
+		name     string
+		template string
+		skip     string
+		want     []tools.Instructions
+	}{
+		{
+			name: "files",
+			want: []tools.Instructions{
+				{Source: "CLAUDE.md", Text: "Run make test before committing."},
+				{Source: ".autofix.md", Text: "Never touch migrations/."},
+			},
+		},
+		{
+			name:     "template",
+			template: "{{if eq .Platform \"python\"}}Use dict.get for {{.ErrorType}}s.{{end}}\n",
+			skip:     claudeMemoryFile,
+			want: []tools.Instructions{
+				{Source: "prompt template", Text: "Use dict.get for KeyErrors."},
+				{Source: ".autofix.md", Text: "Never touch migrations/."},
+			},
+		},
+		{
+			name:     "broken template",
+			template: "{{.NoSuchField}}",
+			skip:     claudeMemoryFile,
+			want:     []tools.Instructions{{Source: ".autofix.md", Text: "Never touch migrations/."}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &config.RepoMapping{
+				Owner:            "org",
+				Repo:             "app",
+				PromptTemplate:   tt.template,
+				InstructionFiles: []string{"CLAUDE.md", ".autofix.md", "MISSING.md"},
+			}
+
+			got, err := repoInstructions(repo, req, read, tt.skip)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("repoInstructions() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
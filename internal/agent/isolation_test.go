@@ -0,0 +1,93 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/config"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/tools"
+)
+
+// checkIsolation is the test command of each fake repository. It fails if
+// another job's checkout, fix or temporary files show up in this one's, or if
+// the checkout's config holds credentials.
+const checkIsolation = `set -e
+name=$(cat name)
+[ "$(cat fixed)" = "$name" ] || { echo "fix of another job: $(cat fixed)"; exit 1; }
+[ -z "$(ls -A "$TMPDIR")" ] || { echo "shared TMPDIR: $(ls -A "$TMPDIR")"; exit 1; }
+echo "$name" > "$TMPDIR/owner"
+sleep 0.2
+[ "$(cat "$TMPDIR/owner")" = "$name" ] || { echo "TMPDIR written by $(cat "$TMPDIR/owner")"; exit 1; }
+! grep -q token .git/config || { echo "credentials in the checkout"; exit 1; }
+`
+
+func TestPipeline_ParallelJobsIsolated(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	const jobs = 4
+	root := t.TempDir()
+	workDirs, err := tools.NewWorkDirs(root, 0, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Pipeline{workspaces: tools.NewWorkspaces("", workDirs), testTimeout: 10 * time.Second}
+
+	// Distinct repositories, each checking that it runs alone
+	urls := make([]string, jobs)
+	for i := range urls {
+		upstream := t.TempDir()
+		os.WriteFile(filepath.Join(upstream, "name"), []byte(fmt.Sprintf("repo%d\n", i)), 0o644)
+		os.WriteFile(filepath.Join(upstream, "check.sh"), []byte(checkIsolation), 0o644)
+		for _, args := range [][]string{
+			{"init", "--quiet", "--initial-branch", "main"},
+			{"add", "."},
+			{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "--quiet", "-m", "init"},
+		} {
+			cmd := exec.Command("git", args...)
+			cmd.Dir = upstream
+			if out, err := cmd.CombinedOutput(); err != nil {
+				t.Fatalf("git %v: %v\n%s", args, err, out)
+			}
+		}
+		urls[i] = "file://" + upstream
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, jobs)
+	for i := range urls {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			dir, release, err := p.workspaces.Checkout(context.Background(), urls[i], fmt.Sprintf("token%d", i), "", tools.CloneOptions{Depth: 1})
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			defer release()
+			repo := &config.RepoMapping{Owner: "org", Repo: fmt.Sprintf("repo%d", i), TestCommand: "sh check.sh"}
+			fix := &ProposedFix{Files: []FileChange{{Path: "fixed", Content: fmt.Sprintf("repo%d\n", i), ChangeType: "create"}}}
+			errs[i] = p.checkFix(context.Background(), dir, repo, fix)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("job %d: %v", i, err)
+			if failed, ok := err.(*CheckFailedError); ok {
+				t.Log(failed.Output)
+			}
+		}
+	}
+	if entries, _ := os.ReadDir(root); len(entries) != 0 {
+		t.Errorf("workspaces left behind: %v", entries)
+	}
+}
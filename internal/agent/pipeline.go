@@ -2,26 +2,139 @@ package agent
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/config"
 	"github.com/Mariscal6/sentry-claude-auto-pr/internal/gitprovider"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/learning"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/sentry"
 	"github.com/Mariscal6/sentry-claude-auto-pr/internal/tools"
 	"github.com/Mariscal6/sentry-claude-auto-pr/internal/webhook"
 )
 
-// Pipeline orchestrates the error analysis and fix generation using Claude Code.
+// AutoFixLabel marks pull requests opened by SentryAgent.
+const AutoFixLabel = "auto-fix"
+
+// Pipeline orchestrates the error analysis and fix generation, handing the
+// fix itself to the configured FixGenerator.
 type Pipeline struct {
-	anthropicAPIKey string
+	generator        FixGenerator
+	learning         *learning.Store
+	sourceLines      int
+	releaseArtifacts func(repo *config.RepoMapping) (*sentry.Client, string)
+	workspaces       *tools.Workspaces
+	cloneDepth       int
+	testTimeout      time.Duration
+	regressionTests  bool
+	review           ReviewOptions
+	repairAttempts   int
+	diffFormat       bool
+	historyCommits   int
+	hooks            *stageHooks
+	checks           tools.CommandOptions
 }
 
-// NewPipeline creates a new agent pipeline.
-func NewPipeline(anthropicAPIKey string) *Pipeline {
-	return &Pipeline{
-		anthropicAPIKey: anthropicAPIKey,
+// PipelineOptions configures how fixes are generated.
+type PipelineOptions struct {
+	// Backend names a registered FixGenerator: BackendClaudeCode (the
+	// default), BackendAnthropicAPI, BackendVertex or one added with
+	// RegisterGenerator.
+	Backend         string
+	AnthropicAPIKey string
+	// Model and BaseURL configure the API backends; empty values use their
+	// defaults. BaseURL is ignored by BackendVertex.
+	Model   string
+	BaseURL string
+	// Vertex configures BackendVertex.
+	Vertex *tools.VertexOptions
+	// ClaudeCode tunes BackendClaudeCode's CLI invocation. Its APIKey and
+	// Limits are taken from AnthropicAPIKey and ProcessLimits. Its Sandbox,
+	// if set, also runs the formatters, builds and tests checking fixes,
+	// whatever the backend.
+	ClaudeCode tools.ClaudeCodeOptions
+	// WorkspaceCacheDir keeps BackendClaudeCode's clones between jobs; empty
+	// clones every repository afresh, into workspaces from WorkDirs if set
+	// and temporary directories otherwise.
+	WorkspaceCacheDir string
+	WorkDirs          *tools.WorkDirs
+	// CloneDepth is the commits of history BackendClaudeCode fetches; 0
+	// fetches all of it.
+	CloneDepth int
+	// SourceContextLines is how many lines around each in-app frame are
+	// fetched into the prompt; 0 leaves the code for the model to find.
+	SourceContextLines int
+	// ReleaseArtifacts returns the Sentry client and organization whose
+	// release artifacts may hold the sourcemaps of a repository's minified
+	// frames. Sourcemaps are otherwise looked for in the repository.
+	ReleaseArtifacts func(repo *config.RepoMapping) (client *sentry.Client, org string)
+	// TestTimeout bounds each build and test run checking a fix; zero
+	// leaves only the job's deadline.
+	TestTimeout time.Duration
+	// CheckEnv names variables of the service's environment passed to the
+	// formatters, builds and tests checking fixes; see tools.CommandOptions.
+	CheckEnv []string
+	// RegressionTests asks Claude for a test reproducing each error, which
+	// must fail without the fix and pass with it when run with the
+	// repository's RegressionTestCommand.
+	RegressionTests bool
+	// Review configures the review of fixes by a second Claude session.
+	Review ReviewOptions
+	// RepairAttempts is how often a fix that fails to build or pass the
+	// tests is regenerated with the failure's output before giving up.
+	RepairAttempts int
+	// DiffFormat asks for modified files as unified diffs, which are applied
+	// to the repository's files, instead of their full content.
+	DiffFormat bool
+	// CulpritHistory is how many of the latest commits touching the
+	// file the error was raised in go into the prompt; 0 leaves them out.
+	CulpritHistory int
+	// MaxSessions caps concurrent Claude sessions; 0 means no cap.
+	MaxSessions int
+	// ProcessLimits bounds the resources of the Claude Code CLI and of the
+	// formatters, builds and tests checking fixes.
+	ProcessLimits tools.ProcessLimits
+}
+
+// maxRepoDocBytes caps how much of a repo's style guide or instruction
+// file goes into the system prompt.
+const maxRepoDocBytes = 32 * 1024
+
+// maxFeedbackThemes limits how much past reviewer feedback goes into a prompt.
+const maxFeedbackThemes = 5
+
+// maxPastRejections limits how many rejected earlier fixes go into a prompt.
+const maxPastRejections = 3
+
+// NewPipeline creates a new agent pipeline using opts.Backend to generate
+// fixes.
+func NewPipeline(learningStore *learning.Store, opts PipelineOptions) (*Pipeline, error) {
+	generator, err := newGenerator(opts)
+	if err != nil {
+		return nil, err
 	}
+	return &Pipeline{
+		generator:        generator,
+		learning:         learningStore,
+		sourceLines:      opts.SourceContextLines,
+		releaseArtifacts: opts.ReleaseArtifacts,
+		workspaces:       tools.NewWorkspaces(opts.WorkspaceCacheDir, opts.WorkDirs),
+		cloneDepth:       opts.CloneDepth,
+		testTimeout:      opts.TestTimeout,
+		regressionTests:  opts.RegressionTests,
+		review:           opts.Review,
+		repairAttempts:   opts.RepairAttempts,
+		diffFormat:       opts.DiffFormat,
+		historyCommits:   opts.CulpritHistory,
+		hooks:            registeredHooks(),
+		checks:           tools.CommandOptions{Limits: opts.ProcessLimits, Sandbox: opts.ClaudeCode.Sandbox, Env: opts.CheckEnv},
+	}, nil
 }
 
 // ProposedFix represents the output from the fix generation.
@@ -30,6 +143,60 @@ type ProposedFix struct {
 	Description string       `json:"description"`
 	PRTitle     string       `json:"pr_title"`
 	PRBody      string       `json:"pr_body"`
+	// Report, if Claude gave one, is written into pull request
+	// descriptions instead of PRBody.
+	Report *FixReport `json:"report,omitempty"`
+	// CostUSD is what generating the fix cost, or 0 if unknown.
+	CostUSD      float64 `json:"cost_usd,omitempty"`
+	InputTokens  int     `json:"input_tokens,omitempty"`
+	OutputTokens int     `json:"output_tokens,omitempty"`
+
+	// TestFilter selects the regression test added with the fix, whose
+	// files are marked Test, in the repository's RegressionTestCommand.
+	TestFilter string `json:"test_filter,omitempty"`
+	// Confidence is Claude's estimate, from 0 to 1, that the fix is correct.
+	Confidence float64 `json:"confidence,omitempty"`
+	// Oversized explains how the fix exceeds the repository's size limits.
+	// Such fixes are posted as analysis instead of proposed.
+	Oversized string `json:"oversized,omitempty"`
+	// AnalysisOnly is set for fixes in repositories that only get
+	// analyses, which are posted with SuggestedDiff, the fix as a unified
+	// diff, instead of proposed. Dry runs log SuggestedDiff.
+	AnalysisOnly  bool   `json:"analysis_only,omitempty"`
+	SuggestedDiff string `json:"suggested_diff,omitempty"`
+}
+
+// Usage is what generating the fix used.
+func (f *ProposedFix) Usage() Usage {
+	return Usage{CostUSD: f.CostUSD, InputTokens: f.InputTokens, OutputTokens: f.OutputTokens}
+}
+
+// addUsage counts u towards what generating the fix used.
+func (f *ProposedFix) addUsage(u Usage) {
+	f.CostUSD += u.CostUSD
+	f.InputTokens += u.InputTokens
+	f.OutputTokens += u.OutputTokens
+}
+
+// hasTest reports whether the fix adds a regression test.
+func (f *ProposedFix) hasTest() bool {
+	for _, file := range f.Files {
+		if file.Test {
+			return true
+		}
+	}
+	return false
+}
+
+// FixFailedError reports that Claude ran but could not produce a fix.
+type FixFailedError struct {
+	Reason string
+	// Usage is what the attempt used.
+	Usage Usage
+}
+
+func (e *FixFailedError) Error() string {
+	return "Claude could not generate fix: " + e.Reason
 }
 
 // FileChange represents a file modification.
@@ -37,26 +204,61 @@ type FileChange struct {
 	Path       string `json:"path"`
 	Content    string `json:"content"`
 	ChangeType string `json:"change_type"`
+	Test       bool   `json:"test,omitempty"`
 }
 
-// Run executes the pipeline for an error using Claude Code.
-func (p *Pipeline) Run(ctx context.Context, repoURL, token string, parsedError *webhook.ParsedError) (*ProposedFix, error) {
+// Run executes the pipeline for an error against the repository's base
+// branch.
+func (p *Pipeline) Run(ctx context.Context, repo *config.RepoMapping, token string, parsedError *webhook.ParsedError) (*ProposedFix, error) {
+	return p.RunOnBranch(ctx, repo, repo.BaseBranch, token, parsedError)
+}
+
+// RunOnBranch executes the pipeline against a specific branch instead of the
+// repository's default branch, running the registered hooks around each
+// stage up to PipelineValidate.
+func (p *Pipeline) RunOnBranch(ctx context.Context, repo *config.RepoMapping, branch, token string, parsedError *webhook.ParsedError) (*ProposedFix, error) {
 	log.Printf("Starting fix generation for issue %s", parsedError.IssueID)
+	provider := gitprovider.NewGitHubProvider(token, repo.Owner, repo.Repo)
+	run := &StageRun{Repo: repo, Branch: branch, ParsedError: parsedError}
 
-	// Clone the repository
-	log.Printf("Cloning repository: %s", repoURL)
-	repoDir, cleanup, err := tools.CloneRepo(ctx, repoURL, token)
-	if err != nil {
-		return nil, fmt.Errorf("failed to clone repo: %w", err)
+	stages := []struct {
+		stage PipelineStage
+		fn    func(ctx context.Context) error
+	}{
+		{PipelineIngest, func(ctx context.Context) error {
+			run.Request = p.ingest(repo, run.ParsedError)
+			return nil
+		}},
+		{PipelineLocate, func(ctx context.Context) error {
+			p.locate(ctx, repo, branch, provider, run.ParsedError, run.Request)
+			return nil
+		}},
+		{PipelineGenerate, func(ctx context.Context) (err error) {
+			run.Fix, err = p.generate(ctx, repo, branch, token, provider, run.Request)
+			return err
+		}},
+		{PipelineValidate, func(ctx context.Context) (err error) {
+			run.Fix, err = p.validate(ctx, repo, branch, token, provider, run.Request, run.Fix)
+			return err
+		}},
 	}
-	defer cleanup()
-
-	log.Printf("Repository cloned to: %s", repoDir)
+	for _, s := range stages {
+		if err := p.hooks.run(ctx, s.stage, run, s.fn); err != nil {
+			return nil, err
+		}
+	}
+	return run.Fix, nil
+}
 
-	// Create Claude Code tool
-	claudeCode := tools.NewClaudeCodeTool(repoDir, p.anthropicAPIKey)
+// Publish runs publish, which proposes or posts fix, between the
+// PipelinePublish hooks. The hooks see no Request.
+func (p *Pipeline) Publish(ctx context.Context, repo *config.RepoMapping, branch string, parsedError *webhook.ParsedError, fix *ProposedFix, publish func(ctx context.Context) error) error {
+	run := &StageRun{Repo: repo, Branch: branch, ParsedError: parsedError, Fix: fix}
+	return p.hooks.run(ctx, PipelinePublish, run, publish)
+}
 
-	// Build the fix request from parsed error
+// ingest builds the fix request for parsedError.
+func (p *Pipeline) ingest(repo *config.RepoMapping, parsedError *webhook.ParsedError) *tools.FixRequest {
 	req := &tools.FixRequest{
 		IssueID:      parsedError.IssueID,
 		Title:        parsedError.Title,
@@ -65,29 +267,179 @@ func (p *Pipeline) Run(ctx context.Context, repoURL, token string, parsedError *
 		Level:        parsedError.Level,
 		Platform:     parsedError.Platform,
 		Culprit:      parsedError.Culprit,
+		Release:      parsedError.Release,
+		Environment:  parsedError.Environment,
+		ServerName:   parsedError.ServerName,
 		Permalink:    parsedError.Permalink,
 		Stacktrace:   convertFrames(parsedError.Frames),
+		Request:      convertRequest(parsedError.Request),
+		Contexts:     parsedError.Contexts,
+		Breadcrumbs:  convertBreadcrumbs(parsedError.Breadcrumbs),
+		Minified:     parsedError.Minified,
+
+		RegressionTest:        p.regressionTests,
+		RegressionTestCommand: repo.RegressionTestCommand,
+		AllowedPaths:          repo.AllowedPaths,
+		DeniedPaths:           repo.DeniedPaths,
+		DiffFormat:            p.diffFormat,
+	}
+
+	// Include recurring reviewer feedback from previous fixes in this repo
+	if p.learning != nil {
+		for _, theme := range p.learning.Themes(repo.FullName(), parsedError.ErrorType, maxFeedbackThemes) {
+			req.ReviewerFeedback = append(req.ReviewerFeedback, tools.FeedbackTheme{
+				Text:  theme.Text,
+				Count: theme.Count,
+			})
+		}
+
+		// Say why earlier fixes for the same class were turned down
+		outcomes := p.learning.Outcomes(repo.FullName(), parsedError.ErrorType, maxPastRejections)
+		if outcomes.Rejected > 0 {
+			req.PastOutcomes = &tools.PastOutcomes{Merged: outcomes.Merged, Rejected: outcomes.Rejected}
+			for _, o := range outcomes.Rejections {
+				req.PastOutcomes.Rejections = append(req.PastOutcomes.Rejections, tools.RejectedFix{
+					Title:    o.Title,
+					Reverted: o.Outcome == learning.OutcomeReverted,
+					Reason:   o.Reason,
+				})
+			}
+		}
+	}
+	return req
+}
+
+// locate adds the repository code parsedError points at to req.
+func (p *Pipeline) locate(ctx context.Context, repo *config.RepoMapping, branch string, provider gitprovider.Provider, parsedError *webhook.ParsedError, req *tools.FixRequest) {
+	// Point minified frames at the original source
+	if parsedError.Minified {
+		frames := resolveSourceMaps(ctx, parsedError.Frames, p.sourceMapFetchers(repo, provider, branch, parsedError))
+		req.Stacktrace = convertFrames(frames)
+		req.Minified = hasMinifiedFrames(frames)
+	}
+	if req.Minified {
+		log.Printf("Stacktrace for issue %s points at minified JavaScript", parsedError.IssueID)
+	}
+
+	// Start the model off with the failing code
+	if p.sourceLines > 0 {
+		req.SourceFiles = gatherSource(ctx, provider, branch, req.Stacktrace, p.sourceLines)
+	}
+
+	// Show what changed in the culprit file lately, in case it's a regression
+	if p.historyCommits > 0 {
+		req.CulpritHistory = gatherHistory(ctx, provider, branch, req.Stacktrace, req.SourceFiles, p.historyCommits)
+	}
+}
+
+// validate reviews, checks and repairs fix, then refuses it if it contains
+// secrets.
+func (p *Pipeline) validate(ctx context.Context, repo *config.RepoMapping, branch, token string, provider gitprovider.Provider, req *tools.FixRequest, fix *ProposedFix) (*ProposedFix, error) {
+	fix, err := p.refineFix(ctx, repo, branch, token, provider, req, fix, p.verifyFix)
+	if err != nil {
+		return nil, err
+	}
+
+	// Never propose credentials, whether Claude made them up or copied them
+	if err := scanSecrets(ctx, provider, branch, req, fix); err != nil {
+		return nil, err
+	}
+
+	if repo.AnalysisOnly || repo.DryRun {
+		fix.AnalysisOnly = repo.AnalysisOnly
+		fix.SuggestedDiff = fixDiff(ctx, provider, branch, fix)
+	}
+	return fix, nil
+}
+
+// verifyFunc checks a fix, returning a *CheckFailedError if it fails.
+type verifyFunc func(ctx context.Context, repo *config.RepoMapping, branch, token string, fix *ProposedFix) error
+
+// refineFix reviews fix and checks it with verify, regenerating it with the
+// failure's output up to p.repairAttempts times if a check fails. A fix
+// exceeding the repository's size limits is returned marked Oversized
+// without further checks.
+func (p *Pipeline) refineFix(ctx context.Context, repo *config.RepoMapping, branch, token string, provider gitprovider.Provider, req *tools.FixRequest, fix *ProposedFix, verify verifyFunc) (*ProposedFix, error) {
+	for repair := 0; ; repair++ {
+		var err error
+
+		// Don't spend reviews and checks on sweeping changes
+		if checkSize(ctx, repo, branch, provider, fix) {
+			return fix, nil
+		}
+
+		// Have a second Claude session review the fix, revising it on request
+		if p.review.Enabled {
+			if fix, err = p.reviewFix(ctx, repo, branch, token, provider, req, fix); err != nil {
+				return nil, err
+			}
+			if checkSize(ctx, repo, branch, provider, fix) {
+				return fix, nil
+			}
+		}
+
+		// Format the fix and refuse it if it breaks the build or tests
+		if repo.FormatCommand == "" && repo.BuildCommand == "" && repo.TestCommand == "" && (repo.RegressionTestCommand == "" || !fix.hasTest() || repo.SkipRegressionTests) {
+			return fix, nil
+		}
+		err = verify(ctx, repo, branch, token, fix)
+		if err == nil {
+			return fix, nil
+		}
+		var failed *CheckFailedError
+		if !errors.As(err, &failed) || repair >= p.repairAttempts {
+			return nil, err
+		}
+
+		// Let Claude repair the fix from the failure
+		log.Printf("Fix failed %s, asking Claude to repair it (%d/%d)", failed.Check, repair+1, p.repairAttempts)
+		req.Revision = nil
+		req.FailedAttempt = &tools.FailedAttempt{
+			Diff:   fixDiff(ctx, provider, branch, fix),
+			Error:  failed.Error(),
+			Output: failed.Output,
+		}
+		if fix, err = p.regenerate(ctx, repo, branch, token, provider, req, fix.Usage()); err != nil {
+			return nil, err
+		}
 	}
+}
 
-	// Run Claude Code to generate the fix
-	log.Printf("Running Claude Code to analyze and fix the error...")
-	resp, err := claudeCode.GenerateFix(ctx, req)
+// generate asks the generator for a fix to req, applying the diffs it gives
+// to the files in provider at branch. A fix changing files repo does not
+// allow, or whose diffs don't apply, fails with a *FixFailedError.
+func (p *Pipeline) generate(ctx context.Context, repo *config.RepoMapping, branch, token string, provider gitprovider.Provider, req *tools.FixRequest) (*ProposedFix, error) {
+	resp, err := p.generator.GenerateFix(ctx, repo, branch, token, req)
 	if err != nil {
-		return nil, fmt.Errorf("Claude Code error: %w", err)
+		return nil, err
 	}
 
+	usage := Usage{CostUSD: resp.CostUSD, InputTokens: resp.InputTokens, OutputTokens: resp.OutputTokens}
 	if !resp.Success {
-		return nil, fmt.Errorf("Claude Code could not generate fix: %s", resp.Error)
+		return nil, &FixFailedError{Reason: resp.Error, Usage: usage}
+	}
+	if err := applyDiffs(ctx, provider, branch, resp.Files); err != nil {
+		var failed *FixFailedError
+		if errors.As(err, &failed) {
+			failed.Usage = usage
+		}
+		return nil, err
 	}
 
-	log.Printf("Claude Code generated fix with %d file changes", len(resp.Files))
+	log.Printf("Claude generated fix with %d file changes (confidence %.2f)", len(resp.Files), resp.Confidence)
 
 	// Convert response to ProposedFix
 	fix := &ProposedFix{
-		Description: resp.Description,
-		PRTitle:     resp.PRTitle,
-		PRBody:      resp.PRBody,
-		Files:       make([]FileChange, len(resp.Files)),
+		Description:  resp.Description,
+		PRTitle:      resp.PRTitle,
+		PRBody:       resp.PRBody,
+		Report:       newFixReport(resp),
+		CostUSD:      resp.CostUSD,
+		InputTokens:  resp.InputTokens,
+		OutputTokens: resp.OutputTokens,
+		Files:        make([]FileChange, len(resp.Files)),
+		TestFilter:   resp.TestFilter,
+		Confidence:   resp.Confidence,
 	}
 
 	for i, f := range resp.Files {
@@ -95,12 +447,83 @@ func (p *Pipeline) Run(ctx context.Context, repoURL, token string, parsedError *
 			Path:       f.Path,
 			Content:    f.Content,
 			ChangeType: f.ChangeType,
+			Test:       f.Test,
+		}
+	}
+	if p.regressionTests && !fix.hasTest() {
+		log.Printf("Claude did not add a regression test for issue %s", req.IssueID)
+	}
+
+	// Refuse fixes reaching into files the repository keeps off limits
+	var restricted []string
+	for _, f := range fix.Files {
+		if !repo.MayChange(f.Path) {
+			restricted = append(restricted, f.Path)
+		}
+	}
+	if len(restricted) > 0 {
+		return nil, &FixFailedError{
+			Reason: "fix changes restricted paths: " + strings.Join(restricted, ", "),
+			Usage:  fix.Usage(),
 		}
 	}
+	return fix, nil
+}
 
+// regenerate asks the generator for a new fix to req, counting used, what
+// earlier attempts used, towards it.
+func (p *Pipeline) regenerate(ctx context.Context, repo *config.RepoMapping, branch, token string, provider gitprovider.Provider, req *tools.FixRequest, used Usage) (*ProposedFix, error) {
+	fix, err := p.generate(ctx, repo, branch, token, provider, req)
+	var failed *FixFailedError
+	if errors.As(err, &failed) {
+		failed.Usage = failed.Usage.Add(used)
+	}
+	if err != nil {
+		return nil, err
+	}
+	fix.addUsage(used)
 	return fix, nil
 }
 
+// fetchRepoDoc reads a repo-relative document such as the style guide
+// through the provider, returning an empty string if the repository doesn't
+// have it.
+func fetchRepoDoc(ctx context.Context, provider gitprovider.Provider, ref, relPath string) (string, error) {
+	file, err := provider.FetchFile(ctx, strings.TrimPrefix(filepath.Clean("/"+relPath), "/"), ref)
+	if err != nil {
+		// The provider doesn't distinguish a missing file from other failures
+		log.Printf("Failed to fetch %s, continuing without it: %v", relPath, err)
+		return "", nil
+	}
+	data := file.Content
+	if len(data) > maxRepoDocBytes {
+		log.Printf("%s exceeds %d bytes, truncating", relPath, maxRepoDocBytes)
+		data = data[:maxRepoDocBytes]
+	}
+	return strings.TrimSpace(data), nil
+}
+
+// loadRepoDoc reads a repo-relative document such as the style guide from
+// a clone, returning an empty string if the repository doesn't have it.
+func loadRepoDoc(repoDir, relPath string) (string, error) {
+	// Clean as an absolute path first so the path can't point outside the repo
+	path := filepath.Join(repoDir, filepath.Clean("/"+relPath))
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", relPath, err)
+	}
+
+	if len(data) > maxRepoDocBytes {
+		log.Printf("%s exceeds %d bytes, truncating", relPath, maxRepoDocBytes)
+		data = data[:maxRepoDocBytes]
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
 // convertFrames converts webhook frames to tool frames.
 func convertFrames(webhookFrames []webhook.Frame) []tools.Frame {
 	frames := make([]tools.Frame, len(webhookFrames))
@@ -112,27 +535,153 @@ func convertFrames(webhookFrames []webhook.Frame) []tools.Frame {
 			ColNo:    f.ColNo,
 			InApp:    f.InApp,
 			Module:   f.Module,
+			Package:  f.Package,
+			Vars:     f.Vars,
+			Minified: f.IsMinified(),
+		}
+		for _, line := range f.ContextLines() {
+			frames[i].Context = append(frames[i].Context, tools.SourceLine{LineNo: line.LineNo, Code: line.Code})
 		}
 	}
 	return frames
 }
 
-// CreatePullRequest creates a GitHub PR with the proposed fix.
-func CreatePullRequest(ctx context.Context, provider gitprovider.Provider, parsedError *webhook.ParsedError, fix *ProposedFix) (string, error) {
-	// Get default branch
-	defaultBranch, err := provider.GetDefaultBranch(ctx)
+func convertRequest(r *webhook.RequestData) *tools.HTTPRequest {
+	if r == nil {
+		return nil
+	}
+
+	req := &tools.HTTPRequest{Method: r.Method, URL: r.URL}
+	for _, q := range r.Query {
+		req.Query = append(req.Query, tools.Param{Name: q.Key, Value: q.Value})
+	}
+	for _, h := range r.Headers {
+		req.Headers = append(req.Headers, tools.Param{Name: h.Key, Value: h.Value})
+	}
+	return req
+}
+
+func convertBreadcrumbs(crumbs []webhook.Breadcrumb) []tools.Breadcrumb {
+	var converted []tools.Breadcrumb
+	for _, c := range crumbs {
+		crumb := tools.Breadcrumb{
+			Category: c.Category,
+			Level:    c.Level,
+			Message:  c.Message,
+			Data:     c.Data,
+		}
+		if !c.Timestamp.IsZero() {
+			crumb.Time = c.Timestamp.UTC().Format("15:04:05.000")
+		}
+		converted = append(converted, crumb)
+	}
+	return converted
+}
+
+// OpenedPullRequest is a fix PR created by OpenPullRequest.
+type OpenedPullRequest struct {
+	Number int
+	URL    string
+	Branch string
+}
+
+// FixBranch is a branch a fix has been committed to.
+type FixBranch struct {
+	Name string `json:"name"`
+	Base string `json:"base"`
+}
+
+// PushFixBranch commits the proposed fix to a new branch, named with the
+// repository's branch prefix, off its base branch.
+func PushFixBranch(ctx context.Context, provider gitprovider.Provider, repo *config.RepoMapping, parsedError *webhook.ParsedError, fix *ProposedFix) (*FixBranch, error) {
+	prefix := repo.BranchPrefix
+	if prefix == "" {
+		prefix = config.DefaultBranchPrefix
+	}
+	branchName := fmt.Sprintf("%s%s-%d", prefix, sanitizeBranchName(parsedError.ErrorType), unixTimestamp())
+	base, err := pushFixBranch(ctx, provider, repo.BaseBranch, branchName, parsedError, fix)
+	if err != nil {
+		return nil, err
+	}
+	return &FixBranch{Name: branchName, Base: base}, nil
+}
+
+// OpenPullRequest creates a GitHub PR for a fix pushed with PushFixBranch,
+// with the repository's labels, assignees and reviewers.
+func OpenPullRequest(ctx context.Context, provider gitprovider.Provider, repo *config.RepoMapping, parsedError *webhook.ParsedError, fix *ProposedFix, branch *FixBranch) (*OpenedPullRequest, error) {
+	prBody := prDescription(fix, parsedError)
+	prBody += fmt.Sprintf("\n\n---\n🔗 Sentry Issue: %s", parsedError.Permalink)
+	if release := releaseSummary(parsedError); release != "" {
+		prBody += "\n🏷️ Seen in: " + release
+	}
+	prBody += "\n🤖 Generated by SentryAgent using Claude Code"
+	prBody += "\n\n" + fmt.Sprintf(errorTypeMarker, parsedError.ErrorType)
+	prBody += "\n" + fmt.Sprintf(fingerprintMarker, parsedError.Fingerprint())
+
+	// The auto-fix label marks the PR as SentryAgent's and is always added
+	labels := []string{AutoFixLabel}
+	for _, l := range repo.Labels {
+		if !slices.Contains(labels, l) {
+			labels = append(labels, l)
+		}
+	}
+	prResp, err := provider.CreatePullRequest(ctx, gitprovider.PRRequest{
+		Title:     fix.PRTitle,
+		Body:      prBody,
+		Head:      branch.Name,
+		Base:      branch.Base,
+		Draft:     repo.DraftPRs,
+		Labels:    labels,
+		Assignees: repo.Assignees,
+	})
 	if err != nil {
-		return "", fmt.Errorf("failed to get default branch: %w", err)
+		return nil, fmt.Errorf("failed to create PR: %w", err)
+	}
+	if len(repo.Reviewers) > 0 {
+		if err := provider.RequestReviewers(ctx, prResp.Number, repo.Reviewers); err != nil {
+			// Non-fatal, the PR is open
+			log.Printf("warning: failed to request review on PR #%d: %v", prResp.Number, err)
+		}
+	}
+
+	return &OpenedPullRequest{Number: prResp.Number, URL: prResp.HTMLURL, Branch: branch.Name}, nil
+}
+
+// releaseSummary describes where the error occurred, e.g. "release 1.4.2
+// (production)". It returns "" when the event carried neither tag.
+func releaseSummary(parsedError *webhook.ParsedError) string {
+	var summary string
+	if parsedError.Release != "" {
+		summary = "release " + parsedError.Release
+	}
+	switch {
+	case parsedError.Environment == "":
+	case summary == "":
+		summary = parsedError.Environment
+	default:
+		summary += " (" + parsedError.Environment + ")"
+	}
+	return summary
+}
+
+// pushFixBranch creates branchName from base, or the default branch if base
+// is empty, and commits the fix to it. It returns the branch it was created
+// from.
+func pushFixBranch(ctx context.Context, provider gitprovider.Provider, base, branchName string, parsedError *webhook.ParsedError, fix *ProposedFix) (string, error) {
+	if base == "" {
+		var err error
+		if base, err = provider.GetDefaultBranch(ctx); err != nil {
+			return "", fmt.Errorf("failed to get default branch: %w", err)
+		}
 	}
 
 	// Get latest commit SHA
-	baseSHA, err := provider.GetLatestCommitSHA(ctx, defaultBranch)
+	baseSHA, err := provider.GetLatestCommitSHA(ctx, base)
 	if err != nil {
 		return "", fmt.Errorf("failed to get latest commit: %w", err)
 	}
 
 	// Create fix branch
-	branchName := fmt.Sprintf("sentry-fix/%s-%d", sanitizeBranchName(parsedError.ErrorType), unixTimestamp())
 	if err := provider.CreateBranch(ctx, branchName, baseSHA); err != nil {
 		return "", fmt.Errorf("failed to create branch: %w", err)
 	}
@@ -161,25 +710,7 @@ func CreatePullRequest(ctx context.Context, provider gitprovider.Provider, parse
 		return "", fmt.Errorf("failed to commit files: %w", err)
 	}
 
-	// Create pull request
-	prBody := fix.PRBody
-	if prBody == "" {
-		prBody = fmt.Sprintf("## Summary\n\n%s", fix.Description)
-	}
-	prBody += fmt.Sprintf("\n\n---\n🔗 Sentry Issue: %s\n🤖 Generated by SentryAgent using Claude Code", parsedError.Permalink)
-
-	prResp, err := provider.CreatePullRequest(ctx, gitprovider.PRRequest{
-		Title:  fix.PRTitle,
-		Body:   prBody,
-		Head:   branchName,
-		Base:   defaultBranch,
-		Labels: []string{"sentry", "auto-fix", "claude-code"},
-	})
-	if err != nil {
-		return "", fmt.Errorf("failed to create PR: %w", err)
-	}
-
-	return prResp.HTMLURL, nil
+	return base, nil
 }
 
 // sanitizeBranchName makes a string safe for use in branch names.
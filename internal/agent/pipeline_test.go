@@ -0,0 +1,197 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/config"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/tools"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/webhook"
+)
+
+func TestLoadRepoDoc(t *testing.T) {
+	repoDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(repoDir, ".autopr"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repoDir, ".autopr", "STYLE.md"), []byte("  Use tabs.\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repoDir, "BIG.md"), []byte(strings.Repeat("x", maxRepoDocBytes+10)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := loadRepoDoc(repoDir, ".autopr/STYLE.md")
+	if err != nil || got != "Use tabs." {
+		t.Errorf("loadRepoDoc() = %q, %v; want %q", got, err, "Use tabs.")
+	}
+
+	got, err = loadRepoDoc(repoDir, "MISSING.md")
+	if err != nil || got != "" {
+		t.Errorf("loadRepoDoc() for missing file = %q, %v; want empty", got, err)
+	}
+
+	got, _ = loadRepoDoc(repoDir, "BIG.md")
+	if len(got) != maxRepoDocBytes {
+		t.Errorf("loadRepoDoc() length = %d, want truncated to %d", len(got), maxRepoDocBytes)
+	}
+
+	got, _ = loadRepoDoc(repoDir, "../../etc/passwd")
+	if got != "" {
+		t.Error("loadRepoDoc() must not read outside the repository")
+	}
+}
+
+func TestReleaseSummary(t *testing.T) {
+	tests := []struct {
+		release, environment string
+		want                 string
+	}{
+		{"1.4.2", "production", "release 1.4.2 (production)"},
+		{"1.4.2", "", "release 1.4.2"},
+		{"", "staging", "staging"},
+		{"", "", ""},
+	}
+
+	for _, tt := range tests {
+		got := releaseSummary(&webhook.ParsedError{Release: tt.release, Environment: tt.environment})
+		if got != tt.want {
+			t.Errorf("releaseSummary(%q, %q) = %q, want %q", tt.release, tt.environment, got, tt.want)
+		}
+	}
+}
+
+func TestPushAndOpenPullRequest_RepoSettings(t *testing.T) {
+	repo := &config.RepoMapping{
+		Owner:        "org",
+		Repo:         "app",
+		BaseBranch:   "develop",
+		BranchPrefix: "bot/",
+		Labels:       []string{"sentry", "triage", AutoFixLabel},
+		Assignees:    []string{"alice"},
+		Reviewers:    []string{"bob"},
+		DraftPRs:     true,
+	}
+	provider := &fakeProvider{}
+	parsedError := &webhook.ParsedError{ErrorType: "KeyError"}
+	fix := &ProposedFix{PRTitle: "Fix KeyError", Files: []FileChange{{Path: "app.py", Content: "x", ChangeType: "modify"}}}
+
+	branch, err := PushFixBranch(context.Background(), provider, repo, parsedError, fix)
+	if err != nil {
+		t.Fatalf("PushFixBranch() error = %v", err)
+	}
+	if !strings.HasPrefix(branch.Name, "bot/keyerror-") || branch.Base != "develop" {
+		t.Errorf("PushFixBranch() = %+v, want a bot/ branch off develop", branch)
+	}
+
+	if _, err := OpenPullRequest(context.Background(), provider, repo, parsedError, fix, branch); err != nil {
+		t.Fatalf("OpenPullRequest() error = %v", err)
+	}
+	pr := provider.createdPRs[0]
+	if pr.Base != "develop" || !pr.Draft || strings.Join(pr.Labels, ",") != "auto-fix,sentry,triage" || strings.Join(pr.Assignees, ",") != "alice" {
+		t.Errorf("created PR = %+v", pr)
+	}
+	if got := provider.requested[1]; len(got) != 1 || got[0] != "bob" {
+		t.Errorf("requested reviewers = %v, want [bob]", got)
+	}
+}
+
+func TestPipeline_Generate_RestrictedPaths(t *testing.T) {
+	repo := &config.RepoMapping{
+		Owner:        "org",
+		Repo:         "app",
+		AllowedPaths: []string{"src/", "tests/**/test_*.py"},
+		DeniedPaths:  []string{"**/vendor/", "src/migrations/*.sql"},
+	}
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"src/app.py", true},
+		{"./src/lib/util.py", true},
+		{"tests/test_app.py", true},
+		{"tests/unit/test_app.py", true},
+		{"tests/unit/helpers.py", false},
+		{"README.md", false},
+		{"src/vendor/lib.py", false},
+		{"src/migrations/0001.sql", false},
+		{"src/migrations/README.md", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			gen := &fakeReviewer{fixes: []*tools.FixResponse{{
+				Success: true,
+				Files:   []tools.FileChange{{Path: tt.path, Content: "x\n", ChangeType: "modify"}},
+				CostUSD: 0.5,
+			}}}
+			p := &Pipeline{generator: gen}
+
+			_, err := p.generate(context.Background(), repo, "main", "token", &fakeProvider{}, &tools.FixRequest{IssueID: "1"})
+
+			if tt.want {
+				if err != nil {
+					t.Errorf("generate() error = %v, want the fix", err)
+				}
+				return
+			}
+			var failed *FixFailedError
+			if !errors.As(err, &failed) || !strings.Contains(err.Error(), tt.path) || failed.Usage.CostUSD != 0.5 {
+				t.Errorf("generate() error = %v, want the restricted path refused", err)
+			}
+		})
+	}
+}
+
+func TestPipeline_Generate_Diffs(t *testing.T) {
+	tests := []struct {
+		name    string
+		diff    string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "applies",
+			diff: "@@ -1,2 +1,3 @@\n def name(user):\n+    if user is None: return None\n     return user.name\n",
+			want: "def name(user):\n    if user is None: return None\n    return user.name\n",
+		},
+		{
+			name:    "does not apply",
+			diff:    "@@ -1,1 +1,1 @@\n-def nome(user):\n+def name(user=None):\n",
+			wantErr: "diff for app.py does not apply",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gen := &fakeReviewer{fixes: []*tools.FixResponse{{
+				Success: true,
+				Files:   []tools.FileChange{{Path: "app.py", Diff: tt.diff, ChangeType: "modify"}},
+				CostUSD: 0.5,
+			}}}
+			p := &Pipeline{generator: gen, diffFormat: true}
+			provider := &fakeProvider{files: map[string]string{"app.py": "def name(user):\n    return user.name\n"}}
+
+			fix, err := p.generate(context.Background(), &config.RepoMapping{Owner: "org", Repo: "app"}, "main", "token", provider, &tools.FixRequest{IssueID: "1"})
+
+			if tt.wantErr != "" {
+				var failed *FixFailedError
+				if !errors.As(err, &failed) || !strings.Contains(err.Error(), tt.wantErr) || failed.Usage.CostUSD != 0.5 {
+					t.Fatalf("generate() error = %v, want %q with the fix's usage", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("generate() error = %v", err)
+			}
+			if fix.Files[0].Content != tt.want {
+				t.Errorf("content = %q, want %q", fix.Files[0].Content, tt.want)
+			}
+		})
+	}
+}
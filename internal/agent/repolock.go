@@ -0,0 +1,37 @@
+package agent
+
+import (
+	"context"
+	"sync"
+)
+
+// RepoLocks allows at most one job at a time per repository, so concurrent
+// workers never race to create branches and commits in the same repository.
+type RepoLocks struct {
+	mu    sync.Mutex
+	locks map[string]chan struct{}
+}
+
+// NewRepoLocks creates an empty set of repository locks.
+func NewRepoLocks() *RepoLocks {
+	return &RepoLocks{locks: make(map[string]chan struct{})}
+}
+
+// Lock waits until no other job holds repo, or until ctx is done. The
+// returned function releases the lock.
+func (l *RepoLocks) Lock(ctx context.Context, repo string) (unlock func(), err error) {
+	l.mu.Lock()
+	sem, ok := l.locks[repo]
+	if !ok {
+		sem = make(chan struct{}, 1)
+		l.locks[repo] = sem
+	}
+	l.mu.Unlock()
+
+	select {
+	case sem <- struct{}{}:
+		return func() { <-sem }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
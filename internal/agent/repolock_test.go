@@ -0,0 +1,48 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRepoLocks(t *testing.T) {
+	locks := NewRepoLocks()
+	ctx := context.Background()
+
+	unlock, err := locks.Lock(ctx, "acme/api")
+	if err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+
+	// Other repositories are not blocked
+	unlockOther, err := locks.Lock(ctx, "acme/web")
+	if err != nil {
+		t.Fatalf("Lock() other repo error = %v", err)
+	}
+	unlockOther()
+
+	// A second job for the same repository waits
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := locks.Lock(timeout, "acme/api"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Lock() held repo error = %v, want DeadlineExceeded", err)
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		unlock, err := locks.Lock(ctx, "acme/api")
+		if err == nil {
+			unlock()
+		}
+		close(acquired)
+	}()
+	unlock()
+
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("Lock() not acquired after unlock")
+	}
+}
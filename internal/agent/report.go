@@ -0,0 +1,128 @@
+package agent
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/tools"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/webhook"
+)
+
+// Risk levels of a fix.
+const (
+	RiskLow    = "low"
+	RiskMedium = "medium"
+	RiskHigh   = "high"
+)
+
+// FixReport is Claude's structured account of a fix, from which pull
+// request descriptions are written so every auto-fix reads the same way.
+type FixReport struct {
+	RootCause   string `json:"root_cause"`
+	Explanation string `json:"explanation"`
+	// RiskLevel is RiskLow, RiskMedium, RiskHigh or "" if Claude gave
+	// none.
+	RiskLevel  string `json:"risk_level,omitempty"`
+	RiskReason string `json:"risk_reason,omitempty"`
+	Affected   string `json:"affected,omitempty"`
+	Testing    string `json:"testing,omitempty"`
+}
+
+// newFixReport returns the report in resp, or nil if it explains neither
+// the root cause nor the fix.
+func newFixReport(resp *tools.FixResponse) *FixReport {
+	if strings.TrimSpace(resp.RootCause) == "" && strings.TrimSpace(resp.FixExplanation) == "" {
+		return nil
+	}
+	report := &FixReport{
+		RootCause:   strings.TrimSpace(resp.RootCause),
+		Explanation: strings.TrimSpace(resp.FixExplanation),
+		RiskReason:  strings.TrimSpace(resp.RiskReason),
+		Affected:    strings.TrimSpace(resp.Affected),
+		Testing:     strings.TrimSpace(resp.TestingNotes),
+	}
+	switch level := strings.ToLower(strings.TrimSpace(resp.RiskLevel)); level {
+	case RiskLow, RiskMedium, RiskHigh:
+		report.RiskLevel = level
+	case "":
+	default:
+		log.Printf("Ignoring unknown risk level %q", resp.RiskLevel)
+	}
+	return report
+}
+
+// Markdown writes the report as the sections of a pull request description.
+// parsedError, if not nil, adds the endpoint and the number of events and
+// users Sentry saw to the impact.
+func (r *FixReport) Markdown(parsedError *webhook.ParsedError) string {
+	var sections []string
+	section := func(title, text string) {
+		if text != "" {
+			sections = append(sections, fmt.Sprintf("## %s\n\n%s", title, text))
+		}
+	}
+
+	section("Root Cause", r.RootCause)
+	section("Fix", r.Explanation)
+
+	switch {
+	case r.RiskLevel != "":
+		sections = append(sections, strings.TrimSpace(fmt.Sprintf("## Risk: %s\n\n%s", strings.ToUpper(r.RiskLevel[:1])+r.RiskLevel[1:], r.RiskReason)))
+	case r.RiskReason != "":
+		section("Risk", r.RiskReason)
+	}
+
+	impact := r.Affected
+	if facts := impactFacts(parsedError); facts != "" {
+		impact = strings.TrimSpace(impact + "\n\n" + facts)
+	}
+	section("Impact", impact)
+
+	section("Testing", r.Testing)
+	return strings.Join(sections, "\n\n")
+}
+
+// impactFacts lists what Sentry recorded about an error's reach: the
+// endpoint it was raised in and how often it happened to how many users.
+func impactFacts(parsedError *webhook.ParsedError) string {
+	if parsedError == nil {
+		return ""
+	}
+	var facts []string
+	if r := parsedError.Request; r != nil && r.URL != "" {
+		endpoint := r.URL
+		if u, err := url.Parse(r.URL); err == nil && u.Path != "" {
+			endpoint = u.Path
+		}
+		facts = append(facts, fmt.Sprintf("- **Endpoint**: `%s`", strings.TrimSpace(r.Method+" "+endpoint)))
+	}
+	if parsedError.EventCount > 0 {
+		seen := fmt.Sprintf("- **Seen**: %d time%s", parsedError.EventCount, plural(parsedError.EventCount))
+		if parsedError.UserCount > 0 {
+			seen += fmt.Sprintf(", affecting %d user%s", parsedError.UserCount, plural(parsedError.UserCount))
+		}
+		facts = append(facts, seen)
+	}
+	return strings.Join(facts, "\n")
+}
+
+func plural(n int) string {
+	if n == 1 {
+		return ""
+	}
+	return "s"
+}
+
+// prDescription is the body of a fix's pull request before the links
+// appended to it: its report, or else the description Claude wrote.
+func prDescription(fix *ProposedFix, parsedError *webhook.ParsedError) string {
+	if fix.Report != nil {
+		return fix.Report.Markdown(parsedError)
+	}
+	if fix.PRBody != "" {
+		return fix.PRBody
+	}
+	return fmt.Sprintf("## Summary\n\n%s", fix.Description)
+}
@@ -0,0 +1,72 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/tools"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/webhook"
+)
+
+func TestNewFixReport(t *testing.T) {
+	if report := newFixReport(&tools.FixResponse{RiskLevel: "low"}); report != nil {
+		t.Errorf("newFixReport() without root cause or explanation = %+v, want nil", report)
+	}
+
+	report := newFixReport(&tools.FixResponse{RootCause: " Deleted users have no profile. ", RiskLevel: " Medium"})
+	if report.RootCause != "Deleted users have no profile." || report.RiskLevel != RiskMedium {
+		t.Errorf("newFixReport() = %+v", report)
+	}
+
+	if report := newFixReport(&tools.FixResponse{FixExplanation: "Guard the lookup.", RiskLevel: "negligible"}); report.RiskLevel != "" {
+		t.Errorf("unknown risk level kept as %q", report.RiskLevel)
+	}
+}
+
+func TestFixReport_Markdown(t *testing.T) {
+	report := &FixReport{
+		RootCause:   "Deleted users have no profile.",
+		Explanation: "Return an empty name for them.",
+		RiskLevel:   RiskLow,
+		RiskReason:  "Only deleted users take the new branch.",
+		Affected:    "The profile page.",
+		Testing:     "Added a test for a deleted user.",
+	}
+	parsedError := &webhook.ParsedError{
+		Request:    &webhook.RequestData{Method: "GET", URL: "https://example.com/users/7/profile?tab=posts"},
+		EventCount: 120,
+		UserCount:  1,
+	}
+
+	got := report.Markdown(parsedError)
+
+	want := "## Root Cause\n\nDeleted users have no profile.\n\n" +
+		"## Fix\n\nReturn an empty name for them.\n\n" +
+		"## Risk: Low\n\nOnly deleted users take the new branch.\n\n" +
+		"## Impact\n\nThe profile page.\n\n- **Endpoint**: `GET /users/7/profile`\n- **Seen**: 120 times, affecting 1 user\n\n" +
+		"## Testing\n\nAdded a test for a deleted user."
+	if got != want {
+		t.Errorf("Markdown() =\n%s\nwant\n%s", got, want)
+	}
+
+	if got := (&FixReport{Explanation: "Return an empty name."}).Markdown(nil); got != "## Fix\n\nReturn an empty name." {
+		t.Errorf("Markdown() of a sparse report = %q", got)
+	}
+}
+
+func TestPRDescription(t *testing.T) {
+	fix := &ProposedFix{Description: "Guard against a missing user", PRBody: "## Summary\n\nHandwritten."}
+	if got := prDescription(fix, nil); got != fix.PRBody {
+		t.Errorf("prDescription() without report = %q, want the PR body", got)
+	}
+
+	fix.PRBody = ""
+	if got := prDescription(fix, nil); got != "## Summary\n\nGuard against a missing user" {
+		t.Errorf("prDescription() without report or PR body = %q", got)
+	}
+
+	fix.Report = &FixReport{RootCause: "Deleted users have no profile."}
+	if got := prDescription(fix, nil); !strings.HasPrefix(got, "## Root Cause") {
+		t.Errorf("prDescription() with report = %q", got)
+	}
+}
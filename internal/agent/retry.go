@@ -0,0 +1,63 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand/v2"
+	"time"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/gitprovider"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/tools"
+)
+
+// RetryPolicy bounds how often a failed step is retried. Delays double after
+// each attempt, starting at BaseDelay and capped at MaxDelay, with jitter so
+// replicas hitting the same outage don't retry in lockstep.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// Retryable reports whether err is a transient failure, such as a GitHub
+// 502 or a Claude Code timeout, rather than a permanent one.
+func Retryable(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var transient *tools.TransientError
+	return errors.As(err, &transient) || gitprovider.IsTransient(err)
+}
+
+// Do runs fn until it succeeds, fails permanently, ctx is done or the policy
+// runs out of attempts. It returns fn's last error.
+func (p RetryPolicy) Do(ctx context.Context, what string, fn func(context.Context) error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || attempt >= p.MaxAttempts || !Retryable(err) {
+			return err
+		}
+
+		delay := p.backoff(attempt)
+		log.Printf("%s failed (attempt %d/%d), retrying in %s: %v", what, attempt, p.MaxAttempts, delay.Round(time.Millisecond), err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// backoff returns the delay before retrying after the given attempt: a random
+// duration between half and all of the exponential delay.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay << (attempt - 1)
+	if delay > p.MaxDelay || delay <= 0 {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
@@ -0,0 +1,86 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v66/github"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/tools"
+)
+
+func githubError(status int) error {
+	return fmt.Errorf("failed to create branch: %w", &github.ErrorResponse{Response: &http.Response{StatusCode: status}})
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"github 502", githubError(http.StatusBadGateway), true},
+		{"github 429", githubError(http.StatusTooManyRequests), true},
+		{"github 422", githubError(http.StatusUnprocessableEntity), false},
+		{"github rate limit", &github.RateLimitError{}, true},
+		{"claude timeout", fmt.Errorf("Claude Code error: %w", &tools.TransientError{Err: errors.New("timed out")}), true},
+		{"canceled", fmt.Errorf("clone: %w", context.Canceled), false},
+		{"unknown", errors.New("no file changes to commit"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Retryable(tt.err); got != tt.want {
+				t.Errorf("Retryable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_Do(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 2 * time.Millisecond}
+	transient := &tools.TransientError{Err: errors.New("timed out")}
+
+	tests := []struct {
+		name         string
+		errs         []error
+		wantAttempts int
+		wantErr      bool
+	}{
+		{"succeeds first time", []error{nil}, 1, false},
+		{"recovers from transient failure", []error{transient, nil}, 2, false},
+		{"gives up after max attempts", []error{transient, transient, transient, nil}, 3, true},
+		{"does not retry permanent failure", []error{errors.New("bad fix"), nil}, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			err := policy.Do(context.Background(), "test", func(context.Context) error {
+				attempts++
+				return tt.errs[attempts-1]
+			})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Do() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 10, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+
+	for attempt, max := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 8: 10 * time.Second} {
+		got := policy.backoff(attempt)
+		if got < max/2 || got > max {
+			t.Errorf("backoff(%d) = %s, want between %s and %s", attempt, got, max/2, max)
+		}
+	}
+}
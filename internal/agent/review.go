@@ -0,0 +1,112 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/config"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/gitprovider"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/tools"
+)
+
+// ReviewOptions configures the review of each fix by a second Claude
+// session, which approves it, requests changes or vetoes it.
+type ReviewOptions struct {
+	Enabled bool
+	// MaxRevisions caps how often a fix is regenerated on the reviewer's
+	// request; a fix still not approved after that is vetoed.
+	MaxRevisions int
+	// MinChangedLines skips the review of fixes changing fewer lines; 0
+	// reviews every fix.
+	MinChangedLines int
+}
+
+// FixVetoedError reports that the reviewer refused a fix.
+type FixVetoedError struct {
+	Reason string
+	// Usage is what generating and reviewing the fix used.
+	Usage Usage
+}
+
+func (e *FixVetoedError) Error() string {
+	return "reviewer vetoed the fix: " + e.Reason
+}
+
+// reviewFix has the generator review fix, regenerating it with the
+// reviewer's feedback while changes are requested. It returns the approved
+// fix or a *FixVetoedError.
+func (p *Pipeline) reviewFix(ctx context.Context, repo *config.RepoMapping, branch, token string, provider gitprovider.Provider, req *tools.FixRequest, fix *ProposedFix) (*ProposedFix, error) {
+	reviewer, ok := p.generator.(FixReviewer)
+	if !ok {
+		log.Printf("Fix backend cannot review fixes, skipping review")
+		return fix, nil
+	}
+
+	for revision := 0; ; revision++ {
+		diff := fixDiff(ctx, provider, branch, fix)
+		if revision == 0 && changedLines(diff) < p.review.MinChangedLines {
+			log.Printf("Fix changes fewer than %d lines, skipping review", p.review.MinChangedLines)
+			return fix, nil
+		}
+
+		resp, err := reviewer.ReviewFix(ctx, repo, branch, token, &tools.ReviewRequest{Fix: req, Description: fix.Description, Diff: diff})
+		if err != nil {
+			return nil, fmt.Errorf("failed to review fix: %w", err)
+		}
+		fix.addUsage(Usage{CostUSD: resp.CostUSD, InputTokens: resp.InputTokens, OutputTokens: resp.OutputTokens})
+
+		switch {
+		case resp.Verdict == tools.ReviewApprove:
+			log.Printf("Reviewer approved the fix")
+			return fix, nil
+		case resp.Verdict == tools.ReviewVeto:
+			return nil, &FixVetoedError{Reason: resp.Feedback, Usage: fix.Usage()}
+		case revision >= p.review.MaxRevisions:
+			return nil, &FixVetoedError{
+				Reason: fmt.Sprintf("changes still requested after %d revisions: %s", revision, resp.Feedback),
+				Usage:  fix.Usage(),
+			}
+		}
+
+		log.Printf("Reviewer requested changes, revising the fix (%d/%d)", revision+1, p.review.MaxRevisions)
+		req.Revision = &tools.Revision{Diff: diff, Feedback: resp.Feedback}
+		req.FailedAttempt = nil
+		if fix, err = p.regenerate(ctx, repo, branch, token, provider, req, fix.Usage()); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// fixDiff renders fix as a unified diff against ref. Files that can't be
+// fetched are shown as created.
+func fixDiff(ctx context.Context, provider gitprovider.Provider, ref string, fix *ProposedFix) string {
+	var sb strings.Builder
+	for _, f := range fix.Files {
+		var old, oldPath string
+		if f.ChangeType != "create" {
+			if file, err := provider.FetchFile(ctx, f.Path, ref); err == nil {
+				old, oldPath = file.Content, f.Path
+			}
+		}
+		newPath := f.Path
+		if f.ChangeType == "delete" {
+			newPath = ""
+		}
+		sb.WriteString(unifiedDiff(oldPath, newPath, old, f.Content))
+	}
+	return sb.String()
+}
+
+// changedLines counts the lines a unified diff adds or removes.
+func changedLines(diff string) int {
+	n := 0
+	for _, line := range strings.Split(diff, "\n") {
+		if (strings.HasPrefix(line, "+") || strings.HasPrefix(line, "-")) &&
+			!strings.HasPrefix(line, "+++ ") && !strings.HasPrefix(line, "--- ") {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,138 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/config"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/tools"
+)
+
+// fakeReviewer generates the fixes and returns the verdicts it is given, in
+// order.
+type fakeReviewer struct {
+	fixes    []*tools.FixResponse
+	verdicts []*tools.ReviewResponse
+	reviews  []*tools.ReviewRequest
+}
+
+func (r *fakeReviewer) GenerateFix(ctx context.Context, repo *config.RepoMapping, branch, token string, req *tools.FixRequest) (*tools.FixResponse, error) {
+	fix := r.fixes[0]
+	r.fixes = r.fixes[1:]
+	return fix, nil
+}
+
+func (r *fakeReviewer) ReviewFix(ctx context.Context, repo *config.RepoMapping, branch, token string, req *tools.ReviewRequest) (*tools.ReviewResponse, error) {
+	r.reviews = append(r.reviews, req)
+	verdict := r.verdicts[0]
+	r.verdicts = r.verdicts[1:]
+	return verdict, nil
+}
+
+func TestPipeline_ReviewFix(t *testing.T) {
+	revised := &tools.FixResponse{
+		Success: true,
+		Files:   []tools.FileChange{{Path: "app.py", Content: "if user:\n    return user.name\n", ChangeType: "modify"}},
+		CostUSD: 1,
+	}
+	verdict := func(v string) *tools.ReviewResponse {
+		return &tools.ReviewResponse{Verdict: v, Feedback: "check the caller", CostUSD: 0.25}
+	}
+
+	tests := []struct {
+		name        string
+		opts        ReviewOptions
+		verdicts    []*tools.ReviewResponse
+		wantReviews int
+		wantRevised bool
+		wantVeto    string
+		wantCost    float64
+	}{
+		{
+			name:        "approved",
+			opts:        ReviewOptions{Enabled: true, MaxRevisions: 1},
+			verdicts:    []*tools.ReviewResponse{verdict(tools.ReviewApprove)},
+			wantReviews: 1,
+			wantCost:    0.75,
+		},
+		{
+			name:        "revised",
+			opts:        ReviewOptions{Enabled: true, MaxRevisions: 1},
+			verdicts:    []*tools.ReviewResponse{verdict(tools.ReviewRequestChanges), verdict(tools.ReviewApprove)},
+			wantReviews: 2,
+			wantRevised: true,
+			wantCost:    2,
+		},
+		{
+			name:        "vetoed",
+			opts:        ReviewOptions{Enabled: true, MaxRevisions: 1},
+			verdicts:    []*tools.ReviewResponse{verdict(tools.ReviewVeto)},
+			wantReviews: 1,
+			wantVeto:    "reviewer vetoed the fix: check the caller",
+			wantCost:    0.75,
+		},
+		{
+			name:        "out of revisions",
+			opts:        ReviewOptions{Enabled: true, MaxRevisions: 1},
+			verdicts:    []*tools.ReviewResponse{verdict(tools.ReviewRequestChanges), verdict(tools.ReviewRequestChanges)},
+			wantReviews: 2,
+			wantVeto:    "changes still requested after 1 revisions",
+			wantCost:    2,
+		},
+		{
+			name:     "small fix",
+			opts:     ReviewOptions{Enabled: true, MinChangedLines: 10},
+			wantCost: 0.5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reviewer := &fakeReviewer{fixes: []*tools.FixResponse{revised}, verdicts: tt.verdicts}
+			p := &Pipeline{generator: reviewer, review: tt.opts}
+			provider := &fakeProvider{files: map[string]string{"app.py": "return user.name\n"}}
+			req := &tools.FixRequest{IssueID: "1"}
+			fix := &ProposedFix{
+				Files:   []FileChange{{Path: "app.py", Content: "return user.name if user else None\n", ChangeType: "modify"}},
+				CostUSD: 0.5,
+			}
+
+			got, err := p.reviewFix(context.Background(), &config.RepoMapping{Owner: "org", Repo: "app"}, "main", "token", provider, req, fix)
+
+			if len(reviewer.reviews) != tt.wantReviews {
+				t.Fatalf("reviews = %d, want %d", len(reviewer.reviews), tt.wantReviews)
+			}
+			if tt.wantReviews > 0 {
+				want := "--- a/app.py\n+++ b/app.py\n@@ -1,1 +1,1 @@\n-return user.name\n+return user.name if user else None\n"
+				if diff := reviewer.reviews[0].Diff; diff != want {
+					t.Errorf("reviewed diff =\n%s\nwant\n%s", diff, want)
+				}
+			}
+
+			var vetoed *FixVetoedError
+			if tt.wantVeto != "" {
+				if !errors.As(err, &vetoed) || !strings.Contains(err.Error(), tt.wantVeto) {
+					t.Fatalf("reviewFix() error = %v, want veto %q", err, tt.wantVeto)
+				}
+				if vetoed.Usage.CostUSD != tt.wantCost {
+					t.Errorf("vetoed usage = %v, want %v", vetoed.Usage.CostUSD, tt.wantCost)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("reviewFix() error = %v", err)
+			}
+			if revisedFix := got.Files[0].Content == revised.Files[0].Content; revisedFix != tt.wantRevised {
+				t.Errorf("fix content = %q, revised %v", got.Files[0].Content, tt.wantRevised)
+			}
+			if tt.wantRevised && (req.Revision == nil || req.Revision.Feedback != "check the caller") {
+				t.Errorf("revision request = %+v, want the reviewer's feedback", req.Revision)
+			}
+			if got.CostUSD != tt.wantCost {
+				t.Errorf("fix cost = %v, want %v", got.CostUSD, tt.wantCost)
+			}
+		})
+	}
+}
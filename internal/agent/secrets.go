@@ -0,0 +1,152 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/gitprovider"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/tools"
+)
+
+// secretPatterns match credentials by their well-known formats, and
+// hardcoded values assigned to names that suggest a secret.
+var secretPatterns = []struct {
+	kind    string
+	pattern *regexp.Regexp
+}{
+	{"private key", regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`)},
+	{"AWS access key", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"GitHub token", regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})`)},
+	{"Anthropic API key", regexp.MustCompile(`\bsk-ant-[A-Za-z0-9_-]{20,}`)},
+	{"Slack token", regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}`)},
+	{"Stripe key", regexp.MustCompile(`\b[rs]k_live_[A-Za-z0-9]{20,}`)},
+	{"Google API key", regexp.MustCompile(`\bAIza[A-Za-z0-9_-]{35}\b`)},
+	{"Sentry token", regexp.MustCompile(`\b(?:sntrys_[A-Za-z0-9_=+/]{20,}|sntryu_[a-f0-9]{64})`)},
+	{"JSON web token", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`)},
+	{"hardcoded secret", regexp.MustCompile(`(?i)(?:password|passwd|secret|token|api_?key|access_?key)["']?\s*[:=]\s*["'][^"'\s]{16,}["']`)},
+}
+
+// sensitiveName matches the names of request headers, query parameters and
+// local variables likely to hold credentials.
+var sensitiveName = regexp.MustCompile(`(?i)auth|cookie|token|key|secret|session|passw`)
+
+// minContextSecretLen is the shortest value that counts as copied from the
+// error's context when found in a fix; shorter ones are too likely to
+// appear by chance.
+const minContextSecretLen = 8
+
+// SecretFoundError reports that a fix appears to add credentials, either
+// in a known format or copied from the error's context.
+type SecretFoundError struct {
+	// Findings name the file and kind of each suspected secret, never the
+	// secret itself.
+	Findings []string
+	// Usage is what generating the fix used.
+	Usage Usage
+}
+
+func (e *SecretFoundError) Error() string {
+	return "fix appears to contain secrets: " + strings.Join(e.Findings, ", ")
+}
+
+// scanSecrets looks for secrets in the lines fix adds to ref, returning a
+// *SecretFoundError if it finds any.
+func scanSecrets(ctx context.Context, provider gitprovider.Provider, ref string, req *tools.FixRequest, fix *ProposedFix) error {
+	copied := contextSecrets(req)
+	var findings []string
+	for _, f := range fix.Files {
+		seen := make(map[string]bool)
+		diff := fixDiff(ctx, provider, ref, &ProposedFix{Files: []FileChange{f}})
+		for _, line := range strings.Split(diff, "\n") {
+			if !strings.HasPrefix(line, "+") || strings.HasPrefix(line, "+++ ") {
+				continue
+			}
+			for _, kind := range findSecrets(line[1:], copied) {
+				if !seen[kind] {
+					seen[kind] = true
+					findings = append(findings, fmt.Sprintf("%s (%s)", f.Path, kind))
+				}
+			}
+		}
+	}
+	if len(findings) > 0 {
+		return &SecretFoundError{Findings: findings, Usage: fix.Usage()}
+	}
+	return nil
+}
+
+// contextSecrets returns the values of the request's headers and query
+// parameters, the frames' local variables and the breadcrumbs' data whose
+// names suggest a secret. Values Sentry scrubbed are left out.
+func contextSecrets(req *tools.FixRequest) []string {
+	var secrets []string
+	add := func(name, value string) {
+		// Sentry's Python SDK sends variables as reprs
+		value = strings.Trim(value, `'"`)
+		if sensitiveName.MatchString(name) && len(value) >= minContextSecretLen && value != "[Filtered]" {
+			secrets = append(secrets, value)
+		}
+	}
+	if req.Request != nil {
+		for _, params := range [][]tools.Param{req.Request.Headers, req.Request.Query} {
+			for _, p := range params {
+				add(p.Name, p.Value)
+			}
+		}
+	}
+	for _, frame := range req.Stacktrace {
+		for name, value := range frame.Vars {
+			if s, ok := value.(string); ok {
+				add(name, s)
+			}
+		}
+	}
+	for _, crumb := range req.Breadcrumbs {
+		for name, value := range crumb.Data {
+			if s, ok := value.(string); ok {
+				add(name, s)
+			}
+		}
+	}
+	return secrets
+}
+
+// findSecrets returns the kinds of secret in line, including any of copied.
+func findSecrets(line string, copied []string) []string {
+	var kinds []string
+	for _, p := range secretPatterns {
+		if p.pattern.MatchString(line) {
+			kinds = append(kinds, p.kind)
+		}
+	}
+	for _, value := range copied {
+		if strings.Contains(line, value) {
+			kinds = append(kinds, "value from the error's context")
+			break
+		}
+	}
+	return kinds
+}
+
+// sensitiveAssignment matches a value given for a name that suggests a
+// secret, such as a header or variable in a prompt or a setting in code.
+// Values without a digit are taken for code, such as os.environ lookups.
+var sensitiveAssignment = regexp.MustCompile("(?i)([\\w.-]*(?:auth|cookie|token|key|secret|session|passw)[\\w.-]*[`\"']*\\s*[:=]\\s*[`\"']*(?:Bearer |Basic )?)([\\w+/=.~-]{8,})")
+
+// RedactSecrets replaces the credentials in text, by their well-known
+// formats or the names they are given, with a marker.
+func RedactSecrets(text string) string {
+	text = sensitiveAssignment.ReplaceAllStringFunc(text, func(m string) string {
+		parts := sensitiveAssignment.FindStringSubmatch(m)
+		if !strings.ContainsAny(parts[2], "0123456789") {
+			return m
+		}
+		return parts[1] + "[REDACTED]"
+	})
+	for _, p := range secretPatterns {
+		text = p.pattern.ReplaceAllString(text, "[REDACTED "+p.kind+"]")
+	}
+	return text
+}
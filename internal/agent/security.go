@@ -0,0 +1,129 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/gitprovider"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/webhook"
+)
+
+// DefaultSecurityPatterns match error classes and messages that usually
+// indicate a vulnerability rather than an ordinary bug.
+var DefaultSecurityPatterns = []string{
+	`injection`,
+	`\bxss\b`,
+	`cross.?site`,
+	`deserializ`,
+	`InvalidClassException`,
+	`unpickl`,
+	`path.?traversal`,
+	`directory.?traversal`,
+	`\.\./`,
+	`SuspiciousFileOperation`,
+	`SecurityException`,
+	`\bxxe\b`,
+	`\bssrf\b`,
+}
+
+// SecurityClassifier detects vulnerability-class errors.
+type SecurityClassifier struct {
+	patterns []*regexp.Regexp
+}
+
+// NewSecurityClassifier compiles case-insensitive patterns.
+func NewSecurityClassifier(patterns []string) (*SecurityClassifier, error) {
+	c := &SecurityClassifier{}
+	for _, p := range patterns {
+		re, err := regexp.Compile("(?i)" + p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid security pattern %q: %w", p, err)
+		}
+		c.patterns = append(c.patterns, re)
+	}
+	return c, nil
+}
+
+// IsSecurityError reports whether the error type, message or title matches
+// any security pattern.
+func (c *SecurityClassifier) IsSecurityError(parsedError *webhook.ParsedError) bool {
+	text := strings.Join([]string{parsedError.ErrorType, parsedError.ErrorMessage, parsedError.Title}, "\n")
+	for _, re := range c.patterns {
+		if re.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
+
+// forkReadyAttempts bounds how long to wait for a private fork to become usable.
+const forkReadyAttempts = 10
+
+// CreateSecurityFix opens a draft security advisory and proposes the fix in
+// its temporary private fork instead of a public PR. The PR carries no labels
+// or assignees to keep notifications to a minimum. It returns the advisory URL.
+func CreateSecurityFix(ctx context.Context, provider gitprovider.Provider, forkProvider func(owner, repo string) gitprovider.Provider, parsedError *webhook.ParsedError, fix *ProposedFix) (string, error) {
+	advisory, err := provider.CreateSecurityAdvisory(ctx, gitprovider.AdvisoryRequest{
+		Summary: fmt.Sprintf("%s in %s", parsedError.ErrorType, parsedError.Culprit),
+		Description: fmt.Sprintf("Reported by Sentry: %s\n\n%s\n\n%s",
+			parsedError.Permalink, parsedError.ErrorMessage, fix.Description),
+		Severity: "high",
+	})
+	if err != nil {
+		return "", err
+	}
+
+	forkOwner, forkRepo, err := provider.CreatePrivateFork(ctx, advisory.GHSAID)
+	if err != nil {
+		return "", err
+	}
+	fork := forkProvider(forkOwner, forkRepo)
+
+	// The fork is created asynchronously
+	if err := waitForRepository(ctx, fork, forkReadyAttempts, 3*time.Second); err != nil {
+		return "", fmt.Errorf("private fork %s/%s not ready: %w", forkOwner, forkRepo, err)
+	}
+
+	branchName := fmt.Sprintf("security-fix/%d", unixTimestamp())
+	defaultBranch, err := pushFixBranch(ctx, fork, "", branchName, parsedError, fix)
+	if err != nil {
+		return "", err
+	}
+
+	prBody := prDescription(fix, parsedError)
+	prBody += fmt.Sprintf("\n\n---\n🔒 Security advisory: %s\n🤖 Generated by SentryAgent using Claude Code", advisory.HTMLURL)
+
+	_, err = fork.CreatePullRequest(ctx, gitprovider.PRRequest{
+		Title: fix.PRTitle,
+		Body:  prBody,
+		Head:  branchName,
+		Base:  defaultBranch,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create PR in private fork: %w", err)
+	}
+
+	return advisory.HTMLURL, nil
+}
+
+// waitForRepository polls until the repository answers API calls.
+func waitForRepository(ctx context.Context, provider gitprovider.Provider, attempts int, interval time.Duration) error {
+	var err error
+	for i := 0; i < attempts; i++ {
+		if _, err = provider.GetDefaultBranch(ctx); err == nil {
+			return nil
+		}
+		log.Printf("Waiting for %s/%s: %v", provider.Owner(), provider.Repo(), err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+	return err
+}
@@ -0,0 +1,76 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/gitprovider"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/webhook"
+)
+
+func TestSecurityClassifier_IsSecurityError(t *testing.T) {
+	c, err := NewSecurityClassifier(DefaultSecurityPatterns)
+	if err != nil {
+		t.Fatalf("NewSecurityClassifier() error = %v", err)
+	}
+
+	tests := []struct {
+		parsed webhook.ParsedError
+		want   bool
+	}{
+		{webhook.ParsedError{ErrorType: "SQLInjectionAttempt"}, true},
+		{webhook.ParsedError{ErrorType: "java.io.InvalidClassException"}, true},
+		{webhook.ParsedError{ErrorType: "ValueError", ErrorMessage: "refusing to open ../../etc/passwd"}, true},
+		{webhook.ParsedError{ErrorType: "SuspiciousFileOperation"}, true},
+		{webhook.ParsedError{ErrorType: "NullPointerException", ErrorMessage: "user was null"}, false},
+		{webhook.ParsedError{ErrorType: "KeyError", Title: "KeyError: 'xssi_token'"}, false},
+	}
+
+	for _, tt := range tests {
+		if got := c.IsSecurityError(&tt.parsed); got != tt.want {
+			t.Errorf("IsSecurityError(%+v) = %v, want %v", tt.parsed, got, tt.want)
+		}
+	}
+
+	if _, err := NewSecurityClassifier([]string{"("}); err == nil {
+		t.Error("NewSecurityClassifier() should reject invalid patterns")
+	}
+}
+
+func TestCreateSecurityFix(t *testing.T) {
+	upstream := &fakeProvider{}
+	fork := &fakeProvider{}
+
+	var forkName string
+	url, err := CreateSecurityFix(context.Background(), upstream,
+		func(owner, repo string) gitprovider.Provider {
+			forkName = owner + "/" + repo
+			return fork
+		},
+		&webhook.ParsedError{ErrorType: "PathTraversal", Culprit: "files.Open"},
+		&ProposedFix{PRTitle: "fix: sanitize paths", Files: []FileChange{{Path: "files.go", Content: "package files\n"}}},
+	)
+	if err != nil {
+		t.Fatalf("CreateSecurityFix() error = %v", err)
+	}
+
+	if !strings.Contains(url, "GHSA-") {
+		t.Errorf("returned URL = %q, want advisory URL", url)
+	}
+	if len(upstream.advisories) != 1 {
+		t.Errorf("advisories created = %d, want 1", len(upstream.advisories))
+	}
+	if len(upstream.createdPRs) != 0 {
+		t.Error("no public PR should be opened on the upstream repository")
+	}
+	if forkName != "owner/repo-ghsa-xxxx-yyyy-zzzz" {
+		t.Errorf("fork = %q", forkName)
+	}
+	if len(fork.createdPRs) != 1 {
+		t.Fatalf("fork PRs = %d, want 1", len(fork.createdPRs))
+	}
+	if pr := fork.createdPRs[0]; len(pr.Labels) != 0 || len(pr.Assignees) != 0 {
+		t.Errorf("fork PR should not carry labels or assignees: %+v", pr)
+	}
+}
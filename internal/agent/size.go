@@ -0,0 +1,40 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/config"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/gitprovider"
+)
+
+// checkSize marks fix Oversized if it changes more files or lines than
+// repo.MaxFixFiles or repo.MaxFixLines, and reports whether it did. The
+// fix's regression test does not count.
+func checkSize(ctx context.Context, repo *config.RepoMapping, ref string, provider gitprovider.Provider, fix *ProposedFix) bool {
+	if repo.MaxFixFiles <= 0 && repo.MaxFixLines <= 0 {
+		return false
+	}
+
+	counted := &ProposedFix{}
+	for _, f := range fix.Files {
+		if !f.Test {
+			counted.Files = append(counted.Files, f)
+		}
+	}
+
+	switch files := len(counted.Files); {
+	case repo.MaxFixFiles > 0 && files > repo.MaxFixFiles:
+		fix.Oversized = fmt.Sprintf("changes %d files, more than the limit of %d", files, repo.MaxFixFiles)
+	case repo.MaxFixLines > 0:
+		if lines := changedLines(fixDiff(ctx, provider, ref, counted)); lines > repo.MaxFixLines {
+			fix.Oversized = fmt.Sprintf("changes %d lines, more than the limit of %d", lines, repo.MaxFixLines)
+		}
+	}
+	if fix.Oversized == "" {
+		return false
+	}
+	log.Printf("Fix %s, not checking it further", fix.Oversized)
+	return true
+}
@@ -0,0 +1,66 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/config"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/tools"
+)
+
+func TestCheckSize(t *testing.T) {
+	fix := func() *ProposedFix {
+		return &ProposedFix{Files: []FileChange{
+			{Path: "app.py", Content: "a\nB\nc\n", ChangeType: "modify"},
+			{Path: "util.py", Content: "x\n", ChangeType: "create"},
+			{Path: "test_app.py", Content: "t1\nt2\nt3\nt4\n", ChangeType: "create", Test: true},
+		}}
+	}
+
+	tests := []struct {
+		name     string
+		maxFiles int
+		maxLines int
+		want     string
+	}{
+		{name: "no limits"},
+		{name: "within limits", maxFiles: 2, maxLines: 4},
+		{name: "too many files", maxFiles: 1, want: "changes 2 files, more than the limit of 1"},
+		{name: "too many lines", maxLines: 3, want: "changes 4 lines, more than the limit of 3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &config.RepoMapping{Owner: "org", Repo: "app", MaxFixFiles: tt.maxFiles, MaxFixLines: tt.maxLines}
+			provider := &fakeProvider{files: map[string]string{"app.py": "a\nb\n"}}
+			f := fix()
+
+			got := checkSize(context.Background(), repo, "main", provider, f)
+
+			if got != (tt.want != "") || f.Oversized != tt.want {
+				t.Errorf("checkSize() = %v, Oversized %q, want %q", got, f.Oversized, tt.want)
+			}
+		})
+	}
+}
+
+func TestPipeline_RefineFix_Oversized(t *testing.T) {
+	p := &Pipeline{repairAttempts: 2}
+	fix := &ProposedFix{Files: []FileChange{
+		{Path: "a.py", Content: "a\n", ChangeType: "modify"},
+		{Path: "b.py", Content: "b\n", ChangeType: "modify"},
+	}}
+	verify := func(ctx context.Context, repo *config.RepoMapping, branch, token string, fix *ProposedFix) error {
+		t.Error("oversized fix was verified")
+		return nil
+	}
+
+	repo := &config.RepoMapping{Owner: "org", Repo: "app", TestCommand: "make test", MaxFixFiles: 1}
+	got, err := p.refineFix(context.Background(), repo, "main", "token", &fakeProvider{}, &tools.FixRequest{IssueID: "1"}, fix, verify)
+	if err != nil {
+		t.Fatalf("refineFix() error = %v", err)
+	}
+	if got.Oversized == "" {
+		t.Error("fix not marked oversized")
+	}
+}
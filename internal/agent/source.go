@@ -0,0 +1,107 @@
+package agent
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/gitprovider"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/tools"
+)
+
+// maxSourceFiles caps how many files are fetched for the prompt.
+const maxSourceFiles = 5
+
+// maxPathAttempts caps how many candidate paths are tried per frame
+// filename, since each costs a provider request.
+const maxPathAttempts = 4
+
+// gatherSource fetches the code within lines lines of each in-app frame
+// through provider, starting from the frame that raised the error. Files
+// that can't be found are skipped.
+func gatherSource(ctx context.Context, provider gitprovider.Provider, ref string, frames []tools.Frame, lines int) []tools.SourceFile {
+	var (
+		files    []tools.SourceFile
+		contents = make(map[string][]string) // repository path -> lines
+		resolved = make(map[string]string)   // frame filename -> repository path, "" if not found
+		index    = make(map[string]int)      // repository path -> index in files
+	)
+
+	// Sentry lists the frame that raised the error last
+	for i := len(frames) - 1; i >= 0; i-- {
+		frame := frames[i]
+		if !frame.InApp || frame.Minified || frame.LineNo <= 0 || ctx.Err() != nil {
+			continue
+		}
+
+		path, ok := resolved[frame.Filename]
+		if !ok {
+			if len(files) >= maxSourceFiles {
+				continue
+			}
+			var content []string
+			path, content = fetchFrameFile(ctx, provider, ref, frame.Filename)
+			resolved[frame.Filename] = path
+			if path != "" {
+				if _, seen := contents[path]; !seen {
+					contents[path] = content
+					index[path] = len(files)
+					files = append(files, tools.SourceFile{Path: path})
+				}
+			}
+		}
+		if path == "" {
+			continue
+		}
+
+		file := &files[index[path]]
+		file.FrameLines = append(file.FrameLines, frame.LineNo)
+	}
+
+	for i := range files {
+		files[i].Lines = excerpt(contents[files[i].Path], files[i].FrameLines, lines)
+	}
+	return files
+}
+
+// fetchFrameFile finds the repository file a frame filename refers to and
+// returns its path and lines, or "" if there is none.
+func fetchFrameFile(ctx context.Context, provider gitprovider.Provider, ref, filename string) (string, []string) {
+	candidates := tools.PathCandidates(filename)
+	if len(candidates) > maxPathAttempts {
+		candidates = candidates[:maxPathAttempts]
+	}
+	for _, path := range candidates {
+		// Bare filenames would match any file with that name at the root
+		if !strings.Contains(path, "/") && len(candidates) > 1 {
+			continue
+		}
+		file, err := provider.FetchFile(ctx, path, ref)
+		if err != nil {
+			continue
+		}
+		log.Printf("Including %s in the prompt", path)
+		return path, strings.Split(file.Content, "\n")
+	}
+	log.Printf("Couldn't find %s in the repository, leaving it out of the prompt", filename)
+	return "", nil
+}
+
+// excerpt returns the lines within context lines of each of frameLines,
+// merging overlapping ranges.
+func excerpt(content []string, frameLines []int, context int) []tools.SourceLine {
+	keep := make([]bool, len(content)+1)
+	for _, n := range frameLines {
+		for l := max(1, n-context); l <= min(len(content), n+context); l++ {
+			keep[l] = true
+		}
+	}
+
+	var out []tools.SourceLine
+	for l := 1; l <= len(content); l++ {
+		if keep[l] {
+			out = append(out, tools.SourceLine{LineNo: l, Code: content[l-1]})
+		}
+	}
+	return out
+}
@@ -0,0 +1,55 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/tools"
+)
+
+func TestGatherSource(t *testing.T) {
+	var handler []string
+	for i := 1; i <= 30; i++ {
+		handler = append(handler, fmt.Sprintf("line %d", i))
+	}
+	provider := &fakeProvider{files: map[string]string{
+		"app/handler.py": strings.Join(handler, "\n"),
+		"app/models.py":  "class User:\n    name = None",
+	}}
+
+	frames := []tools.Frame{
+		{Filename: "/srv/app/handler.py", LineNo: 5, InApp: true},
+		{Filename: "django/core/handlers/base.py", LineNo: 100},
+		{Filename: "/srv/app/models.py", LineNo: 2, InApp: true},
+		{Filename: "lib/missing.py", LineNo: 3, InApp: true},
+		{Filename: "static/app.min.js", LineNo: 1, InApp: true, Minified: true},
+		{Filename: "/srv/app/handler.py", LineNo: 25, InApp: true},
+	}
+
+	got := gatherSource(context.Background(), provider, "main", frames, 2)
+	if len(got) != 2 {
+		t.Fatalf("gatherSource() returned %d files, want 2: %+v", len(got), got)
+	}
+
+	// The frame that raised the error comes first
+	if got[0].Path != "app/handler.py" || !reflect.DeepEqual(got[0].FrameLines, []int{25, 5}) {
+		t.Errorf("first file = %s at %v, want app/handler.py at [25 5]", got[0].Path, got[0].FrameLines)
+	}
+	var lines []int
+	for _, l := range got[0].Lines {
+		lines = append(lines, l.LineNo)
+	}
+	if want := []int{3, 4, 5, 6, 7, 23, 24, 25, 26, 27}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("handler.py lines = %v, want %v", lines, want)
+	}
+	if got[0].Lines[2].Code != "line 5" {
+		t.Errorf("line 5 = %q", got[0].Lines[2].Code)
+	}
+
+	if got[1].Path != "app/models.py" || len(got[1].Lines) != 2 {
+		t.Errorf("second file = %+v, want both lines of app/models.py", got[1])
+	}
+}
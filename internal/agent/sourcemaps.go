@@ -0,0 +1,230 @@
+package agent
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/config"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/gitprovider"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/sentry"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/sourcemap"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/tools"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/webhook"
+)
+
+// sourceMapContextLines is how many lines either side of a mapped frame are
+// taken from the sourcemap's embedded sources.
+const sourceMapContextLines = 5
+
+// sourceMapFetcher finds the sourcemap of a minified bundle, returning nil
+// if it has none.
+type sourceMapFetcher interface {
+	fetchSourceMap(ctx context.Context, bundle string) ([]byte, error)
+}
+
+// resolveSourceMaps maps minified in-app frames back to their original
+// source with the first sourcemap fetchers find for each bundle. Frames
+// without a sourcemap are returned unchanged.
+func resolveSourceMaps(ctx context.Context, frames []webhook.Frame, fetchers []sourceMapFetcher) []webhook.Frame {
+	maps := make(map[string]*sourcemap.Map) // bundle -> sourcemap, nil if none
+	resolved := make([]webhook.Frame, len(frames))
+	for i, frame := range frames {
+		resolved[i] = frame
+		if !frame.InApp || !frame.IsMinified() || frame.LineNo <= 0 {
+			continue
+		}
+
+		bundle := bundleOf(frame)
+		m, ok := maps[bundle]
+		if !ok {
+			m = loadSourceMap(ctx, bundle, fetchers)
+			maps[bundle] = m
+		}
+		if m == nil {
+			continue
+		}
+
+		mapping, ok := m.Lookup(frame.LineNo-1, max(frame.ColNo-1, 0))
+		if !ok {
+			continue
+		}
+		resolved[i] = mapFrame(frame, mapping, m)
+	}
+	return resolved
+}
+
+// loadSourceMap returns the first sourcemap of bundle fetchers find, or nil.
+func loadSourceMap(ctx context.Context, bundle string, fetchers []sourceMapFetcher) *sourcemap.Map {
+	for _, f := range fetchers {
+		data, err := f.fetchSourceMap(ctx, bundle)
+		if err != nil {
+			log.Printf("Failed to fetch sourcemap for %s: %v", bundle, err)
+			continue
+		}
+		if data == nil {
+			continue
+		}
+		m, err := sourcemap.Parse(data)
+		if err != nil {
+			log.Printf("Ignoring sourcemap for %s: %v", bundle, err)
+			continue
+		}
+		log.Printf("Mapping %s with its sourcemap", bundle)
+		return m
+	}
+	log.Printf("No sourcemap found for %s", bundle)
+	return nil
+}
+
+// mapFrame moves frame to the original location of mapping, taking its
+// source context from the sourcemap when embedded there.
+func mapFrame(frame webhook.Frame, mapping sourcemap.Mapping, m *sourcemap.Map) webhook.Frame {
+	frame.AbsPath = mapping.Source
+	frame.Filename = mapping.Source
+	if candidates := tools.PathCandidates(mapping.Source); len(candidates) > 0 {
+		frame.Filename = candidates[0]
+	}
+	frame.LineNo = mapping.Line + 1
+	frame.ColNo = mapping.Column + 1
+	if mapping.Name != "" {
+		frame.Function = mapping.Name
+	}
+	// Bundled dependencies are not the application's code
+	if strings.Contains(mapping.Source, "/node_modules/") {
+		frame.InApp = false
+	}
+
+	frame.Context, frame.PreContext, frame.ContextLine, frame.PostContext = nil, nil, "", nil
+	if content, ok := m.SourceContent(mapping.Source); ok {
+		lines := strings.Split(content, "\n")
+		if n := mapping.Line; n < len(lines) {
+			frame.PreContext = lines[max(0, n-sourceMapContextLines):n]
+			frame.ContextLine = lines[n]
+			frame.PostContext = lines[n+1 : min(len(lines), n+1+sourceMapContextLines)]
+		}
+	}
+	return frame
+}
+
+// bundleOf returns the URL or path of the bundle a frame points at, without
+// any query or fragment.
+func bundleOf(frame webhook.Frame) string {
+	bundle := frame.AbsPath
+	if bundle == "" {
+		bundle = frame.Filename
+	}
+	if i := strings.IndexAny(bundle, "?#"); i >= 0 {
+		bundle = bundle[:i]
+	}
+	return bundle
+}
+
+// hasMinifiedFrames reports whether any in-app frame is still minified.
+func hasMinifiedFrames(frames []webhook.Frame) bool {
+	for _, f := range frames {
+		if f.InApp && f.IsMinified() {
+			return true
+		}
+	}
+	return false
+}
+
+// releaseSourceMaps finds sourcemaps among the artifacts uploaded to a
+// Sentry release.
+type releaseSourceMaps struct {
+	client                *sentry.Client
+	org, project, release string
+
+	listed bool
+	files  []sentry.ReleaseFile
+}
+
+func (r *releaseSourceMaps) fetchSourceMap(ctx context.Context, bundle string) ([]byte, error) {
+	// List the release's files once, even if that fails
+	if !r.listed {
+		r.listed = true
+		files, err := r.client.ReleaseFiles(ctx, r.org, r.project, r.release)
+		if err != nil {
+			return nil, err
+		}
+		r.files = files
+	}
+
+	file := matchArtifact(r.files, bundle)
+	if file == nil {
+		return nil, nil
+	}
+	return r.client.DownloadReleaseFile(ctx, r.org, r.project, r.release, file.ID)
+}
+
+// matchArtifact returns the sourcemap among files named after bundle: by
+// its URL, by its path under "~" (any host), or failing that by a unique
+// file name.
+func matchArtifact(files []sentry.ReleaseFile, bundle string) *sentry.ReleaseFile {
+	names := []string{bundle + ".map"}
+	if u, err := url.Parse(bundle); err == nil && u.Path != "" {
+		names = append(names, "~"+u.Path+".map")
+	}
+	for _, name := range names {
+		for i := range files {
+			if files[i].Name == name {
+				return &files[i]
+			}
+		}
+	}
+
+	var match *sentry.ReleaseFile
+	base := path.Base(bundle) + ".map"
+	for i := range files {
+		if path.Base(files[i].Name) != base {
+			continue
+		}
+		if match != nil {
+			return nil
+		}
+		match = &files[i]
+	}
+	return match
+}
+
+// repoSourceMaps finds sourcemaps committed to the repository next to the
+// bundle's path.
+type repoSourceMaps struct {
+	provider gitprovider.Provider
+	ref      string
+}
+
+func (r *repoSourceMaps) fetchSourceMap(ctx context.Context, bundle string) ([]byte, error) {
+	candidates := tools.PathCandidates(bundle)
+	if len(candidates) > maxPathAttempts {
+		candidates = candidates[:maxPathAttempts]
+	}
+	for _, p := range candidates {
+		file, err := r.provider.FetchFile(ctx, p+".map", r.ref)
+		if err == nil {
+			return []byte(file.Content), nil
+		}
+	}
+	return nil, nil
+}
+
+// sourceMapFetchers returns where to look for the sourcemaps of a job's
+// minified frames: the Sentry release, when known, then the repository.
+func (p *Pipeline) sourceMapFetchers(repo *config.RepoMapping, provider gitprovider.Provider, branch string, parsedError *webhook.ParsedError) []sourceMapFetcher {
+	var fetchers []sourceMapFetcher
+	if p.releaseArtifacts != nil && parsedError.Release != "" && parsedError.ProjectSlug != "" {
+		client, org := p.releaseArtifacts(repo)
+		if org == "" {
+			org = sentry.OrgFromPermalink(parsedError.Permalink)
+		}
+		if client != nil && org != "" {
+			fetchers = append(fetchers, &releaseSourceMaps{client: client, org: org, project: parsedError.ProjectSlug, release: parsedError.Release})
+		} else {
+			log.Printf("No Sentry organization or auth token for %s, not looking for sourcemaps there", repo.FullName())
+		}
+	}
+	return append(fetchers, &repoSourceMaps{provider: provider, ref: branch})
+}
@@ -0,0 +1,100 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/sentry"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/webhook"
+)
+
+// fakeSourceMaps serves sourcemaps by bundle and counts lookups.
+type fakeSourceMaps struct {
+	maps    map[string]string
+	fetches int
+}
+
+func (f *fakeSourceMaps) fetchSourceMap(ctx context.Context, bundle string) ([]byte, error) {
+	f.fetches++
+	if m, ok := f.maps[bundle]; ok {
+		return []byte(m), nil
+	}
+	return nil, nil
+}
+
+func TestResolveSourceMaps(t *testing.T) {
+	fetcher := &fakeSourceMaps{maps: map[string]string{
+		"https://example.com/static/main.min.js": `{
+			"version": 3,
+			"sources": ["webpack:///./src/app.ts", "webpack:///./node_modules/lib/index.js"],
+			"sourcesContent": ["const user = load();\nuser.name;\n", null],
+			"names": ["load", "name"],
+			"mappings": "AAAA,IAAIA,SACCC,KCDL"
+		}`,
+	}}
+
+	frames := []webhook.Frame{
+		{Filename: "/static/main.min.js", AbsPath: "https://example.com/static/main.min.js?v=1", Function: "e", LineNo: 1, ColNo: 14, InApp: true},
+		{Filename: "/static/main.min.js", AbsPath: "https://example.com/static/main.min.js", Function: "t", LineNo: 1, ColNo: 20, InApp: true},
+		{Filename: "/static/vendor.min.js", AbsPath: "https://example.com/static/vendor.min.js", Function: "n", LineNo: 1, ColNo: 5, InApp: true},
+		{Filename: "app/handler.py", Function: "handle", LineNo: 3, InApp: true},
+	}
+
+	got := resolveSourceMaps(context.Background(), frames, []sourceMapFetcher{fetcher})
+
+	mapped := got[0]
+	if mapped.Filename != "src/app.ts" || mapped.LineNo != 2 || mapped.ColNo != 6 || mapped.Function != "name" || !mapped.InApp {
+		t.Errorf("mapped frame = %+v", mapped)
+	}
+	if mapped.ContextLine != "user.name;" || len(mapped.PreContext) != 1 || mapped.IsMinified() {
+		t.Errorf("mapped frame context = %q %q %q", mapped.PreContext, mapped.ContextLine, mapped.PostContext)
+	}
+
+	if got[1].Filename != "node_modules/lib/index.js" || got[1].InApp {
+		t.Errorf("dependency frame = %+v, want it mapped and not in app", got[1])
+	}
+	if got[2].Filename != frames[2].Filename || !got[2].IsMinified() {
+		t.Errorf("frame without a sourcemap = %+v, want it unchanged", got[2])
+	}
+	if got[3].Filename != "app/handler.py" {
+		t.Errorf("unminified frame = %+v, want it unchanged", got[3])
+	}
+	if !hasMinifiedFrames(got) {
+		t.Error("hasMinifiedFrames() = false, want true for the vendor bundle")
+	}
+
+	// Each bundle's sourcemap is looked up once
+	if fetcher.fetches != 2 {
+		t.Errorf("fetched %d sourcemaps, want 2", fetcher.fetches)
+	}
+}
+
+func TestMatchArtifact(t *testing.T) {
+	files := []sentry.ReleaseFile{
+		{ID: "1", Name: "~/static/js/main.js.map"},
+		{ID: "2", Name: "https://cdn.example.com/static/js/app.js.map"},
+		{ID: "3", Name: "~/a/chunk.js.map"},
+		{ID: "4", Name: "~/b/chunk.js.map"},
+		{ID: "5", Name: "~/assets/other.js.map"},
+	}
+
+	tests := []struct {
+		bundle string
+		want   string
+	}{
+		{"https://example.com/static/js/main.js", "1"},
+		{"https://cdn.example.com/static/js/app.js", "2"},
+		{"https://example.com/js/other.js", "5"},
+		{"https://example.com/js/chunk.js", ""},
+		{"https://example.com/js/missing.js", ""},
+	}
+	for _, tt := range tests {
+		got := ""
+		if f := matchArtifact(files, tt.bundle); f != nil {
+			got = f.ID
+		}
+		if got != tt.want {
+			t.Errorf("matchArtifact(%q) = %q, want %q", tt.bundle, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/config"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/tools"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/webhook"
+)
+
+// PipelineStage is one of the steps an error goes through on its way to a
+// fix, in the order below.
+type PipelineStage string
+
+const (
+	// PipelineIngest builds the fix request from the Sentry error.
+	PipelineIngest PipelineStage = "ingest"
+	// PipelineLocate finds the code the error points at, resolving
+	// sourcemaps and adding source context and culprit history to the
+	// request.
+	PipelineLocate PipelineStage = "locate"
+	// PipelineGenerate has Claude write the fix.
+	PipelineGenerate PipelineStage = "generate"
+	// PipelineValidate reviews, checks and repairs the fix and scans it for
+	// secrets.
+	PipelineValidate PipelineStage = "validate"
+	// PipelinePublish opens the fix's pull request or posts its analysis.
+	// The caller does this through Pipeline.Publish.
+	PipelinePublish PipelineStage = "publish"
+)
+
+// StageRun is the state of a pipeline run, which hooks may inspect and
+// change.
+type StageRun struct {
+	// Stage is the stage the hook runs around.
+	Stage       PipelineStage
+	Repo        *config.RepoMapping
+	Branch      string
+	ParsedError *webhook.ParsedError
+	// Request is what Claude is asked, set by PipelineIngest. Changing it
+	// before PipelineGenerate changes the prompt.
+	Request *tools.FixRequest
+	// Fix is set by PipelineGenerate.
+	Fix *ProposedFix
+}
+
+// StageHook is a custom step run before or after a pipeline stage, such as
+// an internal policy check. An error stops the run; return a
+// *tools.TransientError for failures worth retrying.
+type StageHook func(ctx context.Context, run *StageRun) error
+
+// HookError reports that a stage hook stopped a run.
+type HookError struct {
+	Stage PipelineStage
+	Hook  string
+	Err   error
+	// Usage is what generating the fix used, if the run got that far.
+	Usage Usage
+}
+
+func (e *HookError) Error() string {
+	return fmt.Sprintf("%s hook %s: %v", e.Stage, e.Hook, e.Err)
+}
+
+func (e *HookError) Unwrap() error {
+	return e.Err
+}
+
+type namedHook struct {
+	name string
+	hook StageHook
+}
+
+// stageHooks are the hooks of each stage.
+type stageHooks struct {
+	before, after map[PipelineStage][]namedHook
+}
+
+var (
+	hooksMu sync.RWMutex
+	hooks   = &stageHooks{}
+)
+
+// RegisterBeforeStage adds a hook, named name in errors, run before stage
+// in pipelines created afterwards. Hooks run in the order they were
+// registered.
+func RegisterBeforeStage(stage PipelineStage, name string, hook StageHook) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	addHook(&hooks.before, stage, name, hook)
+}
+
+// RegisterAfterStage adds a hook, named name in errors, run after stage
+// succeeds in pipelines created afterwards. Hooks run in the order they were
+// registered.
+func RegisterAfterStage(stage PipelineStage, name string, hook StageHook) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	addHook(&hooks.after, stage, name, hook)
+}
+
+// registeredHooks returns a copy of the registered hooks.
+func registeredHooks() *stageHooks {
+	hooksMu.RLock()
+	defer hooksMu.RUnlock()
+	c := &stageHooks{}
+	for stage, hs := range hooks.before {
+		for _, h := range hs {
+			addHook(&c.before, stage, h.name, h.hook)
+		}
+	}
+	for stage, hs := range hooks.after {
+		for _, h := range hs {
+			addHook(&c.after, stage, h.name, h.hook)
+		}
+	}
+	return c
+}
+
+func addHook(m *map[PipelineStage][]namedHook, stage PipelineStage, name string, hook StageHook) {
+	if *m == nil {
+		*m = make(map[PipelineStage][]namedHook)
+	}
+	(*m)[stage] = append((*m)[stage], namedHook{name, hook})
+}
+
+// run runs stage's before hooks, fn and its after hooks, stopping at the
+// first error.
+func (h *stageHooks) run(ctx context.Context, stage PipelineStage, run *StageRun, fn func(ctx context.Context) error) error {
+	run.Stage = stage
+	if err := runHooks(ctx, h.before[stage], run); err != nil {
+		return err
+	}
+	if err := fn(ctx); err != nil {
+		return err
+	}
+	return runHooks(ctx, h.after[stage], run)
+}
+
+func runHooks(ctx context.Context, hs []namedHook, run *StageRun) error {
+	for _, h := range hs {
+		if err := h.hook(ctx, run); err != nil {
+			hookErr := &HookError{Stage: run.Stage, Hook: h.name, Err: err}
+			if run.Fix != nil {
+				hookErr.Usage = run.Fix.Usage()
+			}
+			return hookErr
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/tools"
+)
+
+func TestStageHooks_Run(t *testing.T) {
+	var calls []string
+	hook := func(name string, err error) StageHook {
+		return func(ctx context.Context, run *StageRun) error {
+			calls = append(calls, name+" "+string(run.Stage))
+			return err
+		}
+	}
+	h := &stageHooks{}
+	addHook(&h.before, PipelineValidate, "first", hook("first", nil))
+	addHook(&h.before, PipelineValidate, "second", func(ctx context.Context, run *StageRun) error {
+		calls = append(calls, "second")
+		run.Fix.Description = "changed by hook"
+		return nil
+	})
+	addHook(&h.after, PipelineValidate, "after", hook("after", nil))
+	addHook(&h.before, PipelineGenerate, "unrelated", hook("unrelated", nil))
+
+	run := &StageRun{Fix: &ProposedFix{}}
+	err := h.run(context.Background(), PipelineValidate, run, func(ctx context.Context) error {
+		calls = append(calls, "stage "+run.Fix.Description)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	want := []string{"first validate", "second", "stage changed by hook", "after validate"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %q, want %q", calls, want)
+	}
+
+	t.Run("stage fails", func(t *testing.T) {
+		calls = nil
+		stageErr := errors.New("build failed")
+		err := h.run(context.Background(), PipelineValidate, &StageRun{Fix: &ProposedFix{}}, func(ctx context.Context) error { return stageErr })
+		if err != stageErr {
+			t.Errorf("run() error = %v, want the stage's", err)
+		}
+		if len(calls) != 2 {
+			t.Errorf("calls = %q, want only the before hooks", calls)
+		}
+	})
+
+	t.Run("hook stops the run", func(t *testing.T) {
+		calls = nil
+		h := &stageHooks{}
+		addHook(&h.after, PipelineGenerate, "policy", hook("policy", &tools.TransientError{Err: errors.New("policy service unavailable")}))
+		addHook(&h.after, PipelineGenerate, "never", hook("never", nil))
+
+		err := h.run(context.Background(), PipelineGenerate, &StageRun{Fix: &ProposedFix{CostUSD: 0.5}}, func(ctx context.Context) error { return nil })
+		var stopped *HookError
+		if !errors.As(err, &stopped) || stopped.Stage != PipelineGenerate || stopped.Hook != "policy" {
+			t.Fatalf("run() error = %v, want a *HookError from policy", err)
+		}
+		if stopped.Usage.CostUSD != 0.5 {
+			t.Errorf("Usage = %+v, want the fix's", stopped.Usage)
+		}
+		if !Retryable(err) {
+			t.Error("Retryable() = false for a transient hook error")
+		}
+		if len(calls) != 1 {
+			t.Errorf("calls = %q, want the run to stop at the failing hook", calls)
+		}
+	})
+}
@@ -0,0 +1,175 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/gitprovider"
+)
+
+// StaleLabel is added to bot PRs once a review reminder has been posted.
+const StaleLabel = "stale"
+
+// StalePolicy controls how unreviewed bot PRs are nudged and closed.
+// A zero duration disables the corresponding action.
+type StalePolicy struct {
+	NudgeAfter time.Duration
+	CloseAfter time.Duration
+}
+
+// Enabled reports whether the policy has any action configured.
+func (p StalePolicy) Enabled() bool {
+	return p.NudgeAfter > 0 || p.CloseAfter > 0
+}
+
+// SweepResult summarizes the actions taken by a stale PR sweep.
+type SweepResult struct {
+	Nudged int
+	Closed int
+}
+
+// SweepStalePullRequests nudges or closes bot PRs that have had no review or
+// comment from anyone but their author for longer than the policy allows.
+func SweepStalePullRequests(ctx context.Context, provider gitprovider.Provider, policy StalePolicy, now time.Time) (SweepResult, error) {
+	var result SweepResult
+
+	prs, err := provider.ListPullRequests(ctx, gitprovider.PullRequestQuery{State: "open", Label: AutoFixLabel})
+	if err != nil {
+		return result, err
+	}
+
+	for _, pr := range prs {
+		// Activity only makes a PR younger, so skip fetching it for new PRs
+		if !dueForAction(policy, pr, now.Sub(pr.CreatedAt)) {
+			continue
+		}
+		activity, err := loadActivity(ctx, provider, pr)
+		if err != nil {
+			return result, err
+		}
+		idle := now.Sub(activity.latest)
+		if !dueForAction(policy, pr, idle) {
+			continue // Humans are engaged, leave it alone
+		}
+		// The listing leaves out the branch and requested reviewers
+		full, err := provider.GetPullRequest(ctx, pr.Number)
+		if err != nil {
+			return result, err
+		}
+		pr = *full
+
+		if policy.CloseAfter > 0 && idle >= policy.CloseAfter {
+			if err := closeStalePullRequest(ctx, provider, pr, policy.CloseAfter); err != nil {
+				return result, err
+			}
+			result.Closed++
+			continue
+		}
+
+		if err := nudgeStalePullRequest(ctx, provider, pr, activity.reviewers, policy.NudgeAfter); err != nil {
+			return result, err
+		}
+		result.Nudged++
+	}
+
+	return result, nil
+}
+
+// prActivity is the human activity on a PR.
+type prActivity struct {
+	// latest is when the PR was opened or last reviewed or commented on by
+	// someone other than its author, whose reminders don't count.
+	latest time.Time
+	// reviewers are the users who reviewed the PR, in review order.
+	reviewers []string
+}
+
+// loadActivity fetches the reviews and comments of a PR.
+func loadActivity(ctx context.Context, provider gitprovider.Provider, pr gitprovider.PullRequest) (prActivity, error) {
+	activity := prActivity{latest: pr.CreatedAt}
+	seen := func(user string, at time.Time) {
+		if user != pr.Author && at.After(activity.latest) {
+			activity.latest = at
+		}
+	}
+
+	reviews, err := provider.ListReviews(ctx, pr.Number)
+	if err != nil {
+		return activity, err
+	}
+	for _, r := range reviews {
+		seen(r.User, r.SubmittedAt)
+		if r.User != "" && r.User != pr.Author && !slices.Contains(activity.reviewers, r.User) {
+			activity.reviewers = append(activity.reviewers, r.User)
+		}
+	}
+	reviewComments, err := provider.ListReviewComments(ctx, pr.Number)
+	if err != nil {
+		return activity, err
+	}
+	for _, c := range reviewComments {
+		seen(c.User, c.CreatedAt)
+	}
+	comments, err := provider.ListComments(ctx, pr.Number)
+	if err != nil {
+		return activity, err
+	}
+	for _, c := range comments {
+		seen(c.User, c.CreatedAt)
+	}
+	return activity, nil
+}
+
+// dueForAction reports whether a PR idle for so long should be nudged or
+// closed.
+func dueForAction(policy StalePolicy, pr gitprovider.PullRequest, idle time.Duration) bool {
+	if policy.CloseAfter > 0 && idle >= policy.CloseAfter {
+		return true
+	}
+	if policy.NudgeAfter > 0 && idle >= policy.NudgeAfter {
+		return !slices.Contains(pr.Labels, StaleLabel)
+	}
+	return false
+}
+
+// nudgeStalePullRequest posts a reminder, re-requests review and marks the PR
+// stale. Review is requested from the PR's pending reviewers or, if it has
+// none, from those who reviewed it before.
+func nudgeStalePullRequest(ctx context.Context, provider gitprovider.Provider, pr gitprovider.PullRequest, pastReviewers []string, after time.Duration) error {
+	body := fmt.Sprintf("👋 This automated fix has been waiting for review for %d days. "+
+		"Please take a look, or close it if the fix is not wanted.", days(after))
+	if err := provider.AddComment(ctx, pr.Number, body); err != nil {
+		return err
+	}
+
+	reviewers := pr.Reviewers
+	if len(reviewers) == 0 {
+		reviewers = pastReviewers
+	}
+	if len(reviewers) > 0 {
+		if err := provider.RequestReviewers(ctx, pr.Number, reviewers); err != nil {
+			// Non-fatal, the reminder comment has already been posted
+			log.Printf("warning: failed to re-request review on PR #%d: %v", pr.Number, err)
+		}
+	}
+
+	return provider.AddLabels(ctx, pr.Number, []string{StaleLabel})
+}
+
+// closeStalePullRequest closes a PR with a summary comment explaining why.
+func closeStalePullRequest(ctx context.Context, provider gitprovider.Provider, pr gitprovider.PullRequest, after time.Duration) error {
+	body := fmt.Sprintf("🧹 Closing this automated fix after %d days without review.\n\n"+
+		"**%s** proposed changes on `%s`. The underlying Sentry issue may still need attention; "+
+		"reopen this PR if you would like to pick the fix back up.", days(after), pr.Title, pr.Head)
+	if err := provider.AddComment(ctx, pr.Number, body); err != nil {
+		return err
+	}
+	return provider.ClosePullRequest(ctx, pr.Number)
+}
+
+func days(d time.Duration) int {
+	return int(d / (24 * time.Hour))
+}
@@ -0,0 +1,267 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/gitprovider"
+)
+
+func TestSweepStalePullRequests(t *testing.T) {
+	now := time.Date(2024, 6, 30, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	policy := StalePolicy{NudgeAfter: 7 * day, CloseAfter: 14 * day}
+
+	provider := &fakeProvider{
+		prs: []gitprovider.PullRequest{
+			{Number: 1, Author: "autopr", CreatedAt: now.Add(-2 * day)},
+			{Number: 2, Author: "autopr", CreatedAt: now.Add(-8 * day), Reviewers: []string{"alice"}},
+			{Number: 3, Author: "autopr", CreatedAt: now.Add(-9 * day), Labels: []string{AutoFixLabel, StaleLabel}},
+			{Number: 4, Author: "autopr", CreatedAt: now.Add(-15 * day), Labels: []string{AutoFixLabel, StaleLabel}},
+			{Number: 5, Author: "autopr", CreatedAt: now.Add(-20 * day)},
+			{Number: 6, Author: "autopr", CreatedAt: now.Add(-20 * day)},
+			{Number: 7, Author: "autopr", CreatedAt: now.Add(-20 * day)},
+			{Number: 8, Author: "autopr", CreatedAt: now.Add(-20 * day)},
+			{Number: 9, Author: "autopr", CreatedAt: now.Add(-20 * day)},
+			{Number: 10, Author: "autopr", CreatedAt: now.Add(-20 * day)},
+		},
+		reviews: map[int][]gitprovider.Review{
+			5: {{User: "bob", State: "COMMENTED", SubmittedAt: now.Add(-2 * day)}},
+			6: {{User: "bob", State: "COMMENTED", SubmittedAt: now.Add(-16 * day)}},
+			10: {
+				{User: "bob", State: "CHANGES_REQUESTED", SubmittedAt: now.Add(-12 * day)},
+				{User: "autopr", State: "COMMENTED", SubmittedAt: now.Add(-11 * day)},
+				{User: "bob", State: "COMMENTED", SubmittedAt: now.Add(-10 * day)},
+			},
+		},
+		reviewComments: map[int][]gitprovider.ReviewComment{
+			7: {{User: "bob", Path: "app.py", CreatedAt: now.Add(-3 * day)}},
+		},
+		prComments: map[int][]gitprovider.Comment{
+			8: {{User: "carol", Body: "Looking into this", CreatedAt: now.Add(-day)}},
+			9: {{User: "autopr", Body: "Waiting for review", CreatedAt: now.Add(-day)}},
+		},
+	}
+
+	result, err := SweepStalePullRequests(context.Background(), provider, policy, now)
+	if err != nil {
+		t.Fatalf("SweepStalePullRequests() error = %v", err)
+	}
+
+	if result.Nudged != 2 || result.Closed != 3 {
+		t.Errorf("result = %+v, want 2 nudged and 3 closed", result)
+	}
+
+	if got := provider.comments[2]; len(got) != 1 {
+		t.Errorf("PR #2 comments = %d, want 1 reminder", len(got))
+	}
+	if got := provider.labels[2]; len(got) != 1 || got[0] != StaleLabel {
+		t.Errorf("PR #2 labels added = %v, want [%s]", got, StaleLabel)
+	}
+	if got := provider.requested[2]; len(got) != 1 || got[0] != "alice" {
+		t.Errorf("PR #2 re-requested reviewers = %v, want [alice]", got)
+	}
+	// Without pending reviewers, earlier reviewers are asked again
+	if got := provider.requested[10]; len(got) != 1 || got[0] != "bob" {
+		t.Errorf("PR #10 re-requested reviewers = %v, want [bob]", got)
+	}
+
+	// Old activity doesn't keep a PR open, nor do the author's own comments
+	for _, n := range []int{4, 6, 9} {
+		if !provider.closed[n] {
+			t.Errorf("PR #%d should have been closed", n)
+		}
+	}
+	for _, n := range []int{1, 3, 5, 7, 8} {
+		if len(provider.comments[n]) > 0 || provider.closed[n] {
+			t.Errorf("PR #%d should not have been touched", n)
+		}
+	}
+}
+
+func TestStalePolicy_Enabled(t *testing.T) {
+	if (StalePolicy{}).Enabled() {
+		t.Error("zero policy should be disabled")
+	}
+	if !(StalePolicy{CloseAfter: time.Hour}).Enabled() {
+		t.Error("policy with CloseAfter should be enabled")
+	}
+}
+
+// fakeProvider is an in-memory gitprovider.Provider for tests.
+type fakeProvider struct {
+	prs            []gitprovider.PullRequest
+	searches       []string
+	reviews        map[int][]gitprovider.Review
+	reviewComments map[int][]gitprovider.ReviewComment
+	prComments     map[int][]gitprovider.Comment
+	prFiles        map[int][]gitprovider.PullRequestFile
+	files          map[string]string // path -> content served by FetchFile
+	history        map[string][]gitprovider.Commit
+	createdReviews map[int][]gitprovider.ReviewRequest
+	advisories     []gitprovider.AdvisoryRequest
+	createdPRs     []gitprovider.PRRequest
+	issues         []gitprovider.IssueRequest
+	comments       map[int][]string
+	labels         map[int][]string
+	requested      map[int][]string
+	closed         map[int]bool
+}
+
+func (f *fakeProvider) FetchFile(ctx context.Context, path, ref string) (*gitprovider.FileContent, error) {
+	content, ok := f.files[path]
+	if !ok {
+		return nil, fmt.Errorf("file %s not found", path)
+	}
+	return &gitprovider.FileContent{Path: path, Content: content}, nil
+}
+
+func (f *fakeProvider) FileHistory(ctx context.Context, path, ref string, limit int) ([]gitprovider.Commit, error) {
+	commits := f.history[path]
+	if len(commits) > limit {
+		commits = commits[:limit]
+	}
+	return commits, nil
+}
+
+func (f *fakeProvider) SearchCode(ctx context.Context, query string) ([]gitprovider.SearchResult, error) {
+	return nil, nil
+}
+
+func (f *fakeProvider) ListDirectory(ctx context.Context, path, ref string) ([]gitprovider.DirEntry, error) {
+	return nil, nil
+}
+
+func (f *fakeProvider) GetDefaultBranch(ctx context.Context) (string, error) {
+	return "main", nil
+}
+
+func (f *fakeProvider) GetLatestCommitSHA(ctx context.Context, branch string) (string, error) {
+	return "abc123", nil
+}
+
+func (f *fakeProvider) CreateBranch(ctx context.Context, name, baseSHA string) error {
+	return nil
+}
+
+func (f *fakeProvider) DeleteBranch(ctx context.Context, name string) error {
+	return nil
+}
+
+func (f *fakeProvider) CommitFiles(ctx context.Context, branch string, files []gitprovider.FileChange, message string) (string, error) {
+	return "def456", nil
+}
+
+func (f *fakeProvider) CreatePullRequest(ctx context.Context, req gitprovider.PRRequest) (*gitprovider.PRResponse, error) {
+	f.createdPRs = append(f.createdPRs, req)
+	return &gitprovider.PRResponse{Number: len(f.createdPRs), HTMLURL: "https://github.com/owner/repo/pull/1"}, nil
+}
+
+func (f *fakeProvider) ListPullRequests(ctx context.Context, q gitprovider.PullRequestQuery) ([]gitprovider.PullRequest, error) {
+	var prs []gitprovider.PullRequest
+	for _, pr := range f.prs {
+		if !q.UpdatedSince.IsZero() && !pr.UpdatedAt.After(q.UpdatedSince) {
+			continue
+		}
+		if q.Label != "" {
+			// Like GitHub's issues API, which lists labeled PRs
+			pr.Head, pr.Reviewers = "", nil
+		}
+		prs = append(prs, pr)
+	}
+	return prs, nil
+}
+
+func (f *fakeProvider) GetPullRequest(ctx context.Context, number int) (*gitprovider.PullRequest, error) {
+	for _, pr := range f.prs {
+		if pr.Number == number {
+			return &pr, nil
+		}
+	}
+	return nil, fmt.Errorf("PR #%d not found", number)
+}
+
+func (f *fakeProvider) SearchPullRequests(ctx context.Context, query string) ([]gitprovider.PullRequest, error) {
+	f.searches = append(f.searches, query)
+	return f.prs, nil
+}
+
+func (f *fakeProvider) ListReviews(ctx context.Context, number int) ([]gitprovider.Review, error) {
+	return f.reviews[number], nil
+}
+
+func (f *fakeProvider) ListReviewComments(ctx context.Context, number int) ([]gitprovider.ReviewComment, error) {
+	return f.reviewComments[number], nil
+}
+
+func (f *fakeProvider) ListComments(ctx context.Context, number int) ([]gitprovider.Comment, error) {
+	return f.prComments[number], nil
+}
+
+func (f *fakeProvider) ListPullRequestFiles(ctx context.Context, number int) ([]gitprovider.PullRequestFile, error) {
+	return f.prFiles[number], nil
+}
+
+func (f *fakeProvider) CreateReview(ctx context.Context, number int, req gitprovider.ReviewRequest) error {
+	if f.createdReviews == nil {
+		f.createdReviews = make(map[int][]gitprovider.ReviewRequest)
+	}
+	f.createdReviews[number] = append(f.createdReviews[number], req)
+	return nil
+}
+
+func (f *fakeProvider) AddComment(ctx context.Context, number int, body string) error {
+	if f.comments == nil {
+		f.comments = make(map[int][]string)
+	}
+	f.comments[number] = append(f.comments[number], body)
+	return nil
+}
+
+func (f *fakeProvider) AddLabels(ctx context.Context, number int, labels []string) error {
+	if f.labels == nil {
+		f.labels = make(map[int][]string)
+	}
+	f.labels[number] = append(f.labels[number], labels...)
+	return nil
+}
+
+func (f *fakeProvider) RequestReviewers(ctx context.Context, number int, reviewers []string) error {
+	if f.requested == nil {
+		f.requested = make(map[int][]string)
+	}
+	f.requested[number] = append(f.requested[number], reviewers...)
+	return nil
+}
+
+func (f *fakeProvider) ClosePullRequest(ctx context.Context, number int) error {
+	if f.closed == nil {
+		f.closed = make(map[int]bool)
+	}
+	f.closed[number] = true
+	return nil
+}
+
+func (f *fakeProvider) CreateIssue(ctx context.Context, req gitprovider.IssueRequest) (*gitprovider.IssueResponse, error) {
+	f.issues = append(f.issues, req)
+	return &gitprovider.IssueResponse{Number: len(f.issues), HTMLURL: fmt.Sprintf("https://github.com/owner/repo/issues/%d", len(f.issues))}, nil
+}
+
+func (f *fakeProvider) CreateSecurityAdvisory(ctx context.Context, req gitprovider.AdvisoryRequest) (*gitprovider.Advisory, error) {
+	f.advisories = append(f.advisories, req)
+	return &gitprovider.Advisory{GHSAID: "GHSA-xxxx-yyyy-zzzz", HTMLURL: "https://github.com/owner/repo/security/advisories/GHSA-xxxx-yyyy-zzzz"}, nil
+}
+
+func (f *fakeProvider) CreatePrivateFork(ctx context.Context, ghsaID string) (string, string, error) {
+	return "owner", "repo-ghsa-xxxx-yyyy-zzzz", nil
+}
+
+func (f *fakeProvider) CheckCapabilities(ctx context.Context) (*gitprovider.Capabilities, error) {
+	return &gitprovider.Capabilities{ReadContents: true, CreateRefs: true, OpenPRs: true}, nil
+}
+
+func (f *fakeProvider) Owner() string { return "owner" }
+
+func (f *fakeProvider) Repo() string { return "repo" }
@@ -0,0 +1,187 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/gitprovider"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/webhook"
+)
+
+// FindHumanPullRequest returns an open, non-bot PR in the same repository that
+// references the Sentry issue, or nil if there is none.
+func FindHumanPullRequest(ctx context.Context, provider gitprovider.Provider, parsedError *webhook.ParsedError) (*gitprovider.PullRequest, error) {
+	prs, err := provider.ListPullRequests(ctx, gitprovider.PullRequestQuery{State: "open"})
+	if err != nil {
+		return nil, err
+	}
+
+	repo := provider.Owner() + "/" + provider.Repo()
+	for i := range prs {
+		pr := &prs[i]
+		if slices.Contains(pr.Labels, AutoFixLabel) {
+			continue
+		}
+		// Suggestions are generated from a clone of this repository, so the
+		// head branch has to live here rather than in a fork
+		if pr.HeadRepo != repo {
+			continue
+		}
+		if referencesIssue(pr.Title+"\n"+pr.Body, parsedError) {
+			return pr, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// referencesIssue reports whether text mentions the Sentry issue by short ID,
+// permalink or issue URL.
+func referencesIssue(text string, parsedError *webhook.ParsedError) bool {
+	if parsedError.Permalink != "" && strings.Contains(text, parsedError.Permalink) {
+		return true
+	}
+	if parsedError.IssueID != "" && strings.Contains(text, "/issues/"+parsedError.IssueID+"/") {
+		return true
+	}
+	if parsedError.ShortID != "" {
+		re := regexp.MustCompile(`\b` + regexp.QuoteMeta(parsedError.ShortID) + `\b`)
+		return re.MatchString(text)
+	}
+	return false
+}
+
+// SuggestOnPullRequest reviews a human PR with the proposed fix as GitHub
+// suggestion blocks. Changes outside the PR's diff are included in the review
+// body instead. It returns the number of inline suggestions posted.
+func SuggestOnPullRequest(ctx context.Context, provider gitprovider.Provider, pr *gitprovider.PullRequest, parsedError *webhook.ParsedError, fix *ProposedFix) (int, error) {
+	prFiles, err := provider.ListPullRequestFiles(ctx, pr.Number)
+	if err != nil {
+		return 0, err
+	}
+	patches := make(map[string]string, len(prFiles))
+	for _, f := range prFiles {
+		patches[f.Path] = f.Patch
+	}
+
+	var comments []gitprovider.DraftReviewComment
+	var outOfDiff strings.Builder
+
+	for _, f := range fix.Files {
+		patch, inPR := patches[f.Path]
+		if !inPR || f.ChangeType != "modify" {
+			fmt.Fprintf(&outOfDiff, "\n**`%s`** (%s, outside this PR's diff)\n", f.Path, changeTypeOrModify(f.ChangeType))
+			continue
+		}
+
+		current, err := provider.FetchFile(ctx, f.Path, pr.HeadSHA)
+		if err != nil {
+			return 0, err
+		}
+		old := splitLines(current.Content)
+		commentable := commentableLines(patch)
+
+		for _, h := range diffLines(old, splitLines(f.Content)) {
+			c, ok := suggestionComment(f.Path, old, h, commentable)
+			if ok {
+				comments = append(comments, c)
+				continue
+			}
+			fmt.Fprintf(&outOfDiff, "\n**`%s`** around line %d (outside this PR's diff):\n```diff\n%s```\n",
+				f.Path, max(h.OldStart, 1), hunkDiff(old, h))
+		}
+	}
+
+	if len(comments) == 0 && outOfDiff.Len() == 0 {
+		return 0, fmt.Errorf("proposed fix makes no changes relative to PR #%d", pr.Number)
+	}
+
+	body := fmt.Sprintf("🤖 This PR references Sentry issue %s, so SentryAgent is suggesting its fix here instead of opening a separate PR.\n\n%s",
+		issueRef(parsedError), fix.Description)
+	if outOfDiff.Len() > 0 {
+		body += "\n\n### Additional changes\n" + outOfDiff.String()
+	}
+
+	err = provider.CreateReview(ctx, pr.Number, gitprovider.ReviewRequest{
+		CommitSHA: pr.HeadSHA,
+		Body:      body,
+		Comments:  comments,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(comments), nil
+}
+
+// suggestionComment turns a hunk into an inline suggestion if every line it
+// anchors on is part of the PR diff.
+func suggestionComment(path string, old []string, h lineHunk, commentable map[int]bool) (gitprovider.DraftReviewComment, bool) {
+	start, end := h.OldStart, h.OldEnd
+	lines := h.NewLines
+
+	// Suggestions replace existing lines, so anchor pure insertions on a neighbour
+	if end < start {
+		switch {
+		case end >= 1:
+			start = end
+			lines = append([]string{old[end-1]}, lines...)
+		case len(old) > 0:
+			end = start
+			lines = append(append([]string{}, lines...), old[0])
+		default:
+			return gitprovider.DraftReviewComment{}, false
+		}
+	}
+
+	for l := start; l <= end; l++ {
+		if !commentable[l] {
+			return gitprovider.DraftReviewComment{}, false
+		}
+	}
+
+	body := "```suggestion\n"
+	if len(lines) > 0 {
+		body += strings.Join(lines, "\n") + "\n"
+	}
+	body += "```"
+
+	c := gitprovider.DraftReviewComment{Path: path, Line: end, Body: body}
+	if start < end {
+		c.StartLine = start
+	}
+	return c, true
+}
+
+// hunkDiff renders a hunk as unified-diff lines.
+func hunkDiff(old []string, h lineHunk) string {
+	var sb strings.Builder
+	for l := h.OldStart; l <= h.OldEnd; l++ {
+		sb.WriteString("-" + old[l-1] + "\n")
+	}
+	for _, l := range h.NewLines {
+		sb.WriteString("+" + l + "\n")
+	}
+	return sb.String()
+}
+
+func issueRef(parsedError *webhook.ParsedError) string {
+	name := parsedError.ShortID
+	if name == "" {
+		name = parsedError.IssueID
+	}
+	if parsedError.Permalink == "" {
+		return name
+	}
+	return fmt.Sprintf("[%s](%s)", name, parsedError.Permalink)
+}
+
+func changeTypeOrModify(changeType string) string {
+	if changeType == "" {
+		return "modify"
+	}
+	return changeType
+}
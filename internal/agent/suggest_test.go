@@ -0,0 +1,69 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/gitprovider"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/webhook"
+)
+
+func TestFindHumanPullRequest(t *testing.T) {
+	parsed := &webhook.ParsedError{IssueID: "42", ShortID: "API-7"}
+	provider := &fakeProvider{
+		prs: []gitprovider.PullRequest{
+			{Number: 1, Title: "Fix API-7", HeadRepo: "owner/repo", Labels: []string{AutoFixLabel}},
+			{Number: 2, Title: "Fix API-7", HeadRepo: "someone/fork"},
+			{Number: 3, Title: "Fix API-70", HeadRepo: "owner/repo"},
+			{Number: 4, Body: "Fixes API-7.", HeadRepo: "owner/repo"},
+		},
+	}
+
+	pr, err := FindHumanPullRequest(context.Background(), provider, parsed)
+	if err != nil {
+		t.Fatalf("FindHumanPullRequest() error = %v", err)
+	}
+	if pr == nil || pr.Number != 4 {
+		t.Fatalf("FindHumanPullRequest() = %+v, want PR #4", pr)
+	}
+}
+
+func TestSuggestOnPullRequest(t *testing.T) {
+	provider := &fakeProvider{
+		files: map[string]string{
+			"app.go": "package app\n\nfunc Load(u *User) string {\n\treturn u.Name\n}\n",
+		},
+		prFiles: map[int][]gitprovider.PullRequestFile{
+			9: {{Path: "app.go", Patch: "@@ -3,2 +3,3 @@\n func Load(u *User) string {\n+\t// load\n \treturn u.Name"}},
+		},
+	}
+	pr := &gitprovider.PullRequest{Number: 9, HeadSHA: "abc"}
+	fix := &ProposedFix{
+		Description: "Guard against nil users",
+		Files: []FileChange{
+			{Path: "app.go", ChangeType: "modify", Content: "package app\n\nfunc Load(u *User) string {\n\tif u == nil {\n\t\treturn \"\"\n\t}\n\treturn u.Name\n}\n"},
+			{Path: "user.go", ChangeType: "modify", Content: "package app\n"},
+		},
+	}
+
+	n, err := SuggestOnPullRequest(context.Background(), provider, pr, &webhook.ParsedError{ShortID: "API-7"}, fix)
+	if err != nil {
+		t.Fatalf("SuggestOnPullRequest() error = %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("inline suggestions = %d, want 1", n)
+	}
+
+	review := provider.createdReviews[9][0]
+	c := review.Comments[0]
+	if c.Path != "app.go" || c.Line != 3 {
+		t.Errorf("suggestion anchored at %s:%d, want app.go:3", c.Path, c.Line)
+	}
+	if !strings.Contains(c.Body, "```suggestion\nfunc Load(u *User) string {\n\tif u == nil {") {
+		t.Errorf("suggestion body = %q", c.Body)
+	}
+	if !strings.Contains(review.Body, "`user.go`") {
+		t.Errorf("review body should mention changes outside the diff: %q", review.Body)
+	}
+}
@@ -0,0 +1,224 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/config"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/tools"
+)
+
+// Checks run against a fix before it is proposed.
+const (
+	CheckBuild      = "build"
+	CheckRegression = "regression test"
+	CheckTests      = "tests"
+)
+
+// CheckFailedError reports that the repository failed to build or its tests
+// failed with the fix applied, or that the fix's regression test passed
+// without it.
+type CheckFailedError struct {
+	// Check is CheckBuild, CheckRegression or CheckTests.
+	Check   string
+	Command string
+	// Output is the end of the command's output.
+	Output string
+	// WithoutFix is set when the regression test passed without the fix,
+	// so it does not reproduce the error.
+	WithoutFix bool
+	// Usage is what generating the rejected fix used.
+	Usage Usage
+}
+
+func (e *CheckFailedError) Error() string {
+	if e.WithoutFix {
+		return fmt.Sprintf("%s passed without the fix, so it does not reproduce the error (%s)", e.Check, e.Command)
+	}
+	return fmt.Sprintf("%s failed with the fix applied (%s)", e.Check, e.Command)
+}
+
+// verifyFix checks fix in a checkout of branch; see checkFix.
+func (p *Pipeline) verifyFix(ctx context.Context, repo *config.RepoMapping, branch, token string, fix *ProposedFix) error {
+	repoURL := fmt.Sprintf("https://github.com/%s.git", repo.FullName())
+	dir, release, err := p.workspaces.Checkout(ctx, repoURL, token, branch, tools.CloneOptions{Depth: p.cloneDepth})
+	if err != nil {
+		return fmt.Errorf("failed to check out repo to verify fix: %w", err)
+	}
+	defer release()
+	return p.checkFix(ctx, dir, repo, fix)
+}
+
+// checkFix applies fix to the checkout at dir and formats the changed files
+// with repo.FormatCommand, updating fix. It then builds the checkout with
+// repo.BuildCommand and runs the fix's regression test, with
+// repo.RegressionTestCommand, and repo.TestCommand in it. Finally it
+// confirms the regression test fails with only the test applied. It returns a *CheckFailedError if any check fails.
+func (p *Pipeline) checkFix(ctx context.Context, dir string, repo *config.RepoMapping, fix *ProposedFix) error {
+	files := make([]tools.FileChange, len(fix.Files))
+	for i, f := range fix.Files {
+		files[i] = tools.FileChange{Path: f.Path, Content: f.Content, ChangeType: f.ChangeType, Test: f.Test}
+	}
+	original, err := tools.Snapshot(dir, files)
+	if err != nil {
+		return err
+	}
+	if err := tools.ApplyChanges(dir, files); err != nil {
+		return err
+	}
+	if repo.FormatCommand != "" {
+		if err := p.formatFix(ctx, dir, repo, files, fix); err != nil {
+			return err
+		}
+	}
+
+	build := repo.BuildCommand
+	if build == config.BuildCommandAuto {
+		if build = tools.DetectBuildCommand(dir, files); build == "" {
+			log.Printf("No build check found for %s", repo.FullName())
+		}
+	}
+	if build != "" {
+		if err := p.runCheck(ctx, dir, CheckBuild, build, fix); err != nil {
+			return err
+		}
+	}
+	regression, err := regressionCommand(repo, files, fix)
+	if err != nil {
+		return err
+	}
+	if regression != "" {
+		if err := p.runCheck(ctx, dir, CheckRegression, regression, fix); err != nil {
+			return err
+		}
+	}
+	if repo.TestCommand != "" {
+		if err := p.runCheck(ctx, dir, CheckTests, repo.TestCommand, fix); err != nil {
+			return err
+		}
+	}
+	if regression != "" {
+		return p.reproduceError(ctx, dir, original, regression, fix)
+	}
+	return nil
+}
+
+// regressionCommand returns the command running the regression test among
+// files, the changes of fix, or "" if the fix adds none or the repository
+// doesn't run them. A test the command can't be filled in for fails the
+// check, so that a repair can select it properly.
+func regressionCommand(repo *config.RepoMapping, files []tools.FileChange, fix *ProposedFix) (string, error) {
+	if repo.SkipRegressionTests || !fix.hasTest() {
+		return "", nil
+	}
+	if repo.RegressionTestCommand == "" {
+		log.Printf("No regression test command for %s, not running the fix's test", repo.FullName())
+		return "", nil
+	}
+	command, err := tools.RegressionTestCommand(repo.RegressionTestCommand, files, fix.TestFilter)
+	if err != nil {
+		return "", &CheckFailedError{Check: CheckRegression, Command: repo.RegressionTestCommand, Output: err.Error(), Usage: fix.Usage()}
+	}
+	return command, nil
+}
+
+// reproduceError reverts everything but the regression test in the checkout
+// at dir to original and confirms command, running the test, fails there.
+func (p *Pipeline) reproduceError(ctx context.Context, dir string, original []tools.FileChange, command string, fix *ProposedFix) error {
+	var revert []tools.FileChange
+	for _, f := range original {
+		if !f.Test {
+			revert = append(revert, f)
+		}
+	}
+	if len(revert) == len(original) {
+		log.Printf("Regression test files are not marked, cannot check the test reproduces the error")
+		return nil
+	}
+	if err := tools.ApplyChanges(dir, revert); err != nil {
+		return err
+	}
+
+	err := p.runCheck(ctx, dir, CheckRegression, command, fix)
+	var failed *CheckFailedError
+	switch {
+	case err == nil:
+		return &CheckFailedError{Check: CheckRegression, Command: command, WithoutFix: true, Usage: fix.Usage()}
+	case errors.As(err, &failed):
+		log.Printf("Regression test fails without the fix, as it should")
+		return nil
+	default:
+		return err
+	}
+}
+
+// formatFix runs the repository's formatter on the changed files in the
+// checkout at dir and takes their formatted content into fix. A formatter
+// that fails leaves the files as Claude wrote them.
+func (p *Pipeline) formatFix(ctx context.Context, dir string, repo *config.RepoMapping, files []tools.FileChange, fix *ProposedFix) error {
+	command := tools.FormatCommand(repo.FormatCommand, files)
+	if repo.FormatCommand == config.FormatCommandAuto {
+		command = tools.DetectFormatCommand(dir, files)
+	}
+	if command == "" {
+		return nil
+	}
+
+	formatCtx := ctx
+	if p.testTimeout > 0 {
+		var cancel context.CancelFunc
+		formatCtx, cancel = context.WithTimeout(ctx, p.testTimeout)
+		defer cancel()
+	}
+
+	log.Printf("Formatting changes: %s", command)
+	output, err := tools.RunCommand(formatCtx, dir, command, p.checks)
+	if err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		log.Printf("Formatter failed, keeping changes unformatted: %v\n%s", err, output)
+		// Undo whatever the formatter managed before failing
+		return tools.ApplyChanges(dir, files)
+	}
+
+	if err := tools.ReadChanges(dir, files); err != nil {
+		return err
+	}
+	for i, f := range files {
+		fix.Files[i].Content = f.Content
+	}
+	return nil
+}
+
+// runCheck runs command in the checkout at dir, which has fix applied.
+func (p *Pipeline) runCheck(ctx context.Context, dir, check, command string, fix *ProposedFix) error {
+	checkCtx := ctx
+	if p.testTimeout > 0 {
+		var cancel context.CancelFunc
+		checkCtx, cancel = context.WithTimeout(ctx, p.testTimeout)
+		defer cancel()
+	}
+
+	log.Printf("Running %s: %s", check, command)
+	output, err := tools.RunCommand(checkCtx, dir, command, p.checks)
+	var exit *exec.ExitError
+	switch {
+	case err == nil:
+		log.Printf("Fix passed %s", check)
+		return nil
+	case ctx.Err() != nil:
+		return err
+	case errors.Is(err, context.DeadlineExceeded):
+		output += fmt.Sprintf("\n[%s timed out after %s]", check, p.testTimeout)
+		fallthrough
+	case errors.As(err, &exit), errors.Is(err, tools.ErrOutputLimit):
+		log.Printf("Fix failed %s: %v", check, err)
+		return &CheckFailedError{Check: check, Command: command, Output: output, Usage: fix.Usage()}
+	default:
+		return fmt.Errorf("failed to run %s: %w", check, err)
+	}
+}
@@ -0,0 +1,213 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/config"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/tools"
+)
+
+func TestPipeline_RunCheck(t *testing.T) {
+	fix := &ProposedFix{CostUSD: 0.5}
+
+	tests := []struct {
+		name       string
+		command    string
+		wantFailed bool
+		wantOutput string
+	}{
+		{name: "passing", command: "true"},
+		{name: "failing", command: "echo 1 failed; exit 1", wantFailed: true, wantOutput: "1 failed"},
+		{name: "timed out", command: "echo started; sleep 5", wantFailed: true, wantOutput: "started\n[build timed out after 200ms]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Pipeline{testTimeout: 200 * time.Millisecond}
+			err := p.runCheck(context.Background(), t.TempDir(), CheckBuild, tt.command, fix)
+
+			var failed *CheckFailedError
+			if errors.As(err, &failed) != tt.wantFailed {
+				t.Fatalf("runCheck() error = %v, want failure %v", err, tt.wantFailed)
+			}
+			if !tt.wantFailed {
+				if err != nil {
+					t.Errorf("runCheck() error = %v", err)
+				}
+				return
+			}
+			if !strings.Contains(failed.Output, tt.wantOutput) || failed.Usage.CostUSD != 0.5 || failed.Command != tt.command || failed.Check != CheckBuild {
+				t.Errorf("runCheck() = %+v", failed)
+			}
+			if Retryable(err) {
+				t.Error("failed checks must not be retried")
+			}
+		})
+	}
+}
+
+func TestPipeline_FormatFix(t *testing.T) {
+	dir := t.TempDir()
+	// Upper-cases the files it is given
+	script := "#!/bin/sh\n[ \"$1\" = -- ] && shift\nfor f; do tr a-z A-Z < \"$f\" > \"$f.tmp\" && mv \"$f.tmp\" \"$f\"; done\n"
+	os.WriteFile(filepath.Join(dir, "fmt.sh"), []byte(script), 0o755)
+
+	tests := []struct {
+		name    string
+		command string
+		want    string
+	}{
+		{name: "formatted", command: "./fmt.sh", want: "FIXED\n"},
+		{name: "formatter failed", command: "./fmt.sh app.py; false", want: "fixed\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fix := &ProposedFix{Files: []FileChange{{Path: "app.py", Content: "fixed\n", ChangeType: "modify"}}}
+			files := []tools.FileChange{{Path: "app.py", Content: "fixed\n", ChangeType: "modify"}}
+			if err := tools.ApplyChanges(dir, files); err != nil {
+				t.Fatal(err)
+			}
+
+			p := &Pipeline{}
+			repo := &config.RepoMapping{FormatCommand: tt.command}
+			if err := p.formatFix(context.Background(), dir, repo, files, fix); err != nil {
+				t.Fatalf("formatFix() error = %v", err)
+			}
+			if fix.Files[0].Content != tt.want {
+				t.Errorf("fix content = %q, want %q", fix.Files[0].Content, tt.want)
+			}
+			if data, _ := os.ReadFile(filepath.Join(dir, "app.py")); string(data) != tt.want {
+				t.Errorf("checkout content = %q, want %q", data, tt.want)
+			}
+		})
+	}
+}
+
+func TestPipeline_CheckFix_RegressionTest(t *testing.T) {
+	const test = "sh app.sh\n"
+
+	tests := []struct {
+		name           string
+		command        string
+		filter         string
+		fixed          string
+		test           string
+		skip           bool
+		wantWithoutFix bool
+		wantFailed     bool
+	}{
+		{name: "reproduces the error", command: "sh {files}", fixed: "exit 0\n", test: test},
+		{name: "skipped", command: "sh {files}", fixed: "exit 1 # still broken\n", test: test, skip: true},
+		{name: "no command", fixed: "exit 1 # still broken\n", test: test},
+		{name: "fails with the fix", command: "sh {files}", fixed: "exit 1 # still broken\n", test: test, wantFailed: true},
+		{name: "passes without the fix", command: "sh {files}", fixed: "exit 0\n", test: "true\n", wantFailed: true, wantWithoutFix: true},
+		{name: "filter", command: "sh {files} {filter}", filter: "a b", fixed: "exit 0\n", test: "[ \"$1\" = 'a b' ] && " + test},
+		{name: "missing filter", command: "sh {files} {filter}", fixed: "exit 0\n", test: test, wantFailed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			os.WriteFile(filepath.Join(dir, "app.sh"), []byte("exit 1\n"), 0o644)
+			fix := &ProposedFix{
+				Files: []FileChange{
+					{Path: "app.sh", Content: tt.fixed, ChangeType: "modify"},
+					{Path: "test_app.sh", Content: tt.test, ChangeType: "create", Test: true},
+				},
+				TestFilter: tt.filter,
+			}
+
+			p := &Pipeline{}
+			repo := &config.RepoMapping{Owner: "org", Repo: "app", RegressionTestCommand: tt.command, SkipRegressionTests: tt.skip}
+			err := p.checkFix(context.Background(), dir, repo, fix)
+
+			var failed *CheckFailedError
+			if errors.As(err, &failed) != tt.wantFailed {
+				t.Fatalf("checkFix() error = %v, want failure %v", err, tt.wantFailed)
+			}
+			if !tt.wantFailed && err != nil {
+				t.Fatalf("checkFix() error = %v", err)
+			}
+			if tt.wantFailed && (failed.Check != CheckRegression || failed.WithoutFix != tt.wantWithoutFix) {
+				t.Errorf("checkFix() = %+v", failed)
+			}
+		})
+	}
+}
+
+func TestPipeline_RefineFix_Repair(t *testing.T) {
+	repaired := &tools.FixResponse{
+		Success: true,
+		Files:   []tools.FileChange{{Path: "app.py", Content: "repaired\n", ChangeType: "modify"}},
+		CostUSD: 1,
+	}
+
+	tests := []struct {
+		name         string
+		attempts     int
+		failures     int
+		wantErr      bool
+		wantVerified int
+		wantCost     float64
+	}{
+		{name: "passes", attempts: 2, wantVerified: 1, wantCost: 0.5},
+		{name: "repaired", attempts: 2, failures: 1, wantVerified: 2, wantCost: 1.5},
+		{name: "out of attempts", attempts: 1, failures: 2, wantErr: true, wantVerified: 2, wantCost: 1.5},
+		{name: "no repairs", failures: 1, wantErr: true, wantVerified: 1, wantCost: 0.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gen := &fakeReviewer{fixes: []*tools.FixResponse{repaired}}
+			p := &Pipeline{generator: gen, repairAttempts: tt.attempts}
+			req := &tools.FixRequest{IssueID: "1"}
+			fix := &ProposedFix{
+				Files:   []FileChange{{Path: "app.py", Content: "broken\n", ChangeType: "modify"}},
+				CostUSD: 0.5,
+			}
+
+			verified := 0
+			verify := func(ctx context.Context, repo *config.RepoMapping, branch, token string, fix *ProposedFix) error {
+				verified++
+				if verified <= tt.failures {
+					return &CheckFailedError{Check: CheckTests, Command: "make test", Output: "FAIL: test_user", Usage: fix.Usage()}
+				}
+				return nil
+			}
+
+			repo := &config.RepoMapping{Owner: "org", Repo: "app", TestCommand: "make test"}
+			provider := &fakeProvider{files: map[string]string{"app.py": "old\n"}}
+			got, err := p.refineFix(context.Background(), repo, "main", "token", provider, req, fix, verify)
+
+			if verified != tt.wantVerified {
+				t.Errorf("verified %d times, want %d", verified, tt.wantVerified)
+			}
+			var failed *CheckFailedError
+			if tt.wantErr {
+				if !errors.As(err, &failed) || failed.Usage.CostUSD != tt.wantCost {
+					t.Fatalf("refineFix() error = %v, want a failed check costing %v", err, tt.wantCost)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("refineFix() error = %v", err)
+			}
+			if got.CostUSD != tt.wantCost {
+				t.Errorf("fix cost = %v, want %v", got.CostUSD, tt.wantCost)
+			}
+			if tt.failures > 0 {
+				attempt := req.FailedAttempt
+				if attempt == nil || attempt.Output != "FAIL: test_user" || !strings.Contains(attempt.Diff, "+broken") {
+					t.Errorf("failed attempt = %+v", attempt)
+				}
+			}
+		})
+	}
+}
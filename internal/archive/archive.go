@@ -0,0 +1,71 @@
+package archive
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when a payload does not exist in the archive.
+var ErrNotFound = errors.New("payload not found")
+
+// Archive stores raw webhook payloads for debugging and replay.
+type Archive interface {
+	// Put stores a payload under id.
+	Put(ctx context.Context, id string, payload []byte) error
+	// Get returns the payload stored under id, or ErrNotFound.
+	Get(ctx context.Context, id string) ([]byte, error)
+	// Prune deletes payloads archived before cutoff and returns how many were removed.
+	Prune(ctx context.Context, cutoff time.Time) (int, error)
+}
+
+// idTimeLayout prefixes payload IDs so they sort chronologically.
+const idTimeLayout = "20060102T150405Z"
+
+var idPattern = regexp.MustCompile(`^\d{8}T\d{6}Z-[0-9a-f]{8}$`)
+
+// NewID returns a unique, chronologically sortable payload ID.
+func NewID(now time.Time) string {
+	var b [4]byte
+	rand.Read(b[:])
+	return now.UTC().Format(idTimeLayout) + "-" + hex.EncodeToString(b[:])
+}
+
+// ValidID reports whether id has the format produced by NewID. Archives use
+// it to reject IDs that could escape their storage location.
+func ValidID(id string) bool {
+	return idPattern.MatchString(id)
+}
+
+// idTime returns the time encoded in a payload ID.
+func idTime(id string) (time.Time, bool) {
+	ts, _, ok := strings.Cut(id, "-")
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(idTimeLayout, ts)
+	return t, err == nil
+}
+
+// Open creates an archive from a URL: file:///path/to/dir or s3://bucket/prefix.
+func Open(ctx context.Context, rawURL string) (Archive, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid archive URL %q: %w", rawURL, err)
+	}
+
+	switch u.Scheme {
+	case "file":
+		return NewDiskArchive(u.Path)
+	case "s3":
+		return NewS3Archive(ctx, u.Host, strings.Trim(u.Path, "/"))
+	default:
+		return nil, fmt.Errorf("unsupported archive URL scheme %q (expected file or s3)", u.Scheme)
+	}
+}
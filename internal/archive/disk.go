@@ -0,0 +1,80 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DiskArchive stores payloads as JSON files in a directory.
+type DiskArchive struct {
+	dir string
+}
+
+// NewDiskArchive creates a disk archive, creating dir if needed.
+func NewDiskArchive(dir string) (*DiskArchive, error) {
+	if dir == "" {
+		return nil, errors.New("archive directory is required")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create archive directory: %w", err)
+	}
+	return &DiskArchive{dir: dir}, nil
+}
+
+// Put stores a payload under id.
+func (a *DiskArchive) Put(ctx context.Context, id string, payload []byte) error {
+	if !ValidID(id) {
+		return fmt.Errorf("invalid payload ID %q", id)
+	}
+	if err := os.WriteFile(a.path(id), payload, 0o644); err != nil {
+		return fmt.Errorf("failed to archive payload %s: %w", id, err)
+	}
+	return nil
+}
+
+// Get returns the payload stored under id.
+func (a *DiskArchive) Get(ctx context.Context, id string) ([]byte, error) {
+	if !ValidID(id) {
+		return nil, ErrNotFound
+	}
+	data, err := os.ReadFile(a.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read payload %s: %w", id, err)
+	}
+	return data, nil
+}
+
+// Prune deletes payloads archived before cutoff.
+func (a *DiskArchive) Prune(ctx context.Context, cutoff time.Time) (int, error) {
+	entries, err := os.ReadDir(a.dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list archive: %w", err)
+	}
+
+	removed := 0
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok || !ValidID(id) {
+			continue
+		}
+		if t, ok := idTime(id); ok && t.Before(cutoff) {
+			if err := os.Remove(a.path(id)); err != nil {
+				return removed, fmt.Errorf("failed to prune payload %s: %w", id, err)
+			}
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+func (a *DiskArchive) path(id string) string {
+	return filepath.Join(a.dir, id+".json")
+}
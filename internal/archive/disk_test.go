@@ -0,0 +1,54 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDiskArchive(t *testing.T) {
+	ctx := context.Background()
+	a, err := NewDiskArchive(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDiskArchive() error = %v", err)
+	}
+
+	old := NewID(time.Now().Add(-48 * time.Hour))
+	recent := NewID(time.Now())
+
+	for _, id := range []string{old, recent} {
+		if err := a.Put(ctx, id, []byte(`{"action":"created"}`)); err != nil {
+			t.Fatalf("Put(%s) error = %v", id, err)
+		}
+	}
+
+	got, err := a.Get(ctx, recent)
+	if err != nil || string(got) != `{"action":"created"}` {
+		t.Errorf("Get() = %q, %v", got, err)
+	}
+
+	if _, err := a.Get(ctx, "../../etc/passwd"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() with invalid ID error = %v, want ErrNotFound", err)
+	}
+
+	removed, err := a.Prune(ctx, time.Now().Add(-24*time.Hour))
+	if err != nil || removed != 1 {
+		t.Errorf("Prune() = %d, %v; want 1 removed", removed, err)
+	}
+	if _, err := a.Get(ctx, old); !errors.Is(err, ErrNotFound) {
+		t.Errorf("pruned payload should be gone, got %v", err)
+	}
+	if _, err := a.Get(ctx, recent); err != nil {
+		t.Errorf("recent payload should survive pruning, got %v", err)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	if _, err := Open(context.Background(), "file://"+t.TempDir()); err != nil {
+		t.Errorf("Open(file://) error = %v", err)
+	}
+	if _, err := Open(context.Background(), "ftp://example.com/x"); err == nil {
+		t.Error("Open() should reject unsupported schemes")
+	}
+}
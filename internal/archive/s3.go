@@ -0,0 +1,124 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// S3Archive stores payloads as objects in an S3 bucket.
+type S3Archive struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+// NewS3Archive creates an S3 archive using the default AWS credential chain.
+func NewS3Archive(ctx context.Context, bucket, prefix string) (*S3Archive, error) {
+	if bucket == "" {
+		return nil, errors.New("archive bucket is required")
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	return &S3Archive{
+		client: s3.NewFromConfig(cfg),
+		bucket: bucket,
+		prefix: prefix,
+	}, nil
+}
+
+// Put stores a payload under id.
+func (a *S3Archive) Put(ctx context.Context, id string, payload []byte) error {
+	if !ValidID(id) {
+		return fmt.Errorf("invalid payload ID %q", id)
+	}
+	_, err := a.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(a.bucket),
+		Key:         aws.String(a.key(id)),
+		Body:        bytes.NewReader(payload),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to archive payload %s: %w", id, err)
+	}
+	return nil
+}
+
+// Get returns the payload stored under id.
+func (a *S3Archive) Get(ctx context.Context, id string) ([]byte, error) {
+	if !ValidID(id) {
+		return nil, ErrNotFound
+	}
+	out, err := a.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(a.bucket),
+		Key:    aws.String(a.key(id)),
+	})
+	var noSuchKey *types.NoSuchKey
+	if errors.As(err, &noSuchKey) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read payload %s: %w", id, err)
+	}
+	defer out.Body.Close()
+
+	return io.ReadAll(out.Body)
+}
+
+// Prune deletes payloads archived before cutoff.
+func (a *S3Archive) Prune(ctx context.Context, cutoff time.Time) (int, error) {
+	removed := 0
+	paginator := s3.NewListObjectsV2Paginator(a.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(a.bucket),
+		Prefix: aws.String(a.key("")),
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return removed, fmt.Errorf("failed to list archive: %w", err)
+		}
+
+		for _, obj := range page.Contents {
+			id := strings.TrimSuffix(path.Base(aws.ToString(obj.Key)), ".json")
+			t, ok := idTime(id)
+			if !ValidID(id) || !ok || !t.Before(cutoff) {
+				continue
+			}
+			_, err := a.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+				Bucket: aws.String(a.bucket),
+				Key:    obj.Key,
+			})
+			if err != nil {
+				return removed, fmt.Errorf("failed to prune payload %s: %w", id, err)
+			}
+			removed++
+		}
+	}
+
+	return removed, nil
+}
+
+// key returns the object key for id. An empty id yields the listing prefix.
+func (a *S3Archive) key(id string) string {
+	name := ""
+	if id != "" {
+		name = id + ".json"
+	}
+	if a.prefix == "" {
+		return name
+	}
+	return a.prefix + "/" + name
+}
@@ -0,0 +1,215 @@
+// Package callback delivers signed job lifecycle events to operator-configured
+// URLs so external systems can react to the pipeline.
+package callback
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/tracking"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/webhook"
+)
+
+// Event types
+const (
+	EventQueued    = "job.queued"
+	EventStarted   = "job.started"
+	EventSucceeded = "job.succeeded"
+	EventFailed    = "job.failed"
+	// EventBudgetExhausted is sent when a monthly cost budget runs out and
+	// fix generation pauses.
+	EventBudgetExhausted = "budget.exhausted"
+)
+
+const (
+	// SignatureHeader carries the hex HMAC-SHA256 of the body, keyed with
+	// the callback secret.
+	SignatureHeader = "X-SentryAgent-Signature"
+	// EventHeader carries the event type.
+	EventHeader = "X-SentryAgent-Event"
+
+	sendAttempts = 3
+	sendTimeout  = 30 * time.Second
+)
+
+// Event is the JSON body of a callback.
+type Event struct {
+	Type     string           `json:"type"`
+	Time     time.Time        `json:"time"`
+	RecordID string           `json:"record_id,omitempty"`
+	Tenant   string           `json:"tenant,omitempty"`
+	IssueID  string           `json:"issue_id,omitempty"`
+	ShortID  string           `json:"short_id,omitempty"`
+	Project  string           `json:"project,omitempty"`
+	Repo     string           `json:"repo,omitempty"`
+	Outcome  tracking.Outcome `json:"outcome,omitempty"`
+	PRURL    string           `json:"pr_url,omitempty"`
+	Error    string           `json:"error,omitempty"`
+	CostUSD  float64          `json:"cost_usd,omitempty"`
+	// LimitUSD is the exhausted budget; Repo is empty for the budget across
+	// all repositories.
+	LimitUSD float64 `json:"limit_usd,omitempty"`
+}
+
+// Notifier posts events to a set of callback URLs. A nil Notifier sends
+// nothing.
+type Notifier struct {
+	urls       []string
+	secret     []byte
+	http       *http.Client
+	now        func() time.Time
+	retryDelay time.Duration
+}
+
+// NewNotifier returns a Notifier for urls, or nil if there are none.
+func NewNotifier(urls []string, secret string) *Notifier {
+	if len(urls) == 0 {
+		return nil
+	}
+	return &Notifier{
+		urls:       urls,
+		secret:     []byte(secret),
+		http:       &http.Client{Timeout: 10 * time.Second},
+		now:        time.Now,
+		retryDelay: 2 * time.Second,
+	}
+}
+
+// Notify sends the event of type typ for a job's record in the background,
+// logging failures.
+func (n *Notifier) Notify(typ string, rec tracking.Record) {
+	if n == nil {
+		return
+	}
+	event := Event{
+		Type:     typ,
+		Time:     n.now().UTC(),
+		RecordID: rec.ID,
+		Tenant:   rec.Tenant,
+		IssueID:  rec.IssueID,
+		ShortID:  rec.ShortID,
+		Project:  rec.Project,
+		Repo:     rec.Repo,
+		Outcome:  rec.Outcome,
+		PRURL:    rec.PRURL,
+		Error:    rec.Error,
+		CostUSD:  rec.CostUSD,
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		defer cancel()
+		if err := n.Send(ctx, event); err != nil {
+			log.Printf("Failed to send %s callback for issue %s: %v", typ, rec.IssueID, err)
+		}
+	}()
+}
+
+// NotifyBudgetExhausted sends EventBudgetExhausted in the background,
+// logging failures. repo is empty for the budget across all repositories.
+func (n *Notifier) NotifyBudgetExhausted(repo string, spentUSD, limitUSD float64) {
+	if n == nil {
+		return
+	}
+	event := Event{
+		Type:     EventBudgetExhausted,
+		Time:     n.now().UTC(),
+		Repo:     repo,
+		CostUSD:  spentUSD,
+		LimitUSD: limitUSD,
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		defer cancel()
+		if err := n.Send(ctx, event); err != nil {
+			log.Printf("Failed to send %s callback: %v", EventBudgetExhausted, err)
+		}
+	}()
+}
+
+// Send posts event to every URL, retrying failed deliveries.
+func (n *Notifier) Send(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+	mac := hmac.New(sha256.New, n.secret)
+	mac.Write(body)
+	signature := hex.EncodeToString(mac.Sum(nil))
+
+	var errs []error
+	for _, url := range n.urls {
+		if err := n.post(ctx, url, event.Type, signature, body); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", url, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (n *Notifier) post(ctx context.Context, url, typ, signature string, body []byte) error {
+	var err error
+	for attempt := 1; attempt <= sendAttempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(n.retryDelay):
+			}
+		}
+
+		var req *http.Request
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(EventHeader, typ)
+		req.Header.Set(SignatureHeader, signature)
+
+		var resp *http.Response
+		resp, err = n.http.Do(req)
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 300 {
+			return nil
+		}
+		err = fmt.Errorf("callback returned %s", resp.Status)
+		if resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			return err
+		}
+	}
+	return err
+}
+
+// queue notifies when jobs are queued.
+type queue struct {
+	webhook.JobQueue
+	n *Notifier
+}
+
+// Queue wraps jobs so each job it accepts sends a job.queued event.
+func (n *Notifier) Queue(jobs webhook.JobQueue) webhook.JobQueue {
+	if n == nil {
+		return jobs
+	}
+	return &queue{JobQueue: jobs, n: n}
+}
+
+// Enqueue implements webhook.JobQueue.
+func (q *queue) Enqueue(ctx context.Context, job webhook.Job) error {
+	if err := q.JobQueue.Enqueue(ctx, job); err != nil {
+		return err
+	}
+	q.n.Notify(EventQueued, tracking.NewRecord(job, q.n.now()))
+	return nil
+}
@@ -0,0 +1,125 @@
+package callback
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/tracking"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/webhook"
+)
+
+func TestNotifier_Send(t *testing.T) {
+	var got Event
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write(body)
+		if sig := r.Header.Get(SignatureHeader); sig != hex.EncodeToString(mac.Sum(nil)) {
+			t.Errorf("signature = %q, want HMAC of body", sig)
+		}
+		if typ := r.Header.Get(EventHeader); typ != EventSucceeded {
+			t.Errorf("event header = %q, want %s", typ, EventSucceeded)
+		}
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Errorf("invalid body: %v", err)
+		}
+	}))
+	defer srv.Close()
+
+	n := NewNotifier([]string{srv.URL}, "secret")
+	event := Event{Type: EventSucceeded, IssueID: "1", Project: "api", Outcome: tracking.OutcomePROpened, PRURL: "https://github.com/acme/api/pull/7"}
+	if err := n.Send(context.Background(), event); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if got.IssueID != "1" || got.PRURL != event.PRURL || got.Outcome != tracking.OutcomePROpened {
+		t.Errorf("received event = %+v", got)
+	}
+}
+
+func TestNotifier_SendRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		wantSent int32
+		wantErr  bool
+	}{
+		{"server error", http.StatusBadGateway, sendAttempts, true},
+		{"rate limited", http.StatusTooManyRequests, sendAttempts, true},
+		{"client error", http.StatusBadRequest, 1, true},
+		{"success", http.StatusNoContent, 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				sent.Add(1)
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			n := NewNotifier([]string{srv.URL}, "secret")
+			n.retryDelay = time.Millisecond
+			err := n.Send(context.Background(), Event{Type: EventFailed, IssueID: "1"})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Send() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if sent.Load() != tt.wantSent {
+				t.Errorf("attempts = %d, want %d", sent.Load(), tt.wantSent)
+			}
+		})
+	}
+}
+
+type fakeQueue struct{ err error }
+
+func (q fakeQueue) Enqueue(context.Context, webhook.Job) error { return q.err }
+
+func TestNotifier_Queue(t *testing.T) {
+	events := make(chan Event, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e Event
+		json.NewDecoder(r.Body).Decode(&e)
+		events <- e
+	}))
+	defer srv.Close()
+
+	n := NewNotifier([]string{srv.URL}, "secret")
+	job := webhook.Job{ParsedError: &webhook.ParsedError{IssueID: "1", ProjectSlug: "api"}}
+
+	if err := n.Queue(fakeQueue{err: webhook.ErrDuplicateJob}).Enqueue(context.Background(), job); !errors.Is(err, webhook.ErrDuplicateJob) {
+		t.Fatalf("Enqueue() error = %v, want ErrDuplicateJob", err)
+	}
+	if err := n.Queue(fakeQueue{}).Enqueue(context.Background(), job); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+
+	// Only the accepted job is announced
+	select {
+	case e := <-events:
+		if e.Type != EventQueued || e.IssueID != "1" || e.Project != "api" {
+			t.Errorf("event = %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no job.queued event")
+	}
+	select {
+	case e := <-events:
+		t.Errorf("unexpected event %+v", e)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	var nilNotifier *Notifier
+	if q := nilNotifier.Queue(fakeQueue{}); q != (fakeQueue{}) {
+		t.Error("nil Notifier wrapped the queue")
+	}
+}
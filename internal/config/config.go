@@ -3,33 +3,494 @@ package config
 import (
 	"errors"
 	"fmt"
+	"net/netip"
+	"net/url"
 	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/filter"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/schedule"
+)
+
+// BuildCommandAuto and FormatCommandAuto as a repository's build or format
+// command use its build tool or formatters, detected from the files in it.
+const (
+	BuildCommandAuto  = "auto"
+	FormatCommandAuto = "auto"
 )
 
 // RepoMapping maps a Sentry project to a GitHub repository.
 type RepoMapping struct {
+	// SentryProject is a project slug, or a glob such as "payments-*"
+	// matching several.
 	SentryProject string
 	Owner         string
 	Repo          string
+
+	// StyleGuidePath is a repo-relative conventions document included in
+	// the system prompt when present.
+	StyleGuidePath string
+	// SparseCheckout limits clones to the directories the stack trace
+	// points at, for monorepos too large to check out in full.
+	SparseCheckout bool
+	// AnalysisOnly posts each fix's analysis and suggested diff instead of
+	// committing it or opening a pull request.
+	AnalysisOnly bool
+	// TestCommand is a shell command run with a fix applied; fixes that
+	// make it fail are not proposed. Empty skips the check.
+	TestCommand string
+	// BuildCommand compiles the repository with a fix applied, before its
+	// tests run. BuildCommandAuto picks one for the repository's language;
+	// empty skips the check.
+	BuildCommand string
+	// RegressionTestCommand runs the regression test added with a fix: its
+	// "{files}" are replaced by the test's files and "{filter}" by a filter
+	// Claude gives to select the test, such as its name. Empty skips the
+	// regression test.
+	RegressionTestCommand string
+	// FormatCommand formats the changed files, given as arguments, before
+	// the fix is checked and committed. FormatCommandAuto runs the
+	// formatters the repository uses; empty leaves files as generated.
+	FormatCommand string
+	// MaxFixFiles and MaxFixLines cap the files and changed lines of a fix;
+	// larger fixes are posted as analysis instead of proposed. 0 means no
+	// limit.
+	MaxFixFiles int
+	MaxFixLines int
+	// AllowedPaths and DeniedPaths are globs of the files fixes may change;
+	// see MayChange. No AllowedPaths allows every file not denied.
+	AllowedPaths []string
+	DeniedPaths  []string
+	// PromptTemplate is a text/template rendered against each fix request
+	// into the system prompt, for notes kept outside the repository.
+	PromptTemplate string
+	// InstructionFiles are repo-relative files, such as .autofix.md, added
+	// to the system prompt when present.
+	InstructionFiles []string
+
+	// BaseBranch is the branch fixes are generated against and their PRs
+	// target; empty uses the repository's default branch.
+	BaseBranch string
+	// BranchPrefix starts the name of each fix branch.
+	BranchPrefix string
+	// Labels, Assignees and Reviewers are added to each fix PR, besides the
+	// label marking it as SentryAgent's.
+	Labels    []string
+	Assignees []string
+	Reviewers []string
+	// DraftPRs opens fix PRs as drafts.
+	DraftPRs bool
+	// MaxPRsPerDay caps the fix PRs opened in the repository per UTC day;
+	// 0 means no limit.
+	MaxPRsPerDay int
+	// Model generates the repository's fixes instead of the backend's
+	// default model.
+	Model string
+	// Severity is the minimum level and impact of the project's issues to
+	// fix; others are skipped before they are queued.
+	Severity filter.SeverityThreshold
+	// Environments are the Sentry environments the project's issues are
+	// fixed in; issues from others are skipped before they are queued.
+	// Empty accepts every environment.
+	Environments []string
+	// Flags switch capabilities on or off for the repository. The settings
+	// they override, like TestCommand, already reflect them.
+	Flags Flags
+	// SkipRegressionTests doesn't run the regression tests added with fixes.
+	SkipRegressionTests bool
+	// DryRun logs each fix instead of proposing it.
+	DryRun bool
+
+	// Tenant owning the mapping, "" for the default tenant.
+	Tenant string
+	// GitHubToken is the credential used for the repository.
+	GitHubToken string
+}
+
+// FullName returns the repository in owner/repo form.
+func (m *RepoMapping) FullName() string {
+	return m.Owner + "/" + m.Repo
 }
 
 // Config holds all application configuration.
 type Config struct {
+	// mu guards the settings Reload replaces: the repo mappings and
+	// patterns of every tenant, the mappings resolved from patterns and the
+	// webhook filters.
+	mu sync.RWMutex
+	// resolveRepo applies the per-repo settings to a mapping.
+	resolveRepo func(m *RepoMapping) error
+	resolved    []*RepoMapping
+
+	// File of KEY=value settings read after the environment, and how often
+	// it is checked for changes to reload.
+	ConfigFile         string
+	ConfigPollInterval time.Duration
+
+	// ManagedSecrets lists the settings fetched from a secret manager, and
+	// SecretsRefreshInterval how often the config is reloaded to fetch them
+	// again.
+	ManagedSecrets         []string
+	SecretsRefreshInterval time.Duration
+
 	Port                string
 	SentryWebhookSecret string
 	GitHubToken         string
 	AnthropicAPIKey     string
+	AdminToken          string
 	RepoMappings        []RepoMapping
+	// RepoPatterns map projects not in RepoMappings by regular expression.
+	RepoPatterns []RepoPattern
+
+	// Additional tenants served from /webhook/sentry/{name}.
+	Tenants []Tenant
+
+	// gRPC ingestion API listen address (e.g. ":9090"). Empty disables it.
+	// Clients must send GRPCToken as a bearer token.
+	GRPCAddr  string
+	GRPCToken string
+
+	// Fix generation backend: "claude-code" runs the Claude Code CLI in a
+	// clone, "anthropic-api" calls the Anthropic API with AnthropicModel at
+	// AnthropicBaseURL (defaults when empty) and reads files through GitHub,
+	// and "vertex" does the same through Vertex AI in VertexProjectID and
+	// VertexRegion.
+	FixBackend       string
+	AnthropicModel   string
+	AnthropicBaseURL string
+
+	// Vertex AI authenticates with the service account key in
+	// VertexCredentialsFile, or Application Default Credentials when empty.
+	VertexProjectID       string
+	VertexRegion          string
+	VertexCredentialsFile string
+
+	// Sentry API access, used to fetch issues for event-only payloads.
+	// An empty SentryAuthToken disables fetching.
+	SentryURL       string
+	SentryAuthToken string
+	// Organization owning the Sentry projects, for release artifacts such
+	// as sourcemaps. Empty takes it from each issue's permalink.
+	SentryOrg string
+
+	// Stale bot PR policy. A zero value disables the corresponding action.
+	StalePRNudgeDays     int
+	StalePRCloseDays     int
+	StalePRCheckInterval time.Duration
+
+	// Reviewer feedback learning store. An empty path keeps feedback in memory.
+	LearningStorePath    string
+	FeedbackSyncInterval time.Duration
+
+	// Tag include/exclude rules evaluated before queueing a job.
+	TagFilter filter.TagFilter
+
+	// Per-project error type allow/deny lists evaluated before queueing a job.
+	ErrorTypeFilter filter.ErrorTypeFilter
+
+	// How long a fingerprint suppresses near-identical errors from other issues.
+	DuplicateWindow time.Duration
+
+	// Review open human PRs that reference the issue with suggestions
+	// instead of opening a separate PR.
+	SuggestOnHumanPRs bool
+
+	// Point issues whose fingerprint a merged bot PR already fixed to that
+	// PR instead of generating another fix.
+	FixCache bool
+
+	// Route vulnerability-class errors through a private security advisory
+	// instead of a public PR. Empty SecurityPatterns uses the built-in list.
+	SecurityAdvisoryMode bool
+	SecurityPatterns     []string
+
+	// Job queue backend ("memory", "sqlite", "redis", "postgres" or "nats")
+	// and its capacity.
+	// Webhooks arriving while it is full are rejected with 429 and
+	// QueueRetryAfter so Sentry retries them.
+	QueueBackend    string
+	QueueCapacity   int
+	QueueRetryAfter time.Duration
+	// Jobs left unacknowledged for QueueClaimAfter (e.g. after a replica
+	// crashed) are taken over by another replica. Durable backends only.
+	QueueClaimAfter time.Duration
+	// Number of jobs processed concurrently
+	Workers int
+	// Cap on concurrent Claude Code sessions across all jobs; 0 means no cap
+	// beyond Workers.
+	MaxClaudeSessions int
+	// Claude Code CLI options: a cap on agent turns (0 for the CLI default),
+	// the tools it may use without asking (all when empty), the permission
+	// mode (permissions are skipped when empty) and extra flags.
+	ClaudeMaxTurns       int
+	ClaudeAllowedTools   []string
+	ClaudePermissionMode string
+	ClaudeExtraArgs      []string
+	// Have Claude Code report fixes through the submit_fix tool of an MCP
+	// server run for each session instead of as JSON in its output.
+	ClaudeSubmitTool bool
+	// Docker image to run Claude Code in, one container per session, and
+	// the formatters, builds and tests checking fixes, one container per
+	// command; empty runs them on the host. The container joins ClaudeSandboxNetwork, reaches
+	// out through ClaudeSandboxProxy if set, and is limited to the given
+	// CPUs, memory and processes.
+	ClaudeSandboxImage   string
+	ClaudeSandboxNetwork string
+	ClaudeSandboxProxy   string
+	ClaudeSandboxCPUs    string
+	ClaudeSandboxMemory  string
+	ClaudeSandboxPids    int
+	// Resource limits of the Claude Code CLI and of the formatters, builds
+	// and tests checking fixes, applied to every process they start: data
+	// memory and largest file written in bytes and CPU time, 0 for no limit.
+	// Commands writing more than ProcessOutputLimit bytes are killed.
+	ProcessMemoryLimit   int64
+	ProcessCPULimit      time.Duration
+	ProcessFileSizeLimit int64
+	ProcessOutputLimit   int64
+	// Directory keeping a cached clone of each repository for Claude Code
+	// runs, fetched and reset per job. Empty clones afresh for every job.
+	WorkspaceCacheDir string
+	// Without a cache, each job clones into a directory of its own under
+	// WorkspaceDir. No new clones are made while they use more than
+	// WorkspaceQuota bytes (0 for no limit), and clones older than
+	// WorkspaceMaxAge are removed.
+	WorkspaceDir    string
+	WorkspaceQuota  int64
+	WorkspaceMaxAge time.Duration
+	// Commits of history fetched for Claude Code runs; 0 fetches all of it.
+	CloneDepth int
+	// Lines fetched around each in-app frame into the prompt; 0 disables.
+	SourceContextLines int
+	// Latest commits touching the culprit file shown in the prompt; 0
+	// disables.
+	CulpritHistoryCommits int
+	// How much personal data is scrubbed from errors before they are
+	// processed: "off", "standard" or "strict".
+	PIIScrubbing string
+	// Bound on each run of a repository's build or test command, zero for
+	// none.
+	TestTimeout time.Duration
+	// Variables of the service's environment passed to the formatters,
+	// builds and tests checking fixes on top of the few they always get,
+	// like PATH. Nothing else, least of all the service's credentials, is
+	// passed on.
+	CheckEnv []string
+	// Ask Claude for a test reproducing each error alongside its fix.
+	RegressionTests bool
+	// How Claude gives modified files: "content" in full, or as a "diff".
+	FixFormat string
+	// Fixes Claude is less confident in than MinConfidence (0 to 1) are not
+	// proposed; their analysis is posted according to LowConfidenceAction,
+	// "sentry-comment" or "github-issue", instead. Oversized fixes and those
+	// for analysis-only repositories are posted the same way.
+	MinConfidence       float64
+	LowConfidenceAction string
+	// Times a fix failing the build or tests is regenerated with the
+	// failure's output.
+	RepairAttempts int
+	// Have a second Claude session review each fix changing at least
+	// ReviewMinChangedLines lines, regenerating it at most ReviewMaxRevisions
+	// times on request.
+	ReviewFixes           bool
+	ReviewMaxRevisions    int
+	ReviewMinChangedLines int
+	// Deadline for each job once it starts; a hung Claude Code session is
+	// killed when it expires.
+	PipelineTimeout time.Duration
+	// Minimum time between an error being reported and its job starting,
+	// so Sentry grouping and event volume settle first. The issue is
+	// reloaded from Sentry before the job starts.
+	ProcessingDelay time.Duration
+	// Daily windows in which queued jobs are processed; nil means always.
+	// Webhooks received outside them wait in the queue.
+	ProcessingWindows *schedule.Schedule
+
+	// How long job records (issue, PR, outcome, cost) are kept
+	HistoryRetention time.Duration
+	// Keep the prompts sent to the model and its output for each job record,
+	// redacted, for HistoryRetention
+	AuditTrail bool
+
+	// Maximum fix PRs opened per repository per UTC day; 0 means no limit.
+	// Issues over the budget are deferred to the next day, and commented on
+	// in Sentry when PRBudgetSentryComment is set.
+	PRBudgetPerDay        int
+	PRBudgetSentryComment bool
+
+	// Flags of repositories that don't set their own.
+	Flags Flags
+	// DryRun turns on the dry_run flag of every repository, whatever its
+	// own flags, and stops the stale PR sweeps, so the agent can be trialled
+	// without changing any repository.
+	DryRun bool
+
+	// Labels added to every fix PR, and the assignees and reviewers of
+	// repositories that don't set their own.
+	PRLabels    []string
+	PRAssignees []string
+	PRReviewers []string
+
+	// Caps on fix generation spending per UTC month, across all
+	// repositories and per repository; 0 means no cap. Jobs over budget are
+	// deferred to the next month.
+	CostBudgetMonthlyUSD     float64
+	CostBudgetRepoMonthlyUSD float64
+
+	// Retries of transient pipeline failures (GitHub 5xx, Claude Code
+	// timeouts). Delays grow exponentially from RetryBaseDelay up to
+	// RetryMaxDelay.
+	RetryMaxAttempts int
+	RetryBaseDelay   time.Duration
+	RetryMaxDelay    time.Duration
+
+	// Redis queue settings
+	RedisURL      string
+	RedisQueueKey string
+
+	// SQLite queue database, DATA_DIR/queue.db by default
+	SQLitePath string
+
+	// Postgres queue settings
+	DatabaseURL string
+
+	// NATS JetStream queue settings
+	NATSURL    string
+	NATSStream string
+
+	// Role of this process: "all" receives webhooks and processes jobs,
+	// "frontend" only receives them and "worker" only processes them.
+	// Split roles share a durable queue backend.
+	Role string
+
+	// Per-project webhook rate limit in deliveries per minute, with bursts of
+	// up to RateLimitBurst. Zero disables rate limiting.
+	RateLimitPerMinute int
+	RateLimitBurst     int
+
+	// Networks allowed to deliver webhooks (CIDRs or bare IPs). Empty allows
+	// all. X-Forwarded-For is honoured only from TrustedProxies.
+	WebhookAllowedIPs []netip.Prefix
+	TrustedProxies    []netip.Prefix
+
+	// Serve HTTPS with the certificate and key in these files, or with
+	// certificates for ACMEDomains obtained from Let's Encrypt (or the ACME
+	// directory at ACMEDirectoryURL) and cached in ACMECacheDir. ACME
+	// challenges are answered on ACMEHTTPPort, which redirects everything
+	// else to HTTPS.
+	TLSCertFile      string
+	TLSKeyFile       string
+	ACMEDomains      []string
+	ACMEEmail        string
+	ACMECacheDir     string
+	ACMEDirectoryURL string
+	ACMEHTTPPort     string
+
+	// HTTP server limits. Large Sentry events can need a longer read timeout
+	// or a larger body. A zero HTTPMaxBodyBytes accepts bodies of any size.
+	HTTPReadTimeout    time.Duration
+	HTTPWriteTimeout   time.Duration
+	HTTPIdleTimeout    time.Duration
+	HTTPMaxHeaderBytes int64
+	HTTPMaxBodyBytes   int64
+
+	// DataDir holds persisted state such as processed webhook deliveries.
+	// An empty value keeps that state in memory.
+	DataDir string
+	// How long processed webhook deliveries are remembered.
+	DeliveryRetention time.Duration
+
+	// Raw payload archive (file:///dir or s3://bucket/prefix). Empty disables archiving.
+	ArchiveURL       string
+	ArchiveRetention time.Duration
+
+	// URLs receiving job lifecycle events (queued, started, succeeded,
+	// failed), signed with CallbackSecret. Empty disables callbacks.
+	CallbackURLs   []string
+	CallbackSecret string
 }
 
-// Load reads configuration from environment variables.
+// Load reads configuration from environment variables and the file named by
+// CONFIG_FILE, if any. Variables set in the environment take precedence.
 func Load() (*Config, error) {
+	loadMu.Lock()
+	defer loadMu.Unlock()
+
+	// Keep the file's values for resolving pattern mappings unless the new
+	// ones fail to load
+	prev := fileValues
+	cfg, err := load()
+	if err != nil {
+		fileValues = prev
+	}
+	return cfg, err
+}
+
+// load reads the configuration. Callers must hold loadMu.
+func load() (*Config, error) {
+	fileValues = nil
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		values, err := readConfigFile(path)
+		if err != nil {
+			return nil, err
+		}
+		fileValues = values
+	}
+
 	cfg := &Config{
-		Port:                getEnv("PORT", "8080"),
-		SentryWebhookSecret: os.Getenv("SENTRY_WEBHOOK_SECRET"),
-		GitHubToken:         os.Getenv("GITHUB_TOKEN"),
-		AnthropicAPIKey:     os.Getenv("ANTHROPIC_API_KEY"),
+		ConfigFile:            os.Getenv("CONFIG_FILE"),
+		Port:                  getEnv("PORT", "8080"),
+		SentryWebhookSecret:   lookupEnv("SENTRY_WEBHOOK_SECRET"),
+		SentryURL:             getEnv("SENTRY_URL", "https://sentry.io"),
+		SentryAuthToken:       lookupEnv("SENTRY_AUTH_TOKEN"),
+		SentryOrg:             lookupEnv("SENTRY_ORG"),
+		GitHubToken:           lookupEnv("GITHUB_TOKEN"),
+		AnthropicAPIKey:       lookupEnv("ANTHROPIC_API_KEY"),
+		AdminToken:            lookupEnv("ADMIN_TOKEN"),
+		LearningStorePath:     lookupEnv("LEARNING_STORE_PATH"),
+		DataDir:               lookupEnv("DATA_DIR"),
+		WorkspaceCacheDir:     lookupEnv("WORKSPACE_CACHE_DIR"),
+		ArchiveURL:            lookupEnv("ARCHIVE_URL"),
+		GRPCAddr:              lookupEnv("GRPC_ADDR"),
+		GRPCToken:             lookupEnv("GRPC_TOKEN"),
+		QueueBackend:          getEnv("QUEUE_BACKEND", "memory"),
+		RedisURL:              lookupEnv("REDIS_URL"),
+		RedisQueueKey:         getEnv("REDIS_QUEUE_KEY", "sentryagent:jobs"),
+		DatabaseURL:           lookupEnv("DATABASE_URL"),
+		NATSURL:               lookupEnv("NATS_URL"),
+		NATSStream:            getEnv("NATS_STREAM", "SENTRYAGENT_JOBS"),
+		Role:                  getEnv("ROLE", "all"),
+		CallbackSecret:        lookupEnv("CALLBACK_SECRET"),
+		FixBackend:            getEnv("FIX_BACKEND", "claude-code"),
+		AnthropicModel:        lookupEnv("ANTHROPIC_MODEL"),
+		AnthropicBaseURL:      lookupEnv("ANTHROPIC_BASE_URL"),
+		VertexProjectID:       lookupEnv("VERTEX_PROJECT_ID"),
+		VertexRegion:          getEnv("VERTEX_REGION", "us-east5"),
+		VertexCredentialsFile: lookupEnv("VERTEX_CREDENTIALS_FILE"),
+	}
+
+	// Fetch secrets kept in a secret manager
+	var err error
+	for _, secret := range []struct {
+		key string
+		val *string
+	}{
+		{"SENTRY_WEBHOOK_SECRET", &cfg.SentryWebhookSecret},
+		{"SENTRY_AUTH_TOKEN", &cfg.SentryAuthToken},
+		{"GITHUB_TOKEN", &cfg.GitHubToken},
+		{"ANTHROPIC_API_KEY", &cfg.AnthropicAPIKey},
+	} {
+		if *secret.val, err = cfg.resolveSecret(secret.key, *secret.val); err != nil {
+			return nil, err
+		}
 	}
 
 	// Validate required fields
@@ -39,23 +500,713 @@ func Load() (*Config, error) {
 	if cfg.GitHubToken == "" {
 		return nil, errors.New("GITHUB_TOKEN is required")
 	}
+	if cfg.GRPCAddr != "" && cfg.GRPCToken == "" {
+		return nil, errors.New("GRPC_TOKEN is required when GRPC_ADDR is set")
+	}
+	switch cfg.FixBackend {
+	case "claude-code":
+	case "anthropic-api":
+		if cfg.AnthropicAPIKey == "" {
+			return nil, errors.New("ANTHROPIC_API_KEY is required when FIX_BACKEND=anthropic-api")
+		}
+	case "vertex":
+		if cfg.VertexProjectID == "" {
+			return nil, errors.New("VERTEX_PROJECT_ID is required when FIX_BACKEND=vertex")
+		}
+	default:
+		return nil, fmt.Errorf("FIX_BACKEND: unknown backend %q (expected claude-code, anthropic-api or vertex)", cfg.FixBackend)
+	}
 
 	// Parse repo mappings
 	// Format: sentry-project1:owner1/repo1,sentry-project2:owner2/repo2
-	mappingsStr := os.Getenv("REPO_MAPPINGS")
-	if mappingsStr == "" {
-		return nil, errors.New("REPO_MAPPINGS is required")
+	// and ^regex$=owner/$1;...
+	mappingsStr := lookupEnv("REPO_MAPPINGS")
+	patternsStr := lookupEnv("REPO_MAPPING_PATTERNS")
+	if mappingsStr == "" && patternsStr == "" {
+		return nil, errors.New("REPO_MAPPINGS or REPO_MAPPING_PATTERNS is required")
+	}
+
+	if mappingsStr != "" {
+		if cfg.RepoMappings, err = parseRepoMappings(mappingsStr); err != nil {
+			return nil, err
+		}
+	}
+	for i := range cfg.RepoMappings {
+		cfg.RepoMappings[i].GitHubToken = cfg.GitHubToken
+	}
+	if cfg.RepoPatterns, err = parseRepoPatterns("REPO_MAPPING_PATTERNS", patternsStr); err != nil {
+		return nil, err
+	}
+	for i := range cfg.RepoPatterns {
+		cfg.RepoPatterns[i].GitHubToken = cfg.GitHubToken
+	}
+
+	if cfg.Tenants, err = cfg.parseTenants(); err != nil {
+		return nil, err
+	}
+
+	// Per-repo settings are resolved by functions kept for repositories
+	// mapped through patterns, whose names aren't known until an error
+	// arrives
+	var resolvers []func(m *RepoMapping) error
+
+	// Resolve style guide paths
+	// Format: owner1/repo1:path/to/STYLE.md,owner2/repo2:CONTRIBUTING.md
+	styleGuides, err := parseStyleGuidePaths(lookupEnv("STYLE_GUIDE_PATHS"))
+	if err != nil {
+		return nil, err
+	}
+	defaultStyleGuide := getEnv("STYLE_GUIDE_PATH", ".autopr/STYLE.md")
+	resolvers = append(resolvers, func(m *RepoMapping) error {
+		m.StyleGuidePath = defaultStyleGuide
+		if p, ok := styleGuides[m.FullName()]; ok {
+			m.StyleGuidePath = p
+		}
+		return nil
+	})
+
+	// Resolve sparse checkout repos
+	// Format: owner1/repo1,owner2/repo2
+	sparseRepos := make(map[string]bool)
+	for _, repo := range strings.Split(lookupEnv("SPARSE_CHECKOUT_REPOS"), ",") {
+		if repo = strings.TrimSpace(repo); repo != "" {
+			sparseRepos[repo] = true
+		}
+	}
+	resolvers = append(resolvers, func(m *RepoMapping) error {
+		m.SparseCheckout = sparseRepos[m.FullName()]
+		return nil
+	})
+
+	// Resolve analysis-only repos
+	// Format: owner1/repo1,owner2/repo2
+	analysisOnlyRepos := make(map[string]bool)
+	for _, repo := range strings.Split(lookupEnv("ANALYSIS_ONLY_REPOS"), ",") {
+		if repo = strings.TrimSpace(repo); repo != "" {
+			analysisOnlyRepos[repo] = true
+		}
+	}
+	resolvers = append(resolvers, func(m *RepoMapping) error {
+		m.AnalysisOnly = analysisOnlyRepos[m.FullName()]
+		return nil
+	})
+
+	// Resolve format, build and test commands
+	// Format: owner1/repo1=make test;owner2/repo2=npm test
+	formatCommands, err := parseCommands("FORMAT_COMMANDS", lookupEnv("FORMAT_COMMANDS"))
+	if err != nil {
+		return nil, err
+	}
+	buildCommands, err := parseCommands("BUILD_COMMANDS", lookupEnv("BUILD_COMMANDS"))
+	if err != nil {
+		return nil, err
+	}
+	testCommands, err := parseCommands("TEST_COMMANDS", lookupEnv("TEST_COMMANDS"))
+	if err != nil {
+		return nil, err
+	}
+	regressionTestCommands, err := parseCommands("REGRESSION_TEST_COMMANDS", lookupEnv("REGRESSION_TEST_COMMANDS"))
+	if err != nil {
+		return nil, err
+	}
+	defaultFormatCommand := lookupEnv("FORMAT_COMMAND")
+	defaultBuildCommand := lookupEnv("BUILD_COMMAND")
+	defaultTestCommand := lookupEnv("TEST_COMMAND")
+	defaultRegressionTestCommand := lookupEnv("REGRESSION_TEST_COMMAND")
+	resolvers = append(resolvers, func(m *RepoMapping) error {
+		m.FormatCommand = defaultFormatCommand
+		if c, ok := formatCommands[m.FullName()]; ok {
+			m.FormatCommand = c
+		}
+		m.BuildCommand = defaultBuildCommand
+		if c, ok := buildCommands[m.FullName()]; ok {
+			m.BuildCommand = c
+		}
+		m.TestCommand = defaultTestCommand
+		if c, ok := testCommands[m.FullName()]; ok {
+			m.TestCommand = c
+		}
+		m.RegressionTestCommand = defaultRegressionTestCommand
+		if c, ok := regressionTestCommands[m.FullName()]; ok {
+			m.RegressionTestCommand = c
+		}
+		return nil
+	})
+
+	// Resolve fix size limits
+	// Format: owner1/repo1=files/lines;owner2/repo2=files/lines
+	sizeLimits, err := parseFixSizeLimits(lookupEnv("FIX_SIZE_LIMITS"))
+	if err != nil {
+		return nil, err
+	}
+	defaultMaxFiles, err := getEnvInt("MAX_FIX_FILES", 0)
+	if err != nil {
+		return nil, err
+	}
+	defaultMaxLines, err := getEnvInt("MAX_FIX_LINES", 0)
+	if err != nil {
+		return nil, err
+	}
+	if defaultMaxFiles < 0 || defaultMaxLines < 0 {
+		return nil, errors.New("MAX_FIX_FILES and MAX_FIX_LINES must not be negative")
+	}
+	resolvers = append(resolvers, func(m *RepoMapping) error {
+		m.MaxFixFiles, m.MaxFixLines = defaultMaxFiles, defaultMaxLines
+		if l, ok := sizeLimits[m.FullName()]; ok {
+			m.MaxFixFiles, m.MaxFixLines = l.files, l.lines
+		}
+		return nil
+	})
+
+	// Resolve severity thresholds, keyed by the project as mapped
+	// Format: project1=level/events/users,project2=level
+	thresholds, err := parseSeverityThresholds(lookupEnv("SEVERITY_THRESHOLDS"))
+	if err != nil {
+		return nil, err
+	}
+	var defaultThreshold filter.SeverityThreshold
+	if defaultThreshold.MinLevel, err = filter.ParseLevel(lookupEnv("MIN_LEVEL")); err != nil {
+		return nil, fmt.Errorf("MIN_LEVEL: %w", err)
+	}
+	if defaultThreshold.MinEvents, err = getEnvInt("MIN_EVENTS", 0); err != nil {
+		return nil, err
+	}
+	if defaultThreshold.MinUsers, err = getEnvInt("MIN_USERS", 0); err != nil {
+		return nil, err
+	}
+	if defaultThreshold.MinEvents < 0 || defaultThreshold.MinUsers < 0 {
+		return nil, errors.New("MIN_EVENTS and MIN_USERS must not be negative")
+	}
+	resolvers = append(resolvers, func(m *RepoMapping) error {
+		m.Severity = defaultThreshold
+		if t, ok := thresholds[m.SentryProject]; ok {
+			m.Severity = t
+		}
+		return nil
+	})
+
+	// Resolve the environments each mapping accepts, keyed by the project
+	// as mapped
+	// Format: project1=production|canary,project2=production
+	environments, err := parseProjectEnvironments(lookupEnv("PROJECT_ENVIRONMENTS"))
+	if err != nil {
+		return nil, err
+	}
+	resolvers = append(resolvers, func(m *RepoMapping) error {
+		m.Environments = environments[m.SentryProject]
+		return nil
+	})
+
+	// Resolve the paths fixes may change
+	// Format: owner1/repo1=src/**,lib/;owner2/repo2=app/
+	allowedPaths, err := parseCommands("REPO_ALLOWED_PATHS", lookupEnv("REPO_ALLOWED_PATHS"))
+	if err != nil {
+		return nil, err
+	}
+	deniedPaths, err := parseCommands("REPO_DENIED_PATHS", lookupEnv("REPO_DENIED_PATHS"))
+	if err != nil {
+		return nil, err
+	}
+	defaultAllowedPaths, err := parsePathGlobs("ALLOWED_PATHS", lookupEnv("ALLOWED_PATHS"))
+	if err != nil {
+		return nil, err
+	}
+	defaultDeniedPaths, err := parsePathGlobs("DENIED_PATHS", lookupEnv("DENIED_PATHS"))
+	if err != nil {
+		return nil, err
 	}
+	resolvers = append(resolvers, func(m *RepoMapping) (err error) {
+		m.AllowedPaths, m.DeniedPaths = defaultAllowedPaths, defaultDeniedPaths
+		if s, ok := allowedPaths[m.FullName()]; ok {
+			if m.AllowedPaths, err = parsePathGlobs("REPO_ALLOWED_PATHS", s); err != nil {
+				return err
+			}
+		}
+		if s, ok := deniedPaths[m.FullName()]; ok {
+			if m.DeniedPaths, err = parsePathGlobs("REPO_DENIED_PATHS", s); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 
-	mappings, err := parseRepoMappings(mappingsStr)
+	// Resolve prompt templates
+	// Format: owner1/repo1=/etc/sentryagent/repo1.md;owner2/repo2=...
+	promptTemplates, err := parseCommands("PROMPT_TEMPLATES", lookupEnv("PROMPT_TEMPLATES"))
 	if err != nil {
 		return nil, err
 	}
-	cfg.RepoMappings = mappings
+	templates := make(map[string]string)
+	defaultTemplate := lookupEnv("PROMPT_TEMPLATE")
+	var instructionFiles []string
+	for _, f := range strings.Split(getEnv("INSTRUCTION_FILES", "CLAUDE.md,.autofix.md"), ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			instructionFiles = append(instructionFiles, f)
+		}
+	}
+	resolvers = append(resolvers, func(m *RepoMapping) (err error) {
+		path := defaultTemplate
+		if p, ok := promptTemplates[m.FullName()]; ok {
+			path = p
+		}
+		if m.PromptTemplate, err = loadPromptTemplate(templates, path); err != nil {
+			return err
+		}
+		m.InstructionFiles = instructionFiles
+		return nil
+	})
+
+	if cfg.TestTimeout, err = getEnvDurationAllowZero("TEST_TIMEOUT", 10*time.Minute); err != nil {
+		return nil, err
+	}
+	cfg.CheckEnv = splitList(lookupEnv("CHECK_ENV"))
+	if cfg.RegressionTests, err = getEnvBool("REGRESSION_TESTS", false); err != nil {
+		return nil, err
+	}
+	cfg.FixFormat = getEnv("FIX_FORMAT", "content")
+	if cfg.FixFormat != "content" && cfg.FixFormat != "diff" {
+		return nil, fmt.Errorf("FIX_FORMAT: unknown format %q (expected content or diff)", cfg.FixFormat)
+	}
+	if cfg.MinConfidence, err = getEnvFloat("MIN_CONFIDENCE", 0); err != nil {
+		return nil, err
+	}
+	if cfg.MinConfidence < 0 || cfg.MinConfidence > 1 {
+		return nil, errors.New("MIN_CONFIDENCE must be between 0 and 1")
+	}
+	cfg.LowConfidenceAction = getEnv("LOW_CONFIDENCE_ACTION", "sentry-comment")
+	if cfg.LowConfidenceAction != "sentry-comment" && cfg.LowConfidenceAction != "github-issue" {
+		return nil, fmt.Errorf("LOW_CONFIDENCE_ACTION: unknown action %q (expected sentry-comment or github-issue)", cfg.LowConfidenceAction)
+	}
+	if cfg.RepairAttempts, err = getEnvInt("REPAIR_ATTEMPTS", 2); err != nil {
+		return nil, err
+	}
+	if cfg.RepairAttempts < 0 {
+		return nil, errors.New("REPAIR_ATTEMPTS must not be negative")
+	}
+	if cfg.ReviewFixes, err = getEnvBool("REVIEW_FIXES", false); err != nil {
+		return nil, err
+	}
+	if cfg.ReviewMaxRevisions, err = getEnvInt("REVIEW_MAX_REVISIONS", 1); err != nil {
+		return nil, err
+	}
+	if cfg.ReviewMaxRevisions < 0 {
+		return nil, errors.New("REVIEW_MAX_REVISIONS must not be negative")
+	}
+	if cfg.ReviewMinChangedLines, err = getEnvInt("REVIEW_MIN_CHANGED_LINES", 0); err != nil {
+		return nil, err
+	}
+	if cfg.ReviewMinChangedLines < 0 {
+		return nil, errors.New("REVIEW_MIN_CHANGED_LINES must not be negative")
+	}
+
+	// Parse tag rules
+	// Format: key:value,key:>=version (values may use * wildcards)
+	if cfg.TagFilter.Include, err = filter.ParseTagRules(lookupEnv("TAG_INCLUDE")); err != nil {
+		return nil, fmt.Errorf("TAG_INCLUDE: %w", err)
+	}
+	if cfg.TagFilter.Exclude, err = filter.ParseTagRules(lookupEnv("TAG_EXCLUDE")); err != nil {
+		return nil, fmt.Errorf("TAG_EXCLUDE: %w", err)
+	}
+
+	// Parse error type lists
+	// Format: Type,project=Type (types may use * wildcards)
+	if cfg.ErrorTypeFilter.AllowList, err = filter.ParseErrorTypeRules(lookupEnv("ERROR_TYPE_ALLOW")); err != nil {
+		return nil, fmt.Errorf("ERROR_TYPE_ALLOW: %w", err)
+	}
+	if cfg.ErrorTypeFilter.DenyList, err = filter.ParseErrorTypeRules(lookupEnv("ERROR_TYPE_DENY")); err != nil {
+		return nil, fmt.Errorf("ERROR_TYPE_DENY: %w", err)
+	}
+
+	if cfg.DuplicateWindow, err = getEnvDuration("DUPLICATE_WINDOW", 24*time.Hour); err != nil {
+		return nil, err
+	}
+
+	if cfg.SuggestOnHumanPRs, err = getEnvBool("SUGGEST_ON_HUMAN_PRS", true); err != nil {
+		return nil, err
+	}
+	if cfg.FixCache, err = getEnvBool("FIX_CACHE", true); err != nil {
+		return nil, err
+	}
+
+	if cfg.SecurityAdvisoryMode, err = getEnvBool("SECURITY_ADVISORY_MODE", true); err != nil {
+		return nil, err
+	}
+	for _, p := range strings.Split(lookupEnv("SECURITY_PATTERNS"), ",") {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		if _, err := regexp.Compile(p); err != nil {
+			return nil, fmt.Errorf("SECURITY_PATTERNS: invalid pattern %q: %w", p, err)
+		}
+		cfg.SecurityPatterns = append(cfg.SecurityPatterns, p)
+	}
+
+	if cfg.QueueCapacity, err = getEnvInt("QUEUE_CAPACITY", 100); err != nil {
+		return nil, err
+	}
+	if cfg.QueueCapacity <= 0 {
+		return nil, errors.New("QUEUE_CAPACITY must be positive")
+	}
+	if cfg.Workers, err = getEnvInt("WORKERS", 1); err != nil {
+		return nil, err
+	}
+	if cfg.Workers <= 0 {
+		return nil, errors.New("WORKERS must be positive")
+	}
+	if cfg.MaxClaudeSessions, err = getEnvInt("MAX_CLAUDE_SESSIONS", 0); err != nil {
+		return nil, err
+	}
+	if cfg.MaxClaudeSessions < 0 {
+		return nil, errors.New("MAX_CLAUDE_SESSIONS must not be negative")
+	}
+	if cfg.ClaudeMaxTurns, err = getEnvInt("CLAUDE_MAX_TURNS", 0); err != nil {
+		return nil, err
+	}
+	if cfg.ClaudeMaxTurns < 0 {
+		return nil, errors.New("CLAUDE_MAX_TURNS must not be negative")
+	}
+	for _, tool := range strings.Split(lookupEnv("CLAUDE_ALLOWED_TOOLS"), ",") {
+		if tool = strings.TrimSpace(tool); tool != "" {
+			cfg.ClaudeAllowedTools = append(cfg.ClaudeAllowedTools, tool)
+		}
+	}
+	switch cfg.ClaudePermissionMode = lookupEnv("CLAUDE_PERMISSION_MODE"); cfg.ClaudePermissionMode {
+	case "", "default", "acceptEdits", "bypassPermissions", "plan":
+	default:
+		return nil, fmt.Errorf("CLAUDE_PERMISSION_MODE: unknown mode %q (expected default, acceptEdits, bypassPermissions or plan)", cfg.ClaudePermissionMode)
+	}
+	cfg.ClaudeExtraArgs = strings.Fields(lookupEnv("CLAUDE_EXTRA_ARGS"))
+	if cfg.ClaudeSubmitTool, err = getEnvBool("CLAUDE_SUBMIT_TOOL", true); err != nil {
+		return nil, err
+	}
+	cfg.ClaudeSandboxImage = lookupEnv("CLAUDE_SANDBOX_IMAGE")
+	cfg.ClaudeSandboxNetwork = lookupEnv("CLAUDE_SANDBOX_NETWORK")
+	cfg.ClaudeSandboxProxy = lookupEnv("CLAUDE_SANDBOX_PROXY")
+	cfg.ClaudeSandboxCPUs = getEnv("CLAUDE_SANDBOX_CPUS", "2")
+	cfg.ClaudeSandboxMemory = getEnv("CLAUDE_SANDBOX_MEMORY", "4g")
+	if cfg.ClaudeSandboxPids, err = getEnvInt("CLAUDE_SANDBOX_PIDS", 512); err != nil {
+		return nil, err
+	}
+	if cfg.ClaudeSandboxPids < 0 {
+		return nil, errors.New("CLAUDE_SANDBOX_PIDS must not be negative")
+	}
+	// Docker's default network reaches anywhere
+	if cfg.ClaudeSandboxImage != "" && cfg.ClaudeSandboxNetwork == "" {
+		return nil, errors.New("CLAUDE_SANDBOX_NETWORK is required with CLAUDE_SANDBOX_IMAGE")
+	}
+	if cfg.ProcessMemoryLimit, err = getEnvSize("PROCESS_MEMORY_LIMIT", 0); err != nil {
+		return nil, err
+	}
+	if cfg.ProcessCPULimit, err = getEnvDurationAllowZero("PROCESS_CPU_LIMIT", 0); err != nil {
+		return nil, err
+	}
+	if cfg.ProcessFileSizeLimit, err = getEnvSize("PROCESS_FILE_SIZE_LIMIT", 0); err != nil {
+		return nil, err
+	}
+	if cfg.ProcessOutputLimit, err = getEnvSize("PROCESS_OUTPUT_LIMIT", 100<<20); err != nil {
+		return nil, err
+	}
+	cfg.WorkspaceDir = getEnv("WORKSPACE_DIR", filepath.Join(os.TempDir(), "sentryagent-workspaces"))
+	if cfg.WorkspaceQuota, err = getEnvSize("WORKSPACE_QUOTA", 0); err != nil {
+		return nil, err
+	}
+	if cfg.WorkspaceMaxAge, err = getEnvDuration("WORKSPACE_MAX_AGE", 2*time.Hour); err != nil {
+		return nil, err
+	}
+	if cfg.CloneDepth, err = getEnvInt("CLONE_DEPTH", 1); err != nil {
+		return nil, err
+	}
+	if cfg.CloneDepth < 0 {
+		return nil, errors.New("CLONE_DEPTH must not be negative")
+	}
+	if cfg.SourceContextLines, err = getEnvInt("SOURCE_CONTEXT_LINES", 100); err != nil {
+		return nil, err
+	}
+	if cfg.SourceContextLines < 0 {
+		return nil, errors.New("SOURCE_CONTEXT_LINES must not be negative")
+	}
+	if cfg.CulpritHistoryCommits, err = getEnvInt("CULPRIT_HISTORY_COMMITS", 5); err != nil {
+		return nil, err
+	}
+	if cfg.CulpritHistoryCommits < 0 {
+		return nil, errors.New("CULPRIT_HISTORY_COMMITS must not be negative")
+	}
+	switch cfg.PIIScrubbing = getEnv("PII_SCRUBBING", "off"); cfg.PIIScrubbing {
+	case "off", "standard", "strict":
+	default:
+		return nil, fmt.Errorf("PII_SCRUBBING: unknown level %q (expected off, standard or strict)", cfg.PIIScrubbing)
+	}
+	if cfg.PipelineTimeout, err = getEnvDuration("PIPELINE_TIMEOUT", 30*time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.PipelineTimeout <= 0 {
+		return nil, errors.New("PIPELINE_TIMEOUT must be positive")
+	}
+	if cfg.ProcessingDelay, err = getEnvDurationAllowZero("PROCESSING_DELAY", 0); err != nil {
+		return nil, err
+	}
+	loc, err := time.LoadLocation(getEnv("PROCESSING_TIMEZONE", "UTC"))
+	if err != nil {
+		return nil, fmt.Errorf("PROCESSING_TIMEZONE: %w", err)
+	}
+	if cfg.ProcessingWindows, err = schedule.Parse(lookupEnv("PROCESSING_WINDOWS"), loc); err != nil {
+		return nil, fmt.Errorf("PROCESSING_WINDOWS: %w", err)
+	}
+	if cfg.HistoryRetention, err = getEnvDuration("HISTORY_RETENTION", 90*24*time.Hour); err != nil {
+		return nil, err
+	}
+	if cfg.AuditTrail, err = getEnvBool("AUDIT_TRAIL", false); err != nil {
+		return nil, err
+	}
+	if cfg.PRBudgetPerDay, err = getEnvInt("PR_BUDGET_PER_DAY", 0); err != nil {
+		return nil, err
+	}
+	if cfg.PRBudgetPerDay < 0 {
+		return nil, errors.New("PR_BUDGET_PER_DAY must not be negative")
+	}
+	if cfg.PRBudgetSentryComment, err = getEnvBool("PR_BUDGET_SENTRY_COMMENT", false); err != nil {
+		return nil, err
+	}
+	if cfg.Flags, err = parseFlags("FLAGS", lookupEnv("FLAGS"), DefaultFlags); err != nil {
+		return nil, err
+	}
+	if cfg.DryRun, err = getEnvBool("DRY_RUN", false); err != nil {
+		return nil, err
+	}
+	cfg.PRLabels = splitList(getEnv("PR_LABELS", "sentry,claude-code"))
+	cfg.PRAssignees = splitList(lookupEnv("PR_ASSIGNEES"))
+	cfg.PRReviewers = splitList(lookupEnv("PR_REVIEWERS"))
+	if cfg.CostBudgetMonthlyUSD, err = getEnvFloat("COST_BUDGET_MONTHLY_USD", 0); err != nil {
+		return nil, err
+	}
+	if cfg.CostBudgetRepoMonthlyUSD, err = getEnvFloat("COST_BUDGET_REPO_MONTHLY_USD", 0); err != nil {
+		return nil, err
+	}
+	if cfg.RetryMaxAttempts, err = getEnvInt("RETRY_MAX_ATTEMPTS", 3); err != nil {
+		return nil, err
+	}
+	if cfg.RetryMaxAttempts <= 0 {
+		return nil, errors.New("RETRY_MAX_ATTEMPTS must be positive")
+	}
+	if cfg.RetryBaseDelay, err = getEnvDuration("RETRY_BASE_DELAY", 10*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.RetryMaxDelay, err = getEnvDuration("RETRY_MAX_DELAY", 5*time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.QueueRetryAfter, err = getEnvDuration("QUEUE_RETRY_AFTER", 30*time.Second); err != nil {
+		return nil, err
+	}
+	switch cfg.QueueBackend {
+	case "memory":
+	case "redis":
+		if cfg.RedisURL == "" {
+			return nil, errors.New("REDIS_URL is required when QUEUE_BACKEND=redis")
+		}
+	case "sqlite":
+		// The database path may default to DATA_DIR, checked below
+	case "postgres":
+		if cfg.DatabaseURL == "" {
+			return nil, errors.New("DATABASE_URL is required when QUEUE_BACKEND=postgres")
+		}
+	case "nats":
+		if cfg.NATSURL == "" {
+			return nil, errors.New("NATS_URL is required when QUEUE_BACKEND=nats")
+		}
+	default:
+		return nil, fmt.Errorf("QUEUE_BACKEND: unknown backend %q (expected memory, sqlite, redis, postgres or nats)", cfg.QueueBackend)
+	}
+	switch cfg.Role {
+	case "all":
+	case "frontend", "worker":
+		if cfg.QueueBackend == "memory" || cfg.QueueBackend == "sqlite" {
+			// Frontends and workers are separate processes
+			return nil, fmt.Errorf("ROLE=%s requires a shared QUEUE_BACKEND (redis, postgres or nats)", cfg.Role)
+		}
+	default:
+		return nil, fmt.Errorf("ROLE: unknown role %q (expected all, frontend or worker)", cfg.Role)
+	}
+	if cfg.QueueClaimAfter, err = getEnvDuration("QUEUE_CLAIM_AFTER", time.Hour); err != nil {
+		return nil, err
+	}
+	if cfg.QueueBackend != "memory" && cfg.QueueClaimAfter <= cfg.PipelineTimeout+cfg.ProcessingDelay {
+		// Otherwise another replica takes over jobs that are still running
+		return nil, errors.New("QUEUE_CLAIM_AFTER must be longer than PIPELINE_TIMEOUT plus PROCESSING_DELAY")
+	}
+	if cfg.WorkspaceMaxAge <= cfg.PipelineTimeout {
+		// Otherwise clones are removed under running jobs
+		return nil, errors.New("WORKSPACE_MAX_AGE must be longer than PIPELINE_TIMEOUT")
+	}
+
+	for _, u := range strings.Split(lookupEnv("CALLBACK_URLS"), ",") {
+		if u = strings.TrimSpace(u); u == "" {
+			continue
+		}
+		if parsed, err := url.Parse(u); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return nil, fmt.Errorf("CALLBACK_URLS: invalid URL %q", u)
+		}
+		cfg.CallbackURLs = append(cfg.CallbackURLs, u)
+	}
+	if len(cfg.CallbackURLs) > 0 && cfg.CallbackSecret == "" {
+		return nil, errors.New("CALLBACK_SECRET is required when CALLBACK_URLS is set")
+	}
+
+	if cfg.RateLimitPerMinute, err = getEnvInt("RATE_LIMIT_PER_MINUTE", 0); err != nil {
+		return nil, err
+	}
+	if cfg.RateLimitBurst, err = getEnvInt("RATE_LIMIT_BURST", cfg.RateLimitPerMinute); err != nil {
+		return nil, err
+	}
+	if cfg.RateLimitPerMinute < 0 || cfg.RateLimitBurst < 0 {
+		return nil, errors.New("RATE_LIMIT_PER_MINUTE and RATE_LIMIT_BURST must not be negative")
+	}
+
+	if cfg.WebhookAllowedIPs, err = parsePrefixes("WEBHOOK_ALLOWED_IPS"); err != nil {
+		return nil, err
+	}
+	if cfg.TrustedProxies, err = parsePrefixes("TRUSTED_PROXIES"); err != nil {
+		return nil, err
+	}
+
+	cfg.TLSCertFile = lookupEnv("TLS_CERT_FILE")
+	cfg.TLSKeyFile = lookupEnv("TLS_KEY_FILE")
+	cfg.ACMEDomains = splitList(lookupEnv("ACME_DOMAINS"))
+	cfg.ACMEEmail = lookupEnv("ACME_EMAIL")
+	cfg.ACMEDirectoryURL = lookupEnv("ACME_DIRECTORY_URL")
+	cfg.ACMEHTTPPort = getEnv("ACME_HTTP_PORT", "80")
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return nil, errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if cfg.TLSCertFile != "" && len(cfg.ACMEDomains) > 0 {
+		return nil, errors.New("set either TLS_CERT_FILE and TLS_KEY_FILE or ACME_DOMAINS, not both")
+	}
+
+	if cfg.HTTPReadTimeout, err = getEnvDuration("HTTP_READ_TIMEOUT", 10*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.HTTPWriteTimeout, err = getEnvDuration("HTTP_WRITE_TIMEOUT", 10*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.HTTPIdleTimeout, err = getEnvDuration("HTTP_IDLE_TIMEOUT", 120*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.HTTPMaxHeaderBytes, err = getEnvSize("HTTP_MAX_HEADER_BYTES", 1<<20); err != nil {
+		return nil, err
+	}
+	if cfg.HTTPMaxBodyBytes, err = getEnvSize("HTTP_MAX_BODY_BYTES", 0); err != nil {
+		return nil, err
+	}
+
+	if cfg.DeliveryRetention, err = getEnvDuration("DELIVERY_RETENTION", 72*time.Hour); err != nil {
+		return nil, err
+	}
+	if cfg.ArchiveRetention, err = getEnvDuration("ARCHIVE_RETENTION", 30*24*time.Hour); err != nil {
+		return nil, err
+	}
+	if cfg.DataDir != "" {
+		if err := os.MkdirAll(cfg.DataDir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create DATA_DIR: %w", err)
+		}
+	}
+	if cfg.QueueBackend == "sqlite" {
+		if cfg.SQLitePath = getEnv("SQLITE_PATH", cfg.DataPath("queue.db")); cfg.SQLitePath == "" {
+			return nil, errors.New("SQLITE_PATH or DATA_DIR is required when QUEUE_BACKEND=sqlite")
+		}
+	}
+	// Certificates must outlive restarts, or every restart requests new ones
+	if len(cfg.ACMEDomains) > 0 {
+		if cfg.ACMECacheDir = getEnv("ACME_CACHE_DIR", cfg.DataPath("acme")); cfg.ACMECacheDir == "" {
+			return nil, errors.New("ACME_CACHE_DIR or DATA_DIR is required with ACME_DOMAINS")
+		}
+	}
+
+	// Parse stale PR policy
+	if cfg.StalePRNudgeDays, err = getEnvInt("STALE_PR_NUDGE_DAYS", 0); err != nil {
+		return nil, err
+	}
+	if cfg.StalePRCloseDays, err = getEnvInt("STALE_PR_CLOSE_DAYS", 0); err != nil {
+		return nil, err
+	}
+	if cfg.StalePRCheckInterval, err = getEnvDuration("STALE_PR_CHECK_INTERVAL", 6*time.Hour); err != nil {
+		return nil, err
+	}
+	if cfg.FeedbackSyncInterval, err = getEnvDuration("FEEDBACK_SYNC_INTERVAL", time.Hour); err != nil {
+		return nil, err
+	}
+	if cfg.StalePRNudgeDays > 0 && cfg.StalePRCloseDays > 0 && cfg.StalePRCloseDays <= cfg.StalePRNudgeDays {
+		return nil, errors.New("STALE_PR_CLOSE_DAYS must be greater than STALE_PR_NUDGE_DAYS")
+	}
+	if cfg.ConfigPollInterval, err = getEnvDuration("CONFIG_POLL_INTERVAL", 30*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.SecretsRefreshInterval, err = getEnvDuration("SECRETS_REFRESH_INTERVAL", time.Hour); err != nil {
+		return nil, err
+	}
+
+	// Apply each repository's REPO_<NAME>_* settings over the defaults
+	resolvers = append(resolvers, func(m *RepoMapping) error {
+		m.BranchPrefix = DefaultBranchPrefix
+		m.MaxPRsPerDay = cfg.PRBudgetPerDay
+		m.Assignees = cfg.PRAssignees
+		m.Reviewers = cfg.PRReviewers
+		m.Flags = cfg.Flags
+		// A base branch given in the mapping wins over the repository's
+		mappingBase := m.BaseBranch
+		if err := applyRepoSettings(m); err != nil {
+			return err
+		}
+		if mappingBase != "" {
+			m.BaseBranch = mappingBase
+		}
+		// Repositories' labels add to the global ones
+		m.Labels = append(slices.Clone(cfg.PRLabels), m.Labels...)
+		if cfg.DryRun {
+			m.Flags.DryRun = true
+		}
+		m.applyFlags()
+		return nil
+	})
+	cfg.resolveRepo = func(m *RepoMapping) error {
+		for _, resolve := range resolvers {
+			if err := resolve(m); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, m := range cfg.AllRepoMappings() {
+		if err := cfg.resolveRepo(m); err != nil {
+			return nil, err
+		}
+	}
 
 	return cfg, nil
 }
 
+// parsePrefixes parses a comma-separated list of CIDRs or bare IP addresses.
+func parsePrefixes(key string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range strings.Split(lookupEnv(key), ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid address %q: %w", key, entry, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid CIDR %q: %w", key, entry, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
 // parseRepoMappings parses the REPO_MAPPINGS environment variable.
 // Format: sentry-project1:owner1/repo1,sentry-project2:owner2/repo2
 func parseRepoMappings(s string) ([]RepoMapping, error) {
@@ -68,7 +1219,7 @@ func parseRepoMappings(s string) ([]RepoMapping, error) {
 			continue
 		}
 
-		// Split sentry-project:owner/repo
+		// Split sentry-project:owner/repo[@branch]
 		parts := strings.SplitN(pair, ":", 2)
 		if len(parts) != 2 {
 			return nil, fmt.Errorf("invalid repo mapping format: %q (expected sentry-project:owner/repo)", pair)
@@ -76,9 +1227,19 @@ func parseRepoMappings(s string) ([]RepoMapping, error) {
 
 		sentryProject := strings.TrimSpace(parts[0])
 		repoPath := strings.TrimSpace(parts[1])
+		if _, err := path.Match(sentryProject, ""); err != nil || sentryProject == "" {
+			return nil, fmt.Errorf("invalid sentry project %q in repo mapping %q", sentryProject, pair)
+		}
+
+		// Split off an optional @base-branch
+		repoPath, baseBranch, hasBase := strings.Cut(repoPath, "@")
+		baseBranch = strings.TrimSpace(baseBranch)
+		if hasBase && (baseBranch == "" || strings.ContainsAny(baseBranch, " ~^:?*[\\") || strings.Contains(baseBranch, "..")) {
+			return nil, fmt.Errorf("invalid base branch %q in repo mapping %q", baseBranch, pair)
+		}
 
 		// Split owner/repo
-		repoParts := strings.SplitN(repoPath, "/", 2)
+		repoParts := strings.SplitN(strings.TrimSpace(repoPath), "/", 2)
 		if len(repoParts) != 2 {
 			return nil, fmt.Errorf("invalid repo path format: %q (expected owner/repo)", repoPath)
 		}
@@ -87,6 +1248,7 @@ func parseRepoMappings(s string) ([]RepoMapping, error) {
 			SentryProject: sentryProject,
 			Owner:         strings.TrimSpace(repoParts[0]),
 			Repo:          strings.TrimSpace(repoParts[1]),
+			BaseBranch:    baseBranch,
 		})
 	}
 
@@ -97,19 +1259,348 @@ func parseRepoMappings(s string) ([]RepoMapping, error) {
 	return mappings, nil
 }
 
-// GetRepoMapping returns the repo mapping for a Sentry project, or nil if not found.
-func (c *Config) GetRepoMapping(sentryProject string) *RepoMapping {
+// parseStyleGuidePaths parses the STYLE_GUIDE_PATHS environment variable.
+// Format: owner1/repo1:path/to/STYLE.md,owner2/repo2:CONTRIBUTING.md
+func parseStyleGuidePaths(s string) (map[string]string, error) {
+	paths := make(map[string]string)
+
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		repo, path, ok := strings.Cut(pair, ":")
+		repo, path = strings.TrimSpace(repo), strings.TrimSpace(path)
+		if !ok || !strings.Contains(repo, "/") || path == "" {
+			return nil, fmt.Errorf("invalid style guide path: %q (expected owner/repo:path)", pair)
+		}
+		paths[repo] = path
+	}
+
+	return paths, nil
+}
+
+// loadPromptTemplate reads the prompt template at path, checking that it
+// parses. Templates already read are kept in loaded, since repositories may
+// share one. An empty path has no template.
+func loadPromptTemplate(loaded map[string]string, path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	if text, ok := loaded[path]; ok {
+		return text, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("prompt template: %w", err)
+	}
+	text := string(data)
+	if _, err := template.New(path).Parse(text); err != nil {
+		return "", fmt.Errorf("prompt template: %w", err)
+	}
+	loaded[path] = text
+	return text, nil
+}
+
+// parseCommands parses a per-repository command variable such as
+// TEST_COMMANDS. Entries are separated by semicolons, since commands may
+// contain commas.
+func parseCommands(name, s string) (map[string]string, error) {
+	commands := make(map[string]string)
+
+	for _, pair := range strings.Split(s, ";") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		repo, command, ok := strings.Cut(pair, "=")
+		repo, command = strings.TrimSpace(repo), strings.TrimSpace(command)
+		if !ok || !strings.Contains(repo, "/") {
+			return nil, fmt.Errorf("%s: invalid entry %q (expected owner/repo=command)", name, pair)
+		}
+		commands[repo] = command
+	}
+
+	return commands, nil
+}
+
+// fixSizeLimit is a repository's cap on the files and lines of a fix.
+type fixSizeLimit struct {
+	files, lines int
+}
+
+// parseFixSizeLimits parses the FIX_SIZE_LIMITS environment variable.
+func parseFixSizeLimits(s string) (map[string]fixSizeLimit, error) {
+	entries, err := parseCommands("FIX_SIZE_LIMITS", s)
+	if err != nil {
+		return nil, err
+	}
+
+	limits := make(map[string]fixSizeLimit)
+	for repo, entry := range entries {
+		files, lines, ok := strings.Cut(entry, "/")
+		var l fixSizeLimit
+		var filesErr, linesErr error
+		l.files, filesErr = strconv.Atoi(strings.TrimSpace(files))
+		l.lines, linesErr = strconv.Atoi(strings.TrimSpace(lines))
+		if !ok || filesErr != nil || linesErr != nil || l.files < 0 || l.lines < 0 {
+			return nil, fmt.Errorf("FIX_SIZE_LIMITS: invalid limits %q for %s (expected files/lines)", entry, repo)
+		}
+		limits[repo] = l
+	}
+
+	return limits, nil
+}
+
+// parseSeverityThresholds parses the SEVERITY_THRESHOLDS environment
+// variable.
+func parseSeverityThresholds(s string) (map[string]filter.SeverityThreshold, error) {
+	thresholds := make(map[string]filter.SeverityThreshold)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		project, entry, ok := strings.Cut(pair, "=")
+		project = strings.TrimSpace(project)
+		if !ok || project == "" {
+			return nil, fmt.Errorf("SEVERITY_THRESHOLDS: invalid entry %q (expected project=level/events/users)", pair)
+		}
+		t, err := filter.ParseSeverityThreshold(entry)
+		if err != nil {
+			return nil, fmt.Errorf("SEVERITY_THRESHOLDS: %s: %w", project, err)
+		}
+		thresholds[project] = t
+	}
+	return thresholds, nil
+}
+
+// parseProjectEnvironments parses the PROJECT_ENVIRONMENTS environment
+// variable.
+func parseProjectEnvironments(s string) (map[string][]string, error) {
+	environments := make(map[string][]string)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		project, list, ok := strings.Cut(pair, "=")
+		project = strings.TrimSpace(project)
+		var envs []string
+		for _, env := range strings.Split(list, "|") {
+			if env = strings.TrimSpace(env); env != "" {
+				envs = append(envs, env)
+			}
+		}
+		if !ok || project == "" || len(envs) == 0 {
+			return nil, fmt.Errorf("PROJECT_ENVIRONMENTS: invalid entry %q (expected project=env1|env2)", pair)
+		}
+		environments[project] = envs
+	}
+	return environments, nil
+}
+
+// DataPath returns the path of a state file inside DataDir, or "" if state
+// should be kept in memory.
+func (c *Config) DataPath(name string) string {
+	if c.DataDir == "" {
+		return ""
+	}
+	return filepath.Join(c.DataDir, name)
+}
+
+// TenantSentryAuthToken returns the Sentry auth token of a tenant. The
+// default tenant is "".
+func (c *Config) TenantSentryAuthToken(tenant string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if tenant == "" {
+		return c.SentryAuthToken
+	}
+	for _, t := range c.Tenants {
+		if t.Name == tenant {
+			return t.SentryAuthToken
+		}
+	}
+	return ""
+}
+
+// TenantWebhookSecret returns the secret signing a tenant's webhooks. The
+// default tenant is "".
+func (c *Config) TenantWebhookSecret(tenant string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if tenant == "" {
+		return c.SentryWebhookSecret
+	}
+	for _, t := range c.Tenants {
+		if t.Name == tenant {
+			return t.SentryWebhookSecret
+		}
+	}
+	return ""
+}
+
+// TenantSentryOrg returns the Sentry organization of a tenant, or "" if not
+// configured. The default tenant is "".
+func (c *Config) TenantSentryOrg(tenant string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if tenant == "" {
+		return c.SentryOrg
+	}
+	for _, t := range c.Tenants {
+		if t.Name == tenant {
+			return t.SentryOrg
+		}
+	}
+	return ""
+}
+
+// TenantSentryURL returns the URL of the Sentry instance hosting a tenant's
+// organization. The default tenant is "".
+func (c *Config) TenantSentryURL(tenant string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, t := range c.Tenants {
+		if t.Name == tenant {
+			return t.SentryURL
+		}
+	}
+	return c.SentryURL
+}
+
+// GetRepoMapping returns a tenant's repo mapping for a Sentry project, or nil
+// if not found. The default tenant is "". A mapping naming the project wins
+// over glob mappings, which win over RepoPatterns; both are tried in the
+// order they were listed.
+func (c *Config) GetRepoMapping(tenant, sentryProject string) *RepoMapping {
+	var matched *RepoMapping
+	for _, m := range c.AllRepoMappings() {
+		if m.Tenant != tenant {
+			continue
+		}
+		if m.SentryProject == sentryProject {
+			return m
+		}
+		if matched == nil && m.IsPattern() && m.Matches(sentryProject) {
+			matched = m
+		}
+	}
+	if matched != nil {
+		return matched
+	}
+	return c.resolvePattern(tenant, sentryProject)
+}
+
+// AllRepoMappings returns the repo mappings of every tenant, starting with the
+// default tenant's, followed by those resolved from patterns so far.
+func (c *Config) AllRepoMappings() []*RepoMapping {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var all []*RepoMapping
 	for i := range c.RepoMappings {
-		if c.RepoMappings[i].SentryProject == sentryProject {
-			return &c.RepoMappings[i]
+		all = append(all, &c.RepoMappings[i])
+	}
+	for t := range c.Tenants {
+		for i := range c.Tenants[t].RepoMappings {
+			all = append(all, &c.Tenants[t].RepoMappings[i])
 		}
 	}
-	return nil
+	return append(all, c.resolved...)
 }
 
 func getEnv(key, defaultVal string) string {
-	if val := os.Getenv(key); val != "" {
+	if val := lookupEnv(key); val != "" {
 		return val
 	}
 	return defaultVal
 }
+
+func getEnvInt(key string, defaultVal int) (int, error) {
+	val := lookupEnv(key)
+	if val == "" {
+		return defaultVal, nil
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer, got %q", key, val)
+	}
+	return n, nil
+}
+
+func getEnvFloat(key string, defaultVal float64) (float64, error) {
+	val := lookupEnv(key)
+	if val == "" {
+		return defaultVal, nil
+	}
+	f, err := strconv.ParseFloat(val, 64)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative number, got %q", key, val)
+	}
+	return f, nil
+}
+
+// getEnvSize reads a size in bytes, optionally with a k, m or g suffix for
+// KiB, MiB or GiB.
+func getEnvSize(key string, defaultVal int64) (int64, error) {
+	val := lookupEnv(key)
+	if val == "" {
+		return defaultVal, nil
+	}
+	num, unit := strings.ToLower(val), int64(1)
+	for suffix, u := range map[string]int64{"k": 1 << 10, "m": 1 << 20, "g": 1 << 30} {
+		if n, ok := strings.CutSuffix(num, suffix); ok {
+			num, unit = n, u
+			break
+		}
+	}
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative size in bytes (e.g. 512m, 4g), got %q", key, val)
+	}
+	return n * unit, nil
+}
+
+func getEnvBool(key string, defaultVal bool) (bool, error) {
+	val := lookupEnv(key)
+	if val == "" {
+		return defaultVal, nil
+	}
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		return false, fmt.Errorf("%s must be true or false, got %q", key, val)
+	}
+	return b, nil
+}
+
+func getEnvDuration(key string, defaultVal time.Duration) (time.Duration, error) {
+	val := lookupEnv(key)
+	if val == "" {
+		return defaultVal, nil
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("%s must be a positive duration (e.g. 30m, 6h), got %q", key, val)
+	}
+	return d, nil
+}
+
+// getEnvDurationAllowZero is getEnvDuration for settings where 0 disables
+// what they configure.
+func getEnvDurationAllowZero(key string, defaultVal time.Duration) (time.Duration, error) {
+	val := lookupEnv(key)
+	if val == "" {
+		return defaultVal, nil
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative duration (e.g. 30m, 6h), got %q", key, val)
+	}
+	return d, nil
+}
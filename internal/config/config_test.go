@@ -0,0 +1,95 @@
+package config
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseProjectEnvironments(t *testing.T) {
+	tests := []struct {
+		in   string
+		want map[string][]string
+	}{
+		{"", map[string][]string{}},
+		{" , ", map[string][]string{}},
+		{"backend=production", map[string][]string{"backend": {"production"}}},
+		{
+			"backend = production | staging ,web=production",
+			map[string][]string{"backend": {"production", "staging"}, "web": {"production"}},
+		},
+		{"backend=production||", map[string][]string{"backend": {"production"}}},
+	}
+	for _, tt := range tests {
+		got, err := parseProjectEnvironments(tt.in)
+		if err != nil {
+			t.Errorf("parseProjectEnvironments(%q) error = %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseProjectEnvironments(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"backend", "=production", "backend=", "backend=|", "backend=production,web"} {
+		if _, err := parseProjectEnvironments(bad); err == nil {
+			t.Errorf("parseProjectEnvironments(%q) expected error", bad)
+		}
+	}
+}
+
+func TestGetEnvDuration(t *testing.T) {
+	loadMu.Lock()
+	defer loadMu.Unlock()
+
+	t.Setenv("TEST_DURATION", "0")
+	if _, err := getEnvDuration("TEST_DURATION", time.Hour); err == nil {
+		t.Error("getEnvDuration(0) expected error")
+	}
+	if d, err := getEnvDurationAllowZero("TEST_DURATION", time.Hour); err != nil || d != 0 {
+		t.Errorf("getEnvDurationAllowZero(0) = %v, %v, want 0", d, err)
+	}
+
+	t.Setenv("TEST_DURATION", "-1m")
+	if _, err := getEnvDurationAllowZero("TEST_DURATION", time.Hour); err == nil {
+		t.Error("getEnvDurationAllowZero(-1m) expected error")
+	}
+
+	t.Setenv("TEST_DURATION", "")
+	if d, err := getEnvDurationAllowZero("TEST_DURATION", time.Hour); err != nil || d != time.Hour {
+		t.Errorf("getEnvDurationAllowZero() unset = %v, %v, want the default", d, err)
+	}
+}
+
+func TestLoad_ZeroDisables(t *testing.T) {
+	setRequiredEnv(t, map[string]string{"PROCESSING_DELAY": "0", "PROCESS_CPU_LIMIT": "0s", "TEST_TIMEOUT": "0"})
+	cfg := mustLoad(t)
+	if cfg.ProcessingDelay != 0 || cfg.ProcessCPULimit != 0 || cfg.TestTimeout != 0 {
+		t.Errorf("ProcessingDelay = %v, ProcessCPULimit = %v, TestTimeout = %v, want 0",
+			cfg.ProcessingDelay, cfg.ProcessCPULimit, cfg.TestTimeout)
+	}
+}
+
+func TestLoad_RegressionTestCommand(t *testing.T) {
+	setRequiredEnv(t, map[string]string{
+		"REPO_MAPPINGS":                         "backend:acme/backend,web:acme/web,api:acme/api",
+		"REGRESSION_TEST_COMMAND":               "make test-one TEST={filter}",
+		"REGRESSION_TEST_COMMANDS":              "acme/web=npx jest {files}",
+		"REPO_ACME_API_REGRESSION_TEST_COMMAND": "go test ./... -run {filter}",
+		"CHECK_ENV":                             "NPM_TOKEN, PIP_INDEX_URL",
+	})
+	cfg := mustLoad(t)
+	for project, want := range map[string]string{
+		"backend": "make test-one TEST={filter}",
+		"web":     "npx jest {files}",
+		"api":     "go test ./... -run {filter}",
+	} {
+		if got := cfg.GetRepoMapping("", project).RegressionTestCommand; got != want {
+			t.Errorf("RegressionTestCommand(%s) = %q, want %q", project, got, want)
+		}
+	}
+	if !slices.Equal(cfg.CheckEnv, []string{"NPM_TOKEN", "PIP_INDEX_URL"}) {
+		t.Errorf("CheckEnv = %q, want NPM_TOKEN and PIP_INDEX_URL", cfg.CheckEnv)
+	}
+}
@@ -0,0 +1,63 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// loadMu serializes Load, which reads the config file into fileValues.
+var (
+	loadMu     sync.Mutex
+	fileValues map[string]string
+)
+
+// lookupEnv returns a setting from the environment or, if it is not set
+// there, from the config file. Callers must hold loadMu.
+func lookupEnv(key string) string {
+	if val, ok := os.LookupEnv(key); ok {
+		return val
+	}
+	return fileValues[key]
+}
+
+// readConfigFile parses a file of KEY=value lines, as in a .env file. Blank
+// lines and lines starting with # are ignored, and values may be quoted.
+func readConfigFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("CONFIG_FILE: %w", err)
+	}
+	defer f.Close()
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, val, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		key, val = strings.TrimSpace(key), strings.TrimSpace(val)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("CONFIG_FILE: %s:%d: expected KEY=value", path, n)
+		}
+		if len(val) >= 2 && val[0] == '"' && val[len(val)-1] == '"' {
+			if val, err = strconv.Unquote(val); err != nil {
+				return nil, fmt.Errorf("CONFIG_FILE: %s:%d: invalid quoted value for %s", path, n, key)
+			}
+		} else if len(val) >= 2 && val[0] == '\'' && val[len(val)-1] == '\'' {
+			val = val[1 : len(val)-1]
+		}
+		values[key] = val
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("CONFIG_FILE: %w", err)
+	}
+	return values, nil
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Flags switch capabilities on or off, globally with FLAGS and per
+// repository with REPO_<NAME>_FLAGS, so risky ones can be rolled out a few
+// repositories at a time.
+type Flags struct {
+	// EnableTests runs the repository's tests and each fix's regression
+	// test before proposing the fix.
+	EnableTests bool
+	// EnableBuildCheck builds the repository with each fix applied.
+	EnableBuildCheck bool
+	// DraftPRsOnly opens every fix PR as a draft.
+	DraftPRsOnly bool
+	// AnalysisOnly posts each fix's analysis instead of opening a PR.
+	AnalysisOnly bool
+	// DryRun generates fixes but only logs them.
+	DryRun bool
+}
+
+// DefaultFlags are the flags of repositories that set none.
+var DefaultFlags = Flags{EnableTests: true, EnableBuildCheck: true}
+
+// parseFlags sets the flags listed in s, a comma-separated list of
+// name=true|false entries, over f. A bare name turns its flag on.
+func parseFlags(key, s string, f Flags) (Flags, error) {
+	for _, entry := range strings.Split(s, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+
+		name, val, hasVal := strings.Cut(entry, "=")
+		on := true
+		if hasVal {
+			var err error
+			if on, err = strconv.ParseBool(strings.TrimSpace(val)); err != nil {
+				return f, fmt.Errorf("%s: invalid value %q for flag %s", key, val, name)
+			}
+		}
+
+		switch strings.TrimSpace(name) {
+		case "enable_tests":
+			f.EnableTests = on
+		case "enable_build_check":
+			f.EnableBuildCheck = on
+		case "draft_prs_only":
+			f.DraftPRsOnly = on
+		case "analysis_only":
+			f.AnalysisOnly = on
+		case "dry_run":
+			f.DryRun = on
+		default:
+			return f, fmt.Errorf("%s: unknown flag %q (expected enable_tests, enable_build_check, draft_prs_only, analysis_only or dry_run)", key, name)
+		}
+	}
+	return f, nil
+}
+
+// applyFlags turns the mapping's flags into the settings they override.
+func (m *RepoMapping) applyFlags() {
+	if !m.Flags.EnableTests {
+		m.TestCommand = ""
+		m.SkipRegressionTests = true
+	}
+	if !m.Flags.EnableBuildCheck {
+		m.BuildCommand = ""
+	}
+	if m.Flags.DraftPRsOnly {
+		m.DraftPRs = true
+	}
+	if m.Flags.AnalysisOnly {
+		m.AnalysisOnly = true
+	}
+	m.DryRun = m.Flags.DryRun
+}
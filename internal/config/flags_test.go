@@ -0,0 +1,55 @@
+package config
+
+import "testing"
+
+func TestParseFlags(t *testing.T) {
+	tests := []struct {
+		in   string
+		base Flags
+		want Flags
+	}{
+		{"", DefaultFlags, DefaultFlags},
+		{"dry_run", DefaultFlags, Flags{EnableTests: true, EnableBuildCheck: true, DryRun: true}},
+		{" enable_tests=false , draft_prs_only ", DefaultFlags, Flags{EnableBuildCheck: true, DraftPRsOnly: true}},
+		{"enable_build_check=0,analysis_only=TRUE", DefaultFlags, Flags{EnableTests: true, AnalysisOnly: true}},
+		{"dry_run=false", Flags{DryRun: true, DraftPRsOnly: true}, Flags{DraftPRsOnly: true}},
+		{"enable_tests,", Flags{}, Flags{EnableTests: true}},
+	}
+	for _, tt := range tests {
+		got, err := parseFlags("FLAGS", tt.in, tt.base)
+		if err != nil {
+			t.Errorf("parseFlags(%q) error = %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseFlags(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"dry_runs", "dry_run=maybe", "=true"} {
+		if _, err := parseFlags("FLAGS", bad, DefaultFlags); err == nil {
+			t.Errorf("parseFlags(%q) expected error", bad)
+		}
+	}
+}
+
+func TestRepoMapping_ApplyFlags(t *testing.T) {
+	m := &RepoMapping{
+		TestCommand:  "make test",
+		BuildCommand: "make",
+		Flags:        Flags{DraftPRsOnly: true, AnalysisOnly: true, DryRun: true},
+	}
+	m.applyFlags()
+	if m.TestCommand != "" || !m.SkipRegressionTests || m.BuildCommand != "" {
+		t.Errorf("disabled checks left TestCommand=%q SkipRegressionTests=%v BuildCommand=%q", m.TestCommand, m.SkipRegressionTests, m.BuildCommand)
+	}
+	if !m.DraftPRs || !m.AnalysisOnly || !m.DryRun {
+		t.Errorf("applyFlags() = DraftPRs %v, AnalysisOnly %v, DryRun %v, want all set", m.DraftPRs, m.AnalysisOnly, m.DryRun)
+	}
+
+	m = &RepoMapping{TestCommand: "make test", BuildCommand: "make", Flags: DefaultFlags}
+	m.applyFlags()
+	if m.TestCommand != "make test" || m.SkipRegressionTests || m.BuildCommand != "make" || m.DryRun {
+		t.Errorf("default flags changed the mapping to %+v", m)
+	}
+}
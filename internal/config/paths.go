@@ -0,0 +1,88 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// MayChange reports whether fixes may change the repo-relative file: it must
+// match one of AllowedPaths, if any, and none of DeniedPaths.
+func (m *RepoMapping) MayChange(name string) bool {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	for _, pattern := range m.DeniedPaths {
+		if matchPath(pattern, name) {
+			return false
+		}
+	}
+	if len(m.AllowedPaths) == 0 {
+		return true
+	}
+	for _, pattern := range m.AllowedPaths {
+		if matchPath(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsPattern reports whether the mapping's SentryProject is a glob.
+func (m *RepoMapping) IsPattern() bool {
+	return strings.ContainsAny(m.SentryProject, "*?[")
+}
+
+// Matches reports whether the mapping applies to a Sentry project slug,
+// either by name or through its glob.
+func (m *RepoMapping) Matches(project string) bool {
+	if m.SentryProject == project {
+		return true
+	}
+	ok, _ := path.Match(m.SentryProject, project)
+	return m.IsPattern() && ok
+}
+
+// parsePathGlobs parses a comma-separated list of globs for MayChange.
+func parsePathGlobs(name, s string) ([]string, error) {
+	var globs []string
+	for _, glob := range strings.Split(s, ",") {
+		if glob = strings.TrimSpace(glob); glob == "" {
+			continue
+		}
+		if _, err := path.Match(glob, ""); err != nil {
+			return nil, fmt.Errorf("%s: invalid glob %q", name, glob)
+		}
+		globs = append(globs, glob)
+	}
+	return globs, nil
+}
+
+// matchPath reports whether a repo-relative file matches a glob. Besides
+// path.Match syntax within each segment, "**" matches any number of
+// directories and a trailing "/" everything below a directory.
+func matchPath(pattern, name string) bool {
+	if strings.HasSuffix(pattern, "/") {
+		pattern += "**"
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := range len(name) + 1 {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
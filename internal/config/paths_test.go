@@ -0,0 +1,90 @@
+package config
+
+import "testing"
+
+func TestRepoMapping_Matches(t *testing.T) {
+	tests := []struct {
+		mapping     string
+		project     string
+		wantPattern bool
+		want        bool
+	}{
+		{"backend", "backend", false, true},
+		{"backend", "backend-api", false, false},
+		{"svc-*", "svc-billing", true, true},
+		{"svc-*", "svc-", true, true},
+		{"svc-*", "web-svc-billing", true, false},
+		{"svc-?", "svc-a", true, true},
+		{"svc-?", "svc-ab", true, false},
+		{"[ab]-web", "b-web", true, true},
+		{"[ab]-web", "c-web", true, false},
+	}
+	for _, tt := range tests {
+		m := &RepoMapping{SentryProject: tt.mapping}
+		if got := m.IsPattern(); got != tt.wantPattern {
+			t.Errorf("IsPattern(%q) = %v, want %v", tt.mapping, got, tt.wantPattern)
+		}
+		if got := m.Matches(tt.project); got != tt.want {
+			t.Errorf("Matches(%q, %q) = %v, want %v", tt.mapping, tt.project, got, tt.want)
+		}
+	}
+}
+
+func TestGetRepoMapping_Globs(t *testing.T) {
+	cfg := &Config{RepoMappings: []RepoMapping{
+		{SentryProject: "svc-*", Owner: "acme", Repo: "services"},
+		{SentryProject: "svc-b*", Owner: "acme", Repo: "b-services"},
+		{SentryProject: "svc-billing", Owner: "acme", Repo: "billing"},
+		{SentryProject: "svc-billing", Owner: "team-a", Repo: "billing", Tenant: "team-a"},
+	}}
+
+	tests := []struct {
+		tenant, project string
+		want            string
+	}{
+		{"", "svc-billing", "acme/billing"},  // exact beats an earlier glob
+		{"", "svc-orders", "acme/services"},  // first matching glob
+		{"", "svc-banking", "acme/services"}, // globs are tried in order
+		{"team-a", "svc-billing", "team-a/billing"},
+		{"team-a", "svc-orders", ""}, // globs belong to their tenant
+		{"", "web", ""},
+	}
+	for _, tt := range tests {
+		m := cfg.GetRepoMapping(tt.tenant, tt.project)
+		got := ""
+		if m != nil {
+			got = m.FullName()
+		}
+		if got != tt.want {
+			t.Errorf("GetRepoMapping(%q, %q) = %q, want %q", tt.tenant, tt.project, got, tt.want)
+		}
+	}
+}
+
+func TestRepoMapping_MayChange(t *testing.T) {
+	tests := []struct {
+		name            string
+		allowed, denied []string
+		file            string
+		want            bool
+	}{
+		{"no rules", nil, nil, "main.go", true},
+		{"star stays in its directory", []string{"src/*.go"}, nil, "src/main.go", true},
+		{"star doesn't cross directories", []string{"src/*.go"}, nil, "src/pkg/main.go", false},
+		{"double star crosses directories", []string{"src/**/*.go"}, nil, "src/pkg/sub/main.go", true},
+		{"double star matches no directory", []string{"src/**/*.go"}, nil, "src/main.go", true},
+		{"trailing slash covers the tree", []string{"src/"}, nil, "src/pkg/main.go", true},
+		{"trailing slash needs the directory", []string{"src/"}, nil, "srcs/main.go", false},
+		{"denied wins", []string{"src/"}, []string{"src/generated/"}, "src/generated/api.go", false},
+		{"denied only", nil, []string{"**/*.pb.go"}, "api/v1/api.pb.go", false},
+		{"path is cleaned", []string{"src/"}, nil, "./lib/../src/main.go", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &RepoMapping{AllowedPaths: tt.allowed, DeniedPaths: tt.denied}
+			if got := m.MayChange(tt.file); got != tt.want {
+				t.Errorf("MayChange(%q) = %v, want %v", tt.file, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// RepoPattern maps every Sentry project matching a regular expression to the
+// repository named by substituting its capture groups into Owner and Repo,
+// e.g. "^svc-(.+)$" to acme/$1.
+type RepoPattern struct {
+	Project *regexp.Regexp
+	Owner   string
+	Repo    string
+
+	// Tenant owning the pattern, "" for the default tenant.
+	Tenant string
+	// GitHubToken is the credential used for the repositories.
+	GitHubToken string
+}
+
+// mapping returns the repo mapping the pattern gives project, without its
+// per-repo settings, and whether project matches.
+func (p *RepoPattern) mapping(project string) (*RepoMapping, bool) {
+	match := p.Project.FindStringSubmatchIndex(project)
+	if match == nil {
+		return nil, false
+	}
+	owner := string(p.Project.ExpandString(nil, p.Owner, project, match))
+	repo := string(p.Project.ExpandString(nil, p.Repo, project, match))
+	if !validRepoPart(owner) || !validRepoPart(repo) {
+		log.Printf("Repo mapping pattern %s gives project %s the invalid repository %s/%s", p.Project, project, owner, repo)
+		return nil, false
+	}
+	return &RepoMapping{
+		SentryProject: project,
+		Owner:         owner,
+		Repo:          repo,
+		Tenant:        p.Tenant,
+		GitHubToken:   p.GitHubToken,
+	}, true
+}
+
+// validRepoPart reports whether s can be a GitHub owner or repository name.
+func validRepoPart(s string) bool {
+	return s != "" && s != "." && s != ".." && !strings.ContainsAny(s, "/ \t\n")
+}
+
+// parseRepoPatterns parses a REPO_MAPPING_PATTERNS variable. Entries are
+// separated by semicolons and each is regex=owner/repo, split at the last
+// "=" since the expression may contain one.
+func parseRepoPatterns(name, s string) ([]RepoPattern, error) {
+	var patterns []RepoPattern
+	for _, entry := range strings.Split(s, ";") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+
+		i := strings.LastIndex(entry, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("%s: invalid entry %q (expected regex=owner/repo)", name, entry)
+		}
+		expr, target := strings.TrimSpace(entry[:i]), strings.TrimSpace(entry[i+1:])
+		owner, repo, ok := strings.Cut(target, "/")
+		if !ok || owner == "" || repo == "" || strings.Contains(repo, "/") {
+			return nil, fmt.Errorf("%s: invalid repository %q (expected owner/repo)", name, target)
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid pattern %q: %w", name, expr, err)
+		}
+		patterns = append(patterns, RepoPattern{Project: re, Owner: owner, Repo: repo})
+	}
+	return patterns, nil
+}
+
+// resolvePattern returns the repo mapping a tenant's patterns give a Sentry
+// project, or nil if none matches. Mappings are created with their per-repo
+// settings on first use and kept until the next reload.
+func (c *Config) resolvePattern(tenant, project string) *RepoMapping {
+	c.mu.RLock()
+	var patterns []RepoPattern
+	if tenant == "" {
+		patterns = c.RepoPatterns
+	}
+	for _, t := range c.Tenants {
+		if t.Name == tenant {
+			patterns = t.RepoPatterns
+		}
+	}
+	resolve := c.resolveRepo
+	c.mu.RUnlock()
+
+	for i := range patterns {
+		m, ok := patterns[i].mapping(project)
+		if !ok {
+			continue
+		}
+		if resolve != nil {
+			loadMu.Lock()
+			err := resolve(m)
+			loadMu.Unlock()
+			if err != nil {
+				log.Printf("Settings of %s, mapped from project %s, are invalid: %v", m.FullName(), project, err)
+				return nil
+			}
+		}
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for _, r := range c.resolved {
+			if r.Tenant == tenant && r.SentryProject == project {
+				return r
+			}
+		}
+		c.resolved = append(c.resolved, m)
+		return m
+	}
+	return nil
+}
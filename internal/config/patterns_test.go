@@ -0,0 +1,94 @@
+package config
+
+import "testing"
+
+func TestParseRepoPatterns(t *testing.T) {
+	patterns, err := parseRepoPatterns("REPO_MAPPING_PATTERNS", " ^svc-(.+)$=acme/$1 ; ^(?P<team>[a-z]+)-web$=$team/web;")
+	if err != nil {
+		t.Fatalf("parseRepoPatterns() error = %v", err)
+	}
+	if len(patterns) != 2 {
+		t.Fatalf("parseRepoPatterns() returned %d patterns, want 2", len(patterns))
+	}
+	if got := patterns[0].Project.String(); got != "^svc-(.+)$" {
+		t.Errorf("pattern = %q, want ^svc-(.+)$", got)
+	}
+	if patterns[1].Owner != "$team" || patterns[1].Repo != "web" {
+		t.Errorf("target = %s/%s, want $team/web", patterns[1].Owner, patterns[1].Repo)
+	}
+
+	// The last "=" splits the entry
+	patterns, err = parseRepoPatterns("REPO_MAPPING_PATTERNS", "^a=b$=acme/ab")
+	if err != nil || len(patterns) != 1 || patterns[0].Project.String() != "^a=b$" {
+		t.Errorf("parseRepoPatterns(^a=b$=acme/ab) = %v, %v", patterns, err)
+	}
+
+	for _, bad := range []string{"^svc$", "^svc$=acme", "^svc$=acme/a/b", "^svc$=/repo", "^(svc$=acme/repo"} {
+		if _, err := parseRepoPatterns("REPO_MAPPING_PATTERNS", bad); err == nil {
+			t.Errorf("parseRepoPatterns(%q) expected error", bad)
+		}
+	}
+}
+
+func TestGetRepoMapping_Patterns(t *testing.T) {
+	patterns, err := parseRepoPatterns("REPO_MAPPING_PATTERNS", "^svc-(.+)$=acme/$1;^(?P<team>[a-z]+)-web$=${team}/web;^bad-(.*)$=acme/$1")
+	if err != nil {
+		t.Fatalf("parseRepoPatterns() error = %v", err)
+	}
+	cfg := &Config{
+		RepoMappings: []RepoMapping{
+			{SentryProject: "svc-legacy", Owner: "acme", Repo: "monolith"},
+			{SentryProject: "svc-pay*", Owner: "acme", Repo: "payments"},
+		},
+		RepoPatterns: patterns,
+	}
+
+	tests := []struct {
+		project string
+		want    string
+	}{
+		{"svc-billing", "acme/billing"},
+		{"payments-web", "payments/web"},
+		{"svc-legacy", "acme/monolith"},  // exact mapping beats the pattern
+		{"svc-payouts", "acme/payments"}, // glob mapping beats the pattern
+		{"frontend", ""},                 // no pattern matches
+		{"bad-", ""},                     // expands to an invalid repository
+	}
+	for _, tt := range tests {
+		m := cfg.GetRepoMapping("", tt.project)
+		got := ""
+		if m != nil {
+			got = m.FullName()
+		}
+		if got != tt.want {
+			t.Errorf("GetRepoMapping(%q) = %q, want %q", tt.project, got, tt.want)
+		}
+	}
+
+	if a, b := cfg.GetRepoMapping("", "svc-billing"), cfg.GetRepoMapping("", "svc-billing"); a != b {
+		t.Error("GetRepoMapping() resolved the same project twice")
+	}
+	if m := cfg.GetRepoMapping("", "svc-billing"); m.SentryProject != "svc-billing" {
+		t.Errorf("SentryProject = %q, want svc-billing", m.SentryProject)
+	}
+}
+
+func TestGetRepoMapping_TenantPatterns(t *testing.T) {
+	patterns, err := parseRepoPatterns("TENANT_TEAM_A_REPO_MAPPING_PATTERNS", "^svc-(.+)$=team-a/$1")
+	if err != nil {
+		t.Fatalf("parseRepoPatterns() error = %v", err)
+	}
+	for i := range patterns {
+		patterns[i].Tenant = "team-a"
+		patterns[i].GitHubToken = "team-a-token"
+	}
+	cfg := &Config{Tenants: []Tenant{{Name: "team-a", RepoPatterns: patterns}}}
+
+	m := cfg.GetRepoMapping("team-a", "svc-billing")
+	if m == nil || m.FullName() != "team-a/billing" || m.Tenant != "team-a" || m.GitHubToken != "team-a-token" {
+		t.Errorf("GetRepoMapping(team-a, svc-billing) = %+v, want team-a/billing with the tenant's token", m)
+	}
+	if m := cfg.GetRepoMapping("", "svc-billing"); m != nil {
+		t.Errorf("GetRepoMapping(default, svc-billing) = %+v, want nil", m)
+	}
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/filter"
+)
+
+// Reload takes the repo mappings and patterns, their per-repo settings, the
+// webhook filters and the Sentry and GitHub credentials, those of existing
+// tenants included, from next, a configuration loaded since c. Mappings already returned by GetRepoMapping
+// keep their old settings, so running jobs are unaffected and queued jobs
+// pick up the new ones. Everything else, tenants added or removed included,
+// needs a restart; the changes to tenants that were not applied are returned.
+func (c *Config) Reload(next *Config) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.SentryWebhookSecret = next.SentryWebhookSecret
+	c.SentryAuthToken = next.SentryAuthToken
+	c.GitHubToken = next.GitHubToken
+	c.RepoMappings = next.RepoMappings
+	c.RepoPatterns = next.RepoPatterns
+	c.resolveRepo = next.resolveRepo
+	c.resolved = nil
+	c.TagFilter = next.TagFilter
+	c.ErrorTypeFilter = next.ErrorTypeFilter
+
+	var skipped []string
+	kept := make(map[string]bool)
+	for i := range c.Tenants {
+		t := &c.Tenants[i]
+		found := false
+		for _, n := range next.Tenants {
+			if n.Name == t.Name {
+				t.SentryWebhookSecret = n.SentryWebhookSecret
+				t.SentryAuthToken = n.SentryAuthToken
+				t.GitHubToken = n.GitHubToken
+				t.RepoMappings = n.RepoMappings
+				t.RepoPatterns = n.RepoPatterns
+				found = true
+				break
+			}
+		}
+		if !found {
+			skipped = append(skipped, fmt.Sprintf("tenant %q was removed", t.Name))
+		}
+		kept[t.Name] = true
+	}
+	for _, n := range next.Tenants {
+		if !kept[n.Name] {
+			skipped = append(skipped, fmt.Sprintf("tenant %q was added", n.Name))
+		}
+	}
+	return skipped
+}
+
+// Filters returns the tag and error type filters evaluated before queueing
+// a job.
+func (c *Config) Filters() (filter.TagFilter, filter.ErrorTypeFilter) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.TagFilter, c.ErrorTypeFilter
+}
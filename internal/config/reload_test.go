@@ -0,0 +1,163 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setRequiredEnv sets the settings Load requires, plus any in extra.
+func setRequiredEnv(t *testing.T, extra map[string]string) {
+	t.Helper()
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("SENTRY_WEBHOOK_SECRET", "webhook-secret")
+	t.Setenv("GITHUB_TOKEN", "github-token")
+	t.Setenv("REPO_MAPPINGS", "backend:acme/backend")
+	for k, v := range extra {
+		t.Setenv(k, v)
+	}
+}
+
+// mustLoad loads the configuration, failing the test on error.
+func mustLoad(t *testing.T) *Config {
+	t.Helper()
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	return cfg
+}
+
+func TestReload_TenantSecrets(t *testing.T) {
+	setRequiredEnv(t, map[string]string{
+		"TENANTS":                             "team-a",
+		"TENANT_TEAM_A_SENTRY_WEBHOOK_SECRET": "old-secret",
+		"TENANT_TEAM_A_SENTRY_AUTH_TOKEN":     "old-token",
+		"TENANT_TEAM_A_GITHUB_TOKEN":          "old-github",
+		"TENANT_TEAM_A_REPO_MAPPINGS":         "web:acme/web",
+	})
+	cfg := mustLoad(t)
+
+	t.Setenv("TENANT_TEAM_A_SENTRY_WEBHOOK_SECRET", "new-secret")
+	t.Setenv("TENANT_TEAM_A_SENTRY_AUTH_TOKEN", "new-token")
+	t.Setenv("TENANT_TEAM_A_GITHUB_TOKEN", "new-github")
+	t.Setenv("TENANT_TEAM_A_REPO_MAPPING_PATTERNS", "^svc-(.+)$=acme/$1")
+	if skipped := cfg.Reload(mustLoad(t)); len(skipped) != 0 {
+		t.Fatalf("Reload() skipped %v", skipped)
+	}
+
+	if got := cfg.TenantWebhookSecret("team-a"); got != "new-secret" {
+		t.Errorf("TenantWebhookSecret() = %q, want new-secret", got)
+	}
+	if got := cfg.TenantSentryAuthToken("team-a"); got != "new-token" {
+		t.Errorf("TenantSentryAuthToken() = %q, want new-token", got)
+	}
+	if m := cfg.GetRepoMapping("team-a", "web"); m == nil || m.GitHubToken != "new-github" {
+		t.Errorf("GetRepoMapping(web) = %+v, want the new GitHub token", m)
+	}
+	m := cfg.GetRepoMapping("team-a", "svc-billing")
+	if m == nil || m.FullName() != "acme/billing" || m.GitHubToken != "new-github" {
+		t.Errorf("GetRepoMapping(svc-billing) = %+v, want acme/billing with the new GitHub token", m)
+	}
+}
+
+func TestReload_SecretsAndMappings(t *testing.T) {
+	setRequiredEnv(t, map[string]string{"STYLE_GUIDE_PATH": "OLD.md"})
+	cfg := mustLoad(t)
+	old := cfg.GetRepoMapping("", "backend")
+
+	t.Setenv("SENTRY_WEBHOOK_SECRET", "rotated-secret")
+	t.Setenv("GITHUB_TOKEN", "rotated-token")
+	t.Setenv("REPO_MAPPINGS", "backend:acme/api,web:acme/web")
+	t.Setenv("STYLE_GUIDE_PATH", "NEW.md")
+	t.Setenv("TAG_EXCLUDE", "environment:staging")
+	cfg.Reload(mustLoad(t))
+
+	if got := cfg.TenantWebhookSecret(""); got != "rotated-secret" {
+		t.Errorf("TenantWebhookSecret() = %q, want rotated-secret", got)
+	}
+	m := cfg.GetRepoMapping("", "backend")
+	if m == nil || m.FullName() != "acme/api" || m.GitHubToken != "rotated-token" || m.StyleGuidePath != "NEW.md" {
+		t.Errorf("GetRepoMapping(backend) = %+v, want acme/api with the new token and settings", m)
+	}
+	if cfg.GetRepoMapping("", "web") == nil {
+		t.Error("GetRepoMapping(web) = nil after it was added")
+	}
+	if old.FullName() != "acme/backend" || old.StyleGuidePath != "OLD.md" {
+		t.Errorf("mapping returned before the reload changed to %+v", old)
+	}
+	if tags, _ := cfg.Filters(); len(tags.Exclude) != 1 {
+		t.Errorf("Filters() tag excludes = %v, want the reloaded rule", tags.Exclude)
+	}
+}
+
+func TestReload_PatternSettings(t *testing.T) {
+	setRequiredEnv(t, map[string]string{
+		"REPO_MAPPING_PATTERNS": "^svc-(.+)$=acme/$1",
+		"STYLE_GUIDE_PATHS":     "acme/billing:OLD.md",
+	})
+	cfg := mustLoad(t)
+	if m := cfg.GetRepoMapping("", "svc-billing"); m == nil || m.StyleGuidePath != "OLD.md" {
+		t.Fatalf("GetRepoMapping(svc-billing) = %+v, want style guide OLD.md", m)
+	}
+
+	// Mappings resolved from patterns are resolved again with the new settings
+	t.Setenv("REPO_MAPPING_PATTERNS", "^svc-(.+)$=acme/$1-service")
+	t.Setenv("STYLE_GUIDE_PATHS", "acme/billing-service:NEW.md")
+	cfg.Reload(mustLoad(t))
+
+	m := cfg.GetRepoMapping("", "svc-billing")
+	if m == nil || m.FullName() != "acme/billing-service" || m.StyleGuidePath != "NEW.md" {
+		t.Errorf("GetRepoMapping(svc-billing) = %+v, want acme/billing-service with style guide NEW.md", m)
+	}
+}
+
+func TestReload_ConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "autopr.env")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	setRequiredEnv(t, nil)
+	os.Unsetenv("REPO_MAPPINGS")
+	t.Setenv("CONFIG_FILE", path)
+
+	write("REPO_MAPPING_PATTERNS=^svc-(.+)$=acme/$1\nSTYLE_GUIDE_PATH=OLD.md\n")
+	cfg := mustLoad(t)
+	write("REPO_MAPPING_PATTERNS=^svc-(.+)$=acme/$1\nSTYLE_GUIDE_PATH=NEW.md\n")
+	cfg.Reload(mustLoad(t))
+
+	// Pattern mappings read their settings from the file when first used
+	if m := cfg.GetRepoMapping("", "svc-billing"); m == nil || m.StyleGuidePath != "NEW.md" {
+		t.Errorf("GetRepoMapping(svc-billing) = %+v, want style guide NEW.md from the file", m)
+	}
+
+	// A file that fails to load leaves the last good values in place
+	write("not a setting\n")
+	if _, err := Load(); err == nil {
+		t.Fatal("Load() of an invalid file succeeded")
+	}
+	if m := cfg.GetRepoMapping("", "svc-orders"); m == nil || m.StyleGuidePath != "NEW.md" {
+		t.Errorf("GetRepoMapping(svc-orders) = %+v, want style guide NEW.md", m)
+	}
+}
+
+func TestReload_Tenants(t *testing.T) {
+	setRequiredEnv(t, nil)
+	cfg := mustLoad(t)
+
+	t.Setenv("TENANTS", "team-a")
+	t.Setenv("TENANT_TEAM_A_SENTRY_WEBHOOK_SECRET", "secret")
+	t.Setenv("TENANT_TEAM_A_GITHUB_TOKEN", "token")
+	t.Setenv("TENANT_TEAM_A_REPO_MAPPINGS", "web:acme/web")
+	skipped := cfg.Reload(mustLoad(t))
+	if len(skipped) != 1 || !strings.Contains(skipped[0], `"team-a" was added`) {
+		t.Errorf("Reload() skipped %v, want the added tenant", skipped)
+	}
+	if cfg.GetRepoMapping("team-a", "web") != nil {
+		t.Error("GetRepoMapping() found a mapping of a tenant added on reload")
+	}
+}
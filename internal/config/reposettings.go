@@ -0,0 +1,74 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultBranchPrefix starts the name of fix branches unless a repository
+// sets its own.
+const DefaultBranchPrefix = "sentry-fix/"
+
+// repoSettingsPrefix returns the prefix of a repository's REPO_<NAME>_*
+// settings, where NAME is owner/repo upper-cased with every character other
+// than a letter or digit replaced by an underscore.
+func repoSettingsPrefix(m *RepoMapping) string {
+	name := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, m.FullName())
+	return "REPO_" + strings.ToUpper(name) + "_"
+}
+
+// applyRepoSettings sets a repository's PR and generation settings from its
+// REPO_<NAME>_* variables, keeping the defaults it already has for those not
+// set.
+func applyRepoSettings(m *RepoMapping) error {
+	prefix := repoSettingsPrefix(m)
+
+	m.BaseBranch = getEnv(prefix+"BASE_BRANCH", m.BaseBranch)
+	m.BranchPrefix = getEnv(prefix+"BRANCH_PREFIX", m.BranchPrefix)
+	m.Model = getEnv(prefix+"MODEL", m.Model)
+	m.TestCommand = getEnv(prefix+"TEST_COMMAND", m.TestCommand)
+	m.RegressionTestCommand = getEnv(prefix+"REGRESSION_TEST_COMMAND", m.RegressionTestCommand)
+	for _, list := range []struct {
+		key string
+		val *[]string
+	}{
+		{"LABELS", &m.Labels},
+		{"ASSIGNEES", &m.Assignees},
+		{"REVIEWERS", &m.Reviewers},
+	} {
+		if s := lookupEnv(prefix + list.key); s != "" {
+			*list.val = splitList(s)
+		}
+	}
+
+	var err error
+	if m.DraftPRs, err = getEnvBool(prefix+"DRAFT", m.DraftPRs); err != nil {
+		return err
+	}
+	if m.MaxPRsPerDay, err = getEnvInt(prefix+"PR_BUDGET_PER_DAY", m.MaxPRsPerDay); err != nil {
+		return err
+	}
+	if m.Flags, err = parseFlags(prefix+"FLAGS", lookupEnv(prefix+"FLAGS"), m.Flags); err != nil {
+		return err
+	}
+	if strings.ContainsAny(m.BranchPrefix, " ~^:?*[\\") || strings.Contains(m.BranchPrefix, "..") {
+		return fmt.Errorf("%sBRANCH_PREFIX: invalid branch prefix %q", prefix, m.BranchPrefix)
+	}
+	return nil
+}
+
+// splitList splits a comma-separated list, dropping empty entries.
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
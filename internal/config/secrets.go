@@ -0,0 +1,86 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// secretFetchTimeout bounds fetching one secret from a secret manager.
+const secretFetchTimeout = 30 * time.Second
+
+// awsSecretPrefix starts the ARN of an AWS Secrets Manager secret.
+const awsSecretPrefix = "arn:aws:secretsmanager:"
+
+// resolveSecret returns the value of the secret setting key. A value naming
+// a secret manager's secret is replaced by the secret, or by one key of it
+// when the secret is a JSON object and the reference ends in #KEY. Vault
+// secrets are always JSON objects, so their references need a key. Other
+// values are returned unchanged. Callers must hold loadMu.
+func (c *Config) resolveSecret(key, val string) (string, error) {
+	ref, field, _ := strings.Cut(val, "#")
+	var fetch func(ctx context.Context, ref string) (string, error)
+	switch {
+	case strings.HasPrefix(val, awsSecretPrefix):
+		fetch = fetchAWSSecret
+	case strings.HasPrefix(val, vaultSecretPrefix):
+		if field == "" {
+			return "", fmt.Errorf("%s: Vault secret %s needs a #KEY", key, ref)
+		}
+		ref = strings.TrimPrefix(ref, vaultSecretPrefix)
+		fetch = fetchVaultSecret
+	default:
+		return val, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), secretFetchTimeout)
+	defer cancel()
+	secret, err := fetch(ctx, ref)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", key, err)
+	}
+	if field != "" {
+		var fields map[string]string
+		if err := json.Unmarshal([]byte(secret), &fields); err != nil {
+			return "", fmt.Errorf("%s: secret %s is not a JSON object of strings: %w", key, ref, err)
+		}
+		var ok bool
+		if secret, ok = fields[field]; !ok {
+			return "", fmt.Errorf("%s: secret %s has no key %q", key, ref, field)
+		}
+	}
+
+	c.ManagedSecrets = append(c.ManagedSecrets, key)
+	return secret, nil
+}
+
+// fetchAWSSecret returns the current value of the Secrets Manager secret
+// with the given ARN, using the default AWS credential chain.
+func fetchAWSSecret(ctx context.Context, arn string) (string, error) {
+	// arn:aws:secretsmanager:REGION:ACCOUNT:secret:NAME
+	parts := strings.SplitN(arn, ":", 7)
+	if len(parts) != 7 || parts[3] == "" || parts[5] != "secret" {
+		return "", fmt.Errorf("invalid Secrets Manager ARN %q", arn)
+	}
+
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(parts[3]))
+	if err != nil {
+		return "", fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	out, err := secretsmanager.NewFromConfig(awsCfg).GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(arn),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch secret %s: %w", arn, err)
+	}
+	if out.SecretString != nil {
+		return *out.SecretString, nil
+	}
+	return string(out.SecretBinary), nil
+}
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var tenantNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// Tenant is a team or customer served from /webhook/sentry/{name} with its
+// own webhook secret, credentials and repositories.
+type Tenant struct {
+	Name                string
+	SentryWebhookSecret string
+	SentryAuthToken     string
+	SentryOrg           string
+	SentryURL           string
+	GitHubToken         string
+	RepoMappings        []RepoMapping
+	RepoPatterns        []RepoPattern
+}
+
+// parseTenants reads the tenants listed in TENANTS. Each tenant is configured
+// with TENANT_<NAME>_* variables, where NAME is the upper-cased tenant name
+// with dashes replaced by underscores. Tenants without a Sentry URL of their
+// own use the default tenant's.
+func (c *Config) parseTenants() ([]Tenant, error) {
+	var tenants []Tenant
+	seen := make(map[string]bool)
+
+	for _, name := range strings.Split(lookupEnv("TENANTS"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !tenantNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("TENANTS: invalid tenant name %q (use lowercase letters, digits and dashes)", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("TENANTS: duplicate tenant %q", name)
+		}
+		seen[name] = true
+
+		prefix := "TENANT_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		t := Tenant{
+			Name:                name,
+			SentryWebhookSecret: lookupEnv(prefix + "SENTRY_WEBHOOK_SECRET"),
+			SentryAuthToken:     lookupEnv(prefix + "SENTRY_AUTH_TOKEN"),
+			SentryOrg:           lookupEnv(prefix + "SENTRY_ORG"),
+			SentryURL:           getEnv(prefix+"SENTRY_URL", c.SentryURL),
+			GitHubToken:         lookupEnv(prefix + "GITHUB_TOKEN"),
+		}
+		for _, secret := range []struct {
+			key string
+			val *string
+		}{
+			{"SENTRY_WEBHOOK_SECRET", &t.SentryWebhookSecret},
+			{"SENTRY_AUTH_TOKEN", &t.SentryAuthToken},
+			{"GITHUB_TOKEN", &t.GitHubToken},
+		} {
+			var err error
+			if *secret.val, err = c.resolveSecret(prefix+secret.key, *secret.val); err != nil {
+				return nil, err
+			}
+		}
+
+		mappingsStr := lookupEnv(prefix + "REPO_MAPPINGS")
+		patternsStr := lookupEnv(prefix + "REPO_MAPPING_PATTERNS")
+		for _, required := range []struct{ key, val string }{
+			{"SENTRY_WEBHOOK_SECRET", t.SentryWebhookSecret},
+			{"GITHUB_TOKEN", t.GitHubToken},
+			{"REPO_MAPPINGS or " + prefix + "REPO_MAPPING_PATTERNS", mappingsStr + patternsStr},
+		} {
+			if required.val == "" {
+				return nil, fmt.Errorf("%s%s is required for tenant %q", prefix, required.key, name)
+			}
+		}
+
+		if mappingsStr != "" {
+			mappings, err := parseRepoMappings(mappingsStr)
+			if err != nil {
+				return nil, fmt.Errorf("%sREPO_MAPPINGS: %w", prefix, err)
+			}
+			for i := range mappings {
+				mappings[i].Tenant = name
+				mappings[i].GitHubToken = t.GitHubToken
+			}
+			t.RepoMappings = mappings
+		}
+
+		patterns, err := parseRepoPatterns(prefix+"REPO_MAPPING_PATTERNS", patternsStr)
+		if err != nil {
+			return nil, err
+		}
+		for i := range patterns {
+			patterns[i].Tenant = name
+			patterns[i].GitHubToken = t.GitHubToken
+		}
+		t.RepoPatterns = patterns
+
+		tenants = append(tenants, t)
+	}
+
+	return tenants, nil
+}
@@ -0,0 +1,251 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// vaultSecretPrefix starts a reference to a HashiCorp Vault secret, as in
+// vault:secret/data/sentryagent#github_token.
+const vaultSecretPrefix = "vault:"
+
+// defaultK8sTokenPath is where Kubernetes mounts a pod's service account
+// token.
+const defaultK8sTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// vaultSettings are the VAULT_* settings selecting the server and how to log
+// in to it.
+type vaultSettings struct {
+	Addr      string
+	Namespace string
+	// AuthMethod is token, approle or kubernetes.
+	AuthMethod string
+	AuthMount  string
+	Token      string
+	RoleID     string
+	SecretID   string
+	Role       string
+	TokenPath  string
+}
+
+// vaultClient reads secrets from Vault, keeping the token it logged in with
+// across reloads and renewing its lease.
+type vaultClient struct {
+	settings vaultSettings
+	http     *http.Client
+
+	token     string
+	renewable bool
+	issued    time.Time
+	// ttl is the token's lease duration, 0 if it doesn't expire.
+	ttl time.Duration
+}
+
+// vault is the client used by the last Load. Guarded by loadMu.
+var vault *vaultClient
+
+// loadVaultSettings reads the VAULT_* settings. Callers must hold loadMu.
+func loadVaultSettings() (vaultSettings, error) {
+	s := vaultSettings{
+		Addr:       strings.TrimRight(lookupEnv("VAULT_ADDR"), "/"),
+		Namespace:  lookupEnv("VAULT_NAMESPACE"),
+		AuthMethod: getEnv("VAULT_AUTH_METHOD", "token"),
+		Token:      lookupEnv("VAULT_TOKEN"),
+		RoleID:     lookupEnv("VAULT_ROLE_ID"),
+		SecretID:   lookupEnv("VAULT_SECRET_ID"),
+		Role:       lookupEnv("VAULT_ROLE"),
+		TokenPath:  getEnv("VAULT_K8S_TOKEN_PATH", defaultK8sTokenPath),
+	}
+	if s.Addr == "" {
+		return s, fmt.Errorf("VAULT_ADDR is required to read %s secrets", vaultSecretPrefix)
+	}
+
+	switch s.AuthMethod {
+	case "token":
+		if s.Token == "" {
+			return s, errors.New("VAULT_TOKEN is required when VAULT_AUTH_METHOD=token")
+		}
+	case "approle":
+		if s.RoleID == "" || s.SecretID == "" {
+			return s, errors.New("VAULT_ROLE_ID and VAULT_SECRET_ID are required when VAULT_AUTH_METHOD=approle")
+		}
+	case "kubernetes":
+		if s.Role == "" {
+			return s, errors.New("VAULT_ROLE is required when VAULT_AUTH_METHOD=kubernetes")
+		}
+	default:
+		return s, fmt.Errorf("VAULT_AUTH_METHOD: unknown method %q (expected token, approle or kubernetes)", s.AuthMethod)
+	}
+	s.AuthMount = strings.Trim(getEnv("VAULT_AUTH_MOUNT", s.AuthMethod), "/")
+	return s, nil
+}
+
+// fetchVaultSecret returns the data of the Vault secret at path as a JSON
+// object. KV version 2 paths include the mount's data/ segment.
+func fetchVaultSecret(ctx context.Context, path string) (string, error) {
+	settings, err := loadVaultSettings()
+	if err != nil {
+		return "", err
+	}
+	// Keep the token across reloads unless the settings changed
+	if vault == nil || vault.settings != settings {
+		vault = &vaultClient{settings: settings, http: &http.Client{Timeout: 10 * time.Second}}
+	}
+
+	var secret struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := vault.read(ctx, strings.Trim(path, "/"), &secret); err != nil {
+		return "", err
+	}
+	data := secret.Data
+	// KV version 2 nests the secret's data and metadata under data
+	if nested, ok := data["data"]; ok && data["metadata"] != nil {
+		data = nil
+		if err := json.Unmarshal(nested, &data); err != nil {
+			return "", fmt.Errorf("failed to decode secret %s: %w", path, err)
+		}
+	}
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
+// read GETs a secret, logging in or renewing the token first if needed.
+func (v *vaultClient) read(ctx context.Context, path string, out any) error {
+	if err := v.ensureToken(ctx); err != nil {
+		return err
+	}
+	if err := v.do(ctx, http.MethodGet, path, nil, out); err != nil {
+		return fmt.Errorf("failed to read secret %s: %w", path, err)
+	}
+	return nil
+}
+
+// ensureToken logs in when there is no token or it has expired, and renews
+// a renewable token once half its lease has passed.
+func (v *vaultClient) ensureToken(ctx context.Context) error {
+	if v.token != "" && v.ttl == 0 {
+		return nil
+	}
+	if v.token != "" {
+		age := time.Since(v.issued)
+		if age < v.ttl/2 {
+			return nil
+		}
+		if v.renewable && age < v.ttl {
+			if err := v.auth(ctx, "auth/token/renew-self", map[string]any{}); err == nil {
+				return nil
+			}
+			// An expired or revoked token is replaced by logging in again
+		}
+	}
+	return v.login(ctx)
+}
+
+// login obtains a token with the configured auth method.
+func (v *vaultClient) login(ctx context.Context) error {
+	s := v.settings
+	v.token = ""
+	switch s.AuthMethod {
+	case "token":
+		// Static tokens are renewed if their lease allows it but never
+		// replaced
+		v.token = s.Token
+		var self struct {
+			Data struct {
+				TTL       int  `json:"ttl"`
+				Renewable bool `json:"renewable"`
+			} `json:"data"`
+		}
+		if err := v.do(ctx, http.MethodGet, "auth/token/lookup-self", nil, &self); err != nil {
+			return fmt.Errorf("failed to look up VAULT_TOKEN: %w", err)
+		}
+		v.issued = time.Now()
+		v.ttl = time.Duration(self.Data.TTL) * time.Second
+		v.renewable = self.Data.Renewable
+		return nil
+	case "approle":
+		return v.auth(ctx, "auth/"+s.AuthMount+"/login", map[string]any{
+			"role_id":   s.RoleID,
+			"secret_id": s.SecretID,
+		})
+	default:
+		jwt, err := os.ReadFile(s.TokenPath)
+		if err != nil {
+			return fmt.Errorf("failed to read Kubernetes service account token: %w", err)
+		}
+		return v.auth(ctx, "auth/"+s.AuthMount+"/login", map[string]any{
+			"role": s.Role,
+			"jwt":  strings.TrimSpace(string(jwt)),
+		})
+	}
+}
+
+// auth calls a Vault endpoint that issues or renews a token and keeps it.
+func (v *vaultClient) auth(ctx context.Context, path string, body map[string]any) error {
+	var resp struct {
+		Auth *struct {
+			ClientToken   string `json:"client_token"`
+			LeaseDuration int    `json:"lease_duration"`
+			Renewable     bool   `json:"renewable"`
+		} `json:"auth"`
+	}
+	if err := v.do(ctx, http.MethodPost, path, body, &resp); err != nil {
+		return fmt.Errorf("vault %s failed: %w", path, err)
+	}
+	if resp.Auth == nil || resp.Auth.ClientToken == "" {
+		return fmt.Errorf("vault %s returned no token", path)
+	}
+	v.token = resp.Auth.ClientToken
+	v.issued = time.Now()
+	v.ttl = time.Duration(resp.Auth.LeaseDuration) * time.Second
+	v.renewable = resp.Auth.Renewable
+	return nil
+}
+
+// do calls the Vault API at /v1/path, decoding the JSON response into out.
+func (v *vaultClient) do(ctx context.Context, method, path string, body, out any) error {
+	var reqBody io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, v.settings.Addr+"/v1/"+path, reqBody)
+	if err != nil {
+		return err
+	}
+	if v.token != "" {
+		req.Header.Set("X-Vault-Token", v.token)
+	}
+	if v.settings.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.settings.Namespace)
+	}
+
+	resp, err := v.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package filter
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// ErrorTypeRule matches a Sentry error type (Metadata.Type), optionally
+// scoped to one project, e.g. "OutOfMemoryError" or "api=TimeoutError".
+type ErrorTypeRule struct {
+	Project string // empty applies to every project
+	Pattern string // may contain * wildcards
+}
+
+// Match reports whether the rule applies to the project and error type.
+func (r ErrorTypeRule) Match(project, errorType string) bool {
+	if r.Project != "" && r.Project != project {
+		return false
+	}
+	matched, _ := path.Match(r.Pattern, errorType)
+	return matched
+}
+
+// ParseErrorTypeRules parses a comma-separated list of [project=]Type rules.
+func ParseErrorTypeRules(s string) ([]ErrorTypeRule, error) {
+	var rules []ErrorTypeRule
+
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		var rule ErrorTypeRule
+		if project, pattern, ok := strings.Cut(item, "="); ok {
+			rule.Project = strings.TrimSpace(project)
+			rule.Pattern = strings.TrimSpace(pattern)
+			if rule.Project == "" {
+				return nil, fmt.Errorf("invalid error type rule %q (empty project)", item)
+			}
+		} else {
+			rule.Pattern = item
+		}
+
+		if rule.Pattern == "" {
+			return nil, fmt.Errorf("invalid error type rule %q (empty type)", item)
+		}
+		if _, err := path.Match(rule.Pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid error type rule %q: %w", item, err)
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// ErrorTypeFilter decides whether an error class should be auto-fixed.
+type ErrorTypeFilter struct {
+	// AllowList restricts a project to the listed error types. Projects
+	// with no applicable allow rules accept every type.
+	AllowList []ErrorTypeRule
+	// DenyList rejects matching error types and takes precedence over AllowList.
+	DenyList []ErrorTypeRule
+}
+
+// Allow reports whether the error type passes the filter for the project,
+// with a reason when it doesn't.
+func (f ErrorTypeFilter) Allow(project, errorType string) (bool, string) {
+	for _, rule := range f.DenyList {
+		if rule.Match(project, errorType) {
+			return false, fmt.Sprintf("error type %q is denied", errorType)
+		}
+	}
+
+	restricted := false
+	for _, rule := range f.AllowList {
+		if rule.Project != "" && rule.Project != project {
+			continue
+		}
+		restricted = true
+		if rule.Match(project, errorType) {
+			return true, ""
+		}
+	}
+	if restricted {
+		return false, fmt.Sprintf("error type %q is not in the allow list for project %s", errorType, project)
+	}
+
+	return true, ""
+}
@@ -0,0 +1,58 @@
+package filter
+
+import "testing"
+
+func TestParseErrorTypeRules(t *testing.T) {
+	rules, err := ParseErrorTypeRules("OutOfMemoryError, api=ActiveRecord::*")
+	if err != nil {
+		t.Fatalf("ParseErrorTypeRules() error = %v", err)
+	}
+
+	want := []ErrorTypeRule{
+		{Pattern: "OutOfMemoryError"},
+		{Project: "api", Pattern: "ActiveRecord::*"},
+	}
+	if len(rules) != len(want) {
+		t.Fatalf("got %d rules, want %d", len(rules), len(want))
+	}
+	for i := range want {
+		if rules[i] != want[i] {
+			t.Errorf("rule %d = %+v, want %+v", i, rules[i], want[i])
+		}
+	}
+
+	for _, bad := range []string{"=TypeError", "api=", "Bad[Type"} {
+		if _, err := ParseErrorTypeRules(bad); err == nil {
+			t.Errorf("ParseErrorTypeRules(%q) expected error", bad)
+		}
+	}
+}
+
+func TestErrorTypeFilter_Allow(t *testing.T) {
+	allow, _ := ParseErrorTypeRules("api=NullPointerException,api=*KeyError")
+	deny, _ := ParseErrorTypeRules("OutOfMemoryError,web=TypeError")
+	f := ErrorTypeFilter{AllowList: allow, DenyList: deny}
+
+	tests := []struct {
+		project   string
+		errorType string
+		want      bool
+	}{
+		{"api", "NullPointerException", true},
+		{"api", "MissingKeyError", true},
+		{"api", "TypeError", false},
+		{"api", "OutOfMemoryError", false},
+		{"web", "TypeError", false},
+		{"web", "ValueError", true},
+		{"web", "OutOfMemoryError", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.project+"/"+tt.errorType, func(t *testing.T) {
+			got, reason := f.Allow(tt.project, tt.errorType)
+			if got != tt.want {
+				t.Errorf("Allow() = %v (%s), want %v", got, reason, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package filter
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// levels lists Sentry issue levels from least to most severe.
+var levels = []string{"debug", "info", "warning", "error", "fatal"}
+
+// SeverityThreshold is the minimum level and impact an issue needs to be
+// auto-fixed. Zero fields don't filter.
+type SeverityThreshold struct {
+	MinLevel  string
+	MinEvents int
+	MinUsers  int
+}
+
+// ParseSeverityThreshold parses a threshold written as level/events/users,
+// e.g. "error/10/1". Trailing parts may be omitted and the level left empty,
+// as in "error" or "/100".
+func ParseSeverityThreshold(s string) (SeverityThreshold, error) {
+	var t SeverityThreshold
+	parts := strings.Split(s, "/")
+	if len(parts) > 3 {
+		return t, fmt.Errorf("invalid severity threshold %q (expected level/events/users)", s)
+	}
+
+	var err error
+	if t.MinLevel, err = ParseLevel(parts[0]); err != nil {
+		return t, fmt.Errorf("invalid severity threshold %q: %w", s, err)
+	}
+	for i, count := range []*int{&t.MinEvents, &t.MinUsers} {
+		if i+1 >= len(parts) {
+			break
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(parts[i+1]))
+		if err != nil || n < 0 {
+			return t, fmt.Errorf("invalid severity threshold %q: counts must be non-negative integers", s)
+		}
+		*count = n
+	}
+	return t, nil
+}
+
+// ParseLevel normalizes a Sentry issue level, which may be empty.
+func ParseLevel(s string) (string, error) {
+	level := strings.ToLower(strings.TrimSpace(s))
+	if level != "" && !slices.Contains(levels, level) {
+		return "", fmt.Errorf("unknown level %q (expected one of %s)", level, strings.Join(levels, ", "))
+	}
+	return level, nil
+}
+
+// Allow reports whether an issue with the given level, event count and user
+// count meets the threshold. It returns false with a reason when it doesn't.
+func (t SeverityThreshold) Allow(level string, events, users int) (bool, string) {
+	if t.MinLevel != "" && slices.Index(levels, level) < slices.Index(levels, t.MinLevel) {
+		return false, fmt.Sprintf("level %q is below %s", level, t.MinLevel)
+	}
+	if events < t.MinEvents {
+		return false, fmt.Sprintf("%d event(s), fewer than %d", events, t.MinEvents)
+	}
+	if users < t.MinUsers {
+		return false, fmt.Sprintf("%d user(s) affected, fewer than %d", users, t.MinUsers)
+	}
+	return true, ""
+}
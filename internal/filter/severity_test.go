@@ -0,0 +1,65 @@
+package filter
+
+import "testing"
+
+func TestParseSeverityThreshold(t *testing.T) {
+	tests := []struct {
+		in   string
+		want SeverityThreshold
+	}{
+		{"", SeverityThreshold{}},
+		{"error", SeverityThreshold{MinLevel: "error"}},
+		{"Fatal/10", SeverityThreshold{MinLevel: "fatal", MinEvents: 10}},
+		{"warning/5/2", SeverityThreshold{MinLevel: "warning", MinEvents: 5, MinUsers: 2}},
+		{"/0/3", SeverityThreshold{MinUsers: 3}},
+	}
+	for _, tt := range tests {
+		got, err := ParseSeverityThreshold(tt.in)
+		if err != nil {
+			t.Errorf("ParseSeverityThreshold(%q) error = %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseSeverityThreshold(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"critical", "error/x", "error/-1", "error/1/2/3"} {
+		if _, err := ParseSeverityThreshold(bad); err == nil {
+			t.Errorf("ParseSeverityThreshold(%q) expected error", bad)
+		}
+	}
+}
+
+func TestSeverityThreshold_Allow(t *testing.T) {
+	threshold := SeverityThreshold{MinLevel: "error", MinEvents: 10, MinUsers: 2}
+
+	tests := []struct {
+		name          string
+		level         string
+		events, users int
+		want          bool
+	}{
+		{"meets all", "error", 10, 2, true},
+		{"more severe", "fatal", 50, 5, true},
+		{"below level", "warning", 100, 10, false},
+		{"unknown level", "", 100, 10, false},
+		{"too few events", "fatal", 9, 10, false},
+		{"too few users", "fatal", 100, 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reason := threshold.Allow(tt.level, tt.events, tt.users)
+			if got != tt.want {
+				t.Errorf("Allow() = %v (%s), want %v", got, reason, tt.want)
+			}
+			if !got && reason == "" {
+				t.Error("Allow() rejected without a reason")
+			}
+		})
+	}
+
+	if ok, _ := (SeverityThreshold{}).Allow("debug", 0, 0); !ok {
+		t.Error("zero threshold rejected an issue")
+	}
+}
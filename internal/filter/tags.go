@@ -0,0 +1,176 @@
+package filter
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// TagRule matches a single Sentry tag, e.g. "browser:IE11" or "release:>=2.0".
+type TagRule struct {
+	Key   string
+	Op    string // "=", "!=", ">", ">=", "<", "<="
+	Value string // may contain * wildcards for "=" and "!="
+}
+
+// String returns the rule in its configuration form.
+func (r TagRule) String() string {
+	if r.Op == "=" {
+		return r.Key + ":" + r.Value
+	}
+	return r.Key + ":" + r.Op + r.Value
+}
+
+// Match reports whether the rule matches the given tags.
+// A rule never matches when the tag is absent.
+func (r TagRule) Match(tags map[string]string) bool {
+	actual, ok := tags[r.Key]
+	if !ok {
+		return false
+	}
+
+	switch r.Op {
+	case "=":
+		matched, _ := path.Match(r.Value, actual)
+		return matched
+	case "!=":
+		matched, _ := path.Match(r.Value, actual)
+		return !matched
+	}
+
+	cmp, ok := compareVersions(actual, r.Value)
+	if !ok {
+		return false
+	}
+	switch r.Op {
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	}
+	return false
+}
+
+// ParseTagRules parses a comma-separated list of key:value rules.
+func ParseTagRules(s string) ([]TagRule, error) {
+	var rules []TagRule
+
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		parts := strings.SplitN(item, ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("invalid tag rule %q (expected key:value)", item)
+		}
+
+		rule := TagRule{Key: strings.TrimSpace(parts[0]), Op: "="}
+		value := strings.TrimSpace(parts[1])
+		for _, op := range []string{">=", "<=", "!=", ">", "<", "="} {
+			if strings.HasPrefix(value, op) {
+				rule.Op = op
+				value = strings.TrimSpace(value[len(op):])
+				break
+			}
+		}
+		if value == "" {
+			return nil, fmt.Errorf("invalid tag rule %q (empty value)", item)
+		}
+		if _, err := path.Match(value, ""); err != nil {
+			return nil, fmt.Errorf("invalid tag rule %q: %w", item, err)
+		}
+		rule.Value = value
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// TagFilter decides whether an issue should be handled based on its tags.
+type TagFilter struct {
+	// Include rules are grouped by key: every key must have at least one
+	// matching rule. Empty means everything is included.
+	Include []TagRule
+	// Exclude rules reject the issue if any of them match.
+	Exclude []TagRule
+}
+
+// Allow reports whether tags pass the filter, with a reason when they don't.
+func (f TagFilter) Allow(tags map[string]string) (bool, string) {
+	for _, rule := range f.Exclude {
+		if rule.Match(tags) {
+			return false, fmt.Sprintf("excluded by tag rule %s", rule)
+		}
+	}
+
+	matchedKeys := make(map[string]bool)
+	for _, rule := range f.Include {
+		if rule.Match(tags) {
+			matchedKeys[rule.Key] = true
+		}
+	}
+	for _, rule := range f.Include {
+		if !matchedKeys[rule.Key] {
+			return false, fmt.Sprintf("no include rule matched tag %q", rule.Key)
+		}
+	}
+
+	return true, ""
+}
+
+// compareVersions compares dotted version strings such as "2.0.1" or
+// "app@2.0.1+build". It returns false if either side has no numeric parts.
+func compareVersions(a, b string) (int, bool) {
+	pa, pb := versionParts(a), versionParts(b)
+	if len(pa) == 0 || len(pb) == 0 {
+		return 0, false
+	}
+
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		if x != y {
+			if x < y {
+				return -1, true
+			}
+			return 1, true
+		}
+	}
+	return 0, true
+}
+
+// versionParts extracts the numeric components of a version string.
+func versionParts(v string) []int {
+	// Sentry releases are often "package@version"
+	if idx := strings.LastIndex(v, "@"); idx != -1 {
+		v = v[idx+1:]
+	}
+	// Ignore build metadata and pre-release suffixes
+	if idx := strings.IndexAny(v, "+-"); idx != -1 {
+		v = v[:idx]
+	}
+	v = strings.TrimPrefix(v, "v")
+
+	var parts []int
+	for _, p := range strings.Split(v, ".") {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			break
+		}
+		parts = append(parts, n)
+	}
+	return parts
+}
@@ -0,0 +1,62 @@
+package filter
+
+import "testing"
+
+func TestParseTagRules(t *testing.T) {
+	rules, err := ParseTagRules("browser:IE11, release:>=2.0 ,os:!=Windows*")
+	if err != nil {
+		t.Fatalf("ParseTagRules() error = %v", err)
+	}
+
+	want := []TagRule{
+		{Key: "browser", Op: "=", Value: "IE11"},
+		{Key: "release", Op: ">=", Value: "2.0"},
+		{Key: "os", Op: "!=", Value: "Windows*"},
+	}
+	if len(rules) != len(want) {
+		t.Fatalf("got %d rules, want %d", len(rules), len(want))
+	}
+	for i := range want {
+		if rules[i] != want[i] {
+			t.Errorf("rule %d = %+v, want %+v", i, rules[i], want[i])
+		}
+	}
+
+	for _, bad := range []string{"browser", ":IE11", "release:>=", "os:[bad"} {
+		if _, err := ParseTagRules(bad); err == nil {
+			t.Errorf("ParseTagRules(%q) expected error", bad)
+		}
+	}
+}
+
+func TestTagFilter_Allow(t *testing.T) {
+	include, _ := ParseTagRules("release:>=2.0,browser:Chrome*,browser:Firefox")
+	exclude, _ := ParseTagRules("browser:IE11")
+	f := TagFilter{Include: include, Exclude: exclude}
+
+	tests := []struct {
+		name string
+		tags map[string]string
+		want bool
+	}{
+		{"matches all keys", map[string]string{"release": "app@2.1.0", "browser": "Chrome 120"}, true},
+		{"alternative value for key", map[string]string{"release": "2.0", "browser": "Firefox"}, true},
+		{"old release", map[string]string{"release": "1.9.9", "browser": "Chrome"}, false},
+		{"excluded browser", map[string]string{"release": "3.0", "browser": "IE11"}, false},
+		{"missing tag", map[string]string{"browser": "Chrome"}, false},
+		{"non-numeric release", map[string]string{"release": "latest", "browser": "Chrome"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reason := f.Allow(tt.tags)
+			if got != tt.want {
+				t.Errorf("Allow() = %v (%s), want %v", got, reason, tt.want)
+			}
+		})
+	}
+
+	if ok, _ := (TagFilter{}).Allow(nil); !ok {
+		t.Error("empty filter should allow everything")
+	}
+}
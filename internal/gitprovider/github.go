@@ -3,8 +3,13 @@ package gitprovider
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"log"
+	"net"
+	"net/http"
 	"strings"
+	"time"
 
 	"github.com/google/go-github/v66/github"
 )
@@ -123,6 +128,47 @@ func (g *GitHubProvider) ListDirectory(ctx context.Context, path, ref string) ([
 	return entries, nil
 }
 
+// FileHistory lists the latest limit commits touching a file up to ref,
+// newest first. Listing commits leaves out their changes, so each is fetched
+// for its diff of the file.
+func (g *GitHubProvider) FileHistory(ctx context.Context, path, ref string, limit int) ([]Commit, error) {
+	opts := &github.CommitsListOptions{
+		SHA:         ref,
+		Path:        path,
+		ListOptions: github.ListOptions{PerPage: limit},
+	}
+	page, _, err := g.client.Repositories.ListCommits(ctx, g.owner, g.repo, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list commits for %s: %w", path, err)
+	}
+	if len(page) > limit {
+		page = page[:limit]
+	}
+
+	var commits []Commit
+	for _, c := range page {
+		commit := Commit{
+			SHA:     c.GetSHA(),
+			Message: c.GetCommit().GetMessage(),
+			Author:  c.GetCommit().GetAuthor().GetName(),
+			Date:    c.GetCommit().GetAuthor().GetDate().Time,
+		}
+		full, _, err := g.client.Repositories.GetCommit(ctx, g.owner, g.repo, commit.SHA, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get commit %s: %w", commit.SHA, err)
+		}
+		for _, f := range full.Files {
+			if f.GetFilename() == path || f.GetPreviousFilename() == path {
+				commit.Patch = f.GetPatch()
+				break
+			}
+		}
+		commits = append(commits, commit)
+	}
+
+	return commits, nil
+}
+
 // GetDefaultBranch returns the repository's default branch name.
 func (g *GitHubProvider) GetDefaultBranch(ctx context.Context) (string, error) {
 	repo, _, err := g.client.Repositories.Get(ctx, g.owner, g.repo)
@@ -160,6 +206,19 @@ func (g *GitHubProvider) CreateBranch(ctx context.Context, name, baseSHA string)
 	return nil
 }
 
+// DeleteBranch deletes a branch. Deleting one that doesn't exist succeeds.
+func (g *GitHubProvider) DeleteBranch(ctx context.Context, name string) error {
+	resp, err := g.client.Git.DeleteRef(ctx, g.owner, g.repo, "refs/heads/"+name)
+	if err != nil {
+		// GitHub answers 422 for a ref that doesn't exist
+		if resp != nil && (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusUnprocessableEntity) {
+			return nil
+		}
+		return fmt.Errorf("failed to delete branch %s: %w", name, err)
+	}
+	return nil
+}
+
 // CommitFiles commits file changes to a branch.
 func (g *GitHubProvider) CommitFiles(ctx context.Context, branch string, files []FileChange, message string) (string, error) {
 	// Get the current commit SHA for the branch
@@ -259,6 +318,475 @@ func (g *GitHubProvider) CreatePullRequest(ctx context.Context, req PRRequest) (
 	}, nil
 }
 
+// CreateIssue opens an issue.
+func (g *GitHubProvider) CreateIssue(ctx context.Context, req IssueRequest) (*IssueResponse, error) {
+	issue := &github.IssueRequest{
+		Title: ptr(req.Title),
+		Body:  ptr(req.Body),
+	}
+	if len(req.Labels) > 0 {
+		issue.Labels = &req.Labels
+	}
+
+	created, _, err := g.client.Issues.Create(ctx, g.owner, g.repo, issue)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create issue: %w", err)
+	}
+	return &IssueResponse{Number: created.GetNumber(), HTMLURL: created.GetHTMLURL()}, nil
+}
+
+// ListPullRequests lists the pull requests matching q, most recently updated
+// first.
+func (g *GitHubProvider) ListPullRequests(ctx context.Context, q PullRequestQuery) ([]PullRequest, error) {
+	if q.Label != "" {
+		return g.listLabeledPullRequests(ctx, q)
+	}
+
+	opts := &github.PullRequestListOptions{
+		State:       q.State,
+		Sort:        "updated",
+		Direction:   "desc",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+
+	var prs []PullRequest
+	for {
+		page, resp, err := g.client.PullRequests.List(ctx, g.owner, g.repo, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list pull requests: %w", err)
+		}
+
+		for _, pr := range page {
+			converted := convertPullRequest(pr)
+			if !q.UpdatedSince.IsZero() && !converted.UpdatedAt.After(q.UpdatedSince) {
+				return prs, nil
+			}
+			prs = append(prs, converted)
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	return prs, nil
+}
+
+// listLabeledPullRequests lists labeled pull requests through the issues
+// API, which filters by label and update time on the server.
+func (g *GitHubProvider) listLabeledPullRequests(ctx context.Context, q PullRequestQuery) ([]PullRequest, error) {
+	opts := &github.IssueListByRepoOptions{
+		State:       q.State,
+		Labels:      []string{q.Label},
+		Sort:        "updated",
+		Direction:   "desc",
+		Since:       q.UpdatedSince,
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+
+	var prs []PullRequest
+	for {
+		page, resp, err := g.client.Issues.ListByRepo(ctx, g.owner, g.repo, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list pull requests labeled %s: %w", q.Label, err)
+		}
+
+		for _, issue := range page {
+			if !issue.IsPullRequest() {
+				continue
+			}
+			// since includes PRs updated at that very time
+			if !q.UpdatedSince.IsZero() && !issue.GetUpdatedAt().Time.After(q.UpdatedSince) {
+				continue
+			}
+			prs = append(prs, convertIssuePullRequest(issue))
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	return prs, nil
+}
+
+// GetPullRequest returns a pull request with all its details.
+func (g *GitHubProvider) GetPullRequest(ctx context.Context, number int) (*PullRequest, error) {
+	pr, _, err := g.client.PullRequests.Get(ctx, g.owner, g.repo, number)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get PR #%d: %w", number, err)
+	}
+	converted := convertPullRequest(pr)
+	return &converted, nil
+}
+
+// SearchPullRequests lists the pull requests in the repository matching a
+// search query.
+func (g *GitHubProvider) SearchPullRequests(ctx context.Context, query string) ([]PullRequest, error) {
+	q := fmt.Sprintf("repo:%s/%s is:pr %s", g.owner, g.repo, query)
+	opts := &github.SearchOptions{
+		Sort:        "updated",
+		Order:       "desc",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+
+	var prs []PullRequest
+	for {
+		result, resp, err := g.client.Search.Issues(ctx, q, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to search pull requests: %w", err)
+		}
+
+		for _, issue := range result.Issues {
+			prs = append(prs, convertIssuePullRequest(issue))
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	return prs, nil
+}
+
+// ListReviews lists the reviews submitted on a pull request.
+func (g *GitHubProvider) ListReviews(ctx context.Context, number int) ([]Review, error) {
+	opts := &github.ListOptions{PerPage: 100}
+
+	var result []Review
+	for {
+		reviews, resp, err := g.client.PullRequests.ListReviews(ctx, g.owner, g.repo, number, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list reviews for PR #%d: %w", number, err)
+		}
+
+		for _, r := range reviews {
+			result = append(result, Review{
+				ID:          r.GetID(),
+				User:        r.GetUser().GetLogin(),
+				State:       r.GetState(),
+				Body:        r.GetBody(),
+				SubmittedAt: r.GetSubmittedAt().Time,
+			})
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	return result, nil
+}
+
+// ListReviewComments lists the inline review comments on a pull request.
+func (g *GitHubProvider) ListReviewComments(ctx context.Context, number int) ([]ReviewComment, error) {
+	opts := &github.PullRequestListCommentsOptions{
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+
+	var result []ReviewComment
+	for {
+		comments, resp, err := g.client.PullRequests.ListComments(ctx, g.owner, g.repo, number, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list review comments for PR #%d: %w", number, err)
+		}
+
+		for _, c := range comments {
+			result = append(result, ReviewComment{
+				ID:        c.GetID(),
+				User:      c.GetUser().GetLogin(),
+				Path:      c.GetPath(),
+				Body:      c.GetBody(),
+				CreatedAt: c.GetCreatedAt().Time,
+			})
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	return result, nil
+}
+
+// ListComments lists the conversation comments on a pull request.
+func (g *GitHubProvider) ListComments(ctx context.Context, number int) ([]Comment, error) {
+	opts := &github.IssueListCommentsOptions{
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+
+	var result []Comment
+	for {
+		comments, resp, err := g.client.Issues.ListComments(ctx, g.owner, g.repo, number, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list comments for PR #%d: %w", number, err)
+		}
+
+		for _, c := range comments {
+			result = append(result, Comment{
+				ID:        c.GetID(),
+				User:      c.GetUser().GetLogin(),
+				Body:      c.GetBody(),
+				CreatedAt: c.GetCreatedAt().Time,
+			})
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	return result, nil
+}
+
+// ListPullRequestFiles lists the files changed by a pull request.
+func (g *GitHubProvider) ListPullRequestFiles(ctx context.Context, number int) ([]PullRequestFile, error) {
+	opts := &github.ListOptions{PerPage: 100}
+
+	var files []PullRequestFile
+	for {
+		page, resp, err := g.client.PullRequests.ListFiles(ctx, g.owner, g.repo, number, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list files for PR #%d: %w", number, err)
+		}
+
+		for _, f := range page {
+			files = append(files, PullRequestFile{
+				Path:   f.GetFilename(),
+				Status: f.GetStatus(),
+				Patch:  f.GetPatch(),
+			})
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	return files, nil
+}
+
+// CreateReview submits a non-approving review with optional inline comments.
+func (g *GitHubProvider) CreateReview(ctx context.Context, number int, req ReviewRequest) error {
+	review := &github.PullRequestReviewRequest{
+		Body:  ptr(req.Body),
+		Event: ptr("COMMENT"),
+	}
+	if req.CommitSHA != "" {
+		review.CommitID = ptr(req.CommitSHA)
+	}
+
+	for _, c := range req.Comments {
+		draft := &github.DraftReviewComment{
+			Path: ptr(c.Path),
+			Body: ptr(c.Body),
+			Line: ptr(c.Line),
+			Side: ptr("RIGHT"),
+		}
+		if c.StartLine > 0 && c.StartLine < c.Line {
+			draft.StartLine = ptr(c.StartLine)
+			draft.StartSide = ptr("RIGHT")
+		}
+		review.Comments = append(review.Comments, draft)
+	}
+
+	_, _, err := g.client.PullRequests.CreateReview(ctx, g.owner, g.repo, number, review)
+	if err != nil {
+		return fmt.Errorf("failed to create review on PR #%d: %w", number, err)
+	}
+	return nil
+}
+
+// AddComment posts a comment on a pull request.
+func (g *GitHubProvider) AddComment(ctx context.Context, number int, body string) error {
+	_, _, err := g.client.Issues.CreateComment(ctx, g.owner, g.repo, number, &github.IssueComment{Body: ptr(body)})
+	if err != nil {
+		return fmt.Errorf("failed to comment on PR #%d: %w", number, err)
+	}
+	return nil
+}
+
+// AddLabels adds labels to a pull request.
+func (g *GitHubProvider) AddLabels(ctx context.Context, number int, labels []string) error {
+	_, _, err := g.client.Issues.AddLabelsToIssue(ctx, g.owner, g.repo, number, labels)
+	if err != nil {
+		return fmt.Errorf("failed to add labels to PR #%d: %w", number, err)
+	}
+	return nil
+}
+
+// RequestReviewers (re-)requests review from the given users.
+func (g *GitHubProvider) RequestReviewers(ctx context.Context, number int, reviewers []string) error {
+	_, _, err := g.client.PullRequests.RequestReviewers(ctx, g.owner, g.repo, number, github.ReviewersRequest{Reviewers: reviewers})
+	if err != nil {
+		return fmt.Errorf("failed to request reviewers on PR #%d: %w", number, err)
+	}
+	return nil
+}
+
+// ClosePullRequest closes a pull request without merging it.
+func (g *GitHubProvider) ClosePullRequest(ctx context.Context, number int) error {
+	_, _, err := g.client.PullRequests.Edit(ctx, g.owner, g.repo, number, &github.PullRequest{State: ptr("closed")})
+	if err != nil {
+		return fmt.Errorf("failed to close PR #%d: %w", number, err)
+	}
+	return nil
+}
+
+// CreateSecurityAdvisory opens a draft security advisory visible only to maintainers.
+func (g *GitHubProvider) CreateSecurityAdvisory(ctx context.Context, req AdvisoryRequest) (*Advisory, error) {
+	// go-github has no wrapper for creating repository advisories yet
+	body := map[string]any{
+		"summary":     req.Summary,
+		"description": req.Description,
+		"severity":    req.Severity,
+		"vulnerabilities": []map[string]any{
+			{"package": map[string]string{"ecosystem": "other", "name": g.owner + "/" + g.repo}},
+		},
+	}
+
+	httpReq, err := g.client.NewRequest("POST", fmt.Sprintf("repos/%s/%s/security-advisories", g.owner, g.repo), body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build advisory request: %w", err)
+	}
+
+	var created github.SecurityAdvisory
+	if _, err := g.client.Do(ctx, httpReq, &created); err != nil {
+		return nil, fmt.Errorf("failed to create security advisory: %w", err)
+	}
+
+	return &Advisory{
+		GHSAID:  created.GetGHSAID(),
+		HTMLURL: created.GetHTMLURL(),
+	}, nil
+}
+
+// CreatePrivateFork creates a temporary private fork for an advisory.
+func (g *GitHubProvider) CreatePrivateFork(ctx context.Context, ghsaID string) (string, string, error) {
+	fork, _, err := g.client.SecurityAdvisories.CreateTemporaryPrivateFork(ctx, g.owner, g.repo, ghsaID)
+	if err != nil {
+		// GitHub answers 202 Accepted while the fork is still being created
+		var accepted *github.AcceptedError
+		if !errors.As(err, &accepted) {
+			return "", "", fmt.Errorf("failed to create private fork for %s: %w", ghsaID, err)
+		}
+		if fork == nil || fork.GetOwner().GetLogin() == "" {
+			return "", "", fmt.Errorf("private fork for %s is still being created", ghsaID)
+		}
+	}
+	return fork.GetOwner().GetLogin(), fork.GetName(), nil
+}
+
+// CheckCapabilities verifies that the token can read contents, create refs and
+// open pull requests. It creates a temporary branch pointing at the default
+// branch and attempts a PR with no commits: GitHub answers 422 when PRs are
+// permitted and 403/404 when they are not. The branch is deleted afterwards.
+func (g *GitHubProvider) CheckCapabilities(ctx context.Context) (*Capabilities, error) {
+	caps := &Capabilities{}
+
+	branch, err := g.GetDefaultBranch(ctx)
+	if err != nil {
+		caps.Problems = append(caps.Problems, err.Error())
+		return caps, ctx.Err()
+	}
+	sha, err := g.GetLatestCommitSHA(ctx, branch)
+	if err != nil {
+		caps.Problems = append(caps.Problems, err.Error())
+		return caps, ctx.Err()
+	}
+	if _, err := g.ListDirectory(ctx, "", sha); err != nil {
+		caps.Problems = append(caps.Problems, err.Error())
+		return caps, ctx.Err()
+	}
+	caps.ReadContents = true
+
+	checkBranch := fmt.Sprintf("sentryagent-permission-check-%d", time.Now().UnixNano())
+	if err := g.CreateBranch(ctx, checkBranch, sha); err != nil {
+		caps.Problems = append(caps.Problems, err.Error())
+		return caps, ctx.Err()
+	}
+	caps.CreateRefs = true
+	defer func() {
+		if _, err := g.client.Git.DeleteRef(ctx, g.owner, g.repo, "refs/heads/"+checkBranch); err != nil {
+			log.Printf("warning: failed to delete permission check branch %s on %s/%s: %v", checkBranch, g.owner, g.repo, err)
+		}
+	}()
+
+	pr, _, err := g.client.PullRequests.Create(ctx, g.owner, g.repo, &github.NewPullRequest{
+		Title: ptr("SentryAgent permission check"),
+		Head:  ptr(checkBranch),
+		Base:  ptr(branch),
+	})
+	var ghErr *github.ErrorResponse
+	switch {
+	case err == nil:
+		// Shouldn't happen with no commits, but don't leave it open
+		caps.OpenPRs = true
+		if err := g.ClosePullRequest(ctx, pr.GetNumber()); err != nil {
+			log.Printf("warning: failed to close permission check PR: %v", err)
+		}
+	case errors.As(err, &ghErr) && ghErr.Response.StatusCode == http.StatusUnprocessableEntity:
+		caps.OpenPRs = true
+	default:
+		caps.Problems = append(caps.Problems, fmt.Sprintf("cannot open pull requests: %v", err))
+	}
+
+	return caps, ctx.Err()
+}
+
+// convertPullRequest converts a go-github pull request to the provider type.
+func convertPullRequest(pr *github.PullRequest) PullRequest {
+	converted := PullRequest{
+		Number:    pr.GetNumber(),
+		Title:     pr.GetTitle(),
+		Body:      pr.GetBody(),
+		State:     pr.GetState(),
+		HTMLURL:   pr.GetHTMLURL(),
+		Head:      pr.GetHead().GetRef(),
+		HeadSHA:   pr.GetHead().GetSHA(),
+		HeadRepo:  pr.GetHead().GetRepo().GetFullName(),
+		Base:      pr.GetBase().GetRef(),
+		Author:    pr.GetUser().GetLogin(),
+		CreatedAt: pr.GetCreatedAt().Time,
+		UpdatedAt: pr.GetUpdatedAt().Time,
+		MergedAt:  pr.GetMergedAt().Time,
+	}
+	for _, l := range pr.Labels {
+		converted.Labels = append(converted.Labels, l.GetName())
+	}
+	for _, u := range pr.RequestedReviewers {
+		converted.Reviewers = append(converted.Reviewers, u.GetLogin())
+	}
+	return converted
+}
+
+// convertIssuePullRequest converts the issue of a pull request. Issues carry
+// no branches or requested reviewers.
+func convertIssuePullRequest(issue *github.Issue) PullRequest {
+	converted := PullRequest{
+		Number:    issue.GetNumber(),
+		Title:     issue.GetTitle(),
+		Body:      issue.GetBody(),
+		State:     issue.GetState(),
+		HTMLURL:   issue.GetHTMLURL(),
+		Author:    issue.GetUser().GetLogin(),
+		CreatedAt: issue.GetCreatedAt().Time,
+		UpdatedAt: issue.GetUpdatedAt().Time,
+		MergedAt:  issue.GetPullRequestLinks().GetMergedAt().Time,
+	}
+	for _, l := range issue.Labels {
+		converted.Labels = append(converted.Labels, l.GetName())
+	}
+	return converted
+}
+
 // decodeBase64Content decodes base64-encoded content.
 func decodeBase64Content(encoded string) (string, error) {
 	decoded, err := base64.StdEncoding.DecodeString(encoded)
@@ -267,3 +795,24 @@ func decodeBase64Content(encoded string) (string, error) {
 	}
 	return string(decoded), nil
 }
+
+// IsTransient reports whether err is a GitHub failure that may succeed if
+// retried: a server error, a rate limit or a network error.
+func IsTransient(err error) bool {
+	var (
+		rateErr  *github.RateLimitError
+		abuseErr *github.AbuseRateLimitError
+		ghErr    *github.ErrorResponse
+		netErr   net.Error
+	)
+	switch {
+	case errors.As(err, &rateErr), errors.As(err, &abuseErr):
+		return true
+	case errors.As(err, &ghErr):
+		code := ghErr.Response.StatusCode
+		return code >= http.StatusInternalServerError || code == http.StatusTooManyRequests
+	case errors.As(err, &netErr):
+		return true
+	}
+	return false
+}
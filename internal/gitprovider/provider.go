@@ -1,6 +1,9 @@
 package gitprovider
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 // FileContent represents the content of a file from a git provider.
 type FileContent struct {
@@ -58,6 +61,133 @@ type PRResponse struct {
 	HTMLURL string
 }
 
+// IssueRequest represents a request to open an issue.
+type IssueRequest struct {
+	Title  string
+	Body   string
+	Labels []string
+}
+
+// IssueResponse represents a created issue.
+type IssueResponse struct {
+	Number  int
+	HTMLURL string
+}
+
+// PullRequest represents an existing pull request.
+type PullRequest struct {
+	Number    int
+	Title     string
+	Body      string
+	State     string // open or closed
+	HTMLURL   string
+	Head      string
+	HeadSHA   string
+	HeadRepo  string // owner/repo the head branch lives in
+	Base      string
+	Author    string
+	Labels    []string
+	Reviewers []string // requested reviewers who have not yet responded
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	MergedAt  time.Time // zero unless merged
+}
+
+// PullRequestQuery selects the pull requests ListPullRequests returns.
+type PullRequestQuery struct {
+	State string // "open", "closed" or "all"
+	// Label keeps only pull requests carrying it. Labeled pull requests are
+	// listed without Head, HeadSHA, HeadRepo, Base and Reviewers, which
+	// GetPullRequest returns.
+	Label string
+	// UpdatedSince keeps only pull requests updated after it, unless zero.
+	UpdatedSince time.Time
+}
+
+// Review represents a submitted pull request review.
+type Review struct {
+	ID          int64
+	User        string
+	State       string // "APPROVED", "CHANGES_REQUESTED", "COMMENTED", "DISMISSED"
+	Body        string
+	SubmittedAt time.Time
+}
+
+// ReviewComment represents an inline comment left on a pull request diff.
+type ReviewComment struct {
+	ID        int64
+	User      string
+	Path      string
+	Body      string
+	CreatedAt time.Time
+}
+
+// Comment represents a comment on a pull request's conversation.
+type Comment struct {
+	ID        int64
+	User      string
+	Body      string
+	CreatedAt time.Time
+}
+
+// PullRequestFile represents a file changed by a pull request.
+type PullRequestFile struct {
+	Path   string
+	Status string // "added", "modified", "removed", "renamed"
+	Patch  string // unified diff hunks, empty for binary or very large files
+}
+
+// Commit represents a commit in a file's history.
+type Commit struct {
+	SHA     string
+	Message string
+	Author  string
+	Date    time.Time
+	Patch   string // the commit's diff of the file, empty for binary or very large files
+}
+
+// DraftReviewComment is an inline comment to attach to a new review.
+// Lines refer to the new (right-hand) side of the diff.
+type DraftReviewComment struct {
+	Path      string
+	StartLine int // first line of a multi-line comment, 0 for single-line
+	Line      int
+	Body      string
+}
+
+// ReviewRequest represents a review to submit on a pull request.
+type ReviewRequest struct {
+	CommitSHA string
+	Body      string
+	Comments  []DraftReviewComment
+}
+
+// AdvisoryRequest represents a draft repository security advisory.
+type AdvisoryRequest struct {
+	Summary     string
+	Description string
+	Severity    string // "critical", "high", "medium", "low"
+}
+
+// Advisory represents a created repository security advisory.
+type Advisory struct {
+	GHSAID  string
+	HTMLURL string
+}
+
+// Capabilities reports what the configured credential can do on a repository.
+type Capabilities struct {
+	ReadContents bool     `json:"read_contents"`
+	CreateRefs   bool     `json:"create_refs"`
+	OpenPRs      bool     `json:"open_prs"`
+	Problems     []string `json:"problems,omitempty"`
+}
+
+// OK reports whether every capability the agent needs is available.
+func (c *Capabilities) OK() bool {
+	return c.ReadContents && c.CreateRefs && c.OpenPRs
+}
+
 // Provider defines the interface for git operations.
 // This abstraction allows supporting multiple git providers (GitHub, GitLab, Bitbucket).
 type Provider interface {
@@ -70,6 +200,10 @@ type Provider interface {
 	// ListDirectory lists contents of a directory at a specific ref.
 	ListDirectory(ctx context.Context, path, ref string) ([]DirEntry, error)
 
+	// FileHistory lists the latest limit commits touching a file up to ref,
+	// newest first.
+	FileHistory(ctx context.Context, path, ref string, limit int) ([]Commit, error)
+
 	// GetDefaultBranch returns the repository's default branch name.
 	GetDefaultBranch(ctx context.Context) (string, error)
 
@@ -79,12 +213,68 @@ type Provider interface {
 	// CreateBranch creates a new branch from a base commit SHA.
 	CreateBranch(ctx context.Context, name, baseSHA string) error
 
+	// DeleteBranch deletes a branch. Deleting one that doesn't exist succeeds.
+	DeleteBranch(ctx context.Context, name string) error
+
 	// CommitFiles commits file changes to a branch.
 	CommitFiles(ctx context.Context, branch string, files []FileChange, message string) (string, error)
 
 	// CreatePullRequest creates a pull request.
 	CreatePullRequest(ctx context.Context, req PRRequest) (*PRResponse, error)
 
+	// ListPullRequests lists the pull requests matching q, most recently
+	// updated first.
+	ListPullRequests(ctx context.Context, q PullRequestQuery) ([]PullRequest, error)
+
+	// GetPullRequest returns a pull request with all its details.
+	GetPullRequest(ctx context.Context, number int) (*PullRequest, error)
+
+	// SearchPullRequests lists the pull requests in the repository matching
+	// a search query, such as `is:merged label:bug "some text"`. Like labeled
+	// pull requests, results lack their branches and reviewers.
+	SearchPullRequests(ctx context.Context, query string) ([]PullRequest, error)
+
+	// ListReviews lists the reviews submitted on a pull request.
+	ListReviews(ctx context.Context, number int) ([]Review, error)
+
+	// ListReviewComments lists the inline review comments on a pull request.
+	ListReviewComments(ctx context.Context, number int) ([]ReviewComment, error)
+
+	// ListComments lists the conversation comments on a pull request.
+	ListComments(ctx context.Context, number int) ([]Comment, error)
+
+	// ListPullRequestFiles lists the files changed by a pull request.
+	ListPullRequestFiles(ctx context.Context, number int) ([]PullRequestFile, error)
+
+	// CreateReview submits a non-approving review with optional inline comments.
+	CreateReview(ctx context.Context, number int, req ReviewRequest) error
+
+	// AddComment posts a comment on a pull request.
+	AddComment(ctx context.Context, number int, body string) error
+
+	// AddLabels adds labels to a pull request.
+	AddLabels(ctx context.Context, number int, labels []string) error
+
+	// RequestReviewers (re-)requests review from the given users.
+	RequestReviewers(ctx context.Context, number int, reviewers []string) error
+
+	// ClosePullRequest closes a pull request without merging it.
+	ClosePullRequest(ctx context.Context, number int) error
+
+	// CreateIssue opens an issue.
+	CreateIssue(ctx context.Context, req IssueRequest) (*IssueResponse, error)
+
+	// CreateSecurityAdvisory opens a draft security advisory visible only to maintainers.
+	CreateSecurityAdvisory(ctx context.Context, req AdvisoryRequest) (*Advisory, error)
+
+	// CreatePrivateFork creates a temporary private fork for an advisory and
+	// returns its owner and name.
+	CreatePrivateFork(ctx context.Context, ghsaID string) (owner, repo string, err error)
+
+	// CheckCapabilities verifies, without leaving side effects, that the
+	// credential can read contents, create refs and open pull requests.
+	CheckCapabilities(ctx context.Context) (*Capabilities, error)
+
 	// Owner returns the repository owner.
 	Owner() string
 
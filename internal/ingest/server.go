@@ -0,0 +1,151 @@
+// Package ingest implements the gRPC ingestion API, which lets internal
+// error pipelines submit errors without crafting Sentry webhook payloads.
+package ingest
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/ingest/ingestpb"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/webhook"
+)
+
+// Server implements ingestpb.IngestServiceServer.
+type Server struct {
+	ingestpb.UnimplementedIngestServiceServer
+
+	jobQueue webhook.JobQueue
+	filters  func(tenant string) ([]webhook.Filter, bool)
+}
+
+// NewServer creates an ingestion server that queues jobs on jobQueue after
+// applying the filters of the submission's tenant in order. filters reports
+// false for tenants that don't exist, whose submissions are rejected.
+func NewServer(jobQueue webhook.JobQueue, filters func(tenant string) ([]webhook.Filter, bool)) *Server {
+	return &Server{jobQueue: jobQueue, filters: filters}
+}
+
+// SubmitError validates and queues a submitted error.
+func (s *Server) SubmitError(ctx context.Context, req *ingestpb.SubmitErrorRequest) (*ingestpb.SubmitErrorResponse, error) {
+	pe := req.GetError()
+	if pe.GetIssueId() == "" || pe.GetProjectSlug() == "" {
+		return nil, status.Error(codes.InvalidArgument, "error.issue_id and error.project_slug are required")
+	}
+
+	filters, ok := s.filters(req.GetTenant())
+	if !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown tenant %q", req.GetTenant())
+	}
+
+	parsed := toParsedError(pe)
+	for _, f := range filters {
+		if ok, reason := f(parsed); !ok {
+			log.Printf("skipping submitted issue %s: %s", parsed.IssueID, reason)
+			return &ingestpb.SubmitErrorResponse{
+				Status: ingestpb.SubmitErrorResponse_STATUS_SKIPPED,
+				Reason: reason,
+			}, nil
+		}
+	}
+
+	err := s.jobQueue.Enqueue(ctx, webhook.Job{ParsedError: parsed, Tenant: req.GetTenant(), ReceivedAt: time.Now()})
+	if errors.Is(err, webhook.ErrDuplicateJob) {
+		log.Printf("submitted issue %s is already queued or being fixed", parsed.IssueID)
+		return &ingestpb.SubmitErrorResponse{
+			Status: ingestpb.SubmitErrorResponse_STATUS_SKIPPED,
+			Reason: "a job for this issue is already queued or running",
+		}, nil
+	}
+	if errors.Is(err, webhook.ErrQueueFull) {
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	}
+	if err != nil {
+		log.Printf("failed to queue submitted issue %s: %v", parsed.IssueID, err)
+		return nil, status.Error(codes.Unavailable, "failed to queue job")
+	}
+	log.Printf("queued submitted job for issue %s (project: %s)", parsed.IssueID, parsed.ProjectSlug)
+
+	return &ingestpb.SubmitErrorResponse{Status: ingestpb.SubmitErrorResponse_STATUS_QUEUED}, nil
+}
+
+// AuthInterceptor rejects calls that don't carry token as a bearer token in
+// the authorization metadata.
+func AuthInterceptor(token string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		var given string
+		if values := md.Get("authorization"); len(values) > 0 {
+			given = strings.TrimPrefix(values[0], "Bearer ")
+		}
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			return nil, status.Error(codes.Unauthenticated, "invalid token")
+		}
+		return handler(ctx, req)
+	}
+}
+
+func toParsedError(pe *ingestpb.ParsedError) *webhook.ParsedError {
+	parsed := &webhook.ParsedError{
+		IssueID:      pe.GetIssueId(),
+		ShortID:      pe.GetShortId(),
+		ProjectSlug:  pe.GetProjectSlug(),
+		Title:        pe.GetTitle(),
+		ErrorType:    pe.GetErrorType(),
+		ErrorMessage: pe.GetErrorMessage(),
+		Level:        pe.GetLevel(),
+		Platform:     pe.GetPlatform(),
+		Culprit:      pe.GetCulprit(),
+		Permalink:    pe.GetPermalink(),
+		Frames:       make([]webhook.Frame, 0, len(pe.GetFrames())),
+		Tags:         make(map[string]string, len(pe.GetTags())),
+		Release:      pe.GetRelease(),
+		Environment:  pe.GetEnvironment(),
+		ServerName:   pe.GetServerName(),
+		EventCount:   int(pe.GetEventCount()),
+		UserCount:    int(pe.GetUserCount()),
+	}
+	for k, v := range pe.GetTags() {
+		parsed.Tags[k] = v
+	}
+
+	for _, f := range pe.GetFrames() {
+		frame := webhook.Frame{
+			Filename:    f.GetFilename(),
+			AbsPath:     f.GetAbsPath(),
+			Module:      f.GetModule(),
+			Package:     f.GetPackage(),
+			Function:    f.GetFunction(),
+			LineNo:      int(f.GetLineNo()),
+			ColNo:       int(f.GetColNo()),
+			InApp:       f.GetInApp(),
+			PreContext:  f.GetPreContext(),
+			ContextLine: f.GetContextLine(),
+			PostContext: f.GetPostContext(),
+		}
+		if len(f.GetVars()) > 0 {
+			frame.Vars = make(map[string]interface{}, len(f.GetVars()))
+			for k, v := range f.GetVars() {
+				frame.Vars[k] = v
+			}
+		}
+		parsed.Frames = append(parsed.Frames, frame)
+	}
+
+	for _, frame := range parsed.Frames {
+		if frame.InApp && frame.IsMinified() {
+			parsed.Minified = true
+			break
+		}
+	}
+
+	return parsed
+}
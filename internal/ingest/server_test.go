@@ -0,0 +1,97 @@
+package ingest
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/ingest/ingestpb"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/queue"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/webhook"
+)
+
+func TestServer_SubmitError(t *testing.T) {
+	jobQueue := queue.NewMemory(1)
+	denyKeyError := func(parsed *webhook.ParsedError) (bool, string) {
+		return parsed.ErrorType != "KeyError", "KeyError is denied"
+	}
+	filters := func(tenant string) ([]webhook.Filter, bool) {
+		return []webhook.Filter{denyKeyError}, tenant == "" || tenant == "acme"
+	}
+	client := startServer(t, NewServer(jobQueue, filters), "s3cret")
+
+	authed := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer s3cret")
+	valid := &ingestpb.ParsedError{
+		IssueId:     "42",
+		ProjectSlug: "api",
+		ErrorType:   "TypeError",
+		Frames:      []*ingestpb.Frame{{Filename: "app.py", Function: "handle", LineNo: 7, InApp: true, ContextLine: "x = y()"}},
+	}
+
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		req        *ingestpb.SubmitErrorRequest
+		wantCode   codes.Code
+		wantStatus ingestpb.SubmitErrorResponse_Status
+	}{
+		{"missing token", context.Background(), &ingestpb.SubmitErrorRequest{Error: valid}, codes.Unauthenticated, 0},
+		{"missing issue", authed, &ingestpb.SubmitErrorRequest{Error: &ingestpb.ParsedError{ProjectSlug: "api"}}, codes.InvalidArgument, 0},
+		{"filtered", authed, &ingestpb.SubmitErrorRequest{Error: &ingestpb.ParsedError{IssueId: "1", ProjectSlug: "api", ErrorType: "KeyError"}}, codes.OK, ingestpb.SubmitErrorResponse_STATUS_SKIPPED},
+		{"unknown tenant", authed, &ingestpb.SubmitErrorRequest{Error: valid, Tenant: "other"}, codes.InvalidArgument, 0},
+		{"queued", authed, &ingestpb.SubmitErrorRequest{Error: valid, Tenant: "acme"}, codes.OK, ingestpb.SubmitErrorResponse_STATUS_QUEUED},
+		{"queue full", authed, &ingestpb.SubmitErrorRequest{Error: valid}, codes.ResourceExhausted, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := client.SubmitError(tt.ctx, tt.req)
+			if got := status.Code(err); got != tt.wantCode {
+				t.Fatalf("SubmitError() code = %v, want %v (%v)", got, tt.wantCode, err)
+			}
+			if err == nil && resp.GetStatus() != tt.wantStatus {
+				t.Errorf("SubmitError() status = %v, want %v", resp.GetStatus(), tt.wantStatus)
+			}
+		})
+	}
+
+	msg, err := jobQueue.Dequeue(context.Background())
+	if err != nil {
+		t.Fatalf("Dequeue() error = %v", err)
+	}
+	job := msg.Job
+	if job.Tenant != "acme" || job.ParsedError.IssueID != "42" {
+		t.Errorf("job = %+v", job)
+	}
+	if lines := job.ParsedError.Frames[0].ContextLines(); len(lines) != 1 || lines[0].LineNo != 7 {
+		t.Errorf("ContextLines() = %+v, want the context line at line 7", lines)
+	}
+}
+
+func startServer(t *testing.T, srv *Server, token string) ingestpb.IngestServiceClient {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer(grpc.UnaryInterceptor(AuthInterceptor(token)))
+	ingestpb.RegisterIngestServiceServer(s, srv)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("grpc.NewClient() error = %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return ingestpb.NewIngestServiceClient(conn)
+}
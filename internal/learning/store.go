@@ -0,0 +1,326 @@
+package learning
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/store"
+)
+
+// Feedback is a single piece of reviewer feedback left on a bot PR.
+type Feedback struct {
+	ID        string    `json:"id"`
+	Repo      string    `json:"repo"`
+	ErrorType string    `json:"error_type"`
+	Author    string    `json:"author"`
+	Body      string    `json:"body"`
+	PRNumber  int       `json:"pr_number"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Outcome is how a bot PR ended.
+type Outcome string
+
+const (
+	// OutcomeMerged means the PR was merged.
+	OutcomeMerged Outcome = "merged"
+	// OutcomeClosed means the PR was closed without being merged.
+	OutcomeClosed Outcome = "closed"
+	// OutcomeReverted means the PR was merged and later reverted.
+	OutcomeReverted Outcome = "reverted"
+)
+
+// PROutcome is how a bot PR ended and, for a rejected one, why.
+type PROutcome struct {
+	Repo      string    `json:"repo"`
+	ErrorType string    `json:"error_type"`
+	PRNumber  int       `json:"pr_number"`
+	Title     string    `json:"title"`
+	Outcome   Outcome   `json:"outcome"`
+	Reason    string    `json:"reason,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+// Rejected reports whether the PR was closed or reverted.
+func (o PROutcome) Rejected() bool {
+	return o.Outcome == OutcomeClosed || o.Outcome == OutcomeReverted
+}
+
+// OutcomeSummary is how the bot PRs for an error class in a repository
+// ended.
+type OutcomeSummary struct {
+	Merged   int
+	Rejected int
+	// Rejections are the latest rejected PRs, newest first.
+	Rejections []PROutcome
+}
+
+// Theme is a recurring piece of feedback with the number of times it was given.
+type Theme struct {
+	Text  string
+	Count int
+}
+
+// Store persists reviewer feedback and the outcomes of bot PRs keyed by
+// repository and error class.
+// When created with an empty path it keeps everything in memory.
+type Store struct {
+	mu   sync.Mutex
+	path string
+	data storeData
+	seen map[string]bool
+}
+
+type storeData struct {
+	Feedback []Feedback           `json:"feedback"`
+	LastSync map[string]time.Time `json:"last_sync"`
+	// Outcomes are keyed by repo#number.
+	Outcomes map[string]PROutcome `json:"outcomes,omitempty"`
+}
+
+// NewStore opens the store at path, loading any existing feedback.
+func NewStore(path string) (*Store, error) {
+	s := &Store{
+		path: path,
+		data: storeData{LastSync: make(map[string]time.Time), Outcomes: make(map[string]PROutcome)},
+		seen: make(map[string]bool),
+	}
+
+	if path == "" {
+		return s, nil
+	}
+
+	if _, err := store.ReadJSON(path, &s.data); err != nil {
+		return nil, err
+	}
+	if s.data.LastSync == nil {
+		s.data.LastSync = make(map[string]time.Time)
+	}
+	if s.data.Outcomes == nil {
+		s.data.Outcomes = make(map[string]PROutcome)
+	}
+	for _, fb := range s.data.Feedback {
+		s.seen[fb.ID] = true
+	}
+
+	return s, nil
+}
+
+// Add records feedback, ignoring entries that have already been stored.
+// It reports whether the feedback was new.
+func (s *Store) Add(fb Feedback) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.seen[fb.ID] {
+		return false, nil
+	}
+	s.seen[fb.ID] = true
+	s.data.Feedback = append(s.data.Feedback, fb)
+
+	return true, s.save()
+}
+
+// LastSync returns when feedback was last ingested for a repository.
+func (s *Store) LastSync(repo string) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.LastSync[repo]
+}
+
+// SetLastSync records when feedback was last ingested for a repository.
+func (s *Store) SetLastSync(repo string, t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.LastSync[repo] = t
+	return s.save()
+}
+
+// SetOutcome records how a bot PR ended, replacing what was recorded
+// before, except that a reverted PR stays reverted.
+func (s *Store) SetOutcome(o PROutcome) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := fmt.Sprintf("%s#%d", o.Repo, o.PRNumber)
+	if prev, ok := s.data.Outcomes[key]; ok && prev.Outcome == OutcomeReverted && o.Outcome != OutcomeReverted {
+		return nil
+	}
+	s.data.Outcomes[key] = o
+	return s.save()
+}
+
+// Outcome returns how a bot PR ended, if that was recorded.
+func (s *Store) Outcome(repo string, number int) (PROutcome, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.data.Outcomes[fmt.Sprintf("%s#%d", repo, number)]
+	return o, ok
+}
+
+// Outcomes summarizes how the bot PRs for an error class in a repository
+// ended, with at most limit of the rejected ones.
+func (s *Store) Outcomes(repo, errorType string, limit int) OutcomeSummary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var summary OutcomeSummary
+	var rejections []PROutcome
+	for _, o := range s.data.Outcomes {
+		if o.Repo != repo || o.ErrorType != errorType {
+			continue
+		}
+		if o.Rejected() {
+			summary.Rejected++
+			rejections = append(rejections, o)
+		} else {
+			summary.Merged++
+		}
+	}
+	sort.Slice(rejections, func(i, j int) bool {
+		if !rejections[i].At.Equal(rejections[j].At) {
+			return rejections[i].At.After(rejections[j].At)
+		}
+		return rejections[i].PRNumber > rejections[j].PRNumber
+	})
+	if len(rejections) > limit {
+		rejections = rejections[:limit]
+	}
+	summary.Rejections = rejections
+	return summary
+}
+
+// minThemeCount is how many times feedback must be given to be a theme.
+const minThemeCount = 2
+
+// themeSimilarity is the share of keywords feedback must have in common with
+// a theme to count towards it.
+const themeSimilarity = 0.5
+
+// Themes returns the most frequently given feedback for a repository, leaving
+// out feedback given fewer than minThemeCount times. Feedback is grouped by
+// the keywords it shares, so differently worded requests for the same change
+// count together, and each theme reads as its latest wording. Feedback given
+// on the same error class is ranked ahead of repo-wide feedback.
+func (s *Store) Themes(repo, errorType string, limit int) []Theme {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	type group struct {
+		theme     Theme
+		keywords  map[string]bool
+		sameClass bool
+		latest    time.Time
+	}
+
+	var feedback []Feedback
+	for _, fb := range s.data.Feedback {
+		if fb.Repo == repo {
+			feedback = append(feedback, fb)
+		}
+	}
+	// Newest first, so each group is worded like its latest feedback
+	sort.SliceStable(feedback, func(i, j int) bool {
+		return feedback[i].CreatedAt.After(feedback[j].CreatedAt)
+	})
+
+	var groups []*group
+	for _, fb := range feedback {
+		words := keywords(fb.Body)
+		if len(words) == 0 {
+			continue
+		}
+
+		var g *group
+		best := themeSimilarity
+		for _, candidate := range groups {
+			if sim := similarity(words, candidate.keywords); sim >= best {
+				g, best = candidate, sim
+			}
+		}
+		if g == nil {
+			g = &group{theme: Theme{Text: strings.TrimSpace(fb.Body)}, keywords: words, latest: fb.CreatedAt}
+			groups = append(groups, g)
+		}
+		g.theme.Count++
+		if fb.ErrorType == errorType {
+			g.sameClass = true
+		}
+	}
+
+	sorted := make([]*group, 0, len(groups))
+	for _, g := range groups {
+		if g.theme.Count >= minThemeCount {
+			sorted = append(sorted, g)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.sameClass != b.sameClass {
+			return a.sameClass
+		}
+		if a.theme.Count != b.theme.Count {
+			return a.theme.Count > b.theme.Count
+		}
+		return a.latest.After(b.latest)
+	})
+
+	var themes []Theme
+	for _, g := range sorted {
+		if len(themes) == limit {
+			break
+		}
+		themes = append(themes, g.theme)
+	}
+	return themes
+}
+
+// save writes the store to disk. Callers must hold s.mu.
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	return store.WriteJSON(s.path, s.data)
+}
+
+// stopwords are left out of feedback keywords.
+var stopwords = map[string]bool{
+	"the": true, "and": true, "for": true, "this": true, "that": true, "these": true,
+	"with": true, "are": true, "was": true, "not": true, "but": true, "can": true,
+	"could": true, "should": true, "would": true, "please": true, "here": true,
+	"there": true, "you": true, "from": true, "into": true, "also": true, "it's": true,
+}
+
+// keywords returns the significant words of feedback, lowercased with a
+// trailing plural "s" dropped.
+func keywords(s string) map[string]bool {
+	words := make(map[string]bool)
+	for _, w := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\''
+	}) {
+		if len(w) < 3 || stopwords[w] {
+			continue
+		}
+		if len(w) > 3 && strings.HasSuffix(w, "s") && !strings.HasSuffix(w, "ss") {
+			w = strings.TrimSuffix(w, "s")
+		}
+		words[w] = true
+	}
+	return words
+}
+
+// similarity is the share of the combined keywords of a and b found in both.
+func similarity(a, b map[string]bool) float64 {
+	shared := 0
+	for w := range a {
+		if b[w] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
@@ -0,0 +1,118 @@
+package learning
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStore_Themes(t *testing.T) {
+	store, err := NewStore("")
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+
+	now := time.Now()
+	entries := []Feedback{
+		{ID: "1", Repo: "org/app", ErrorType: "TypeError", Body: "Add nil checks at the call site", CreatedAt: now},
+		{ID: "2", Repo: "org/app", ErrorType: "KeyError", Body: "add nil checks at the  call site.", CreatedAt: now},
+		{ID: "3", Repo: "org/app", ErrorType: "KeyError", Body: "Please add a test", CreatedAt: now.Add(-2 * time.Hour)},
+		{ID: "5", Repo: "org/app", ErrorType: "KeyError", Body: "Please add a test", CreatedAt: now.Add(-time.Hour)},
+		{ID: "6", Repo: "org/app", ErrorType: "KeyError", Body: "Rename this variable", CreatedAt: now},
+		{ID: "7", Repo: "org/app", ErrorType: "KeyError", Body: "Guard against a None response", CreatedAt: now.Add(-time.Hour)},
+		{ID: "8", Repo: "org/app", ErrorType: "KeyError", Body: "The response can be None, guard it", CreatedAt: now.Add(-30 * time.Minute)},
+		{ID: "4", Repo: "org/other", ErrorType: "KeyError", Body: "Unrelated repo", CreatedAt: now},
+		{ID: "1", Repo: "org/app", ErrorType: "TypeError", Body: "Add nil checks at the call site", CreatedAt: now},
+	}
+	for _, fb := range entries {
+		if _, err := store.Add(fb); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+	}
+
+	themes := store.Themes("org/app", "KeyError", 5)
+	if len(themes) != 3 {
+		t.Fatalf("Themes() returned %d themes, want 3: %+v", len(themes), themes)
+	}
+	if themes[0].Count != 2 {
+		t.Errorf("top theme count = %d, want 2 (duplicate ID must be ignored)", themes[0].Count)
+	}
+	// Differently worded feedback sharing its keywords is one theme, worded
+	// like the latest feedback
+	if themes[1].Text != "The response can be None, guard it" || themes[1].Count != 2 {
+		t.Errorf("second theme = %+v, want the None response feedback twice", themes[1])
+	}
+	if themes[2].Text != "Please add a test" {
+		t.Errorf("third theme = %q, want %q", themes[2].Text, "Please add a test")
+	}
+	for _, theme := range themes {
+		if theme.Text == "Rename this variable" {
+			t.Error("Themes() returned feedback given only once")
+		}
+	}
+
+	if got := store.Themes("org/app", "KeyError", 1); len(got) != 1 {
+		t.Errorf("Themes() with limit 1 returned %d themes", len(got))
+	}
+}
+
+func TestStore_Persistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "learning.json")
+
+	store, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	if _, err := store.Add(Feedback{ID: "1", Repo: "org/app", Body: "Keep it small"}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	synced := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := store.SetLastSync("org/app", synced); err != nil {
+		t.Fatalf("SetLastSync() error = %v", err)
+	}
+
+	reopened, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore() reopen error = %v", err)
+	}
+	if added, _ := reopened.Add(Feedback{ID: "1", Repo: "org/app", Body: "Keep it small"}); added {
+		t.Error("feedback already persisted should not be added again")
+	}
+	if got := reopened.LastSync("org/app"); !got.Equal(synced) {
+		t.Errorf("LastSync() = %v, want %v", got, synced)
+	}
+}
+
+func TestStore_Outcomes(t *testing.T) {
+	store, err := NewStore("")
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+
+	now := time.Now()
+	outcomes := []PROutcome{
+		{Repo: "org/app", ErrorType: "KeyError", PRNumber: 1, Outcome: OutcomeMerged, At: now},
+		{Repo: "org/app", ErrorType: "KeyError", PRNumber: 2, Outcome: OutcomeClosed, Reason: "Wrong layer", At: now.Add(-time.Hour)},
+		{Repo: "org/app", ErrorType: "KeyError", PRNumber: 3, Outcome: OutcomeReverted, Reason: "Broke checkout", At: now},
+		{Repo: "org/app", ErrorType: "TypeError", PRNumber: 4, Outcome: OutcomeClosed, At: now},
+		// A reverted PR stays reverted when it is seen merged again
+		{Repo: "org/app", ErrorType: "KeyError", PRNumber: 3, Outcome: OutcomeMerged, At: now},
+	}
+	for _, o := range outcomes {
+		if err := store.SetOutcome(o); err != nil {
+			t.Fatalf("SetOutcome() error = %v", err)
+		}
+	}
+
+	summary := store.Outcomes("org/app", "KeyError", 5)
+	if summary.Merged != 1 || summary.Rejected != 2 {
+		t.Fatalf("Outcomes() = %+v, want 1 merged and 2 rejected", summary)
+	}
+	if summary.Rejections[0].PRNumber != 3 || summary.Rejections[1].PRNumber != 2 {
+		t.Errorf("rejections = %+v, want PR 3 then PR 2", summary.Rejections)
+	}
+
+	if got := store.Outcomes("org/app", "KeyError", 1); len(got.Rejections) != 1 || got.Rejected != 2 {
+		t.Errorf("Outcomes() with limit 1 = %+v", got)
+	}
+}
@@ -0,0 +1,101 @@
+package queue
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/store"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/webhook"
+)
+
+// DeadLetter is a job that failed after exhausting its retries.
+type DeadLetter struct {
+	ID       string      `json:"id"`
+	Job      webhook.Job `json:"job"`
+	Error    string      `json:"error"`
+	FailedAt time.Time   `json:"failed_at"`
+}
+
+// DeadLetters holds failed jobs until an operator requeues them. When created
+// with an empty path it keeps everything in memory.
+type DeadLetters struct {
+	path string
+	now  func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]DeadLetter
+}
+
+// OpenDeadLetters opens the dead-letter queue at path.
+func OpenDeadLetters(path string) (*DeadLetters, error) {
+	d := &DeadLetters{
+		path:    path,
+		now:     time.Now,
+		entries: make(map[string]DeadLetter),
+	}
+
+	if path != "" {
+		if _, err := store.ReadJSON(path, &d.entries); err != nil {
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
+
+// Add records job as failed with jobErr.
+func (d *DeadLetters) Add(job webhook.Job, jobErr error) (DeadLetter, error) {
+	id, err := newID()
+	if err != nil {
+		return DeadLetter{}, err
+	}
+	entry := DeadLetter{ID: id, Job: job, Error: jobErr.Error(), FailedAt: d.now()}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.entries[id] = entry
+	return entry, d.save()
+}
+
+// List returns all dead letters, oldest first.
+func (d *DeadLetters) List() []DeadLetter {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	entries := make([]DeadLetter, 0, len(d.entries))
+	for _, e := range d.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].FailedAt.Before(entries[j].FailedAt)
+	})
+	return entries
+}
+
+// Get returns the dead letter with the given ID.
+func (d *DeadLetters) Get(id string) (DeadLetter, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	e, ok := d.entries[id]
+	return e, ok
+}
+
+// Remove deletes the dead letter with the given ID, e.g. once it is requeued.
+func (d *DeadLetters) Remove(id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.entries, id)
+	return d.save()
+}
+
+// save writes the queue to disk. Callers must hold d.mu.
+func (d *DeadLetters) save() error {
+	if d.path == "" {
+		return nil
+	}
+	return store.WriteJSON(d.path, d.entries)
+}
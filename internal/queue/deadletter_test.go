@@ -0,0 +1,51 @@
+package queue
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDeadLetters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dead-letters.json")
+	now := time.Date(2024, 6, 30, 12, 0, 0, 0, time.UTC)
+
+	d, err := OpenDeadLetters(path)
+	if err != nil {
+		t.Fatalf("OpenDeadLetters() error = %v", err)
+	}
+	d.now = func() time.Time { return now }
+
+	first, err := d.Add(testJob("1"), errors.New("GitHub returned 502"))
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	now = now.Add(time.Minute)
+	if _, err := d.Add(testJob("2"), errors.New("Claude Code timed out")); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	// Entries survive a restart
+	reopened, err := OpenDeadLetters(path)
+	if err != nil {
+		t.Fatalf("OpenDeadLetters() reopen error = %v", err)
+	}
+	entries := reopened.List()
+	if len(entries) != 2 {
+		t.Fatalf("List() = %d entries, want 2", len(entries))
+	}
+	if entries[0].ID != first.ID || entries[0].Job.ParsedError.IssueID != "1" || entries[0].Error != "GitHub returned 502" {
+		t.Errorf("List()[0] = %+v, want oldest entry first", entries[0])
+	}
+
+	if err := reopened.Remove(first.ID); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if _, ok := reopened.Get(first.ID); ok {
+		t.Error("Get() found removed entry")
+	}
+	if len(reopened.List()) != 1 {
+		t.Errorf("List() after Remove = %d entries, want 1", len(reopened.List()))
+	}
+}
@@ -0,0 +1,132 @@
+package queue
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/webhook"
+)
+
+// Memory is an in-process queue that hands out the highest-priority job
+// first (see webhook.ParsedError.Priority). Jobs are lost on restart.
+type Memory struct {
+	capacity int
+	ready    chan struct{} // signalled when jobs may be waiting
+
+	mu     sync.Mutex
+	jobs   jobHeap
+	seq    uint64
+	active map[string]bool // keys of queued and unacknowledged jobs
+}
+
+// NewMemory creates an in-memory queue holding up to capacity jobs.
+func NewMemory(capacity int) *Memory {
+	return &Memory{
+		capacity: capacity,
+		ready:    make(chan struct{}, 1),
+		active:   make(map[string]bool),
+	}
+}
+
+// Enqueue implements Queue.
+func (m *Memory) Enqueue(ctx context.Context, job webhook.Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.active[job.Key()] {
+		return webhook.ErrDuplicateJob
+	}
+	if len(m.jobs) >= m.capacity {
+		return webhook.ErrQueueFull
+	}
+	m.active[job.Key()] = true
+	m.seq++
+	heap.Push(&m.jobs, queuedJob{job: job, priority: job.ParsedError.Priority(), seq: m.seq})
+	m.signal()
+	return nil
+}
+
+// Dequeue implements Queue.
+func (m *Memory) Dequeue(ctx context.Context) (*Message, error) {
+	for {
+		m.mu.Lock()
+		if len(m.jobs) > 0 {
+			next := heap.Pop(&m.jobs).(queuedJob)
+			if len(m.jobs) > 0 {
+				// Wake another waiting worker for the rest
+				m.signal()
+			}
+			m.mu.Unlock()
+			return &Message{Job: next.job}, nil
+		}
+		m.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-m.ready:
+		}
+	}
+}
+
+// signal wakes a waiting Dequeue without blocking.
+func (m *Memory) signal() {
+	select {
+	case m.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Ack implements Queue, allowing new jobs for the message's issue.
+func (m *Memory) Ack(ctx context.Context, msg *Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.active, msg.Job.Key())
+	return nil
+}
+
+// Len returns the number of waiting jobs.
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.jobs)
+}
+
+// Close implements Queue.
+func (m *Memory) Close() error {
+	return nil
+}
+
+// queuedJob is a job waiting in a Memory queue. seq keeps jobs of equal
+// priority in arrival order.
+type queuedJob struct {
+	job      webhook.Job
+	priority float64
+	seq      uint64
+}
+
+// jobHeap is a max-heap of jobs by priority.
+type jobHeap []queuedJob
+
+func (h jobHeap) Len() int { return len(h) }
+
+func (h jobHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h jobHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *jobHeap) Push(x any) { *h = append(*h, x.(queuedJob)) }
+
+func (h *jobHeap) Pop() any {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
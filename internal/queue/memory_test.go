@@ -0,0 +1,105 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/webhook"
+)
+
+func TestMemory_PriorityOrder(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemory(4)
+
+	jobs := []*webhook.ParsedError{
+		{IssueID: "warning", Level: "warning", UserCount: 1},
+		{IssueID: "error-1", Level: "error", UserCount: 10},
+		{IssueID: "fatal", Level: "fatal", UserCount: 5000},
+		{IssueID: "error-2", Level: "error", UserCount: 10},
+	}
+	for _, parsed := range jobs {
+		if err := q.Enqueue(ctx, webhook.Job{ParsedError: parsed}); err != nil {
+			t.Fatalf("Enqueue(%s) error = %v", parsed.IssueID, err)
+		}
+	}
+	if err := q.Enqueue(ctx, testJob("over")); !errors.Is(err, webhook.ErrQueueFull) {
+		t.Fatalf("Enqueue() over capacity error = %v, want ErrQueueFull", err)
+	}
+
+	for _, want := range []string{"fatal", "error-1", "error-2", "warning"} {
+		msg, err := q.Dequeue(ctx)
+		if err != nil {
+			t.Fatalf("Dequeue() error = %v", err)
+		}
+		if msg.Job.ParsedError.IssueID != want {
+			t.Errorf("Dequeue() = %s, want %s", msg.Job.ParsedError.IssueID, want)
+		}
+	}
+}
+
+func TestMemory_DequeueWaits(t *testing.T) {
+	q := NewMemory(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := q.Dequeue(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Dequeue() on empty queue error = %v, want DeadlineExceeded", err)
+	}
+
+	got := make(chan string)
+	go func() {
+		msg, err := q.Dequeue(context.Background())
+		if err == nil {
+			got <- msg.Job.ParsedError.IssueID
+		}
+	}()
+	if err := q.Enqueue(context.Background(), testJob("1")); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+
+	select {
+	case id := <-got:
+		if id != "1" {
+			t.Errorf("Dequeue() = %s, want 1", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiting Dequeue() not woken by Enqueue()")
+	}
+}
+
+func TestMemory_CoalescesIssue(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemory(4)
+
+	if err := q.Enqueue(ctx, testJob("1")); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	if err := q.Enqueue(ctx, testJob("1")); !errors.Is(err, webhook.ErrDuplicateJob) {
+		t.Fatalf("Enqueue() queued issue error = %v, want ErrDuplicateJob", err)
+	}
+
+	// Still a duplicate while the job runs
+	msg, err := q.Dequeue(ctx)
+	if err != nil {
+		t.Fatalf("Dequeue() error = %v", err)
+	}
+	if err := q.Enqueue(ctx, testJob("1")); !errors.Is(err, webhook.ErrDuplicateJob) {
+		t.Fatalf("Enqueue() running issue error = %v, want ErrDuplicateJob", err)
+	}
+
+	// The same issue ID for another tenant is a different job
+	other := testJob("1")
+	other.Tenant = "globex"
+	if err := q.Enqueue(ctx, other); err != nil {
+		t.Fatalf("Enqueue() other tenant error = %v", err)
+	}
+
+	if err := q.Ack(ctx, msg); err != nil {
+		t.Fatalf("Ack() error = %v", err)
+	}
+	if err := q.Enqueue(ctx, testJob("1")); err != nil {
+		t.Errorf("Enqueue() after Ack error = %v", err)
+	}
+}
@@ -0,0 +1,216 @@
+package queue
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/webhook"
+)
+
+const (
+	natsConsumer      = "workers"
+	natsActiveTTL     = 24 * time.Hour // bounds how long a lost job blocks its issue
+	natsBlock         = 5 * time.Second
+	defaultNATSStream = "SENTRYAGENT_JOBS"
+)
+
+// NATS is a queue backed by a NATS JetStream work-queue stream with a shared
+// durable consumer, so webhook frontends can publish jobs that dedicated
+// worker processes consume. A job left unacknowledged for ClaimAfter is
+// redelivered to another worker.
+type NATS struct {
+	conn     *nats.Conn
+	js       jetstream.JetStream
+	subject  string
+	consumer jetstream.Consumer
+	active   jetstream.KeyValue // issues with a job queued or running
+
+	mu       sync.Mutex
+	inflight map[string]jetstream.Msg
+}
+
+// OpenNATS connects to NATS and creates the stream, consumer and active-job
+// bucket if needed.
+func OpenNATS(ctx context.Context, opts Options) (*NATS, error) {
+	conn, err := nats.Connect(opts.NATSURL, nats.Name("sentryagent"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	q, err := newNATS(ctx, conn, opts)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return q, nil
+}
+
+func newNATS(ctx context.Context, conn *nats.Conn, opts Options) (*NATS, error) {
+	js, err := jetstream.New(conn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open JetStream: %w", err)
+	}
+
+	stream := opts.NATSStream
+	if stream == "" {
+		stream = defaultNATSStream
+	}
+	claimAfter := opts.ClaimAfter
+	if claimAfter <= 0 {
+		claimAfter = defaultClaimTime
+	}
+	maxMsgs := int64(opts.Capacity)
+	if maxMsgs <= 0 {
+		maxMsgs = -1
+	}
+
+	q := &NATS{
+		conn:     conn,
+		js:       js,
+		subject:  stream + ".jobs",
+		inflight: make(map[string]jetstream.Msg),
+	}
+
+	// Messages stay in a work-queue stream until acknowledged, so MaxMsgs
+	// counts waiting and in-flight jobs
+	if _, err := js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:      stream,
+		Subjects:  []string{q.subject},
+		Retention: jetstream.WorkQueuePolicy,
+		MaxMsgs:   maxMsgs,
+		Discard:   jetstream.DiscardNew,
+		Storage:   jetstream.FileStorage,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to create NATS stream %s: %w", stream, err)
+	}
+	if q.consumer, err = js.CreateOrUpdateConsumer(ctx, stream, jetstream.ConsumerConfig{
+		Durable:       natsConsumer,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       claimAfter,
+		MaxAckPending: -1,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to create NATS consumer: %w", err)
+	}
+	if q.active, err = js.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
+		Bucket: stream + "_ACTIVE",
+		TTL:    natsActiveTTL,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to create NATS active-job bucket: %w", err)
+	}
+
+	return q, nil
+}
+
+// Enqueue implements Queue. Each issue's job is marked active in a key-value
+// bucket until acknowledged.
+func (q *NATS) Enqueue(ctx context.Context, job webhook.Job) (err error) {
+	active := q.activeKey(job)
+	if _, err := q.active.Create(ctx, active, []byte("1")); err != nil {
+		if errors.Is(err, jetstream.ErrKeyExists) {
+			return webhook.ErrDuplicateJob
+		}
+		return fmt.Errorf("failed to check for queued job: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			q.active.Delete(context.WithoutCancel(ctx), active)
+		}
+	}()
+
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to encode job: %w", err)
+	}
+	if _, err := q.js.Publish(ctx, q.subject, data); err != nil {
+		var apiErr *jetstream.APIError
+		if errors.As(err, &apiErr) && strings.Contains(apiErr.Description, "maximum messages") {
+			return webhook.ErrQueueFull
+		}
+		return fmt.Errorf("failed to publish job: %w", err)
+	}
+	return nil
+}
+
+// activeKey names the key marking job's issue as queued or running. Job keys
+// may contain characters NATS keys don't allow, so they are encoded.
+func (q *NATS) activeKey(job webhook.Job) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(job.Key()))
+}
+
+// Dequeue implements Queue.
+func (q *NATS) Dequeue(ctx context.Context) (*Message, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		wait := natsBlock
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			wait = max(time.Until(deadline), time.Millisecond)
+		}
+		m, err := q.consumer.Next(jetstream.FetchMaxWait(wait))
+		if errors.Is(err, nats.ErrTimeout) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read jobs: %w", err)
+		}
+
+		meta, err := m.Metadata()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read job metadata: %w", err)
+		}
+		msg := &Message{ID: strconv.FormatUint(meta.Sequence.Stream, 10)}
+		if meta.NumDelivered > 1 {
+			log.Printf("Took over unacknowledged job %s", msg.ID)
+		}
+
+		if err := json.Unmarshal(m.Data(), &msg.Job); err != nil || msg.Job.ParsedError == nil {
+			// Drop it so it doesn't block the queue
+			log.Printf("Dropping undecodable job %s: %v", msg.ID, err)
+			m.Term()
+			continue
+		}
+
+		q.mu.Lock()
+		q.inflight[msg.ID] = m
+		q.mu.Unlock()
+		return msg, nil
+	}
+}
+
+// Ack implements Queue. Acknowledged jobs are removed from the stream and
+// new jobs for their issue are allowed.
+func (q *NATS) Ack(ctx context.Context, msg *Message) error {
+	q.mu.Lock()
+	m, ok := q.inflight[msg.ID]
+	delete(q.inflight, msg.ID)
+	q.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("failed to acknowledge job %s: not dequeued by this replica", msg.ID)
+	}
+
+	if err := m.DoubleAck(ctx); err != nil {
+		return fmt.Errorf("failed to acknowledge job %s: %w", msg.ID, err)
+	}
+	if err := q.active.Delete(ctx, q.activeKey(msg.Job)); err != nil {
+		return fmt.Errorf("failed to release issue of job %s: %w", msg.ID, err)
+	}
+	return nil
+}
+
+// Close implements Queue.
+func (q *NATS) Close() error {
+	q.conn.Close()
+	return nil
+}
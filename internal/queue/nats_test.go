@@ -0,0 +1,130 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/webhook"
+)
+
+func runTestNATSServer(t *testing.T) *server.Server {
+	t.Helper()
+	s, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	go s.Start()
+	if !s.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server not ready")
+	}
+	t.Cleanup(s.Shutdown)
+	return s
+}
+
+func openTestNATS(t *testing.T, s *server.Server, claimAfter time.Duration) *NATS {
+	t.Helper()
+	q, err := OpenNATS(context.Background(), Options{
+		Capacity:   2,
+		NATSURL:    s.ClientURL(),
+		ClaimAfter: claimAfter,
+	})
+	if err != nil {
+		t.Fatalf("OpenNATS() error = %v", err)
+	}
+	t.Cleanup(func() { q.Close() })
+	return q
+}
+
+func TestNATS_EnqueueDequeue(t *testing.T) {
+	ctx := context.Background()
+	q := openTestNATS(t, runTestNATSServer(t), time.Minute)
+
+	if err := q.Enqueue(ctx, testJob("1")); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	if err := q.Enqueue(ctx, testJob("2")); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	if err := q.Enqueue(ctx, testJob("3")); !errors.Is(err, webhook.ErrQueueFull) {
+		t.Fatalf("Enqueue() over capacity error = %v, want ErrQueueFull", err)
+	}
+
+	msg, err := q.Dequeue(ctx)
+	if err != nil {
+		t.Fatalf("Dequeue() error = %v", err)
+	}
+	if msg.Job.ParsedError.IssueID != "1" || msg.Job.Tenant != "acme" {
+		t.Errorf("Dequeue() job = %+v", msg.Job)
+	}
+	if err := q.Ack(ctx, msg); err != nil {
+		t.Fatalf("Ack() error = %v", err)
+	}
+
+	// Acknowledged jobs free capacity
+	if err := q.Enqueue(ctx, testJob("3")); err != nil {
+		t.Errorf("Enqueue() after Ack error = %v", err)
+	}
+}
+
+func TestNATS_CoalescesIssue(t *testing.T) {
+	ctx := context.Background()
+	q := openTestNATS(t, runTestNATSServer(t), time.Minute)
+
+	if err := q.Enqueue(ctx, testJob("1")); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	if err := q.Enqueue(ctx, testJob("1")); !errors.Is(err, webhook.ErrDuplicateJob) {
+		t.Fatalf("Enqueue() queued issue error = %v, want ErrDuplicateJob", err)
+	}
+
+	msg, err := q.Dequeue(ctx)
+	if err != nil {
+		t.Fatalf("Dequeue() error = %v", err)
+	}
+	if err := q.Ack(ctx, msg); err != nil {
+		t.Fatalf("Ack() error = %v", err)
+	}
+	if err := q.Enqueue(ctx, testJob("1")); err != nil {
+		t.Errorf("Enqueue() after Ack error = %v", err)
+	}
+}
+
+func TestNATS_RedeliversAbandonedJobs(t *testing.T) {
+	ctx := context.Background()
+	s := runTestNATSServer(t)
+
+	crashed := openTestNATS(t, s, time.Second)
+	if err := crashed.Enqueue(ctx, testJob("1")); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	if _, err := crashed.Dequeue(ctx); err != nil {
+		t.Fatalf("Dequeue() error = %v", err)
+	}
+	crashed.Close()
+
+	// Another worker receives the job once its ack wait has passed
+	other := openTestNATS(t, s, time.Second)
+	dequeueCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	msg, err := other.Dequeue(dequeueCtx)
+	if err != nil {
+		t.Fatalf("Dequeue() error = %v", err)
+	}
+	if msg.Job.ParsedError.IssueID != "1" {
+		t.Errorf("redelivered job = %q, want 1", msg.Job.ParsedError.IssueID)
+	}
+	if err := other.Ack(ctx, msg); err != nil {
+		t.Errorf("Ack() error = %v", err)
+	}
+}
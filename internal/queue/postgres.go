@@ -0,0 +1,330 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib" // registers the "pgx" database/sql driver
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/webhook"
+)
+
+const (
+	pgPollInterval     = time.Second
+	outboxRetryDelay   = time.Minute
+	outboxMaxAttempts  = 5
+	outboxMaxRetryWait = 30 * time.Minute
+)
+
+const pgSchema = `
+CREATE TABLE IF NOT EXISTS sentryagent_jobs (
+	id           bigserial PRIMARY KEY,
+	job          jsonb NOT NULL,
+	priority     double precision NOT NULL DEFAULT 0,
+	issue_key    text,
+	enqueued_at  timestamptz NOT NULL DEFAULT now(),
+	lease        text,
+	locked_until timestamptz,
+	attempts     integer NOT NULL DEFAULT 0
+);
+
+ALTER TABLE sentryagent_jobs ADD COLUMN IF NOT EXISTS priority double precision NOT NULL DEFAULT 0;
+ALTER TABLE sentryagent_jobs ADD COLUMN IF NOT EXISTS issue_key text;
+
+CREATE UNIQUE INDEX IF NOT EXISTS sentryagent_jobs_issue_key ON sentryagent_jobs (issue_key);
+
+CREATE TABLE IF NOT EXISTS sentryagent_outbox (
+	id           bigserial PRIMARY KEY,
+	kind         text NOT NULL,
+	payload      jsonb NOT NULL,
+	created_at   timestamptz NOT NULL DEFAULT now(),
+	available_at timestamptz NOT NULL DEFAULT now(),
+	attempts     integer NOT NULL DEFAULT 0,
+	last_error   text,
+	delivered_at timestamptz,
+	failed_at    timestamptz,
+	lease        text
+);
+
+ALTER TABLE sentryagent_outbox ADD COLUMN IF NOT EXISTS lease text;
+
+CREATE INDEX IF NOT EXISTS sentryagent_outbox_pending
+	ON sentryagent_outbox (available_at)
+	WHERE delivered_at IS NULL AND failed_at IS NULL;
+
+-- Delivered effects are deleted; remove those earlier versions kept
+DELETE FROM sentryagent_outbox WHERE delivered_at IS NOT NULL;
+`
+
+// Postgres is a queue stored in Postgres tables. Replicas take the
+// highest-priority job with SELECT ... FOR UPDATE SKIP LOCKED and hold a lease
+// on it; a job whose lease expires (e.g. because its replica crashed) is
+// handed out again.
+//
+// Postgres also implements Outbox: a job's side effects are recorded in the
+// same transaction that deletes the job, so each job produces them exactly
+// once.
+type Postgres struct {
+	db         *sql.DB
+	capacity   int
+	claimAfter time.Duration
+}
+
+// OpenPostgres connects to Postgres and creates the queue tables if needed.
+func OpenPostgres(ctx context.Context, opts Options) (*Postgres, error) {
+	db, err := sql.Open("pgx", opts.PostgresURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Postgres URL: %w", err)
+	}
+	if _, err := db.ExecContext(ctx, pgSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create queue tables: %w", err)
+	}
+
+	q := &Postgres{
+		db:         db,
+		capacity:   opts.Capacity,
+		claimAfter: opts.ClaimAfter,
+	}
+	if q.claimAfter <= 0 {
+		q.claimAfter = defaultClaimTime
+	}
+	return q, nil
+}
+
+// Enqueue implements Queue. Capacity counts waiting and in-flight jobs.
+func (q *Postgres) Enqueue(ctx context.Context, job webhook.Job) error {
+	if q.capacity > 0 {
+		var n int
+		if err := q.db.QueryRowContext(ctx, `SELECT count(*) FROM sentryagent_jobs`).Scan(&n); err != nil {
+			return fmt.Errorf("failed to check queue length: %w", err)
+		}
+		if n >= q.capacity {
+			return webhook.ErrQueueFull
+		}
+	}
+
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to encode job: %w", err)
+	}
+	// Each issue has at most one queued or running job
+	res, err := q.db.ExecContext(ctx, `
+		INSERT INTO sentryagent_jobs (job, priority, issue_key) VALUES ($1, $2, $3)
+		ON CONFLICT (issue_key) DO NOTHING`,
+		data, job.ParsedError.Priority(), job.Key())
+	if err != nil {
+		return fmt.Errorf("failed to add job: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return webhook.ErrDuplicateJob
+	}
+	return nil
+}
+
+// Dequeue implements Queue. It takes the highest-priority, then oldest, job
+// that is neither leased nor locked by another replica, polling while the
+// queue is empty.
+func (q *Postgres) Dequeue(ctx context.Context) (*Message, error) {
+	for {
+		lease, err := newID()
+		if err != nil {
+			return nil, err
+		}
+
+		var (
+			id  int64
+			raw []byte
+		)
+		err = q.db.QueryRowContext(ctx, `
+			UPDATE sentryagent_jobs
+			SET lease = $1, locked_until = now() + $2 * interval '1 second', attempts = attempts + 1
+			WHERE id = (
+				SELECT id FROM sentryagent_jobs
+				WHERE locked_until IS NULL OR locked_until < now()
+				ORDER BY priority DESC, id
+				LIMIT 1
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING id, job`, lease, q.claimAfter.Seconds()).Scan(&id, &raw)
+		if errors.Is(err, sql.ErrNoRows) {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(pgPollInterval):
+			}
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read jobs: %w", err)
+		}
+
+		msg := &Message{ID: strconv.FormatInt(id, 10), lease: lease}
+		if err := json.Unmarshal(raw, &msg.Job); err != nil || msg.Job.ParsedError == nil {
+			log.Printf("Dropping undecodable job %s: %v", msg.ID, err)
+			if err := q.Ack(ctx, msg); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		return msg, nil
+	}
+}
+
+// Ack implements Queue. It returns ErrLeaseLost if the job's lease expired
+// and another replica took it over.
+func (q *Postgres) Ack(ctx context.Context, msg *Message) error {
+	res, err := q.db.ExecContext(ctx, `DELETE FROM sentryagent_jobs WHERE id = $1 AND lease = $2`, msg.ID, msg.lease)
+	if err != nil {
+		return fmt.Errorf("failed to acknowledge job %s: %w", msg.ID, err)
+	}
+	return checkLease(res, msg)
+}
+
+// AckWithEffect implements Outbox.
+func (q *Postgres) AckWithEffect(ctx context.Context, msg *Message, effect Effect) error {
+	tx, err := q.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM sentryagent_jobs WHERE id = $1 AND lease = $2`, msg.ID, msg.lease)
+	if err != nil {
+		return fmt.Errorf("failed to acknowledge job %s: %w", msg.ID, err)
+	}
+	if err := checkLease(res, msg); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO sentryagent_outbox (kind, payload) VALUES ($1, $2)`,
+		effect.Kind, []byte(effect.Payload)); err != nil {
+		return fmt.Errorf("failed to record %s effect: %w", effect.Kind, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit job %s: %w", msg.ID, err)
+	}
+	return nil
+}
+
+// DeliverEffects implements Outbox. An effect is claimed with a lease before
+// deliver runs, outside any transaction, so replicas don't deliver it
+// concurrently unless delivery outlasts the lease. Failed deliveries are
+// retried with backoff and abandoned after outboxMaxAttempts, staying in the
+// table marked failed.
+func (q *Postgres) DeliverEffects(ctx context.Context, deliver func(context.Context, Effect) error, abandon func(context.Context, Effect, error)) {
+	for {
+		found, err := q.deliverNext(ctx, deliver, abandon)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to process outbox: %v", err)
+		}
+		if found && err == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(pgPollInterval):
+		}
+	}
+}
+
+// deliverNext delivers the oldest due effect and reports whether there was one.
+func (q *Postgres) deliverNext(ctx context.Context, deliver func(context.Context, Effect) error, abandon func(context.Context, Effect, error)) (bool, error) {
+	lease, err := newID()
+	if err != nil {
+		return false, err
+	}
+
+	// Claim the effect by making it unavailable to other replicas until the
+	// lease expires
+	var (
+		effect   Effect
+		raw      []byte
+		attempts int
+	)
+	err = q.db.QueryRowContext(ctx, `
+		UPDATE sentryagent_outbox
+		SET lease = $1, available_at = now() + $2 * interval '1 second'
+		WHERE id = (
+			SELECT id FROM sentryagent_outbox
+			WHERE delivered_at IS NULL AND failed_at IS NULL AND available_at <= now()
+			ORDER BY id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, kind, payload, attempts`, lease, q.claimAfter.Seconds()).Scan(&effect.ID, &effect.Kind, &raw, &attempts)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read outbox: %w", err)
+	}
+	effect.Payload = raw
+
+	var (
+		res       sql.Result
+		abandoned error
+	)
+	if derr := deliver(ctx, effect); derr != nil {
+		attempts++
+		if attempts >= outboxMaxAttempts {
+			log.Printf("Giving up on %s effect %d after %d attempts: %v", effect.Kind, effect.ID, attempts, derr)
+			abandoned = derr
+			res, err = q.db.ExecContext(ctx, `
+				UPDATE sentryagent_outbox SET attempts = $3, last_error = $4, failed_at = now()
+				WHERE id = $1 AND lease = $2`, effect.ID, lease, attempts, derr.Error())
+		} else {
+			wait := outboxRetryDelay << (attempts - 1)
+			if wait > outboxMaxRetryWait {
+				wait = outboxMaxRetryWait
+			}
+			log.Printf("Failed to deliver %s effect %d, retrying in %s: %v", effect.Kind, effect.ID, wait, derr)
+			res, err = q.db.ExecContext(ctx, `
+				UPDATE sentryagent_outbox SET attempts = $3, last_error = $4, available_at = now() + $5 * interval '1 second'
+				WHERE id = $1 AND lease = $2`, effect.ID, lease, attempts, derr.Error(), wait.Seconds())
+		}
+	} else {
+		// Delivered effects are kept no longer, their payloads can be large
+		res, err = q.db.ExecContext(ctx, `DELETE FROM sentryagent_outbox WHERE id = $1 AND lease = $2`, effect.ID, lease)
+	}
+	if err != nil {
+		return true, fmt.Errorf("failed to update %s effect %d: %w", effect.Kind, effect.ID, err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		// Whichever replica holds the lease now finishes the effect
+		log.Printf("Lease on %s effect %d expired during delivery; another replica may deliver it again", effect.Kind, effect.ID)
+		return true, nil
+	}
+	if abandoned != nil {
+		abandon(ctx, effect, abandoned)
+	}
+	return true, nil
+}
+
+// Close implements Queue.
+func (q *Postgres) Close() error {
+	return q.db.Close()
+}
+
+// checkLease returns ErrLeaseLost unless res deleted msg's job.
+func checkLease(res sql.Result, msg *Message) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to acknowledge job %s: %w", msg.ID, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("job %s: %w", msg.ID, ErrLeaseLost)
+	}
+	return nil
+}
@@ -0,0 +1,276 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/webhook"
+)
+
+// openTestPostgres connects to the database in TEST_DATABASE_URL, skipping
+// the test when it isn't set. The queue tables are emptied first.
+func openTestPostgres(t *testing.T, claimAfter time.Duration) *Postgres {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	q, err := OpenPostgres(context.Background(), Options{Capacity: 2, PostgresURL: url, ClaimAfter: claimAfter})
+	if err != nil {
+		t.Fatalf("OpenPostgres() error = %v", err)
+	}
+	t.Cleanup(func() { q.Close() })
+
+	if _, err := q.db.Exec(`TRUNCATE sentryagent_jobs, sentryagent_outbox`); err != nil {
+		t.Fatalf("failed to empty queue tables: %v", err)
+	}
+	return q
+}
+
+func TestPostgres_EnqueueDequeue(t *testing.T) {
+	ctx := context.Background()
+	q := openTestPostgres(t, time.Minute)
+
+	if err := q.Enqueue(ctx, testJob("1")); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	if err := q.Enqueue(ctx, testJob("2")); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	if err := q.Enqueue(ctx, testJob("3")); !errors.Is(err, webhook.ErrQueueFull) {
+		t.Fatalf("Enqueue() over capacity error = %v, want ErrQueueFull", err)
+	}
+
+	first, err := q.Dequeue(ctx)
+	if err != nil {
+		t.Fatalf("Dequeue() error = %v", err)
+	}
+	if first.Job.ParsedError.IssueID != "1" || first.Job.Tenant != "acme" {
+		t.Errorf("Dequeue() job = %+v", first.Job)
+	}
+
+	// A leased job isn't handed out twice
+	second, err := q.Dequeue(ctx)
+	if err != nil {
+		t.Fatalf("Dequeue() error = %v", err)
+	}
+	if second.Job.ParsedError.IssueID != "2" {
+		t.Errorf("second Dequeue() issue = %s, want 2", second.Job.ParsedError.IssueID)
+	}
+
+	if err := q.Ack(ctx, first); err != nil {
+		t.Fatalf("Ack() error = %v", err)
+	}
+	if err := q.Enqueue(ctx, testJob("3")); err != nil {
+		t.Fatalf("Enqueue() after Ack error = %v", err)
+	}
+}
+
+func TestPostgres_ExpiredLease(t *testing.T) {
+	ctx := context.Background()
+	q := openTestPostgres(t, time.Second)
+
+	if err := q.Enqueue(ctx, testJob("1")); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	stale, err := q.Dequeue(ctx)
+	if err != nil {
+		t.Fatalf("Dequeue() error = %v", err)
+	}
+
+	// The lease expires and another replica takes the job over
+	time.Sleep(1100 * time.Millisecond)
+	claimed, err := q.Dequeue(ctx)
+	if err != nil {
+		t.Fatalf("Dequeue() error = %v", err)
+	}
+	if claimed.ID != stale.ID {
+		t.Fatalf("Dequeue() took job %s, want expired job %s", claimed.ID, stale.ID)
+	}
+
+	effect := Effect{Kind: "pull_request", Payload: json.RawMessage(`{}`)}
+	if err := q.AckWithEffect(ctx, stale, effect); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("AckWithEffect() with expired lease error = %v, want ErrLeaseLost", err)
+	}
+	if err := q.AckWithEffect(ctx, claimed, effect); err != nil {
+		t.Fatalf("AckWithEffect() error = %v", err)
+	}
+
+	var effects int
+	if err := q.db.QueryRow(`SELECT count(*) FROM sentryagent_outbox`).Scan(&effects); err != nil {
+		t.Fatal(err)
+	}
+	if effects != 1 {
+		t.Errorf("outbox has %d effects, want 1", effects)
+	}
+}
+
+func TestPostgres_DeliverEffects(t *testing.T) {
+	q := openTestPostgres(t, time.Minute)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := q.Enqueue(ctx, testJob("1")); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	msg, err := q.Dequeue(ctx)
+	if err != nil {
+		t.Fatalf("Dequeue() error = %v", err)
+	}
+	if err := q.AckWithEffect(ctx, msg, Effect{Kind: "pull_request", Payload: json.RawMessage(`{"issue":"1"}`)}); err != nil {
+		t.Fatalf("AckWithEffect() error = %v", err)
+	}
+
+	delivered := make(chan Effect, 2)
+	go q.DeliverEffects(ctx, func(ctx context.Context, e Effect) error {
+		delivered <- e
+		return nil
+	}, func(ctx context.Context, e Effect, err error) {
+		t.Errorf("effect %d abandoned: %v", e.ID, err)
+	})
+
+	select {
+	case e := <-delivered:
+		if e.Kind != "pull_request" || string(e.Payload) != `{"issue": "1"}` {
+			t.Errorf("delivered effect = %s %s", e.Kind, e.Payload)
+		}
+	case <-ctx.Done():
+		t.Fatal("effect was not delivered")
+	}
+
+	// Delivered effects are not delivered again
+	select {
+	case e := <-delivered:
+		t.Errorf("effect %d delivered twice", e.ID)
+	case <-time.After(2 * pgPollInterval):
+	}
+	var effects int
+	if err := q.db.QueryRow(`SELECT count(*) FROM sentryagent_outbox`).Scan(&effects); err != nil {
+		t.Fatal(err)
+	}
+	if effects != 0 {
+		t.Errorf("outbox has %d effects after delivery, want 0", effects)
+	}
+}
+
+func TestPostgres_AbandonEffects(t *testing.T) {
+	ctx := context.Background()
+	q := openTestPostgres(t, time.Minute)
+
+	if err := q.Enqueue(ctx, testJob("1")); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	msg, err := q.Dequeue(ctx)
+	if err != nil {
+		t.Fatalf("Dequeue() error = %v", err)
+	}
+	if err := q.AckWithEffect(ctx, msg, Effect{Kind: "pull_request", Payload: json.RawMessage(`{}`)}); err != nil {
+		t.Fatalf("AckWithEffect() error = %v", err)
+	}
+	// The next failure is the last attempt
+	if _, err := q.db.Exec(`UPDATE sentryagent_outbox SET attempts = $1`, outboxMaxAttempts-1); err != nil {
+		t.Fatal(err)
+	}
+
+	var abandoned []error
+	failing := func(context.Context, Effect) error { return errors.New("boom") }
+	found, err := q.deliverNext(ctx, failing, func(ctx context.Context, e Effect, err error) {
+		abandoned = append(abandoned, err)
+	})
+	if err != nil || !found {
+		t.Fatalf("deliverNext() = %v, %v, want an effect attempted", found, err)
+	}
+	if len(abandoned) != 1 || abandoned[0].Error() != "boom" {
+		t.Fatalf("abandoned = %v, want the effect with its last error", abandoned)
+	}
+
+	// Abandoned effects are not attempted again
+	if found, err := q.deliverNext(ctx, failing, nil); err != nil || found {
+		t.Errorf("deliverNext() after abandoning = %v, %v, want nothing to deliver", found, err)
+	}
+}
+
+func TestPostgres_DeliverEffects_Claim(t *testing.T) {
+	ctx := context.Background()
+	q := openTestPostgres(t, time.Minute)
+
+	if err := q.Enqueue(ctx, testJob("1")); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	msg, err := q.Dequeue(ctx)
+	if err != nil {
+		t.Fatalf("Dequeue() error = %v", err)
+	}
+	if err := q.AckWithEffect(ctx, msg, Effect{Kind: "pull_request", Payload: json.RawMessage(`{}`)}); err != nil {
+		t.Fatalf("AckWithEffect() error = %v", err)
+	}
+
+	// While one replica delivers the effect, no other claims it
+	found, err := q.deliverNext(ctx, func(ctx context.Context, e Effect) error {
+		again, err := q.deliverNext(ctx, func(context.Context, Effect) error { return nil }, nil)
+		if err != nil || again {
+			t.Errorf("deliverNext() during delivery = %v, %v, want nothing to deliver", again, err)
+		}
+		return nil
+	}, nil)
+	if err != nil || !found {
+		t.Fatalf("deliverNext() = %v, %v, want an effect delivered", found, err)
+	}
+
+	var effects int
+	if err := q.db.QueryRow(`SELECT count(*) FROM sentryagent_outbox`).Scan(&effects); err != nil {
+		t.Fatal(err)
+	}
+	if effects != 0 {
+		t.Errorf("outbox has %d effects after delivery, want 0", effects)
+	}
+}
+
+func TestPostgres_Priority(t *testing.T) {
+	ctx := context.Background()
+	q := openTestPostgres(t, time.Minute)
+
+	warning := webhook.Job{ParsedError: &webhook.ParsedError{IssueID: "warning", Level: "warning"}}
+	fatal := webhook.Job{ParsedError: &webhook.ParsedError{IssueID: "fatal", Level: "fatal", UserCount: 5000}}
+	for _, job := range []webhook.Job{warning, fatal} {
+		if err := q.Enqueue(ctx, job); err != nil {
+			t.Fatalf("Enqueue() error = %v", err)
+		}
+	}
+
+	msg, err := q.Dequeue(ctx)
+	if err != nil {
+		t.Fatalf("Dequeue() error = %v", err)
+	}
+	if msg.Job.ParsedError.IssueID != "fatal" {
+		t.Errorf("Dequeue() = %s, want the fatal error first", msg.Job.ParsedError.IssueID)
+	}
+}
+
+func TestPostgres_CoalescesIssue(t *testing.T) {
+	ctx := context.Background()
+	q := openTestPostgres(t, time.Minute)
+
+	if err := q.Enqueue(ctx, testJob("1")); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	if err := q.Enqueue(ctx, testJob("1")); !errors.Is(err, webhook.ErrDuplicateJob) {
+		t.Fatalf("Enqueue() queued issue error = %v, want ErrDuplicateJob", err)
+	}
+
+	msg, err := q.Dequeue(ctx)
+	if err != nil {
+		t.Fatalf("Dequeue() error = %v", err)
+	}
+	if err := q.Ack(ctx, msg); err != nil {
+		t.Fatalf("Ack() error = %v", err)
+	}
+	if err := q.Enqueue(ctx, testJob("1")); err != nil {
+		t.Errorf("Enqueue() after Ack error = %v", err)
+	}
+}
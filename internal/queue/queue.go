@@ -0,0 +1,112 @@
+// Package queue provides the job queue backends shared by the webhook,
+// admin and gRPC entry points and the job processor.
+package queue
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/webhook"
+)
+
+// Message is a dequeued job. It must be acknowledged once processed;
+// durable backends redeliver unacknowledged messages.
+type Message struct {
+	ID  string
+	Job webhook.Job
+
+	lease string // identifies this delivery for leasing backends
+}
+
+// ErrLeaseLost is returned when acknowledging a message whose lease expired
+// and which another replica has taken over.
+var ErrLeaseLost = errors.New("job lease lost")
+
+// Queue is a job queue backend.
+type Queue interface {
+	webhook.JobQueue
+
+	// Dequeue blocks until a job is available or ctx is done.
+	Dequeue(ctx context.Context) (*Message, error)
+	// Ack marks a message as processed.
+	Ack(ctx context.Context, msg *Message) error
+	// Close releases the backend's resources.
+	Close() error
+}
+
+// Effect is a side effect of a processed job, such as opening a pull request.
+type Effect struct {
+	ID      int64
+	Kind    string
+	Payload json.RawMessage
+}
+
+// Outbox is implemented by backends that can record a job's side effects in
+// the same transaction that acknowledges it (a transactional outbox), so a
+// job's effects are recorded exactly once even if a replica crashes mid-job.
+type Outbox interface {
+	// AckWithEffect acknowledges msg and records effect atomically. If the
+	// lease on msg was lost it returns ErrLeaseLost and records nothing.
+	AckWithEffect(ctx context.Context, msg *Message, effect Effect) error
+	// DeliverEffects passes recorded effects to deliver until ctx is done,
+	// retrying those for which deliver fails. Delivered effects are deleted;
+	// one that keeps failing is given up and passed to abandon with the last
+	// error.
+	DeliverEffects(ctx context.Context, deliver func(context.Context, Effect) error, abandon func(context.Context, Effect, error))
+}
+
+// Options configures a queue backend.
+type Options struct {
+	// Capacity is the maximum number of waiting jobs.
+	Capacity int
+	// RedisURL is the redis:// URL for the redis backend.
+	RedisURL string
+	// RedisKey names the Redis stream holding jobs.
+	RedisKey string
+	// Consumer identifies this replica within the Redis consumer group.
+	Consumer string
+	// SQLitePath is the database file for the sqlite backend.
+	SQLitePath string
+	// PostgresURL is the postgres:// URL for the postgres backend.
+	PostgresURL string
+	// NATSURL is the nats:// URL for the nats backend.
+	NATSURL string
+	// NATSStream names the JetStream stream holding jobs.
+	NATSStream string
+	// ClaimAfter is how long a job may stay unacknowledged before another
+	// replica takes it over.
+	ClaimAfter time.Duration
+}
+
+// Open creates the named backend: "memory", "sqlite", "redis", "postgres"
+// or "nats".
+func Open(ctx context.Context, backend string, opts Options) (Queue, error) {
+	switch backend {
+	case "", "memory":
+		return NewMemory(opts.Capacity), nil
+	case "sqlite":
+		return OpenSQLite(ctx, opts)
+	case "redis":
+		return OpenRedis(ctx, opts)
+	case "postgres":
+		return OpenPostgres(ctx, opts)
+	case "nats":
+		return OpenNATS(ctx, opts)
+	default:
+		return nil, fmt.Errorf("unknown queue backend %q", backend)
+	}
+}
+
+// newID returns a random hex identifier, e.g. for one delivery of a job.
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
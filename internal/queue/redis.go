@@ -0,0 +1,246 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/webhook"
+)
+
+const (
+	redisGroup       = "workers"
+	redisActiveTTL   = 24 * time.Hour // bounds how long a lost job blocks its issue
+	redisBlock       = 5 * time.Second
+	defaultRedisKey  = "sentryagent:jobs"
+	defaultClaimTime = time.Hour
+)
+
+// Redis is a queue backed by a Redis stream and consumer group, so several
+// replicas share jobs and jobs survive restarts. A job left unacknowledged
+// by a crashed replica is taken over by another after ClaimAfter.
+type Redis struct {
+	client     *redis.Client
+	key        string
+	consumer   string
+	capacity   int
+	claimAfter time.Duration
+
+	mu            sync.Mutex
+	pendingCursor string // last of our own unacknowledged jobs reread, "" once all are
+}
+
+// OpenRedis connects to Redis and creates the consumer group if needed.
+func OpenRedis(ctx context.Context, opts Options) (*Redis, error) {
+	redisOpts, err := redis.ParseURL(opts.RedisURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis URL: %w", err)
+	}
+
+	q := &Redis{
+		client:        redis.NewClient(redisOpts),
+		key:           opts.RedisKey,
+		consumer:      opts.Consumer,
+		capacity:      opts.Capacity,
+		claimAfter:    opts.ClaimAfter,
+		pendingCursor: "0",
+	}
+	if q.key == "" {
+		q.key = defaultRedisKey
+	}
+	if q.consumer == "" {
+		q.consumer, _ = os.Hostname()
+	}
+	if q.claimAfter <= 0 {
+		q.claimAfter = defaultClaimTime
+	}
+
+	err = q.client.XGroupCreateMkStream(ctx, q.key, redisGroup, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		q.client.Close()
+		return nil, fmt.Errorf("failed to create Redis consumer group: %w", err)
+	}
+
+	return q, nil
+}
+
+// Enqueue implements Queue. Capacity counts waiting and in-flight jobs.
+// Each issue's job is marked active in a separate key until acknowledged.
+func (q *Redis) Enqueue(ctx context.Context, job webhook.Job) (err error) {
+	active := q.activeKey(job)
+	added, err := q.client.SetNX(ctx, active, 1, redisActiveTTL).Result()
+	if err != nil {
+		return fmt.Errorf("failed to check for queued job: %w", err)
+	}
+	if !added {
+		return webhook.ErrDuplicateJob
+	}
+	defer func() {
+		if err != nil {
+			q.client.Del(context.WithoutCancel(ctx), active)
+		}
+	}()
+
+	if q.capacity > 0 {
+		n, err := q.client.XLen(ctx, q.key).Result()
+		if err != nil {
+			return fmt.Errorf("failed to check queue length: %w", err)
+		}
+		if n >= int64(q.capacity) {
+			return webhook.ErrQueueFull
+		}
+	}
+
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to encode job: %w", err)
+	}
+	if err := q.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: q.key,
+		Values: map[string]interface{}{"job": data},
+	}).Err(); err != nil {
+		return fmt.Errorf("failed to add job: %w", err)
+	}
+	return nil
+}
+
+// activeKey names the key marking job's issue as queued or running.
+func (q *Redis) activeKey(job webhook.Job) string {
+	return q.key + ":active:" + job.Key()
+}
+
+// Dequeue implements Queue. It first rereads jobs this consumer took before a
+// restart, then takes over jobs abandoned by other replicas, and otherwise
+// waits for new jobs.
+func (q *Redis) Dequeue(ctx context.Context) (*Message, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		msg, found, err := q.readOwnPending(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			if msg != nil {
+				return msg, nil
+			}
+			continue
+		}
+
+		claimed, _, err := q.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   q.key,
+			Group:    redisGroup,
+			Consumer: q.consumer,
+			MinIdle:  q.claimAfter,
+			Start:    "0-0",
+			Count:    1,
+		}).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to claim abandoned jobs: %w", err)
+		}
+		if len(claimed) > 0 {
+			log.Printf("Took over abandoned job %s", claimed[0].ID)
+			if msg, err := q.decode(ctx, claimed[0]); msg != nil || err != nil {
+				return msg, err
+			}
+			continue
+		}
+
+		streams, err := q.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    redisGroup,
+			Consumer: q.consumer,
+			Streams:  []string{q.key, ">"},
+			Count:    1,
+			Block:    redisBlock,
+		}).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read jobs: %w", err)
+		}
+		if len(streams) > 0 && len(streams[0].Messages) > 0 {
+			if msg, err := q.decode(ctx, streams[0].Messages[0]); msg != nil || err != nil {
+				return msg, err
+			}
+		}
+	}
+}
+
+// readOwnPending returns a job this consumer read but never acknowledged,
+// e.g. because the process restarted mid-job. found reports whether there was
+// such a job; msg is nil if it could not be decoded. Each such job is handed
+// to only one of the workers sharing this consumer.
+func (q *Redis) readOwnPending(ctx context.Context) (msg *Message, found bool, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.pendingCursor == "" {
+		return nil, false, nil
+	}
+
+	streams, err := q.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    redisGroup,
+		Consumer: q.consumer,
+		Streams:  []string{q.key, q.pendingCursor},
+		Count:    1,
+	}).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, false, fmt.Errorf("failed to read pending jobs: %w", err)
+	}
+	if len(streams) == 0 || len(streams[0].Messages) == 0 {
+		q.pendingCursor = ""
+		return nil, false, nil
+	}
+	q.pendingCursor = streams[0].Messages[0].ID
+
+	log.Printf("Resuming unacknowledged job %s", streams[0].Messages[0].ID)
+	msg, err = q.decode(ctx, streams[0].Messages[0])
+	return msg, true, err
+}
+
+// decode unmarshals a stream entry. Entries that can't be decoded are
+// acknowledged and dropped so they don't block the queue; decode then
+// returns a nil message.
+func (q *Redis) decode(ctx context.Context, m redis.XMessage) (*Message, error) {
+	msg := &Message{ID: m.ID}
+
+	raw, _ := m.Values["job"].(string)
+	if err := json.Unmarshal([]byte(raw), &msg.Job); err != nil || msg.Job.ParsedError == nil {
+		log.Printf("Dropping undecodable job %s: %v", m.ID, err)
+		return nil, q.Ack(ctx, msg)
+	}
+	return msg, nil
+}
+
+// Ack implements Queue. Acknowledged jobs are removed from the stream and
+// new jobs for their issue are allowed.
+func (q *Redis) Ack(ctx context.Context, msg *Message) error {
+	_, err := q.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.XAck(ctx, q.key, redisGroup, msg.ID)
+		p.XDel(ctx, q.key, msg.ID)
+		if msg.Job.ParsedError != nil {
+			p.Del(ctx, q.activeKey(msg.Job))
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to acknowledge job %s: %w", msg.ID, err)
+	}
+	return nil
+}
+
+// Close implements Queue.
+func (q *Redis) Close() error {
+	return q.client.Close()
+}
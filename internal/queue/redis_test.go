@@ -0,0 +1,142 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/webhook"
+)
+
+func openTestRedis(t *testing.T, mr *miniredis.Miniredis, consumer string) *Redis {
+	t.Helper()
+	q, err := OpenRedis(context.Background(), Options{
+		Capacity:   2,
+		RedisURL:   "redis://" + mr.Addr(),
+		Consumer:   consumer,
+		ClaimAfter: time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("OpenRedis() error = %v", err)
+	}
+	t.Cleanup(func() { q.Close() })
+	return q
+}
+
+func testJob(issueID string) webhook.Job {
+	return webhook.Job{ParsedError: &webhook.ParsedError{IssueID: issueID, ProjectSlug: "api"}, Tenant: "acme"}
+}
+
+func TestRedis_EnqueueDequeue(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	q := openTestRedis(t, mr, "a")
+
+	if err := q.Enqueue(ctx, testJob("1")); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	if err := q.Enqueue(ctx, testJob("2")); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	if err := q.Enqueue(ctx, testJob("3")); !errors.Is(err, webhook.ErrQueueFull) {
+		t.Fatalf("Enqueue() over capacity error = %v, want ErrQueueFull", err)
+	}
+
+	msg, err := q.Dequeue(ctx)
+	if err != nil {
+		t.Fatalf("Dequeue() error = %v", err)
+	}
+	if msg.Job.ParsedError.IssueID != "1" || msg.Job.Tenant != "acme" {
+		t.Errorf("Dequeue() job = %+v", msg.Job)
+	}
+	if err := q.Ack(ctx, msg); err != nil {
+		t.Fatalf("Ack() error = %v", err)
+	}
+
+	// Acknowledged jobs free capacity
+	if err := q.Enqueue(ctx, testJob("3")); err != nil {
+		t.Errorf("Enqueue() after Ack error = %v", err)
+	}
+}
+
+func TestRedis_ResumesAfterRestart(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+
+	first := openTestRedis(t, mr, "a")
+	for _, id := range []string{"1", "2"} {
+		if err := first.Enqueue(ctx, testJob(id)); err != nil {
+			t.Fatalf("Enqueue() error = %v", err)
+		}
+		if _, err := first.Dequeue(ctx); err != nil {
+			t.Fatalf("Dequeue() error = %v", err)
+		}
+	}
+	first.Close() // crash before Ack
+
+	// The same replica restarting picks its jobs back up immediately, handing
+	// each to only one worker
+	restarted := openTestRedis(t, mr, "a")
+	for _, want := range []string{"1", "2"} {
+		msg, err := restarted.Dequeue(ctx)
+		if err != nil {
+			t.Fatalf("Dequeue() after restart error = %v", err)
+		}
+		if msg.Job.ParsedError.IssueID != want {
+			t.Errorf("resumed job = %q, want %s", msg.Job.ParsedError.IssueID, want)
+		}
+	}
+}
+
+func TestRedis_TakesOverAbandonedJobs(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	now := time.Date(2024, 6, 30, 12, 0, 0, 0, time.UTC)
+	mr.SetTime(now)
+
+	crashed := openTestRedis(t, mr, "a")
+	if err := crashed.Enqueue(ctx, testJob("1")); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	if _, err := crashed.Dequeue(ctx); err != nil {
+		t.Fatalf("Dequeue() error = %v", err)
+	}
+
+	mr.SetTime(now.Add(2 * time.Minute))
+
+	other := openTestRedis(t, mr, "b")
+	msg, err := other.Dequeue(ctx)
+	if err != nil {
+		t.Fatalf("Dequeue() error = %v", err)
+	}
+	if msg.Job.ParsedError.IssueID != "1" {
+		t.Errorf("claimed job = %q, want 1", msg.Job.ParsedError.IssueID)
+	}
+}
+
+func TestRedis_CoalescesIssue(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	q := openTestRedis(t, mr, "a")
+
+	if err := q.Enqueue(ctx, testJob("1")); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	if err := q.Enqueue(ctx, testJob("1")); !errors.Is(err, webhook.ErrDuplicateJob) {
+		t.Fatalf("Enqueue() queued issue error = %v, want ErrDuplicateJob", err)
+	}
+
+	msg, err := q.Dequeue(ctx)
+	if err != nil {
+		t.Fatalf("Dequeue() error = %v", err)
+	}
+	if err := q.Ack(ctx, msg); err != nil {
+		t.Fatalf("Ack() error = %v", err)
+	}
+	if err := q.Enqueue(ctx, testJob("1")); err != nil {
+		t.Errorf("Enqueue() after Ack error = %v", err)
+	}
+}
@@ -0,0 +1,290 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	_ "modernc.org/sqlite" // registers the "sqlite" database/sql driver
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/webhook"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS jobs (
+	id           INTEGER PRIMARY KEY AUTOINCREMENT,
+	job          TEXT NOT NULL,
+	priority     REAL NOT NULL DEFAULT 0,
+	issue_key    TEXT UNIQUE,
+	enqueued_at  INTEGER NOT NULL,
+	lease        TEXT,
+	locked_until INTEGER,
+	attempts     INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS outbox (
+	id           INTEGER PRIMARY KEY AUTOINCREMENT,
+	kind         TEXT NOT NULL,
+	payload      TEXT NOT NULL,
+	created_at   INTEGER NOT NULL,
+	available_at INTEGER NOT NULL,
+	attempts     INTEGER NOT NULL DEFAULT 0,
+	last_error   TEXT,
+	delivered_at INTEGER,
+	failed_at    INTEGER
+);
+
+CREATE INDEX IF NOT EXISTS outbox_pending
+	ON outbox (available_at)
+	WHERE delivered_at IS NULL AND failed_at IS NULL;
+
+-- Delivered effects are deleted; remove those earlier versions kept
+DELETE FROM outbox WHERE delivered_at IS NOT NULL;
+`
+
+// SQLite is a queue stored in a local SQLite database, making jobs durable
+// across restarts without an external service. The database belongs to one
+// process: jobs a previous run left unacknowledged are handed out again as
+// soon as the queue is opened, and leases only guard against jobs being
+// abandoned while it runs. Timestamps are stored as Unix seconds.
+//
+// Like Postgres, SQLite implements Outbox.
+type SQLite struct {
+	db         *sql.DB
+	capacity   int
+	claimAfter time.Duration
+}
+
+// OpenSQLite opens or creates the queue database at opts.SQLitePath.
+func OpenSQLite(ctx context.Context, opts Options) (*SQLite, error) {
+	db, err := sql.Open("sqlite", "file:"+opts.SQLitePath+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, fmt.Errorf("invalid SQLite path: %w", err)
+	}
+	// SQLite allows one writer at a time; a single connection avoids
+	// SQLITE_BUSY errors between this process's own goroutines
+	db.SetMaxOpenConns(1)
+	if _, err := db.ExecContext(ctx, sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create queue tables: %w", err)
+	}
+	// Jobs leased by a previous run of this process were never finished
+	if _, err := db.ExecContext(ctx, `UPDATE jobs SET lease = NULL, locked_until = NULL`); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to release unfinished jobs: %w", err)
+	}
+
+	q := &SQLite{
+		db:         db,
+		capacity:   opts.Capacity,
+		claimAfter: opts.ClaimAfter,
+	}
+	if q.claimAfter <= 0 {
+		q.claimAfter = defaultClaimTime
+	}
+	return q, nil
+}
+
+// Enqueue implements Queue. Capacity counts waiting and in-flight jobs.
+func (q *SQLite) Enqueue(ctx context.Context, job webhook.Job) error {
+	if q.capacity > 0 {
+		var n int
+		if err := q.db.QueryRowContext(ctx, `SELECT count(*) FROM jobs`).Scan(&n); err != nil {
+			return fmt.Errorf("failed to check queue length: %w", err)
+		}
+		if n >= q.capacity {
+			return webhook.ErrQueueFull
+		}
+	}
+
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to encode job: %w", err)
+	}
+	// Each issue has at most one queued or running job
+	res, err := q.db.ExecContext(ctx, `
+		INSERT INTO jobs (job, priority, issue_key, enqueued_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (issue_key) DO NOTHING`,
+		string(data), job.ParsedError.Priority(), job.Key(), time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("failed to add job: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return webhook.ErrDuplicateJob
+	}
+	return nil
+}
+
+// Dequeue implements Queue. It takes the highest-priority, then oldest, job
+// that isn't leased, polling while the queue is empty.
+func (q *SQLite) Dequeue(ctx context.Context) (*Message, error) {
+	for {
+		lease, err := newID()
+		if err != nil {
+			return nil, err
+		}
+
+		var (
+			id  int64
+			raw string
+		)
+		now := time.Now()
+		err = q.db.QueryRowContext(ctx, `
+			UPDATE jobs
+			SET lease = ?, locked_until = ?, attempts = attempts + 1
+			WHERE id = (
+				SELECT id FROM jobs
+				WHERE locked_until IS NULL OR locked_until < ?
+				ORDER BY priority DESC, id
+				LIMIT 1
+			)
+			RETURNING id, job`, lease, now.Add(q.claimAfter).Unix(), now.Unix()).Scan(&id, &raw)
+		if errors.Is(err, sql.ErrNoRows) {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(pgPollInterval):
+			}
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read jobs: %w", err)
+		}
+
+		msg := &Message{ID: strconv.FormatInt(id, 10), lease: lease}
+		if err := json.Unmarshal([]byte(raw), &msg.Job); err != nil || msg.Job.ParsedError == nil {
+			log.Printf("Dropping undecodable job %s: %v", msg.ID, err)
+			if err := q.Ack(ctx, msg); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		return msg, nil
+	}
+}
+
+// Ack implements Queue. It returns ErrLeaseLost if the job's lease expired
+// and it was handed out again.
+func (q *SQLite) Ack(ctx context.Context, msg *Message) error {
+	res, err := q.db.ExecContext(ctx, `DELETE FROM jobs WHERE id = ? AND lease = ?`, msg.ID, msg.lease)
+	if err != nil {
+		return fmt.Errorf("failed to acknowledge job %s: %w", msg.ID, err)
+	}
+	return checkLease(res, msg)
+}
+
+// AckWithEffect implements Outbox.
+func (q *SQLite) AckWithEffect(ctx context.Context, msg *Message, effect Effect) error {
+	tx, err := q.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM jobs WHERE id = ? AND lease = ?`, msg.ID, msg.lease)
+	if err != nil {
+		return fmt.Errorf("failed to acknowledge job %s: %w", msg.ID, err)
+	}
+	if err := checkLease(res, msg); err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	if _, err := tx.ExecContext(ctx, `INSERT INTO outbox (kind, payload, created_at, available_at) VALUES (?, ?, ?, ?)`,
+		effect.Kind, string(effect.Payload), now, now); err != nil {
+		return fmt.Errorf("failed to record %s effect: %w", effect.Kind, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit job %s: %w", msg.ID, err)
+	}
+	return nil
+}
+
+// DeliverEffects implements Outbox. Only this process reads the outbox, so
+// an effect is delivered outside a transaction and marked afterwards;
+// holding the single connection while deliver runs would block the queue.
+// Failed deliveries are retried with backoff and abandoned after
+// outboxMaxAttempts, staying in the table marked failed.
+func (q *SQLite) DeliverEffects(ctx context.Context, deliver func(context.Context, Effect) error, abandon func(context.Context, Effect, error)) {
+	for {
+		found, err := q.deliverNext(ctx, deliver, abandon)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to process outbox: %v", err)
+		}
+		if found && err == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(pgPollInterval):
+		}
+	}
+}
+
+// deliverNext delivers the oldest due effect and reports whether there was one.
+func (q *SQLite) deliverNext(ctx context.Context, deliver func(context.Context, Effect) error, abandon func(context.Context, Effect, error)) (bool, error) {
+	var (
+		effect   Effect
+		raw      string
+		attempts int
+	)
+	err := q.db.QueryRowContext(ctx, `
+		SELECT id, kind, payload, attempts FROM outbox
+		WHERE delivered_at IS NULL AND failed_at IS NULL AND available_at <= ?
+		ORDER BY id
+		LIMIT 1`, time.Now().Unix()).Scan(&effect.ID, &effect.Kind, &raw, &attempts)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read outbox: %w", err)
+	}
+	effect.Payload = json.RawMessage(raw)
+
+	now := time.Now()
+	var abandoned error
+	if derr := deliver(ctx, effect); derr != nil {
+		attempts++
+		if attempts >= outboxMaxAttempts {
+			log.Printf("Giving up on %s effect %d after %d attempts: %v", effect.Kind, effect.ID, attempts, derr)
+			abandoned = derr
+			_, err = q.db.ExecContext(ctx, `
+				UPDATE outbox SET attempts = ?, last_error = ?, failed_at = ?
+				WHERE id = ?`, attempts, derr.Error(), now.Unix(), effect.ID)
+		} else {
+			wait := outboxRetryDelay << (attempts - 1)
+			if wait > outboxMaxRetryWait {
+				wait = outboxMaxRetryWait
+			}
+			log.Printf("Failed to deliver %s effect %d, retrying in %s: %v", effect.Kind, effect.ID, wait, derr)
+			_, err = q.db.ExecContext(ctx, `
+				UPDATE outbox SET attempts = ?, last_error = ?, available_at = ?
+				WHERE id = ?`, attempts, derr.Error(), now.Add(wait).Unix(), effect.ID)
+		}
+	} else {
+		// Delivered effects are kept no longer, their payloads can be large
+		_, err = q.db.ExecContext(ctx, `DELETE FROM outbox WHERE id = ?`, effect.ID)
+	}
+	if err != nil {
+		return true, fmt.Errorf("failed to update %s effect %d: %w", effect.Kind, effect.ID, err)
+	}
+	if abandoned != nil {
+		abandon(ctx, effect, abandoned)
+	}
+	return true, nil
+}
+
+// Close implements Queue.
+func (q *SQLite) Close() error {
+	return q.db.Close()
+}
@@ -0,0 +1,189 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/webhook"
+)
+
+// openTestSQLite opens a queue database at path, creating it in a temporary
+// directory when path is empty.
+func openTestSQLite(t *testing.T, path string) *SQLite {
+	t.Helper()
+	if path == "" {
+		path = filepath.Join(t.TempDir(), "queue.db")
+	}
+	q, err := OpenSQLite(context.Background(), Options{Capacity: 2, SQLitePath: path, ClaimAfter: time.Minute})
+	if err != nil {
+		t.Fatalf("OpenSQLite() error = %v", err)
+	}
+	t.Cleanup(func() { q.Close() })
+	return q
+}
+
+func TestSQLite_EnqueueDequeue(t *testing.T) {
+	ctx := context.Background()
+	q := openTestSQLite(t, "")
+
+	if err := q.Enqueue(ctx, testJob("1")); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	if err := q.Enqueue(ctx, testJob("1")); !errors.Is(err, webhook.ErrDuplicateJob) {
+		t.Fatalf("Enqueue() of a queued issue error = %v, want ErrDuplicateJob", err)
+	}
+	if err := q.Enqueue(ctx, testJob("2")); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	if err := q.Enqueue(ctx, testJob("3")); !errors.Is(err, webhook.ErrQueueFull) {
+		t.Fatalf("Enqueue() over capacity error = %v, want ErrQueueFull", err)
+	}
+
+	first, err := q.Dequeue(ctx)
+	if err != nil {
+		t.Fatalf("Dequeue() error = %v", err)
+	}
+	if first.Job.ParsedError.IssueID != "1" || first.Job.Tenant != "acme" {
+		t.Errorf("Dequeue() job = %+v", first.Job)
+	}
+
+	// A leased job isn't handed out twice
+	second, err := q.Dequeue(ctx)
+	if err != nil {
+		t.Fatalf("Dequeue() error = %v", err)
+	}
+	if second.Job.ParsedError.IssueID != "2" {
+		t.Errorf("second Dequeue() issue = %s, want 2", second.Job.ParsedError.IssueID)
+	}
+
+	if err := q.Ack(ctx, first); err != nil {
+		t.Fatalf("Ack() error = %v", err)
+	}
+	if err := q.Ack(ctx, first); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("second Ack() error = %v, want ErrLeaseLost", err)
+	}
+	if err := q.Enqueue(ctx, testJob("3")); err != nil {
+		t.Fatalf("Enqueue() after Ack error = %v", err)
+	}
+}
+
+func TestSQLite_ResumesAfterRestart(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "queue.db")
+
+	q := openTestSQLite(t, path)
+	warning := webhook.Job{ParsedError: &webhook.ParsedError{IssueID: "warning", Level: "warning"}}
+	fatal := webhook.Job{ParsedError: &webhook.ParsedError{IssueID: "fatal", Level: "fatal", UserCount: 5000}}
+	for _, job := range []webhook.Job{warning, fatal} {
+		if err := q.Enqueue(ctx, job); err != nil {
+			t.Fatalf("Enqueue() error = %v", err)
+		}
+	}
+	msg, err := q.Dequeue(ctx)
+	if err != nil {
+		t.Fatalf("Dequeue() error = %v", err)
+	}
+	if msg.Job.ParsedError.IssueID != "fatal" {
+		t.Errorf("Dequeue() = %s, want the fatal error first", msg.Job.ParsedError.IssueID)
+	}
+	q.Close()
+
+	// The job left running when the process stopped is handed out again
+	q = openTestSQLite(t, path)
+	resumed, err := q.Dequeue(ctx)
+	if err != nil {
+		t.Fatalf("Dequeue() after reopening error = %v", err)
+	}
+	if resumed.Job.ParsedError.IssueID != "fatal" {
+		t.Errorf("Dequeue() after reopening = %s, want the unfinished fatal error", resumed.Job.ParsedError.IssueID)
+	}
+}
+
+func TestSQLite_DeliverEffects(t *testing.T) {
+	q := openTestSQLite(t, "")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := q.Enqueue(ctx, testJob("1")); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	msg, err := q.Dequeue(ctx)
+	if err != nil {
+		t.Fatalf("Dequeue() error = %v", err)
+	}
+	if err := q.AckWithEffect(ctx, msg, Effect{Kind: "pull_request", Payload: json.RawMessage(`{"issue":"1"}`)}); err != nil {
+		t.Fatalf("AckWithEffect() error = %v", err)
+	}
+
+	delivered := make(chan Effect, 2)
+	go q.DeliverEffects(ctx, func(ctx context.Context, e Effect) error {
+		delivered <- e
+		return nil
+	}, func(ctx context.Context, e Effect, err error) {
+		t.Errorf("effect %d abandoned: %v", e.ID, err)
+	})
+
+	select {
+	case e := <-delivered:
+		if e.Kind != "pull_request" || string(e.Payload) != `{"issue":"1"}` {
+			t.Errorf("delivered effect = %s %s", e.Kind, e.Payload)
+		}
+	case <-ctx.Done():
+		t.Fatal("effect was not delivered")
+	}
+
+	// Delivered effects are not delivered again
+	select {
+	case e := <-delivered:
+		t.Errorf("effect %d delivered twice", e.ID)
+	case <-time.After(2 * pgPollInterval):
+	}
+	var effects int
+	if err := q.db.QueryRow(`SELECT count(*) FROM outbox`).Scan(&effects); err != nil {
+		t.Fatal(err)
+	}
+	if effects != 0 {
+		t.Errorf("outbox has %d effects after delivery, want 0", effects)
+	}
+}
+
+func TestSQLite_AbandonEffects(t *testing.T) {
+	ctx := context.Background()
+	q := openTestSQLite(t, "")
+
+	if err := q.Enqueue(ctx, testJob("1")); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	msg, err := q.Dequeue(ctx)
+	if err != nil {
+		t.Fatalf("Dequeue() error = %v", err)
+	}
+	if err := q.AckWithEffect(ctx, msg, Effect{Kind: "pull_request", Payload: json.RawMessage(`{}`)}); err != nil {
+		t.Fatalf("AckWithEffect() error = %v", err)
+	}
+	// The next failure is the last attempt
+	if _, err := q.db.Exec(`UPDATE outbox SET attempts = ?`, outboxMaxAttempts-1); err != nil {
+		t.Fatal(err)
+	}
+
+	var abandoned []error
+	failing := func(context.Context, Effect) error { return errors.New("boom") }
+	found, err := q.deliverNext(ctx, failing, func(ctx context.Context, e Effect, err error) {
+		abandoned = append(abandoned, err)
+	})
+	if err != nil || !found {
+		t.Fatalf("deliverNext() = %v, %v, want an effect attempted", found, err)
+	}
+	if len(abandoned) != 1 || abandoned[0].Error() != "boom" {
+		t.Fatalf("abandoned = %v, want the effect with its last error", abandoned)
+	}
+
+	// Abandoned effects are not attempted again
+	if found, err := q.deliverNext(ctx, failing, nil); err != nil || found {
+		t.Errorf("deliverNext() after abandoning = %v, %v, want nothing to deliver", found, err)
+	}
+}
@@ -0,0 +1,179 @@
+// Package schedule restricts job processing to configured daily windows.
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Window is a daily time range, e.g. 22:00-06:00. A window whose end is not
+// after its start wraps past midnight.
+type Window struct {
+	Start time.Duration // offset from midnight
+	End   time.Duration
+}
+
+// String returns the window in its configuration form.
+func (w Window) String() string {
+	return formatClock(w.Start) + "-" + formatClock(w.End)
+}
+
+// contains reports whether the clock offset falls inside the window.
+func (w Window) contains(clock time.Duration) bool {
+	if w.Start < w.End {
+		return clock >= w.Start && clock < w.End
+	}
+	return clock >= w.Start || clock < w.End
+}
+
+// Schedule is a set of daily windows in a time zone. A nil Schedule is
+// always open.
+type Schedule struct {
+	Windows  []Window
+	Location *time.Location
+}
+
+// Parse parses a comma-separated list of HH:MM-HH:MM windows in loc. It
+// returns nil for an empty spec.
+func Parse(spec string, loc *time.Location) (*Schedule, error) {
+	s := &Schedule{Location: loc}
+	for _, entry := range strings.Split(spec, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		start, end, ok := strings.Cut(entry, "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid window %q: expected HH:MM-HH:MM", entry)
+		}
+		var (
+			w   Window
+			err error
+		)
+		if w.Start, err = parseClock(start); err != nil {
+			return nil, fmt.Errorf("invalid window %q: %w", entry, err)
+		}
+		if w.End, err = parseClock(end); err != nil {
+			return nil, fmt.Errorf("invalid window %q: %w", entry, err)
+		}
+		if w.Start == w.End {
+			return nil, fmt.Errorf("invalid window %q: start and end are equal", entry)
+		}
+		s.Windows = append(s.Windows, w)
+	}
+	if len(s.Windows) == 0 {
+		return nil, nil
+	}
+	return s, nil
+}
+
+// Open reports whether t falls inside one of the windows.
+func (s *Schedule) Open(t time.Time) bool {
+	if s == nil {
+		return true
+	}
+	clock := sinceMidnight(t.In(s.Location))
+	for _, w := range s.Windows {
+		if w.contains(clock) {
+			return true
+		}
+	}
+	return false
+}
+
+// NextOpen returns t if the schedule is open at t, and otherwise the start of
+// the next window.
+func (s *Schedule) NextOpen(t time.Time) time.Time {
+	if s.Open(t) {
+		return t
+	}
+
+	local := t.In(s.Location)
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, s.Location)
+	var next time.Time
+	for _, w := range s.Windows {
+		start := midnight.Add(w.Start)
+		if !start.After(t) {
+			start = midnight.AddDate(0, 0, 1).Add(w.Start)
+		}
+		if next.IsZero() || start.Before(next) {
+			next = start
+		}
+	}
+	return next
+}
+
+// OpenUntil returns when the window containing t closes, or the zero time if
+// t is outside every window or the schedule is always open.
+func (s *Schedule) OpenUntil(t time.Time) time.Time {
+	if s == nil {
+		return time.Time{}
+	}
+
+	local := t.In(s.Location)
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, s.Location)
+	clock := sinceMidnight(local)
+	var until time.Time
+	for _, w := range s.Windows {
+		if !w.contains(clock) {
+			continue
+		}
+		end := midnight.Add(w.End)
+		if w.Start > w.End && clock >= w.Start {
+			end = midnight.AddDate(0, 0, 1).Add(w.End)
+		}
+		if end.After(until) {
+			until = end
+		}
+	}
+	return until
+}
+
+// Wait blocks until the schedule is open or ctx is done.
+func (s *Schedule) Wait(ctx context.Context) error {
+	for {
+		now := time.Now()
+		next := s.NextOpen(now)
+		if !next.After(now) {
+			return nil
+		}
+
+		log.Printf("Outside processing windows (%s), waiting until %s", s, next.Format(time.RFC3339))
+		timer := time.NewTimer(next.Sub(now))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// String returns the schedule in its configuration form.
+func (s *Schedule) String() string {
+	parts := make([]string, len(s.Windows))
+	for i, w := range s.Windows {
+		parts[i] = w.String()
+	}
+	return strings.Join(parts, ",") + " " + s.Location.String()
+}
+
+// parseClock parses HH:MM into an offset from midnight.
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q: expected HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func formatClock(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+}
+
+func sinceMidnight(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second + time.Duration(t.Nanosecond())
+}
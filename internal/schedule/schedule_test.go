@@ -0,0 +1,114 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	s, err := Parse("22:00-06:00, 12:30-13:00", time.UTC)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if got := s.String(); got != "22:00-06:00,12:30-13:00 UTC" {
+		t.Errorf("String() = %q", got)
+	}
+
+	if s, err := Parse("", time.UTC); err != nil || s != nil {
+		t.Errorf("Parse(\"\") = %v, %v, want nil schedule", s, err)
+	}
+
+	for _, spec := range []string{"22:00", "25:00-06:00", "9am-5pm", "08:00-08:00"} {
+		if _, err := Parse(spec, time.UTC); err == nil {
+			t.Errorf("Parse(%q) error = nil, want error", spec)
+		}
+	}
+}
+
+func TestSchedule_OpenAndNextOpen(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("time zone data unavailable: %v", err)
+	}
+	s, err := Parse("22:00-06:00,12:30-13:00", berlin)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	at := func(hour, min int) time.Time {
+		return time.Date(2024, 6, 30, hour, min, 0, 0, berlin)
+	}
+	tests := []struct {
+		name     string
+		t        time.Time
+		wantOpen bool
+		wantNext time.Time
+	}{
+		{"before midnight", at(23, 0), true, at(23, 0)},
+		{"after midnight", at(5, 59), true, at(5, 59)},
+		{"window end is exclusive", at(6, 0), false, at(12, 30)},
+		{"lunch window", at(12, 45), true, at(12, 45)},
+		{"afternoon", at(15, 0), false, at(22, 0)},
+		{"lunch window end", at(13, 0), false, at(22, 0)},
+		{"other time zone", time.Date(2024, 6, 30, 20, 30, 0, 0, time.UTC), true, time.Date(2024, 6, 30, 20, 30, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.Open(tt.t); got != tt.wantOpen {
+				t.Errorf("Open() = %v, want %v", got, tt.wantOpen)
+			}
+			if got := s.NextOpen(tt.t); !got.Equal(tt.wantNext) {
+				t.Errorf("NextOpen() = %v, want %v", got, tt.wantNext)
+			}
+		})
+	}
+
+	// The next window can be tomorrow
+	morning, err := Parse("09:00-10:00", time.UTC)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	evening := time.Date(2024, 6, 30, 18, 0, 0, 0, time.UTC)
+	if got, want := morning.NextOpen(evening), time.Date(2024, 7, 1, 9, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("NextOpen() = %v, want %v", got, want)
+	}
+
+	var always *Schedule
+	if !always.Open(evening) {
+		t.Error("nil schedule should always be open")
+	}
+}
+
+func TestSchedule_OpenUntil(t *testing.T) {
+	s, err := Parse("22:00-06:00,12:30-13:00", time.UTC)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2024, 6, day, hour, min, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name string
+		t    time.Time
+		want time.Time
+	}{
+		{"before midnight", at(29, 23, 0), at(30, 6, 0)},
+		{"after midnight", at(30, 1, 0), at(30, 6, 0)},
+		{"lunch window", at(30, 12, 45), at(30, 13, 0)},
+		{"closed", at(30, 15, 0), time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.OpenUntil(tt.t); !got.Equal(tt.want) {
+				t.Errorf("OpenUntil() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	var always *Schedule
+	if got := always.OpenUntil(at(30, 15, 0)); !got.IsZero() {
+		t.Errorf("nil schedule OpenUntil() = %v, want zero", got)
+	}
+}
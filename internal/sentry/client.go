@@ -0,0 +1,259 @@
+package sentry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/webhook"
+)
+
+// DefaultBaseURL is the Sentry SaaS API host.
+const DefaultBaseURL = "https://sentry.io"
+
+// Client is a minimal Sentry web API client.
+type Client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+// NewClient creates a client for the Sentry instance at baseURL that
+// authenticates with an auth token.
+func NewClient(baseURL, token string) *Client {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	return &Client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		token:   token,
+		http:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// FetchIssue loads the issue an event belongs to. It follows the event's
+// issue URL when it points at this Sentry instance and otherwise builds the
+// URL from the issue ID, so the auth token is never sent to another host.
+func (c *Client) FetchIssue(ctx context.Context, event *webhook.Event) (*webhook.Issue, error) {
+	issueURL := event.IssueURL
+	if !strings.HasPrefix(issueURL, c.baseURL+"/api/") {
+		if event.IssueID == "" {
+			return nil, errors.New("event has no issue reference")
+		}
+		issueURL = fmt.Sprintf("%s/api/0/issues/%s/", c.baseURL, event.IssueID)
+	}
+
+	var issue webhook.Issue
+	if err := c.getJSON(ctx, issueURL, &issue); err != nil {
+		return nil, fmt.Errorf("failed to fetch issue: %w", err)
+	}
+	return &issue, nil
+}
+
+// LoadIssue builds the payload a webhook for an issue would carry: the issue
+// and its most representative event. That is the event Sentry recommends
+// where supported, else the latest one. Issues whose events have expired are
+// returned without one.
+func (c *Client) LoadIssue(ctx context.Context, issueID string) (*webhook.SentryWebhook, error) {
+	issue, err := c.FetchIssue(ctx, &webhook.Event{IssueID: issueID})
+	if err != nil {
+		return nil, err
+	}
+	wh := &webhook.SentryWebhook{Action: "triggered", Data: webhook.WebhookData{Issue: issue}}
+
+	// Older Sentry versions don't recommend events
+	for _, which := range []string{"recommended", "latest"} {
+		var event webhook.Event
+		err := c.getJSON(ctx, fmt.Sprintf("%s/api/0/issues/%s/events/%s/", c.baseURL, url.PathEscape(issue.ID), which), &event)
+		var status *statusError
+		if errors.As(err, &status) && status.code == http.StatusNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch %s event: %w", which, err)
+		}
+		wh.Data.Event = &event
+		break
+	}
+	return wh, nil
+}
+
+// FetchEvent loads one of an issue's events as Sentry stored it, after
+// symbolication and other processing.
+func (c *Client) FetchEvent(ctx context.Context, issueID, eventID string) (*webhook.Event, error) {
+	var event webhook.Event
+	u := fmt.Sprintf("%s/api/0/issues/%s/events/%s/", c.baseURL, url.PathEscape(issueID), url.PathEscape(eventID))
+	if err := c.getJSON(ctx, u, &event); err != nil {
+		return nil, fmt.Errorf("failed to fetch event: %w", err)
+	}
+	return &event, nil
+}
+
+// statusError is an unexpected API response status.
+type statusError struct {
+	code int
+	msg  string
+}
+
+func (e *statusError) Error() string { return e.msg }
+
+// ReleaseFile is an artifact uploaded to a release, such as a sourcemap.
+type ReleaseFile struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// maxReleaseFilePages caps how many pages of release files are listed.
+const maxReleaseFilePages = 10
+
+// maxReleaseFileBytes caps the size of a downloaded release file.
+const maxReleaseFileBytes = 64 << 20
+
+// ReleaseFiles lists the artifacts uploaded to a project's release.
+func (c *Client) ReleaseFiles(ctx context.Context, org, project, release string) ([]ReleaseFile, error) {
+	var files []ReleaseFile
+	next := c.releaseURL(org, project, release) + "files/"
+	for page := 0; next != "" && page < maxReleaseFilePages; page++ {
+		var batch []ReleaseFile
+		var err error
+		if next, err = c.getPage(ctx, next, &batch); err != nil {
+			return nil, fmt.Errorf("failed to list release files: %w", err)
+		}
+		files = append(files, batch...)
+	}
+	return files, nil
+}
+
+// DownloadReleaseFile returns the contents of a release artifact.
+func (c *Client) DownloadReleaseFile(ctx context.Context, org, project, release, id string) ([]byte, error) {
+	u := c.releaseURL(org, project, release) + "files/" + url.PathEscape(id) + "/?download=1"
+	resp, err := c.get(ctx, u)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download release file: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxReleaseFileBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download release file: %w", err)
+	}
+	if len(data) > maxReleaseFileBytes {
+		return nil, fmt.Errorf("release file exceeds %d bytes", maxReleaseFileBytes)
+	}
+	return data, nil
+}
+
+// releaseURL returns the API URL of a project's release, ending in a slash.
+func (c *Client) releaseURL(org, project, release string) string {
+	return fmt.Sprintf("%s/api/0/projects/%s/%s/releases/%s/", c.baseURL, url.PathEscape(org), url.PathEscape(project), url.PathEscape(release))
+}
+
+// OrgFromPermalink returns the organization slug in an issue permalink, such
+// as https://acme.sentry.io/issues/1/ or
+// https://sentry.example.com/organizations/acme/issues/1/, or "".
+func OrgFromPermalink(permalink string) string {
+	u, err := url.Parse(permalink)
+	if err != nil {
+		return ""
+	}
+	if rest, ok := strings.CutPrefix(u.Path, "/organizations/"); ok {
+		org, _, _ := strings.Cut(rest, "/")
+		return org
+	}
+	if org, ok := strings.CutSuffix(u.Hostname(), ".sentry.io"); ok && !strings.Contains(org, ".") {
+		return org
+	}
+	return ""
+}
+
+// getJSON decodes the response to an authenticated GET of u into v.
+func (c *Client) getJSON(ctx context.Context, u string, v any) error {
+	_, err := c.getPage(ctx, u, v)
+	return err
+}
+
+// getPage is getJSON for paginated lists, returning the URL of the next
+// page or "" if this is the last one.
+func (c *Client) getPage(ctx context.Context, u string, v any) (string, error) {
+	resp, err := c.get(ctx, u)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return "", fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nextPage(resp.Header.Get("Link")), nil
+}
+
+// get makes an authenticated GET of u, failing unless it returns 200 OK.
+func (c *Client) get(ctx context.Context, u string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, &statusError{code: resp.StatusCode, msg: fmt.Sprintf("%s: %s", resp.Status, strings.TrimSpace(string(body)))}
+	}
+	return resp, nil
+}
+
+// nextPage returns the next page in a Sentry Link header, which lists a
+// next page with results="false" when there is none.
+func nextPage(link string) string {
+	for _, part := range strings.Split(link, ",") {
+		if !strings.Contains(part, `rel="next"`) || !strings.Contains(part, `results="true"`) {
+			continue
+		}
+		start, end := strings.Index(part, "<"), strings.Index(part, ">")
+		if start >= 0 && end > start {
+			return part[start+1 : end]
+		}
+	}
+	return ""
+}
+
+// AddComment posts a note on an issue's activity stream.
+func (c *Client) AddComment(ctx context.Context, issueID, text string) error {
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+
+	commentsURL := fmt.Sprintf("%s/api/0/issues/%s/comments/", c.baseURL, url.PathEscape(issueID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, commentsURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to comment on issue: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("failed to comment on issue: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
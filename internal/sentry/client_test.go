@@ -0,0 +1,206 @@
+package sentry
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/webhook"
+)
+
+func TestClient_FetchIssue(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer tok" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/api/0/issues/42/" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"id": "42", "shortId": "API-7", "project": {"slug": "api"}, "metadata": {"type": "KeyError"}}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "tok")
+
+	tests := []struct {
+		name    string
+		event   webhook.Event
+		wantErr bool
+	}{
+		{"issue url", webhook.Event{IssueURL: server.URL + "/api/0/issues/42/"}, false},
+		{"foreign url falls back to id", webhook.Event{IssueURL: "https://evil.example.com/api/0/issues/42/", IssueID: "42"}, false},
+		{"foreign url without id", webhook.Event{IssueURL: "https://evil.example.com/api/0/issues/42/"}, true},
+		{"unknown issue", webhook.Event{IssueID: "7"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issue, err := client.FetchIssue(context.Background(), &tt.event)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FetchIssue() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (issue.ShortID != "API-7" || issue.Project.Slug != "api") {
+				t.Errorf("FetchIssue() = %+v", issue)
+			}
+		})
+	}
+}
+
+func TestClient_AddComment(t *testing.T) {
+	var got string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/0/issues/42/comments/" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var body struct{ Text string }
+		json.NewDecoder(r.Body).Decode(&body)
+		got = body.Text
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "tok")
+	if err := client.AddComment(context.Background(), "42", "deferred"); err != nil {
+		t.Fatalf("AddComment() error = %v", err)
+	}
+	if got != "deferred" {
+		t.Errorf("comment text = %q, want %q", got, "deferred")
+	}
+	if err := client.AddComment(context.Background(), "7", "deferred"); err == nil {
+		t.Error("AddComment() on unknown issue should fail")
+	}
+}
+
+func TestClient_LoadIssue(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/0/issues/42/":
+			w.Write([]byte(`{"id": "42", "project": {"slug": "api"}, "metadata": {"type": "KeyError"}}`))
+		case "/api/0/issues/42/events/latest/":
+			w.Write([]byte(`{"eventID": "abc", "tags": [{"key": "release", "value": "1.2.0"}], "entries": [{"type": "exception", "data": {"values": [{"type": "KeyError", "stacktrace": {"frames": [{"filename": "app.py", "inApp": true}]}}]}}]}`))
+		case "/api/0/issues/44/":
+			w.Write([]byte(`{"id": "44", "project": {"slug": "api"}}`))
+		case "/api/0/issues/44/events/recommended/":
+			w.Write([]byte(`{"eventID": "rec"}`))
+		case "/api/0/issues/44/events/latest/":
+			w.Write([]byte(`{"eventID": "new"}`))
+		case "/api/0/issues/43/":
+			w.Write([]byte(`{"id": "43", "project": {"slug": "api"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "tok")
+
+	wh, err := client.LoadIssue(context.Background(), "42")
+	if err != nil {
+		t.Fatalf("LoadIssue() error = %v", err)
+	}
+	parsed := webhook.ParseWebhook(wh)
+	if parsed.IssueID != "42" || parsed.Release != "1.2.0" || len(parsed.Frames) != 1 {
+		t.Errorf("LoadIssue() parsed = %+v", parsed)
+	}
+
+	// The recommended event is preferred where Sentry supports it
+	wh, err = client.LoadIssue(context.Background(), "44")
+	if err != nil {
+		t.Fatalf("LoadIssue() error = %v", err)
+	}
+	if wh.Data.Event == nil || wh.Data.Event.EventID != "rec" {
+		t.Errorf("LoadIssue() event = %+v, want the recommended one", wh.Data.Event)
+	}
+
+	// Issues whose events expired are loaded without one
+	wh, err = client.LoadIssue(context.Background(), "43")
+	if err != nil {
+		t.Fatalf("LoadIssue() without events error = %v", err)
+	}
+	if wh.Data.Issue.ID != "43" || wh.Data.Event != nil {
+		t.Errorf("LoadIssue() without events = %+v", wh.Data)
+	}
+
+	if _, err := client.LoadIssue(context.Background(), "7"); err == nil {
+		t.Error("LoadIssue() of an unknown issue succeeded")
+	}
+}
+
+func TestClient_ReleaseFiles(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/0/projects/acme/web/releases/1.0+build/files/":
+			if r.URL.Query().Get("cursor") == "" {
+				w.Header().Set("Link", `<`+server.URL+r.URL.Path+`?cursor=1>; rel="next"; results="true"; cursor="1"`)
+				w.Write([]byte(`[{"id": "1", "name": "~/static/main.js"}]`))
+				return
+			}
+			w.Header().Set("Link", `<`+server.URL+r.URL.Path+`?cursor=2>; rel="next"; results="false"; cursor="2"`)
+			w.Write([]byte(`[{"id": "2", "name": "~/static/main.js.map"}]`))
+		case r.URL.Path == "/api/0/projects/acme/web/releases/1.0+build/files/2/" && r.URL.Query().Get("download") == "1":
+			w.Write([]byte(`{"version": 3}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "tok")
+	files, err := client.ReleaseFiles(context.Background(), "acme", "web", "1.0+build")
+	if err != nil {
+		t.Fatalf("ReleaseFiles() error = %v", err)
+	}
+	if len(files) != 2 || files[1].Name != "~/static/main.js.map" {
+		t.Errorf("ReleaseFiles() = %+v, want both pages", files)
+	}
+
+	data, err := client.DownloadReleaseFile(context.Background(), "acme", "web", "1.0+build", "2")
+	if err != nil || string(data) != `{"version": 3}` {
+		t.Errorf("DownloadReleaseFile() = %q, %v", data, err)
+	}
+}
+
+func TestOrgFromPermalink(t *testing.T) {
+	tests := map[string]string{
+		"https://acme.sentry.io/issues/1/":                        "acme",
+		"https://sentry.example.com/organizations/acme/issues/1/": "acme",
+		"https://sentry.io/organizations/acme/issues/1/":          "acme",
+		"https://sentry.example.com/issues/1/":                    "",
+		"":                                                        "",
+	}
+	for permalink, want := range tests {
+		if got := OrgFromPermalink(permalink); got != want {
+			t.Errorf("OrgFromPermalink(%q) = %q, want %q", permalink, got, want)
+		}
+	}
+}
+
+func TestClient_FetchEvent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/0/issues/42/events/abc/" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"eventID": "abc", "platform": "cocoa", "entries": [{"type": "exception", "data": {"values": [{"stacktrace": {"frames": [{"function": "-[AppDelegate crash]", "instructionAddr": "0x1a2b"}]}}]}}]}`))
+	}))
+	defer server.Close()
+
+	event, err := NewClient(server.URL, "tok").FetchEvent(context.Background(), "42", "abc")
+	if err != nil {
+		t.Fatalf("FetchEvent() error = %v", err)
+	}
+	parsed := webhook.ParseWebhook(&webhook.SentryWebhook{Data: webhook.WebhookData{Issue: &webhook.Issue{ID: "42"}, Event: event}})
+	if len(parsed.Frames) != 1 || parsed.Frames[0].Function != "-[AppDelegate crash]" || parsed.Unsymbolicated() {
+		t.Errorf("FetchEvent() frames = %+v", parsed.Frames)
+	}
+
+	if _, err := NewClient(server.URL, "tok").FetchEvent(context.Background(), "42", "missing"); err == nil {
+		t.Error("FetchEvent() of a missing event succeeded")
+	}
+}
@@ -0,0 +1,194 @@
+// Package sourcemap decodes JavaScript source maps (revision 3) and maps
+// locations in generated code back to the original source.
+package sourcemap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Map is a decoded source map.
+type Map struct {
+	sources  []string
+	contents []*string
+	names    []string
+	// lines holds each generated line's segments, ordered by column
+	lines [][]segment
+}
+
+// Mapping is the original location of a position in generated code. Line
+// and Column are zero-based, as in the source map format.
+type Mapping struct {
+	Source string
+	Line   int
+	Column int
+	// Name is the original identifier at the location, if recorded.
+	Name string
+}
+
+// segment maps a generated column to an original location. source and name
+// are -1 when the segment has none.
+type segment struct {
+	column, source, line, sourceColumn, name int
+}
+
+// rawMap is the JSON form of a source map.
+type rawMap struct {
+	Version        int       `json:"version"`
+	SourceRoot     string    `json:"sourceRoot"`
+	Sources        []string  `json:"sources"`
+	SourcesContent []*string `json:"sourcesContent"`
+	Names          []string  `json:"names"`
+	Mappings       string    `json:"mappings"`
+	Sections       []any     `json:"sections"`
+}
+
+// Parse decodes a source map. Index maps, which combine several maps in
+// sections, are not supported.
+func Parse(data []byte) (*Map, error) {
+	// Maps may start with a line guarding against XSSI
+	if s := string(data); strings.HasPrefix(s, ")]}") {
+		if i := strings.IndexByte(s, '\n'); i >= 0 {
+			data = data[i+1:]
+		}
+	}
+
+	var raw rawMap
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid source map: %w", err)
+	}
+	if raw.Version != 3 {
+		return nil, fmt.Errorf("unsupported source map version %d", raw.Version)
+	}
+	if raw.Sections != nil {
+		return nil, errors.New("index source maps are not supported")
+	}
+
+	m := &Map{names: raw.Names, contents: raw.SourcesContent}
+	for _, source := range raw.Sources {
+		if raw.SourceRoot != "" {
+			source = strings.TrimSuffix(raw.SourceRoot, "/") + "/" + source
+		}
+		m.sources = append(m.sources, source)
+	}
+
+	if err := m.decode(raw.Mappings); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Lookup returns the original location of a zero-based line and column in
+// the generated code: that of the closest mapped position at or before it
+// on the same line.
+func (m *Map) Lookup(line, column int) (Mapping, bool) {
+	if line < 0 || line >= len(m.lines) {
+		return Mapping{}, false
+	}
+	segs := m.lines[line]
+	i := sort.Search(len(segs), func(i int) bool { return segs[i].column > column }) - 1
+	if i < 0 || segs[i].source < 0 {
+		return Mapping{}, false
+	}
+
+	seg := segs[i]
+	mapping := Mapping{Source: m.sources[seg.source], Line: seg.line, Column: seg.sourceColumn}
+	if seg.name >= 0 {
+		mapping.Name = m.names[seg.name]
+	}
+	return mapping, true
+}
+
+// SourceContent returns the original source of a file embedded in the map.
+func (m *Map) SourceContent(source string) (string, bool) {
+	for i, s := range m.sources {
+		if s == source && i < len(m.contents) && m.contents[i] != nil {
+			return *m.contents[i], true
+		}
+	}
+	return "", false
+}
+
+// decode reads the base64 VLQ mappings. Every field but the generated
+// column is relative to the previous segment across lines.
+func (m *Map) decode(mappings string) error {
+	var source, line, sourceColumn, name int
+	for _, lineMappings := range strings.Split(mappings, ";") {
+		var segs []segment
+		column := 0
+		for _, field := range strings.Split(lineMappings, ",") {
+			if field == "" {
+				continue
+			}
+			values, err := decodeVLQ(field)
+			if err != nil {
+				return err
+			}
+
+			seg := segment{source: -1, name: -1}
+			column += values[0]
+			seg.column = column
+			switch len(values) {
+			case 1:
+			case 4, 5:
+				source += values[1]
+				line += values[2]
+				sourceColumn += values[3]
+				if source < 0 || source >= len(m.sources) {
+					return fmt.Errorf("invalid source map: source index %d out of range", source)
+				}
+				seg.source, seg.line, seg.sourceColumn = source, line, sourceColumn
+				if len(values) == 5 {
+					name += values[4]
+					if name < 0 || name >= len(m.names) {
+						return fmt.Errorf("invalid source map: name index %d out of range", name)
+					}
+					seg.name = name
+				}
+			default:
+				return fmt.Errorf("invalid source map: segment %q has %d fields", field, len(values))
+			}
+			segs = append(segs, seg)
+		}
+		sort.SliceStable(segs, func(i, j int) bool { return segs[i].column < segs[j].column })
+		m.lines = append(m.lines, segs)
+	}
+	return nil
+}
+
+const base64Chars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+// decodeVLQ decodes the base64 VLQ values of a mappings segment.
+func decodeVLQ(s string) ([]int, error) {
+	var values []int
+	value, shift := 0, 0
+	for i := 0; i < len(s); i++ {
+		digit := strings.IndexByte(base64Chars, s[i])
+		if digit < 0 {
+			return nil, fmt.Errorf("invalid source map: bad character %q in mappings", s[i])
+		}
+		value += (digit & 31) << shift
+		if digit&32 != 0 {
+			shift += 5
+			if shift > 30 {
+				return nil, errors.New("invalid source map: value too large in mappings")
+			}
+			continue
+		}
+
+		// The lowest bit is the sign
+		if value&1 != 0 {
+			values = append(values, -(value >> 1))
+		} else {
+			values = append(values, value>>1)
+		}
+		value, shift = 0, 0
+	}
+	if shift != 0 {
+		return nil, errors.New("invalid source map: truncated mappings")
+	}
+	return values, nil
+}
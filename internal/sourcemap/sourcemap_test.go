@@ -0,0 +1,60 @@
+package sourcemap
+
+import "testing"
+
+func TestMap_Lookup(t *testing.T) {
+	data := `)]}'
+{
+  "version": 3,
+  "sourceRoot": "webpack:///",
+  "sources": ["src/app.ts"],
+  "sourcesContent": ["const user = load();\nuser.name;\n"],
+  "names": ["foo", "bar"],
+  "mappings": "AAAA,IAAIA,SACCC;;EACE"
+}`
+	m, err := Parse([]byte(data))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	tests := []struct {
+		line, column int
+		want         Mapping
+		wantOK       bool
+	}{
+		{0, 0, Mapping{Source: "webpack:///src/app.ts"}, true},
+		{0, 10, Mapping{Source: "webpack:///src/app.ts", Column: 4, Name: "foo"}, true},
+		{0, 13, Mapping{Source: "webpack:///src/app.ts", Line: 1, Column: 5, Name: "bar"}, true},
+		{1, 0, Mapping{}, false},
+		{2, 0, Mapping{}, false},
+		{2, 50, Mapping{Source: "webpack:///src/app.ts", Line: 2, Column: 7}, true},
+		{9, 0, Mapping{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := m.Lookup(tt.line, tt.column)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("Lookup(%d, %d) = %+v, %v; want %+v, %v", tt.line, tt.column, got, ok, tt.want, tt.wantOK)
+		}
+	}
+
+	if content, ok := m.SourceContent("webpack:///src/app.ts"); !ok || content != "const user = load();\nuser.name;\n" {
+		t.Errorf("SourceContent() = %q, %v", content, ok)
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"not json":       `{`,
+		"version":        `{"version": 2, "mappings": ""}`,
+		"index map":      `{"version": 3, "sections": []}`,
+		"source index":   `{"version": 3, "sources": ["a.js"], "mappings": "ACAA"}`,
+		"bad character":  `{"version": 3, "sources": ["a.js"], "mappings": "A!AA"}`,
+		"truncated":      `{"version": 3, "sources": ["a.js"], "mappings": "AAAg"}`,
+		"segment fields": `{"version": 3, "sources": ["a.js"], "mappings": "AA"}`,
+	}
+	for name, data := range tests {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("%s: Parse() succeeded, want an error", name)
+		}
+	}
+}
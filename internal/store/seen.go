@@ -0,0 +1,78 @@
+package store
+
+import (
+	"sync"
+	"time"
+)
+
+// SeenSet remembers IDs for a retention period. When created with an empty
+// path it keeps everything in memory.
+type SeenSet struct {
+	path string
+	ttl  time.Duration
+	now  func() time.Time
+
+	mu  sync.Mutex
+	ids map[string]time.Time
+}
+
+// NewSeenSet opens the set at path, loading any IDs still within ttl.
+func NewSeenSet(path string, ttl time.Duration) (*SeenSet, error) {
+	s := &SeenSet{
+		path: path,
+		ttl:  ttl,
+		now:  time.Now,
+		ids:  make(map[string]time.Time),
+	}
+
+	if path != "" {
+		if _, err := ReadJSON(path, &s.ids); err != nil {
+			return nil, err
+		}
+		s.prune()
+	}
+
+	return s, nil
+}
+
+// Add records id and reports whether it was new. Adding an ID that is already
+// present leaves its original timestamp untouched.
+func (s *SeenSet) Add(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.prune()
+	if _, ok := s.ids[id]; ok {
+		return false, nil
+	}
+	s.ids[id] = s.now()
+
+	return true, s.save()
+}
+
+// Remove forgets id, e.g. when the work it guarded could not be started.
+func (s *SeenSet) Remove(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.ids, id)
+	return s.save()
+}
+
+// prune drops expired IDs. Callers must hold s.mu.
+func (s *SeenSet) prune() {
+	now := s.now()
+	for id, at := range s.ids {
+		if now.Sub(at) > s.ttl {
+			delete(s.ids, id)
+		}
+	}
+}
+
+// save writes the set to disk. Callers must hold s.mu.
+func (s *SeenSet) save() error {
+	if s.path == "" {
+		return nil
+	}
+	return WriteJSON(s.path, s.ids)
+}
@@ -0,0 +1,47 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSeenSet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seen.json")
+	now := time.Now()
+
+	s, err := NewSeenSet(path, time.Hour)
+	if err != nil {
+		t.Fatalf("NewSeenSet() error = %v", err)
+	}
+	s.now = func() time.Time { return now }
+
+	if added, _ := s.Add("a"); !added {
+		t.Error("first Add() should report new")
+	}
+	if added, _ := s.Add("a"); added {
+		t.Error("second Add() should report duplicate")
+	}
+
+	// Persisted across restarts
+	reopened, err := NewSeenSet(path, time.Hour)
+	if err != nil {
+		t.Fatalf("NewSeenSet() reopen error = %v", err)
+	}
+	reopened.now = func() time.Time { return now }
+	if added, _ := reopened.Add("a"); added {
+		t.Error("ID should survive a reopen")
+	}
+
+	if err := reopened.Remove("a"); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if added, _ := reopened.Add("a"); !added {
+		t.Error("removed ID should be new again")
+	}
+
+	now = now.Add(2 * time.Hour)
+	if added, _ := reopened.Add("a"); !added {
+		t.Error("expired ID should be new again")
+	}
+}
@@ -0,0 +1,447 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/gitprovider"
+)
+
+const (
+	// DefaultAnthropicBaseURL is the Anthropic API host.
+	DefaultAnthropicBaseURL = "https://api.anthropic.com"
+	// DefaultAnthropicModel is the model used when none is configured.
+	DefaultAnthropicModel = "claude-sonnet-4-5"
+
+	anthropicVersion   = "2023-06-01"
+	anthropicMaxTokens = 16384
+	defaultMaxTurns    = 30
+	// maxToolResultBytes caps how much of a file or listing is returned to
+	// the model in one tool result.
+	maxToolResultBytes = 100 * 1024
+)
+
+// RepoReader reads the repository being fixed. gitprovider.Provider
+// implements it.
+type RepoReader interface {
+	FetchFile(ctx context.Context, path, ref string) (*gitprovider.FileContent, error)
+	ListDirectory(ctx context.Context, path, ref string) ([]gitprovider.DirEntry, error)
+	SearchCode(ctx context.Context, query string) ([]gitprovider.SearchResult, error)
+}
+
+// AnthropicOptions configures the Anthropic API backend.
+type AnthropicOptions struct {
+	APIKey string
+	// Model defaults to DefaultAnthropicModel.
+	Model string
+	// BaseURL defaults to DefaultAnthropicBaseURL.
+	BaseURL string
+	// MaxTurns caps the model's tool-use round trips; 0 uses a default.
+	MaxTurns int
+	// Vertex routes requests through Google Vertex AI instead of the
+	// Anthropic API, in which case APIKey and BaseURL are unused and Model
+	// defaults to DefaultVertexModel.
+	Vertex *VertexOptions
+}
+
+// AnthropicTool generates fixes by calling the Anthropic Messages API
+// directly, giving the model tools that read the repository through its git
+// provider. Unlike ClaudeCodeTool it needs neither the Claude Code CLI nor a
+// clone.
+type AnthropicTool struct {
+	repo     RepoReader
+	ref      string
+	opts     AnthropicOptions
+	sessions *Sessions
+	http     *http.Client
+}
+
+// NewAnthropicTool creates an Anthropic API backend reading repo at ref. Its
+// sessions count against sessions, which may be nil.
+func NewAnthropicTool(repo RepoReader, ref string, opts AnthropicOptions, sessions *Sessions) *AnthropicTool {
+	if opts.Model == "" {
+		opts.Model = DefaultAnthropicModel
+		if opts.Vertex != nil {
+			opts.Model = DefaultVertexModel
+		}
+	}
+	if opts.BaseURL == "" {
+		opts.BaseURL = DefaultAnthropicBaseURL
+	}
+	opts.BaseURL = strings.TrimRight(opts.BaseURL, "/")
+	if opts.MaxTurns <= 0 {
+		opts.MaxTurns = defaultMaxTurns
+	}
+	return &AnthropicTool{
+		repo:     repo,
+		ref:      ref,
+		opts:     opts,
+		sessions: sessions,
+		http:     &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+// apiContent is a content block of a Messages API message.
+type apiContent struct {
+	Type string `json:"type"`
+	Text string `json:"text,omitempty"`
+
+	// tool_use
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+
+	// tool_result
+	ToolUseID string `json:"tool_use_id,omitempty"`
+	Content   string `json:"content,omitempty"`
+	IsError   bool   `json:"is_error,omitempty"`
+}
+
+type apiMessage struct {
+	Role    string       `json:"role"`
+	Content []apiContent `json:"content"`
+}
+
+type apiTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"input_schema"`
+}
+
+type apiRequest struct {
+	// Vertex AI takes the model from the URL and the version in the body
+	Model            string       `json:"model,omitempty"`
+	AnthropicVersion string       `json:"anthropic_version,omitempty"`
+	MaxTokens        int          `json:"max_tokens"`
+	System           string       `json:"system,omitempty"`
+	Tools            []apiTool    `json:"tools"`
+	Messages         []apiMessage `json:"messages"`
+}
+
+type apiResponse struct {
+	Content    []apiContent `json:"content"`
+	StopReason string       `json:"stop_reason"`
+	Usage      streamUsage  `json:"usage"`
+}
+
+type apiError struct {
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// repoTools are the tools the model can use to read the repository.
+var repoTools = []apiTool{
+	{
+		Name:        "read_file",
+		Description: "Read a file from the repository. Paths are relative to the repository root.",
+		InputSchema: stringInputSchema("path", "Repository-relative file path"),
+	},
+	{
+		Name:        "list_directory",
+		Description: "List the entries of a repository directory. Use an empty path for the root.",
+		InputSchema: stringInputSchema("path", "Repository-relative directory path"),
+	},
+	{
+		Name:        "search_code",
+		Description: "Search the repository's default branch for code. Returns matching files and lines.",
+		InputSchema: stringInputSchema("query", "Code search query, e.g. an identifier"),
+	},
+}
+
+func stringInputSchema(name, description string) map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			name: map[string]any{"type": "string", "description": description},
+		},
+		"required": []string{name},
+	}
+}
+
+// GenerateFix asks the model to analyze the error and generate a fix,
+// answering its requests to read the repository until it reports one.
+func (a *AnthropicTool) GenerateFix(ctx context.Context, req *FixRequest) (*FixResponse, error) {
+	system := "You are fixing a production error. You cannot run commands or edit files: " +
+		"read the repository with the provided tools, then report the fix."
+	messages := []apiMessage{userMessage(buildPrompt(req) + "\n\n" + outputInstructions(req))}
+
+	var inputTokens, outputTokens int
+	for correction := 0; ; correction++ {
+		text, in, out, err := a.converse(ctx, system, buildSystemPrompt(req), &messages)
+		if err != nil {
+			return nil, err
+		}
+		inputTokens += in
+		outputTokens += out
+
+		fix, err := parseResponse(text)
+		if err != nil && correction < maxOutputCorrections {
+			// Ask for the report again in the same conversation
+			log.Printf("Fix report for issue %s is malformed (%v), asking the model for it again (%d/%d)", req.IssueID, err, correction+1, maxOutputCorrections)
+			messages = append(messages, userMessage(correctionPrompt(err, outputInstructions(req))))
+			continue
+		}
+		if err != nil {
+			fix = &FixResponse{Success: false, Error: err.Error()}
+		}
+		fix.InputTokens, fix.OutputTokens = inputTokens, outputTokens
+		return fix, nil
+	}
+}
+
+// ReviewFix asks the model to review a fix, reading the repository as it
+// needs.
+func (a *AnthropicTool) ReviewFix(ctx context.Context, req *ReviewRequest) (*ReviewResponse, error) {
+	system := "You are reviewing a proposed fix for a production error. You cannot run commands or edit files: " +
+		"read the repository with the provided tools, then report your verdict."
+	messages := []apiMessage{userMessage(buildReviewPrompt(req))}
+	text, inputTokens, outputTokens, err := a.converse(ctx, system, buildSystemPrompt(req.Fix), &messages)
+	if err != nil {
+		return nil, err
+	}
+	review, err := parseReview(text)
+	if err != nil {
+		return nil, err
+	}
+	review.InputTokens, review.OutputTokens = inputTokens, outputTokens
+	return review, nil
+}
+
+// converse sends messages and answers the model's requests to read the
+// repository until it ends its turn, returning its final text and the tokens
+// used. The model's messages and the tool results are added to messages.
+func (a *AnthropicTool) converse(ctx context.Context, system, guide string, messages *[]apiMessage) (_ string, _, _ int, err error) {
+	release, err := a.sessions.Acquire(ctx)
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("no free model session: %w", err)
+	}
+	defer release()
+
+	if guide != "" {
+		system += "\n\n" + guide
+	}
+
+	// Record the prompt and everything the model says in reply, whatever
+	// the outcome
+	var prompt, said strings.Builder
+	for _, block := range (*messages)[len(*messages)-1].Content {
+		prompt.WriteString(block.Text)
+	}
+	defer func() { recordExchange(ctx, system, prompt.String(), strings.TrimSpace(said.String()), err) }()
+
+	var inputTokens, outputTokens int
+	for turn := 0; turn < a.opts.MaxTurns; turn++ {
+		resp, err := a.createMessage(ctx, apiRequest{
+			Model:     a.opts.Model,
+			MaxTokens: anthropicMaxTokens,
+			System:    system,
+			Tools:     repoTools,
+			Messages:  *messages,
+		})
+		if err != nil {
+			return "", 0, 0, err
+		}
+		inputTokens += resp.Usage.input()
+		outputTokens += resp.Usage.OutputTokens
+		*messages = append(*messages, apiMessage{Role: "assistant", Content: resp.Content})
+		for _, block := range resp.Content {
+			writeOutputBlock(&said, block.Type, block.Text, block.Name, block.Input)
+		}
+
+		if resp.StopReason != "tool_use" {
+			var text strings.Builder
+			for _, block := range resp.Content {
+				if block.Type == "text" {
+					text.WriteString(block.Text)
+				}
+			}
+			return text.String(), inputTokens, outputTokens, nil
+		}
+
+		var results []apiContent
+		for _, block := range resp.Content {
+			if block.Type == "tool_use" {
+				results = append(results, a.runTool(ctx, block))
+			}
+		}
+		*messages = append(*messages, apiMessage{Role: "user", Content: results})
+	}
+	return "", 0, 0, fmt.Errorf("model did not finish within %d turns", a.opts.MaxTurns)
+}
+
+// userMessage is a user message of text.
+func userMessage(text string) apiMessage {
+	return apiMessage{Role: "user", Content: []apiContent{{Type: "text", Text: text}}}
+}
+
+// createMessage sends one Messages API request.
+func (a *AnthropicTool) createMessage(ctx context.Context, body apiRequest) (*apiResponse, error) {
+	endpoint := a.opts.BaseURL + "/v1/messages"
+	if a.opts.Vertex != nil {
+		endpoint = a.opts.Vertex.endpoint(body.Model)
+		body.Model, body.AnthropicVersion = "", vertexAnthropicVersion
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if a.opts.Vertex != nil {
+		token, err := a.opts.Vertex.Token(ctx)
+		if err != nil {
+			return nil, &TransientError{Err: fmt.Errorf("failed to get Google Cloud access token: %w", err)}
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else {
+		req.Header.Set("x-api-key", a.opts.APIKey)
+		req.Header.Set("anthropic-version", anthropicVersion)
+	}
+
+	resp, err := a.http.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		return nil, &TransientError{Err: fmt.Errorf("%s request failed: %w", a.apiName(), err)}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		message := strings.TrimSpace(string(raw))
+		var apiErr apiError
+		if json.Unmarshal(raw, &apiErr) == nil && apiErr.Error.Message != "" {
+			message = apiErr.Error.Message
+			if apiErr.Error.Type != "" {
+				message = apiErr.Error.Type + ": " + message
+			}
+		}
+		err := fmt.Errorf("%s returned %s: %s", a.apiName(), resp.Status, message)
+		// Rate limits, overload (529) and server errors clear up on their own
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+			return nil, &TransientError{Err: err}
+		}
+		return nil, err
+	}
+
+	var out apiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("failed to decode %s response: %w", a.apiName(), err)
+	}
+	return &out, nil
+}
+
+// apiName names the API the tool calls, for errors.
+func (a *AnthropicTool) apiName() string {
+	if a.opts.Vertex != nil {
+		return "Vertex AI"
+	}
+	return "Anthropic API"
+}
+
+// runTool answers a tool_use block. Failures are reported to the model
+// rather than ending the session.
+func (a *AnthropicTool) runTool(ctx context.Context, call apiContent) apiContent {
+	result := apiContent{Type: "tool_result", ToolUseID: call.ID}
+
+	var input struct {
+		Path  string `json:"path"`
+		Query string `json:"query"`
+	}
+	if err := json.Unmarshal(call.Input, &input); err != nil {
+		result.Content, result.IsError = fmt.Sprintf("invalid input: %v", err), true
+		return result
+	}
+
+	var out string
+	var err error
+	switch call.Name {
+	case "read_file":
+		out, err = a.readFile(ctx, input.Path)
+	case "list_directory":
+		out, err = a.listDirectory(ctx, input.Path)
+	case "search_code":
+		out, err = a.searchCode(ctx, input.Query)
+	default:
+		err = fmt.Errorf("unknown tool %q", call.Name)
+	}
+	if err != nil {
+		result.Content, result.IsError = err.Error(), true
+		return result
+	}
+	if out == "" {
+		out = "(empty)"
+	}
+	result.Content = truncate(out, maxToolResultBytes)
+	return result
+}
+
+func (a *AnthropicTool) readFile(ctx context.Context, path string) (string, error) {
+	path = strings.TrimPrefix(path, "/")
+	if path == "" {
+		return "", errors.New("path is required")
+	}
+	file, err := a.repo.FetchFile(ctx, path, a.ref)
+	if err != nil {
+		return "", err
+	}
+	return file.Content, nil
+}
+
+func (a *AnthropicTool) listDirectory(ctx context.Context, path string) (string, error) {
+	entries, err := a.repo.ListDirectory(ctx, strings.Trim(path, "/"), a.ref)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	for _, e := range entries {
+		if e.Type == "dir" {
+			sb.WriteString(e.Path + "/\n")
+		} else {
+			sb.WriteString(e.Path + "\n")
+		}
+	}
+	return sb.String(), nil
+}
+
+func (a *AnthropicTool) searchCode(ctx context.Context, query string) (string, error) {
+	if query == "" {
+		return "", errors.New("query is required")
+	}
+	results, err := a.repo.SearchCode(ctx, query)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	for _, r := range results {
+		if len(r.Matches) == 0 {
+			sb.WriteString(r.Path + "\n")
+		}
+		for _, m := range r.Matches {
+			if m.LineNumber > 0 {
+				sb.WriteString(fmt.Sprintf("%s:%d: %s\n", r.Path, m.LineNumber, oneLine(m.Content)))
+			} else {
+				sb.WriteString(fmt.Sprintf("%s: %s\n", r.Path, oneLine(m.Content)))
+			}
+		}
+	}
+	if sb.Len() == 0 {
+		return "no matches", nil
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,186 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/gitprovider"
+)
+
+// fakeRepo is an in-memory RepoReader.
+type fakeRepo map[string]string
+
+func (r fakeRepo) FetchFile(ctx context.Context, path, ref string) (*gitprovider.FileContent, error) {
+	content, ok := r[path]
+	if !ok {
+		return nil, errors.New("404 Not Found")
+	}
+	return &gitprovider.FileContent{Path: path, Content: content}, nil
+}
+
+func (r fakeRepo) ListDirectory(ctx context.Context, path, ref string) ([]gitprovider.DirEntry, error) {
+	var entries []gitprovider.DirEntry
+	for p := range r {
+		entries = append(entries, gitprovider.DirEntry{Path: p, Type: "file"})
+	}
+	return entries, nil
+}
+
+func (r fakeRepo) SearchCode(ctx context.Context, query string) ([]gitprovider.SearchResult, error) {
+	return nil, nil
+}
+
+func TestAnthropicTool_GenerateFix(t *testing.T) {
+	var requests []apiRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" || r.Header.Get("x-api-key") != "key" || r.Header.Get("anthropic-version") == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var req apiRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("invalid request: %v", err)
+		}
+		requests = append(requests, req)
+
+		switch len(requests) {
+		case 1:
+			w.Write([]byte(`{"stop_reason": "tool_use", "usage": {"input_tokens": 100, "output_tokens": 20}, "content": [
+				{"type": "text", "text": "Let me look at the handler."},
+				{"type": "tool_use", "id": "t1", "name": "read_file", "input": {"path": "app/handler.py"}},
+				{"type": "tool_use", "id": "t2", "name": "read_file", "input": {"path": "missing.py"}}
+			]}`))
+		default:
+			w.Write([]byte(`{"stop_reason": "end_turn", "usage": {"input_tokens": 300, "cache_read_input_tokens": 50, "output_tokens": 40}, "content": [{"type": "text", "text": "` +
+				"```json\\n{\\\"success\\\": true, \\\"description\\\": \\\"guard nil user\\\", \\\"files\\\": [{\\\"path\\\": \\\"app/handler.py\\\", \\\"content\\\": \\\"fixed\\\", \\\"change_type\\\": \\\"modify\\\"}], \\\"pr_title\\\": \\\"fix: guard nil user\\\", \\\"confidence\\\": 0.8}\\n```" +
+				`"}]}`))
+		}
+	}))
+	defer server.Close()
+
+	repo := fakeRepo{"app/handler.py": "def handle(user):\n    return user.name\n"}
+	tool := NewAnthropicTool(repo, "main", AnthropicOptions{APIKey: "key", BaseURL: server.URL}, nil)
+
+	transcript := &Transcript{}
+	ctx := WithTranscript(context.Background(), transcript)
+	resp, err := tool.GenerateFix(ctx, &FixRequest{IssueID: "1", Title: "AttributeError", StyleGuide: "Use type hints."})
+	if err != nil {
+		t.Fatalf("GenerateFix() error = %v", err)
+	}
+	if !resp.Success || resp.PRTitle != "fix: guard nil user" || len(resp.Files) != 1 {
+		t.Errorf("GenerateFix() = %+v", resp)
+	}
+	if resp.InputTokens != 450 || resp.OutputTokens != 60 {
+		t.Errorf("GenerateFix() used %d input and %d output tokens, want 450 and 60", resp.InputTokens, resp.OutputTokens)
+	}
+
+	if len(requests) != 2 {
+		t.Fatalf("sent %d requests, want 2", len(requests))
+	}
+	first := requests[0]
+	if first.Model != DefaultAnthropicModel || len(first.Tools) == 0 || !strings.Contains(first.System, "Use type hints.") {
+		t.Errorf("first request = model %q, %d tools, system %q", first.Model, len(first.Tools), first.System)
+	}
+
+	// The tool results answer each call, reporting failures to the model
+	second := requests[1]
+	results := second.Messages[len(second.Messages)-1].Content
+	if len(results) != 2 {
+		t.Fatalf("got %d tool results, want 2", len(results))
+	}
+	if results[0].ToolUseID != "t1" || results[0].IsError || !strings.Contains(results[0].Content, "return user.name") {
+		t.Errorf("read_file result = %+v", results[0])
+	}
+	if results[1].ToolUseID != "t2" || !results[1].IsError {
+		t.Errorf("missing file result = %+v, want an error", results[1])
+	}
+
+	// The exchange is recorded for the audit trail, without tool results
+	exchanges := transcript.Exchanges()
+	if len(exchanges) != 1 {
+		t.Fatalf("recorded %d exchanges, want 1", len(exchanges))
+	}
+	e := exchanges[0]
+	if e.System != first.System || e.Prompt != first.Messages[0].Content[0].Text || e.Error != "" {
+		t.Errorf("exchange = %+v, want the first request's prompt", e)
+	}
+	if !strings.HasPrefix(e.Output, "Let me look at the handler.\n\n[read_file] {\"path\":\"app/handler.py\"}") || !strings.Contains(e.Output, "guard nil user") || strings.Contains(e.Output, "return user.name") {
+		t.Errorf("exchange output = %q", e.Output)
+	}
+}
+
+func TestAnthropicTool_GenerateFix_Correction(t *testing.T) {
+	var requests []apiRequest
+	reportAt := 3
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req apiRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		requests = append(requests, req)
+
+		text := `I added a nil check to the handler.`
+		if len(requests) == reportAt {
+			text = `{\"success\": true, \"description\": \"guard nil user\", \"files\": [{\"path\": \"app.py\", \"change_type\": \"delete\"}], \"confidence\": 0.9}`
+		}
+		w.Write([]byte(`{"stop_reason": "end_turn", "usage": {"input_tokens": 100, "output_tokens": 10}, "content": [{"type": "text", "text": "` + text + `"}]}`))
+	}))
+	defer server.Close()
+	tool := NewAnthropicTool(fakeRepo{}, "main", AnthropicOptions{APIKey: "key", BaseURL: server.URL}, nil)
+
+	resp, err := tool.GenerateFix(context.Background(), &FixRequest{IssueID: "1"})
+	if err != nil {
+		t.Fatalf("GenerateFix() error = %v", err)
+	}
+	if !resp.Success || resp.Description != "guard nil user" || resp.InputTokens != 300 {
+		t.Errorf("GenerateFix() = %+v, want the corrected report with every request's tokens", resp)
+	}
+	// Corrections continue the conversation
+	last := requests[len(requests)-1].Messages
+	if len(requests) != 3 || len(last) != 5 || !strings.Contains(last[4].Content[0].Text, "could not be read: no JSON fix report") {
+		t.Fatalf("sent %d requests, the last with messages %+v", len(requests), last)
+	}
+
+	// A model that never reports its fix fails the fix
+	requests, reportAt = nil, 0
+	resp, err = tool.GenerateFix(context.Background(), &FixRequest{IssueID: "1"})
+	if err != nil || resp.Success || len(requests) != 1+maxOutputCorrections {
+		t.Errorf("GenerateFix() = %+v, %v after %d requests; want a failed fix after %d", resp, err, len(requests), 1+maxOutputCorrections)
+	}
+}
+
+func TestAnthropicTool_Errors(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		wantTransient bool
+	}{
+		{"overloaded", 529, true},
+		{"rate limited", http.StatusTooManyRequests, true},
+		{"server error", http.StatusInternalServerError, true},
+		{"invalid request", http.StatusBadRequest, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(`{"type": "error", "error": {"type": "some_error", "message": "nope"}}`))
+			}))
+			defer server.Close()
+
+			tool := NewAnthropicTool(fakeRepo{}, "main", AnthropicOptions{APIKey: "key", BaseURL: server.URL}, nil)
+			_, err := tool.GenerateFix(context.Background(), &FixRequest{IssueID: "1"})
+			if err == nil || !strings.Contains(err.Error(), "nope") {
+				t.Fatalf("GenerateFix() error = %v, want the API error", err)
+			}
+			var transient *TransientError
+			if errors.As(err, &transient) != tt.wantTransient {
+				t.Errorf("transient = %v, want %v", !tt.wantTransient, tt.wantTransient)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// buildMarkers maps a file at the root of a repository to the command that
+// compiles it, in order of precedence.
+var buildMarkers = []struct {
+	file    string
+	command string
+}{
+	{"go.mod", "go build ./..."},
+	{"Cargo.toml", "cargo check --quiet"},
+	{"tsconfig.json", "npx --no-install tsc --noEmit"},
+	{"pom.xml", "mvn --batch-mode --quiet compile"},
+	{"gradlew", "./gradlew --quiet classes"},
+	{"build.gradle", "gradle --quiet classes"},
+	{"build.gradle.kts", "gradle --quiet classes"},
+}
+
+// syntaxCheckers maps the extension of a changed file to a command that
+// checks its syntax, for languages without a build step.
+var syntaxCheckers = map[string]string{
+	".py":  "python3 -m py_compile",
+	".js":  "node --check",
+	".mjs": "node --check",
+	".cjs": "node --check",
+	".rb":  "ruby -c",
+	".php": "php -l",
+}
+
+// DetectBuildCommand returns a command that checks the checkout at dir
+// compiles: its build tool's when the repository has one, otherwise syntax
+// checks of the changed files. It returns "" if it finds neither.
+func DetectBuildCommand(dir string, changed []FileChange) string {
+	for _, m := range buildMarkers {
+		if _, err := os.Stat(filepath.Join(dir, m.file)); err == nil {
+			return m.command
+		}
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "*.sln")); len(matches) > 0 {
+		return "dotnet build --nologo --verbosity quiet"
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "*.csproj")); len(matches) > 0 {
+		return "dotnet build --nologo --verbosity quiet"
+	}
+
+	var checks []string
+	for _, f := range changed {
+		checker, ok := syntaxCheckers[strings.ToLower(filepath.Ext(f.Path))]
+		if !ok || f.ChangeType == "delete" {
+			continue
+		}
+		checks = append(checks, checker+" "+shellQuote(strings.TrimPrefix(filepath.Clean("/"+f.Path), "/")))
+	}
+	return strings.Join(checks, " && ")
+}
+
+// Placeholders of a regression test command template.
+const (
+	// TestFilesPlaceholder is replaced by the regression test's files.
+	TestFilesPlaceholder = "{files}"
+	// TestFilterPlaceholder is replaced by the filter naming the test.
+	TestFilterPlaceholder = "{filter}"
+)
+
+// RegressionTestCommand fills in template, an operator's command running
+// some of a repository's tests, with the files of the changes marked Test
+// and filter, each quoted as shell words. It returns "" if no change is
+// marked Test, and an error if filter is needed but empty or a file or the
+// filter would be taken for an option.
+func RegressionTestCommand(template string, changed []FileChange, filter string) (string, error) {
+	var tests []FileChange
+	for _, f := range changed {
+		if f.Test {
+			tests = append(tests, f)
+		}
+	}
+	paths := changedPaths(tests)
+	if len(paths) == 0 {
+		return "", nil
+	}
+
+	quoted := make([]string, len(paths))
+	for i, path := range paths {
+		if strings.HasPrefix(path, "-") {
+			return "", fmt.Errorf("test file %q starts with a dash", path)
+		}
+		quoted[i] = shellQuote(path)
+	}
+	replacements := []string{TestFilesPlaceholder, strings.Join(quoted, " ")}
+	if strings.Contains(template, TestFilterPlaceholder) {
+		switch {
+		case filter == "":
+			return "", fmt.Errorf("no test filter given for %s", template)
+		case strings.HasPrefix(filter, "-"):
+			return "", fmt.Errorf("test filter %q starts with a dash", filter)
+		}
+		replacements = append(replacements, TestFilterPlaceholder, shellQuote(filter))
+	}
+	// In one pass, so nothing substituted is taken for a placeholder
+	command := strings.NewReplacer(replacements...).Replace(template)
+	return command, nil
+}
+
+// shellQuote quotes s as a single sh word.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
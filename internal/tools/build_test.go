@@ -0,0 +1,99 @@
+package tools
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetectBuildCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   []string
+		changed []FileChange
+		want    string
+	}{
+		{
+			name:  "go",
+			files: []string{"go.mod", "package.json"},
+			want:  "go build ./...",
+		},
+		{
+			name:  "typescript",
+			files: []string{"package.json", "tsconfig.json"},
+			want:  "npx --no-install tsc --noEmit",
+		},
+		{
+			name:  "gradle wrapper",
+			files: []string{"gradlew", "build.gradle"},
+			want:  "./gradlew --quiet classes",
+		},
+		{
+			name:  "dotnet",
+			files: []string{"App.csproj"},
+			want:  "dotnet build --nologo --verbosity quiet",
+		},
+		{
+			name:  "changed scripts",
+			files: []string{"requirements.txt"},
+			changed: []FileChange{
+				{Path: "app/it's.py", ChangeType: "modify"},
+				{Path: "README.md", ChangeType: "modify"},
+				{Path: "old.py", ChangeType: "delete"},
+				{Path: "web/main.js", ChangeType: "create"},
+			},
+			want: `python3 -m py_compile 'app/it'\''s.py' && node --check 'web/main.js'`,
+		},
+		{
+			name:    "nothing to check",
+			changed: []FileChange{{Path: "README.md", ChangeType: "modify"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, name := range tt.files {
+				os.WriteFile(filepath.Join(dir, name), nil, 0o644)
+			}
+			if got := DetectBuildCommand(dir, tt.changed); got != tt.want {
+				t.Errorf("DetectBuildCommand() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegressionTestCommand(t *testing.T) {
+	changed := []FileChange{
+		{Path: "app/views.py", ChangeType: "modify"},
+		{Path: "tests/test_views.py", ChangeType: "modify", Test: true},
+		{Path: "tests/it's {filter}.py", ChangeType: "create", Test: true},
+	}
+	tests := []struct {
+		name     string
+		template string
+		changed  []FileChange
+		filter   string
+		want     string
+		wantErr  bool
+	}{
+		{"files", "pytest {files}", changed, "", `pytest 'tests/test_views.py' 'tests/it'\''s {filter}.py'`, false},
+		{"filter", "go test ./... -run {filter}", changed, "TestX; rm -rf /", `go test ./... -run 'TestX; rm -rf /'`, false},
+		{"files and filter", "pytest {files} -k {filter}", changed[:2], "test_none", `pytest 'tests/test_views.py' -k 'test_none'`, false},
+		{"no test", "pytest {files}", changed[:1], "", "", false},
+		{"missing filter", "go test ./... -run {filter}", changed, "", "", true},
+		{"option filter", "go test ./... -run {filter}", changed, "-exec=sh", "", true},
+		{"option file", "pytest {files}", []FileChange{{Path: "-p.py", Test: true}}, "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RegressionTestCommand(tt.template, tt.changed, tt.filter)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RegressionTestCommand() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("RegressionTestCommand() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -5,29 +5,90 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
 
+// maxVarLength caps how much of each local variable is shown in the prompt.
+const maxVarLength = 200
+
+// maxHistoryPatchLength caps how much of each commit's diff of the culprit
+// file is shown in the prompt.
+const maxHistoryPatchLength = 2000
+
+// maxOutputCorrections is how often the model is asked to report its fix
+// again when its report can't be parsed.
+const maxOutputCorrections = 2
+
+// processWaitDelay bounds how long a killed subprocess's output is awaited.
+const processWaitDelay = 10 * time.Second
+
+// TransientError marks a failure that may succeed if retried, such as a
+// timeout or a network error.
+type TransientError struct {
+	Err error
+}
+
+func (e *TransientError) Error() string { return e.Err.Error() }
+
+func (e *TransientError) Unwrap() error { return e.Err }
+
 // ClaudeCodeTool wraps the Claude Code CLI for codebase analysis and fix generation.
 type ClaudeCodeTool struct {
-	workDir         string
-	maxRetries      int
-	timeout         time.Duration
-	anthropicAPIKey string
+	workDir    string
+	maxRetries int
+	timeout    time.Duration
+	opts       ClaudeCodeOptions
+	sessions   *Sessions
 }
 
-// NewClaudeCodeTool creates a new Claude Code tool.
-func NewClaudeCodeTool(workDir, anthropicAPIKey string) *ClaudeCodeTool {
+// ClaudeCodeOptions configures the Claude Code CLI invocation.
+type ClaudeCodeOptions struct {
+	// APIKey is passed to the CLI as ANTHROPIC_API_KEY; empty uses the CLI's
+	// own login.
+	APIKey string
+	// Model is passed as --model; empty uses the CLI default.
+	Model string
+	// MaxTurns caps the agent's turns (--max-turns); 0 uses the CLI default.
+	MaxTurns int
+	// AllowedTools are tool rules such as "Read" or "Bash(go test:*)" the
+	// agent may use without asking (--allowedTools).
+	AllowedTools []string
+	// PermissionMode is passed as --permission-mode, e.g. "acceptEdits". When
+	// empty, permission checks are skipped entirely.
+	PermissionMode string
+	// ExtraArgs are appended to the command line as is.
+	ExtraArgs []string
+	// Sandbox, if set, runs the CLI in a container instead of on the host.
+	Sandbox *DockerSandbox
+	// SubmitTool has the CLI report fixes by calling the submit_fix tool of
+	// an MCP server run for the session rather than as JSON at the end of
+	// its output. It doesn't apply with a Sandbox, which can't reach the
+	// server.
+	SubmitTool bool
+	// Limits bounds the CLI and the commands it runs. Only its Output
+	// limit applies with a Sandbox, which has limits of its own.
+	Limits ProcessLimits
+}
+
+// NewClaudeCodeTool creates a new Claude Code tool. Its sessions count
+// against sessions, which may be nil.
+func NewClaudeCodeTool(workDir string, opts ClaudeCodeOptions, sessions *Sessions) *ClaudeCodeTool {
 	return &ClaudeCodeTool{
-		workDir:         workDir,
-		maxRetries:      2,
-		timeout:         10 * time.Minute,
-		anthropicAPIKey: anthropicAPIKey,
+		workDir:    workDir,
+		maxRetries: 2,
+		timeout:    10 * time.Minute,
+		opts:       opts,
+		sessions:   sessions,
 	}
 }
 
@@ -40,18 +101,165 @@ type FixRequest struct {
 	Level        string  `json:"level"`
 	Platform     string  `json:"platform"`
 	Culprit      string  `json:"culprit"`
+	Release      string  `json:"release,omitempty"`
+	Environment  string  `json:"environment,omitempty"`
+	ServerName   string  `json:"server_name,omitempty"`
 	Stacktrace   []Frame `json:"stacktrace"`
 	Permalink    string  `json:"permalink"`
+
+	Request *HTTPRequest `json:"request,omitempty"`
+	// Contexts describe the runtime, OS, browser and device, keyed by
+	// context name.
+	Contexts map[string]string `json:"contexts,omitempty"`
+	// Breadcrumbs are the events leading up to the error, oldest first.
+	Breadcrumbs []Breadcrumb `json:"breadcrumbs,omitempty"`
+	// Minified is set when the stacktrace points at minified JavaScript.
+	Minified bool `json:"minified,omitempty"`
+
+	ReviewerFeedback []FeedbackTheme `json:"reviewer_feedback,omitempty"`
+	// PastOutcomes is how earlier automated fixes for the same error class
+	// in the repository ended.
+	PastOutcomes *PastOutcomes `json:"past_outcomes,omitempty"`
+	StyleGuide   string        `json:"style_guide,omitempty"`
+
+	// SourceFiles is the repository code around the in-app frames.
+	SourceFiles []SourceFile `json:"source_files,omitempty"`
+	// CulpritHistory is the latest commits touching the file the error was
+	// raised in.
+	CulpritHistory *FileHistory `json:"culprit_history,omitempty"`
+	// RegressionTest asks for a test reproducing the error alongside the fix.
+	RegressionTest bool `json:"regression_test,omitempty"`
+	// RegressionTestCommand is the repository's command template the test
+	// is run with; see RegressionTestCommand.
+	RegressionTestCommand string `json:"regression_test_command,omitempty"`
+	// Revision is a review of an earlier fix for the error that requested
+	// changes.
+	Revision *Revision `json:"revision,omitempty"`
+	// FailedAttempt is an earlier fix for the error that failed to build or
+	// pass the tests.
+	FailedAttempt *FailedAttempt `json:"failed_attempt,omitempty"`
+	// AllowedPaths and DeniedPaths are globs of the files the fix may and
+	// may not change.
+	AllowedPaths []string `json:"allowed_paths,omitempty"`
+	DeniedPaths  []string `json:"denied_paths,omitempty"`
+	// DiffFormat asks for modified files as unified diffs instead of their
+	// full content.
+	DiffFormat bool `json:"diff_format,omitempty"`
+	// Instructions are the maintainers' notes for every fix in the
+	// repository, such as conventions and code not to touch.
+	Instructions []Instructions `json:"instructions,omitempty"`
+}
+
+// Instructions are notes from a repository's maintainers, from its prompt
+// template or a file such as .autofix.md.
+type Instructions struct {
+	Source string `json:"source"`
+	Text   string `json:"text"`
+}
+
+// Revision is reviewer feedback on an earlier fix.
+type Revision struct {
+	Diff     string `json:"diff"`
+	Feedback string `json:"feedback"`
+}
+
+// FailedAttempt is an earlier fix that failed a check, with the check's
+// output.
+type FailedAttempt struct {
+	Diff   string `json:"diff"`
+	Error  string `json:"error"`
+	Output string `json:"output"`
+}
+
+// FeedbackTheme is recurring reviewer feedback from previous fixes in the repo.
+type FeedbackTheme struct {
+	Text  string `json:"text"`
+	Count int    `json:"count"`
+}
+
+// PastOutcomes counts the earlier automated fixes for an error class that
+// were merged and rejected, with the latest rejections.
+type PastOutcomes struct {
+	Merged     int           `json:"merged"`
+	Rejected   int           `json:"rejected"`
+	Rejections []RejectedFix `json:"rejections,omitempty"`
+}
+
+// RejectedFix is an earlier automated fix that was closed unmerged or
+// reverted after merging, with the reviewers' reason if they gave one.
+type RejectedFix struct {
+	Title    string `json:"title"`
+	Reverted bool   `json:"reverted,omitempty"`
+	Reason   string `json:"reason,omitempty"`
 }
 
 // Frame represents a stacktrace frame.
 type Frame struct {
-	Filename string `json:"filename"`
-	Function string `json:"function"`
-	LineNo   int    `json:"line_no"`
-	ColNo    int    `json:"col_no"`
-	InApp    bool   `json:"in_app"`
-	Module   string `json:"module,omitempty"`
+	Filename string                 `json:"filename"`
+	Function string                 `json:"function"`
+	LineNo   int                    `json:"line_no"`
+	ColNo    int                    `json:"col_no"`
+	InApp    bool                   `json:"in_app"`
+	Module   string                 `json:"module,omitempty"`
+	Package  string                 `json:"package,omitempty"`
+	Context  []SourceLine           `json:"context,omitempty"`
+	Vars     map[string]interface{} `json:"vars,omitempty"`
+	Minified bool                   `json:"minified,omitempty"`
+}
+
+// HTTPRequest is the request that was being handled when the error occurred.
+type HTTPRequest struct {
+	Method  string  `json:"method"`
+	URL     string  `json:"url"`
+	Query   []Param `json:"query,omitempty"`
+	Headers []Param `json:"headers,omitempty"`
+}
+
+// Breadcrumb is an event recorded before the error, such as an HTTP
+// request, a database query or a log message.
+type Breadcrumb struct {
+	// Time is the time of day in UTC, empty if unknown.
+	Time     string                 `json:"time,omitempty"`
+	Category string                 `json:"category,omitempty"`
+	Level    string                 `json:"level,omitempty"`
+	Message  string                 `json:"message,omitempty"`
+	Data     map[string]interface{} `json:"data,omitempty"`
+}
+
+// Param is a query parameter or header.
+type Param struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// SourceLine is a numbered line of source code around a frame.
+type SourceLine struct {
+	LineNo int    `json:"line_no"`
+	Code   string `json:"code"`
+}
+
+// SourceFile is an excerpt of a repository file the stacktrace points at.
+type SourceFile struct {
+	Path  string       `json:"path"`
+	Lines []SourceLine `json:"lines"`
+	// FrameLines are the lines stacktrace frames point at.
+	FrameLines []int `json:"frame_lines"`
+}
+
+// FileHistory is the latest commits touching a file, newest first.
+type FileHistory struct {
+	Path    string          `json:"path"`
+	Commits []HistoryCommit `json:"commits"`
+}
+
+// HistoryCommit is a commit in a file's history.
+type HistoryCommit struct {
+	SHA     string `json:"sha"`
+	Message string `json:"message"`
+	Author  string `json:"author"`
+	Date    string `json:"date"`
+	// Patch is the commit's diff of the file.
+	Patch string `json:"patch,omitempty"`
 }
 
 // FixResponse contains the fix generated by Claude Code.
@@ -62,6 +270,27 @@ type FixResponse struct {
 	PRTitle     string       `json:"pr_title"`
 	PRBody      string       `json:"pr_body"`
 	Error       string       `json:"error,omitempty"`
+	// TestFilter selects the regression test added with the fix among the
+	// tests in its files, filling in the RegressionTestCommand's {filter}.
+	TestFilter string `json:"test_filter,omitempty"`
+	// Confidence is the model's estimate, from 0 to 1, that the fix is
+	// correct; 0 if it gave none.
+	Confidence float64 `json:"confidence"`
+	// RootCause, FixExplanation, RiskLevel ("low", "medium" or "high") and
+	// RiskReason, Affected and TestingNotes make up the pull request's
+	// description.
+	RootCause      string `json:"root_cause,omitempty"`
+	FixExplanation string `json:"fix_explanation,omitempty"`
+	RiskLevel      string `json:"risk_level,omitempty"`
+	RiskReason     string `json:"risk_reason,omitempty"`
+	Affected       string `json:"affected,omitempty"`
+	TestingNotes   string `json:"testing_notes,omitempty"`
+
+	// CostUSD is what the Claude Code session cost, if the CLI reported it.
+	CostUSD float64 `json:"-"`
+	// InputTokens and OutputTokens are the tokens the session used.
+	InputTokens  int `json:"-"`
+	OutputTokens int `json:"-"`
 }
 
 // FileChange represents a file modification.
@@ -69,18 +298,100 @@ type FileChange struct {
 	Path       string `json:"path"`
 	Content    string `json:"content"`
 	ChangeType string `json:"change_type"` // "modify", "create", "delete"
+	// Test marks the files of a regression test added with the fix.
+	Test bool `json:"test,omitempty"`
+	// Diff is the change to a modified file as a unified diff, given
+	// instead of Content with FixRequest.DiffFormat; see ApplyPatch.
+	Diff string `json:"diff,omitempty"`
 }
 
 // GenerateFix uses Claude Code to analyze the error and generate a fix.
 func (c *ClaudeCodeTool) GenerateFix(ctx context.Context, req *FixRequest) (*FixResponse, error) {
+	// Have Claude Code submit its report through a tool call where the
+	// submission server is reachable
+	instructions, mcpConfig := outputInstructions(req), ""
+	var submit *submitServer
+	if c.opts.SubmitTool && c.opts.Sandbox == nil {
+		var err error
+		if submit, err = startSubmitServer(); err != nil {
+			return nil, err
+		}
+		defer submit.Close()
+		instructions, mcpConfig = submitInstructions(req), submit.config()
+	}
+
 	// Build the prompt for Claude Code
-	prompt := c.buildPrompt(req)
+	prompt := buildPrompt(req)
+
+	fullPrompt := prompt + "\n\n" + instructions
 
-	// Create a temporary file for the output format instructions
-	outputInstructions := `
+	// Run Claude Code
+	output, err := c.runClaudeCode(ctx, req.IssueID, fullPrompt, buildSystemPrompt(req), "", mcpConfig)
+	if err != nil {
+		return nil, err
+	}
+	if output.Subtype == "error_max_turns" {
+		return &FixResponse{
+			Success:      false,
+			Error:        fmt.Sprintf("Claude Code reached its limit of %d turns before finishing", c.opts.MaxTurns),
+			CostUSD:      output.CostUSD,
+			InputTokens:  output.InputTokens,
+			OutputTokens: output.OutputTokens,
+		}, nil
+	}
+
+	// Parse the response, asking Claude to report the fix again if it can't
+	// be parsed
+	resp, err := submit.submitted(output)
+	costUSD, inputTokens, outputTokens := output.CostUSD, output.InputTokens, output.OutputTokens
+	for correction := 1; err != nil && correction <= maxOutputCorrections && c.canResume(output); correction++ {
+		log.Printf("Fix report for issue %s is malformed (%v), asking Claude Code for it again (%d/%d)", req.IssueID, err, correction, maxOutputCorrections)
+		output, err = c.runClaudeCode(ctx, req.IssueID, correctionPrompt(err, instructions), buildSystemPrompt(req), output.SessionID, mcpConfig)
+		if err != nil {
+			return nil, err
+		}
+		costUSD += output.CostUSD
+		inputTokens += output.InputTokens
+		outputTokens += output.OutputTokens
+		resp, err = submit.submitted(output)
+	}
+	if err != nil {
+		resp = &FixResponse{Success: false, Error: err.Error()}
+	}
+	resp.CostUSD = costUSD
+	resp.InputTokens, resp.OutputTokens = inputTokens, outputTokens
+	return resp, nil
+}
+
+// canResume reports whether the session that produced output can be
+// continued. Sandboxed sessions are stored in their removed container.
+func (c *ClaudeCodeTool) canResume(output *cliOutput) bool {
+	return output.SessionID != "" && c.opts.Sandbox == nil
+}
+
+// fixOutputInstructions tells the model how to report its fix.
+const fixOutputInstructions = `
 After analyzing and fixing the error, output your changes in the following JSON format (and nothing else after the JSON):
 
-` + "```json" + `
+` + fixReportFormat + `
+
+If you cannot fix the issue, output:
+` + failureReportFormat
+
+// submitOutputInstructions tells the model how to report its fix through the
+// submit_fix tool.
+const submitOutputInstructions = `
+After analyzing and fixing the error, report your changes by calling the ` + submitToolName + ` tool once, with arguments in the following format, instead of printing them:
+
+` + fixReportFormat + `
+
+If you cannot fix the issue, call ` + submitToolName + ` with:
+` + failureReportFormat + `
+
+If the tool rejects your report, correct it as it says and call the tool again.`
+
+// fixReportFormat describes the report of a fix.
+const fixReportFormat = "```json" + `
 {
   "success": true,
   "description": "Brief description of what was fixed",
@@ -92,39 +403,138 @@ After analyzing and fixing the error, output your changes in the following JSON
     }
   ],
   "pr_title": "fix: Concise title for the PR",
-  "pr_body": "## Summary\n\nDescription of the fix\n\n## Changes\n\n- List of changes\n\n## Root Cause\n\nExplanation of what caused the issue"
+  "root_cause": "What caused the error and under which conditions it happens",
+  "fix_explanation": "How the changes fix it, file by file if there are several",
+  "risk_level": "low",
+  "risk_reason": "What the change could break, and why that is unlikely or not",
+  "affected": "The endpoints, jobs or users the error affects",
+  "testing_notes": "How the fix was tested, and what a reviewer should check by hand",
+  "confidence": 0.8
 }
 ` + "```" + `
 
-If you cannot fix the issue, output:
-` + "```json" + `
+"confidence" is required: your honest estimate, from 0 to 1, that the fix is correct and complete. Use a low value when you had to guess at the root cause or could not see the failing code.
+
+"risk_level" is "low", "medium" or "high": low for a local guard or correction that cannot change behavior beyond the error, medium for changes to shared code or behavior callers may rely on, high for changes to data handling, authentication, concurrency or public APIs. The other fields are Markdown for the pull request's description; keep each to a few sentences or a short list.`
+
+// failureReportFormat describes the report of a fix that couldn't be made.
+const failureReportFormat = "```json" + `
 {
   "success": false,
   "error": "Explanation of why the fix couldn't be generated"
 }
 ` + "```"
 
-	fullPrompt := prompt + "\n\n" + outputInstructions
+// diffOutputInstructions asks for modified files as diffs, after
+// fixOutputInstructions.
+const diffOutputInstructions = `
 
-	// Run Claude Code
-	output, err := c.runClaudeCode(ctx, fullPrompt)
-	if err != nil {
-		return &FixResponse{
-			Success: false,
-			Error:   fmt.Sprintf("Claude Code execution failed: %v", err),
-		}, nil
-	}
+Give each modified file's change as "diff" instead of "content": a unified diff of the file against its version in the repository, with ` + "`@@`" + ` hunk headers and up to 3 lines of unchanged context around each change, for example:
+
+` + "```json" + `
+{
+  "path": "relative/path/to/file.go",
+  "diff": "@@ -10,3 +10,6 @@ func handle() {\n \tuser := load()\n-\treturn user.Name\n+\tif user == nil {\n+\t\treturn \"\"\n+\t}\n+\treturn user.Name\n }",
+  "change_type": "modify"
+}
+` + "```" + `
 
-	// Parse the response
-	return c.parseResponse(output)
+Give the complete "content" only for created files.`
+
+// correctionPrompt asks the model to report its fix again, as instructions
+// say, after problem made its report unreadable.
+func correctionPrompt(problem error, instructions string) string {
+	return fmt.Sprintf("Your fix report could not be read: %v. Do not change anything further; report the same fix again.\n", problem) + instructions
 }
 
-// buildPrompt constructs the prompt for Claude Code.
-func (c *ClaudeCodeTool) buildPrompt(req *FixRequest) string {
+// outputInstructions tells the model how to report its fix to req.
+func outputInstructions(req *FixRequest) string {
+	return withDiffInstructions(req, fixOutputInstructions)
+}
+
+// submitInstructions tells the model how to report its fix to req through
+// the submit_fix tool.
+func submitInstructions(req *FixRequest) string {
+	return withDiffInstructions(req, submitOutputInstructions)
+}
+
+func withDiffInstructions(req *FixRequest, instructions string) string {
+	if req.DiffFormat {
+		return instructions + diffOutputInstructions
+	}
+	return instructions
+}
+
+// buildPrompt constructs the prompt describing the error to fix.
+func buildPrompt(req *FixRequest) string {
 	var sb strings.Builder
 
 	sb.WriteString("I need you to analyze and fix a production error. Here are the details:\n\n")
+	writeErrorReport(&sb, req)
+
+	if req.Revision != nil {
+		sb.WriteString("\n## Review of a Previous Attempt\n")
+		sb.WriteString("A reviewer requested changes to an earlier fix for this error. Address their feedback in your fix.\n\n")
+		sb.WriteString(req.Revision.Feedback + "\n")
+		if req.Revision.Diff != "" {
+			sb.WriteString("\nThe earlier fix:\n```diff\n" + req.Revision.Diff + "```\n")
+		}
+	}
+
+	if req.FailedAttempt != nil {
+		sb.WriteString("\n## Failure of a Previous Attempt\n")
+		sb.WriteString(fmt.Sprintf("An earlier fix for this error was rejected: %s. Write a fix that avoids the failure.\n", req.FailedAttempt.Error))
+		if req.FailedAttempt.Output != "" {
+			sb.WriteString("\nOutput:\n```\n" + req.FailedAttempt.Output + "\n```\n")
+		}
+		if req.FailedAttempt.Diff != "" {
+			sb.WriteString("\nThe earlier fix:\n```diff\n" + req.FailedAttempt.Diff + "```\n")
+		}
+	}
+
+	sb.WriteString("\n## Instructions\n")
+	sb.WriteString("1. Explore the codebase to understand the context around this error\n")
+	sb.WriteString("2. Focus on files marked [IN APP] in the stacktrace\n")
+	sb.WriteString("3. Identify the root cause of the error\n")
+	sb.WriteString("4. Implement a fix that:\n")
+	sb.WriteString("   - Addresses the root cause (not just symptoms)\n")
+	sb.WriteString("   - Follows existing code patterns and style\n")
+	sb.WriteString("   - Includes appropriate error handling\n")
+	sb.WriteString("   - Is minimal and focused\n")
+	sb.WriteString("5. Provide complete file contents for any modified files\n")
+
+	writePlatformGuide(&sb, req)
+
+	if req.RegressionTest {
+		sb.WriteString("\n## Regression Test\n")
+		sb.WriteString("Also add a test that reproduces this error, following the repository's existing tests. It must fail without your fix and pass with it. ")
+		sb.WriteString("Mark the test's files with `\"test\": true` in the `files` list.")
+		if command := req.RegressionTestCommand; command != "" {
+			sb.WriteString(" The test is run from the repository root with `" + command + "`, where `" + TestFilesPlaceholder + "` are its files.")
+			if strings.Contains(command, TestFilterPlaceholder) {
+				sb.WriteString(" Add a `\"test_filter\"` field to the JSON with what replaces `" + TestFilterPlaceholder + "` to run only this test, such as its name.")
+			}
+		}
+		sb.WriteString("\n")
+	}
+
+	if len(req.AllowedPaths) > 0 || len(req.DeniedPaths) > 0 {
+		sb.WriteString("\n## Restricted Paths\n")
+		sb.WriteString("Fixes that change other files are rejected. In these globs, `**` matches any number of directories and a trailing `/` everything in a directory.\n")
+		if len(req.AllowedPaths) > 0 {
+			sb.WriteString("- Only change files matching: `" + strings.Join(req.AllowedPaths, "`, `") + "`\n")
+		}
+		if len(req.DeniedPaths) > 0 {
+			sb.WriteString("- Never change files matching: `" + strings.Join(req.DeniedPaths, "`, `") + "`\n")
+		}
+	}
 
+	return sb.String()
+}
+
+// writeErrorReport adds the error's details, stacktrace, code and HTTP
+// request, and reviewer feedback on previous fixes in the repository.
+func writeErrorReport(sb *strings.Builder, req *FixRequest) {
 	sb.WriteString(fmt.Sprintf("## Error Information\n"))
 	sb.WriteString(fmt.Sprintf("- **Issue ID**: %s\n", req.IssueID))
 	sb.WriteString(fmt.Sprintf("- **Title**: %s\n", req.Title))
@@ -134,6 +544,26 @@ func (c *ClaudeCodeTool) buildPrompt(req *FixRequest) string {
 	sb.WriteString(fmt.Sprintf("- **Platform**: %s\n", req.Platform))
 	sb.WriteString(fmt.Sprintf("- **Culprit**: %s\n", req.Culprit))
 
+	if req.Release != "" {
+		sb.WriteString(fmt.Sprintf("- **Release**: %s\n", req.Release))
+	}
+	if req.Environment != "" {
+		sb.WriteString(fmt.Sprintf("- **Environment**: %s\n", req.Environment))
+	}
+	if req.ServerName != "" {
+		sb.WriteString(fmt.Sprintf("- **Server**: %s\n", req.ServerName))
+	}
+	for _, c := range []struct{ key, label string }{
+		{"runtime", "Runtime"},
+		{"os", "OS"},
+		{"browser", "Browser"},
+		{"device", "Device"},
+	} {
+		if value := req.Contexts[c.key]; value != "" {
+			sb.WriteString(fmt.Sprintf("- **%s**: %s\n", c.label, value))
+		}
+	}
+
 	if req.Permalink != "" {
 		sb.WriteString(fmt.Sprintf("- **Sentry Link**: %s\n", req.Permalink))
 	}
@@ -145,177 +575,355 @@ func (c *ClaudeCodeTool) buildPrompt(req *FixRequest) string {
 			if frame.InApp {
 				inApp = " [IN APP]"
 			}
+			if frame.Minified {
+				inApp += " [MINIFIED]"
+			}
 			sb.WriteString(fmt.Sprintf("%d. `%s:%d` in `%s`%s\n",
 				i+1, frame.Filename, frame.LineNo, frame.Function, inApp))
+			if frame.InApp {
+				writeFrameDetails(sb, frame)
+			}
 		}
 	}
 
-	sb.WriteString("\n## Instructions\n")
-	sb.WriteString("1. Explore the codebase to understand the context around this error\n")
-	sb.WriteString("2. Focus on files marked [IN APP] in the stacktrace\n")
-	sb.WriteString("3. Identify the root cause of the error\n")
-	sb.WriteString("4. Implement a fix that:\n")
-	sb.WriteString("   - Addresses the root cause (not just symptoms)\n")
-	sb.WriteString("   - Follows existing code patterns and style\n")
-	sb.WriteString("   - Includes appropriate error handling\n")
-	sb.WriteString("   - Is minimal and focused\n")
-	sb.WriteString("5. Provide complete file contents for any modified files\n")
+	if req.Minified {
+		sb.WriteString("\nFrames marked [MINIFIED] point at built JavaScript bundles. Do not edit bundle or build output; locate the original source the bundle was built from and fix it there.\n")
+	}
+
+	if len(req.SourceFiles) > 0 {
+		sb.WriteString("\n## Source Code\n")
+		sb.WriteString("The repository code around the [IN APP] frames, with the lines they point at marked. Start from it rather than searching for these files:\n")
+		for _, file := range req.SourceFiles {
+			writeSourceFile(sb, file)
+		}
+	}
+
+	if req.CulpritHistory != nil && len(req.CulpritHistory.Commits) > 0 {
+		sb.WriteString("\n## Recent Changes to the Culprit File\n")
+		sb.WriteString(fmt.Sprintf("The latest commits touching `%s`, newest first. If one of them introduced the error, fix the regression rather than its symptoms:\n", req.CulpritHistory.Path))
+		for _, commit := range req.CulpritHistory.Commits {
+			writeHistoryCommit(sb, commit)
+		}
+	}
+
+	if req.Request != nil {
+		sb.WriteString("\n## HTTP Request\n")
+		sb.WriteString(fmt.Sprintf("- **Request**: `%s %s`\n", req.Request.Method, req.Request.URL))
+		if len(req.Request.Query) > 0 {
+			sb.WriteString("- **Query Parameters**:\n")
+			for _, p := range req.Request.Query {
+				sb.WriteString(fmt.Sprintf("  - `%s` = `%s`\n", p.Name, truncate(p.Value, maxVarLength)))
+			}
+		}
+		if len(req.Request.Headers) > 0 {
+			sb.WriteString("- **Headers**:\n")
+			for _, p := range req.Request.Headers {
+				sb.WriteString(fmt.Sprintf("  - `%s: %s`\n", p.Name, truncate(p.Value, maxVarLength)))
+			}
+		}
+	}
+
+	if len(req.Breadcrumbs) > 0 {
+		sb.WriteString("\n## Breadcrumbs\n")
+		sb.WriteString("What happened before the error, oldest first. Use it to work out the state and input that led to the error:\n")
+		for _, crumb := range req.Breadcrumbs {
+			writeBreadcrumb(sb, crumb)
+		}
+	}
+
+	if len(req.ReviewerFeedback) > 0 {
+		sb.WriteString("\n## Reviewer Feedback From Previous Fixes\n")
+		sb.WriteString("Reviewers of this repository have given the following feedback on earlier automated fixes. Follow it:\n")
+		for _, fb := range req.ReviewerFeedback {
+			if fb.Count > 1 {
+				sb.WriteString(fmt.Sprintf("- %s (raised %d times)\n", oneLine(fb.Text), fb.Count))
+			} else {
+				sb.WriteString(fmt.Sprintf("- %s\n", oneLine(fb.Text)))
+			}
+		}
+	}
+
+	if req.PastOutcomes != nil && req.PastOutcomes.Rejected > 0 {
+		writePastOutcomes(sb, req.ErrorType, req.PastOutcomes)
+	}
+}
+
+// writePastOutcomes writes how earlier fixes for the error class ended, so
+// the model avoids the approaches reviewers turned down.
+func writePastOutcomes(sb *strings.Builder, errorType string, outcomes *PastOutcomes) {
+	sb.WriteString("\n## Outcomes of Previous Fixes\n")
+	sb.WriteString(fmt.Sprintf("Of the earlier automated fixes for %s in this repository, %d were merged and %d were rejected. ",
+		errorType, outcomes.Merged, outcomes.Rejected))
+	sb.WriteString("Avoid repeating what got them rejected:\n")
+	for _, r := range outcomes.Rejections {
+		verdict := "closed without merging"
+		if r.Reverted {
+			verdict = "reverted after merging"
+		}
+		if r.Reason != "" {
+			sb.WriteString(fmt.Sprintf("- **%s** was %s: %s\n", oneLine(r.Title), verdict, truncate(oneLine(r.Reason), maxVarLength)))
+		} else {
+			sb.WriteString(fmt.Sprintf("- **%s** was %s\n", oneLine(r.Title), verdict))
+		}
+	}
+}
 
+// buildSystemPrompt constructs the text appended to the system prompt.
+func buildSystemPrompt(req *FixRequest) string {
+	var sb strings.Builder
+	if req.StyleGuide != "" {
+		sb.WriteString("This repository has a style and conventions guide. ")
+		sb.WriteString("All code you write must follow it:\n\n")
+		sb.WriteString(req.StyleGuide)
+	}
+	for _, in := range req.Instructions {
+		if sb.Len() > 0 {
+			sb.WriteString("\n\n")
+		}
+		sb.WriteString(fmt.Sprintf("The repository's maintainers give these instructions for every fix (from %s). ", in.Source))
+		sb.WriteString("Follow them:\n\n")
+		sb.WriteString(in.Text)
+	}
 	return sb.String()
 }
 
-// runClaudeCode executes the Claude Code CLI.
-func (c *ClaudeCodeTool) runClaudeCode(ctx context.Context, prompt string) (string, error) {
+// writeSourceFile adds an excerpt of a repository file, marking the lines
+// frames point at.
+func writeSourceFile(sb *strings.Builder, file SourceFile) {
+	if len(file.Lines) == 0 {
+		return
+	}
+	sb.WriteString(fmt.Sprintf("\n### `%s` (lines %d-%d)\n", file.Path, file.Lines[0].LineNo, file.Lines[len(file.Lines)-1].LineNo))
+	sb.WriteString("```\n")
+	for i, line := range file.Lines {
+		// Excerpts of the same file are separated by a gap
+		if i > 0 && line.LineNo != file.Lines[i-1].LineNo+1 {
+			sb.WriteString("   ...\n")
+		}
+		marker := " "
+		if slices.Contains(file.FrameLines, line.LineNo) {
+			marker = ">"
+		}
+		sb.WriteString(fmt.Sprintf("%s%5d | %s\n", marker, line.LineNo, line.Code))
+	}
+	sb.WriteString("```\n")
+}
+
+// writeBreadcrumb adds a breadcrumb as a list item.
+func writeBreadcrumb(sb *strings.Builder, crumb Breadcrumb) {
+	sb.WriteString("-")
+	if crumb.Time != "" {
+		sb.WriteString(fmt.Sprintf(" `%s`", crumb.Time))
+	}
+	if crumb.Category != "" {
+		sb.WriteString(fmt.Sprintf(" [%s]", crumb.Category))
+	}
+	if crumb.Level != "" && crumb.Level != "info" {
+		sb.WriteString(fmt.Sprintf(" (%s)", crumb.Level))
+	}
+	if crumb.Message != "" {
+		sb.WriteString(" " + truncate(oneLine(crumb.Message), maxVarLength))
+	}
+	if len(crumb.Data) > 0 {
+		if data, err := json.Marshal(crumb.Data); err == nil {
+			sb.WriteString(fmt.Sprintf(" `%s`", truncate(string(data), maxVarLength)))
+		}
+	}
+	sb.WriteString("\n")
+}
+
+// writeHistoryCommit adds a commit from a file's history with its diff of
+// the file.
+func writeHistoryCommit(sb *strings.Builder, commit HistoryCommit) {
+	subject, _, _ := strings.Cut(commit.Message, "\n")
+	sb.WriteString(fmt.Sprintf("\n### `%s` %s\n", commit.SHA[:min(7, len(commit.SHA))], oneLine(subject)))
+	sb.WriteString(fmt.Sprintf("By %s on %s\n", commit.Author, commit.Date))
+	if commit.Patch != "" {
+		sb.WriteString("```diff\n")
+		sb.WriteString(truncate(commit.Patch, maxHistoryPatchLength))
+		sb.WriteString("\n```\n")
+	}
+}
+
+// writeFrameDetails adds the source context and local variables captured for
+// a frame.
+func writeFrameDetails(sb *strings.Builder, frame Frame) {
+	if len(frame.Context) > 0 {
+		sb.WriteString("   ```\n")
+		for _, line := range frame.Context {
+			marker := " "
+			if line.LineNo == frame.LineNo {
+				marker = ">"
+			}
+			sb.WriteString(fmt.Sprintf("   %s%5d | %s\n", marker, line.LineNo, line.Code))
+		}
+		sb.WriteString("   ```\n")
+	}
+
+	if len(frame.Vars) > 0 {
+		names := make([]string, 0, len(frame.Vars))
+		for name := range frame.Vars {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		sb.WriteString("   Local variables:\n")
+		for _, name := range names {
+			value, err := json.Marshal(frame.Vars[name])
+			if err != nil {
+				continue
+			}
+			sb.WriteString(fmt.Sprintf("   - `%s` = `%s`\n", name, truncate(string(value), maxVarLength)))
+		}
+	}
+}
+
+// oneLine collapses whitespace so multi-line text fits in a list item.
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// truncate shortens s to at most n bytes, marking the cut with an ellipsis.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
+
+// runClaudeCode executes the Claude Code CLI, continuing the session resume
+// if it isn't empty and connecting it to the MCP servers of mcpConfig if
+// that isn't.
+func (c *ClaudeCodeTool) runClaudeCode(ctx context.Context, issueID, prompt, systemPrompt, resume, mcpConfig string) (*cliOutput, error) {
+	// The session timeout starts once a slot is free
+	release, ok := c.sessions.TryAcquire()
+	if !ok {
+		log.Printf("Waiting for a free Claude Code session")
+		var err error
+		if release, err = c.sessions.Acquire(ctx); err != nil {
+			return nil, fmt.Errorf("no free Claude Code session: %w", err)
+		}
+	}
+	defer release()
+
 	ctx, cancel := context.WithTimeout(ctx, c.timeout)
 	defer cancel()
 
 	// Write prompt to a temp file to avoid shell escaping issues
 	promptFile, err := os.CreateTemp("", "claude-prompt-*.txt")
 	if err != nil {
-		return "", fmt.Errorf("failed to create prompt file: %w", err)
+		return nil, fmt.Errorf("failed to create prompt file: %w", err)
 	}
 	defer os.Remove(promptFile.Name())
 
 	if _, err := promptFile.WriteString(prompt); err != nil {
-		return "", fmt.Errorf("failed to write prompt: %w", err)
+		return nil, fmt.Errorf("failed to write prompt: %w", err)
 	}
 	promptFile.Close()
 
-	// Build the claude command
-	// Using --print flag for non-interactive output
-	cmd := exec.CommandContext(ctx, "claude",
-		"--print",                        // Print response and exit
-		"--dangerously-skip-permissions", // Allow file operations without prompts
-	)
+	runCtx, limitOutput, cancelRun := c.opts.Limits.limitOutput(ctx)
+	defer cancelRun()
+	var cmd *exec.Cmd
+	if c.opts.Sandbox != nil {
+		command := append([]string{"claude"}, c.args(systemPrompt, resume, mcpConfig)...)
+		cmd = c.opts.Sandbox.command(runCtx, "claude", c.workDir, []string{"ANTHROPIC_API_KEY"}, command)
+	} else {
+		cmd = limitedCommand(runCtx, c.opts.Limits, "claude", c.args(systemPrompt, resume, mcpConfig)...)
+		killProcessTree(cmd)
+	}
 
 	// Set working directory to the repo
 	cmd.Dir = c.workDir
 
 	// Set up environment with API key if provided
 	cmd.Env = os.Environ()
-	if c.anthropicAPIKey != "" {
-		cmd.Env = append(cmd.Env, "ANTHROPIC_API_KEY="+c.anthropicAPIKey)
+	if c.opts.APIKey != "" {
+		cmd.Env = append(cmd.Env, "ANTHROPIC_API_KEY="+c.opts.APIKey)
+	}
+	removeTemp, err := withTempDir(cmd)
+	if err != nil {
+		return nil, err
 	}
+	defer removeTemp()
 
 	// Pipe the prompt via stdin
 	promptContent, _ := os.ReadFile(promptFile.Name())
 	cmd.Stdin = bytes.NewReader(promptContent)
 
-	// Capture output
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	// Parse events as they arrive to report progress
+	stdout := newStreamParser(issueID)
+	var stderr bytes.Buffer
+	cmd.Stdout = limitOutput(stdout)
+	cmd.Stderr = limitOutput(&stderr)
 
 	// Run the command
-	err = cmd.Run()
+	err = runProcessTree(cmd)
+	output := stdout.result()
+	recordExchange(ctx, systemPrompt, prompt, stdout.modelOutput(), err)
+	if err != nil && output.Subtype == "error_max_turns" {
+		return output, nil
+	}
 	if err != nil {
 		// Check if it's a timeout
 		if ctx.Err() == context.DeadlineExceeded {
-			return "", fmt.Errorf("Claude Code timed out after %v", c.timeout)
+			return nil, &TransientError{Err: fmt.Errorf("Claude Code timed out after %v", c.timeout)}
+		}
+		if context.Cause(runCtx) == ErrOutputLimit {
+			return nil, fmt.Errorf("Claude Code wrote more than %d bytes: %w", c.opts.Limits.Output, ErrOutputLimit)
+		}
+		err = fmt.Errorf("Claude Code failed: %w\nstderr: %s", err, stderr.String())
+		if errors.Is(err, exec.ErrNotFound) {
+			return nil, err
 		}
-		return "", fmt.Errorf("Claude Code failed: %v\nstderr: %s", err, stderr.String())
+		// Most failures are API errors such as overload or rate limiting
+		return nil, &TransientError{Err: err}
 	}
 
-	return stdout.String(), nil
+	return output, nil
 }
 
-// parseResponse extracts the JSON fix response from Claude Code output.
-func (c *ClaudeCodeTool) parseResponse(output string) (*FixResponse, error) {
-	// Find JSON block in the output
-	jsonStr := extractJSON(output)
-	if jsonStr == "" {
-		return &FixResponse{
-			Success: false,
-			Error:   "No valid JSON response found in Claude Code output",
-		}, nil
+// args builds the claude command line.
+func (c *ClaudeCodeTool) args(systemPrompt, resume, mcpConfig string) []string {
+	// Using --print flag for non-interactive output
+	args := []string{
+		"--print", // Print response and exit
+		// Report each step as a JSON event, which --print allows only with --verbose
+		"--output-format", "stream-json", "--verbose",
 	}
-
-	var resp FixResponse
-	if err := json.Unmarshal([]byte(jsonStr), &resp); err != nil {
-		return &FixResponse{
-			Success: false,
-			Error:   fmt.Sprintf("Failed to parse JSON response: %v", err),
-		}, nil
+	if c.opts.PermissionMode != "" {
+		args = append(args, "--permission-mode", c.opts.PermissionMode)
+	} else {
+		args = append(args, "--dangerously-skip-permissions") // Allow file operations without prompts
 	}
-
-	return &resp, nil
-}
-
-// extractJSON finds and extracts JSON from text that may contain markdown.
-func extractJSON(text string) string {
-	// Try to find JSON in code blocks first
-	if idx := strings.Index(text, "```json"); idx != -1 {
-		start := idx + 7
-		end := strings.Index(text[start:], "```")
-		if end != -1 {
-			return strings.TrimSpace(text[start : start+end])
+	allowed := c.opts.AllowedTools
+	if mcpConfig != "" {
+		args = append(args, "--mcp-config", mcpConfig)
+		if c.opts.PermissionMode != "" {
+			allowed = append(slices.Clip(allowed), "mcp__"+submitServerName+"__"+submitToolName)
 		}
 	}
-
-	// Try plain code blocks
-	if idx := strings.Index(text, "```"); idx != -1 {
-		start := idx + 3
-		// Skip language identifier if present
-		if newline := strings.Index(text[start:], "\n"); newline != -1 {
-			start += newline + 1
-		}
-		end := strings.Index(text[start:], "```")
-		if end != -1 {
-			candidate := strings.TrimSpace(text[start : start+end])
-			if strings.HasPrefix(candidate, "{") {
-				return candidate
-			}
-		}
+	if len(allowed) > 0 {
+		args = append(args, "--allowedTools", strings.Join(allowed, ","))
 	}
-
-	// Try to find raw JSON object
-	start := strings.Index(text, "{")
-	if start == -1 {
-		return ""
+	if c.opts.Model != "" {
+		args = append(args, "--model", c.opts.Model)
 	}
-
-	// Find matching closing brace
-	depth := 0
-	inString := false
-	escaped := false
-
-	for i := start; i < len(text); i++ {
-		ch := text[i]
-
-		if escaped {
-			escaped = false
-			continue
-		}
-
-		if ch == '\\' && inString {
-			escaped = true
-			continue
-		}
-
-		if ch == '"' {
-			inString = !inString
-			continue
-		}
-
-		if inString {
-			continue
-		}
-
-		if ch == '{' {
-			depth++
-		} else if ch == '}' {
-			depth--
-			if depth == 0 {
-				return text[start : i+1]
-			}
-		}
+	if c.opts.MaxTurns > 0 {
+		args = append(args, "--max-turns", strconv.Itoa(c.opts.MaxTurns))
 	}
-
-	return ""
+	if systemPrompt != "" {
+		args = append(args, "--append-system-prompt", systemPrompt)
+	}
+	if resume != "" {
+		args = append(args, "--resume", resume)
+	}
+	return append(args, c.opts.ExtraArgs...)
 }
 
-// CloneRepo clones a git repository to a temporary directory.
-func CloneRepo(ctx context.Context, repoURL, token string) (string, func(), error) {
+// CloneRepo clones a git repository to a temporary directory. An empty branch
+// clones the default branch. A sparse clone fetches file contents only for
+// the directories it checks out.
+func CloneRepo(ctx context.Context, repoURL, token, branch string, opts CloneOptions) (string, func(), error) {
 	// Create temp directory
 	tmpDir, err := os.MkdirTemp("", "sentryagent-repo-*")
 	if err != nil {
@@ -326,27 +934,50 @@ func CloneRepo(ctx context.Context, repoURL, token string) (string, func(), erro
 		os.RemoveAll(tmpDir)
 	}
 
-	// Build authenticated URL if token provided
-	authURL := repoURL
-	if token != "" && strings.HasPrefix(repoURL, "https://github.com/") {
-		// Insert token into URL: https://TOKEN@github.com/...
-		authURL = strings.Replace(repoURL, "https://github.com/",
-			fmt.Sprintf("https://%s@github.com/", token), 1)
+	if err := cloneInto(ctx, tmpDir, repoURL, token, branch, opts); err != nil {
+		cleanup()
+		return "", nil, err
 	}
+	return tmpDir, cleanup, nil
+}
 
+// cloneInto clones a git repository into the empty directory dir, like
+// CloneRepo.
+func cloneInto(ctx context.Context, dir, repoURL, token, branch string, opts CloneOptions) error {
 	// Clone the repository
-	cmd := exec.CommandContext(ctx, "git", "clone", "--depth", "1", authURL, tmpDir)
-	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
-
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
+	args := []string{"clone", "--quiet"}
+	if opts.Depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(opts.Depth))
+	}
+	if branch != "" {
+		args = append(args, "--branch", branch)
+	}
+	if len(opts.Sparse) > 0 {
+		args = append(args, "--filter=blob:none", "--no-checkout")
+	}
+	args = append(args, repoURL, dir)
+	if err := runGit(ctx, "", token, args...); err != nil {
+		return err
+	}
 
-	if err := cmd.Run(); err != nil {
-		cleanup()
-		return "", nil, fmt.Errorf("git clone failed: %v\n%s", err, stderr.String())
+	if len(opts.Sparse) > 0 {
+		if err := applySparse(ctx, dir, token, "HEAD", opts); err != nil {
+			return err
+		}
+		return runGit(ctx, dir, token, "checkout", "--quiet", "--force", "HEAD")
 	}
+	return nil
+}
 
-	return tmpDir, cleanup, nil
+// isPermanentCloneError reports whether git's stderr shows a clone failure
+// that retrying won't fix, such as bad credentials or a missing repository.
+func isPermanentCloneError(stderr string) bool {
+	for _, msg := range []string{"Authentication failed", "Repository not found", "not found in upstream", "couldn't find remote ref"} {
+		if strings.Contains(stderr, msg) {
+			return true
+		}
+	}
+	return false
 }
 
 // GetChangedFiles reads the git diff to find what files Claude Code modified.
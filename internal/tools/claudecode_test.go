@@ -1,90 +1,74 @@
 package tools
 
 import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
 	"testing"
 )
 
-func TestExtractJSON(t *testing.T) {
+func TestClaudeCodeTool_Args(t *testing.T) {
 	tests := []struct {
-		name    string
-		input   string
-		want    string
-		wantLen int // expected length > 0 means we expect valid JSON
+		name      string
+		opts      ClaudeCodeOptions
+		resume    string
+		mcpConfig string
+		want      []string
 	}{
 		{
-			name: "json in code block",
-			input: `Here is the fix:
-
-` + "```json" + `
-{
-  "success": true,
-  "description": "Fixed null pointer",
-  "files": []
-}
-` + "```" + `
-
-Let me know if you need anything else.`,
-			want:    `{"success": true,"description": "Fixed null pointer","files": []}`,
-			wantLen: 1,
+			name: "defaults",
+			want: []string{"--print", "--output-format", "stream-json", "--verbose", "--dangerously-skip-permissions", "--append-system-prompt", "system"},
 		},
 		{
-			name:    "json in plain code block",
-			input:   "```\n{\"success\": true}\n```",
-			want:    `{"success": true}`,
-			wantLen: 1,
-		},
-		{
-			name:    "raw json object",
-			input:   `Some text before {"success": false, "error": "could not fix"} and after`,
-			want:    `{"success": false, "error": "could not fix"}`,
-			wantLen: 1,
-		},
-		{
-			name:    "nested json",
-			input:   `{"outer": {"inner": {"deep": true}}, "arr": [1, 2, 3]}`,
-			want:    `{"outer": {"inner": {"deep": true}}, "arr": [1, 2, 3]}`,
-			wantLen: 1,
+			name: "restricted",
+			opts: ClaudeCodeOptions{
+				Model:          "claude-opus-4-1",
+				MaxTurns:       20,
+				AllowedTools:   []string{"Read", "Edit", "Bash(go test:*)"},
+				PermissionMode: "acceptEdits",
+				ExtraArgs:      []string{"--verbose"},
+			},
+			want: []string{
+				"--print", "--output-format", "stream-json", "--verbose",
+				"--permission-mode", "acceptEdits",
+				"--allowedTools", "Read,Edit,Bash(go test:*)",
+				"--model", "claude-opus-4-1",
+				"--max-turns", "20",
+				"--append-system-prompt", "system",
+				"--verbose",
+			},
 		},
 		{
-			name:    "no json",
-			input:   "Just plain text with no JSON",
-			want:    "",
-			wantLen: 0,
+			name:   "resumed",
+			resume: "s1",
+			want:   []string{"--print", "--output-format", "stream-json", "--verbose", "--dangerously-skip-permissions", "--append-system-prompt", "system", "--resume", "s1"},
 		},
 		{
-			name:    "json with strings containing braces",
-			input:   `{"message": "Use {name} as placeholder", "code": "func() { }"}`,
-			want:    `{"message": "Use {name} as placeholder", "code": "func() { }"}`,
-			wantLen: 1,
+			name:      "submit tool",
+			opts:      ClaudeCodeOptions{AllowedTools: []string{"Read"}, PermissionMode: "acceptEdits"},
+			mcpConfig: `{"mcpServers":{}}`,
+			want: []string{
+				"--print", "--output-format", "stream-json", "--verbose",
+				"--permission-mode", "acceptEdits",
+				"--mcp-config", `{"mcpServers":{}}`,
+				"--allowedTools", "Read,mcp__sentryagent__submit_fix",
+				"--append-system-prompt", "system",
+			},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := extractJSON(tt.input)
-
-			if tt.wantLen == 0 {
-				if got != "" {
-					t.Errorf("extractJSON() = %q, want empty string", got)
-				}
-				return
-			}
-
-			if got == "" {
-				t.Errorf("extractJSON() returned empty, want non-empty JSON")
-				return
-			}
-
-			// Just verify it starts with { and ends with }
-			if got[0] != '{' || got[len(got)-1] != '}' {
-				t.Errorf("extractJSON() = %q, doesn't look like JSON", got)
+			got := NewClaudeCodeTool(t.TempDir(), tt.opts, nil).args("system", tt.resume, tt.mcpConfig)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("args() = %q, want %q", got, tt.want)
 			}
 		})
 	}
 }
 
 func TestBuildPrompt(t *testing.T) {
-	tool := NewClaudeCodeTool("/tmp/test", "")
 
 	req := &FixRequest{
 		IssueID:      "12345",
@@ -95,12 +79,19 @@ func TestBuildPrompt(t *testing.T) {
 		Platform:     "java",
 		Culprit:      "com.example.UserService.getUser",
 		Permalink:    "https://sentry.io/issues/12345",
+		Release:      "2.3.1",
+		Environment:  "production",
 		Stacktrace: []Frame{
 			{
 				Filename: "UserService.java",
 				Function: "getUser",
 				LineNo:   42,
 				InApp:    true,
+				Context: []SourceLine{
+					{LineNo: 41, Code: "User user = repo.find(id);"},
+					{LineNo: 42, Code: "return user.getName();"},
+				},
+				Vars: map[string]interface{}{"id": 7},
 			},
 			{
 				Filename: "UserController.java",
@@ -108,6 +99,11 @@ func TestBuildPrompt(t *testing.T) {
 				LineNo:   15,
 				InApp:    true,
 			},
+			{
+				Filename: "static/vendor.min.js",
+				Function: "e",
+				Minified: true,
+			},
 			{
 				Filename: "spring-framework.jar",
 				Function: "dispatch",
@@ -115,9 +111,25 @@ func TestBuildPrompt(t *testing.T) {
 				InApp:    false,
 			},
 		},
+		Request: &HTTPRequest{
+			Method: "GET",
+			URL:    "https://api.example.com/users/7",
+			Query:  []Param{{Name: "expand", Value: "profile"}},
+		},
+		Minified: true,
+		ReviewerFeedback: []FeedbackTheme{
+			{Text: "Add nil checks at the call site,\nnot inside the helper", Count: 3},
+		},
+		SourceFiles: []SourceFile{{
+			Path:       "src/main/java/UserService.java",
+			Lines:      []SourceLine{{LineNo: 41, Code: "User user = repo.find(id);"}, {LineNo: 42, Code: "return user.getName();"}, {LineNo: 90, Code: "}"}},
+			FrameLines: []int{42},
+		}},
+		RegressionTest:        true,
+		RegressionTestCommand: "mvn test -Dtest={filter}",
 	}
 
-	prompt := tool.buildPrompt(req)
+	prompt := buildPrompt(req)
 
 	// Verify prompt contains key information
 	checks := []string{
@@ -127,6 +139,20 @@ func TestBuildPrompt(t *testing.T) {
 		"getUser",
 		"[IN APP]",
 		"spring-framework.jar",
+		"Add nil checks at the call site, not inside the helper (raised 3 times)",
+		">   42 | return user.getName();",
+		"`id` = `7`",
+		"`GET https://api.example.com/users/7`",
+		"`expand` = `profile`",
+		"`static/vendor.min.js:0` in `e` [MINIFIED]",
+		"Do not edit bundle or build output",
+		"- **Release**: 2.3.1",
+		"- **Environment**: production",
+		"### `src/main/java/UserService.java` (lines 41-90)",
+		"    41 | User user = repo.find(id);\n>   42 | return user.getName();\n   ...\n    90 | }",
+		"## Regression Test",
+		"`mvn test -Dtest={filter}`",
+		"`\"test_filter\"`",
 	}
 
 	for _, check := range checks {
@@ -136,6 +162,135 @@ func TestBuildPrompt(t *testing.T) {
 	}
 }
 
+func TestBuildPrompt_CulpritHistory(t *testing.T) {
+	got := buildPrompt(&FixRequest{CulpritHistory: &FileHistory{
+		Path: "app/handler.py",
+		Commits: []HistoryCommit{{
+			SHA:     "abc1234def",
+			Message: "Refactor user loading\n\nUse the cache.",
+			Author:  "Dana",
+			Date:    "2026-10-15",
+			Patch:   "-user = load(id)\n+user = cache.get(id)",
+		}},
+	}})
+	for _, want := range []string{"## Recent Changes to the Culprit File", "`app/handler.py`", "### `abc1234` Refactor user loading\n", "By Dana on 2026-10-15", "+user = cache.get(id)"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("buildPrompt() missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestBuildPrompt_PastOutcomes(t *testing.T) {
+	got := buildPrompt(&FixRequest{ErrorType: "KeyError", PastOutcomes: &PastOutcomes{
+		Merged:   1,
+		Rejected: 2,
+		Rejections: []RejectedFix{
+			{Title: "Default the key", Reverted: true, Reason: "The default hid\na data bug"},
+			{Title: "Guard missing key"},
+		},
+	}})
+	for _, want := range []string{
+		"## Outcomes of Previous Fixes",
+		"for KeyError in this repository, 1 were merged and 2 were rejected",
+		"- **Default the key** was reverted after merging: The default hid a data bug\n",
+		"- **Guard missing key** was closed without merging\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("buildPrompt() missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestBuildPrompt_RuntimeContext(t *testing.T) {
+	got := buildPrompt(&FixRequest{
+		Contexts: map[string]string{"runtime": "CPython 3.11.4", "os": "Ubuntu 22.04"},
+		Breadcrumbs: []Breadcrumb{
+			{Time: "09:00:01.500", Category: "http", Data: map[string]interface{}{"method": "GET", "status_code": 500}},
+			{Category: "query", Level: "warning", Message: "SELECT *\nFROM users"},
+		},
+	})
+	for _, want := range []string{
+		"- **Runtime**: CPython 3.11.4\n- **OS**: Ubuntu 22.04\n",
+		"## Breadcrumbs",
+		"- `09:00:01.500` [http] `{\"method\":\"GET\",\"status_code\":500}`\n",
+		"- [query] (warning) SELECT * FROM users\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("buildPrompt() missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestBuildPrompt_PlatformGuide(t *testing.T) {
+	got := buildPrompt(&FixRequest{Platform: "node", ErrorType: "TypeError", ErrorMessage: "Cannot read properties of undefined (reading 'id')"})
+	for _, want := range []string{"## JavaScript Errors", "optional chaining only where", "`tsc --noEmit`"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("buildPrompt() missing %q:\n%s", want, got)
+		}
+	}
+	// Only the most specific hint is given
+	if strings.Contains(got, "including values from JSON") {
+		t.Errorf("buildPrompt() gives the generic TypeError hint as well:\n%s", got)
+	}
+
+	if got := buildPrompt(&FixRequest{Platform: "ruby"}); strings.Contains(got, " Errors\n") {
+		t.Errorf("buildPrompt() gives platform guidance for ruby:\n%s", got)
+	}
+}
+
+func TestBuildPrompt_NoRegressionTest(t *testing.T) {
+	if prompt := buildPrompt(&FixRequest{IssueID: "1"}); contains(prompt, "Regression Test") {
+		t.Error("buildPrompt() asks for a regression test, want none")
+	}
+}
+
+func TestBuildPrompt_RestrictedPaths(t *testing.T) {
+	prompt := buildPrompt(&FixRequest{IssueID: "1", DeniedPaths: []string{"vendor/", ".github/workflows/"}})
+	if !contains(prompt, "- Never change files matching: `vendor/`, `.github/workflows/`") {
+		t.Errorf("buildPrompt() does not list the denied paths:\n%s", prompt)
+	}
+	if contains(prompt, "Only change files matching") {
+		t.Error("buildPrompt() restricts the allowed paths, want none")
+	}
+	if contains(buildPrompt(&FixRequest{IssueID: "1"}), "Restricted Paths") {
+		t.Error("buildPrompt() restricts paths, want none")
+	}
+}
+
+func TestOutputInstructions(t *testing.T) {
+	if got := outputInstructions(&FixRequest{}); contains(got, `"diff"`) {
+		t.Error("outputInstructions() asks for diffs, want full content")
+	}
+	if got := outputInstructions(&FixRequest{DiffFormat: true}); !contains(got, `Give each modified file's change as "diff"`) {
+		t.Errorf("outputInstructions() with DiffFormat does not ask for diffs:\n%s", got)
+	}
+	if got := submitInstructions(&FixRequest{DiffFormat: true}); !contains(got, "calling the submit_fix tool") || !contains(got, `"diff"`) || contains(got, "nothing else after the JSON") {
+		t.Errorf("submitInstructions() does not ask for a submit_fix call with diffs:\n%s", got)
+	}
+}
+
+func TestBuildSystemPrompt(t *testing.T) {
+
+	if got := buildSystemPrompt(&FixRequest{}); got != "" {
+		t.Errorf("buildSystemPrompt() without style guide = %q, want empty", got)
+	}
+
+	got := buildSystemPrompt(&FixRequest{StyleGuide: "Use tabs for indentation."})
+	if !contains(got, "Use tabs for indentation.") {
+		t.Errorf("buildSystemPrompt() missing style guide: %q", got)
+	}
+
+	got = buildSystemPrompt(&FixRequest{Instructions: []Instructions{
+		{Source: "prompt template", Text: "Never touch the billing module."},
+		{Source: ".autofix.md", Text: "Errors are wrapped with fmt.Errorf."},
+	}})
+	for _, want := range []string{"(from prompt template)", "Never touch the billing module.", "(from .autofix.md)", "Errors are wrapped with fmt.Errorf."} {
+		if !contains(got, want) {
+			t.Errorf("buildSystemPrompt() missing %q: %q", want, got)
+		}
+	}
+}
+
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && (s == substr || len(s) > 0 && containsHelper(s, substr))
 }
@@ -148,3 +303,36 @@ func containsHelper(s, substr string) bool {
 	}
 	return false
 }
+
+func TestDockerSandbox_Args(t *testing.T) {
+	sandbox := &DockerSandbox{
+		Image:     "claude-sandbox:latest",
+		Network:   "claude-egress",
+		Proxy:     "http://egress-proxy:3128",
+		CPUs:      "2",
+		Memory:    "4g",
+		PidsLimit: 512,
+	}
+
+	got := sandbox.args("sentryagent-claude-1", "/tmp/repo", []string{"ANTHROPIC_API_KEY"}, []string{"claude", "--print"})
+
+	want := []string{
+		"run", "--rm", "--interactive", "--name", "sentryagent-claude-1",
+		"--read-only", "--tmpfs", "/tmp",
+		"--cap-drop", "ALL", "--security-opt", "no-new-privileges",
+		"--volume", "/tmp/repo:/workspace", "--workdir", "/workspace",
+		"--env", "HOME=/tmp", "--env", "ANTHROPIC_API_KEY",
+	}
+	if uid := os.Getuid(); uid >= 0 {
+		want = append(want, "--user", fmt.Sprintf("%d:%d", uid, os.Getgid()))
+	}
+	want = append(want,
+		"--network", "claude-egress",
+		"--env", "HTTPS_PROXY=http://egress-proxy:3128",
+		"--cpus", "2", "--memory", "4g", "--pids-limit", "512",
+		"claude-sandbox:latest", "claude", "--print",
+	)
+	if !slices.Equal(got, want) {
+		t.Errorf("args() =\n%q\nwant\n%q", got, want)
+	}
+}
@@ -0,0 +1,176 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// maxCommandOutput caps how much of a command's output is kept; the end is
+// kept, since that is where test runners summarize failures.
+const maxCommandOutput = 32 * 1024
+
+// ApplyChanges writes a fix's file changes into the checkout at dir. Paths
+// are confined to dir.
+func ApplyChanges(dir string, files []FileChange) error {
+	for _, f := range files {
+		path := filepath.Join(dir, filepath.Clean("/"+f.Path))
+		if f.ChangeType == "delete" {
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("failed to delete %s: %w", f.Path, err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return fmt.Errorf("failed to write %s: %w", f.Path, err)
+		}
+		if err := os.WriteFile(path, []byte(f.Content), 0o644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", f.Path, err)
+		}
+	}
+	return nil
+}
+
+// Snapshot returns the changes restoring the files that changes touch in
+// the checkout at dir to their current state.
+func Snapshot(dir string, changes []FileChange) ([]FileChange, error) {
+	restore := make([]FileChange, len(changes))
+	for i, f := range changes {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.Clean("/"+f.Path)))
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			restore[i] = FileChange{Path: f.Path, ChangeType: "delete", Test: f.Test}
+		case err != nil:
+			return nil, fmt.Errorf("failed to read %s: %w", f.Path, err)
+		default:
+			restore[i] = FileChange{Path: f.Path, Content: string(data), ChangeType: "modify", Test: f.Test}
+		}
+	}
+	return restore, nil
+}
+
+// CommandOptions configures how RunCommand runs a command.
+type CommandOptions struct {
+	// Limits bounds the command's resources. Only its output limit applies
+	// with a Sandbox, which has limits of its own.
+	Limits ProcessLimits
+	// Sandbox, if set, runs the command in a container instead of on the
+	// host.
+	Sandbox *DockerSandbox
+	// Env names variables of the service's environment passed to the
+	// command on top of those in commandEnv, e.g. a package registry's
+	// token.
+	Env []string
+}
+
+// commandEnv names the variables of the service's environment that commands
+// run on the host get: what build tools need to find themselves, their
+// caches and proxies. Credentials of the service are never among them.
+var commandEnv = []string{
+	"PATH", "HOME", "USER", "LANG", "LC_ALL", "TZ", "TERM",
+	"GOPATH", "GOROOT", "GOCACHE", "GOMODCACHE", "GOPROXY", "GOFLAGS",
+	"CARGO_HOME", "RUSTUP_HOME", "JAVA_HOME", "GRADLE_USER_HOME",
+	"NODE_PATH", "NPM_CONFIG_CACHE", "PYTHONPATH", "VIRTUAL_ENV",
+	"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY",
+}
+
+// RunCommand runs a shell command in dir and returns the end of its combined
+// output. The command sees only the variables in commandEnv and opts.Env,
+// and CI=true. A command that exits non-zero returns its output and an
+// *exec.ExitError, and one killed for writing too much output an error
+// wrapping ErrOutputLimit.
+func RunCommand(ctx context.Context, dir, command string, opts CommandOptions) (string, error) {
+	runCtx, limitOutput, cancel := opts.Limits.limitOutput(ctx)
+	defer cancel()
+	var cmd *exec.Cmd
+	if opts.Sandbox != nil {
+		// The container has a PATH and HOME of its own, and a private /tmp
+		env := append([]string{"CI=true"}, opts.Env...)
+		cmd = opts.Sandbox.command(runCtx, "check", dir, env, []string{"sh", "-c", command})
+	} else {
+		cmd = limitedCommand(runCtx, opts.Limits, "sh", "-c", command)
+		cmd.Dir = dir
+		cmd.Env = append(allowedEnv(opts.Env), "CI=true")
+		removeTemp, err := withTempDir(cmd)
+		if err != nil {
+			return "", err
+		}
+		defer removeTemp()
+		killProcessTree(cmd)
+	}
+
+	out := &tailBuffer{max: maxCommandOutput}
+	cmd.Stdout = limitOutput(out)
+	cmd.Stderr = cmd.Stdout
+	err := runProcessTree(cmd)
+	switch {
+	case ctx.Err() != nil:
+		err = fmt.Errorf("%s did not finish: %w", command, ctx.Err())
+	case context.Cause(runCtx) == ErrOutputLimit:
+		err = fmt.Errorf("%s wrote more than %d bytes: %w", command, opts.Limits.Output, ErrOutputLimit)
+		return out.String() + "\n[killed for writing too much output]", err
+	}
+	return out.String(), err
+}
+
+// allowedEnv returns the variables of the service's environment named in
+// commandEnv or extra.
+func allowedEnv(extra []string) []string {
+	var env []string
+	for _, name := range append(commandEnv, extra...) {
+		if v, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+v)
+		}
+	}
+	return env
+}
+
+// withTempDir points cmd's TMPDIR at a new directory of its own, so that
+// commands of parallel jobs never share temporary files, and returns a
+// function removing the directory.
+func withTempDir(cmd *exec.Cmd) (func(), error) {
+	dir, err := os.MkdirTemp("", "sentryagent-tmp-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, "TMPDIR="+dir)
+	return func() { os.RemoveAll(dir) }, nil
+}
+
+// tailBuffer keeps the last max bytes written to it.
+type tailBuffer struct {
+	max int
+
+	mu        sync.Mutex
+	buf       []byte
+	truncated bool
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > b.max {
+		b.buf = append(b.buf[:0], b.buf[len(b.buf)-b.max:]...)
+		b.truncated = true
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := strings.TrimSpace(string(b.buf))
+	if b.truncated {
+		out = "[output truncated]\n" + out
+	}
+	return out
+}
@@ -0,0 +1,128 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApplyChanges(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "old.py"), []byte("x"), 0o644)
+
+	err := ApplyChanges(dir, []FileChange{
+		{Path: "app/new.py", Content: "print(1)\n", ChangeType: "create"},
+		{Path: "old.py", ChangeType: "delete"},
+		{Path: "gone.py", ChangeType: "delete"},
+		{Path: "../../escape.py", Content: "x", ChangeType: "create"},
+	})
+	if err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+
+	if data, _ := os.ReadFile(filepath.Join(dir, "app", "new.py")); string(data) != "print(1)\n" {
+		t.Errorf("app/new.py = %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "old.py")); !os.IsNotExist(err) {
+		t.Error("old.py was not deleted")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escape.py")); err != nil {
+		t.Errorf("escaping path was not confined to the checkout: %v", err)
+	}
+}
+
+func TestRunCommand(t *testing.T) {
+	dir := t.TempDir()
+
+	out, err := RunCommand(context.Background(), dir, "echo ok; echo warn >&2", CommandOptions{})
+	if err != nil || out != "ok\nwarn" {
+		t.Errorf("RunCommand() = %q, %v", out, err)
+	}
+
+	out, err = RunCommand(context.Background(), dir, "echo FAIL: test_user; exit 1", CommandOptions{})
+	var exit *exec.ExitError
+	if !errors.As(err, &exit) || out != "FAIL: test_user" {
+		t.Errorf("failing RunCommand() = %q, %v; want the output and an exit error", out, err)
+	}
+
+	// Only the end of long output is kept
+	out, _ = RunCommand(context.Background(), dir, "yes line | head -n 20000; echo summary", CommandOptions{})
+	if len(out) > maxCommandOutput+100 || !strings.HasPrefix(out, "[output truncated]") || !strings.HasSuffix(out, "summary") {
+		t.Errorf("long RunCommand() output has %d bytes, starting %q", len(out), out[:30])
+	}
+
+	// Each command gets a temp dir of its own, removed when it finishes
+	first, _ := RunCommand(context.Background(), dir, `touch "$TMPDIR/x" && echo "$TMPDIR"`, CommandOptions{})
+	second, _ := RunCommand(context.Background(), dir, `ls "$TMPDIR"; echo "$TMPDIR"`, CommandOptions{})
+	if first == "" || first == second || first == os.TempDir() {
+		t.Errorf("TMPDIR = %q then %q, want a new directory for each command", first, second)
+	}
+	if _, err := os.Stat(first); !os.IsNotExist(err) {
+		t.Errorf("temp dir %s was not removed", first)
+	}
+}
+
+func TestRunCommand_Limits(t *testing.T) {
+	dir := t.TempDir()
+
+	out, err := RunCommand(context.Background(), dir, "ulimit -d; ulimit -t", CommandOptions{Limits: ProcessLimits{Memory: 64 << 20, CPUTime: 5 * time.Second}})
+	if err != nil || out != "65536\n5" {
+		t.Errorf("RunCommand() = %q, %v; want the limits set", out, err)
+	}
+
+	_, err = RunCommand(context.Background(), dir, "head -c 100000 /dev/zero > big", CommandOptions{Limits: ProcessLimits{FileSize: 4096}})
+	var exit *exec.ExitError
+	if !errors.As(err, &exit) {
+		t.Errorf("RunCommand() writing a big file error = %v, want an exit error", err)
+	}
+
+	// Endless output is cut off rather than waiting for a timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	out, err = RunCommand(ctx, dir, "yes", CommandOptions{Limits: ProcessLimits{Output: 1000}})
+	if !errors.Is(err, ErrOutputLimit) {
+		t.Errorf("RunCommand() error = %v, want ErrOutputLimit", err)
+	}
+	if len(out) > 1100 {
+		t.Errorf("RunCommand() kept %d bytes of output, want at most the limit", len(out))
+	}
+}
+
+func TestRunCommand_Env(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("GITHUB_TOKEN", "secret")
+	t.Setenv("NPM_TOKEN", "registry")
+
+	out, err := RunCommand(context.Background(), dir, `echo "$CI ${GITHUB_TOKEN:-unset} ${NPM_TOKEN:-unset} ${PATH:+path}"`, CommandOptions{Env: []string{"NPM_TOKEN"}})
+	if err != nil || out != "true unset registry path" {
+		t.Errorf("RunCommand() = %q, %v; want only allowed variables", out, err)
+	}
+}
+
+func TestRunCommand_Sandbox(t *testing.T) {
+	// docker prints the command line it was given
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "docker"), []byte("#!/bin/sh\necho \"$@\"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(filepath.ListSeparator)+os.Getenv("PATH"))
+
+	sandbox := &DockerSandbox{Image: "sandbox:latest", Network: "egress"}
+	out, err := RunCommand(context.Background(), t.TempDir(), "make test", CommandOptions{Sandbox: sandbox, Env: []string{"NPM_TOKEN"}})
+	if err != nil {
+		t.Fatalf("RunCommand() error = %v", err)
+	}
+	for _, want := range []string{"--env CI=true --env NPM_TOKEN", "sandbox:latest sh -c make test"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("docker args = %q, want them to contain %q", out, want)
+		}
+	}
+	if strings.Contains(out, "ANTHROPIC_API_KEY") {
+		t.Errorf("docker args = %q pass the API key to a check", out)
+	}
+}
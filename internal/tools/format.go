@@ -0,0 +1,129 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// formatters are the formatters run on changed files when the repository's
+// formatter is detected. Formatters not configured in the repository are
+// run only where the language has a single standard one.
+var formatters = []struct {
+	exts    []string
+	command string
+	// configs are files at the root of the repository that show it uses the
+	// formatter, either by existing or by containing marker. None means the
+	// formatter is always used.
+	configs []string
+	marker  string
+}{
+	{exts: []string{".go"}, command: "gofmt -w"},
+	{exts: []string{".rs"}, command: "rustfmt --edition 2021", configs: []string{"rustfmt.toml", ".rustfmt.toml", "Cargo.toml"}},
+	{exts: []string{".py"}, command: "ruff format --quiet", configs: []string{"ruff.toml", ".ruff.toml"}},
+	{exts: []string{".py"}, command: "ruff format --quiet", configs: []string{"pyproject.toml"}, marker: "[tool.ruff"},
+	{exts: []string{".py"}, command: "black --quiet", configs: []string{"pyproject.toml"}, marker: "[tool.black]"},
+	{
+		exts:    []string{".js", ".jsx", ".mjs", ".cjs", ".ts", ".tsx", ".css", ".scss", ".json", ".md", ".vue"},
+		command: "npx --no-install prettier --write --log-level warn",
+		configs: []string{".prettierrc", ".prettierrc.json", ".prettierrc.yaml", ".prettierrc.yml", ".prettierrc.js", ".prettierrc.cjs", ".prettierrc.mjs", "prettier.config.js", "prettier.config.cjs", "prettier.config.mjs", "package.json"},
+		marker:  "prettier",
+	},
+}
+
+// DetectFormatCommand returns a command that formats the changed files in
+// the checkout at dir with the formatters the repository uses, or "" if
+// none apply.
+func DetectFormatCommand(dir string, changed []FileChange) string {
+	var commands []string
+	formatted := make(map[string]bool)
+	for _, f := range formatters {
+		var paths []string
+		for _, path := range changedPaths(changed) {
+			if !formatted[path] && hasExt(path, f.exts) {
+				paths = append(paths, path)
+			}
+		}
+		if len(paths) == 0 || !usesFormatter(dir, f.configs, f.marker) {
+			continue
+		}
+		for _, path := range paths {
+			formatted[path] = true
+		}
+		commands = append(commands, withPaths(f.command, paths))
+	}
+	return strings.Join(commands, " && ")
+}
+
+// FormatCommand returns command run on the changed files, or "" if no file
+// is left to format.
+func FormatCommand(command string, changed []FileChange) string {
+	paths := changedPaths(changed)
+	if len(paths) == 0 {
+		return ""
+	}
+	return withPaths(command, paths)
+}
+
+// ReadChanges replaces the content of changed files with their content in
+// the checkout at dir.
+func ReadChanges(dir string, changed []FileChange) error {
+	for i, f := range changed {
+		if f.ChangeType == "delete" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, filepath.Clean("/"+f.Path)))
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", f.Path, err)
+		}
+		changed[i].Content = string(data)
+	}
+	return nil
+}
+
+// usesFormatter reports whether any of configs exists at the root of dir
+// and, if marker is set, contains it.
+func usesFormatter(dir string, configs []string, marker string) bool {
+	if len(configs) == 0 {
+		return true
+	}
+	for _, name := range configs {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err == nil && strings.Contains(string(data), marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// changedPaths returns the repository-relative paths of the files changed
+// and not deleted.
+func changedPaths(changed []FileChange) []string {
+	var paths []string
+	for _, f := range changed {
+		if f.ChangeType != "delete" {
+			paths = append(paths, strings.TrimPrefix(filepath.Clean("/"+f.Path), "/"))
+		}
+	}
+	return paths
+}
+
+func hasExt(path string, exts []string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, e := range exts {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// withPaths appends paths to command as shell words.
+func withPaths(command string, paths []string) string {
+	quoted := make([]string, len(paths))
+	for i, path := range paths {
+		quoted[i] = shellQuote(path)
+	}
+	return command + " -- " + strings.Join(quoted, " ")
+}
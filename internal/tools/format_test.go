@@ -0,0 +1,79 @@
+package tools
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetectFormatCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		changed []string
+		want    string
+	}{
+		{
+			name:    "go",
+			changed: []string{"main.go", "README.md"},
+			want:    "gofmt -w -- 'main.go'",
+		},
+		{
+			name:    "black",
+			files:   map[string]string{"pyproject.toml": "[tool.black]\nline-length = 100\n"},
+			changed: []string{"app/views.py"},
+			want:    "black --quiet -- 'app/views.py'",
+		},
+		{
+			name:    "ruff before black",
+			files:   map[string]string{"pyproject.toml": "[tool.black]\n[tool.ruff.lint]\n"},
+			changed: []string{"app/views.py"},
+			want:    "ruff format --quiet -- 'app/views.py'",
+		},
+		{
+			name:    "unconfigured python",
+			files:   map[string]string{"pyproject.toml": "[project]\n"},
+			changed: []string{"app/views.py"},
+		},
+		{
+			name:    "prettier in package.json",
+			files:   map[string]string{"package.json": `{"devDependencies": {"prettier": "^3.0.0"}}`},
+			changed: []string{"src/App.tsx", "server/main.go"},
+			want:    "gofmt -w -- 'server/main.go' && npx --no-install prettier --write --log-level warn -- 'src/App.tsx'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644)
+			}
+			var changed []FileChange
+			for _, path := range tt.changed {
+				changed = append(changed, FileChange{Path: path, ChangeType: "modify"})
+			}
+			changed = append(changed, FileChange{Path: "deleted.go", ChangeType: "delete"})
+
+			if got := DetectFormatCommand(dir, changed); got != tt.want {
+				t.Errorf("DetectFormatCommand() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadChanges(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "main.go"), []byte("formatted"), 0o644)
+
+	changed := []FileChange{
+		{Path: "main.go", Content: "generated", ChangeType: "modify"},
+		{Path: "old.go", ChangeType: "delete"},
+	}
+	if err := ReadChanges(dir, changed); err != nil {
+		t.Fatalf("ReadChanges() error = %v", err)
+	}
+	if changed[0].Content != "formatted" {
+		t.Errorf("main.go content = %q, want the checkout's", changed[0].Content)
+	}
+}
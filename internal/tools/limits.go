@@ -0,0 +1,79 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// ErrOutputLimit is the cause of a subprocess being killed for writing more
+// output than its ProcessLimits allow.
+var ErrOutputLimit = errors.New("output limit exceeded")
+
+// ProcessLimits bounds the resources of a subprocess and of every process it
+// starts. Zero values leave a resource unlimited. The memory, CPU and file
+// size limits are resource limits of each process, applied only on Unix.
+type ProcessLimits struct {
+	// Memory is the data memory, in bytes, a process may allocate.
+	Memory int64
+	// CPUTime is the CPU time a process may use before it is killed.
+	CPUTime time.Duration
+	// FileSize is the size, in bytes, of the largest file a process may
+	// write.
+	FileSize int64
+	// Output is how many bytes the subprocess may write to stdout and
+	// stderr before it is killed.
+	Output int64
+}
+
+// limitOutput returns a context for running a subprocess that is cancelled
+// with ErrOutputLimit once the subprocess writes more than l.Output bytes to
+// the writers wrapped by the returned function.
+func (l ProcessLimits) limitOutput(ctx context.Context) (context.Context, func(io.Writer) io.Writer, context.CancelFunc) {
+	if l.Output <= 0 {
+		return ctx, func(w io.Writer) io.Writer { return w }, func() {}
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	counter := &outputCounter{max: l.Output, exceeded: func() { cancel(ErrOutputLimit) }}
+	wrap := func(w io.Writer) io.Writer { return &countingWriter{w: w, counter: counter} }
+	return ctx, wrap, func() { cancel(nil) }
+}
+
+// outputCounter counts what a subprocess writes across its outputs.
+type outputCounter struct {
+	max      int64
+	exceeded func()
+
+	mu sync.Mutex
+	n  int64
+}
+
+// add counts n bytes, returning how many of them are within the limit.
+func (c *outputCounter) add(n int) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	allowed := min(int64(n), max(c.max-c.n, 0))
+	c.n += int64(n)
+	if c.n > c.max {
+		c.exceeded()
+	}
+	return int(allowed)
+}
+
+// countingWriter passes writes to w until its counter runs out, discarding
+// the rest.
+type countingWriter struct {
+	w       io.Writer
+	counter *outputCounter
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	if n := w.counter.add(len(p)); n > 0 {
+		if _, err := w.w.Write(p[:n]); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
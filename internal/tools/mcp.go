@@ -0,0 +1,237 @@
+package tools
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// submitServerName is what Claude Code calls the submission server; its tool
+// is mcp__<name>__submit_fix to the agent.
+const submitServerName = "sentryagent"
+
+// submitToolName is the name of the tool the agent reports its fix with.
+const submitToolName = "submit_fix"
+
+// mcpProtocolVersion is the MCP version answered to clients that don't ask
+// for one.
+const mcpProtocolVersion = "2025-06-18"
+
+// submitServer is an MCP server, over streamable HTTP on the loopback
+// interface, whose submit_fix tool receives the fix report of a Claude Code
+// session as a typed tool call instead of JSON at the end of its output.
+// Reports failing fixReportSchema are rejected with the problems, so the
+// agent can correct them in the same session.
+type submitServer struct {
+	url    string
+	server *http.Server
+
+	mu     sync.Mutex
+	report json.RawMessage
+}
+
+// startSubmitServer starts a submission server on a random local port. Its
+// URL contains a random token so that only the session it is given to can
+// submit.
+func startSubmitServer() (*submitServer, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, fmt.Errorf("failed to generate MCP token: %w", err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to start MCP server: %w", err)
+	}
+	path := "/mcp/" + hex.EncodeToString(token)
+	s := &submitServer{url: "http://" + ln.Addr().String() + path}
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, s.handle)
+	s.server = &http.Server{Handler: mux}
+	go s.server.Serve(ln)
+	return s, nil
+}
+
+// Close stops the server.
+func (s *submitServer) Close() error {
+	return s.server.Close()
+}
+
+// config returns the --mcp-config JSON registering the server with Claude
+// Code.
+func (s *submitServer) config() string {
+	data, _ := json.Marshal(map[string]any{
+		"mcpServers": map[string]any{
+			submitServerName: map[string]string{"type": "http", "url": s.url},
+		},
+	})
+	return string(data)
+}
+
+// take returns the last accepted report and forgets it, or nil if none was
+// submitted since the last call.
+func (s *submitServer) take() json.RawMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	report := s.report
+	s.report = nil
+	return report
+}
+
+// rpcRequest is a JSON-RPC 2.0 request or, without an ID, notification.
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// JSON-RPC error codes.
+const (
+	rpcParseError     = -32700
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+)
+
+func (s *submitServer) handle(w http.ResponseWriter, r *http.Request) {
+	// No server-initiated messages, so there is no event stream to open
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req rpcRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 10<<20)).Decode(&req); err != nil {
+		writeRPC(w, nil, nil, &rpcError{Code: rpcParseError, Message: err.Error()})
+		return
+	}
+	if len(req.ID) == 0 {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	switch req.Method {
+	case "initialize":
+		var params struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		json.Unmarshal(req.Params, &params)
+		version := params.ProtocolVersion
+		if version == "" {
+			version = mcpProtocolVersion
+		}
+		writeRPC(w, req.ID, map[string]any{
+			"protocolVersion": version,
+			"capabilities":    map[string]any{"tools": map[string]any{}},
+			"serverInfo":      map[string]string{"name": submitServerName, "version": "1.0.0"},
+		}, nil)
+	case "ping":
+		writeRPC(w, req.ID, map[string]any{}, nil)
+	case "tools/list":
+		writeRPC(w, req.ID, map[string]any{"tools": []any{submitTool()}}, nil)
+	case "tools/call":
+		var params struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil || params.Name != submitToolName {
+			writeRPC(w, req.ID, nil, &rpcError{Code: rpcInvalidParams, Message: fmt.Sprintf("unknown tool %q", params.Name)})
+			return
+		}
+		writeRPC(w, req.ID, s.submit(params.Arguments), nil)
+	default:
+		writeRPC(w, req.ID, nil, &rpcError{Code: rpcMethodNotFound, Message: "method not found: " + req.Method})
+	}
+}
+
+// submit accepts report if it matches fixReportSchema, returning the tool
+// call's result.
+func (s *submitServer) submit(report json.RawMessage) map[string]any {
+	var v any
+	if err := json.Unmarshal(report, &v); err != nil {
+		return toolResult("The fix report is not valid JSON: "+err.Error(), true)
+	}
+	if problems := fixSchema.validate(v); len(problems) > 0 {
+		return toolResult("The fix report is invalid: "+strings.Join(problems, "; ")+". Call "+submitToolName+" again with the corrected report.", true)
+	}
+	s.mu.Lock()
+	s.report = report
+	s.mu.Unlock()
+	return toolResult("Fix report received. You are done; do not change anything further.", false)
+}
+
+func toolResult(text string, isError bool) map[string]any {
+	return map[string]any{
+		"content": []any{map[string]string{"type": "text", "text": text}},
+		"isError": isError,
+	}
+}
+
+// submitTool describes the submit_fix tool. Its input schema is
+// fixReportSchema without the conditions between fields, which tool schemas
+// don't support everywhere; submit checks those.
+func submitTool() map[string]any {
+	return map[string]any{
+		"name":        submitToolName,
+		"description": "Report the fix for the error, or why it could not be fixed. Call this once, when you are done.",
+		"inputSchema": fixSchema.unconditional(),
+	}
+}
+
+// unconditional returns a copy of s without anyOf, if, then and else.
+func (s *schema) unconditional() *schema {
+	c := *s
+	c.AnyOf, c.If, c.Then, c.Else = nil, nil, nil, nil
+	if s.Items != nil {
+		c.Items = s.Items.unconditional()
+	}
+	if s.Properties != nil {
+		c.Properties = make(map[string]*schema, len(s.Properties))
+		for name, p := range s.Properties {
+			c.Properties[name] = p.unconditional()
+		}
+	}
+	return &c
+}
+
+func writeRPC(w http.ResponseWriter, id json.RawMessage, result any, rpcErr *rpcError) {
+	resp := map[string]any{"jsonrpc": "2.0", "id": id}
+	if rpcErr != nil {
+		resp["error"] = rpcErr
+	} else {
+		resp["result"] = result
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Failed to write MCP response: %v", err)
+	}
+}
+
+// submitted returns the fix report the session submitted through s, parsed,
+// falling back to the JSON at the end of its output. A nil s only parses the
+// output.
+func (s *submitServer) submitted(output *cliOutput) (*FixResponse, error) {
+	var report json.RawMessage
+	if s != nil {
+		report = s.take()
+	}
+	if report == nil {
+		return parseResponse(output.Result)
+	}
+	var resp FixResponse
+	if err := json.Unmarshal(report, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse the submitted fix report: %v", err)
+	}
+	return &resp, nil
+}
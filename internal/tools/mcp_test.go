@@ -0,0 +1,79 @@
+package tools
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestSubmitServer(t *testing.T) {
+	s, err := startSubmitServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	call := func(t *testing.T, body string) (int, map[string]any) {
+		t.Helper()
+		resp, err := http.Post(s.url, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var msg map[string]any
+		json.NewDecoder(resp.Body).Decode(&msg)
+		return resp.StatusCode, msg
+	}
+
+	if _, msg := call(t, `{"jsonrpc": "2.0", "id": 1, "method": "initialize", "params": {"protocolVersion": "2025-03-26"}}`); msg["result"].(map[string]any)["protocolVersion"] != "2025-03-26" {
+		t.Errorf("initialize = %v, want the client's protocol version", msg)
+	}
+	if status, _ := call(t, `{"jsonrpc": "2.0", "method": "notifications/initialized"}`); status != http.StatusAccepted {
+		t.Errorf("notification status = %d, want %d", status, http.StatusAccepted)
+	}
+
+	_, msg := call(t, `{"jsonrpc": "2.0", "id": 2, "method": "tools/list"}`)
+	tools := msg["result"].(map[string]any)["tools"].([]any)
+	tool := tools[0].(map[string]any)
+	if len(tools) != 1 || tool["name"] != "submit_fix" {
+		t.Fatalf("tools/list = %v", msg)
+	}
+	if schema := tool["inputSchema"].(map[string]any); schema["type"] != "object" || schema["if"] != nil {
+		t.Errorf("inputSchema = %v, want an object schema without conditions", schema)
+	}
+
+	// An invalid report is rejected with its problems
+	_, msg = call(t, `{"jsonrpc": "2.0", "id": 3, "method": "tools/call", "params": {"name": "submit_fix", "arguments": {"success": true}}}`)
+	result := msg["result"].(map[string]any)
+	if result["isError"] != true || !strings.Contains(result["content"].([]any)[0].(map[string]any)["text"].(string), `missing required field "files"`) {
+		t.Errorf("tools/call with an invalid report = %v", msg)
+	}
+	if report := s.take(); report != nil {
+		t.Errorf("take() = %s after an invalid report", report)
+	}
+
+	_, msg = call(t, `{"jsonrpc": "2.0", "id": 4, "method": "tools/call", "params": {"name": "submit_fix", "arguments": {"success": false, "error": "cannot fix"}}}`)
+	if msg["result"].(map[string]any)["isError"] != false {
+		t.Errorf("tools/call with a valid report = %v", msg)
+	}
+	resp, err := s.submitted(&cliOutput{Result: "no report here"})
+	if err != nil || resp.Error != "cannot fix" {
+		t.Errorf("submitted() = %+v, %v, want the submitted report", resp, err)
+	}
+
+	// Without a submission the output's report is used
+	if _, err := s.submitted(&cliOutput{Result: "no report here"}); err == nil {
+		t.Error("submitted() error = nil without a report")
+	}
+
+	if _, msg := call(t, `{"jsonrpc": "2.0", "id": 5, "method": "tools/call", "params": {"name": "rm", "arguments": {}}}`); msg["error"] == nil {
+		t.Errorf("tools/call of an unknown tool = %v, want an error", msg)
+	}
+	if resp, err := http.Get(s.url); err != nil || resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET = %v, %v, want %d", resp, err, http.StatusMethodNotAllowed)
+	}
+	if resp, err := http.Post(s.url[:len(s.url)-4], "application/json", strings.NewReader(`{}`)); err != nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("POST without the token = %v, %v, want %d", resp, err, http.StatusNotFound)
+	}
+}
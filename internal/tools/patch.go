@@ -0,0 +1,189 @@
+package tools
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// hunk is one @@ section of a unified diff.
+type hunk struct {
+	// pos is the 0-based line the hunk's header says it starts at.
+	pos int
+	// old is the hunk's context and removed lines, and lines all of its
+	// lines, prefixed with ' ', '-' or '+'.
+	old, lines []string
+	// oldNoEOL and newNoEOL are set when the hunk ends its side of the file
+	// without a final newline.
+	oldNoEOL, newNoEOL bool
+}
+
+// ApplyPatch applies a unified diff of a single file to its content. Hunks
+// are found by their context and removed lines, searching outward from the
+// line their header gives, so diffs with wrong line numbers still apply;
+// trailing whitespace is ignored if no exact match is found. File headers
+// ("---", "+++") are optional.
+func ApplyPatch(content, diff string) (string, error) {
+	hunks, err := parseHunks(diff)
+	if err != nil {
+		return "", err
+	}
+	if len(hunks) == 0 {
+		return "", fmt.Errorf("diff has no hunks")
+	}
+
+	lines := strings.Split(content, "\n")
+	eol := content == "" || strings.HasSuffix(content, "\n")
+	if eol {
+		lines = lines[:len(lines)-1]
+	}
+
+	var out []string
+	next, offset := 0, 0
+	for i, h := range hunks {
+		at := findHunk(lines, h.old, next, h.pos+offset)
+		if at < 0 {
+			return "", fmt.Errorf("hunk %d does not match the file", i+1)
+		}
+		out = append(out, lines[next:at]...)
+		// Context keeps the file's own lines, which may differ in
+		// trailing whitespace
+		for _, line := range h.lines {
+			switch line[0] {
+			case ' ':
+				out = append(out, lines[at])
+				at++
+			case '-':
+				at++
+			case '+':
+				out = append(out, line[1:])
+			}
+		}
+		next = at
+		offset = next - len(h.old) - h.pos
+
+		if next == len(lines) {
+			switch {
+			case h.newNoEOL:
+				eol = false
+			case h.oldNoEOL:
+				eol = true
+			}
+		}
+	}
+	out = append(out, lines[next:]...)
+
+	if len(out) == 0 {
+		return "", nil
+	}
+	result := strings.Join(out, "\n")
+	if eol {
+		result += "\n"
+	}
+	return result, nil
+}
+
+// parseHunks reads the hunks of a unified diff.
+func parseHunks(diff string) ([]hunk, error) {
+	var hunks []hunk
+	var h *hunk
+	var last byte
+
+	for _, line := range strings.Split(strings.TrimSuffix(diff, "\n"), "\n") {
+		if strings.HasPrefix(line, "@@") {
+			pos, err := parseHunkHeader(line)
+			if err != nil {
+				return nil, err
+			}
+			hunks = append(hunks, hunk{pos: pos})
+			h = &hunks[len(hunks)-1]
+			continue
+		}
+		if h == nil {
+			// "diff --git", "---", "+++" and other headers
+			continue
+		}
+
+		if line == "" {
+			line = " "
+		}
+		kind := line[0]
+		switch kind {
+		case ' ', '-':
+			h.old = append(h.old, line[1:])
+			h.lines = append(h.lines, line)
+		case '+':
+			h.lines = append(h.lines, line)
+		case '\\':
+			// "\ No newline at end of file" marks the line before it
+			if last != '+' {
+				h.oldNoEOL = true
+			}
+			if last != '-' {
+				h.newNoEOL = true
+			}
+		default:
+			return nil, fmt.Errorf("unexpected line in hunk: %q", line)
+		}
+		last = kind
+	}
+	return hunks, nil
+}
+
+// parseHunkHeader returns the 0-based line a hunk with the header
+// "@@ -start,count +start,count @@" starts at.
+func parseHunkHeader(line string) (int, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 || !strings.HasPrefix(fields[1], "-") {
+		return 0, fmt.Errorf("invalid hunk header: %q", line)
+	}
+	start, count, hasCount := strings.Cut(fields[1][1:], ",")
+	n, err := strconv.Atoi(start)
+	if err != nil {
+		return 0, fmt.Errorf("invalid hunk header: %q", line)
+	}
+	// A hunk only adding lines starts after line start
+	if hasCount && count == "0" {
+		return n, nil
+	}
+	return max(n-1, 0), nil
+}
+
+// findHunk returns where old occurs in lines at or after from, preferring
+// the occurrence nearest want, or -1 if it doesn't.
+func findHunk(lines, old []string, from, want int) int {
+	if len(old) == 0 {
+		return min(max(want, from), len(lines))
+	}
+	for _, equal := range []func(a, b string) bool{
+		func(a, b string) bool { return a == b },
+		func(a, b string) bool { return strings.TrimRight(a, " \t\r") == strings.TrimRight(b, " \t\r") },
+	} {
+		best := -1
+		for at := from; at+len(old) <= len(lines); at++ {
+			if matchesAt(lines, old, at, equal) && (best < 0 || abs(at-want) < abs(best-want)) {
+				best = at
+			}
+		}
+		if best >= 0 {
+			return best
+		}
+	}
+	return -1
+}
+
+func matchesAt(lines, old []string, at int, equal func(a, b string) bool) bool {
+	for i, line := range old {
+		if !equal(lines[at+i], line) {
+			return false
+		}
+	}
+	return true
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,88 @@
+package tools
+
+import "testing"
+
+func TestApplyPatch(t *testing.T) {
+	const file = "def name(user):\n    user = load(user)\n    return user.name\n\n\ndef email(user):\n    return user.email\n"
+
+	tests := []struct {
+		name    string
+		content string
+		diff    string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "modify",
+			content: file,
+			diff:    "--- a/app.py\n+++ b/app.py\n@@ -1,3 +1,5 @@\n def name(user):\n     user = load(user)\n-    return user.name\n+    if user is None:\n+        return None\n+    return user.name\n",
+			want:    "def name(user):\n    user = load(user)\n    if user is None:\n        return None\n    return user.name\n\n\ndef email(user):\n    return user.email\n",
+		},
+		{
+			name:    "wrong line numbers",
+			content: file,
+			diff:    "@@ -40,2 +40,2 @@\n def email(user):\n-    return user.email\n+    return user.email or \"\"\n",
+			want:    "def name(user):\n    user = load(user)\n    return user.name\n\n\ndef email(user):\n    return user.email or \"\"\n",
+		},
+		{
+			name:    "several hunks",
+			content: file,
+			diff:    "@@ -1,1 +1,1 @@\n-def name(user):\n+def name(user=None):\n@@ -6,1 +6,1 @@\n-def email(user):\n+def email(user=None):\n",
+			want:    "def name(user=None):\n    user = load(user)\n    return user.name\n\n\ndef email(user=None):\n    return user.email\n",
+		},
+		{
+			name:    "insertion without context",
+			content: "a\nb\nc\n",
+			diff:    "@@ -2,0 +3,1 @@\n+b2\n",
+			want:    "a\nb\nb2\nc\n",
+		},
+		{
+			name:    "blank context line without its space",
+			content: file,
+			diff:    "@@ -3,4 +3,3 @@\n     return user.name\n\n-\n def email(user):\n",
+			want:    "def name(user):\n    user = load(user)\n    return user.name\n\ndef email(user):\n    return user.email\n",
+		},
+		{
+			name:    "trailing whitespace",
+			content: "a  \nb\n",
+			diff:    "@@ -1,2 +1,2 @@\n a\n-b\n+c\n",
+			want:    "a  \nc\n",
+		},
+		{
+			name:    "no newline at end of file",
+			content: "a\nb",
+			diff:    "@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n",
+			want:    "a\nc\n",
+		},
+		{
+			name:    "new file",
+			content: "",
+			diff:    "--- /dev/null\n+++ b/new.py\n@@ -0,0 +1,2 @@\n+x = 1\n+y = 2\n",
+			want:    "x = 1\ny = 2\n",
+		},
+		{
+			name:    "context does not match",
+			content: file,
+			diff:    "@@ -1,2 +1,2 @@\n def nome(user):\n-    user = load(user)\n+    user = fetch(user)\n",
+			wantErr: true,
+		},
+		{
+			name:    "no hunks",
+			content: file,
+			diff:    "complete new file content",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ApplyPatch(tt.content, tt.diff)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ApplyPatch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ApplyPatch() =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package tools
+
+import "strings"
+
+// platformGuide is prompt guidance for the errors of one platform: how to
+// read them, what usually causes them and how to check a fix.
+type platformGuide struct {
+	name string
+	// platforms are the Sentry platforms the guide is for.
+	platforms []string
+	guidance  []string
+	// hints apply to errors whose type or message contains their key.
+	hints []errorHint
+	// checks are ways to validate a fix before reporting it.
+	checks []string
+}
+
+type errorHint struct {
+	match string
+	hint  string
+}
+
+var platformGuides = []platformGuide{
+	{
+		name:      "Go",
+		platforms: []string{"go"},
+		guidance: []string{
+			"A panic's stacktrace lists the goroutine that panicked; the panic happens in the innermost [IN APP] frame, but the bad value usually comes from a caller.",
+			"Prefer returning an error over recovering from the panic, and never add a recover() just to hide it.",
+			"Check whether the value is shared between goroutines before guarding it; a data race needs a lock or channel, not a nil check.",
+		},
+		hints: []errorHint{
+			{"nil pointer dereference", "Find where the nil pointer, map or interface comes from (a failed lookup, an ignored error, a zero-value struct field) and handle it there."},
+			{"index out of range", "Check the length before indexing and work out why the slice is shorter than the code assumes, e.g. an empty result or an off-by-one bound."},
+			{"concurrent map", "The map is written from several goroutines. Protect it with a sync.Mutex or use sync.Map; do not just retry."},
+			{"interface conversion", "Use the two-value type assertion (v, ok := x.(T)) and handle the unexpected type."},
+		},
+		checks: []string{
+			"The code compiles (`go build ./...`) and passes `go vet ./...`.",
+			"The package's tests pass (`go test` in the changed packages, with `-race` if goroutines are involved).",
+		},
+	},
+	{
+		name:      "Python",
+		platforms: []string{"python"},
+		guidance: []string{
+			"The innermost [IN APP] frame raised the error; the local variables of its callers show how the bad value got there.",
+			"If the exception was raised while handling another (\"During handling of the above exception\"), fix the original one.",
+			"Do not wrap code in a bare `except:` or `except Exception:` to silence the error.",
+		},
+		hints: []errorHint{
+			{"NoneType", "A value is None where the code expects an object. Find out why it is None (a missing row, an optional field, a function without a return) and handle that case explicitly."},
+			{"KeyError", "Use `.get()` with a sensible default only if a missing key is expected; otherwise fix whatever should have set the key."},
+			{"AttributeError", "Check the object's actual type at that point; the attribute may be missing on a subclass, a mock or an older version of a dependency."},
+			{"TypeError", "Compare the call with the function's signature and the types of its arguments in the frame's variables."},
+		},
+		checks: []string{
+			"The changed modules import without errors and keep their existing type hints valid.",
+			"The project's tests pass (e.g. `pytest` for the affected package).",
+		},
+	},
+	{
+		name:      "JavaScript",
+		platforms: []string{"javascript", "node"},
+		guidance: []string{
+			"Errors in asynchronous code often surface far from their cause; look at the promise chain or callback that produced the value.",
+			"If the project uses TypeScript, fix the types so the compiler would have caught the error, rather than casting it away.",
+			"Check whether the code runs in browsers, Node or both; browser-only errors can come from old browsers or extensions rather than the code.",
+		},
+		hints: []errorHint{
+			{"Cannot read properties of undefined", "Find why the object is undefined (an unresolved promise, a missing API field, state that is not loaded yet) and handle it there; use optional chaining only where the value is legitimately optional."},
+			{"Cannot read properties of null", "Check whether the DOM element or API value can be null at that point, e.g. before the page renders or when a lookup finds nothing."},
+			{"is not a function", "Check the value's actual type: an import mismatch (default vs named), a shadowed variable or a changed API."},
+			{"TypeError", "Check the types flowing into the failing expression, including values from JSON and API responses."},
+		},
+		checks: []string{
+			"The code type-checks (`tsc --noEmit` for TypeScript projects) and passes the linter.",
+			"The project's tests pass (e.g. `npm test`).",
+		},
+	},
+	{
+		name:      "JVM",
+		platforms: []string{"java", "kotlin", "scala", "groovy", "clojure"},
+		guidance: []string{
+			"Exceptions may be wrapped: the innermost \"Caused by\" exception is usually the one to fix.",
+			"Do not catch and swallow the exception; handle the condition or let it propagate with context.",
+			"In Kotlin, prefer the type system (nullable types, safe calls) over `!!` and unchecked casts.",
+		},
+		hints: []errorHint{
+			{"NullPointerException", "Find where the null value comes from (an absent Optional, a missing map entry, an uninitialized field) and handle it there; use the helpful NPE message to see which expression was null."},
+			{"ConcurrentModificationException", "The collection is modified while being iterated; use an iterator's remove(), iterate over a copy or use a concurrent collection."},
+			{"ClassCastException", "Check the actual runtime type and the generic types involved; unchecked casts from raw types are a common cause."},
+			{"IndexOutOfBoundsException", "Check the size before accessing and work out why the collection is smaller than expected."},
+		},
+		checks: []string{
+			"The project compiles (e.g. `./gradlew compileJava` or `mvn compile`).",
+			"The affected module's tests pass (e.g. `./gradlew test` or `mvn test`).",
+		},
+	},
+}
+
+// platformGuideFor returns the guide for req's platform, or nil if there is
+// none.
+func platformGuideFor(req *FixRequest) *platformGuide {
+	platform := strings.ToLower(req.Platform)
+	for i := range platformGuides {
+		for _, p := range platformGuides[i].platforms {
+			if platform == p {
+				return &platformGuides[i]
+			}
+		}
+	}
+	return nil
+}
+
+// writePlatformGuide adds the guidance for req's platform, with the hints
+// for its error.
+func writePlatformGuide(sb *strings.Builder, req *FixRequest) {
+	guide := platformGuideFor(req)
+	if guide == nil {
+		return
+	}
+
+	sb.WriteString("\n## " + guide.name + " Errors\n")
+	for _, g := range guide.guidance {
+		sb.WriteString("- " + g + "\n")
+	}
+	for _, h := range guide.hints {
+		if strings.Contains(req.ErrorType, h.match) || strings.Contains(req.ErrorMessage, h.match) {
+			sb.WriteString("- " + h.hint + "\n")
+			break
+		}
+	}
+
+	sb.WriteString("\nBefore reporting the fix, check that:\n")
+	for _, c := range guide.checks {
+		sb.WriteString("- " + c + "\n")
+	}
+}
@@ -0,0 +1,25 @@
+//go:build !unix
+
+package tools
+
+import (
+	"context"
+	"os/exec"
+)
+
+// killProcessTree bounds how long cmd's output is awaited once its context is
+// done. Process groups are unavailable here, so only cmd itself is killed.
+func killProcessTree(cmd *exec.Cmd) {
+	cmd.WaitDelay = processWaitDelay
+}
+
+// runProcessTree runs cmd, set up with killProcessTree.
+func runProcessTree(cmd *exec.Cmd) error {
+	return cmd.Run()
+}
+
+// limitedCommand is exec.CommandContext; resource limits other than output
+// are only applied on Unix.
+func limitedCommand(ctx context.Context, limits ProcessLimits, name string, args ...string) *exec.Cmd {
+	return exec.CommandContext(ctx, name, args...)
+}
@@ -0,0 +1,55 @@
+//go:build unix
+
+package tools
+
+import (
+	"context"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// killProcessTree runs cmd in its own process group and, when its context is
+// done, kills the whole group, so subprocesses it started (shells, test
+// runners, language servers) don't outlive it.
+func killProcessTree(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = processWaitDelay
+}
+
+// runProcessTree runs cmd, set up with killProcessTree, and then kills what
+// is left of its process group, so processes it left running in the
+// background don't outlive it either.
+func runProcessTree(cmd *exec.Cmd) error {
+	err := cmd.Run()
+	if cmd.Process != nil {
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	return err
+}
+
+// limitedCommand is exec.CommandContext running name with args under the
+// resource limits in limits, which are set by a shell before it execs name.
+func limitedCommand(ctx context.Context, limits ProcessLimits, name string, args ...string) *exec.Cmd {
+	var ulimits []string
+	if limits.Memory > 0 {
+		ulimits = append(ulimits, "ulimit -d "+strconv.FormatInt(max(limits.Memory/1024, 1), 10))
+	}
+	if limits.CPUTime > 0 {
+		ulimits = append(ulimits, "ulimit -t "+strconv.FormatInt(max(int64(limits.CPUTime/time.Second), 1), 10))
+	}
+	if limits.FileSize > 0 {
+		// In 512-byte blocks
+		ulimits = append(ulimits, "ulimit -f "+strconv.FormatInt(max(limits.FileSize/512, 1), 10))
+	}
+	if len(ulimits) == 0 {
+		return exec.CommandContext(ctx, name, args...)
+	}
+	script := strings.Join(ulimits, " && ") + ` && exec "$0" "$@"`
+	return exec.CommandContext(ctx, "sh", append([]string{"-c", script, name}, args...)...)
+}
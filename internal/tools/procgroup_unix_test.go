@@ -0,0 +1,74 @@
+//go:build unix
+
+package tools
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestKillProcessTree(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// The background sleep inherits stdout; unless it is killed too, Run
+	// waits for it until WaitDelay
+	cmd := exec.CommandContext(ctx, "sh", "-c", "sleep 30 & wait")
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	killProcessTree(cmd)
+
+	start := time.Now()
+	if err := cmd.Run(); err == nil {
+		t.Fatal("Run() error = nil, want killed")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Run() returned after %s, want the process tree killed promptly", elapsed)
+	}
+}
+
+func TestRunProcessTree(t *testing.T) {
+	// The shell exits at once, leaving sleep running in the background
+	cmd := exec.CommandContext(context.Background(), "sh", "-c", "sleep 30 >/dev/null 2>&1 & echo $!")
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	killProcessTree(cmd)
+
+	if err := runProcessTree(cmd); err != nil {
+		t.Fatalf("runProcessTree() error = %v", err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(stdout.String()))
+	if err != nil {
+		t.Fatalf("unexpected output %q", stdout.String())
+	}
+
+	for deadline := time.Now().Add(2 * time.Second); running(pid); {
+		if time.Now().After(deadline) {
+			syscall.Kill(pid, syscall.SIGKILL)
+			t.Fatal("background process outlived the command")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// running reports whether the process pid exists and isn't a zombie.
+func running(pid int) bool {
+	if syscall.Kill(pid, 0) != nil {
+		return false
+	}
+	stat, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return !errors.Is(err, os.ErrNotExist)
+	}
+	// The state follows the parenthesized command name
+	_, state, _ := strings.Cut(string(stat), ") ")
+	return !strings.HasPrefix(state, "Z")
+}
@@ -0,0 +1,118 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Review verdicts.
+const (
+	ReviewApprove        = "approve"
+	ReviewRequestChanges = "request_changes"
+	ReviewVeto           = "veto"
+)
+
+// ReviewRequest is a generated fix for a reviewer to check against the
+// error it fixes.
+type ReviewRequest struct {
+	Fix *FixRequest
+	// Description is how the fix's author described it.
+	Description string
+	// Diff is the fix as a unified diff.
+	Diff string
+}
+
+// ReviewResponse is a reviewer's verdict on a fix.
+type ReviewResponse struct {
+	Verdict string `json:"verdict"`
+	// Feedback explains the verdict; for ReviewRequestChanges, what to
+	// change.
+	Feedback string `json:"feedback"`
+
+	// CostUSD is what the review cost, if reported.
+	CostUSD float64 `json:"-"`
+	// InputTokens and OutputTokens are the tokens the review used.
+	InputTokens  int `json:"-"`
+	OutputTokens int `json:"-"`
+}
+
+// reviewOutputInstructions tells the model how to report its verdict.
+const reviewOutputInstructions = `
+Do not modify any files. When you have reviewed the fix, output your verdict in the following JSON format (and nothing else after the JSON):
+
+` + "```json" + `
+{
+  "verdict": "approve",
+  "feedback": "Why the fix is right, or what must change"
+}
+` + "```" + `
+
+The verdict is one of:
+- "approve": the fix addresses the root cause of the error correctly and safely
+- "request_changes": the fix is on the right track but must change; say exactly what in the feedback
+- "veto": the fix should not be proposed at all, for example because it masks the error, risks data loss or security, or the error is not a code bug`
+
+// buildReviewPrompt constructs the prompt asking for a review of a fix.
+func buildReviewPrompt(req *ReviewRequest) string {
+	var sb strings.Builder
+
+	sb.WriteString("An automated agent wrote the fix below for a production error. Review it before it is proposed as a pull request. Here is the error:\n\n")
+	writeErrorReport(&sb, req.Fix)
+
+	sb.WriteString("\n## Proposed Fix\n")
+	if req.Description != "" {
+		sb.WriteString(req.Description + "\n\n")
+	}
+	sb.WriteString("```diff\n" + req.Diff + "```\n")
+
+	sb.WriteString("\n## Instructions\n")
+	sb.WriteString("1. Read the code around the change in the repository\n")
+	sb.WriteString("2. Check that the fix addresses the root cause of the error, not just its symptom\n")
+	sb.WriteString("3. Look for regressions, unhandled cases, and behavior changes beyond the fix\n")
+	sb.WriteString("4. Check it follows the repository's existing patterns and style\n")
+	sb.WriteString(reviewOutputInstructions)
+
+	return sb.String()
+}
+
+// parseReview decodes the verdict JSON the model ends its output with.
+func parseReview(output string) (*ReviewResponse, error) {
+	jsonStr := trailingJSON(output)
+	if jsonStr == "" {
+		return nil, errors.New("no verdict JSON found in review output")
+	}
+
+	var resp ReviewResponse
+	if err := json.Unmarshal([]byte(jsonStr), &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse review verdict: %w", err)
+	}
+	switch resp.Verdict {
+	case ReviewApprove, ReviewRequestChanges, ReviewVeto:
+		return &resp, nil
+	default:
+		return nil, fmt.Errorf("unknown review verdict %q", resp.Verdict)
+	}
+}
+
+// ReviewFix uses Claude Code to review a fix in the repository it applies
+// to.
+func (c *ClaudeCodeTool) ReviewFix(ctx context.Context, req *ReviewRequest) (*ReviewResponse, error) {
+	output, err := c.runClaudeCode(ctx, req.Fix.IssueID, buildReviewPrompt(req), buildSystemPrompt(req.Fix), "", "")
+	if err != nil {
+		return nil, err
+	}
+	if output.Subtype == "error_max_turns" {
+		return nil, fmt.Errorf("Claude Code reached its limit of %d turns before finishing the review", c.opts.MaxTurns)
+	}
+
+	resp, err := parseReview(output.Result)
+	if err != nil {
+		return nil, err
+	}
+	resp.CostUSD = output.CostUSD
+	resp.InputTokens, resp.OutputTokens = output.InputTokens, output.OutputTokens
+	return resp, nil
+}
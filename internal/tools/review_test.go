@@ -0,0 +1,93 @@
+package tools
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseReview(t *testing.T) {
+	tests := []struct {
+		name        string
+		output      string
+		wantVerdict string
+		wantErr     bool
+	}{
+		{
+			name:        "fenced",
+			output:      "The fix looks right.\n\n```json\n{\"verdict\": \"approve\", \"feedback\": \"Handles the nil user.\"}\n```",
+			wantVerdict: ReviewApprove,
+		},
+		{
+			name:        "bare",
+			output:      `{"verdict": "request_changes", "feedback": "Also guard the caller."}`,
+			wantVerdict: ReviewRequestChanges,
+		},
+		{name: "unknown verdict", output: `{"verdict": "maybe"}`, wantErr: true},
+		{name: "no json", output: "Looks good to me.", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseReview(tt.output)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseReview() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got.Verdict != tt.wantVerdict {
+				t.Errorf("parseReview() verdict = %q, want %q", got.Verdict, tt.wantVerdict)
+			}
+		})
+	}
+}
+
+func TestBuildReviewPrompt(t *testing.T) {
+	prompt := buildReviewPrompt(&ReviewRequest{
+		Fix:         &FixRequest{IssueID: "12345", ErrorType: "AttributeError"},
+		Description: "Guard against a missing user",
+		Diff:        "--- a/app.py\n+++ b/app.py\n@@ -1,1 +1,1 @@\n-x\n+y\n",
+	})
+
+	for _, want := range []string{
+		"- **Error Type**: AttributeError",
+		"Guard against a missing user",
+		"```diff\n--- a/app.py",
+		`"verdict": "approve"`,
+		"Do not modify any files",
+	} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("buildReviewPrompt() missing %q", want)
+		}
+	}
+}
+
+func TestBuildPrompt_Revision(t *testing.T) {
+	prompt := buildPrompt(&FixRequest{
+		IssueID:  "12345",
+		Revision: &Revision{Diff: "-x\n+y\n", Feedback: "Fix the caller instead."},
+	})
+	for _, want := range []string{"## Review of a Previous Attempt", "Fix the caller instead.", "```diff\n-x\n+y\n```"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("buildPrompt() missing %q", want)
+		}
+	}
+}
+
+func TestBuildPrompt_FailedAttempt(t *testing.T) {
+	prompt := buildPrompt(&FixRequest{
+		IssueID: "12345",
+		FailedAttempt: &FailedAttempt{
+			Diff:   "-x\n+y\n",
+			Error:  "tests failed with the fix applied (make test)",
+			Output: "FAIL: test_user",
+		},
+	})
+	for _, want := range []string{
+		"## Failure of a Previous Attempt",
+		"rejected: tests failed with the fix applied (make test).",
+		"```\nFAIL: test_user\n```",
+		"```diff\n-x\n+y\n```",
+	} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("buildPrompt() missing %q", want)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package tools
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// sandboxWorkDir is where the clone is mounted inside the sandbox.
+const sandboxWorkDir = "/workspace"
+
+// DockerSandbox runs each Claude Code session, and each command checking a
+// fix, in its own container, which sees only the job's clone, so a tool
+// call or a test can't touch the host or other jobs' workspaces.
+type DockerSandbox struct {
+	// Image has the claude CLI (and git) installed, along with the
+	// toolchains the repositories' builds, tests and formatters need.
+	Image string
+	// Network the container joins. Docker can't limit egress to hosts by
+	// itself, so this is typically an internal network whose only way out
+	// is Proxy.
+	Network string
+	// Proxy, if set, is passed to the container as HTTPS_PROXY.
+	Proxy string
+	// CPUs and Memory are passed as --cpus and --memory, e.g. "2" and
+	// "4g"; PidsLimit as --pids-limit. Zero values leave them unlimited.
+	CPUs      string
+	Memory    string
+	PidsLimit int
+}
+
+// args builds the docker command line running command in a container named
+// name, with the clone in workDir mounted read-write and everything else
+// read-only. The container's environment holds only env; variables given
+// by name alone, like the API key, are copied from the docker client's
+// environment rather than given on the command line.
+func (s *DockerSandbox) args(name, workDir string, env, command []string) []string {
+	args := []string{
+		"run", "--rm", "--interactive", "--name", name,
+		"--read-only", "--tmpfs", "/tmp",
+		"--cap-drop", "ALL", "--security-opt", "no-new-privileges",
+		"--volume", workDir + ":" + sandboxWorkDir, "--workdir", sandboxWorkDir,
+		// The CLI and build tools keep their settings and caches under HOME
+		"--env", "HOME=/tmp",
+	}
+	for _, v := range env {
+		args = append(args, "--env", v)
+	}
+	// Files the agent writes should belong to us, not root
+	if uid, gid := os.Getuid(), os.Getgid(); uid >= 0 {
+		args = append(args, "--user", strconv.Itoa(uid)+":"+strconv.Itoa(gid))
+	}
+	if s.Network != "" {
+		args = append(args, "--network", s.Network)
+	}
+	if s.Proxy != "" {
+		args = append(args, "--env", "HTTPS_PROXY="+s.Proxy)
+	}
+	if s.CPUs != "" {
+		args = append(args, "--cpus", s.CPUs)
+	}
+	if s.Memory != "" {
+		args = append(args, "--memory", s.Memory)
+	}
+	if s.PidsLimit > 0 {
+		args = append(args, "--pids-limit", strconv.Itoa(s.PidsLimit))
+	}
+	args = append(args, s.Image)
+	return append(args, command...)
+}
+
+// command returns the docker command running command with env in a
+// container named after kind. Killing the docker client doesn't stop its
+// container, so cancelling the command removes the container as well.
+func (s *DockerSandbox) command(ctx context.Context, kind, workDir string, env, command []string) *exec.Cmd {
+	name := "sentryagent-" + kind + "-" + randomSuffix()
+	cmd := exec.CommandContext(ctx, "docker", s.args(name, workDir, env, command)...)
+	killProcessTree(cmd)
+	kill := cmd.Cancel
+	cmd.Cancel = func() error {
+		// ctx is already done, so this can't use it
+		exec.Command("docker", "rm", "--force", name).Run()
+		if kill != nil {
+			return kill()
+		}
+		return cmd.Process.Kill()
+	}
+	return cmd
+}
+
+// randomSuffix makes container names unique across concurrent sessions.
+func randomSuffix() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
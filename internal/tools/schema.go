@@ -0,0 +1,246 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// maxSchemaErrors caps how many problems a validation reports.
+const maxSchemaErrors = 10
+
+// fixReportSchema is the JSON Schema of the fix report the model ends its
+// output with; see FixResponse.
+const fixReportSchema = `{
+  "type": "object",
+  "required": ["success"],
+  "properties": {
+    "success": {"type": "boolean"},
+    "error": {"type": "string"},
+    "description": {"type": "string", "minLength": 1},
+    "files": {
+      "type": "array",
+      "minItems": 1,
+      "items": {
+        "type": "object",
+        "required": ["path", "change_type"],
+        "properties": {
+          "path": {"type": "string", "minLength": 1},
+          "change_type": {"enum": ["modify", "create", "delete"]},
+          "content": {"type": "string"},
+          "diff": {"type": "string"},
+          "test": {"type": "boolean"}
+        },
+        "if": {"properties": {"change_type": {"const": "create"}}},
+        "then": {"required": ["content"]},
+        "else": {
+          "if": {"properties": {"change_type": {"const": "modify"}}},
+          "then": {"anyOf": [{"required": ["content"]}, {"required": ["diff"]}]}
+        }
+      }
+    },
+    "pr_title": {"type": "string"},
+    "pr_body": {"type": "string"},
+    "test_filter": {"type": "string"},
+    "confidence": {"type": "number", "minimum": 0, "maximum": 1},
+    "root_cause": {"type": "string"},
+    "fix_explanation": {"type": "string"},
+    "risk_level": {"enum": ["low", "medium", "high"]},
+    "risk_reason": {"type": "string"},
+    "affected": {"type": "string"},
+    "testing_notes": {"type": "string"}
+  },
+  "if": {"properties": {"success": {"const": true}}},
+  "then": {"required": ["description", "files", "confidence"]},
+  "else": {"required": ["error"]}
+}`
+
+// fixSchema is fixReportSchema, parsed.
+var fixSchema = mustParseSchema(fixReportSchema)
+
+// schema is the subset of JSON Schema fix reports are described with.
+type schema struct {
+	Type       string             `json:"type,omitempty"`
+	Properties map[string]*schema `json:"properties,omitempty"`
+	Required   []string           `json:"required,omitempty"`
+	Items      *schema            `json:"items,omitempty"`
+	Enum       []any              `json:"enum,omitempty"`
+	Const      any                `json:"const,omitempty"`
+	Minimum    *float64           `json:"minimum,omitempty"`
+	Maximum    *float64           `json:"maximum,omitempty"`
+	MinLength  int                `json:"minLength,omitempty"`
+	MinItems   int                `json:"minItems,omitempty"`
+	AnyOf      []*schema          `json:"anyOf,omitempty"`
+	If         *schema            `json:"if,omitempty"`
+	Then       *schema            `json:"then,omitempty"`
+	Else       *schema            `json:"else,omitempty"`
+}
+
+func mustParseSchema(s string) *schema {
+	var sc schema
+	if err := json.Unmarshal([]byte(s), &sc); err != nil {
+		panic("tools: invalid schema: " + err.Error())
+	}
+	return &sc
+}
+
+// validate checks the decoded JSON value v against s, returning a
+// description of each problem found, at most maxSchemaErrors, located by
+// their path such as "files[0].path".
+func (s *schema) validate(v any) []string {
+	var problems []string
+	s.check("", v, &problems)
+	if len(problems) > maxSchemaErrors {
+		problems = append(problems[:maxSchemaErrors], fmt.Sprintf("and %d more", len(problems)-maxSchemaErrors))
+	}
+	return problems
+}
+
+func (s *schema) check(path string, v any, problems *[]string) {
+	report := func(format string, args ...any) {
+		where := path
+		if where == "" {
+			where = "report"
+		}
+		*problems = append(*problems, where+": "+fmt.Sprintf(format, args...))
+	}
+
+	if s.Type != "" && jsonType(v) != s.Type {
+		report("must be %s, got %s", withArticle(s.Type), withArticle(jsonType(v)))
+		return
+	}
+	if s.Const != nil && !reflect.DeepEqual(v, s.Const) {
+		report("must be %s", quoteJSON(s.Const))
+	}
+	if len(s.Enum) > 0 && !containsValue(s.Enum, v) {
+		choices := make([]string, len(s.Enum))
+		for i, e := range s.Enum {
+			choices[i] = quoteJSON(e)
+		}
+		report("must be one of %s, got %s", strings.Join(choices, ", "), quoteJSON(v))
+	}
+
+	switch v := v.(type) {
+	case string:
+		if len(v) < s.MinLength {
+			report("must not be empty")
+		}
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			report("must be at least %g, got %g", *s.Minimum, v)
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			report("must be at most %g, got %g", *s.Maximum, v)
+		}
+	case []any:
+		if len(v) < s.MinItems {
+			report("must have at least %d item(s)", s.MinItems)
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				s.Items.check(fmt.Sprintf("%s[%d]", path, i), item, problems)
+			}
+		}
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				report("missing required field %q", name)
+			}
+		}
+		names := make([]string, 0, len(s.Properties))
+		for name := range s.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if value, ok := v[name]; ok {
+				s.Properties[name].check(joinPath(path, name), value, problems)
+			}
+		}
+	}
+
+	if len(s.AnyOf) > 0 {
+		var first []string
+		for i, alt := range s.AnyOf {
+			var altProblems []string
+			alt.check(path, v, &altProblems)
+			if len(altProblems) == 0 {
+				first = nil
+				break
+			}
+			if i == 0 {
+				first = altProblems
+			}
+		}
+		if first != nil {
+			report("does not match any allowed form, e.g. %s", strings.Join(first, "; "))
+		}
+	}
+
+	if s.If != nil {
+		var ifProblems []string
+		s.If.check(path, v, &ifProblems)
+		if len(ifProblems) == 0 {
+			if s.Then != nil {
+				s.Then.check(path, v, problems)
+			}
+		} else if s.Else != nil {
+			s.Else.check(path, v, problems)
+		}
+	}
+}
+
+// jsonType names the JSON type of a value decoded by encoding/json.
+func jsonType(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func withArticle(typ string) string {
+	switch typ {
+	case "null":
+		return typ
+	case "array", "object":
+		return "an " + typ
+	}
+	return "a " + typ
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func containsValue(values []any, v any) bool {
+	for _, value := range values {
+		if reflect.DeepEqual(value, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func quoteJSON(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
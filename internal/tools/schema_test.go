@@ -0,0 +1,84 @@
+package tools
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestFixSchema_Validate(t *testing.T) {
+	tests := []struct {
+		name   string
+		report string
+		want   []string
+	}{
+		{
+			name:   "valid fix",
+			report: `{"success": true, "description": "Guard against nil user", "confidence": 0.8, "files": [{"path": "app.py", "content": "x", "change_type": "modify"}]}`,
+		},
+		{
+			name:   "valid diff",
+			report: `{"success": true, "description": "d", "confidence": 1, "files": [{"path": "app.py", "diff": "@@", "change_type": "modify"}, {"path": "old.py", "change_type": "delete"}]}`,
+		},
+		{
+			name:   "valid failure",
+			report: `{"success": false, "error": "cannot reproduce"}`,
+		},
+		{
+			name:   "failure without error",
+			report: `{"success": false}`,
+			want:   []string{`report: missing required field "error"`},
+		},
+		{
+			name:   "missing fields",
+			report: `{"success": true, "description": "d"}`,
+			want:   []string{`report: missing required field "files"`, `report: missing required field "confidence"`},
+		},
+		{
+			name:   "wrong types",
+			report: `{"success": "yes", "confidence": "high"}`,
+			want:   []string{`confidence: must be a number, got a string`, `success: must be a boolean, got a string`, `report: missing required field "error"`},
+		},
+		{
+			name:   "confidence out of range",
+			report: `{"success": true, "description": "d", "confidence": 80, "files": [{"path": "a.py", "content": "x", "change_type": "create"}]}`,
+			want:   []string{`confidence: must be at most 1, got 80`},
+		},
+		{
+			name:   "bad files",
+			report: `{"success": true, "description": "d", "confidence": 0.5, "files": [{"path": "", "change_type": "rename"}, {"path": "b.py", "change_type": "modify"}, {"path": "c.py", "change_type": "create"}]}`,
+			want: []string{
+				`files[0].change_type: must be one of "modify", "create", "delete", got "rename"`,
+				`files[0].path: must not be empty`,
+				`files[1]: does not match any allowed form, e.g. files[1]: missing required field "content"`,
+				`files[2]: missing required field "content"`,
+			},
+		},
+		{
+			name:   "not an object",
+			report: `[]`,
+			want:   []string{`report: must be an object, got an array`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var report any
+			if err := json.Unmarshal([]byte(tt.report), &report); err != nil {
+				t.Fatal(err)
+			}
+			got := fixSchema.validate(report)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("validate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseResponse_Invalid(t *testing.T) {
+	_, err := parseResponse("Done.\n```json\n{\"success\": true, \"files\": []}\n```")
+	want := `the JSON fix report is invalid: files: must have at least 1 item(s); report: missing required field "description"; report: missing required field "confidence"`
+	if err == nil || err.Error() != want {
+		t.Errorf("parseResponse() error = %v, want %q", err, want)
+	}
+}
@@ -0,0 +1,46 @@
+package tools
+
+import "context"
+
+// Sessions caps how many Claude Code sessions run at once across the
+// process, however many jobs are being processed. A nil Sessions imposes no
+// cap.
+type Sessions struct {
+	slots chan struct{}
+}
+
+// NewSessions allows up to max concurrent sessions, or returns nil if max is
+// not positive.
+func NewSessions(max int) *Sessions {
+	if max <= 0 {
+		return nil
+	}
+	return &Sessions{slots: make(chan struct{}, max)}
+}
+
+// Acquire waits for a free session slot. The returned function releases it.
+func (s *Sessions) Acquire(ctx context.Context) (release func(), err error) {
+	if s == nil {
+		return func() {}, nil
+	}
+	select {
+	case s.slots <- struct{}{}:
+		return func() { <-s.slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// TryAcquire takes a free session slot without waiting. It reports false if
+// none is free.
+func (s *Sessions) TryAcquire() (release func(), ok bool) {
+	if s == nil {
+		return func() {}, true
+	}
+	select {
+	case s.slots <- struct{}{}:
+		return func() { <-s.slots }, true
+	default:
+		return nil, false
+	}
+}
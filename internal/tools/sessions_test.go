@@ -0,0 +1,53 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSessions(t *testing.T) {
+	s := NewSessions(2)
+
+	first, err := s.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	if _, err := s.Acquire(context.Background()); err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+
+	// A third session waits for a free slot
+	if _, ok := s.TryAcquire(); ok {
+		t.Error("TryAcquire() over the cap succeeded")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := s.Acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Acquire() over the cap error = %v, want DeadlineExceeded", err)
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		if release, err := s.Acquire(context.Background()); err == nil {
+			release()
+		}
+		close(acquired)
+	}()
+	first()
+	select {
+	case <-acquired:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Acquire() did not proceed after a slot was released")
+	}
+}
+
+func TestSessions_Unlimited(t *testing.T) {
+	var s *Sessions = NewSessions(0)
+	for i := 0; i < 10; i++ {
+		if _, err := s.Acquire(context.Background()); err != nil {
+			t.Fatalf("Acquire() error = %v", err)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"path"
+	"strings"
+)
+
+// CloneOptions controls how much of a repository is fetched and checked out.
+type CloneOptions struct {
+	// Depth is the number of commits of history fetched; 0 fetches all of it.
+	Depth int
+	// Sparse, when not empty, limits the checkout to top-level files and the
+	// directories of the repository files these paths, such as stack trace
+	// filenames, refer to. Everything is checked out when none match.
+	Sparse []string
+}
+
+// applySparse limits the working tree of the repository at dir to what
+// opts.Sparse refers to in rev, or restores a full working tree. It takes
+// effect on the next checkout.
+func applySparse(ctx context.Context, dir, token, rev string, opts CloneOptions) error {
+	var dirs []string
+	if len(opts.Sparse) > 0 {
+		out, err := gitOutput(ctx, dir, token, "ls-tree", "-r", "-z", "--name-only", rev)
+		if err != nil {
+			return err
+		}
+		files := strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+		if dirs = sparseDirs(files, opts.Sparse); len(dirs) == 0 {
+			log.Printf("No stack trace paths found in the repository, checking out everything")
+		}
+	}
+
+	if len(dirs) == 0 {
+		return runGit(ctx, dir, token, "sparse-checkout", "disable")
+	}
+	log.Printf("Sparse checkout of %s", strings.Join(dirs, ", "))
+	return runGit(ctx, dir, token, append([]string{"sparse-checkout", "set", "--cone", "--"}, dirs...)...)
+}
+
+// sparseDirs returns the directories of the files each path refers to. A
+// path refers to the files sharing the longest run of trailing path
+// components with it, so deployment prefixes like /srv/app or webpack:///
+// don't matter; paths matching several files equally well are skipped.
+func sparseDirs(files, paths []string) []string {
+	byName := make(map[string][]string)
+	for _, f := range files {
+		byName[path.Base(f)] = append(byName[path.Base(f)], f)
+	}
+
+	seen := make(map[string]bool)
+	var dirs []string
+	for _, p := range paths {
+		parts := splitPath(p)
+		if len(parts) == 0 {
+			continue
+		}
+
+		var best []string
+		bestScore := 0
+		for _, f := range byName[parts[len(parts)-1]] {
+			score := commonSuffix(splitPath(f), parts)
+			switch {
+			case score > bestScore:
+				best, bestScore = []string{f}, score
+			case score == bestScore:
+				best = append(best, f)
+			}
+		}
+		if len(best) != 1 {
+			continue
+		}
+
+		if d := path.Dir(best[0]); d != "." && !seen[d] {
+			seen[d] = true
+			dirs = append(dirs, d)
+		}
+	}
+	return dirs
+}
+
+// splitPath splits a frame filename or repository path into its components,
+// dropping any URL scheme and relative components.
+func splitPath(p string) []string {
+	if _, rest, ok := strings.Cut(p, "://"); ok {
+		p = rest
+	}
+	p = strings.ReplaceAll(p, "\\", "/")
+
+	var parts []string
+	for _, part := range strings.Split(p, "/") {
+		if part != "" && part != "." && part != ".." && part != "~" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+// commonSuffix counts the trailing components a and b share.
+func commonSuffix(a, b []string) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[len(a)-1-n] == b[len(b)-1-n] {
+		n++
+	}
+	return n
+}
+
+// gitOutput runs a git command in dir and returns its stdout, keeping token
+// out of its error.
+func gitOutput(ctx context.Context, dir, token string, args ...string) ([]byte, error) {
+	var stdout bytes.Buffer
+	err := runGitTo(ctx, dir, token, &stdout, args...)
+	return stdout.Bytes(), err
+}
+
+// PathCandidates returns the repository paths a stack trace filename may
+// refer to, longest first: the filename itself and then ever shorter
+// suffixes of it, so deployment prefixes like /srv/app can be dropped.
+func PathCandidates(filename string) []string {
+	parts := splitPath(filename)
+	candidates := make([]string, len(parts))
+	for i := range parts {
+		candidates[i] = strings.Join(parts[i:], "/")
+	}
+	return candidates
+}
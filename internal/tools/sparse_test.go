@@ -0,0 +1,136 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSparseDirs(t *testing.T) {
+	files := []string{
+		"README.md",
+		"manage.py",
+		"services/api/app/handler.py",
+		"services/api/app/__init__.py",
+		"services/billing/app/__init__.py",
+		"web/src/components/Button.tsx",
+		".autopr/STYLE.md",
+	}
+
+	tests := []struct {
+		name  string
+		paths []string
+		want  []string
+	}{
+		{
+			name:  "repository path",
+			paths: []string{"services/api/app/handler.py"},
+			want:  []string{"services/api/app"},
+		},
+		{
+			name:  "deployment prefix",
+			paths: []string{"/srv/api/app/handler.py", "/usr/lib/python3/json/decoder.py"},
+			want:  []string{"services/api/app"},
+		},
+		{
+			name:  "url",
+			paths: []string{"webpack:///./src/components/Button.tsx", `C:\build\web\src\components\Button.tsx`},
+			want:  []string{"web/src/components"},
+		},
+		{
+			name:  "longest match wins",
+			paths: []string{"billing/app/__init__.py"},
+			want:  []string{"services/billing/app"},
+		},
+		{
+			name:  "ambiguous",
+			paths: []string{"app/__init__.py"},
+		},
+		{
+			name:  "top-level file",
+			paths: []string{"manage.py", ".autopr/STYLE.md"},
+			want:  []string{".autopr"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sparseDirs(files, tt.paths); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sparseDirs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCloneRepo_Sparse(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	upstream := t.TempDir()
+	git(t, upstream, "init", "--quiet")
+	for _, name := range []string{"README.md", "api/handler.py", "web/index.js"} {
+		os.MkdirAll(filepath.Dir(filepath.Join(upstream, name)), 0o755)
+		os.WriteFile(filepath.Join(upstream, name), []byte(name), 0o644)
+	}
+	git(t, upstream, "add", ".")
+	git(t, upstream, "commit", "--quiet", "-m", "init")
+
+	tests := []struct {
+		name    string
+		sparse  []string
+		present []string
+		absent  []string
+	}{
+		{
+			name:    "sparse",
+			sparse:  []string{"/srv/api/handler.py"},
+			present: []string{"README.md", "api/handler.py"},
+			absent:  []string{"web/index.js"},
+		},
+		{
+			name:    "no matching paths",
+			sparse:  []string{"lib/other.py"},
+			present: []string{"README.md", "api/handler.py", "web/index.js"},
+		},
+		{
+			name:    "full",
+			present: []string{"README.md", "api/handler.py", "web/index.js"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, cleanup, err := CloneRepo(context.Background(), "file://"+upstream, "", "", CloneOptions{Depth: 1, Sparse: tt.sparse})
+			if err != nil {
+				t.Fatalf("CloneRepo() error = %v", err)
+			}
+			defer cleanup()
+
+			for _, name := range tt.present {
+				if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+					t.Errorf("%s not checked out: %v", name, err)
+				}
+			}
+			for _, name := range tt.absent {
+				if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+					t.Errorf("%s checked out, want it left out", name)
+				}
+			}
+			if changes, err := GetChangedFiles(dir); err != nil || len(changes) != 0 {
+				t.Errorf("GetChangedFiles() = %v, %v, want a clean tree", changes, err)
+			}
+		})
+	}
+}
+
+func TestPathCandidates(t *testing.T) {
+	got := PathCandidates("webpack:///./src/app/index.js")
+	want := []string{"src/app/index.js", "app/index.js", "index.js"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("PathCandidates() = %v, want %v", got, want)
+	}
+}
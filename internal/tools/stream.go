@@ -0,0 +1,235 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// maxProgressTarget caps how much of a tool's input is logged.
+const maxProgressTarget = 120
+
+// cliOutput is Claude Code's response to a --print session.
+type cliOutput struct {
+	// Result is the model's final message.
+	Result  string
+	CostUSD float64
+	// Subtype is how the session ended, e.g. "success" or "error_max_turns".
+	Subtype      string
+	InputTokens  int
+	OutputTokens int
+	// SessionID continues the session with --resume.
+	SessionID string
+}
+
+// streamEvent is one line of --output-format stream-json output.
+type streamEvent struct {
+	Type      string `json:"type"`
+	Subtype   string `json:"subtype"`
+	SessionID string `json:"session_id"`
+	// Message is set on "assistant" and "user" events
+	Message json.RawMessage `json:"message"`
+	// The rest are set on the final "result" event
+	Result   string      `json:"result"`
+	NumTurns int         `json:"num_turns"`
+	CostUSD  float64     `json:"total_cost_usd"`
+	Usage    streamUsage `json:"usage"`
+}
+
+type streamMessage struct {
+	ID      string `json:"id"`
+	Content []struct {
+		Type  string         `json:"type"`
+		Text  string         `json:"text"`
+		Name  string         `json:"name"`
+		Input map[string]any `json:"input"`
+	} `json:"content"`
+	Usage streamUsage `json:"usage"`
+}
+
+type streamUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+// input counts every prompt token, cached or not.
+func (u streamUsage) input() int {
+	return u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+}
+
+// streamParser reads the CLI's stream-json output as it is written, logging
+// each tool call with the tokens used so far.
+type streamParser struct {
+	issueID string
+
+	buf []byte
+	out cliOutput
+	// lastText is the latest assistant text block, and plain collects lines
+	// that aren't events, e.g. from CLI versions without stream-json
+	lastText    string
+	plain       []string
+	lastMessage string
+	// said is everything the model output, for its transcript
+	said strings.Builder
+}
+
+func newStreamParser(issueID string) *streamParser {
+	return &streamParser{issueID: issueID}
+}
+
+// Write implements io.Writer, handling each complete line.
+func (p *streamParser) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+		p.handleLine(p.buf[:i])
+		p.buf = p.buf[i+1:]
+	}
+	return len(b), nil
+}
+
+// result handles any unterminated last line and returns the session's output.
+func (p *streamParser) result() *cliOutput {
+	if len(p.buf) > 0 {
+		p.handleLine(p.buf)
+		p.buf = nil
+	}
+	out := p.out
+	if out.Result == "" {
+		out.Result = p.lastText
+	}
+	if out.Result == "" {
+		out.Result = strings.Join(p.plain, "\n")
+	}
+	return &out
+}
+
+// modelOutput returns everything the model output so far, or the plain
+// output of CLIs without stream-json.
+func (p *streamParser) modelOutput() string {
+	if p.said.Len() == 0 {
+		return strings.Join(p.plain, "\n")
+	}
+	return strings.TrimSpace(p.said.String())
+}
+
+func (p *streamParser) handleLine(line []byte) {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 {
+		return
+	}
+	var event streamEvent
+	if err := json.Unmarshal(line, &event); err != nil || event.Type == "" {
+		p.plain = append(p.plain, string(line))
+		return
+	}
+	if event.SessionID != "" {
+		p.out.SessionID = event.SessionID
+	}
+
+	switch event.Type {
+	case "assistant":
+		var msg streamMessage
+		if err := json.Unmarshal(event.Message, &msg); err != nil {
+			return
+		}
+		// A message with several content blocks arrives as several events
+		// carrying the same usage, so count each message once
+		if msg.ID == "" || msg.ID != p.lastMessage {
+			p.lastMessage = msg.ID
+			p.out.InputTokens += msg.Usage.input()
+			p.out.OutputTokens += msg.Usage.OutputTokens
+		}
+		for _, block := range msg.Content {
+			writeOutputBlock(&p.said, block.Type, block.Text, block.Name, block.Input)
+			switch block.Type {
+			case "text":
+				p.lastText = block.Text
+			case "tool_use":
+				log.Printf("Issue %s: Claude Code %s %s (%d input, %d output tokens so far)",
+					p.issueID, block.Name, toolTarget(block.Input), p.out.InputTokens, p.out.OutputTokens)
+			}
+		}
+	case "result":
+		p.out.Result = event.Result
+		p.out.CostUSD = event.CostUSD
+		p.out.Subtype = event.Subtype
+		if total := event.Usage.input(); total > 0 {
+			p.out.InputTokens = total
+			p.out.OutputTokens = event.Usage.OutputTokens
+		}
+		log.Printf("Issue %s: Claude Code finished (%s) after %d turns, %d input and %d output tokens, $%.2f",
+			p.issueID, event.Subtype, event.NumTurns, p.out.InputTokens, p.out.OutputTokens, event.CostUSD)
+	}
+}
+
+// toolTarget summarizes what a tool call acts on, such as the file read or
+// the command run.
+func toolTarget(input map[string]any) string {
+	for _, key := range []string{"file_path", "path", "command", "pattern", "url", "description"} {
+		if v, ok := input[key].(string); ok && v != "" {
+			return truncate(oneLine(v), maxProgressTarget)
+		}
+	}
+	return ""
+}
+
+// parseResponse decodes the fix JSON the model ends its output with, either
+// bare or in a code fence after its explanation. It fails if output doesn't
+// end with a fix report matching fixReportSchema.
+func parseResponse(output string) (*FixResponse, error) {
+	jsonStr := trailingJSON(output)
+	if jsonStr == "" {
+		return nil, errors.New("no JSON fix report found at the end of the output")
+	}
+
+	var report any
+	if err := json.Unmarshal([]byte(jsonStr), &report); err != nil {
+		return nil, fmt.Errorf("failed to parse the JSON fix report: %v", err)
+	}
+	if problems := fixSchema.validate(report); len(problems) > 0 {
+		return nil, fmt.Errorf("the JSON fix report is invalid: %s", strings.Join(problems, "; "))
+	}
+
+	var resp FixResponse
+	if err := json.Unmarshal([]byte(jsonStr), &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse the JSON fix report: %v", err)
+	}
+	return &resp, nil
+}
+
+// trailingJSON returns the JSON object text ends with: the whole of text, or
+// the code fence closing it. It returns "" if text doesn't end with either.
+func trailingJSON(text string) string {
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(text, "{") {
+		return text
+	}
+	body, ok := strings.CutSuffix(text, "```")
+	if !ok {
+		return ""
+	}
+	// The opening fence starts a line; JSON strings can't contain newlines,
+	// so fences quoted inside the object never do
+	open := strings.LastIndex("\n"+body, "\n```")
+	if open == -1 {
+		return ""
+	}
+	block := body[open+3:]
+	// Skip the language identifier, e.g. json
+	if newline := strings.IndexByte(block, '\n'); newline != -1 {
+		block = block[newline+1:]
+	}
+	if block = strings.TrimSpace(block); !strings.HasPrefix(block, "{") {
+		return ""
+	}
+	return block
+}
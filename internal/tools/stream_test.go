@@ -0,0 +1,123 @@
+package tools
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStreamParser(t *testing.T) {
+	stream := strings.Join([]string{
+		`{"type": "system", "subtype": "init", "session_id": "s1", "tools": ["Read", "Edit"]}`,
+		`{"type": "assistant", "message": {"id": "m1", "content": [{"type": "text", "text": "Let me look."}], "usage": {"input_tokens": 100, "cache_read_input_tokens": 900, "output_tokens": 20}}}`,
+		`{"type": "assistant", "message": {"id": "m1", "content": [{"type": "tool_use", "id": "t1", "name": "Read", "input": {"file_path": "app/handler.py"}}], "usage": {"input_tokens": 100, "cache_read_input_tokens": 900, "output_tokens": 20}}}`,
+		`{"type": "user", "message": {"role": "user", "content": [{"type": "tool_result", "tool_use_id": "t1", "content": "def handle(user): ..."}]}}`,
+		`{"type": "assistant", "message": {"id": "m2", "content": [{"type": "text", "text": "Done.\n` + "```json" + `\n{\"success\": false, \"error\": \"cannot fix\"}\n` + "```" + `"}], "usage": {"input_tokens": 50, "output_tokens": 30}}}`,
+		`{"type": "result", "subtype": "success", "result": "Done.\n` + "```json" + `\n{\"success\": false, \"error\": \"cannot fix\"}\n` + "```" + `", "num_turns": 2, "total_cost_usd": 0.42, "usage": {"input_tokens": 150, "cache_read_input_tokens": 900, "output_tokens": 50}}`,
+	}, "\n")
+
+	// Events are parsed as they are written, whatever the chunking
+	p := newStreamParser("1")
+	for i := 0; i < len(stream); i += 7 {
+		p.Write([]byte(stream[i:min(i+7, len(stream))]))
+	}
+	got := p.result()
+
+	if got.Subtype != "success" || got.CostUSD != 0.42 || got.InputTokens != 1050 || got.OutputTokens != 50 || got.SessionID != "s1" {
+		t.Errorf("result() = %+v", got)
+	}
+	if resp, err := parseResponse(got.Result); err != nil || resp.Error != "cannot fix" {
+		t.Errorf("parseResponse(%q) = %+v, %v", got.Result, resp, err)
+	}
+	if out := p.modelOutput(); !strings.HasPrefix(out, "Let me look.\n\n[Read] {\"file_path\":\"app/handler.py\"}\n\nDone.") || strings.Contains(out, "def handle") {
+		t.Errorf("modelOutput() = %q", out)
+	}
+}
+
+func TestStreamParser_Fallbacks(t *testing.T) {
+	tests := []struct {
+		name       string
+		stdout     string
+		wantResult string
+		wantTokens int
+	}{
+		{
+			name:       "no result event",
+			stdout:     `{"type": "assistant", "message": {"id": "m1", "content": [{"type": "text", "text": "{\"success\": false}"}], "usage": {"input_tokens": 10, "output_tokens": 5}}}`,
+			wantResult: `{"success": false}`,
+			wantTokens: 10,
+		},
+		{
+			name:       "plain text",
+			stdout:     "Fixed it\n",
+			wantResult: "Fixed it",
+		},
+		{
+			name:       "user message with string content",
+			stdout:     `{"type": "user", "message": {"role": "user", "content": "hello"}}` + "\n" + `{"type": "result", "subtype": "error_max_turns", "result": ""}`,
+			wantResult: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newStreamParser("1")
+			p.Write([]byte(tt.stdout))
+			got := p.result()
+			if got.Result != tt.wantResult || got.InputTokens != tt.wantTokens {
+				t.Errorf("result() = %+v, want result %q and %d input tokens", got, tt.wantResult, tt.wantTokens)
+			}
+		})
+	}
+}
+
+func TestTrailingJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "json in code block after explanation",
+			input: "Here is the fix:\n\n```json\n{\n  \"success\": true\n}\n```\n",
+			want:  "{\n  \"success\": true\n}",
+		},
+		{
+			name:  "json in plain code block",
+			input: "```\n{\"success\": true}\n```",
+			want:  `{"success": true}`,
+		},
+		{
+			name:  "bare json",
+			input: `{"success": false, "error": "could not fix"}`,
+			want:  `{"success": false, "error": "could not fix"}`,
+		},
+		{
+			name:  "fence inside a json string",
+			input: "Fixed the docs.\n```json\n{\"files\": [{\"content\": \"```go\\nfmt.Println()\\n```\"}]}\n```",
+			want:  "{\"files\": [{\"content\": \"```go\\nfmt.Println()\\n```\"}]}",
+		},
+		{
+			name:  "earlier code block",
+			input: "The bug is here:\n```python\nuser.name\n```\n",
+			want:  "",
+		},
+		{
+			name:  "text after the json",
+			input: "```json\n{\"success\": true}\n```\nLet me know if you need anything else.",
+			want:  "",
+		},
+		{
+			name:  "no json",
+			input: "Just plain text with no JSON",
+			want:  "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := trailingJSON(tt.input); got != tt.want {
+				t.Errorf("trailingJSON() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Exchange is one prompt sent to the model and everything the model output
+// in response: its messages and tool calls, but not the tool results.
+type Exchange struct {
+	System string    `json:"system,omitempty"`
+	Prompt string    `json:"prompt"`
+	Output string    `json:"output"`
+	Error  string    `json:"error,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+// Transcript collects the exchanges with the model of one job, for auditing
+// why the agent made a change. It is safe for concurrent use.
+type Transcript struct {
+	mu        sync.Mutex
+	exchanges []Exchange
+}
+
+type transcriptKey struct{}
+
+// WithTranscript returns a context in which every prompt sent to the model
+// and its output are added to t.
+func WithTranscript(ctx context.Context, t *Transcript) context.Context {
+	return context.WithValue(ctx, transcriptKey{}, t)
+}
+
+// Exchanges returns the exchanges so far, oldest first.
+func (t *Transcript) Exchanges() []Exchange {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Exchange(nil), t.exchanges...)
+}
+
+// recordExchange adds an exchange to ctx's transcript, if it has one. A
+// failed exchange keeps the output up to the failure.
+func recordExchange(ctx context.Context, system, prompt, output string, err error) {
+	t, _ := ctx.Value(transcriptKey{}).(*Transcript)
+	if t == nil {
+		return
+	}
+	e := Exchange{System: system, Prompt: prompt, Output: output, At: time.Now()}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.exchanges = append(t.exchanges, e)
+}
+
+// writeOutputBlock adds a block of the model's output to a transcript: text
+// as is and a tool call as the tool's name and input.
+func writeOutputBlock(sb *strings.Builder, typ, text, name string, input any) {
+	switch typ {
+	case "text":
+		sb.WriteString(text)
+	case "tool_use":
+		data, _ := json.Marshal(input)
+		sb.WriteString("[" + name + "] " + string(data))
+	default:
+		return
+	}
+	sb.WriteString("\n\n")
+}
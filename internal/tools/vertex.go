@@ -0,0 +1,80 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	// DefaultVertexModel is the Vertex AI model used when none is configured.
+	DefaultVertexModel = "claude-sonnet-4-5@20250929"
+	// DefaultVertexRegion is the Vertex AI region used when none is configured.
+	DefaultVertexRegion = "us-east5"
+
+	vertexAnthropicVersion = "vertex-2023-10-16"
+	vertexScope            = "https://www.googleapis.com/auth/cloud-platform"
+)
+
+// VertexOptions routes the Anthropic backend through Google Vertex AI.
+type VertexOptions struct {
+	ProjectID string
+	// Region is a Vertex AI region such as "us-east5", or "global".
+	Region string
+	// Token returns an OAuth2 access token for the cloud-platform scope.
+	Token func(ctx context.Context) (string, error)
+	// BaseURL overrides the regional endpoint, e.g. for tests.
+	BaseURL string
+}
+
+// endpoint returns the URL serving model.
+func (v *VertexOptions) endpoint(model string) string {
+	region := v.Region
+	if region == "" {
+		region = DefaultVertexRegion
+	}
+	base := v.BaseURL
+	switch {
+	case base != "":
+		base = strings.TrimRight(base, "/")
+	case region == "global":
+		base = "https://aiplatform.googleapis.com"
+	default:
+		base = "https://" + region + "-aiplatform.googleapis.com"
+	}
+	return fmt.Sprintf("%s/v1/projects/%s/locations/%s/publishers/anthropic/models/%s:rawPredict", base, v.ProjectID, region, model)
+}
+
+// VertexToken returns a VertexOptions.Token function that authenticates with
+// the service account key in credentialsFile or, if it is empty, with
+// Application Default Credentials (GOOGLE_APPLICATION_CREDENTIALS, workload
+// identity or the metadata server).
+func VertexToken(ctx context.Context, credentialsFile string) (func(context.Context) (string, error), error) {
+	var creds *google.Credentials
+	if credentialsFile != "" {
+		data, err := os.ReadFile(credentialsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Google Cloud credentials: %w", err)
+		}
+		if creds, err = google.CredentialsFromJSON(ctx, data, vertexScope); err != nil {
+			return nil, fmt.Errorf("invalid Google Cloud credentials %s: %w", credentialsFile, err)
+		}
+	} else {
+		var err error
+		if creds, err = google.FindDefaultCredentials(ctx, vertexScope); err != nil {
+			return nil, fmt.Errorf("failed to find Google Cloud credentials: %w", err)
+		}
+	}
+
+	// The token source caches tokens and refreshes them before they expire
+	return func(context.Context) (string, error) {
+		token, err := creds.TokenSource.Token()
+		if err != nil {
+			return "", err
+		}
+		return token.AccessToken, nil
+	}, nil
+}
@@ -0,0 +1,72 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVertexOptions_Endpoint(t *testing.T) {
+	tests := []struct {
+		region string
+		want   string
+	}{
+		{"us-east5", "https://us-east5-aiplatform.googleapis.com/v1/projects/p/locations/us-east5/publishers/anthropic/models/m@1:rawPredict"},
+		{"global", "https://aiplatform.googleapis.com/v1/projects/p/locations/global/publishers/anthropic/models/m@1:rawPredict"},
+		{"", "https://us-east5-aiplatform.googleapis.com/v1/projects/p/locations/us-east5/publishers/anthropic/models/m@1:rawPredict"},
+	}
+
+	for _, tt := range tests {
+		v := &VertexOptions{ProjectID: "p", Region: tt.region}
+		if got := v.endpoint("m@1"); got != tt.want {
+			t.Errorf("endpoint() with region %q = %q, want %q", tt.region, got, tt.want)
+		}
+	}
+}
+
+func TestAnthropicTool_Vertex(t *testing.T) {
+	var body map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		want := "/v1/projects/proj/locations/europe-west1/publishers/anthropic/models/" + DefaultVertexModel + ":rawPredict"
+		if r.URL.Path != want || r.Header.Get("Authorization") != "Bearer tok" || r.Header.Get("x-api-key") != "" {
+			t.Errorf("request to %s with Authorization %q", r.URL.Path, r.Header.Get("Authorization"))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("invalid request: %v", err)
+		}
+		w.Write([]byte(`{"stop_reason": "end_turn", "content": [{"type": "text", "text": "{\"success\": false, \"error\": \"cannot fix\"}"}]}`))
+	}))
+	defer server.Close()
+
+	vertex := &VertexOptions{
+		ProjectID: "proj",
+		Region:    "europe-west1",
+		Token:     func(context.Context) (string, error) { return "tok", nil },
+		BaseURL:   server.URL,
+	}
+	tool := NewAnthropicTool(fakeRepo{}, "main", AnthropicOptions{Vertex: vertex}, nil)
+
+	resp, err := tool.GenerateFix(context.Background(), &FixRequest{IssueID: "1"})
+	if err != nil {
+		t.Fatalf("GenerateFix() error = %v", err)
+	}
+	if resp.Success || resp.Error != "cannot fix" {
+		t.Errorf("GenerateFix() = %+v", resp)
+	}
+	if _, ok := body["model"]; ok || body["anthropic_version"] != vertexAnthropicVersion {
+		t.Errorf("request body model = %v, anthropic_version = %v", body["model"], body["anthropic_version"])
+	}
+
+	// Failing to get a token is worth retrying
+	vertex.Token = func(context.Context) (string, error) { return "", errors.New("metadata server unavailable") }
+	_, err = tool.GenerateFix(context.Background(), &FixRequest{IssueID: "1"})
+	var transient *TransientError
+	if !errors.As(err, &transient) {
+		t.Errorf("GenerateFix() error = %v, want a TransientError", err)
+	}
+}
@@ -0,0 +1,172 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrWorkspaceQuota is the cause of a clone failing because the workspaces
+// use up their disk quota.
+var ErrWorkspaceQuota = errors.New("workspace disk quota exceeded")
+
+// WorkDirs allocates a directory of its own for each job's fresh clone
+// under a root directory, keeps their total size within a quota and removes
+// workspaces that were never released.
+type WorkDirs struct {
+	root   string
+	quota  int64
+	maxAge time.Duration
+
+	mu     sync.Mutex
+	active map[string]time.Time
+}
+
+// NewWorkDirs creates root if needed and allocates workspaces in it. Jobs
+// are refused new workspaces while the workspaces use more than quota bytes,
+// 0 for no limit. Workspaces older than maxAge, including those left behind
+// by earlier runs of the server, are removed whether or not they were
+// released.
+func NewWorkDirs(root string, quota int64, maxAge time.Duration) (*WorkDirs, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create workspace directory: %w", err)
+	}
+	d := &WorkDirs{root: root, quota: quota, maxAge: maxAge, active: make(map[string]time.Time)}
+	d.collect()
+	return d, nil
+}
+
+// Allocate creates an empty workspace, named after name, reserved for the
+// caller until release removes it.
+func (d *WorkDirs) Allocate(name string) (dir string, release func(), err error) {
+	d.collect()
+	if err := d.checkQuota(); err != nil {
+		return "", nil, err
+	}
+
+	dir, err = os.MkdirTemp(d.root, name+"-*")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create workspace: %w", err)
+	}
+	d.mu.Lock()
+	d.active[dir] = time.Now()
+	d.mu.Unlock()
+
+	var once sync.Once
+	release = func() {
+		once.Do(func() {
+			d.mu.Lock()
+			delete(d.active, dir)
+			d.mu.Unlock()
+			if err := os.RemoveAll(dir); err != nil {
+				log.Printf("Failed to remove workspace %s: %v", dir, err)
+			}
+		})
+	}
+	return dir, release, nil
+}
+
+// Clone clones repoURL like CloneRepo into a workspace of its own. A clone
+// taking the workspaces over their quota is removed again.
+func (d *WorkDirs) Clone(ctx context.Context, repoURL, token, branch string, opts CloneOptions) (string, func(), error) {
+	dir, release, err := d.Allocate(path.Base(strings.TrimSuffix(repoURL, ".git")))
+	if err != nil {
+		return "", nil, err
+	}
+	if err := cloneInto(ctx, dir, repoURL, token, branch, opts); err != nil {
+		release()
+		return "", nil, err
+	}
+	if err := d.checkQuota(); err != nil {
+		release()
+		return "", nil, err
+	}
+	return dir, release, nil
+}
+
+// checkQuota fails with a transient error wrapping ErrWorkspaceQuota if the
+// workspaces use more than the quota, since they shrink as jobs finish.
+func (d *WorkDirs) checkQuota() error {
+	if d.quota <= 0 {
+		return nil
+	}
+	used, err := dirSize(d.root)
+	if err != nil {
+		return fmt.Errorf("failed to measure workspaces: %w", err)
+	}
+	if used > d.quota {
+		return &TransientError{Err: fmt.Errorf("workspaces use %d of %d bytes: %w", used, d.quota, ErrWorkspaceQuota)}
+	}
+	return nil
+}
+
+// collect removes the workspaces older than maxAge: the allocated ones by
+// when they were allocated, the others, left by an earlier run or a failed
+// removal, by when they were last modified.
+func (d *WorkDirs) collect() {
+	entries, err := os.ReadDir(d.root)
+	if err != nil {
+		log.Printf("Failed to list workspaces: %v", err)
+		return
+	}
+	cutoff := time.Now().Add(-d.maxAge)
+	for _, entry := range entries {
+		dir := filepath.Join(d.root, entry.Name())
+		d.mu.Lock()
+		allocated, inUse := d.active[dir]
+		d.mu.Unlock()
+		switch {
+		case inUse && allocated.Before(cutoff):
+			log.Printf("Removing workspace %s, still in use after %v", dir, d.maxAge)
+			d.mu.Lock()
+			delete(d.active, dir)
+			d.mu.Unlock()
+		case !inUse && modifiedBefore(entry, cutoff):
+			log.Printf("Removing stale workspace %s", dir)
+		default:
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			log.Printf("Failed to remove workspace %s: %v", dir, err)
+		}
+	}
+}
+
+func modifiedBefore(entry fs.DirEntry, t time.Time) bool {
+	info, err := entry.Info()
+	return err == nil && info.ModTime().Before(t)
+}
+
+// dirSize returns the total size of the files under dir.
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			// Workspaces are removed while they are measured
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if entry.Type().IsRegular() {
+			info, err := entry.Info()
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
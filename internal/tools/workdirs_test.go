@@ -0,0 +1,120 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWorkDirs(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "workspaces")
+	d, err := NewWorkDirs(root, 1000, time.Hour)
+	if err != nil {
+		t.Fatalf("NewWorkDirs() error = %v", err)
+	}
+
+	first, releaseFirst, err := d.Allocate("repo")
+	if err != nil {
+		t.Fatalf("Allocate() error = %v", err)
+	}
+	second, releaseSecond, err := d.Allocate("repo")
+	if err != nil {
+		t.Fatalf("Allocate() error = %v", err)
+	}
+	if first == second || filepath.Dir(first) != root {
+		t.Errorf("Allocate() = %s and %s, want distinct directories under %s", first, second, root)
+	}
+	releaseSecond()
+	if _, err := os.Stat(second); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("workspace %s still exists after release", second)
+	}
+
+	// Over the quota, no workspaces are handed out until space is freed
+	os.WriteFile(filepath.Join(first, "big"), make([]byte, 2000), 0o644)
+	if _, _, err := d.Allocate("repo"); !errors.Is(err, ErrWorkspaceQuota) {
+		t.Errorf("Allocate() over the quota error = %v, want ErrWorkspaceQuota", err)
+	}
+	releaseFirst()
+	_, release, err := d.Allocate("repo")
+	if err != nil {
+		t.Fatalf("Allocate() after release error = %v", err)
+	}
+	release()
+}
+
+func TestWorkDirs_Collect(t *testing.T) {
+	root := t.TempDir()
+	stale := filepath.Join(root, "repo-stale")
+	fresh := filepath.Join(root, "repo-fresh")
+	os.Mkdir(stale, 0o755)
+	os.Mkdir(fresh, 0o755)
+	old := time.Now().Add(-2 * time.Hour)
+	os.Chtimes(stale, old, old)
+
+	// Workspaces left by an earlier run are removed once they are old
+	d, err := NewWorkDirs(root, 0, time.Hour)
+	if err != nil {
+		t.Fatalf("NewWorkDirs() error = %v", err)
+	}
+	if _, err := os.Stat(stale); !errors.Is(err, os.ErrNotExist) {
+		t.Error("stale workspace was not removed")
+	}
+	if _, err := os.Stat(fresh); err != nil {
+		t.Errorf("recent workspace was removed: %v", err)
+	}
+
+	// So are workspaces never released
+	leaked, _, err := d.Allocate("repo")
+	if err != nil {
+		t.Fatalf("Allocate() error = %v", err)
+	}
+	d.active[leaked] = old
+	d.collect()
+	if _, err := os.Stat(leaked); !errors.Is(err, os.ErrNotExist) {
+		t.Error("leaked workspace was not removed")
+	}
+	if len(d.active) != 0 {
+		t.Errorf("active = %v, want the leaked workspace forgotten", d.active)
+	}
+}
+
+func TestWorkDirs_Clone(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	upstream := t.TempDir()
+	git(t, upstream, "init", "--quiet", "--initial-branch", "main")
+	os.WriteFile(filepath.Join(upstream, "app.py"), make([]byte, 5000), 0o644)
+	git(t, upstream, "add", ".")
+	git(t, upstream, "commit", "--quiet", "-m", "v1")
+
+	d, err := NewWorkDirs(t.TempDir(), 0, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewWorkspaces("", d)
+	dir, release, err := w.Checkout(context.Background(), "file://"+upstream, "", "", CloneOptions{})
+	if err != nil {
+		t.Fatalf("Checkout() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "app.py")); err != nil {
+		t.Errorf("app.py not cloned: %v", err)
+	}
+	release()
+	if _, err := os.Stat(dir); !errors.Is(err, os.ErrNotExist) {
+		t.Error("workspace still exists after release")
+	}
+
+	// A clone taking the workspaces over the quota is removed again
+	d.quota = 1000
+	if _, _, err := w.Checkout(context.Background(), "file://"+upstream, "", "", CloneOptions{}); !errors.Is(err, ErrWorkspaceQuota) {
+		t.Errorf("Checkout() over the quota error = %v, want ErrWorkspaceQuota", err)
+	}
+	if entries, _ := os.ReadDir(d.root); len(entries) != 0 {
+		t.Errorf("workspaces = %v, want none left", entries)
+	}
+}
@@ -0,0 +1,199 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Workspaces keeps a cached clone of each repository under a directory, so
+// a job fetches only the commit it needs instead of cloning the repository
+// from scratch, or clones afresh for every job into a workspace of its own.
+// A nil Workspaces clones afresh into a temporary directory.
+type Workspaces struct {
+	dir  string
+	jobs *WorkDirs
+
+	mu    sync.Mutex
+	repos map[string]*sync.Mutex
+}
+
+var (
+	workspacesMu sync.Mutex
+	workspaces   = make(map[string]*Workspaces)
+)
+
+// NewWorkspaces caches clones under dir. If dir is empty, it clones afresh
+// into workspaces allocated by jobs, or returns nil if jobs is nil too.
+// Calls for the same dir return the same Workspaces, so every user of a
+// clone takes turns with it.
+func NewWorkspaces(dir string, jobs *WorkDirs) *Workspaces {
+	if dir == "" {
+		if jobs == nil {
+			return nil
+		}
+		return &Workspaces{jobs: jobs}
+	}
+	workspacesMu.Lock()
+	defer workspacesMu.Unlock()
+	w, ok := workspaces[dir]
+	if !ok {
+		w = &Workspaces{dir: dir, repos: make(map[string]*sync.Mutex)}
+		workspaces[dir] = w
+	}
+	return w
+}
+
+// Checkout updates the cached clone of repoURL to the tip of branch, or of
+// the default branch if branch is empty, discarding whatever the previous
+// job left behind. The clone is reserved for the caller until release is
+// called. Like CloneRepo, which it falls back to when w is nil, it returns
+// the directory to work in. A sparse checkout still fetches every file, but
+// only once per commit.
+func (w *Workspaces) Checkout(ctx context.Context, repoURL, token, branch string, opts CloneOptions) (dir string, release func(), err error) {
+	if w == nil {
+		return CloneRepo(ctx, repoURL, token, branch, opts)
+	}
+	if w.dir == "" {
+		return w.jobs.Clone(ctx, repoURL, token, branch, opts)
+	}
+
+	dir, err = w.path(repoURL)
+	if err != nil {
+		return "", nil, err
+	}
+	lock := w.lock(dir)
+	lock.Lock()
+
+	if err := w.update(ctx, dir, repoURL, token, branch, opts); err != nil {
+		// Start over next time rather than trust a half-updated clone, unless
+		// the failure had nothing to do with it, e.g. a missing branch
+		var transient *TransientError
+		if ctx.Err() == nil && errors.As(err, &transient) {
+			os.RemoveAll(dir)
+		}
+		lock.Unlock()
+		return "", nil, err
+	}
+	return dir, lock.Unlock, nil
+}
+
+// update fetches the branch into the clone at dir, creating the clone if
+// needed, and resets the working tree to it.
+func (w *Workspaces) update(ctx context.Context, dir, repoURL, token, branch string, opts CloneOptions) error {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+		log.Printf("Creating workspace cache for %s", repoURL)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("failed to create workspace: %w", err)
+		}
+		if err := runGit(ctx, dir, token, "init", "--quiet"); err != nil {
+			return err
+		}
+	}
+
+	// Fetch from the URL rather than a configured remote so the clone's
+	// config keeps nothing of the job
+	ref := "HEAD"
+	if branch != "" {
+		ref = "refs/heads/" + branch
+	}
+	args := []string{"fetch", "--quiet", "--no-tags"}
+	if opts.Depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(opts.Depth))
+	} else if _, err := os.Stat(filepath.Join(dir, ".git", "shallow")); err == nil {
+		args = append(args, "--unshallow")
+	}
+	if err := runGit(ctx, dir, token, append(args, repoURL, ref)...); err != nil {
+		return err
+	}
+	if err := applySparse(ctx, dir, token, "FETCH_HEAD", opts); err != nil {
+		return err
+	}
+	if err := runGit(ctx, dir, token, "checkout", "--quiet", "--force", "--detach", "FETCH_HEAD"); err != nil {
+		return err
+	}
+	return runGit(ctx, dir, token, "clean", "--quiet", "-ffdx")
+}
+
+// path returns the cache directory for repoURL, e.g. <dir>/github.com/org/repo.
+func (w *Workspaces) path(repoURL string) (string, error) {
+	u, err := url.Parse(repoURL)
+	if err != nil || u.Path == "" || (u.Host == "" && u.Scheme != "file") {
+		return "", fmt.Errorf("invalid repository URL %q", repoURL)
+	}
+	host := u.Host
+	if host == "" {
+		host = u.Scheme
+	}
+	rel := filepath.Clean("/" + strings.TrimSuffix(u.Path, ".git"))
+	return filepath.Join(w.dir, host, rel), nil
+}
+
+// lock returns the mutex reserving the clone at dir.
+func (w *Workspaces) lock(dir string) *sync.Mutex {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	m, ok := w.repos[dir]
+	if !ok {
+		m = &sync.Mutex{}
+		w.repos[dir] = m
+	}
+	return m
+}
+
+// gitEnv returns the environment git runs in for a job. Credential helpers
+// are disabled, so no job's credentials are stored or picked up by another,
+// and token, if set, is sent to GitHub from the environment of this one
+// process rather than from its command line or the clone's config.
+func gitEnv(token string) []string {
+	config := [][2]string{{"credential.helper", ""}}
+	if token != "" {
+		auth := base64.StdEncoding.EncodeToString([]byte("x-access-token:" + token))
+		config = append(config, [2]string{"http.https://github.com/.extraHeader", "Authorization: Basic " + auth})
+	}
+	env := append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_CONFIG_COUNT="+strconv.Itoa(len(config)))
+	for i, kv := range config {
+		env = append(env, fmt.Sprintf("GIT_CONFIG_KEY_%d=%s", i, kv[0]), fmt.Sprintf("GIT_CONFIG_VALUE_%d=%s", i, kv[1]))
+	}
+	return env
+}
+
+// runGit runs a git command in dir, keeping token out of its error.
+func runGit(ctx context.Context, dir, token string, args ...string) error {
+	return runGitTo(ctx, dir, token, nil, args...)
+}
+
+// runGitTo is runGit writing the command's stdout to stdout.
+func runGitTo(ctx context.Context, dir, token string, stdout io.Writer, args ...string) error {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = gitEnv(token)
+	cmd.Stdout = stdout
+	killProcessTree(cmd)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := runProcessTree(cmd); err != nil {
+		msg := stderr.String()
+		if token != "" {
+			msg = strings.ReplaceAll(msg, token, "***")
+		}
+		err = fmt.Errorf("git %s failed: %v\n%s", args[0], err, msg)
+		if ctx.Err() == nil && !isPermanentCloneError(msg) {
+			err = &TransientError{Err: err}
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package tracking
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/store"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/tools"
+)
+
+// recordIDPattern matches the IDs newID generates, which name audit files.
+var recordIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// Audit is the exact prompts a job sent to the model and the model's full
+// output, redacted, so a change can be traced back to its reasoning.
+type Audit struct {
+	RecordID  string           `json:"record_id"`
+	SavedAt   time.Time        `json:"saved_at"`
+	Exchanges []tools.Exchange `json:"exchanges"`
+}
+
+// AuditTrail keeps the Audit of each job record for a retention period, one
+// file per record under a directory. When created with an empty directory it
+// keeps everything in memory.
+type AuditTrail struct {
+	dir       string
+	retention time.Duration
+	redact    func(string) string
+	now       func() time.Time
+
+	mu     sync.Mutex
+	audits map[string]Audit
+}
+
+// OpenAuditTrail opens the audit trail in dir, creating dir if needed and
+// dropping audits older than retention. Every prompt and output is passed
+// through redact before it is stored.
+func OpenAuditTrail(dir string, retention time.Duration, redact func(string) string) (*AuditTrail, error) {
+	a := &AuditTrail{
+		dir:       dir,
+		retention: retention,
+		redact:    redact,
+		now:       time.Now,
+		audits:    make(map[string]Audit),
+	}
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, fmt.Errorf("failed to create audit trail: %w", err)
+		}
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.prune()
+	return a, nil
+}
+
+// Save stores the exchanges of the job with the given record ID, replacing
+// any saved before.
+func (a *AuditTrail) Save(recordID string, exchanges []tools.Exchange) error {
+	if !recordIDPattern.MatchString(recordID) {
+		return fmt.Errorf("invalid record ID %q", recordID)
+	}
+	audit := Audit{RecordID: recordID, SavedAt: a.now(), Exchanges: make([]tools.Exchange, len(exchanges))}
+	for i, e := range exchanges {
+		e.System, e.Prompt, e.Output, e.Error = a.redact(e.System), a.redact(e.Prompt), a.redact(e.Output), a.redact(e.Error)
+		audit.Exchanges[i] = e
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.prune()
+	if a.dir == "" {
+		a.audits[recordID] = audit
+		return nil
+	}
+	return store.WriteJSON(a.path(recordID), audit)
+}
+
+// Get returns the audit of the job with the given record ID.
+func (a *AuditTrail) Get(recordID string) (Audit, bool, error) {
+	if !recordIDPattern.MatchString(recordID) {
+		return Audit{}, false, nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.dir == "" {
+		audit, ok := a.audits[recordID]
+		return audit, ok, nil
+	}
+	var audit Audit
+	ok, err := store.ReadJSON(a.path(recordID), &audit)
+	return audit, ok, err
+}
+
+func (a *AuditTrail) path(recordID string) string {
+	return filepath.Join(a.dir, recordID+".json")
+}
+
+// prune drops audits older than the retention period. Callers must hold
+// a.mu.
+func (a *AuditTrail) prune() {
+	cutoff := a.now().Add(-a.retention)
+	if a.dir == "" {
+		for id, audit := range a.audits {
+			if audit.SavedAt.Before(cutoff) {
+				delete(a.audits, id)
+			}
+		}
+		return
+	}
+	entries, err := os.ReadDir(a.dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		if info, err := entry.Info(); err == nil && info.ModTime().Before(cutoff) {
+			os.Remove(filepath.Join(a.dir, entry.Name()))
+		}
+	}
+}
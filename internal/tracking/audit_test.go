@@ -0,0 +1,72 @@
+package tracking
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/tools"
+)
+
+func TestAuditTrail(t *testing.T) {
+	const id = "0123456789abcdef0123456789abcdef"
+	redact := func(s string) string { return strings.ReplaceAll(s, "hunter2", "[REDACTED]") }
+	exchanges := []tools.Exchange{
+		{System: "You fix bugs", Prompt: "Fix KeyError, password=hunter2", Output: "Done", At: time.Now()},
+		{Prompt: "Try again", Error: "timed out after hunter2"},
+	}
+
+	for _, dir := range []string{"", filepath.Join(t.TempDir(), "audit")} {
+		a, err := OpenAuditTrail(dir, 24*time.Hour, redact)
+		if err != nil {
+			t.Fatalf("OpenAuditTrail(%q) error = %v", dir, err)
+		}
+		if err := a.Save(id, exchanges); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+		if err := a.Save("../history", exchanges); err == nil {
+			t.Error("Save() with an invalid record ID succeeded")
+		}
+
+		if dir != "" {
+			// Audits survive a restart
+			if a, err = OpenAuditTrail(dir, 24*time.Hour, redact); err != nil {
+				t.Fatalf("OpenAuditTrail() reopen error = %v", err)
+			}
+		}
+		got, ok, err := a.Get(id)
+		if !ok || err != nil {
+			t.Fatalf("Get() = %v, %v", ok, err)
+		}
+		if got.RecordID != id || len(got.Exchanges) != 2 {
+			t.Fatalf("Get() = %+v, want both exchanges", got)
+		}
+		if got.Exchanges[0].Prompt != "Fix KeyError, password=[REDACTED]" || got.Exchanges[1].Error != "timed out after [REDACTED]" {
+			t.Errorf("Get() = %+v, want redacted exchanges", got.Exchanges)
+		}
+		if exchanges[0].Prompt != "Fix KeyError, password=hunter2" {
+			t.Error("Save() modified the caller's exchanges")
+		}
+		if _, ok, _ := a.Get("unknown"); ok {
+			t.Error("Get(unknown) found an audit")
+		}
+
+		// Audits are dropped with the records they belong to
+		if dir != "" {
+			old := time.Now().Add(-48 * time.Hour)
+			if err := os.Chtimes(filepath.Join(dir, id+".json"), old, old); err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			a.now = func() time.Time { return time.Now().Add(48 * time.Hour) }
+		}
+		if err := a.Save("fedcba9876543210fedcba9876543210", nil); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+		if _, ok, _ := a.Get(id); ok {
+			t.Errorf("Get() found an audit past its retention in %q", dir)
+		}
+	}
+}
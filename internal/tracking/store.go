@@ -0,0 +1,244 @@
+// Package tracking records what happened to every processed job: which
+// Sentry issue it was for, the branch and pull request it produced, how it
+// ended and what it cost.
+package tracking
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/store"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/webhook"
+)
+
+// Outcome is how a job ended.
+type Outcome string
+
+const (
+	// OutcomePROpened means a fix PR was opened.
+	OutcomePROpened Outcome = "pr_opened"
+	// OutcomePRPending means a fix PR was recorded in the queue's outbox and
+	// will be opened by the delivery loop. The record becomes failed if the
+	// loop gives up on it.
+	OutcomePRPending Outcome = "pr_pending"
+	// OutcomeSuggested means the fix was posted as suggestions on an existing PR.
+	OutcomeSuggested Outcome = "suggested"
+	// OutcomeAdvisory means the fix went into a private security advisory.
+	OutcomeAdvisory Outcome = "advisory"
+	// OutcomeDeferred means the repository's PR budget was exhausted.
+	OutcomeDeferred Outcome = "deferred"
+	// OutcomeLowConfidence means Claude was not confident enough in its fix
+	// to propose it, and its analysis was posted instead.
+	OutcomeLowConfidence Outcome = "low_confidence"
+	// OutcomeOversized means the fix changed more than the repository's
+	// size limits allow, and its analysis was posted instead.
+	OutcomeOversized Outcome = "oversized"
+	// OutcomeAnalyzed means the repository only gets analyses, and the
+	// fix's analysis and suggested diff were posted.
+	OutcomeAnalyzed Outcome = "analyzed"
+	// OutcomeBlocked means the fix appeared to contain secrets, so it was
+	// not proposed.
+	OutcomeBlocked Outcome = "blocked"
+	// OutcomeAlreadyFixed means a merged fix PR for an error with the same
+	// fingerprint was pointed to instead of generating another fix.
+	OutcomeAlreadyFixed Outcome = "already_fixed"
+	// OutcomeDryRun means a fix was generated and logged but, in a dry run,
+	// not proposed.
+	OutcomeDryRun Outcome = "dry_run"
+	// OutcomeSkipped means the job had nothing to do, e.g. no repo mapping.
+	OutcomeSkipped Outcome = "skipped"
+	// OutcomeFailed means the job failed and was dead-lettered.
+	OutcomeFailed Outcome = "failed"
+)
+
+// Record is the history of one processed job.
+type Record struct {
+	ID          string    `json:"id"`
+	Tenant      string    `json:"tenant,omitempty"`
+	IssueID     string    `json:"issue_id"`
+	ShortID     string    `json:"short_id,omitempty"`
+	Project     string    `json:"project"`
+	Fingerprint string    `json:"fingerprint"`
+	Repo        string    `json:"repo,omitempty"`
+	Branch      string    `json:"branch,omitempty"`
+	PRNumber    int       `json:"pr_number,omitempty"`
+	PRURL       string    `json:"pr_url,omitempty"`
+	Outcome     Outcome   `json:"outcome"`
+	Error       string    `json:"error,omitempty"`
+	CostUSD     float64   `json:"cost_usd"`
+	StartedAt   time.Time `json:"started_at"`
+	FinishedAt  time.Time `json:"finished_at"`
+
+	// Tokens used generating fixes, including failed attempts
+	InputTokens  int `json:"input_tokens,omitempty"`
+	OutputTokens int `json:"output_tokens,omitempty"`
+
+	// TestOutput is the end of the output of the repository's tests when
+	// they failed with the fix applied.
+	TestOutput string `json:"test_output,omitempty"`
+	// BuildOutput is the end of the build's output when the repository
+	// failed to build with the fix applied.
+	BuildOutput string `json:"build_output,omitempty"`
+
+	// Confidence is Claude's estimate that its fix is correct.
+	Confidence float64 `json:"confidence,omitempty"`
+	// AnalysisURL links to the issue holding the analysis of a fix not
+	// proposed for low confidence or size.
+	AnalysisURL string `json:"analysis_url,omitempty"`
+}
+
+// NewRecord starts the record of a job.
+func NewRecord(job webhook.Job, startedAt time.Time) Record {
+	return Record{
+		Tenant:      job.Tenant,
+		IssueID:     job.ParsedError.IssueID,
+		ShortID:     job.ParsedError.ShortID,
+		Project:     job.ParsedError.ProjectSlug,
+		Fingerprint: job.ParsedError.Fingerprint(),
+		StartedAt:   startedAt,
+	}
+}
+
+// SetPullRequest records that the job opened a pull request.
+func (r *Record) SetPullRequest(number int, url, branch string) {
+	r.Outcome = OutcomePROpened
+	r.PRNumber = number
+	r.PRURL = url
+	r.Branch = branch
+}
+
+// Query selects records. Empty fields match everything.
+type Query struct {
+	Tenant  string
+	IssueID string
+	Repo    string
+	// Limit caps how many records are returned; 0 means no limit.
+	Limit int
+}
+
+func (q Query) matches(r Record) bool {
+	return (q.Tenant == "" || r.Tenant == q.Tenant) &&
+		(q.IssueID == "" || r.IssueID == q.IssueID) &&
+		(q.Repo == "" || r.Repo == q.Repo)
+}
+
+// Store persists job records for a retention period. When created with an
+// empty path it keeps everything in memory.
+type Store struct {
+	path      string
+	retention time.Duration
+	now       func() time.Time
+
+	mu      sync.Mutex
+	records map[string]Record
+}
+
+// Open opens the store at path, loading any records still within retention.
+func Open(path string, retention time.Duration) (*Store, error) {
+	s := &Store{
+		path:      path,
+		retention: retention,
+		now:       time.Now,
+		records:   make(map[string]Record),
+	}
+
+	if path != "" {
+		if _, err := store.ReadJSON(path, &s.records); err != nil {
+			return nil, err
+		}
+		s.prune()
+	}
+
+	return s, nil
+}
+
+// Add stores rec, assigning it an ID, and returns the stored record.
+func (s *Store) Add(rec Record) (Record, error) {
+	id, err := newID()
+	if err != nil {
+		return Record{}, err
+	}
+	rec.ID = id
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.prune()
+	s.records[id] = rec
+	return rec, s.save()
+}
+
+// Update applies fn to the record with the given ID. It reports whether the
+// record exists.
+func (s *Store) Update(id string, fn func(*Record)) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, ok := s.records[id]
+	if !ok {
+		return false, nil
+	}
+	fn(&rec)
+	s.records[id] = rec
+	return true, s.save()
+}
+
+// Get returns the record with the given ID.
+func (s *Store) Get(id string) (Record, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, ok := s.records[id]
+	return rec, ok
+}
+
+// List returns the records matching q, newest first.
+func (s *Store) List(q Query) []Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var records []Record
+	for _, r := range s.records {
+		if q.matches(r) {
+			records = append(records, r)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].StartedAt.After(records[j].StartedAt)
+	})
+	if q.Limit > 0 && len(records) > q.Limit {
+		records = records[:q.Limit]
+	}
+	return records
+}
+
+// prune drops records older than the retention period. Callers must hold s.mu.
+func (s *Store) prune() {
+	cutoff := s.now().Add(-s.retention)
+	for id, r := range s.records {
+		if r.StartedAt.Before(cutoff) {
+			delete(s.records, id)
+		}
+	}
+}
+
+// save writes the store to disk. Callers must hold s.mu.
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+	return store.WriteJSON(s.path, s.records)
+}
+
+// newID returns a random record ID.
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
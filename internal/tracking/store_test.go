@@ -0,0 +1,74 @@
+package tracking
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/webhook"
+)
+
+func testJob(issueID string) webhook.Job {
+	return webhook.Job{ParsedError: &webhook.ParsedError{IssueID: issueID, ProjectSlug: "api", ErrorType: "KeyError"}}
+}
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.json")
+	now := time.Now()
+
+	s, err := Open(path, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	s.now = func() time.Time { return now }
+
+	first := NewRecord(testJob("1"), now.Add(-time.Hour))
+	first.Repo = "org/api"
+	first.Outcome = OutcomePRPending
+	first, err = s.Add(first)
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	second := NewRecord(testJob("2"), now)
+	second.Repo = "org/web"
+	second.Outcome = OutcomeFailed
+	if _, err := s.Add(second); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	ok, err := s.Update(first.ID, func(r *Record) {
+		r.Outcome = OutcomePROpened
+		r.PRNumber = 7
+	})
+	if !ok || err != nil {
+		t.Fatalf("Update() = %v, %v", ok, err)
+	}
+
+	// Records survive a restart
+	reopened, err := Open(path, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("Open() reopen error = %v", err)
+	}
+	reopened.now = s.now
+
+	all := reopened.List(Query{})
+	if len(all) != 2 || all[0].IssueID != "2" {
+		t.Fatalf("List() = %+v, want both records newest first", all)
+	}
+	got := reopened.List(Query{Repo: "org/api"})
+	if len(got) != 1 || got[0].Outcome != OutcomePROpened || got[0].PRNumber != 7 || got[0].Fingerprint == "" {
+		t.Errorf("List(repo) = %+v, want updated record", got)
+	}
+	if got := reopened.List(Query{Limit: 1}); len(got) != 1 {
+		t.Errorf("List(limit 1) = %d records", len(got))
+	}
+
+	// Old records are dropped
+	reopened.now = func() time.Time { return now.Add(24*time.Hour - time.Minute) }
+	if _, err := reopened.Add(NewRecord(testJob("3"), reopened.now())); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if _, ok := reopened.Get(first.ID); ok {
+		t.Error("Get() found a record past retention")
+	}
+}
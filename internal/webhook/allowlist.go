@@ -0,0 +1,82 @@
+package webhook
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// IPAllowlist rejects requests whose client address is outside the allowed
+// networks. Requests arriving through a trusted proxy are attributed to the
+// address the proxy reports in X-Forwarded-For.
+type IPAllowlist struct {
+	allowed []netip.Prefix
+	trusted []netip.Prefix
+}
+
+// NewIPAllowlist creates an allowlist for the given networks, trusting
+// X-Forwarded-For only from trustedProxies.
+func NewIPAllowlist(allowed, trustedProxies []netip.Prefix) *IPAllowlist {
+	return &IPAllowlist{allowed: allowed, trusted: trustedProxies}
+}
+
+// ClientIP returns the address of the client that sent r. It walks
+// X-Forwarded-For from the nearest hop and stops at the first address that
+// isn't a trusted proxy, so clients can't spoof their address by prepending
+// entries.
+func (a *IPAllowlist) ClientIP(r *http.Request) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	addr = addr.Unmap()
+
+	if !contains(a.trusted, addr) {
+		return addr, true
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			return netip.Addr{}, false
+		}
+		addr = hop.Unmap()
+		if !contains(a.trusted, addr) {
+			break
+		}
+	}
+	return addr, true
+}
+
+// Middleware returns an HTTP middleware that rejects requests from clients
+// outside the allowlist with 403.
+func (a *IPAllowlist) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addr, ok := a.ClientIP(r)
+		if !ok || !contains(a.allowed, addr) {
+			log.Printf("rejecting webhook from %s (remote %s)", addr, r.RemoteAddr)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func contains(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+package webhook
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestIPAllowlist_Middleware(t *testing.T) {
+	allowlist := NewIPAllowlist(
+		[]netip.Prefix{netip.MustParsePrefix("35.184.238.160/27"), netip.MustParsePrefix("2001:db8::/32")},
+		[]netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+	)
+	handler := allowlist.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		wantStatus   int
+	}{
+		{"allowed direct", "35.184.238.161:5000", nil, http.StatusOK},
+		{"allowed ipv6", "[2001:db8::1]:5000", nil, http.StatusOK},
+		{"denied direct", "203.0.113.9:5000", nil, http.StatusForbidden},
+		{"untrusted proxy header ignored", "203.0.113.9:5000", []string{"35.184.238.161"}, http.StatusForbidden},
+		{"allowed via trusted proxy", "10.1.2.3:5000", []string{"35.184.238.161"}, http.StatusOK},
+		{"denied via trusted proxy", "10.1.2.3:5000", []string{"203.0.113.9"}, http.StatusForbidden},
+		{"spoofed leftmost entry", "10.1.2.3:5000", []string{"35.184.238.161, 203.0.113.9"}, http.StatusForbidden},
+		{"chained trusted proxies", "10.1.2.3:5000", []string{"35.184.238.161, 10.9.9.9"}, http.StatusOK},
+		{"split headers", "10.1.2.3:5000", []string{"203.0.113.9", "35.184.238.161"}, http.StatusOK},
+		{"garbage header", "10.1.2.3:5000", []string{"not-an-ip"}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/webhook/sentry", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.forwardedFor {
+				req.Header.Add("X-Forwarded-For", v)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("status code = %v, want %v", rr.Code, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strconv"
+	"time"
+)
+
+// maxBreadcrumbs caps how many of the latest breadcrumbs are kept.
+const maxBreadcrumbs = 30
+
+// BreadcrumbsData represents breadcrumbs entry data: the trail of events
+// leading up to the error, oldest first.
+type BreadcrumbsData struct {
+	Values []Breadcrumb `json:"values"`
+}
+
+// Breadcrumb is a single event recorded before the error, such as an HTTP
+// request, a database query or a log message.
+type Breadcrumb struct {
+	Timestamp BreadcrumbTime         `json:"timestamp"`
+	Type      string                 `json:"type"`
+	Category  string                 `json:"category"`
+	Level     string                 `json:"level"`
+	Message   string                 `json:"message"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+}
+
+// BreadcrumbTime is a breadcrumb's timestamp, which Sentry sends as an ISO
+// 8601 string or as seconds since the epoch.
+type BreadcrumbTime struct {
+	time.Time
+}
+
+// UnmarshalJSON accepts both timestamp formats, leaving the time zero for
+// anything else.
+func (t *BreadcrumbTime) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		t.Time, _ = time.Parse(time.RFC3339Nano, s)
+		return nil
+	}
+	if secs, err := strconv.ParseFloat(string(data), 64); err == nil {
+		// Keep to microseconds, which is all a float64 holds this far from 1970
+		whole := math.Floor(secs)
+		t.Time = time.Unix(int64(whole), int64(math.Round((secs-whole)*1e6))*1e3).UTC()
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package webhook
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePayload_Breadcrumbs(t *testing.T) {
+	crumbs := []string{
+		`{"timestamp": "2026-10-15T09:00:01.5Z", "category": "http", "data": {"method": "GET", "url": "/api/users/7", "status_code": 500}}`,
+		`{"timestamp": 1792054802.25, "category": "query", "message": "SELECT * FROM users WHERE id = 7"}`,
+	}
+	for i := 0; i < maxBreadcrumbs; i++ {
+		crumbs = append([]string{fmt.Sprintf(`{"message": "old %d"}`, i)}, crumbs...)
+	}
+	body := `{
+		"action": "created",
+		"data": {
+			"issue": {"id": "1"},
+			"event": {
+				"contexts": {
+					"runtime": {"name": "CPython", "version": "3.11.4"},
+					"os": {"name": "Ubuntu", "version": "22.04"},
+					"device": {"name": "Jane's phone", "model": "iPhone15,2"},
+					"browser": {"version": "118"}
+				},
+				"entries": [{"type": "breadcrumbs", "data": {"values": [` + strings.Join(crumbs, ",") + `]}}]
+			}
+		}
+	}`
+
+	_, parsed, err := ParsePayload([]byte(body))
+	if err != nil {
+		t.Fatalf("ParsePayload() error = %v", err)
+	}
+
+	wantContexts := map[string]string{"runtime": "CPython 3.11.4", "os": "Ubuntu 22.04", "device": "iPhone15,2"}
+	if !reflect.DeepEqual(parsed.Contexts, wantContexts) {
+		t.Errorf("Contexts = %v, want %v", parsed.Contexts, wantContexts)
+	}
+
+	if len(parsed.Breadcrumbs) != maxBreadcrumbs {
+		t.Fatalf("got %d breadcrumbs, want the latest %d", len(parsed.Breadcrumbs), maxBreadcrumbs)
+	}
+	last := parsed.Breadcrumbs[maxBreadcrumbs-2:]
+	if last[0].Category != "http" || last[0].Data["url"] != "/api/users/7" || !last[0].Timestamp.Equal(time.Date(2026, 10, 15, 9, 0, 1, 5e8, time.UTC)) {
+		t.Errorf("http breadcrumb = %+v", last[0])
+	}
+	if last[1].Message != "SELECT * FROM users WHERE id = 7" || !last[1].Timestamp.Equal(time.Date(2026, 10, 15, 9, 0, 2, 25e7, time.UTC)) {
+		t.Errorf("query breadcrumb = %+v at %v", last[1], last[1].Timestamp.Time)
+	}
+}
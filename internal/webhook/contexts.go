@@ -0,0 +1,48 @@
+package webhook
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Summary describes the runtime, OS, browser and device the event happened
+// on, such as "CPython 3.11.4", keyed by context. Contexts without a name
+// are left out.
+func (c Contexts) Summary() map[string]string {
+	summary := make(map[string]string)
+	for key, ctx := range map[string]map[string]interface{}{
+		"runtime": c.Runtime,
+		"os":      c.OS,
+		"browser": c.Browser,
+		"device":  c.Device,
+	} {
+		if s := describeContext(ctx); s != "" {
+			summary[key] = s
+		}
+	}
+	return summary
+}
+
+// describeContext gives a context's name, or for devices their model, and
+// version.
+func describeContext(ctx map[string]interface{}) string {
+	name := contextString(ctx, "model")
+	if name == "" {
+		name = contextString(ctx, "name")
+	}
+	if name == "" {
+		return ""
+	}
+	if version := contextString(ctx, "version"); version != "" {
+		name += " " + version
+	}
+	return name
+}
+
+func contextString(ctx map[string]interface{}, key string) string {
+	v, ok := ctx[key]
+	if !ok || v == nil {
+		return ""
+	}
+	return strings.TrimSpace(fmt.Sprint(v))
+}
@@ -0,0 +1,53 @@
+package webhook
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// FingerprintDeduper suppresses errors whose fingerprint matches one accepted
+// within the window, so imperfect Sentry grouping doesn't produce near-identical PRs.
+type FingerprintDeduper struct {
+	window time.Duration
+	now    func() time.Time
+
+	mu   sync.Mutex
+	seen map[string]seenIssue
+}
+
+type seenIssue struct {
+	issueID string
+	at      time.Time
+}
+
+// NewFingerprintDeduper creates a deduper that remembers fingerprints for window.
+func NewFingerprintDeduper(window time.Duration) *FingerprintDeduper {
+	return &FingerprintDeduper{
+		window: window,
+		now:    time.Now,
+		seen:   make(map[string]seenIssue),
+	}
+}
+
+// Filter implements Filter. It must run after every other filter so that only
+// errors that will actually be queued are remembered.
+func (d *FingerprintDeduper) Filter(parsed *ParsedError) (bool, string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	for fp, s := range d.seen {
+		if now.Sub(s.at) > d.window {
+			delete(d.seen, fp)
+		}
+	}
+
+	fp := parsed.Fingerprint()
+	if prev, ok := d.seen[fp]; ok && prev.issueID != parsed.IssueID {
+		return false, fmt.Sprintf("duplicate of issue %s (fingerprint %s)", prev.issueID, fp)
+	}
+
+	d.seen[fp] = seenIssue{issueID: parsed.IssueID, at: now}
+	return true, ""
+}
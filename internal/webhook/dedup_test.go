@@ -0,0 +1,55 @@
+package webhook
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFingerprintDeduper_Filter(t *testing.T) {
+	now := time.Date(2024, 6, 30, 12, 0, 0, 0, time.UTC)
+	d := NewFingerprintDeduper(time.Hour)
+	d.now = func() time.Time { return now }
+
+	frames := []Frame{
+		{Filename: "handler.go", Function: "Serve", InApp: true},
+		{Filename: "user.go", Function: "Load", InApp: true},
+		{Filename: "runtime/panic.go", Function: "panic", InApp: false},
+	}
+	first := &ParsedError{IssueID: "1", Culprit: "user.Load", ErrorType: "NilPointer", Frames: frames}
+	second := &ParsedError{IssueID: "2", Culprit: "user.Load", ErrorType: "NilPointer", Frames: frames}
+	other := &ParsedError{IssueID: "3", Culprit: "user.Load", ErrorType: "IndexOutOfRange", Frames: frames}
+
+	if ok, _ := d.Filter(first); !ok {
+		t.Fatal("first occurrence should be allowed")
+	}
+	if ok, _ := d.Filter(first); !ok {
+		t.Error("the same issue should not be treated as its own duplicate")
+	}
+	if ok, _ := d.Filter(second); ok {
+		t.Error("different issue with the same fingerprint should be suppressed")
+	}
+	if ok, _ := d.Filter(other); !ok {
+		t.Error("different error type should be allowed")
+	}
+
+	now = now.Add(2 * time.Hour)
+	if ok, _ := d.Filter(second); !ok {
+		t.Error("fingerprint should be forgotten after the window")
+	}
+}
+
+func TestParsedError_Fingerprint(t *testing.T) {
+	base := ParsedError{Culprit: "a", ErrorType: "E", Frames: []Frame{{Filename: "x.go", Function: "f", InApp: true}}}
+
+	sameTop := base
+	sameTop.Frames = append([]Frame{{Filename: "main.go", Function: "main", InApp: true}}, base.Frames...)
+	if base.Fingerprint() != sameTop.Fingerprint() {
+		t.Error("fingerprint should only depend on the top in-app frame")
+	}
+
+	otherTop := base
+	otherTop.Frames = []Frame{{Filename: "y.go", Function: "g", InApp: true}}
+	if base.Fingerprint() == otherTop.Fingerprint() {
+		t.Error("different top in-app frame should change the fingerprint")
+	}
+}
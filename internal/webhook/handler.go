@@ -1,30 +1,152 @@
 package webhook
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/archive"
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/filter"
 )
 
+// DefaultRetryAfter is how long Sentry is asked to wait before retrying a
+// delivery rejected because the job queue is full.
+const DefaultRetryAfter = 30 * time.Second
+
 // Job represents a webhook processing job.
 type Job struct {
 	Webhook     *SentryWebhook
 	ParsedError *ParsedError
+	PayloadID   string // archive ID of the raw payload, empty if not archived
+	Tenant      string // tenant the webhook was delivered to, empty for the default
+	// ReceivedAt is when the error was reported, or zero for jobs that start
+	// without a processing delay (replays and manual triggers).
+	ReceivedAt time.Time
+}
+
+// Key identifies the Sentry issue a job is for, so concurrent jobs for the
+// same issue can be coalesced.
+func (j Job) Key() string {
+	return j.Tenant + "/" + j.ParsedError.IssueID
+}
+
+var (
+	// ErrQueueFull is returned by a JobQueue that is at capacity.
+	ErrQueueFull = errors.New("job queue is full")
+	// ErrDuplicateJob is returned by a JobQueue that already has a queued or
+	// running job with the same Key.
+	ErrDuplicateJob = errors.New("job for this issue is already queued")
+)
+
+// JobQueue accepts jobs for asynchronous processing.
+type JobQueue interface {
+	// Enqueue adds job without blocking. It returns ErrDuplicateJob when a
+	// job for the same issue is queued or running, and ErrQueueFull when the
+	// queue is at capacity.
+	Enqueue(ctx context.Context, job Job) error
+}
+
+// Filter decides whether a parsed error should be queued for fixing.
+// It returns false with a human-readable reason to skip the error.
+type Filter func(parsed *ParsedError) (allow bool, reason string)
+
+// TagFilter returns a Filter that evaluates tag include/exclude rules.
+func TagFilter(f filter.TagFilter) Filter {
+	return func(parsed *ParsedError) (bool, string) {
+		return f.Allow(parsed.Tags)
+	}
+}
+
+// ErrorTypeFilter returns a Filter that evaluates per-project error type allow/deny lists.
+func ErrorTypeFilter(f filter.ErrorTypeFilter) Filter {
+	return func(parsed *ParsedError) (bool, string) {
+		return f.Allow(parsed.ProjectSlug, parsed.ErrorType)
+	}
+}
+
+// DeliveryStore remembers webhook deliveries that have already been accepted
+// so Sentry's retries are not processed twice.
+type DeliveryStore interface {
+	// Add records id and reports whether it was new.
+	Add(id string) (bool, error)
+	// Remove forgets id so a retry of the delivery can be processed.
+	Remove(id string) error
+}
+
+// PayloadArchive stores raw webhook payloads for debugging and replay.
+type PayloadArchive interface {
+	Put(ctx context.Context, id string, payload []byte) error
+}
+
+// IssueFetcher loads the issue referenced by an event-only payload.
+type IssueFetcher interface {
+	FetchIssue(ctx context.Context, event *Event) (*Issue, error)
+}
+
+// HandlerOptions configures optional Handler behaviour.
+type HandlerOptions struct {
+	// Tenant is recorded on every job; empty for the default tenant.
+	Tenant string
+	// Deliveries skips duplicate deliveries when set.
+	Deliveries DeliveryStore
+	// Archive stores every accepted payload when set.
+	Archive PayloadArchive
+	// Filters are applied in order; errors rejected by any of them are
+	// acknowledged but not queued.
+	Filters []Filter
+	// Issues resolves the issue of event-only payloads. Without it those
+	// payloads are acknowledged but not processed.
+	Issues IssueFetcher
+	// RetryAfter is sent with 429 responses when the job queue is full.
+	// Defaults to DefaultRetryAfter.
+	RetryAfter time.Duration
 }
 
 // Handler handles incoming Sentry webhooks.
 type Handler struct {
-	jobQueue chan<- Job
+	jobQueue   JobQueue
+	tenant     string
+	deliveries DeliveryStore
+	archive    PayloadArchive
+	filters    []Filter
+	issues     IssueFetcher
+	retryAfter time.Duration
 }
 
 // NewHandler creates a new webhook handler.
-func NewHandler(jobQueue chan<- Job) *Handler {
+func NewHandler(jobQueue JobQueue, opts HandlerOptions) *Handler {
+	if opts.RetryAfter <= 0 {
+		opts.RetryAfter = DefaultRetryAfter
+	}
 	return &Handler{
-		jobQueue: jobQueue,
+		jobQueue:   jobQueue,
+		tenant:     opts.Tenant,
+		deliveries: opts.Deliveries,
+		archive:    opts.Archive,
+		filters:    opts.Filters,
+		issues:     opts.Issues,
+		retryAfter: opts.RetryAfter,
 	}
 }
 
+// deliveryKey identifies a webhook delivery by its event ID, falling back to
+// Sentry's Request-ID header. It returns "" if neither is available.
+func deliveryKey(r *http.Request, wh *SentryWebhook) string {
+	if wh.Data.Event != nil && wh.Data.Event.EventID != "" {
+		return "event:" + wh.Data.Event.EventID
+	}
+	if id := r.Header.Get("Request-ID"); id != "" {
+		return "request:" + id
+	}
+	return ""
+}
+
 // ServeHTTP implements http.Handler.
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -36,7 +158,7 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		log.Printf("failed to read webhook body: %v", err)
-		http.Error(w, "failed to read body", http.StatusBadRequest)
+		bodyError(w, err)
 		return
 	}
 
@@ -47,35 +169,137 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid payload", http.StatusBadRequest)
 		return
 	}
-	log.Printf("received webhook: action=%s, issue_id=%s", webhook.Action, webhook.Data.Issue.ID)
-	// Only process error/issue events
-	if webhook.Action != "created" && webhook.Action != "triggered" {
-		log.Printf("ignoring webhook action: %s", webhook.Action)
+	log.Printf("received webhook: action=%s, issue_id=%s", webhook.Action, issueID(&webhook))
+
+	// Archive the raw payload so it can be inspected and replayed later
+	payloadID := ""
+	if h.archive != nil {
+		id := archive.NewID(time.Now())
+		if err := h.archive.Put(r.Context(), id, body); err != nil {
+			log.Printf("failed to archive webhook payload: %v", err)
+		} else {
+			payloadID = id
+		}
+	}
+
+	// Dispatch on the resource type; only issue-bearing deliveries become jobs
+	if reason := checkResource(r, &webhook); reason != "" {
+		log.Printf("not processing webhook: %s", reason)
 		w.WriteHeader(http.StatusAccepted)
 		return
 	}
 
-	// Parse error information
+	// Skip deliveries we have already accepted (Sentry retries slow responses)
+	key := ""
+	if h.deliveries != nil {
+		key = deliveryKey(r, &webhook)
+	}
+	if key != "" {
+		isNew, err := h.deliveries.Add(key)
+		if err != nil {
+			// Prefer processing a possible duplicate over losing the webhook
+			log.Printf("failed to record delivery %s: %v", key, err)
+		} else if !isNew {
+			log.Printf("ignoring duplicate delivery %s for issue %s", key, issueID(&webhook))
+			w.WriteHeader(http.StatusAccepted)
+			w.Write([]byte(`{"status":"duplicate"}`))
+			return
+		}
+	}
+
+	// Event-only payloads reference their issue; fetch it so they can be processed
+	if webhook.Data.Issue == nil && webhook.Data.Event != nil && h.issues != nil {
+		issue, err := h.issues.FetchIssue(r.Context(), webhook.Data.Event)
+		if err != nil {
+			log.Printf("failed to fetch issue for event %s: %v", webhook.Data.Event.EventID, err)
+			h.forgetDelivery(key)
+			h.retryLater(w, `{"status":"issue_unavailable"}`)
+			return
+		}
+		webhook.Data.Issue = issue
+	}
+
 	parsed := ParseWebhook(&webhook)
 	if parsed == nil {
-		log.Printf("webhook has no issue data")
+		log.Printf("not processing webhook: webhook has no issue data")
 		w.WriteHeader(http.StatusAccepted)
 		return
 	}
 
+	// Apply filters before queueing
+	for _, f := range h.filters {
+		if ok, reason := f(parsed); !ok {
+			log.Printf("skipping issue %s: %s", parsed.IssueID, reason)
+			w.WriteHeader(http.StatusAccepted)
+			w.Write([]byte(`{"status":"skipped"}`))
+			return
+		}
+	}
+
 	// Queue job for async processing (non-blocking)
-	select {
-	case h.jobQueue <- Job{Webhook: &webhook, ParsedError: parsed}:
-		log.Printf("queued job for issue %s (project: %s)", parsed.IssueID, parsed.ProjectSlug)
-	default:
-		log.Printf("job queue full, dropping webhook for issue %s", parsed.IssueID)
+	job := Job{Webhook: &webhook, ParsedError: parsed, PayloadID: payloadID, Tenant: h.tenant, ReceivedAt: time.Now()}
+	err = h.jobQueue.Enqueue(r.Context(), job)
+	if errors.Is(err, ErrDuplicateJob) {
+		log.Printf("issue %s is already queued or being fixed, coalescing", parsed.IssueID)
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"status":"coalesced"}`))
+		return
+	}
+	if err != nil {
+		h.forgetDelivery(key)
+		if errors.Is(err, ErrQueueFull) {
+			log.Printf("job queue full, asking Sentry to retry issue %s", parsed.IssueID)
+			h.retryLater(w, `{"status":"queue_full"}`)
+		} else {
+			log.Printf("failed to queue issue %s, asking Sentry to retry: %v", parsed.IssueID, err)
+			h.retryLater(w, `{"status":"queue_unavailable"}`)
+		}
+		return
 	}
+	log.Printf("queued job for issue %s (project: %s)", parsed.IssueID, parsed.ProjectSlug)
 
 	// Respond immediately (Sentry requires <1 second response)
 	w.WriteHeader(http.StatusAccepted)
 	w.Write([]byte(`{"status":"queued"}`))
 }
 
+// forgetDelivery removes a recorded delivery so Sentry's retry of it gets
+// through.
+func (h *Handler) forgetDelivery(key string) {
+	if key == "" {
+		return
+	}
+	if err := h.deliveries.Remove(key); err != nil {
+		log.Printf("failed to forget delivery %s: %v", key, err)
+	}
+}
+
+// retryLater responds 429 with Retry-After so Sentry redelivers the webhook.
+func (h *Handler) retryLater(w http.ResponseWriter, body string) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(h.retryAfter.Seconds()))))
+	w.WriteHeader(http.StatusTooManyRequests)
+	w.Write([]byte(body))
+}
+
+// issueID returns the webhook's issue ID for logging, or "" if it has no issue.
+func issueID(wh *SentryWebhook) string {
+	if wh.Data.Issue == nil {
+		return ""
+	}
+	return wh.Data.Issue.ID
+}
+
+// bodyError answers a request whose body could not be read, with 413 when
+// it exceeded the server's size limit.
+func bodyError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, "body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	http.Error(w, "failed to read body", http.StatusBadRequest)
+}
+
 // HealthHandler returns a simple health check handler.
 func HealthHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -1,21 +1,26 @@
 package webhook
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/Mariscal6/sentry-claude-auto-pr/internal/filter"
 )
 
 func TestHandler_ServeHTTP(t *testing.T) {
 	jobQueue := make(chan Job, 10)
-	handler := NewHandler(jobQueue)
+	handler := NewHandler(chanQueue(jobQueue), HandlerOptions{})
 
 	tests := []struct {
 		name       string
 		method     string
+		resource   string
 		body       string
 		wantStatus int
 		wantJob    bool
@@ -41,6 +46,46 @@ func TestHandler_ServeHTTP(t *testing.T) {
 			wantStatus: http.StatusAccepted,
 			wantJob:    false,
 		},
+		{
+			name:       "issue resource created",
+			method:     http.MethodPost,
+			resource:   "issue",
+			body:       validWebhookPayload("created"),
+			wantStatus: http.StatusAccepted,
+			wantJob:    true,
+		},
+		{
+			name:       "issue resource assigned ignored",
+			method:     http.MethodPost,
+			resource:   "issue",
+			body:       validWebhookPayload("assigned"),
+			wantStatus: http.StatusAccepted,
+			wantJob:    false,
+		},
+		{
+			name:       "event alert triggered",
+			method:     http.MethodPost,
+			resource:   "event_alert",
+			body:       validWebhookPayload("triggered"),
+			wantStatus: http.StatusAccepted,
+			wantJob:    true,
+		},
+		{
+			name:       "metric alert ignored",
+			method:     http.MethodPost,
+			resource:   "metric_alert",
+			body:       validWebhookPayload("critical"),
+			wantStatus: http.StatusAccepted,
+			wantJob:    false,
+		},
+		{
+			name:       "unknown resource ignored",
+			method:     http.MethodPost,
+			resource:   "seer",
+			body:       validWebhookPayload("created"),
+			wantStatus: http.StatusAccepted,
+			wantJob:    false,
+		},
 		{
 			name:       "GET method not allowed",
 			method:     http.MethodGet,
@@ -66,6 +111,9 @@ func TestHandler_ServeHTTP(t *testing.T) {
 			}
 
 			req := httptest.NewRequest(tt.method, "/webhook/sentry", strings.NewReader(tt.body))
+			if tt.resource != "" {
+				req.Header.Set("Sentry-Hook-Resource", tt.resource)
+			}
 			rr := httptest.NewRecorder()
 
 			handler.ServeHTTP(rr, req)
@@ -89,6 +137,272 @@ func TestHandler_ServeHTTP(t *testing.T) {
 	}
 }
 
+func TestHandler_Filters(t *testing.T) {
+	jobQueue := make(chan Job, 10)
+	exclude, _ := filter.ParseTagRules("browser:IE11")
+	handler := NewHandler(chanQueue(jobQueue), HandlerOptions{
+		Filters: []Filter{TagFilter(filter.TagFilter{Exclude: exclude})},
+	})
+
+	tests := []struct {
+		name    string
+		tags    []Tag
+		wantJob bool
+	}{
+		{"excluded tag skipped", []Tag{{Key: "browser", Value: "IE11"}}, false},
+		{"other tag queued", []Tag{{Key: "browser", Value: "Chrome"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wh := SentryWebhook{
+				Action: "created",
+				Data: WebhookData{
+					Issue: &Issue{ID: "1", Project: Project{Slug: "test-project"}},
+					Event: &Event{Tags: tt.tags},
+				},
+			}
+			body, _ := json.Marshal(wh)
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/webhook/sentry", strings.NewReader(string(body))))
+
+			if rr.Code != http.StatusAccepted {
+				t.Errorf("status code = %v, want %v", rr.Code, http.StatusAccepted)
+			}
+
+			select {
+			case <-jobQueue:
+				if !tt.wantJob {
+					t.Error("unexpected job queued")
+				}
+			default:
+				if tt.wantJob {
+					t.Error("expected job to be queued, but none received")
+				}
+			}
+		})
+	}
+}
+
+func TestHandler_DuplicateDeliveries(t *testing.T) {
+	jobQueue := make(chan Job, 10)
+	handler := NewHandler(chanQueue(jobQueue), HandlerOptions{Deliveries: newMemoryDeliveries()})
+
+	send := func(eventID, requestID string) {
+		wh := SentryWebhook{
+			Action: "created",
+			Data: WebhookData{
+				Issue: &Issue{ID: "1", Project: Project{Slug: "test-project"}},
+			},
+		}
+		if eventID != "" {
+			wh.Data.Event = &Event{EventID: eventID}
+		}
+		body, _ := json.Marshal(wh)
+
+		req := httptest.NewRequest(http.MethodPost, "/webhook/sentry", strings.NewReader(string(body)))
+		if requestID != "" {
+			req.Header.Set("Request-ID", requestID)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	send("evt-1", "")
+	send("evt-1", "") // retry of the same event
+	send("", "req-1") // keyed by Request-ID
+	send("", "req-1") // retry
+	send("", "")      // no key, always processed
+	send("", "")
+
+	if got := len(jobQueue); got != 4 {
+		t.Errorf("queued jobs = %d, want 4", got)
+	}
+}
+
+func TestHandler_QueueFull(t *testing.T) {
+	jobQueue := make(chan Job, 1)
+	deliveries := newMemoryDeliveries()
+	handler := NewHandler(chanQueue(jobQueue), HandlerOptions{Deliveries: deliveries, RetryAfter: 90 * time.Second})
+
+	send := func(eventID string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(SentryWebhook{
+			Action: "created",
+			Data: WebhookData{
+				Issue: &Issue{ID: "1", Project: Project{Slug: "test-project"}},
+				Event: &Event{EventID: eventID},
+			},
+		})
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/webhook/sentry", strings.NewReader(string(body))))
+		return rr
+	}
+
+	if rr := send("evt-1"); rr.Code != http.StatusAccepted {
+		t.Fatalf("first delivery status = %v, want %v", rr.Code, http.StatusAccepted)
+	}
+
+	rr := send("evt-2")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("status with full queue = %v, want %v", rr.Code, http.StatusTooManyRequests)
+	}
+	if got := rr.Header().Get("Retry-After"); got != "90" {
+		t.Errorf("Retry-After = %q, want %q", got, "90")
+	}
+
+	// Once there is room the retry must be accepted, not treated as a duplicate
+	<-jobQueue
+	if rr := send("evt-2"); rr.Code != http.StatusAccepted {
+		t.Errorf("retry status = %v, want %v", rr.Code, http.StatusAccepted)
+	}
+	if got := len(jobQueue); got != 1 {
+		t.Errorf("queued jobs = %d, want 1", got)
+	}
+}
+
+func TestHandler_BodyTooLarge(t *testing.T) {
+	jobQueue := make(chan Job, 1)
+	handler := http.MaxBytesHandler(NewHandler(chanQueue(jobQueue), HandlerOptions{}), 64)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/webhook/sentry", strings.NewReader(validWebhookPayload("created"))))
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %v, want %v", rr.Code, http.StatusRequestEntityTooLarge)
+	}
+	if got := len(jobQueue); got != 0 {
+		t.Errorf("queued jobs = %d, want 0", got)
+	}
+}
+
+func TestHandler_CoalescesQueuedIssue(t *testing.T) {
+	deliveries := newMemoryDeliveries()
+	handler := NewHandler(errQueue{ErrDuplicateJob}, HandlerOptions{Deliveries: deliveries})
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/webhook/sentry", strings.NewReader(validWebhookPayload("created"))))
+
+	if rr.Code != http.StatusAccepted {
+		t.Errorf("status code = %v, want %v", rr.Code, http.StatusAccepted)
+	}
+	if !strings.Contains(rr.Body.String(), "coalesced") {
+		t.Errorf("body = %s, want coalesced status", rr.Body.String())
+	}
+}
+
+func TestHandler_EventOnlyPayload(t *testing.T) {
+	body := `{"action": "triggered", "data": {"event": {"event_id": "abc", "issue_id": "42", "issue_url": "https://sentry.io/api/0/issues/42/"}}}`
+
+	tests := []struct {
+		name       string
+		issues     IssueFetcher
+		wantStatus int
+		wantJob    bool
+	}{
+		{"issue fetched", fakeIssues{issue: &Issue{ID: "42", Project: Project{Slug: "api"}}}, http.StatusAccepted, true},
+		{"fetch failed", fakeIssues{err: errors.New("boom")}, http.StatusTooManyRequests, false},
+		{"no fetcher", nil, http.StatusAccepted, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jobQueue := make(chan Job, 1)
+			handler := NewHandler(chanQueue(jobQueue), HandlerOptions{Issues: tt.issues})
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/webhook/sentry", strings.NewReader(body)))
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("status code = %v, want %v", rr.Code, tt.wantStatus)
+			}
+			if got := len(jobQueue) == 1; got != tt.wantJob {
+				t.Fatalf("job queued = %v, want %v", got, tt.wantJob)
+			}
+			if tt.wantJob {
+				if job := <-jobQueue; job.ParsedError.IssueID != "42" || job.ParsedError.ProjectSlug != "api" {
+					t.Errorf("job = %+v, want fetched issue", job.ParsedError)
+				}
+			}
+		})
+	}
+}
+
+type fakeIssues struct {
+	issue *Issue
+	err   error
+}
+
+func (f fakeIssues) FetchIssue(ctx context.Context, event *Event) (*Issue, error) {
+	return f.issue, f.err
+}
+
+func TestHandler_EventOnlyPayload_FetchesLast(t *testing.T) {
+	event := `{"eventID": "abc", "issue_id": "42", "issue_url": "https://sentry.io/api/0/issues/42/"}`
+	post := func(handler *Handler, action string) *httptest.ResponseRecorder {
+		body := `{"action": "` + action + `", "data": {"event": ` + event + `}}`
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/webhook/sentry", strings.NewReader(body)))
+		return rr
+	}
+
+	issues := &countingIssues{err: errors.New("boom")}
+	jobQueue := make(chan Job, 2)
+	handler := NewHandler(chanQueue(jobQueue), HandlerOptions{Issues: issues, Deliveries: newMemoryDeliveries()})
+
+	// Deliveries that won't be processed don't fetch their issue
+	post(handler, "resolved")
+	if issues.calls != 0 {
+		t.Errorf("FetchIssue() called %d times for an ignored action, want 0", issues.calls)
+	}
+
+	// A failed fetch lets Sentry's retry of the delivery through
+	if rr := post(handler, "triggered"); rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("status code = %v, want %v", rr.Code, http.StatusTooManyRequests)
+	}
+	issues.err = nil
+	issues.issue = &Issue{ID: "42", Project: Project{Slug: "api"}}
+	if rr := post(handler, "triggered"); rr.Code != http.StatusAccepted || len(jobQueue) != 1 {
+		t.Fatalf("retry: status code = %v, queued %d, want %v and a job", rr.Code, len(jobQueue), http.StatusAccepted)
+	}
+
+	// Duplicate deliveries don't fetch their issue again
+	post(handler, "triggered")
+	if issues.calls != 2 {
+		t.Errorf("FetchIssue() called %d times, want 2", issues.calls)
+	}
+}
+
+// countingIssues is an IssueFetcher counting its calls.
+type countingIssues struct {
+	issue *Issue
+	err   error
+	calls int
+}
+
+func (f *countingIssues) FetchIssue(ctx context.Context, event *Event) (*Issue, error) {
+	f.calls++
+	return f.issue, f.err
+}
+
+func TestHandler_Archive(t *testing.T) {
+	jobQueue := make(chan Job, 10)
+	archived := make(map[string][]byte)
+	handler := NewHandler(chanQueue(jobQueue), HandlerOptions{Archive: memoryArchive(archived), Tenant: "acme"})
+
+	body := validWebhookPayload("created")
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/webhook/sentry", strings.NewReader(body)))
+
+	job := <-jobQueue
+	if job.PayloadID == "" {
+		t.Fatal("job should reference the archived payload")
+	}
+	if string(archived[job.PayloadID]) != body {
+		t.Errorf("archived payload = %q, want original body", archived[job.PayloadID])
+	}
+	if job.Tenant != "acme" {
+		t.Errorf("job tenant = %q, want %q", job.Tenant, "acme")
+	}
+}
+
 func TestParseWebhook(t *testing.T) {
 	webhook := &SentryWebhook{
 		Action: "created",
@@ -147,6 +461,125 @@ func TestParseWebhook_NilIssue(t *testing.T) {
 	}
 }
 
+func TestParsePayload_ExceptionFrames(t *testing.T) {
+	body := `{
+		"action": "created",
+		"data": {
+			"issue": {"id": "1", "metadata": {"type": "KeyError"}},
+			"event": {
+				"entries": [
+					{"type": "breadcrumbs", "data": {"values": []}},
+					{"type": "exception", "data": {"values": [{
+						"type": "KeyError",
+						"stacktrace": {"frames": [{
+							"filename": "app/views.py",
+							"function": "get_user",
+							"package": "app",
+							"lineNo": 12,
+							"inApp": true,
+							"context": [[11, "def get_user(request):"], [12, "    return USERS[request.id]"]],
+							"vars": {"request": "<Request>"}
+						}]}
+					}]}},
+					{"type": "exception", "data": "not an object"}
+				]
+			}
+		}
+	}`
+
+	_, parsed, err := ParsePayload([]byte(body))
+	if err != nil {
+		t.Fatalf("ParsePayload() error = %v", err)
+	}
+	if len(parsed.Frames) != 1 {
+		t.Fatalf("got %d frames, want 1", len(parsed.Frames))
+	}
+
+	frame := parsed.Frames[0]
+	if frame.Package != "app" || frame.LineNo != 12 || !frame.InApp {
+		t.Errorf("frame = %+v, want package app, line 12, in app", frame)
+	}
+	if frame.Vars["request"] != "<Request>" {
+		t.Errorf("Vars = %v, want request captured", frame.Vars)
+	}
+
+	lines := frame.ContextLines()
+	if len(lines) != 2 || lines[1].LineNo != 12 || lines[1].Code != "    return USERS[request.id]" {
+		t.Errorf("ContextLines() = %+v", lines)
+	}
+}
+
+func TestParsePayload_ThreadFrames(t *testing.T) {
+	threads := `{"type": "threads", "data": {"values": [
+		{"id": 1, "name": "main", "current": true, "stacktrace": {"frames": [{"function": "main.idle"}]}},
+		{"id": 7, "name": "worker", "crashed": true, "stacktrace": {"frames": [{"function": "main.work"}, {"function": "main.panicky", "inApp": true}]}},
+		{"id": 9, "name": "empty"}
+	]}}`
+
+	tests := []struct {
+		name      string
+		entries   string
+		wantFrame string
+	}{
+		{"crashed thread", threads, "main.panicky"},
+		{"exception wins", `{"type": "exception", "data": {"values": [{"stacktrace": {"frames": [{"function": "main.raise"}]}}]}},` + threads, "main.raise"},
+		{"current thread", `{"type": "threads", "data": {"values": [{"id": 2, "stacktrace": {"frames": [{"function": "a"}]}}, {"id": 3, "current": true, "stacktrace": {"frames": [{"function": "b"}]}}]}}`, "b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"action": "created", "data": {"issue": {"id": "1"}, "event": {"entries": [` + tt.entries + `]}}}`
+			_, parsed, err := ParsePayload([]byte(body))
+			if err != nil {
+				t.Fatalf("ParsePayload() error = %v", err)
+			}
+			if len(parsed.Frames) == 0 {
+				t.Fatal("no frames parsed")
+			}
+			if got := parsed.Frames[len(parsed.Frames)-1].Function; got != tt.wantFrame {
+				t.Errorf("top frame = %q, want %q", got, tt.wantFrame)
+			}
+		})
+	}
+}
+
+func TestParseWebhook_ReleaseTags(t *testing.T) {
+	parsed := ParseWebhook(&SentryWebhook{
+		Data: WebhookData{
+			Issue: &Issue{ID: "1"},
+			Event: &Event{Tags: []Tag{
+				{Key: "release", Value: "api@1.4.2"},
+				{Key: "environment", Value: "production"},
+				{Key: "server_name", Value: "web-3"},
+			}},
+		},
+	})
+
+	if parsed.Release != "api@1.4.2" || parsed.Environment != "production" || parsed.ServerName != "web-3" {
+		t.Errorf("got release=%q environment=%q server=%q", parsed.Release, parsed.Environment, parsed.ServerName)
+	}
+}
+
+func TestFrame_ContextLinesFallback(t *testing.T) {
+	frame := Frame{
+		LineNo:      10,
+		PreContext:  []string{"a", "b"},
+		ContextLine: "c",
+		PostContext: []string{"d"},
+	}
+
+	lines := frame.ContextLines()
+	want := []ContextLine{{8, "a"}, {9, "b"}, {10, "c"}, {11, "d"}}
+	if len(lines) != len(want) {
+		t.Fatalf("ContextLines() = %+v, want %+v", lines, want)
+	}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Errorf("line %d = %+v, want %+v", i, lines[i], want[i])
+		}
+	}
+}
+
 func validWebhookPayload(action string) string {
 	webhook := SentryWebhook{
 		Action: action,
@@ -166,3 +599,50 @@ func validWebhookPayload(action string) string {
 	data, _ := json.Marshal(webhook)
 	return string(data)
 }
+
+// memoryDeliveries is an in-memory DeliveryStore for tests.
+type memoryDeliveries map[string]bool
+
+func newMemoryDeliveries() memoryDeliveries {
+	return make(memoryDeliveries)
+}
+
+func (m memoryDeliveries) Add(id string) (bool, error) {
+	if m[id] {
+		return false, nil
+	}
+	m[id] = true
+	return true, nil
+}
+
+func (m memoryDeliveries) Remove(id string) error {
+	delete(m, id)
+	return nil
+}
+
+// memoryArchive is an in-memory PayloadArchive for tests.
+type memoryArchive map[string][]byte
+
+func (m memoryArchive) Put(ctx context.Context, id string, payload []byte) error {
+	m[id] = payload
+	return nil
+}
+
+// chanQueue adapts a channel to JobQueue for tests.
+type chanQueue chan Job
+
+func (q chanQueue) Enqueue(ctx context.Context, job Job) error {
+	select {
+	case q <- job:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// errQueue is a JobQueue that rejects every job with err.
+type errQueue struct{ err error }
+
+func (q errQueue) Enqueue(ctx context.Context, job Job) error {
+	return q.err
+}
@@ -0,0 +1,55 @@
+package webhook
+
+import (
+	"path"
+	"strings"
+)
+
+// minifiedColumn is the column beyond which a JavaScript frame is assumed to
+// sit on a minified line; hand-written code rarely has lines this long.
+const minifiedColumn = 1000
+
+var minifiedSuffixes = []string{".min.js", ".min.mjs", ".min.cjs"}
+
+// IsMinified reports whether the frame points at minified JavaScript: a
+// .min.js bundle, a mangled single-letter function name, or a huge column.
+func (f Frame) IsMinified() bool {
+	file := f.AbsPath
+	if file == "" {
+		file = f.Filename
+	}
+	if i := strings.IndexAny(file, "?#"); i >= 0 {
+		file = file[:i]
+	}
+	file = strings.ToLower(file)
+
+	for _, suffix := range minifiedSuffixes {
+		if strings.HasSuffix(file, suffix) {
+			return true
+		}
+	}
+
+	switch path.Ext(file) {
+	case ".js", ".mjs", ".cjs":
+	default:
+		return false
+	}
+
+	if f.ColNo > minifiedColumn {
+		return true
+	}
+	return isMangledName(f.Function)
+}
+
+// isMangledName reports whether a function name looks like minifier output,
+// e.g. "e" or "Object.t".
+func isMangledName(name string) bool {
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	if len(name) != 1 {
+		return false
+	}
+	c := name[0]
+	return c == '_' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
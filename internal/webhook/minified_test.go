@@ -0,0 +1,54 @@
+package webhook
+
+import "testing"
+
+func TestFrame_IsMinified(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame Frame
+		want  bool
+	}{
+		{"min bundle", Frame{Filename: "/static/app.min.js", Function: "render", LineNo: 1}, true},
+		{"min bundle with query", Frame{AbsPath: "https://cdn.example.com/vendor.min.js?v=3"}, true},
+		{"mangled name", Frame{Filename: "/static/main.4f2a1c.js", Function: "e"}, true},
+		{"mangled method", Frame{Filename: "/static/main.js", Function: "Object.t"}, true},
+		{"huge column", Frame{Filename: "/static/main.js", Function: "render", ColNo: 48213}, true},
+		{"readable source", Frame{Filename: "src/components/App.js", Function: "render", LineNo: 42, ColNo: 12}, false},
+		{"typescript source", Frame{Filename: "src/App.tsx", Function: "e", ColNo: 5000}, false},
+		{"python frame", Frame{Filename: "app/views.py", Function: "f"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.frame.IsMinified(); got != tt.want {
+				t.Errorf("IsMinified() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseWebhook_Minified(t *testing.T) {
+	tests := []struct {
+		name   string
+		frames string
+		want   bool
+	}{
+		{"minified library only", `{"filename": "/static/vendor.min.js", "function": "n"}, {"filename": "/static/app.js", "function": "render", "inApp": true}`, false},
+		{"minified app frame", `{"filename": "/static/app.js", "function": "render", "colNo": 20000, "inApp": true}`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"action": "created", "data": {"issue": {"id": "1"}, "event": {"entries": [
+				{"type": "exception", "data": {"values": [{"stacktrace": {"frames": [` + tt.frames + `]}}]}}
+			]}}}`
+			_, parsed, err := ParsePayload([]byte(body))
+			if err != nil {
+				t.Fatalf("ParsePayload() error = %v", err)
+			}
+			if parsed.Minified != tt.want {
+				t.Errorf("Minified = %v, want %v", parsed.Minified, tt.want)
+			}
+		})
+	}
+}
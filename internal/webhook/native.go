@@ -0,0 +1,39 @@
+package webhook
+
+import "strings"
+
+// nativePlatforms are the event platforms whose stack traces Sentry
+// symbolicates with uploaded debug files.
+var nativePlatforms = map[string]bool{
+	"c":      true,
+	"cocoa":  true,
+	"native": true,
+	"objc":   true,
+	"swift":  true,
+}
+
+// IsNative reports whether the webhook is for a mobile or native crash,
+// whose frames Sentry symbolicates, or deobfuscates for Android, only after
+// ingestion. Its event is best fetched from the Sentry API rather than taken
+// from the payload.
+func (wh *SentryWebhook) IsNative() bool {
+	if wh.Data.Issue != nil && nativePlatforms[wh.Data.Issue.Platform] {
+		return true
+	}
+	if e := wh.Data.Event; e != nil {
+		// Android events have the java platform
+		return nativePlatforms[e.Platform] || strings.Contains(e.SDK.Name, "android")
+	}
+	return false
+}
+
+// Unsymbolicated reports whether any frame is still a bare instruction
+// address.
+func (p *ParsedError) Unsymbolicated() bool {
+	for _, f := range p.Frames {
+		if f.InstructionAddr != "" && f.Function == "" {
+			return true
+		}
+	}
+	return false
+}
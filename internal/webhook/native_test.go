@@ -0,0 +1,49 @@
+package webhook
+
+import "testing"
+
+func TestSentryWebhook_IsNative(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want bool
+	}{
+		{"cocoa issue", `{"data": {"issue": {"id": "1", "platform": "cocoa"}}}`, true},
+		{"native event", `{"data": {"issue": {"id": "1"}, "event": {"platform": "native"}}}`, true},
+		{"android event", `{"data": {"issue": {"id": "1", "platform": "java"}, "event": {"platform": "java", "sdk": {"name": "sentry.java.android"}}}}`, true},
+		{"java backend", `{"data": {"issue": {"id": "1", "platform": "java"}, "event": {"platform": "java", "sdk": {"name": "sentry.java.spring-boot"}}}}`, false},
+		{"python", `{"data": {"issue": {"id": "1", "platform": "python"}}}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wh, _, err := ParsePayload([]byte(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := wh.IsNative(); got != tt.want {
+				t.Errorf("IsNative() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsedError_Unsymbolicated(t *testing.T) {
+	tests := []struct {
+		name   string
+		frames []Frame
+		want   bool
+	}{
+		{"bare address", []Frame{{InstructionAddr: "0x1a2b"}, {InstructionAddr: "0x3c4d", Function: "main"}}, true},
+		{"symbolicated", []Frame{{InstructionAddr: "0x3c4d", Function: "-[AppDelegate crash]", Filename: "AppDelegate.m"}}, false},
+		{"not native", []Frame{{Filename: "app.py", Function: "handle"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (&ParsedError{Frames: tt.frames}).Unsymbolicated(); got != tt.want {
+				t.Errorf("Unsymbolicated() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package webhook
+
+import (
+	"net/netip"
+	"regexp"
+	"strings"
+)
+
+// PII scrubbing levels. ScrubStandard replaces email addresses, IP addresses
+// and card numbers; ScrubStrict also replaces every string in local
+// variables, breadcrumb data and request headers and query parameters, and
+// drops URL queries.
+const (
+	ScrubOff      = "off"
+	ScrubStandard = "standard"
+	ScrubStrict   = "strict"
+)
+
+// filtered replaces values dropped by ScrubStrict, the way Sentry marks
+// values it scrubbed itself.
+const filtered = "[Filtered]"
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	ipv4Pattern  = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)
+	ipv6Pattern  = regexp.MustCompile(`\b[0-9A-Fa-f]{0,4}(?::[0-9A-Fa-f]{0,4}){2,7}\b`)
+	cardPattern  = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+)
+
+// userTags identify the user an event happened to.
+var userTags = []string{"user", "user.id", "user.email", "user.username", "user.ip", "ip"}
+
+// Scrubbed returns a copy of p with personal data replaced according to
+// level, for errors whose details end up in prompts, pull requests and
+// logs. Code locations are kept as they are. ScrubOff returns p itself.
+func (p *ParsedError) Scrubbed(level string) *ParsedError {
+	if level != ScrubStandard && level != ScrubStrict {
+		return p
+	}
+	strict := level == ScrubStrict
+
+	scrubbed := *p
+	scrubbed.Title = scrubString(p.Title)
+	scrubbed.ErrorMessage = scrubString(p.ErrorMessage)
+
+	scrubbed.Tags = make(map[string]string, len(p.Tags))
+	for key, value := range p.Tags {
+		if !isUserTag(key) {
+			scrubbed.Tags[key] = scrubString(value)
+		}
+	}
+
+	scrubbed.Frames = make([]Frame, len(p.Frames))
+	for i, frame := range p.Frames {
+		if frame.Vars != nil {
+			frame.Vars = scrubValue(frame.Vars, strict).(map[string]interface{})
+		}
+		scrubbed.Frames[i] = frame
+	}
+
+	if p.Breadcrumbs != nil {
+		scrubbed.Breadcrumbs = make([]Breadcrumb, len(p.Breadcrumbs))
+		for i, crumb := range p.Breadcrumbs {
+			crumb.Message = scrubString(crumb.Message)
+			if crumb.Data != nil {
+				crumb.Data = scrubValue(crumb.Data, strict).(map[string]interface{})
+			}
+			scrubbed.Breadcrumbs[i] = crumb
+		}
+	}
+
+	if p.Request != nil {
+		request := *p.Request
+		if strict {
+			request.URL, _, _ = strings.Cut(request.URL, "?")
+			request.URL, _, _ = strings.Cut(request.URL, "#")
+			request.Fragment = ""
+		}
+		request.URL = scrubString(request.URL)
+		request.Fragment = scrubString(request.Fragment)
+		request.Query = scrubKeyValues(request.Query, strict)
+		request.Headers = scrubKeyValues(request.Headers, strict)
+		scrubbed.Request = &request
+	}
+	return &scrubbed
+}
+
+// scrubString replaces the email addresses, IP addresses and card numbers
+// in s.
+func scrubString(s string) string {
+	s = emailPattern.ReplaceAllString(s, "[email]")
+	s = ipv4Pattern.ReplaceAllStringFunc(s, func(m string) string {
+		if _, err := netip.ParseAddr(m); err != nil {
+			return m
+		}
+		return "[ip]"
+	})
+	s = ipv6Pattern.ReplaceAllStringFunc(s, func(m string) string {
+		// Short forms like "::" also appear in code, as in "Foo::Bar"
+		if _, err := netip.ParseAddr(m); err != nil || hexGroups(m) < 3 {
+			return m
+		}
+		return "[ip]"
+	})
+	return cardPattern.ReplaceAllStringFunc(s, func(m string) string {
+		if !luhnValid(m) {
+			return m
+		}
+		return "[card]"
+	})
+}
+
+// scrubValue scrubs the strings in a decoded JSON value, replacing them
+// outright if strict.
+func scrubValue(v interface{}, strict bool) interface{} {
+	switch v := v.(type) {
+	case string:
+		if strict {
+			return filtered
+		}
+		return scrubString(v)
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			out[key] = scrubValue(value, strict)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, value := range v {
+			out[i] = scrubValue(value, strict)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// scrubKeyValues scrubs the values of headers or query parameters,
+// replacing them outright if strict.
+func scrubKeyValues(kv KeyValues, strict bool) KeyValues {
+	var out KeyValues
+	for _, entry := range kv {
+		if strict {
+			entry.Value = filtered
+		} else {
+			entry.Value = scrubString(entry.Value)
+		}
+		out = append(out, entry)
+	}
+	return out
+}
+
+// hexGroups counts the non-empty groups of an IPv6 address.
+func hexGroups(addr string) int {
+	n := 0
+	for _, group := range strings.Split(addr, ":") {
+		if group != "" {
+			n++
+		}
+	}
+	return n
+}
+
+func isUserTag(key string) bool {
+	for _, tag := range userTags {
+		if strings.EqualFold(key, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// luhnValid reports whether the digits in s pass the Luhn check card
+// numbers use.
+func luhnValid(s string) bool {
+	sum, double := 0, false
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
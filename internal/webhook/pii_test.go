@@ -0,0 +1,98 @@
+package webhook
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestScrubString(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"User jane.doe@example.com not found", "User [email] not found"},
+		{"connection from 203.0.113.7 refused", "connection from [ip] refused"},
+		{"client 2001:db8:85a3::8a2e:370:7334 blocked", "client [ip] blocked"},
+		{"card 4111 1111 1111 1111 declined", "card [card] declined"},
+		{"order 1234567890123 not found", "order 1234567890123 not found"},
+		{"NoMethodError in Foo::Bar at 12:30:45", "NoMethodError in Foo::Bar at 12:30:45"},
+		{"version 999.1.2.3", "version 999.1.2.3"},
+	}
+
+	for _, tt := range tests {
+		if got := scrubString(tt.in); got != tt.want {
+			t.Errorf("scrubString(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParsedError_Scrubbed(t *testing.T) {
+	parsed := &ParsedError{
+		Title:        "ValueError: no account for jane@example.com",
+		ErrorMessage: "no account for jane@example.com",
+		Culprit:      "app.accounts in lookup",
+		Tags:         map[string]string{"user": "email:jane@example.com", "environment": "production", "client_ip": "203.0.113.7"},
+		Frames: []Frame{{
+			Filename: "app/accounts.py",
+			Vars:     map[string]interface{}{"email": "'jane@example.com'", "retries": float64(3), "user": nil},
+		}},
+		Breadcrumbs: []Breadcrumb{{
+			Category: "query",
+			Message:  "SELECT * FROM accounts WHERE email = 'jane@example.com'",
+			Data:     map[string]interface{}{"email": "jane@example.com"},
+		}},
+		Request: &RequestData{
+			URL:     "https://example.com/accounts?email=jane@example.com",
+			Query:   KeyValues{{"email", "jane@example.com"}},
+			Headers: KeyValues{{"X-Forwarded-For", "203.0.113.7"}},
+		},
+	}
+
+	t.Run("off", func(t *testing.T) {
+		if got := parsed.Scrubbed(ScrubOff); got != parsed {
+			t.Error("Scrubbed(off) changed the error")
+		}
+	})
+
+	t.Run("standard", func(t *testing.T) {
+		got := parsed.Scrubbed(ScrubStandard)
+
+		if got.Title != "ValueError: no account for [email]" || got.ErrorMessage != "no account for [email]" {
+			t.Errorf("title = %q, message = %q", got.Title, got.ErrorMessage)
+		}
+		wantTags := map[string]string{"environment": "production", "client_ip": "[ip]"}
+		if !reflect.DeepEqual(got.Tags, wantTags) {
+			t.Errorf("tags = %v, want %v", got.Tags, wantTags)
+		}
+		wantVars := map[string]interface{}{"email": "'[email]'", "retries": float64(3), "user": nil}
+		if !reflect.DeepEqual(got.Frames[0].Vars, wantVars) {
+			t.Errorf("vars = %v, want %v", got.Frames[0].Vars, wantVars)
+		}
+		if got.Request.URL != "https://example.com/accounts?email=[email]" || got.Request.Query[0].Value != "[email]" || got.Request.Headers[0].Value != "[ip]" {
+			t.Errorf("request = %+v", got.Request)
+		}
+		if got.Breadcrumbs[0].Message != "SELECT * FROM accounts WHERE email = '[email]'" || got.Breadcrumbs[0].Data["email"] != "[email]" {
+			t.Errorf("breadcrumbs = %+v", got.Breadcrumbs)
+		}
+		if got.Culprit != parsed.Culprit || got.Frames[0].Filename != "app/accounts.py" {
+			t.Error("Scrubbed() changed code locations")
+		}
+		if parsed.Title != "ValueError: no account for jane@example.com" || parsed.Frames[0].Vars["email"] != "'jane@example.com'" || parsed.Breadcrumbs[0].Data["email"] != "jane@example.com" || parsed.Request.Query[0].Value != "jane@example.com" {
+			t.Error("Scrubbed() modified the original error")
+		}
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		got := parsed.Scrubbed(ScrubStrict)
+
+		wantVars := map[string]interface{}{"email": "[Filtered]", "retries": float64(3), "user": nil}
+		if !reflect.DeepEqual(got.Frames[0].Vars, wantVars) {
+			t.Errorf("vars = %v, want %v", got.Frames[0].Vars, wantVars)
+		}
+		if got.Breadcrumbs[0].Data["email"] != "[Filtered]" {
+			t.Errorf("breadcrumb data = %v, want filtered", got.Breadcrumbs[0].Data)
+		}
+		if got.Request.URL != "https://example.com/accounts" || got.Request.Query[0].Value != "[Filtered]" || got.Request.Headers[0].Value != "[Filtered]" {
+			t.Errorf("request = %+v", got.Request)
+		}
+	})
+}
@@ -0,0 +1,22 @@
+package webhook
+
+import "math"
+
+// levelRanks orders Sentry levels from least to most severe.
+var levelRanks = map[string]int{
+	"debug":   1,
+	"info":    2,
+	"warning": 3,
+	"error":   4,
+	"fatal":   5,
+}
+
+// Priority scores how urgently the error should be fixed; higher is more
+// urgent. The level dominates, so any fatal error outranks any warning, and
+// within a level errors affecting more users, then with more events, win.
+func (p *ParsedError) Priority() float64 {
+	// log10 keeps each impact term below 10 for any realistic count
+	users := math.Log10(1 + float64(max(p.UserCount, 0)))
+	events := math.Log10(1 + float64(max(p.EventCount, 0)))
+	return float64(levelRanks[p.Level])*100 + users*10 + events
+}
@@ -0,0 +1,23 @@
+package webhook
+
+import "testing"
+
+func TestParsedError_Priority(t *testing.T) {
+	// Ordered from most to least urgent
+	errs := []*ParsedError{
+		{IssueID: "fatal-many-users", Level: "fatal", UserCount: 5000, EventCount: 20000},
+		{IssueID: "fatal-few-users", Level: "fatal", UserCount: 3, EventCount: 900000},
+		{IssueID: "error-many-users", Level: "error", UserCount: 1000000, EventCount: 5000000},
+		{IssueID: "error-more-events", Level: "error", UserCount: 10, EventCount: 500},
+		{IssueID: "error-fewer-events", Level: "error", UserCount: 10, EventCount: 20},
+		{IssueID: "warning-long-tail", Level: "warning", UserCount: 1, EventCount: 1},
+		{IssueID: "unknown-level", Level: "", UserCount: 50, EventCount: 50},
+	}
+
+	for i := 1; i < len(errs); i++ {
+		if errs[i-1].Priority() <= errs[i].Priority() {
+			t.Errorf("%s priority %.2f should exceed %s priority %.2f",
+				errs[i-1].IssueID, errs[i-1].Priority(), errs[i].IssueID, errs[i].Priority())
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxIdleBuckets is how many buckets are kept before idle (full) ones are dropped.
+const maxIdleBuckets = 1000
+
+// RateLimiter is a per-project token bucket limiter for webhook deliveries,
+// so one project with an error storm can't monopolize the job queue.
+type RateLimiter struct {
+	rate  float64 // tokens per second
+	burst float64
+	now   func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter allows each project perMinute deliveries per minute, with
+// bursts of up to burst deliveries.
+func NewRateLimiter(perMinute, burst int) *RateLimiter {
+	if burst <= 0 {
+		burst = perMinute
+	}
+	return &RateLimiter{
+		rate:    float64(perMinute) / 60,
+		burst:   float64(burst),
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Allow takes a token for project. When none is available it returns false
+// and how long until one will be.
+func (l *RateLimiter) Allow(project string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if len(l.buckets) > maxIdleBuckets {
+		l.pruneIdle(now)
+	}
+
+	b, ok := l.buckets[project]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[project] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// pruneIdle drops buckets that have refilled completely. Callers must hold l.mu.
+func (l *RateLimiter) pruneIdle(now time.Time) {
+	for project, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, project)
+		}
+	}
+}
+
+// Middleware returns an HTTP middleware that rejects deliveries over the
+// project's limit with 429 and a Retry-After header.
+func (l *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			bodyError(w, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		project := projectSlug(body)
+		if ok, wait := l.Allow(project); !ok {
+			log.Printf("rate limit exceeded for project %q", project)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// projectSlug extracts the issue's project slug from a raw payload. Event-only
+// payloads have no issue, so their event's project, which Sentry sends as a
+// numeric ID, is used instead. It returns "" if the payload has neither.
+func projectSlug(body []byte) string {
+	var payload struct {
+		Data struct {
+			Issue *struct {
+				Project Project `json:"project"`
+			} `json:"issue"`
+			Event *struct {
+				Project json.RawMessage `json:"project"`
+			} `json:"event"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return ""
+	}
+	if issue := payload.Data.Issue; issue != nil && issue.Project.Slug != "" {
+		return issue.Project.Slug
+	}
+	if event := payload.Data.Event; event != nil && len(event.Project) > 0 && string(event.Project) != "null" {
+		return "project-id:" + strings.Trim(string(event.Project), `"`)
+	}
+	return ""
+}
@@ -0,0 +1,107 @@
+package webhook
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_Allow(t *testing.T) {
+	now := time.Date(2024, 6, 30, 12, 0, 0, 0, time.UTC)
+	limiter := NewRateLimiter(60, 2) // one per second, bursts of two
+	limiter.now = func() time.Time { return now }
+
+	steps := []struct {
+		name    string
+		advance time.Duration
+		project string
+		want    bool
+	}{
+		{"first in burst", 0, "api", true},
+		{"second in burst", 0, "api", true},
+		{"burst exhausted", 0, "api", false},
+		{"other project unaffected", 0, "web", true},
+		{"refilled after a second", time.Second, "api", true},
+		{"empty again", 0, "api", false},
+	}
+
+	for _, step := range steps {
+		now = now.Add(step.advance)
+		ok, wait := limiter.Allow(step.project)
+		if ok != step.want {
+			t.Errorf("%s: Allow() = %v, want %v", step.name, ok, step.want)
+		}
+		if !ok && wait <= 0 {
+			t.Errorf("%s: rejected without a retry delay", step.name)
+		}
+	}
+}
+
+func TestRateLimiter_Middleware(t *testing.T) {
+	limiter := NewRateLimiter(1, 1)
+	var served int
+	handler := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served++
+	}))
+
+	body := validWebhookPayload("created")
+	for i := 0; i < 2; i++ {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/webhook/sentry", strings.NewReader(body)))
+		if i == 1 {
+			if rr.Code != http.StatusTooManyRequests {
+				t.Errorf("status = %v, want %v", rr.Code, http.StatusTooManyRequests)
+			}
+			if rr.Header().Get("Retry-After") == "" {
+				t.Error("missing Retry-After header")
+			}
+		}
+	}
+
+	if served != 1 {
+		t.Errorf("served = %d, want 1", served)
+	}
+}
+
+func TestProjectSlug(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"issue", validWebhookPayload("created"), "test-project"},
+		{"event with numeric project", `{"data": {"event": {"issue_id": "42", "project": 7}}}`, "project-id:7"},
+		{"event with string project", `{"data": {"event": {"issue_id": "42", "project": "7"}}}`, "project-id:7"},
+		{"issue and event", `{"data": {"issue": {"project": {"slug": "api"}}, "event": {"project": 7}}}`, "api"},
+		{"event without project", `{"data": {"event": {"issue_id": "42"}}}`, ""},
+		{"invalid", `{`, ""},
+	}
+	for _, tt := range tests {
+		if got := projectSlug([]byte(tt.body)); got != tt.want {
+			t.Errorf("%s: projectSlug() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRateLimiter_MiddlewareEventPayloads(t *testing.T) {
+	limiter := NewRateLimiter(1, 1)
+	handler := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	send := func(project string) int {
+		body := `{"action": "triggered", "data": {"event": {"issue_id": "42", "project": ` + project + `}}}`
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/webhook/sentry", strings.NewReader(body)))
+		return rr.Code
+	}
+	if code := send("1"); code != http.StatusOK {
+		t.Fatalf("first event for project 1: status = %d", code)
+	}
+	if code := send("1"); code != http.StatusTooManyRequests {
+		t.Errorf("second event for project 1: status = %d, want %d", code, http.StatusTooManyRequests)
+	}
+	if code := send("2"); code != http.StatusOK {
+		t.Errorf("event for project 2 throttled by project 1: status = %d", code)
+	}
+}
@@ -0,0 +1,114 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// sensitiveHeaders are dropped from request entries before they reach the agent.
+var sensitiveHeaders = []string{
+	"Authorization",
+	"Cookie",
+	"Proxy-Authorization",
+	"Set-Cookie",
+	"X-Api-Key",
+	"X-Auth-Token",
+}
+
+// RequestData represents the HTTP request entry of an event.
+type RequestData struct {
+	URL      string    `json:"url"`
+	Method   string    `json:"method"`
+	Query    KeyValues `json:"query"`
+	Headers  KeyValues `json:"headers"`
+	Fragment string    `json:"fragment"`
+}
+
+// KeyValue is a single header or query parameter.
+type KeyValue struct {
+	Key   string
+	Value string
+}
+
+// KeyValues is an ordered list of headers or query parameters. Sentry sends
+// these as a list of [key, value] pairs, an object, or (for queries) a raw
+// query string.
+type KeyValues []KeyValue
+
+// UnmarshalJSON accepts every shape Sentry uses for headers and queries.
+func (kv *KeyValues) UnmarshalJSON(data []byte) error {
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	var out KeyValues
+	switch v := raw.(type) {
+	case nil:
+	case string:
+		values, err := url.ParseQuery(strings.TrimPrefix(v, "?"))
+		if err != nil {
+			return fmt.Errorf("invalid query string: %w", err)
+		}
+		for key, vals := range values {
+			for _, val := range vals {
+				out = append(out, KeyValue{Key: key, Value: val})
+			}
+		}
+		sort.SliceStable(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	case []interface{}:
+		for _, item := range v {
+			pair, ok := item.([]interface{})
+			if !ok || len(pair) != 2 {
+				return fmt.Errorf("expected [key, value] pair, got %v", item)
+			}
+			out = append(out, KeyValue{Key: fmt.Sprint(pair[0]), Value: stringify(pair[1])})
+		}
+	case map[string]interface{}:
+		for key, val := range v {
+			out = append(out, KeyValue{Key: key, Value: stringify(val)})
+		}
+		sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	default:
+		return fmt.Errorf("unexpected %T for key/value list", raw)
+	}
+
+	*kv = out
+	return nil
+}
+
+// Without returns the entries whose keys don't match any of keys, ignoring case.
+func (kv KeyValues) Without(keys []string) KeyValues {
+	var out KeyValues
+	for _, entry := range kv {
+		drop := false
+		for _, key := range keys {
+			if strings.EqualFold(entry.Key, key) {
+				drop = true
+				break
+			}
+		}
+		if !drop {
+			out = append(out, entry)
+		}
+	}
+	return out
+}
+
+func stringify(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(data)
+	}
+}
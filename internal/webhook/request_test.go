@@ -0,0 +1,71 @@
+package webhook
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestKeyValues_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    KeyValues
+		wantErr bool
+	}{
+		{"pairs", `[["Accept","text/html"],["X-Count",3]]`, KeyValues{{"Accept", "text/html"}, {"X-Count", "3"}}, false},
+		{"object", `{"b":"2","a":"1"}`, KeyValues{{"a", "1"}, {"b", "2"}}, false},
+		{"query string", `"?page=2&q=x"`, KeyValues{{"page", "2"}, {"q", "x"}}, false},
+		{"null", `null`, nil, false},
+		{"bad pair", `[["only-key"]]`, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got KeyValues
+			err := json.Unmarshal([]byte(tt.input), &got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Errorf("entry %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParsePayload_Request(t *testing.T) {
+	body := `{
+		"action": "created",
+		"data": {
+			"issue": {"id": "1"},
+			"event": {"entries": [{"type": "request", "data": {
+				"url": "https://api.example.com/users",
+				"method": "POST",
+				"query": [["page", "2"]],
+				"headers": [["Content-Type", "application/json"], ["Authorization", "Bearer secret"], ["cookie", "session=abc"]]
+			}}]}
+		}
+	}`
+
+	_, parsed, err := ParsePayload([]byte(body))
+	if err != nil {
+		t.Fatalf("ParsePayload() error = %v", err)
+	}
+	if parsed.Request == nil {
+		t.Fatal("Request is nil")
+	}
+	if parsed.Request.Method != "POST" || parsed.Request.URL != "https://api.example.com/users" {
+		t.Errorf("Request = %+v", parsed.Request)
+	}
+	if len(parsed.Request.Query) != 1 || parsed.Request.Query[0].Value != "2" {
+		t.Errorf("Query = %+v", parsed.Request.Query)
+	}
+	if len(parsed.Request.Headers) != 1 || parsed.Request.Headers[0].Key != "Content-Type" {
+		t.Errorf("Headers = %+v, want sensitive headers dropped", parsed.Request.Headers)
+	}
+}
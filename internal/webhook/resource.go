@@ -0,0 +1,66 @@
+package webhook
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// resourceCheck decides whether a delivery for one Sentry-Hook-Resource is
+// processed. It returns a reason when the delivery should be acknowledged
+// without being processed.
+type resourceCheck func(wh *SentryWebhook) string
+
+// resourceChecks dispatches on the Sentry-Hook-Resource header.
+var resourceChecks = map[string]resourceCheck{
+	"issue":        checkIssueResource,
+	"event_alert":  checkEventAlertResource,
+	"metric_alert": ignoreResource("metric alerts are not tied to an issue"),
+	"installation": ignoreResource("installation lifecycle event"),
+}
+
+// checkResource checks a delivery according to its Sentry-Hook-Resource
+// header. Deliveries without the header (e.g. from older integrations) are
+// dispatched on the action alone. It returns "" for deliveries that carry an
+// error to fix, which is parsed once the delivery has its issue.
+func checkResource(r *http.Request, wh *SentryWebhook) string {
+	resource := r.Header.Get("Sentry-Hook-Resource")
+	if resource == "" {
+		return checkAction(wh)
+	}
+
+	check, ok := resourceChecks[resource]
+	if !ok {
+		return fmt.Sprintf("unknown resource %q", resource)
+	}
+	return check(wh)
+}
+
+// checkIssueResource handles issue deliveries; only newly created issues are fixed.
+func checkIssueResource(wh *SentryWebhook) string {
+	if wh.Action != "created" {
+		return fmt.Sprintf("ignoring issue action %q", wh.Action)
+	}
+	return ""
+}
+
+// checkEventAlertResource handles alert rule actions firing for an event.
+func checkEventAlertResource(wh *SentryWebhook) string {
+	if wh.Action != "triggered" {
+		return fmt.Sprintf("ignoring event_alert action %q", wh.Action)
+	}
+	return ""
+}
+
+// checkAction handles deliveries that don't identify their resource.
+func checkAction(wh *SentryWebhook) string {
+	if wh.Action != "created" && wh.Action != "triggered" {
+		return fmt.Sprintf("ignoring webhook action %q", wh.Action)
+	}
+	return ""
+}
+
+func ignoreResource(reason string) resourceCheck {
+	return func(*SentryWebhook) string {
+		return reason
+	}
+}
@@ -10,13 +10,19 @@ import (
 
 // SignatureVerifier verifies Sentry webhook signatures.
 type SignatureVerifier struct {
-	secret []byte
+	secret func() string
 }
 
 // NewSignatureVerifier creates a new signature verifier.
 func NewSignatureVerifier(secret string) *SignatureVerifier {
+	return NewRotatingSignatureVerifier(func() string { return secret })
+}
+
+// NewRotatingSignatureVerifier creates a signature verifier that looks up
+// the secret for every request, so it can be rotated without a restart.
+func NewRotatingSignatureVerifier(secret func() string) *SignatureVerifier {
 	return &SignatureVerifier{
-		secret: []byte(secret),
+		secret: secret,
 	}
 }
 
@@ -28,7 +34,7 @@ func (v *SignatureVerifier) Verify(signature string, body []byte) bool {
 	}
 
 	// Compute expected signature
-	mac := hmac.New(sha256.New, v.secret)
+	mac := hmac.New(sha256.New, []byte(v.secret()))
 	mac.Write(body)
 	expected := hex.EncodeToString(mac.Sum(nil))
 
@@ -49,7 +55,7 @@ func (v *SignatureVerifier) Middleware(next http.Handler) http.Handler {
 		// Read and buffer body
 		body, err := io.ReadAll(r.Body)
 		if err != nil {
-			http.Error(w, "failed to read body", http.StatusBadRequest)
+			bodyError(w, err)
 			return
 		}
 
@@ -122,6 +122,24 @@ func TestSignatureVerifier_Middleware(t *testing.T) {
 	}
 }
 
+func TestRotatingSignatureVerifier(t *testing.T) {
+	secret := "old-secret"
+	verifier := NewRotatingSignatureVerifier(func() string { return secret })
+	body := []byte(`{"action":"created"}`)
+
+	if !verifier.Verify(computeSignature("old-secret", body), body) {
+		t.Fatal("Verify() rejected the current secret")
+	}
+
+	secret = "new-secret"
+	if verifier.Verify(computeSignature("old-secret", body), body) {
+		t.Error("Verify() accepted the rotated-out secret")
+	}
+	if !verifier.Verify(computeSignature("new-secret", body), body) {
+		t.Error("Verify() rejected the rotated-in secret")
+	}
+}
+
 func computeSignature(secret string, body []byte) string {
 	mac := hmac.New(sha256.New, []byte(secret))
 	mac.Write(body)
@@ -1,6 +1,14 @@
 package webhook
 
-import "time"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+)
 
 // SentryWebhook represents the incoming Sentry webhook payload.
 type SentryWebhook struct {
@@ -64,6 +72,11 @@ type Event struct {
 	Title      string      `json:"title"`
 	Type       string      `json:"type"`
 	User       *User       `json:"user,omitempty"`
+
+	// Set on event-only payloads such as event alerts, which reference their
+	// issue instead of embedding it.
+	IssueID  string `json:"issue_id,omitempty"`
+	IssueURL string `json:"issue_url,omitempty"`
 }
 
 // Contexts contains runtime context information.
@@ -74,10 +87,11 @@ type Contexts struct {
 	Device   map[string]interface{} `json:"device,omitempty"`
 }
 
-// Entry represents an event entry (exception, breadcrumbs, etc.).
+// Entry represents an event entry (exception, breadcrumbs, etc.). Data is
+// decoded according to Type.
 type Entry struct {
-	Type string      `json:"type"`
-	Data interface{} `json:"data"`
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
 }
 
 // ExceptionData represents exception entry data.
@@ -94,6 +108,21 @@ type ExceptionValue struct {
 	Mechanism  *Mechanism `json:"mechanism,omitempty"`
 }
 
+// ThreadsData represents threads entry data. Platforms such as Go panics and
+// native crashes report their stack traces here instead of under exceptions.
+type ThreadsData struct {
+	Values []Thread `json:"values"`
+}
+
+// Thread represents a single thread captured with an event.
+type Thread struct {
+	ID         interface{} `json:"id"`
+	Name       string      `json:"name"`
+	Crashed    bool        `json:"crashed"`
+	Current    bool        `json:"current"`
+	Stacktrace *Stacktrace `json:"stacktrace,omitempty"`
+}
+
 // Stacktrace represents an exception stacktrace.
 type Stacktrace struct {
 	Frames []Frame `json:"frames"`
@@ -113,7 +142,74 @@ type Frame struct {
 	Context     [][]interface{}        `json:"context"`
 	Vars        map[string]interface{} `json:"vars"`
 	PreContext  []string               `json:"preContext"`
+	ContextLine string                 `json:"contextLine"`
 	PostContext []string               `json:"postContext"`
+
+	// InstructionAddr is set on native frames; those without a Function
+	// have not been symbolicated.
+	InstructionAddr string `json:"instructionAddr,omitempty"`
+}
+
+// Culprit returns the thread that most likely caused the event: the crashed
+// thread, else the current one, else the first with a stack trace.
+func (t *ThreadsData) Culprit() *Thread {
+	var current, first *Thread
+	for i := range t.Values {
+		thread := &t.Values[i]
+		if thread.Stacktrace == nil || len(thread.Stacktrace.Frames) == 0 {
+			continue
+		}
+		if thread.Crashed {
+			return thread
+		}
+		if thread.Current && current == nil {
+			current = thread
+		}
+		if first == nil {
+			first = thread
+		}
+	}
+	if current != nil {
+		return current
+	}
+	return first
+}
+
+// ContextLine is a line of source code around a frame.
+type ContextLine struct {
+	LineNo int
+	Code   string
+}
+
+// ContextLines returns the source around the frame. It prefers Sentry's
+// numbered context and falls back to the pre/post context lists.
+func (f Frame) ContextLines() []ContextLine {
+	var lines []ContextLine
+	for _, c := range f.Context {
+		if len(c) != 2 {
+			continue
+		}
+		lineNo, ok := c[0].(float64)
+		if !ok {
+			continue
+		}
+		code, _ := c[1].(string)
+		lines = append(lines, ContextLine{LineNo: int(lineNo), Code: code})
+	}
+	if len(lines) > 0 || f.LineNo == 0 {
+		return lines
+	}
+
+	for i, code := range f.PreContext {
+		lines = append(lines, ContextLine{LineNo: f.LineNo - len(f.PreContext) + i, Code: code})
+	}
+	if f.ContextLine != "" {
+		lines = append(lines, ContextLine{LineNo: f.LineNo, Code: f.ContextLine})
+	}
+	for i, code := range f.PostContext {
+		lines = append(lines, ContextLine{LineNo: f.LineNo + 1 + i, Code: code})
+	}
+	return lines
 }
 
 // Mechanism represents error mechanism info.
@@ -152,6 +248,7 @@ type Actor struct {
 // ParsedError extracts key error information for the agent.
 type ParsedError struct {
 	IssueID      string
+	ShortID      string
 	ProjectSlug  string
 	Title        string
 	ErrorType    string
@@ -161,6 +258,49 @@ type ParsedError struct {
 	Culprit      string
 	Frames       []Frame
 	Permalink    string
+	Tags         map[string]string
+	Release      string
+	Environment  string
+	ServerName   string
+	Request      *RequestData
+	// EventCount and UserCount measure the issue's impact so far.
+	EventCount int
+	UserCount  int
+	// Minified is set when in-app frames point at minified JavaScript, whose
+	// locations need sourcemaps to map back to the original source.
+	Minified bool
+
+	// Contexts summarizes the runtime, OS, browser and device, e.g.
+	// {"runtime": "CPython 3.11.4"}.
+	Contexts map[string]string
+	// Breadcrumbs are the latest events leading up to the error, oldest
+	// first.
+	Breadcrumbs []Breadcrumb
+}
+
+// Fingerprint identifies near-identical errors across Sentry issues using the
+// culprit, error type and the top in-app frame.
+func (p *ParsedError) Fingerprint() string {
+	var top string
+	for i := len(p.Frames) - 1; i >= 0; i-- {
+		if p.Frames[i].InApp {
+			top = p.Frames[i].Filename + ":" + p.Frames[i].Function
+			break
+		}
+	}
+
+	sum := sha256.Sum256([]byte(p.Culprit + "\x00" + p.ErrorType + "\x00" + top))
+	return hex.EncodeToString(sum[:8])
+}
+
+// ParsePayload decodes a raw webhook body and extracts its error information.
+// It returns a nil ParsedError if the payload carries no issue.
+func ParsePayload(body []byte) (*SentryWebhook, *ParsedError, error) {
+	var wh SentryWebhook
+	if err := json.Unmarshal(body, &wh); err != nil {
+		return nil, nil, fmt.Errorf("invalid payload: %w", err)
+	}
+	return &wh, ParseWebhook(&wh), nil
 }
 
 // ParseWebhook extracts error information from the webhook payload.
@@ -171,6 +311,7 @@ func ParseWebhook(wh *SentryWebhook) *ParsedError {
 
 	parsed := &ParsedError{
 		IssueID:      wh.Data.Issue.ID,
+		ShortID:      wh.Data.Issue.ShortID,
 		ProjectSlug:  wh.Data.Issue.Project.Slug,
 		Title:        wh.Data.Issue.Title,
 		ErrorType:    wh.Data.Issue.Metadata.Type,
@@ -180,60 +321,79 @@ func ParseWebhook(wh *SentryWebhook) *ParsedError {
 		Culprit:      wh.Data.Issue.Culprit,
 		Permalink:    wh.Data.Issue.Permalink,
 		Frames:       make([]Frame, 0),
+		Tags:         make(map[string]string),
+		UserCount:    wh.Data.Issue.UserCount,
+	}
+	// Sentry sends the event count as a string
+	parsed.EventCount, _ = strconv.Atoi(wh.Data.Issue.Count)
+
+	// Extract tags from event if available
+	if wh.Data.Event != nil {
+		for _, tag := range wh.Data.Event.Tags {
+			parsed.Tags[tag.Key] = tag.Value
+		}
+		parsed.Release = parsed.Tags["release"]
+		parsed.Environment = parsed.Tags["environment"]
+		parsed.ServerName = parsed.Tags["server_name"]
+		parsed.Contexts = wh.Data.Event.Contexts.Summary()
 	}
 
-	// Extract frames from event if available
+	// Extract frames and request details from event entries if available
 	if wh.Data.Event != nil {
+		var threads *ThreadsData
 		for _, entry := range wh.Data.Event.Entries {
-			if entry.Type == "exception" {
-				if data, ok := entry.Data.(map[string]interface{}); ok {
-					if values, ok := data["values"].([]interface{}); ok {
-						for _, v := range values {
-							if val, ok := v.(map[string]interface{}); ok {
-								if st, ok := val["stacktrace"].(map[string]interface{}); ok {
-									if frames, ok := st["frames"].([]interface{}); ok {
-										for _, f := range frames {
-											if fm, ok := f.(map[string]interface{}); ok {
-												frame := Frame{
-													InApp: getBool(fm, "inApp"),
-												}
-												if filename, ok := fm["filename"].(string); ok {
-													frame.Filename = filename
-												}
-												if absPath, ok := fm["absPath"].(string); ok {
-													frame.AbsPath = absPath
-												}
-												if function, ok := fm["function"].(string); ok {
-													frame.Function = function
-												}
-												if lineNo, ok := fm["lineNo"].(float64); ok {
-													frame.LineNo = int(lineNo)
-												}
-												if colNo, ok := fm["colNo"].(float64); ok {
-													frame.ColNo = int(colNo)
-												}
-												if module, ok := fm["module"].(string); ok {
-													frame.Module = module
-												}
-												parsed.Frames = append(parsed.Frames, frame)
-											}
-										}
-									}
-								}
-							}
-						}
-					}
+			switch entry.Type {
+			case "exception":
+				var data ExceptionData
+				if err := json.Unmarshal(entry.Data, &data); err != nil {
+					log.Printf("skipping malformed exception entry in issue %s: %v", parsed.IssueID, err)
+					continue
+				}
+				for _, value := range data.Values {
+					parsed.Frames = append(parsed.Frames, value.Stacktrace.Frames...)
 				}
+			case "request":
+				var data RequestData
+				if err := json.Unmarshal(entry.Data, &data); err != nil {
+					log.Printf("skipping malformed request entry in issue %s: %v", parsed.IssueID, err)
+					continue
+				}
+				data.Headers = data.Headers.Without(sensitiveHeaders)
+				parsed.Request = &data
+			case "threads":
+				var data ThreadsData
+				if err := json.Unmarshal(entry.Data, &data); err != nil {
+					log.Printf("skipping malformed threads entry in issue %s: %v", parsed.IssueID, err)
+					continue
+				}
+				threads = &data
+			case "breadcrumbs":
+				var data BreadcrumbsData
+				if err := json.Unmarshal(entry.Data, &data); err != nil {
+					log.Printf("skipping malformed breadcrumbs entry in issue %s: %v", parsed.IssueID, err)
+					continue
+				}
+				if len(data.Values) > maxBreadcrumbs {
+					data.Values = data.Values[len(data.Values)-maxBreadcrumbs:]
+				}
+				parsed.Breadcrumbs = data.Values
 			}
 		}
-	}
 
-	return parsed
-}
+		// Fall back to the crashing thread when there is no exception stack
+		if len(parsed.Frames) == 0 && threads != nil {
+			if thread := threads.Culprit(); thread != nil {
+				parsed.Frames = append(parsed.Frames, thread.Stacktrace.Frames...)
+			}
+		}
+	}
 
-func getBool(m map[string]interface{}, key string) bool {
-	if v, ok := m[key].(bool); ok {
-		return v
+	for _, frame := range parsed.Frames {
+		if frame.InApp && frame.IsMinified() {
+			parsed.Minified = true
+			break
+		}
 	}
-	return false
+
+	return parsed
 }